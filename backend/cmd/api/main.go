@@ -11,6 +11,8 @@ import (
 
 	"caiatech-datalab/backend/internal/api"
 	"caiatech-datalab/backend/internal/db"
+	"caiatech-datalab/backend/internal/llm"
+	"caiatech-datalab/backend/internal/models"
 )
 
 func main() {
@@ -26,11 +28,42 @@ func main() {
 		log.Fatalf("db migrate: %v", err)
 	}
 
+	if n, err := models.PurgeExpiredIdempotencyKeys(context.Background(), database); err != nil {
+		log.Printf("purge idempotency keys: %v", err)
+	} else if n > 0 {
+		log.Printf("purged %d expired idempotency keys", n)
+	}
+
 	h := api.NewHandler(api.HandlerDeps{
-		DB:         database,
-		AdminToken: cfg.AdminToken,
+		DB:            database,
+		AdminToken:    cfg.AdminToken,
+		BannedPhrases: cfg.BannedPhrases,
+		AuthHeader:    cfg.AuthHeader,
+
+		RequireLicense:    cfg.RequireLicense,
+		StrictAlternation: cfg.StrictAlternation,
+		MaxExportRows:     cfg.MaxExportRows,
+
+		MaxMessages:            cfg.MaxMessages,
+		MaxMessageContentBytes: cfg.MaxMessageContentBytes,
+		MaxMessageMetaBytes:    cfg.MaxMessageMetaBytes,
+		DatasetCacheTTL:        cfg.DatasetCacheTTL,
+		DatasetLockTTL:         cfg.DatasetLockTTL,
+
+		LLM: llm.New(cfg.LLMBaseURL, cfg.LLMAPIKey, cfg.LLMModel, cfg.LLMTimeout),
+
+		Embedder:       llm.New(cfg.EmbedBaseURL, cfg.EmbedAPIKey, cfg.EmbedModel, cfg.LLMTimeout),
+		EmbedIndex:     cfg.EmbedIndex,
+		EmbedBatchSize: cfg.EmbedBatchSize,
 	})
 
+	if err := h.ResumeGenerationJobs(context.Background()); err != nil {
+		log.Printf("resume generation jobs: %v", err)
+	}
+	statsCtx, stopStats := context.WithCancel(context.Background())
+	defer stopStats()
+	go h.RunStatsSnapshots(statsCtx, cfg.StatsSnapshotInterval, cfg.StatsRetention)
+
 	srv := &http.Server{
 		Addr:              cfg.ListenAddr,
 		Handler:           h.Routes(),
@@ -48,8 +81,18 @@ func main() {
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	<-stop
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	stopStats()
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
+	log.Printf("api draining (timeout %s)", cfg.ShutdownTimeout)
+	drained := make(chan error, 1)
+	go func() { drained <- h.DrainExports(ctx) }()
 	_ = srv.Shutdown(ctx)
+	if err := <-drained; err != nil {
+		log.Printf("shutdown: exports still running: %v", err)
+	}
+	if err := h.StopGenerationJobs(ctx); err != nil {
+		log.Printf("shutdown: generation jobs still running: %v", err)
+	}
 	log.Printf("api stopped")
 }
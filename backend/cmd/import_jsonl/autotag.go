@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"caiatech-datalab/backend/internal/models"
+)
+
+// autoTagRule adds tags to conversations whose field matches pattern.
+type autoTagRule struct {
+	raw     string
+	field   string
+	pattern *regexp.Regexp
+	tags    []string
+}
+
+// autoTagRules collects repeated --auto-tag flags.
+type autoTagRules []autoTagRule
+
+func (r *autoTagRules) String() string {
+	if r == nil {
+		return ""
+	}
+	raws := make([]string, 0, len(*r))
+	for _, rule := range *r {
+		raws = append(raws, rule.raw)
+	}
+	return strings.Join(raws, " ")
+}
+
+// Set parses one --auto-tag rule, "field~=pattern:tag[,tag...]". The pattern is a
+// case-insensitive regular expression; the tags follow its last colon.
+func (r *autoTagRules) Set(s string) error {
+	field, rest, ok := strings.Cut(s, "~=")
+	field = strings.ToLower(strings.TrimSpace(field))
+	if !ok {
+		return fmt.Errorf("invalid --auto-tag %q (want field~=pattern:tags)", s)
+	}
+	if field != "source" && field != "notes" {
+		return fmt.Errorf("unknown --auto-tag field %q (expected source|notes)", field)
+	}
+	i := strings.LastIndex(rest, ":")
+	if i < 0 {
+		return fmt.Errorf("invalid --auto-tag %q (want field~=pattern:tags)", s)
+	}
+	pattern, tags := rest[:i], parseTags(rest[i+1:])
+	if pattern == "" || len(tags) == 0 {
+		return fmt.Errorf("invalid --auto-tag %q (empty pattern or tags)", s)
+	}
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return fmt.Errorf("invalid --auto-tag pattern %q: %v", pattern, err)
+	}
+	*r = append(*r, autoTagRule{raw: s, field: field, pattern: re, tags: tags})
+	return nil
+}
+
+// apply adds the tags of every matching rule to conv, skipping tags it already has
+// (case-insensitively).
+func (r autoTagRules) apply(conv *models.Conversation) {
+	if len(r) == 0 {
+		return
+	}
+	// conv.Tags may be the shared --tags default, so build a fresh slice.
+	tags := append([]string(nil), conv.Tags...)
+	seen := map[string]bool{}
+	for _, t := range tags {
+		seen[strings.ToLower(t)] = true
+	}
+	for _, rule := range r {
+		value := conv.Source
+		if rule.field == "notes" {
+			value = conv.Notes
+		}
+		if !rule.pattern.MatchString(value) {
+			continue
+		}
+		for _, t := range rule.tags {
+			if key := strings.ToLower(t); !seen[key] {
+				seen[key] = true
+				tags = append(tags, t)
+			}
+		}
+	}
+	conv.Tags = tags
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"caiatech-datalab/backend/internal/models"
+)
+
+func TestAutoTagRules(t *testing.T) {
+	var rules autoTagRules
+	for _, s := range []string{"source~=support:customer-support", "source~=^zendesk-(eu|us)$:zendesk,Support", "notes~=refund:billing"} {
+		if err := rules.Set(s); err != nil {
+			t.Fatalf("%q: %v", s, err)
+		}
+	}
+
+	defaults := []string{"imported"}
+	conv := models.Conversation{Source: "Zendesk-EU", Tags: defaults}
+	rules.apply(&conv)
+	if want := []string{"imported", "zendesk", "Support"}; !reflect.DeepEqual(conv.Tags, want) {
+		t.Fatalf("expected %v, got %v", want, conv.Tags)
+	}
+	if len(defaults) != 1 || cap(defaults) != 1 {
+		t.Fatalf("shared default tags were modified: %v", defaults)
+	}
+
+	conv = models.Conversation{Source: "support-desk", Notes: "asked for a refund", Tags: []string{"Billing"}}
+	rules.apply(&conv)
+	if want := []string{"Billing", "customer-support"}; !reflect.DeepEqual(conv.Tags, want) {
+		t.Fatalf("expected %v, got %v", want, conv.Tags)
+	}
+
+	conv = models.Conversation{Source: "forum"}
+	rules.apply(&conv)
+	if len(conv.Tags) != 0 {
+		t.Fatalf("expected no tags, got %v", conv.Tags)
+	}
+}
+
+func TestAutoTagRules_RejectsBadRules(t *testing.T) {
+	for _, s := range []string{"source=support:x", "lang~=en:x", "source~=support", "source~=:x", "source~=support:", "source~=(:x"} {
+		var rules autoTagRules
+		if err := rules.Set(s); err == nil {
+			t.Fatalf("%q: expected an error", s)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	badFormatJSONL = "jsonl"
+	badFormatRaw   = "raw"
+)
+
+// badRecord is one --bad-out line in --bad-format jsonl.
+type badRecord struct {
+	Line   int    `json:"line,omitempty"` // input line number (JSONL input only)
+	Where  string `json:"where"`          // "line N", "row N", hf source_ref or chat export ref
+	Reason string `json:"reason"`
+	Error  string `json:"error"`
+	Raw    string `json:"raw"`
+}
+
+// maxFirstErrors is how many skipped rows a dry run lists in full.
+const maxFirstErrors = 5
+
+// badSink writes skipped rows to --bad-out and tallies why they were skipped.
+type badSink struct {
+	w       io.Writer // nil when --bad-out is unset
+	format  string
+	reasons map[string]int
+	first   []string
+}
+
+func newBadSink(w io.Writer, format string) (*badSink, error) {
+	switch format {
+	case badFormatJSONL, badFormatRaw:
+	default:
+		return nil, fmt.Errorf("unknown --bad-format %q (expected jsonl|raw)", format)
+	}
+	return &badSink{w: w, format: format, reasons: map[string]int{}}, nil
+}
+
+func (s *badSink) record(rec badRecord) error {
+	s.reasons[reasonKey(rec.Reason, rec.Error)]++
+	if len(s.first) < maxFirstErrors {
+		s.first = append(s.first, fmt.Sprintf("%s: %s: %s", rec.Where, rec.Reason, rec.Error))
+	}
+	if s.w == nil {
+		return nil
+	}
+	if s.format == badFormatRaw {
+		_, err := io.WriteString(s.w, rec.Raw+"\n")
+		return err
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+var digitsRe = regexp.MustCompile(`\d+`)
+
+// reasonKey groups errors that differ only in positions or sizes, e.g. "invalid role at
+// message 2" and "... message 5" both count as "invalid role at message N".
+func reasonKey(reason, errText string) string {
+	if errText == "" {
+		return reason
+	}
+	return reason + ": " + digitsRe.ReplaceAllString(errText, "N")
+}
+
+// firstErrors returns the first few skipped rows as "where: reason: error".
+func (s *badSink) firstErrors() []string {
+	return s.first
+}
+
+// summary renders the reason counts, most frequent first, for the final log line.
+func (s *badSink) summary() string {
+	keys := make([]string, 0, len(s.reasons))
+	for k := range s.reasons {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if s.reasons[keys[i]] != s.reasons[keys[j]] {
+			return s.reasons[keys[i]] > s.reasons[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s (%d)", k, s.reasons[k])
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestBadSink_JSONL(t *testing.T) {
+	var buf bytes.Buffer
+	sink, err := newBadSink(&buf, badFormatJSONL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = sink.record(badRecord{Line: 123, Where: "line 123", Reason: "invalid record", Error: "invalid role at message 2", Raw: `{"x":1}`})
+	_ = sink.record(badRecord{Line: 130, Where: "line 130", Reason: "invalid record", Error: "invalid role at message 5", Raw: `{"x":2}`})
+	_ = sink.record(badRecord{Line: 131, Where: "line 131", Reason: "invalid json", Error: "not valid JSON", Raw: `{`})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 records, got %q", buf.String())
+	}
+	var rec badRecord
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Line != 123 || rec.Error != "invalid role at message 2" || rec.Raw != `{"x":1}` {
+		t.Fatalf("unexpected record: %+v", rec)
+	}
+
+	if first := sink.firstErrors(); len(first) != 3 || first[0] != "line 123: invalid record: invalid role at message 2" {
+		t.Fatalf("unexpected first errors: %q", first)
+	}
+
+	want := "invalid record: invalid role at message N (2); invalid json: not valid JSON (1)"
+	if got := sink.summary(); got != want {
+		t.Fatalf("summary = %q, want %q", got, want)
+	}
+}
+
+func TestBadSink_RawAndCountOnly(t *testing.T) {
+	var buf bytes.Buffer
+	sink, _ := newBadSink(&buf, badFormatRaw)
+	_ = sink.record(badRecord{Reason: "invalid json", Error: "x", Raw: "not json"})
+	if buf.String() != "not json\n" {
+		t.Fatalf("raw format should write the line as-is, got %q", buf.String())
+	}
+
+	// Without --bad-out reasons are still counted for the summary.
+	sink, _ = newBadSink(nil, badFormatJSONL)
+	_ = sink.record(badRecord{Reason: "invalid json", Error: "x"})
+	if sink.summary() != "invalid json: x (1)" {
+		t.Fatalf("unexpected summary %q", sink.summary())
+	}
+
+	if _, err := newBadSink(nil, "csv"); err == nil {
+		t.Fatalf("expected unknown format to be rejected")
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"caiatech-datalab/backend/internal/models"
+)
+
+// formatOpenAIBatchResults reads the output file of an OpenAI Batch API run over a
+// type=openai_batch export and stores each answer as a draft alternative of the assistant
+// message its custom_id names, for comparison with the gold reply.
+const formatOpenAIBatchResults = "openai_batch_results"
+
+// batchResultLine is the part of a Batch API output line the import reads.
+type batchResultLine struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int `json:"status_code"`
+		Body       struct {
+			Model   string `json:"model"`
+			Choices []struct {
+				Message struct {
+					Content string `json:"content"`
+				} `json:"message"`
+			} `json:"choices"`
+		} `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// batchAnswer is a model's answer for the assistant message row MessageID.
+type batchAnswer struct {
+	ConversationID int64
+	MessageID      int64
+	Model          string
+	Content        string
+}
+
+// parseBatchResult reads one output line; on failure it returns the --bad-out reason too.
+func parseBatchResult(raw []byte) (batchAnswer, string, error) {
+	var line batchResultLine
+	if err := json.Unmarshal(raw, &line); err != nil {
+		return batchAnswer{}, "invalid json", err
+	}
+	convID, msgID, err := models.ParseBatchCustomID(line.CustomID)
+	if err != nil {
+		return batchAnswer{}, "invalid custom_id", err
+	}
+	if line.Error != nil {
+		return batchAnswer{}, "request failed", fmt.Errorf("%s: %s", line.Error.Code, line.Error.Message)
+	}
+	if line.Response == nil || line.Response.StatusCode != 200 {
+		status := 0
+		if line.Response != nil {
+			status = line.Response.StatusCode
+		}
+		return batchAnswer{}, "request failed", fmt.Errorf("status %d", status)
+	}
+	body := line.Response.Body
+	if len(body.Choices) == 0 || strings.TrimSpace(body.Choices[0].Message.Content) == "" {
+		return batchAnswer{}, "empty answer", errors.New("response has no answer text")
+	}
+	return batchAnswer{ConversationID: convID, MessageID: msgID, Model: body.Model, Content: body.Choices[0].Message.Content}, "", nil
+}
+
+// checkBatchAnswer runs the content checks POST /api/v1/conversations/{id}/alternatives
+// applies; on failure it returns the --bad-out reason too.
+func checkBatchAnswer(ans batchAnswer, banned *models.PhraseFilter, limits models.MessageLimits) (string, error) {
+	if phrase, ok := banned.Match(ans.Content); ok {
+		return "banned phrase", fmt.Errorf("answer contains banned phrase %q", phrase)
+	}
+	if err := limits.CheckContent(-1, ans.Content); err != nil {
+		return invalidRecordReason(err), err
+	}
+	return "", nil
+}
+
+// attachBatchAnswer stores ans as a draft alternative of its message row, which must still
+// exist and be an assistant message; on failure it returns the --bad-out reason too. A
+// rewrite of the conversation's messages since the export replaces the rows, so its answers
+// are refused as unknown rather than attached to whatever reply now sits at their old idx. A
+// dataset locked since the export is refused by the lock triggers and reported as such.
+func attachBatchAnswer(ctx context.Context, database *sql.DB, ans batchAnswer) (string, error) {
+	msgs, err := models.LoadConversationMessages(ctx, database, ans.ConversationID)
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		return "", err
+	}
+	idx := slices.IndexFunc(msgs, func(m models.Message) bool { return m.ID == ans.MessageID })
+	if idx < 0 {
+		return "unknown message", fmt.Errorf("conversation %d has no message %d", ans.ConversationID, ans.MessageID)
+	}
+	if err := models.CheckAlternativeTarget(msgs, idx); err != nil {
+		return "not an assistant message", err
+	}
+	_, err = models.CreateMessageAlternative(ctx, database, models.MessageAlternative{
+		ConversationID: ans.ConversationID,
+		MessageID:      ans.MessageID,
+		Content:        ans.Content,
+		Model:          ans.Model,
+	})
+	switch {
+	case err == nil:
+		return "", nil
+	case errors.Is(err, models.ErrNotFound):
+		return "unknown message", fmt.Errorf("conversation %d has no assistant message %d", ans.ConversationID, ans.MessageID)
+	case models.AsLockedError(err) != nil:
+		return "dataset locked", models.AsLockedError(err)
+	default:
+		return "", err
+	}
+}
+
+// importBatchResults stores the answers of in as message alternatives, with the checks of
+// the API: banned phrases, content limits, an assistant message as target and an unlocked
+// dataset. Lines that fail to parse, failed requests and answers failing a check go to
+// sink. A dry run only parses and checks content, and exits 1 when any line was bad.
+func importBatchResults(ctx context.Context, database *sql.DB, in io.Reader, sink *badSink, banned *models.PhraseFilter, limits models.MessageLimits, dryRun, skipBad bool, max int) {
+	started := time.Now()
+	imported, bad, lineNo := 0, 0, 0
+	recordBad := func(raw, reason string, err error) {
+		bad++
+		where := fmt.Sprintf("line %d", lineNo)
+		_ = sink.record(badRecord{Line: lineNo, Where: where, Reason: reason, Error: err.Error(), Raw: raw})
+		if !skipBad {
+			log.Fatalf("%s: %s: %v", where, reason, err)
+		}
+	}
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 1024*1024), 50*1024*1024)
+	for scanner.Scan() {
+		lineNo++
+		raw := strings.TrimSpace(scanner.Text())
+		if raw == "" {
+			continue
+		}
+		ans, reason, err := parseBatchResult([]byte(raw))
+		if err != nil {
+			recordBad(raw, reason, err)
+			continue
+		}
+		if reason, err := checkBatchAnswer(ans, banned, limits); err != nil {
+			recordBad(raw, reason, err)
+			continue
+		}
+		if !dryRun {
+			if reason, err := attachBatchAnswer(ctx, database, ans); err != nil {
+				if reason == "" {
+					log.Fatalf("line %d: store answer: %v", lineNo, err)
+				}
+				recordBad(raw, reason, err)
+				continue
+			}
+		}
+		imported++
+		if max > 0 && imported >= max {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatalf("scan: %v", err)
+	}
+
+	elapsed := time.Since(started).Truncate(time.Second)
+	if dryRun {
+		log.Printf("dry run done: would attach=%d bad=%d elapsed=%s", imported, bad, elapsed)
+		for _, e := range sink.firstErrors() {
+			log.Printf("  %s", e)
+		}
+	} else {
+		log.Printf("done attached=%d bad=%d elapsed=%s", imported, bad, elapsed)
+		log.Printf("review with GET /api/v1/conversations/{id}/alternatives")
+	}
+	if bad > 0 {
+		log.Printf("bad reasons: %s", sink.summary())
+		if dryRun {
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"caiatech-datalab/backend/internal/models"
+)
+
+func TestParseBatchResult(t *testing.T) {
+	ans, _, err := parseBatchResult([]byte(`{"id":"batch_req_1","custom_id":"conv-12-msg-345","response":{"status_code":200,"body":{"model":"gpt-x-2026","choices":[{"message":{"role":"assistant","content":"Paris."}}]}},"error":null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ans != (batchAnswer{ConversationID: 12, MessageID: 345, Model: "gpt-x-2026", Content: "Paris."}) {
+		t.Fatalf("unexpected answer %+v", ans)
+	}
+
+	for raw, reason := range map[string]string{
+		`{"custom_id":`: "invalid json",
+		`{"custom_id":"req-1","response":{"status_code":200}}`:                                        "invalid custom_id",
+		`{"custom_id":"conv-1-msg-1","response":null,"error":{"code":"rate_limit","message":"slow"}}`: "request failed",
+		`{"custom_id":"conv-1-msg-1","response":{"status_code":500,"body":{}}}`:                       "request failed",
+		`{"custom_id":"conv-1-msg-1","response":{"status_code":200,"body":{"choices":[]}}}`:           "empty answer",
+	} {
+		if _, got, err := parseBatchResult([]byte(raw)); err == nil || got != reason {
+			t.Fatalf("%s: got reason %q (%v), want %q", raw, got, err, reason)
+		}
+	}
+}
+
+func TestCheckBatchAnswer(t *testing.T) {
+	banned := models.NewPhraseFilter([]string{"as an ai"})
+	limits := models.MessageLimits{MaxContentBytes: 20}
+	if reason, err := checkBatchAnswer(batchAnswer{MessageID: 1, Content: "Paris."}, banned, limits); err != nil {
+		t.Fatalf("expected a clean answer to pass, got %q %v", reason, err)
+	}
+	cases := []struct {
+		content, reason, want string
+	}{
+		{"As an AI, Paris.", "banned phrase", `"as an ai"`},
+		{strings.Repeat("Paris ", 5), "content too large", "30 bytes (max 20)"},
+	}
+	for _, tc := range cases {
+		reason, err := checkBatchAnswer(batchAnswer{MessageID: 1, Content: tc.content}, banned, limits)
+		if reason != tc.reason || err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%q: got %q %v, want %q with %q", tc.content, reason, err, tc.reason, tc.want)
+		}
+	}
+}
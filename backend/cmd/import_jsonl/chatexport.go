@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"caiatech-datalab/backend/internal/models"
+)
+
+const (
+	formatJSONL         = "jsonl"
+	formatChatGPTExport = "chatgpt-export"
+	formatClaudeExport  = "claude-export"
+)
+
+// chatgptConversation is one entry of an OpenAI conversations.json export. Messages form a
+// tree in Mapping; CurrentNode is the leaf the user was last looking at.
+type chatgptConversation struct {
+	ID               string                 `json:"id"`
+	ConversationID   string                 `json:"conversation_id"`
+	Title            string                 `json:"title"`
+	CreateTime       float64                `json:"create_time"`
+	CurrentNode      string                 `json:"current_node"`
+	DefaultModelSlug string                 `json:"default_model_slug"`
+	Mapping          map[string]chatgptNode `json:"mapping"`
+}
+
+type chatgptNode struct {
+	ID       string          `json:"id"`
+	Message  *chatgptMessage `json:"message"`
+	Parent   string          `json:"parent"`
+	Children []string        `json:"children"`
+}
+
+type chatgptMessage struct {
+	ID     string `json:"id"`
+	Author struct {
+		Role string `json:"role"`
+	} `json:"author"`
+	CreateTime *float64 `json:"create_time"`
+	Content    struct {
+		ContentType string            `json:"content_type"`
+		Parts       []json.RawMessage `json:"parts"`
+		Text        string            `json:"text"`
+	} `json:"content"`
+	Metadata struct {
+		ModelSlug string `json:"model_slug"`
+	} `json:"metadata"`
+}
+
+// claudeConversation is one entry of a claude.ai conversations.json export.
+type claudeConversation struct {
+	UUID         string          `json:"uuid"`
+	Name         string          `json:"name"`
+	CreatedAt    string          `json:"created_at"`
+	ChatMessages []claudeMessage `json:"chat_messages"`
+}
+
+type claudeMessage struct {
+	UUID      string `json:"uuid"`
+	Sender    string `json:"sender"`
+	Text      string `json:"text"`
+	CreatedAt string `json:"created_at"`
+	Content   []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+}
+
+// readChatExport streams the top-level JSON array of a ChatGPT or Claude export and calls fn
+// for every linearized conversation. ref identifies the conversation (and branch) in logs and
+// --bad-out. fn returns false to stop early.
+func readChatExport(r io.Reader, format string, allBranches bool, fn func(rec importConversation, ref string) bool) error {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '[' {
+		return fmt.Errorf("expected a JSON array of conversations")
+	}
+
+	for idx := 0; dec.More(); idx++ {
+		var recs []importConversation
+		var refs []string
+		switch format {
+		case formatChatGPTExport:
+			var c chatgptConversation
+			if err := dec.Decode(&c); err != nil {
+				return fmt.Errorf("conversation %d: %w", idx, err)
+			}
+			recs, refs = linearizeChatGPT(c, allBranches)
+		case formatClaudeExport:
+			var c claudeConversation
+			if err := dec.Decode(&c); err != nil {
+				return fmt.Errorf("conversation %d: %w", idx, err)
+			}
+			recs = []importConversation{linearizeClaude(c)}
+			refs = []string{"claude:" + c.UUID}
+		default:
+			return fmt.Errorf("unsupported format %q", format)
+		}
+		for i := range recs {
+			if !fn(recs[i], refs[i]) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// linearizeChatGPT walks parent links from the current node (or, with allBranches, from every
+// leaf) back to the root and returns the path in chronological order.
+func linearizeChatGPT(c chatgptConversation, allBranches bool) ([]importConversation, []string) {
+	convID := c.ConversationID
+	if convID == "" {
+		convID = c.ID
+	}
+
+	var leaves []string
+	if allBranches {
+		for id, n := range c.Mapping {
+			if len(n.Children) == 0 {
+				leaves = append(leaves, id)
+			}
+		}
+		sort.Strings(leaves)
+	} else if c.CurrentNode != "" {
+		leaves = []string{c.CurrentNode}
+	}
+
+	var recs []importConversation
+	var refs []string
+	for _, leaf := range leaves {
+		var path []chatgptNode
+		seen := map[string]bool{}
+		for id := leaf; id != "" && !seen[id]; {
+			seen[id] = true
+			n, ok := c.Mapping[id]
+			if !ok {
+				break
+			}
+			path = append(path, n)
+			id = n.Parent
+		}
+
+		rec := importConversation{Notes: strings.TrimSpace(c.Title)}
+		for i := len(path) - 1; i >= 0; i-- {
+			if m, ok := chatgptToMessage(path[i], c.DefaultModelSlug); ok {
+				rec.Messages = append(rec.Messages, importMessage{Message: m})
+			}
+		}
+		ref := "chatgpt:" + convID
+		if allBranches {
+			rec.Tags = []string{"branch:" + leaf}
+			ref += ":" + leaf
+		}
+		recs = append(recs, rec)
+		refs = append(refs, ref)
+	}
+	return recs, refs
+}
+
+func chatgptToMessage(n chatgptNode, defaultModel string) (models.Message, bool) {
+	if n.Message == nil {
+		return models.Message{}, false
+	}
+	m := n.Message
+	role := models.Role(m.Author.Role)
+	switch role {
+	case models.RoleSystem, models.RoleUser, models.RoleAssistant:
+	default:
+		// tool/plugin turns have no equivalent role.
+		return models.Message{}, false
+	}
+
+	var parts []string
+	for _, raw := range m.Content.Parts {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			continue // images and other non-text parts
+		}
+		if text = strings.TrimSpace(text); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	if len(parts) == 0 && strings.TrimSpace(m.Content.Text) != "" {
+		parts = append(parts, strings.TrimSpace(m.Content.Text))
+	}
+	content := strings.Join(parts, "\n\n")
+	if content == "" {
+		return models.Message{}, false
+	}
+
+	meta := map[string]any{"source_id": m.ID}
+	if m.CreateTime != nil && *m.CreateTime > 0 {
+		meta["created_at"] = unixFloatToTime(*m.CreateTime).Format(time.RFC3339Nano)
+	}
+	if role == models.RoleAssistant {
+		model := m.Metadata.ModelSlug
+		if model == "" {
+			model = defaultModel
+		}
+		if model != "" {
+			meta["model"] = model
+		}
+	}
+	metaJSON, _ := json.Marshal(meta)
+	return models.Message{Role: role, Content: content, Meta: metaJSON}, true
+}
+
+func linearizeClaude(c claudeConversation) importConversation {
+	rec := importConversation{Notes: strings.TrimSpace(c.Name)}
+	for _, cm := range c.ChatMessages {
+		var role models.Role
+		switch cm.Sender {
+		case "human":
+			role = models.RoleUser
+		case "assistant":
+			role = models.RoleAssistant
+		default:
+			continue
+		}
+
+		content := strings.TrimSpace(cm.Text)
+		if content == "" {
+			var parts []string
+			for _, p := range cm.Content {
+				if p.Type == "text" && strings.TrimSpace(p.Text) != "" {
+					parts = append(parts, strings.TrimSpace(p.Text))
+				}
+			}
+			content = strings.Join(parts, "\n\n")
+		}
+		if content == "" {
+			continue
+		}
+
+		meta := map[string]any{"source_id": cm.UUID}
+		if cm.CreatedAt != "" {
+			meta["created_at"] = cm.CreatedAt
+		}
+		metaJSON, _ := json.Marshal(meta)
+		rec.Messages = append(rec.Messages, importMessage{Message: models.Message{Role: role, Content: content, Meta: metaJSON}})
+	}
+	return rec
+}
+
+func unixFloatToTime(f float64) time.Time {
+	sec := int64(f)
+	nsec := int64((f - float64(sec)) * 1e9)
+	return time.Unix(sec, nsec).UTC()
+}
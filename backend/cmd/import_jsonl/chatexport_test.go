@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"caiatech-datalab/backend/internal/models"
+)
+
+func readFixture(t *testing.T, path string, format string, allBranches bool) ([]importConversation, []string) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open fixture: %v", err)
+	}
+	defer f.Close()
+
+	var recs []importConversation
+	var refs []string
+	err = readChatExport(f, format, allBranches, func(rec importConversation, ref string) bool {
+		recs = append(recs, rec)
+		refs = append(refs, ref)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("readChatExport: %v", err)
+	}
+	return recs, refs
+}
+
+func TestReadChatExport_ChatGPTCurrentNode(t *testing.T) {
+	recs, refs := readFixture(t, "testdata/chatgpt_conversations.json", formatChatGPTExport, false)
+	if len(recs) != 1 {
+		t.Fatalf("expected 1 conversation, got %d", len(recs))
+	}
+	if refs[0] != "chatgpt:c0ffee00-0000-0000-0000-000000000001" {
+		t.Fatalf("unexpected ref: %q", refs[0])
+	}
+
+	// Hidden empty system message, the tool turn and the image part are dropped; the
+	// abandoned first assistant reply is not on the current_node path.
+	want := []struct {
+		role    models.Role
+		content string
+	}{
+		{models.RoleUser, "What should I pack for a day hike?"},
+		{models.RoleAssistant, "Bring plenty of water and layers."},
+		{models.RoleUser, "Is this trail map readable?"},
+		{models.RoleAssistant, "Yes, the trail markers are clear."},
+	}
+	msgs := recs[0].Messages
+	if len(msgs) != len(want) {
+		t.Fatalf("expected %d messages, got %d: %+v", len(want), len(msgs), msgs)
+	}
+	for i, w := range want {
+		if msgs[i].Role != w.role || msgs[i].Content != w.content {
+			t.Fatalf("message %d: got (%s, %q), want (%s, %q)", i, msgs[i].Role, msgs[i].Content, w.role, w.content)
+		}
+	}
+
+	var meta map[string]string
+	if err := json.Unmarshal(msgs[1].Meta, &meta); err != nil {
+		t.Fatalf("meta: %v", err)
+	}
+	if meta["model"] != "gpt-4o" {
+		t.Fatalf("expected model gpt-4o, got %q", meta["model"])
+	}
+	if meta["created_at"] != "2023-11-14T22:13:50Z" {
+		t.Fatalf("unexpected created_at: %q", meta["created_at"])
+	}
+	if err := json.Unmarshal(msgs[3].Meta, &meta); err != nil {
+		t.Fatalf("meta: %v", err)
+	}
+	if meta["model"] != "gpt-4o" {
+		t.Fatalf("expected default model slug fallback, got %q", meta["model"])
+	}
+	if recs[0].Notes != "Packing list for a hiking trip" {
+		t.Fatalf("unexpected notes: %q", recs[0].Notes)
+	}
+}
+
+func TestReadChatExport_ChatGPTAllBranches(t *testing.T) {
+	recs, refs := readFixture(t, "testdata/chatgpt_conversations.json", formatChatGPTExport, true)
+	if len(recs) != 2 {
+		t.Fatalf("expected 2 branches, got %d", len(recs))
+	}
+	if refs[0] != "chatgpt:c0ffee00-0000-0000-0000-000000000001:aaaaaaaa-0000-0000-0000-000000000003" {
+		t.Fatalf("unexpected ref: %q", refs[0])
+	}
+	if len(recs[0].Messages) != 2 || recs[0].Messages[1].Content != "Water, snacks, a map, and a rain layer." {
+		t.Fatalf("unexpected first branch: %+v", recs[0].Messages)
+	}
+	if len(recs[0].Tags) != 1 || recs[0].Tags[0] != "branch:aaaaaaaa-0000-0000-0000-000000000003" {
+		t.Fatalf("unexpected branch tags: %v", recs[0].Tags)
+	}
+	if len(recs[1].Messages) != 4 {
+		t.Fatalf("expected 4 messages on second branch, got %d", len(recs[1].Messages))
+	}
+}
+
+func TestReadChatExport_Claude(t *testing.T) {
+	recs, refs := readFixture(t, "testdata/claude_conversations.json", formatClaudeExport, false)
+	if len(recs) != 2 {
+		t.Fatalf("expected 2 conversations, got %d", len(recs))
+	}
+	if refs[0] != "claude:d00dfeed-0000-0000-0000-000000000001" {
+		t.Fatalf("unexpected ref: %q", refs[0])
+	}
+	msgs := recs[0].Messages
+	if len(msgs) != 2 || msgs[0].Role != models.RoleUser || msgs[1].Role != models.RoleAssistant {
+		t.Fatalf("unexpected messages: %+v", msgs)
+	}
+	if msgs[1].Content != "Use `/$`." {
+		t.Fatalf("expected content fallback to content blocks, got %q", msgs[1].Content)
+	}
+
+	// The empty conversation is surfaced so the importer counts it as bad.
+	if _, err := normalizeImport(recs[1], 1, "train", "pending", nil, "", "", nil, models.MessageLimits{}); err == nil {
+		t.Fatalf("expected empty conversation to fail normalization")
+	}
+}
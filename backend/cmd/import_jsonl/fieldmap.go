@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// conversationFields are the importConversation keys a --map entry may target.
+var conversationFields = map[string]bool{
+	"split": true, "status": true, "tags": true, "source": true, "notes": true, "lang": true, "meta": true,
+	"messages": true, "user": true, "assistant": true, "system": true, "turns": true,
+}
+
+// parseFieldMap parses --map "user=question,assistant=answer" into field -> column.
+func parseFieldMap(s string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		field, column, ok := strings.Cut(part, "=")
+		field, column = strings.TrimSpace(field), strings.TrimSpace(column)
+		if !ok || field == "" || column == "" {
+			return nil, fmt.Errorf("invalid --map entry %q (want field=column)", part)
+		}
+		if !conversationFields[field] {
+			return nil, fmt.Errorf("unknown --map field %q", field)
+		}
+		out[field] = column
+	}
+	return out, nil
+}
+
+// applyFieldMap copies mapped columns of a JSON object onto their conversation field names.
+// Unmapped keys are left in place.
+func applyFieldMap(raw []byte, fields map[string]string) ([]byte, error) {
+	if len(fields) == 0 {
+		return raw, nil
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, err
+	}
+	for field, column := range fields {
+		if v, ok := obj[column]; ok {
+			obj[field] = v
+		}
+	}
+	return json.Marshal(obj)
+}
+
+// parseItemMap parses --item-map "input=user,output=assistant" into old key -> new key. Two
+// keys may not be renamed to the same name.
+func parseItemMap(s string) (map[string]string, error) {
+	out := map[string]string{}
+	targets := map[string]string{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(part, "=")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("invalid --item-map entry %q (want from=to)", part)
+		}
+		if _, dup := out[from]; dup {
+			return nil, fmt.Errorf("--item-map renames %q twice", from)
+		}
+		if other, dup := targets[to]; dup {
+			return nil, fmt.Errorf("--item-map renames both %q and %q to %q", other, from, to)
+		}
+		out[from], targets[to] = to, from
+	}
+	return out, nil
+}
+
+// applyItemMap renames top-level keys of a JSON object, all at once so that swaps work. A
+// renamed key replaces any key already under the new name; other keys are left in place.
+func applyItemMap(raw []byte, renames map[string]string) ([]byte, error) {
+	if len(renames) == 0 {
+		return raw, nil
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("--item-map needs a JSON object")
+	}
+	moved := map[string]json.RawMessage{}
+	for from, to := range renames {
+		if v, ok := obj[from]; ok {
+			moved[to] = v
+			delete(obj, from)
+		}
+	}
+	for k, v := range moved {
+		obj[k] = v
+	}
+	return json.Marshal(obj)
+}
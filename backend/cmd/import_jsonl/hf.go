@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	hfRowsURL      = "https://datasets-server.huggingface.co/rows"
+	hfPageSize     = 100 // datasets-server caps length at 100
+	hfMaxRetries   = 8
+	hfMaxBackoff   = time.Minute
+	hfTokenEnvName = "HF_TOKEN"
+)
+
+// hfSource names a dataset split as a source: hf:org/name:split.
+func hfSource(dataset, split string) string {
+	return "hf:" + dataset + ":" + split
+}
+
+// hfSourceRef is the source of one imported row: hf:org/name:split:row.
+func hfSourceRef(dataset, split string, rowIdx int64) string {
+	return hfSource(dataset, split) + ":" + strconv.FormatInt(rowIdx, 10)
+}
+
+// hfRowsClient pages through the Hugging Face datasets-server rows API.
+type hfRowsClient struct {
+	baseURL  string
+	token    string
+	http     *http.Client
+	pageSize int
+	sleep    func(time.Duration)
+}
+
+func newHFRowsClient(token string) *hfRowsClient {
+	return &hfRowsClient{
+		baseURL:  hfRowsURL,
+		token:    token,
+		http:     &http.Client{Timeout: 60 * time.Second},
+		pageSize: hfPageSize,
+		sleep:    time.Sleep,
+	}
+}
+
+type hfRowsPage struct {
+	Rows []struct {
+		RowIdx int64           `json:"row_idx"`
+		Row    json.RawMessage `json:"row"`
+	} `json:"rows"`
+	NumRowsTotal int64 `json:"num_rows_total"`
+}
+
+// each calls fn for every row of dataset/config/split in order. fn returns false to stop early.
+func (c *hfRowsClient) each(ctx context.Context, dataset, config, split string, fn func(rowIdx int64, row json.RawMessage) bool) error {
+	for offset := int64(0); ; {
+		page, err := c.fetch(ctx, dataset, config, split, offset)
+		if err != nil {
+			return fmt.Errorf("rows offset=%d: %w", offset, err)
+		}
+		for _, r := range page.Rows {
+			if !fn(r.RowIdx, r.Row) {
+				return nil
+			}
+		}
+		offset += int64(len(page.Rows))
+		if len(page.Rows) == 0 || offset >= page.NumRowsTotal {
+			return nil
+		}
+	}
+}
+
+// fetch requests one page, backing off on 429 and 5xx responses (honouring Retry-After).
+func (c *hfRowsClient) fetch(ctx context.Context, dataset, config, split string, offset int64) (hfRowsPage, error) {
+	q := url.Values{}
+	q.Set("dataset", dataset)
+	q.Set("config", config)
+	q.Set("split", split)
+	q.Set("offset", strconv.FormatInt(offset, 10))
+	q.Set("length", strconv.Itoa(c.pageSize))
+	u := c.baseURL + "?" + q.Encode()
+
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return hfRowsPage{}, err
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return hfRowsPage{}, err
+		}
+		if resp.StatusCode == http.StatusOK {
+			var page hfRowsPage
+			err := json.NewDecoder(resp.Body).Decode(&page)
+			resp.Body.Close()
+			if err != nil {
+				return hfRowsPage{}, fmt.Errorf("decode: %w", err)
+			}
+			return page, nil
+		}
+
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		if !retryable || attempt >= hfMaxRetries {
+			return hfRowsPage{}, fmt.Errorf("%s: %s", resp.Status, body)
+		}
+
+		wait := backoff
+		if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s >= 0 {
+			wait = time.Duration(s) * time.Second
+		}
+		if wait > hfMaxBackoff {
+			wait = hfMaxBackoff
+		}
+		log.Printf("hf: %s, retrying in %s", resp.Status, wait)
+		c.sleep(wait)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHFRowsClient_PaginatesAndBacksOff(t *testing.T) {
+	const total = 5
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("missing bearer token")
+		}
+		if calls == 1 {
+			w.Header().Set("Retry-After", "3")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		q := r.URL.Query()
+		if q.Get("dataset") != "org/name" || q.Get("split") != "train" || q.Get("config") != "default" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		offset, _ := strconv.Atoi(q.Get("offset"))
+		length, _ := strconv.Atoi(q.Get("length"))
+		var rows []string
+		for i := offset; i < offset+length && i < total; i++ {
+			rows = append(rows, fmt.Sprintf(`{"row_idx":%d,"row":{"n":%d}}`, i, i))
+		}
+		fmt.Fprintf(w, `{"rows":[%s],"num_rows_total":%d}`, strings.Join(rows, ","), total)
+	}))
+	defer srv.Close()
+
+	var slept []time.Duration
+	c := newHFRowsClient("secret")
+	c.baseURL = srv.URL
+	c.pageSize = 2
+	c.sleep = func(d time.Duration) { slept = append(slept, d) }
+
+	var got []int64
+	err := c.each(context.Background(), "org/name", "default", "train", func(idx int64, row json.RawMessage) bool {
+		got = append(got, idx)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("each: %v", err)
+	}
+	if len(got) != total || got[0] != 0 || got[total-1] != total-1 {
+		t.Fatalf("unexpected rows: %v", got)
+	}
+	if len(slept) != 1 || slept[0] != 3*time.Second {
+		t.Fatalf("expected one Retry-After backoff of 3s, got %v", slept)
+	}
+}
+
+func TestHFRowsClient_StopsEarly(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"rows":[{"row_idx":0,"row":{}},{"row_idx":1,"row":{}}],"num_rows_total":100}`)
+	}))
+	defer srv.Close()
+
+	c := newHFRowsClient("")
+	c.baseURL = srv.URL
+	n := 0
+	if err := c.each(context.Background(), "org/name", "default", "train", func(int64, json.RawMessage) bool {
+		n++
+		return n < 3
+	}); err != nil {
+		t.Fatalf("each: %v", err)
+	}
+	if n != 3 {
+		t.Fatalf("expected to stop after 3 rows, got %d", n)
+	}
+}
+
+func TestHFSourceRef(t *testing.T) {
+	if got := hfSource("org/name", "train"); got != "hf:org/name:train" {
+		t.Fatalf("hfSource = %q", got)
+	}
+	if got := hfSourceRef("org/name", "validation", 42); got != "hf:org/name:validation:42" {
+		t.Fatalf("hfSourceRef = %q", got)
+	}
+}
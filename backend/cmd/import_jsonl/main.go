@@ -2,42 +2,64 @@ package main
 
 import (
 	"bufio"
+	"cmp"
+	"compress/gzip"
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
 	"caiatech-datalab/backend/internal/db"
+	"caiatech-datalab/backend/internal/lang"
 	"caiatech-datalab/backend/internal/models"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 type importConversation struct {
-	Split    string           `json:"split"`
-	Status   string           `json:"status"`
-	Tags     []string         `json:"tags"`
-	Source   string           `json:"source"`
-	Notes    string           `json:"notes"`
-	Messages []models.Message `json:"messages"`
+	Split    string          `json:"split"`
+	Status   string          `json:"status"`
+	Tags     []string        `json:"tags"`
+	Source   string          `json:"source"`
+	Notes    string          `json:"notes"`
+	Lang     string          `json:"lang"`
+	Meta     json.RawMessage `json:"meta"`
+	Messages []importMessage `json:"messages"`
 
 	User      string `json:"user"`
 	Assistant string `json:"assistant"`
 	System    string `json:"system"`
+
+	// Turns are untagged alternating user/assistant strings, read with --infer-roles.
+	Turns []string `json:"turns"`
+}
+
+// importMessage is a message of an import record. Order, when set on every message of the
+// record, gives its position for sources that deliver messages out of sequence; it only
+// decides the stored idx and is not kept itself.
+type importMessage struct {
+	models.Message
+	Order *int `json:"order,omitempty"`
 }
 
 func main() {
 	var (
 		inputPath     = flag.String("input", "", "Input JSONL path")
-		databaseURL   = flag.String("database-url", os.Getenv("DATALAB_DATABASE_URL"), "Postgres URL (or set DATALAB_DATABASE_URL)")
+		databaseURL   = flag.String("database-url", defaultDatabaseURL(), "Postgres URL (or set DATALAB_DATABASE_URL, or PGHOST/PGUSER/PGPASSWORD/PGDATABASE)")
 		into          = flag.String("into", "items", "Import into: items|conversations")
 		defaultSplit  = flag.String("split", "train", "Default split if missing (train|valid|test)")
 		defaultStatus = flag.String("status", "approved", "Default status if missing (draft|pending|approved|rejected|archived)")
 		defaultSource = flag.String("source", "", "Default source if missing")
 		datasetName   = flag.String("dataset", "", "Dataset name to import into (default: source or 'default')")
+		project       = flag.String("project", "", "Project slug the dataset belongs to (default: the default project)")
 		replace       = flag.Bool("replace", false, "Delete existing rows in the dataset before import")
 		defaultNotes  = flag.String("notes", "", "Default notes if missing")
 		defaultTags   = flag.String("tags", "", "Comma-separated tags to apply if missing")
@@ -45,21 +67,73 @@ func main() {
 		batch         = flag.Int("batch", 200, "Commit every N rows")
 		skipBad       = flag.Bool("skip-bad", true, "Skip invalid lines instead of failing")
 		badOut        = flag.String("bad-out", "", "Write invalid lines to this file (optional)")
+		badFormat     = flag.String("bad-format", badFormatJSONL, "--bad-out format: jsonl ({line,where,reason,error,raw} per skipped row) or raw (the input line as-is)")
+		rejectPhrases = flag.String("reject-phrases-file", "", "Reject conversations containing any phrase in this file (one per line, case-insensitive)")
+		format        = flag.String("format", formatJSONL, "Input format: jsonl|parquet|chatgpt-export|claude-export|openai_batch_results")
+		allBranches   = flag.Bool("all-branches", false, "chatgpt-export: import every leaf branch instead of only current_node")
+		hfDataset     = flag.String("hf-dataset", "", "Import rows of a Hugging Face dataset (org/name) instead of --input")
+		hfSplit       = flag.String("hf-split", "train", "Hugging Face split to import")
+		hfConfig      = flag.String("hf-config", "default", "Hugging Face dataset config")
+		fieldMap      = flag.String("map", "", "Conversations: map fields to input columns, e.g. user=question,assistant=answer")
+		itemMap       = flag.String("item-map", "", "Items: rename top-level keys before storing, e.g. input=user,output=assistant")
+		maxMetaBytes  = flag.Int("max-meta-bytes", models.DefaultMaxMessageMetaBytes, "Conversations: reject messages whose meta exceeds this many bytes (0 = no limit)")
+		maxMessages   = flag.Int("max-messages", models.DefaultMaxMessages, "Conversations: reject conversations with more messages than this (0 = no limit)")
+		maxContent    = flag.Int("max-content-bytes", models.DefaultMaxMessageContentBytes, "Conversations: reject messages whose content exceeds this many bytes (0 = no limit)")
+		detectLang    = flag.Bool("detect-lang", false, "Conversations: detect each conversation's language when the record has no lang")
+		inferRoles    = flag.Bool("infer-roles", false, "Conversations: build messages from a turns array, alternating user/assistant after an optional system")
+		dryRun        = flag.Bool("dry-run", false, "Parse and validate only: report would-be imported/bad counts and the first errors without writing to the database")
+		noDB          = flag.Bool("no-db", false, "With --dry-run: do not connect to the database at all (the target dataset is not resolved)")
 	)
+	var autoTags autoTagRules
+	flag.Var(&autoTags, "auto-tag", "Conversations: add tags when a field matches a pattern, e.g. source~=support:customer-support (repeatable)")
 	flag.Parse()
 
-	if *inputPath == "" {
-		log.Fatalf("--input is required")
+	if *inputPath == "" && *hfDataset == "" {
+		log.Fatalf("--input or --hf-dataset is required")
+	}
+	if *inputPath != "" && *hfDataset != "" {
+		log.Fatalf("--input and --hf-dataset are mutually exclusive")
+	}
+	if *noDB && !*dryRun {
+		log.Fatalf("--no-db requires --dry-run")
+	}
+	if *databaseURL == "" && !*noDB {
+		log.Fatalf("--database-url, DATALAB_DATABASE_URL or PGHOST/PGUSER/PGDATABASE is required")
+	}
+
+	inputFormat := strings.ToLower(strings.TrimSpace(*format))
+	switch inputFormat {
+	case formatJSONL, formatParquet, formatOpenAIBatchResults:
+	case formatChatGPTExport, formatClaudeExport:
+		// Chat exports are always conversations, imported for review.
+		*into = "conversations"
+		if !flagPassed("status") {
+			*defaultStatus = string(models.ConversationStatusPending)
+		}
+	default:
+		log.Fatalf("unknown --format %q", *format)
 	}
-	if *databaseURL == "" {
-		log.Fatalf("--database-url or DATALAB_DATABASE_URL is required")
+	if *hfDataset != "" && inputFormat != formatJSONL {
+		log.Fatalf("--format %s cannot be used with --hf-dataset", inputFormat)
 	}
 
-	in, err := os.Open(*inputPath)
+	columns, err := parseFieldMap(*fieldMap)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	itemRenames, err := parseItemMap(*itemMap)
 	if err != nil {
-		log.Fatalf("open input: %v", err)
+		log.Fatalf("%v", err)
+	}
+
+	var in io.ReadCloser
+	if *inputPath != "" && inputFormat != formatParquet {
+		in, err = openInput(*inputPath)
+		if err != nil {
+			log.Fatalf("open input: %v", err)
+		}
+		defer in.Close()
 	}
-	defer in.Close()
 
 	var badFile *os.File
 	if *badOut != "" {
@@ -69,10 +143,34 @@ func main() {
 		}
 		defer badFile.Close()
 	}
+	var badW io.Writer
+	if badFile != nil {
+		badW = badFile
+	}
+	badSink, err := newBadSink(badW, strings.ToLower(strings.TrimSpace(*badFormat)))
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	var banned *models.PhraseFilter
+	if *rejectPhrases != "" {
+		b, err := os.ReadFile(*rejectPhrases)
+		if err != nil {
+			log.Fatalf("read reject-phrases-file: %v", err)
+		}
+		banned = models.NewPhraseFilter(models.ParsePhraseFile(string(b)))
+	}
 
 	parsedDefaultTags := parseTags(*defaultTags)
+	limits := models.MessageLimits{MaxMessages: *maxMessages, MaxContentBytes: *maxContent, MaxMetaBytes: *maxMetaBytes}
+	// Rows from Hugging Face get their own hf:org/name:split:row source unless --source is set.
+	hfRowSources := *hfDataset != "" && *defaultSource == ""
 	if *defaultSource == "" {
-		*defaultSource = fmt.Sprintf("import:%s", filepathBase(*inputPath))
+		if *hfDataset != "" {
+			*defaultSource = hfSource(*hfDataset, *hfSplit)
+		} else {
+			*defaultSource = fmt.Sprintf("import:%s", filepathBase(*inputPath))
+		}
 	}
 
 	if *datasetName == "" {
@@ -85,21 +183,83 @@ func main() {
 			*datasetName = "default"
 		}
 	}
-	database, err := db.Open(*databaseURL)
-	if err != nil {
-		log.Fatalf("db open: %v", err)
-	}
-	defer database.Close()
 	ctx := context.Background()
+	var database *sql.DB
+	if !*noDB {
+		database, err = db.Open(*databaseURL)
+		if err != nil {
+			log.Fatalf("db open: %v", err)
+		}
+		defer database.Close()
+	}
 
-	// Ensure dataset exists
-	ds, err := models.EnsureDataset(ctx, database, *datasetName)
-	if err != nil {
-		log.Fatalf("ensure dataset: %v", err)
+	if inputFormat == formatOpenAIBatchResults {
+		// Answers attach to existing conversations, so no dataset or import run is involved.
+		importBatchResults(ctx, database, in, badSink, banned, limits, *dryRun, *skipBad, *max)
+		return
+	}
+
+	mode := models.DatasetKindItems
+	if strings.TrimSpace(*into) != "" {
+		k, ok := models.NormalizeDatasetKind(*into)
+		if !ok {
+			log.Fatalf("unknown --into %q (expected items|conversations)", *into)
+		}
+		mode = k
+	}
+	if len(itemRenames) > 0 && mode != models.DatasetKindItems {
+		log.Fatalf("--item-map applies to --into items; use --map for conversations")
+	}
+
+	if *project != "" && !models.ValidProjectSlug(*project) {
+		log.Fatalf("invalid --project %q (lowercase letters, digits and dashes)", *project)
+	}
+	var projectID int64
+	if !*noDB {
+		projectID, err = models.ProjectID(ctx, database, *project)
+		if err != nil {
+			log.Fatalf("project: %v", err)
+		}
+	}
+
+	// Ensure dataset exists; a dry run only looks it up.
+	var ds models.Dataset
+	switch {
+	case *noDB:
+		log.Printf("dry run without database: dataset %q not resolved", *datasetName)
+	case *dryRun:
+		ds, err = models.FindDatasetByName(ctx, database, *datasetName)
+		if errors.Is(err, models.ErrNotFound) {
+			log.Printf("dry run: dataset %q does not exist and would be created", *datasetName)
+		} else if err != nil {
+			log.Fatalf("find dataset: %v", err)
+		} else if ds.ProjectID != projectID {
+			log.Printf("dry run: dataset %q belongs to another project; a real import would be refused", ds.Name)
+		}
+	default:
+		ds, err = models.EnsureDataset(ctx, database, *datasetName, mode, projectID)
+		if err != nil {
+			log.Fatalf("ensure dataset: %v", err)
+		}
+	}
+	if ds.ID > 0 && ds.Kind != mode {
+		// Same rule as the API: rows only go into a dataset of their own kind.
+		if !*dryRun {
+			log.Fatalf("dataset %q is a %s dataset; it cannot take --into=%s", ds.Name, ds.Kind, mode)
+		}
+		log.Printf("dry run: dataset %q is a %s dataset; a real --into=%s import would be refused", ds.Name, ds.Kind, mode)
+	}
+	if ds.Lock != nil {
+		// Same rule as the API: a locked dataset takes no edits until it is unlocked.
+		if !*dryRun {
+			log.Fatalf("dataset %q is locked by %s; unlock it first", ds.Name, ds.Lock.By)
+		}
+		log.Printf("dry run: dataset %q is locked by %s; a real import would be refused", ds.Name, ds.Lock.By)
 	}
 
-	if *replace {
-		mode := strings.ToLower(strings.TrimSpace(*into))
+	if *replace && *dryRun {
+		log.Printf("dry run: --replace would delete the existing %s of dataset %q", mode, *datasetName)
+	} else if *replace {
 		switch mode {
 		case "conversations":
 			if _, err := database.ExecContext(ctx, "DELETE FROM conversations WHERE dataset_id = $1", ds.ID); err != nil {
@@ -112,18 +272,22 @@ func main() {
 		}
 	}
 
-	scanner := bufio.NewScanner(in)
-	scanner.Buffer(make([]byte, 1024*1024), 50*1024*1024)
-
 	imported := 0
 	bad := 0
 	lineNo := 0
 
+	// A dry run never opens a transaction: tx stays nil and inserts are skipped.
 	commitBatch := func(tx *sql.Tx) error {
+		if tx == nil {
+			return nil
+		}
 		return tx.Commit()
 	}
 
 	newTx := func() *sql.Tx {
+		if *dryRun {
+			return nil
+		}
 		tx, err := database.BeginTx(ctx, nil)
 		if err != nil {
 			log.Fatalf("begin tx: %v", err)
@@ -132,98 +296,230 @@ func main() {
 	}
 
 	tx := newTx()
+	rollback := func() {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+	}
 	started := time.Now()
 
-	mode := strings.ToLower(strings.TrimSpace(*into))
-	if mode == "" {
-		mode = "items"
-	}
 	itemSourcePrefix := filepathBase(*inputPath)
 
-	for scanner.Scan() {
-		lineNo++
-		raw := strings.TrimSpace(scanner.Text())
-		if raw == "" {
-			continue
+	// The run is recorded up front so every row can carry its id; see finish.
+	var runID *int64
+	if !*dryRun {
+		input := filepathBase(*inputPath)
+		if *hfDataset != "" {
+			input = hfSource(*hfDataset, *hfSplit)
+		}
+		run, err := models.CreateImportRun(ctx, database, models.ImportRun{
+			DatasetID: ds.ID,
+			Input:     input,
+			Mode:      mode,
+			Flags:     passedFlags(flag.CommandLine),
+			StartedAt: started,
+		})
+		if err != nil {
+			log.Fatalf("record import run: %v", err)
+		}
+		runID = &run.ID
+	}
+
+	recordBad := func(raw string, where string, reason string, err error) {
+		bad++
+		_ = badSink.record(badRecord{Line: lineNo, Where: where, Reason: reason, Error: err.Error(), Raw: raw})
+		if !*skipBad {
+			log.Fatalf("%s: %s: %v", where, reason, err)
+		}
+	}
+
+	// insertConversation normalizes and inserts rec, with source as its default source; it
+	// reports whether a row was written.
+	insertConversation := func(rec importConversation, raw string, where string, source string) bool {
+		conv, err := normalizeImport(rec, ds.ID, *defaultSplit, *defaultStatus, parsedDefaultTags, source, *defaultNotes, banned, limits)
+		if err != nil {
+			recordBad(raw, where, invalidRecordReason(err), err)
+			return false
+		}
+		autoTags.apply(&conv)
+		conv.ImportRunID = runID
+		if *detectLang && conv.Lang == "" {
+			conv.Lang = detectConversationLang(conv.Messages)
+		}
+		if *dryRun {
+			return true
+		}
+		if _, err := models.InsertConversationWithMessages(ctx, tx, conv); err != nil {
+			rollback()
+			log.Fatalf("%s: insert: %v", where, err)
+		}
+		return true
+	}
+
+	// afterRow commits every --batch rows and reports whether --max has been reached.
+	afterRow := func() bool {
+		imported++
+		if imported%*batch == 0 {
+			if err := commitBatch(tx); err != nil {
+				log.Fatalf("commit: %v", err)
+			}
+			tx = newTx()
+			log.Printf("imported=%d bad=%d elapsed=%s", imported, bad, time.Since(started).Truncate(time.Second))
+		}
+		return *max > 0 && imported >= *max
+	}
+
+	// finish commits the last batch and stores the run's counts in import_runs. A dry run
+	// instead reports what would have been imported and exits 1 when any row was bad.
+	finish := func() {
+		if *dryRun {
+			log.Printf("dry run done: would import=%d bad=%d elapsed=%s", imported, bad, time.Since(started).Truncate(time.Second))
+			for _, e := range badSink.firstErrors() {
+				log.Printf("  %s", e)
+			}
+			if bad > 0 {
+				log.Printf("bad reasons: %s", badSink.summary())
+				os.Exit(1)
+			}
+			return
+		}
+		if err := commitBatch(tx); err != nil {
+			log.Fatalf("final commit: %v", err)
+		}
+		if err := models.FinishImportRun(ctx, database, *runID, imported, bad); err != nil {
+			log.Printf("record import run: %v", err)
+		}
+		log.Printf("done run=%d imported=%d bad=%d elapsed=%s", *runID, imported, bad, time.Since(started).Truncate(time.Second))
+		log.Printf("undo with POST /api/v1/import-runs/%d/rollback", *runID)
+		if bad > 0 {
+			log.Printf("bad reasons: %s", badSink.summary())
+		}
+	}
+
+	switch inputFormat {
+	case formatChatGPTExport, formatClaudeExport:
+		err := readChatExport(in, inputFormat, *allBranches, func(rec importConversation, ref string) bool {
+			if !insertConversation(rec, ref, ref, *defaultSource) {
+				return true
+			}
+			return !afterRow()
+		})
+		if err != nil {
+			rollback()
+			log.Fatalf("read %s: %v", inputFormat, err)
 		}
+		finish()
+		return
+	}
 
+	// importRaw inserts one JSON object from a line or row; it reports whether the row was written.
+	importRaw := func(raw string, where string, sourceRef string) bool {
 		switch mode {
 		case "conversations":
+			mapped, err := applyFieldMap([]byte(raw), columns)
+			if err != nil {
+				recordBad(raw, where, "invalid json", err)
+				return false
+			}
 			var rec importConversation
-			if err := json.Unmarshal([]byte(raw), &rec); err != nil {
-				bad++
-				if badFile != nil {
-					_, _ = badFile.WriteString(raw + "\n")
-				}
-				if !*skipBad {
-					log.Fatalf("line %d: invalid json: %v", lineNo, err)
-				}
-				continue
+			if err := json.Unmarshal(mapped, &rec); err != nil {
+				recordBad(raw, where, "invalid json", err)
+				return false
 			}
-
-			conv, err := normalizeImport(rec, ds.ID, *defaultSplit, *defaultStatus, parsedDefaultTags, *defaultSource, *defaultNotes)
-			if err != nil {
-				bad++
-				if badFile != nil {
-					_, _ = badFile.WriteString(raw + "\n")
-				}
-				if !*skipBad {
-					log.Fatalf("line %d: invalid record: %v", lineNo, err)
+			if *inferRoles && len(rec.Messages) == 0 && len(rec.Turns) > 0 {
+				if rec, err = inferTurnRoles(rec); err != nil {
+					recordBad(raw, where, "invalid turns", err)
+					return false
 				}
-				continue
 			}
-
-			if _, err := models.InsertConversationWithMessages(ctx, tx, conv); err != nil {
-				_ = tx.Rollback()
-				log.Fatalf("line %d: insert: %v", lineNo, err)
+			source := *defaultSource
+			if hfRowSources {
+				source = sourceRef
 			}
+			return insertConversation(rec, raw, where, source)
 
 		default:
-			// Generic items: store each JSON object as-is in dataset_items.data.
+			// Generic items: store each JSON object as-is in dataset_items.data, after any
+			// --item-map renames.
 			if !json.Valid([]byte(raw)) {
-				bad++
-				if badFile != nil {
-					_, _ = badFile.WriteString(raw + "\n")
-				}
-				if !*skipBad {
-					log.Fatalf("line %d: invalid json", lineNo)
-				}
-				continue
+				recordBad(raw, where, "invalid json", errors.New("not valid JSON"))
+				return false
+			}
+			data, err := applyItemMap([]byte(raw), itemRenames)
+			if err != nil {
+				recordBad(raw, where, "invalid json", err)
+				return false
+			}
+			if *dryRun {
+				return true
 			}
-
-			sourceRef := fmt.Sprintf("%s:%d", itemSourcePrefix, lineNo)
 			if _, err := tx.ExecContext(ctx, `
-INSERT INTO dataset_items (dataset_id, data, source_ref)
-VALUES ($1, $2, $3)
-`, ds.ID, json.RawMessage(raw), sourceRef); err != nil {
-				_ = tx.Rollback()
-				log.Fatalf("line %d: insert item: %v", lineNo, err)
+INSERT INTO dataset_items (dataset_id, data, source_ref, import_run_id)
+VALUES ($1, $2, $3, $4)
+`, ds.ID, json.RawMessage(data), sourceRef, runID); err != nil {
+				rollback()
+				log.Fatalf("%s: insert item: %v", where, err)
 			}
+			return true
 		}
+	}
 
-		imported++
-		if imported%*batch == 0 {
-			if err := commitBatch(tx); err != nil {
-				log.Fatalf("commit: %v", err)
+	if *hfDataset != "" {
+		client := newHFRowsClient(os.Getenv(hfTokenEnvName))
+		err := client.each(ctx, *hfDataset, *hfConfig, *hfSplit, func(rowIdx int64, row json.RawMessage) bool {
+			sourceRef := hfSourceRef(*hfDataset, *hfSplit, rowIdx)
+			if !importRaw(string(row), sourceRef, sourceRef) {
+				return true
 			}
-			tx = newTx()
-			log.Printf("imported=%d bad=%d elapsed=%s", imported, bad, time.Since(started).Truncate(time.Second))
+			return !afterRow()
+		})
+		if err != nil {
+			rollback()
+			log.Fatalf("hf %s: %v", *hfDataset, err)
+		}
+		finish()
+		return
+	}
+
+	if inputFormat == formatParquet {
+		err := readParquet(*inputPath, func(rowIdx int64, raw []byte) bool {
+			where := fmt.Sprintf("row %d", rowIdx)
+			if !importRaw(string(raw), where, fmt.Sprintf("%s:%d", itemSourcePrefix, rowIdx)) {
+				return true
+			}
+			return !afterRow()
+		})
+		if err != nil {
+			rollback()
+			log.Fatalf("read parquet: %v", err)
 		}
+		finish()
+		return
+	}
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 1024*1024), 50*1024*1024)
 
-		if *max > 0 && imported >= *max {
+	for scanner.Scan() {
+		lineNo++
+		raw := strings.TrimSpace(scanner.Text())
+		if raw == "" {
+			continue
+		}
+		where := fmt.Sprintf("line %d", lineNo)
+		if !importRaw(raw, where, fmt.Sprintf("%s:%d", itemSourcePrefix, lineNo)) {
+			continue
+		}
+		if afterRow() {
 			break
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		_ = tx.Rollback()
+		rollback()
 		log.Fatalf("scan: %v", err)
 	}
-	if err := commitBatch(tx); err != nil {
-		log.Fatalf("final commit: %v", err)
-	}
-
-	log.Printf("done imported=%d bad=%d elapsed=%s", imported, bad, time.Since(started).Truncate(time.Second))
+	finish()
 }
 
 func normalizeImport(
@@ -234,6 +530,8 @@ func normalizeImport(
 	defaultTags []string,
 	defaultSource string,
 	defaultNotes string,
+	banned *models.PhraseFilter,
+	limits models.MessageLimits,
 ) (models.Conversation, error) {
 	splitText := strings.TrimSpace(rec.Split)
 	if splitText == "" {
@@ -268,7 +566,10 @@ func normalizeImport(
 		notes = defaultNotes
 	}
 
-	msgs := rec.Messages
+	msgs, err := orderMessages(rec.Messages)
+	if err != nil {
+		return models.Conversation{}, err
+	}
 	if len(msgs) == 0 {
 		user := strings.TrimSpace(rec.User)
 		assistant := strings.TrimSpace(rec.Assistant)
@@ -285,21 +586,41 @@ func normalizeImport(
 		)
 	}
 
+	if err := limits.CheckCount(len(msgs)); err != nil {
+		return models.Conversation{}, err
+	}
 	for i := range msgs {
 		msgs[i].Content = strings.TrimSpace(msgs[i].Content)
 		msgs[i].Name = strings.TrimSpace(msgs[i].Name)
 		if msgs[i].Content == "" {
 			return models.Conversation{}, fmt.Errorf("empty content at message %d", i)
 		}
+		if err := limits.CheckContent(i, msgs[i].Content); err != nil {
+			return models.Conversation{}, err
+		}
 		switch msgs[i].Role {
 		case models.RoleSystem, models.RoleUser, models.RoleAssistant:
 		default:
 			return models.Conversation{}, fmt.Errorf("invalid role at message %d", i)
 		}
-		if len(msgs[i].Meta) == 0 {
+		if err := models.ValidateMessageMeta(i, msgs[i].Meta, limits.MaxMetaBytes); err != nil {
+			return models.Conversation{}, err
+		}
+		if len(msgs[i].Meta) == 0 || string(msgs[i].Meta) == "null" {
 			msgs[i].Meta = json.RawMessage("{}")
 		}
 	}
+	if idx, phrase := banned.MatchMessages(msgs); idx >= 0 {
+		return models.Conversation{}, fmt.Errorf("banned phrase %q at message %d", phrase, idx)
+	}
+
+	langCode, ok := lang.Normalize(rec.Lang)
+	if !ok {
+		return models.Conversation{}, fmt.Errorf("invalid lang: %q", rec.Lang)
+	}
+	if err := models.ValidateConversationMeta(rec.Meta, limits.MaxMetaBytes); err != nil {
+		return models.Conversation{}, err
+	}
 
 	return models.Conversation{
 		DatasetID: datasetID,
@@ -308,10 +629,106 @@ func normalizeImport(
 		Tags:      tags,
 		Source:    source,
 		Notes:     notes,
+		Lang:      langCode,
+		Meta:      rec.Meta,
 		Messages:  msgs,
 	}, nil
 }
 
+// orderMessages returns the messages sorted by Order when they carry one, in input order
+// otherwise. Equal orders keep their input order, so duplicates cannot collide on idx.
+// Setting order on only some messages is rejected as ambiguous.
+func orderMessages(in []importMessage) ([]models.Message, error) {
+	ordered := 0
+	for _, m := range in {
+		if m.Order != nil {
+			ordered++
+		}
+	}
+	if ordered > 0 && ordered < len(in) {
+		return nil, fmt.Errorf("order set on %d of %d messages (set it on all or none)", ordered, len(in))
+	}
+	if ordered > 0 {
+		in = slices.Clone(in)
+		slices.SortStableFunc(in, func(a, b importMessage) int { return cmp.Compare(*a.Order, *b.Order) })
+	}
+	msgs := make([]models.Message, len(in))
+	for i, m := range in {
+		msgs[i] = m.Message
+	}
+	return msgs, nil
+}
+
+// invalidRecordReason is the --bad-out reason for a record normalizeImport rejected: the
+// exceeded limit for LimitErrors, "invalid record" otherwise.
+func invalidRecordReason(err error) string {
+	var le *models.LimitError
+	if !errors.As(err, &le) {
+		return "invalid record"
+	}
+	if le.Limit == models.LimitMessages {
+		return "too many messages"
+	}
+	return "content too large"
+}
+
+// detectConversationLang guesses the language from the user and assistant turns; system
+// prompts are skipped since they are often boilerplate in a different language.
+func detectConversationLang(msgs []models.Message) string {
+	var b strings.Builder
+	for _, m := range msgs {
+		if m.Role == models.RoleSystem {
+			continue
+		}
+		b.WriteString(m.Content)
+		b.WriteByte('\n')
+	}
+	return lang.Detect(b.String())
+}
+
+// defaultDatabaseURL is DATALAB_DATABASE_URL, or a URL built from the PG* component variables.
+func defaultDatabaseURL() string {
+	if u := os.Getenv("DATALAB_DATABASE_URL"); u != "" {
+		return u
+	}
+	return db.URLFromComponents(os.Getenv)
+}
+
+// openInput opens path for reading, transparently decompressing .gz and .zst files.
+func openInput(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".zst") || strings.HasSuffix(lower, ".zstd"):
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+		return &decompressReader{Reader: zr, close: func() error { zr.Close(); return f.Close() }}, nil
+	case strings.HasSuffix(lower, ".gz"):
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		return &decompressReader{Reader: gr, close: func() error { _ = gr.Close(); return f.Close() }}, nil
+	default:
+		return f, nil
+	}
+}
+
+type decompressReader struct {
+	io.Reader
+	close func() error
+}
+
+func (r *decompressReader) Close() error { return r.close() }
+
 func parseTags(s string) []string {
 	if strings.TrimSpace(s) == "" {
 		return nil
@@ -334,6 +751,28 @@ func parseTags(s string) []string {
 	return out
 }
 
+// passedFlags returns the flags set on fs's command line, for the import_runs audit trail.
+// --database-url is left out since it may carry credentials.
+func passedFlags(fs *flag.FlagSet) map[string]string {
+	out := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "database-url" {
+			out[f.Name] = f.Value.String()
+		}
+	})
+	return out
+}
+
+func flagPassed(name string) bool {
+	passed := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			passed = true
+		}
+	})
+	return passed
+}
+
 func filepathBase(p string) string {
 	p = strings.ReplaceAll(p, "\\", "/")
 	if i := strings.LastIndex(p, "/"); i >= 0 {
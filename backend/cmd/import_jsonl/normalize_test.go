@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"caiatech-datalab/backend/internal/models"
+)
+
+func TestNormalizeImport_MessageLimits(t *testing.T) {
+	limits := models.MessageLimits{MaxMessages: 2, MaxContentBytes: 10}
+	rec := importConversation{User: "hi", Assistant: "0123456789"}
+	if _, err := normalizeImport(rec, 1, "train", "approved", nil, "", "", nil, limits); err != nil {
+		t.Fatalf("at the limits: expected ok, got %v", err)
+	}
+
+	rec = importConversation{User: "hi", Assistant: "0123456789!"}
+	_, err := normalizeImport(rec, 1, "train", "approved", nil, "", "", nil, limits)
+	if err == nil || invalidRecordReason(err) != "content too large" {
+		t.Fatalf("expected content too large, got %v", err)
+	}
+
+	rec = importConversation{System: "be brief", User: "hi", Assistant: "ok"}
+	_, err = normalizeImport(rec, 1, "train", "approved", nil, "", "", nil, limits)
+	if err == nil || invalidRecordReason(err) != "too many messages" || !strings.Contains(err.Error(), "3 messages (max 2)") {
+		t.Fatalf("expected too many messages, got %v", err)
+	}
+
+	if got := invalidRecordReason(errors.New("invalid role at message 0")); got != "invalid record" {
+		t.Fatalf("expected invalid record, got %q", got)
+	}
+}
+
+func TestNormalizeImport_MessageOrder(t *testing.T) {
+	var rec importConversation
+	raw := `{"messages":[
+		{"role":"assistant","content":"a1","order":2},
+		{"role":"user","content":"q1","order":1},
+		{"role":"user","content":"q2","order":3},
+		{"role":"user","content":"q2 again","order":3},
+		{"role":"assistant","content":"a2","order":7}]}`
+	if err := json.Unmarshal([]byte(raw), &rec); err != nil {
+		t.Fatal(err)
+	}
+	conv, err := normalizeImport(rec, 1, "train", "approved", nil, "", "", nil, models.MessageLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range conv.Messages {
+		got = append(got, m.Content)
+	}
+	// Sparse orders are fine; the duplicate 3s keep their input order.
+	if want := []string{"q1", "a1", "q2", "q2 again", "a2"}; !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	one := 1
+	rec.Messages[0].Order = nil
+	rec.Messages[1].Order = &one
+	if _, err := normalizeImport(rec, 1, "train", "approved", nil, "", "", nil, models.MessageLimits{}); err == nil || !strings.Contains(err.Error(), "order set on 4 of 5") {
+		t.Fatalf("expected partial order rejected, got %v", err)
+	}
+}
+
+func TestPassedFlags_OmitsDatabaseURL(t *testing.T) {
+	fs := flag.NewFlagSet("import_jsonl", flag.ContinueOnError)
+	fs.String("database-url", "", "")
+	fs.String("into", "items", "")
+	fs.String("split", "train", "")
+	if err := fs.Parse([]string{"--database-url=postgres://u:secret@db/x", "--into=conversations"}); err != nil {
+		t.Fatal(err)
+	}
+	got := passedFlags(fs)
+	if want := map[string]string{"into": "conversations"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected only explicitly passed flags without the database URL, got %v", got)
+	}
+}
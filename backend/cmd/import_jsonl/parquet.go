@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"unicode/utf8"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+const formatParquet = "parquet"
+
+// readParquet reads path one row group at a time and calls fn with every row encoded as a
+// JSON object, rowIdx counting from 0 across the whole file. fn returns false to stop early.
+func readParquet(path string, fn func(rowIdx int64, raw []byte) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	pf, err := parquet.OpenFile(f, st.Size())
+	if err != nil {
+		return err
+	}
+
+	schema := pf.Schema()
+	groups := pf.RowGroups()
+	buf := make([]parquet.Row, 256)
+	var rowIdx int64
+	for gi, rg := range groups {
+		rows := rg.Rows()
+		for {
+			n, err := rows.ReadRows(buf)
+			for _, row := range buf[:n] {
+				obj := map[string]any{}
+				if err := schema.Reconstruct(&obj, row); err != nil {
+					rows.Close()
+					return fmt.Errorf("row %d: %w", rowIdx, err)
+				}
+				raw, err := json.Marshal(jsonValue(obj))
+				if err != nil {
+					rows.Close()
+					return fmt.Errorf("row %d: %w", rowIdx, err)
+				}
+				if !fn(rowIdx, raw) {
+					rows.Close()
+					return nil
+				}
+				rowIdx++
+			}
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("row group %d: %w", gi, err)
+			}
+		}
+		rows.Close()
+		log.Printf("parquet: row group %d/%d read rows=%d", gi+1, len(groups), rowIdx)
+	}
+	return nil
+}
+
+// jsonValue rewrites reconstructed parquet values for JSONB: un-annotated byte arrays become
+// strings when they hold valid UTF-8 (instead of base64), recursing into lists and groups.
+func jsonValue(v any) any {
+	switch x := v.(type) {
+	case []byte:
+		if utf8.Valid(x) {
+			return string(x)
+		}
+		return x
+	case map[string]any:
+		for k, e := range x {
+			x[k] = jsonValue(e)
+		}
+		return x
+	case []any:
+		for i, e := range x {
+			x[i] = jsonValue(e)
+		}
+		return x
+	default:
+		return v
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestReadParquet_Fixture(t *testing.T) {
+	var rows []map[string]any
+	var idxs []int64
+	err := readParquet("testdata/qa.parquet", func(rowIdx int64, raw []byte) bool {
+		var obj map[string]any
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			t.Fatalf("row %d: invalid json %s: %v", rowIdx, raw, err)
+		}
+		rows = append(rows, obj)
+		idxs = append(idxs, rowIdx)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("readParquet: %v", err)
+	}
+	if len(rows) != 3 || idxs[2] != 2 {
+		t.Fatalf("expected 3 rows across row groups, got %d (%v)", len(rows), idxs)
+	}
+
+	first := rows[0]
+	if first["question"] != "What is 2+2?" || first["score"] != 4.5 || first["turns"] != float64(2) || first["safe"] != true {
+		t.Fatalf("unexpected scalar columns: %v", first)
+	}
+	labels, ok := first["labels"].([]any)
+	if !ok || len(labels) != 2 || labels[0] != "math" {
+		t.Fatalf("expected labels list, got %#v", first["labels"])
+	}
+	if first["note"] != "reviewed" || rows[1]["note"] != nil {
+		t.Fatalf("unexpected optional column: %v / %v", first["note"], rows[1]["note"])
+	}
+}
+
+func TestApplyFieldMap(t *testing.T) {
+	fields, err := parseFieldMap("user=question, assistant=answer,tags=labels")
+	if err != nil {
+		t.Fatalf("parseFieldMap: %v", err)
+	}
+	out, err := applyFieldMap([]byte(`{"question":"hi","answer":"hello","labels":["a"]}`), fields)
+	if err != nil {
+		t.Fatalf("applyFieldMap: %v", err)
+	}
+	var rec importConversation
+	if err := json.Unmarshal(out, &rec); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if rec.User != "hi" || rec.Assistant != "hello" || len(rec.Tags) != 1 || rec.Tags[0] != "a" {
+		t.Fatalf("unexpected mapped record: %+v", rec)
+	}
+
+	if _, err := parseFieldMap("bogus=col"); err == nil {
+		t.Fatalf("expected unknown field error")
+	}
+	if _, err := parseFieldMap("user"); err == nil {
+		t.Fatalf("expected malformed entry error")
+	}
+}
+
+func TestApplyItemMap(t *testing.T) {
+	renames, err := parseItemMap("input=user, output=assistant,user=prompt")
+	if err != nil {
+		t.Fatalf("parseItemMap: %v", err)
+	}
+	out, err := applyItemMap([]byte(`{"input":"hi","output":"hello","user":"u1","assistant":"old","id":7}`), renames)
+	if err != nil {
+		t.Fatalf("applyItemMap: %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	// Renames happen at once: user moves to prompt before input takes its place, and the
+	// existing assistant key is replaced.
+	want := map[string]any{"user": "hi", "assistant": "hello", "prompt": "u1", "id": float64(7)}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+
+	if _, err := applyItemMap([]byte(`["not","an","object"]`), renames); err == nil {
+		t.Fatalf("expected non-object error")
+	}
+	if _, err := parseItemMap("input"); err == nil {
+		t.Fatalf("expected malformed entry error")
+	}
+	if _, err := parseItemMap("input=text,output=text"); err == nil {
+		t.Fatalf("expected duplicate target error")
+	}
+}
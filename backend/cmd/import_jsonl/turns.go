@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"caiatech-datalab/backend/internal/models"
+)
+
+// inferTurnRoles turns rec.Turns, untagged alternating strings, into messages for
+// --infer-roles: user first, then assistant, led by rec.System when set. The turns must form
+// whole user/assistant pairs, so a transcript cut off after a user turn is rejected.
+func inferTurnRoles(rec importConversation) (importConversation, error) {
+	if len(rec.Turns) < 2 {
+		return rec, fmt.Errorf("turns: need at least 2 turns, got %d", len(rec.Turns))
+	}
+	if len(rec.Turns)%2 != 0 {
+		return rec, fmt.Errorf("turns: need user/assistant pairs, got %d turns", len(rec.Turns))
+	}
+	msgs := make([]importMessage, 0, len(rec.Turns)+1)
+	if system := strings.TrimSpace(rec.System); system != "" {
+		msgs = append(msgs, importMessage{Message: models.Message{Role: models.RoleSystem, Content: system}})
+	}
+	for i, turn := range rec.Turns {
+		if strings.TrimSpace(turn) == "" {
+			return rec, fmt.Errorf("turns: empty turn %d", i)
+		}
+		role := models.RoleUser
+		if i%2 == 1 {
+			role = models.RoleAssistant
+		}
+		msgs = append(msgs, importMessage{Message: models.Message{Role: role, Content: turn}})
+	}
+	rec.Messages = msgs
+	return rec, nil
+}
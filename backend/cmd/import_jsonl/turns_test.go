@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"caiatech-datalab/backend/internal/models"
+)
+
+func TestInferTurnRoles(t *testing.T) {
+	rec, err := inferTurnRoles(importConversation{System: " Be brief. ", Turns: []string{"hi", "hello", "bye", "see you"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.Role{models.RoleSystem, models.RoleUser, models.RoleAssistant, models.RoleUser, models.RoleAssistant}
+	if len(rec.Messages) != len(want) {
+		t.Fatalf("got %d messages, want %d", len(rec.Messages), len(want))
+	}
+	for i, role := range want {
+		if rec.Messages[i].Role != role {
+			t.Fatalf("message %d role = %s, want %s", i, rec.Messages[i].Role, role)
+		}
+	}
+	if rec.Messages[0].Content != "Be brief." || rec.Messages[4].Content != "see you" {
+		t.Fatalf("unexpected contents: %+v", rec.Messages)
+	}
+
+	rec, err = inferTurnRoles(importConversation{Turns: []string{"q", "a"}})
+	if err != nil || len(rec.Messages) != 2 || rec.Messages[0].Role != models.RoleUser {
+		t.Fatalf("without system: %+v %v", rec.Messages, err)
+	}
+
+	for name, turns := range map[string][]string{
+		"none":       nil,
+		"one":        {"q"},
+		"odd":        {"q", "a", "q2"},
+		"blank turn": {"q", "  "},
+	} {
+		if _, err := inferTurnRoles(importConversation{Turns: turns}); err == nil || !strings.HasPrefix(err.Error(), "turns:") {
+			t.Fatalf("%s: expected a turns error, got %v", name, err)
+		}
+	}
+}
+
+func TestInferTurnRoles_Normalizes(t *testing.T) {
+	rec, err := inferTurnRoles(importConversation{Turns: []string{" q ", " a "}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv, err := normalizeImport(rec, 1, "train", "approved", nil, "", "", nil, models.MessageLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conv.Messages[0].Content != "q" || conv.Messages[1].Content != "a" {
+		t.Fatalf("unexpected messages: %+v", conv.Messages)
+	}
+}
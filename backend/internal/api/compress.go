@@ -0,0 +1,50 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	compressNone = "none"
+	compressGzip = "gzip"
+	compressZstd = "zstd"
+)
+
+var compressValues = []string{compressNone, compressGzip, compressZstd}
+
+func normalizeCompress(s string) (string, bool) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	switch s {
+	case "", compressNone:
+		return compressNone, true
+	case compressGzip, "gz":
+		return compressGzip, true
+	case compressZstd, "zst":
+		return compressZstd, true
+	default:
+		return "", false
+	}
+}
+
+// newCompressWriter wraps w with the requested encoder. Close must be called to flush
+// the trailing frame; it does not close w.
+func newCompressWriter(w io.Writer, compress string) (io.WriteCloser, error) {
+	switch compress {
+	case compressGzip:
+		return gzip.NewWriter(w), nil
+	case compressZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"caiatech-datalab/backend/internal/models"
+)
+
+// datasetCache keeps dataset heads (see models.GetDatasetHead) for a short TTL so that
+// existence, visibility and kind checks on hot paths skip the database. Writes through this
+// process invalidate their entry; other processes see changes after at most the TTL.
+type datasetCache struct {
+	ttl time.Duration // 0 disables caching
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[int64]datasetCacheEntry
+}
+
+type datasetCacheEntry struct {
+	ds      models.Dataset
+	expires time.Time
+}
+
+func newDatasetCache(ttl time.Duration) *datasetCache {
+	return &datasetCache{ttl: ttl, now: time.Now, entries: map[int64]datasetCacheEntry{}}
+}
+
+// get returns the cached head for id, calling load on a miss. Errors (including
+// models.ErrNotFound) are not cached.
+func (c *datasetCache) get(id int64, load func() (models.Dataset, error)) (models.Dataset, error) {
+	if c.ttl <= 0 {
+		return load()
+	}
+	c.mu.Lock()
+	e, ok := c.entries[id]
+	c.mu.Unlock()
+	if ok && c.now().Before(e.expires) {
+		return e.ds, nil
+	}
+
+	ds, err := load()
+	if err != nil {
+		return models.Dataset{}, err
+	}
+	c.mu.Lock()
+	c.entries[id] = datasetCacheEntry{ds: ds, expires: c.now().Add(c.ttl)}
+	c.mu.Unlock()
+	return ds, nil
+}
+
+func (c *datasetCache) invalidate(id int64) {
+	c.mu.Lock()
+	delete(c.entries, id)
+	c.mu.Unlock()
+}
+
+// datasetHead returns the dataset's own columns (no readme or counts), cached.
+func (h *Handler) datasetHead(ctx context.Context, id int64) (models.Dataset, error) {
+	return h.datasets.get(id, func() (models.Dataset, error) {
+		return models.GetDatasetHead(ctx, h.db, id)
+	})
+}
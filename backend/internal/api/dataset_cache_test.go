@@ -0,0 +1,68 @@
+package api
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"caiatech-datalab/backend/internal/models"
+)
+
+func TestDatasetCache_HitsExpiryAndInvalidation(t *testing.T) {
+	now := time.Unix(1000, 0)
+	c := newDatasetCache(5 * time.Second)
+	c.now = func() time.Time { return now }
+
+	loads := 0
+	load := func() (models.Dataset, error) {
+		loads++
+		return models.Dataset{ID: 7, Kind: "items"}, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if ds, err := c.get(7, load); err != nil || ds.Kind != "items" {
+			t.Fatalf("unexpected result %+v %v", ds, err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("expected one load for repeated gets, got %d", loads)
+	}
+
+	now = now.Add(6 * time.Second)
+	_, _ = c.get(7, load)
+	if loads != 2 {
+		t.Fatalf("expected a reload after the TTL, got %d loads", loads)
+	}
+
+	c.invalidate(7)
+	_, _ = c.get(7, load)
+	if loads != 3 {
+		t.Fatalf("expected a reload after invalidate, got %d loads", loads)
+	}
+}
+
+func TestDatasetCache_ErrorsAndDisabled(t *testing.T) {
+	c := newDatasetCache(time.Minute)
+	loads := 0
+	missing := func() (models.Dataset, error) {
+		loads++
+		return models.Dataset{}, models.ErrNotFound
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.get(1, missing); !errors.Is(err, models.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	}
+	if loads != 2 {
+		t.Fatalf("misses must not be cached, got %d loads", loads)
+	}
+
+	off := newDatasetCache(0)
+	loads = 0
+	found := func() (models.Dataset, error) { loads++; return models.Dataset{ID: 1}, nil }
+	_, _ = off.get(1, found)
+	_, _ = off.get(1, found)
+	if loads != 2 {
+		t.Fatalf("a zero TTL disables caching, got %d loads", loads)
+	}
+}
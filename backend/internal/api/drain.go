@@ -0,0 +1,54 @@
+package api
+
+import (
+	"context"
+	"sync"
+)
+
+// exportTracker counts in-flight export streams so shutdown can wait for them to finish
+// instead of truncating downloads.
+type exportTracker struct {
+	mu       sync.Mutex
+	draining bool
+	wg       sync.WaitGroup
+}
+
+// begin registers a new export; it returns false once draining has started.
+func (t *exportTracker) begin() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return false
+	}
+	t.wg.Add(1)
+	return true
+}
+
+func (t *exportTracker) done() {
+	t.wg.Done()
+}
+
+// drain rejects new exports and waits for active ones until ctx is done.
+func (t *exportTracker) drain(ctx context.Context) error {
+	t.mu.Lock()
+	t.draining = true
+	t.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DrainExports stops accepting export requests (they get 503) and blocks until in-flight
+// exports complete or ctx expires.
+func (h *Handler) DrainExports(ctx context.Context) error {
+	return h.exports.drain(ctx)
+}
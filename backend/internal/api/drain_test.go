@@ -0,0 +1,45 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestExportTracker_DrainWaitsForActive(t *testing.T) {
+	var tr exportTracker
+	if !tr.begin() {
+		t.Fatalf("expected begin to succeed before draining")
+	}
+
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(released)
+		tr.done()
+	}()
+
+	if err := tr.drain(context.Background()); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	select {
+	case <-released:
+	default:
+		t.Fatalf("drain returned before the active export finished")
+	}
+	if tr.begin() {
+		t.Fatalf("expected begin to fail while draining")
+	}
+}
+
+func TestExportTracker_DrainTimesOut(t *testing.T) {
+	var tr exportTracker
+	tr.begin()
+	defer tr.done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := tr.drain(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
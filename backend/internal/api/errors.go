@@ -0,0 +1,189 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+
+	"caiatech-datalab/backend/internal/models"
+)
+
+// Error codes sent in the "code" field of every error body. Clients branch on codes; messages
+// are for people and may change. A rejected request field uses invalid_<field> (invalid_split,
+// invalid_id, ...), see fieldError.
+const (
+	codeBadRequest       = "bad_request"
+	codeInvalidJSON      = "invalid_json"
+	codeInvalidInput     = "invalid_input"
+	codeInvalidMeta      = "invalid_meta"
+	codeTooManyMessages  = "too_many_messages"
+	codeContentTooLarge  = "content_too_large"
+	codeInvalidIdemKey   = "invalid_idempotency_key"
+	codeIdemKeyReused    = "idempotency_key_reused"
+	codeBannedPhrase     = "banned_phrase"
+	codeWrongDatasetKind = "wrong_dataset_kind"
+	codeSplitPurity      = "split_purity"
+	codeUnauthorized     = "unauthorized"
+	codeNotFound         = "not_found"
+	codeConflict         = "conflict"
+	codeDatasetLocked    = "dataset_locked"
+	codeOpenFlags        = "open_flags"
+	codeLLMDisabled      = "llm_disabled"
+	codeUpstreamError    = "upstream_error"
+	codeUpstreamTimeout  = "upstream_timeout"
+	codeEmbedDisabled    = "embeddings_disabled"
+	codeNoVector         = "vector_unavailable"
+	codeUnprocessable    = "unprocessable"
+	codeInternal         = "internal"
+	codeUnavailable      = "unavailable"
+)
+
+// statusErrorCodes is the code writeJSONError uses for each status.
+var statusErrorCodes = map[int]string{
+	http.StatusBadRequest:          codeBadRequest,
+	http.StatusUnauthorized:        codeUnauthorized,
+	http.StatusNotFound:            codeNotFound,
+	http.StatusConflict:            codeConflict,
+	http.StatusLocked:              codeDatasetLocked,
+	http.StatusUnprocessableEntity: codeUnprocessable,
+	http.StatusInternalServerError: codeInternal,
+	http.StatusServiceUnavailable:  codeUnavailable,
+}
+
+const requestIDHeader = "X-Request-Id"
+
+// apiError is the body of every error response, wrapped as {"error": apiError}.
+type apiError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Field     string `json:"field,omitempty"`
+	Index     *int   `json:"index,omitempty"` // offending message, for invalid_meta and content_too_large
+	RequestID string `json:"request_id,omitempty"`
+
+	// Fields lists every rejected body field (name -> message) when validation collects them;
+	// Code and Field then describe the first.
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// fieldError is a validation failure tied to one request field.
+type fieldError struct {
+	Code    string
+	Field   string
+	Message string
+}
+
+func (e *fieldError) Error() string { return e.Message }
+
+// invalidField returns a fieldError with code invalid_<field>.
+func invalidField(field, msg string) error {
+	return &fieldError{Code: "invalid_" + field, Field: field, Message: msg}
+}
+
+// addFieldError records a plain invalid_<field> error in verr. Any other error (nil
+// included) is returned unchanged.
+func addFieldError(verr *models.ValidationError, err error) error {
+	var fe *fieldError
+	if errors.As(err, &fe) && fe.Code == "invalid_"+fe.Field {
+		verr.Add(fe.Field, fe.Message)
+		return nil
+	}
+	return err
+}
+
+// errorBody builds the {"error": ...} envelope, stamping the request ID set by withCORS.
+func errorBody(w http.ResponseWriter, e apiError) map[string]any {
+	e.RequestID = w.Header().Get(requestIDHeader)
+	return map[string]any{"error": e}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, e apiError) {
+	writeJSON(w, status, errorBody(w, e))
+}
+
+// writeJSONError writes msg with the default code for status.
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	code, ok := statusErrorCodes[status]
+	if !ok {
+		code = codeBadRequest
+	}
+	writeAPIError(w, status, apiError{Code: code, Message: msg})
+}
+
+// writeErrorCode writes msg with an explicit code.
+func writeErrorCode(w http.ResponseWriter, status int, code, msg string) {
+	writeAPIError(w, status, apiError{Code: code, Message: msg})
+}
+
+// writeFieldError reports a rejected request field as 400 invalid_<field>.
+func writeFieldError(w http.ResponseWriter, field, msg string) {
+	writeError(w, http.StatusBadRequest, invalidField(field, msg))
+}
+
+// writeError writes err with status, keeping the code and field of a fieldError, listing
+// the fields of a models.ValidationError and using invalid_input for other
+// models.ErrInvalidInput errors.
+func writeError(w http.ResponseWriter, status int, err error) {
+	var fe *fieldError
+	var ve *models.ValidationError
+	switch {
+	case errors.As(err, &fe):
+		writeAPIError(w, status, apiError{Code: fe.Code, Message: fe.Message, Field: fe.Field})
+	case errors.As(err, &ve):
+		first := ve.First()
+		writeAPIError(w, status, apiError{Code: "invalid_" + first, Message: ve.Error(), Field: first, Fields: ve.Fields})
+	case errors.Is(err, models.ErrInvalidInput):
+		writeErrorCode(w, status, codeInvalidInput, err.Error())
+	default:
+		writeJSONError(w, status, err.Error())
+	}
+}
+
+// writeNormalizeError reports a rejected conversation: 422 invalid_meta with the message
+// index for bad meta, 422 too_many_messages or content_too_large (with the index) over a
+// message limit, 400 otherwise.
+func writeNormalizeError(w http.ResponseWriter, err error) {
+	var me *models.MetaError
+	var le *models.LimitError
+	var e apiError
+	var index int
+	switch {
+	case errors.As(err, &me):
+		e = apiError{Code: codeInvalidMeta, Message: me.Error(), Field: "messages"}
+		index = me.Index
+	case errors.As(err, &le):
+		e = apiError{Code: codeContentTooLarge, Message: le.Error(), Field: "messages"}
+		if le.Limit == models.LimitMessages {
+			e.Code = codeTooManyMessages
+		}
+		index = le.Index
+	default:
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if index >= 0 {
+		e.Index = &index
+	}
+	writeAPIError(w, http.StatusUnprocessableEntity, e)
+}
+
+// requestID returns the caller's X-Request-Id when it is short and plain, or a new one.
+func requestID(r *http.Request) string {
+	if id := r.Header.Get(requestIDHeader); id != "" && len(id) <= 64 && isPlainID(id) {
+		return id
+	}
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func isPlainID(s string) bool {
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
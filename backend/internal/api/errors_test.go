@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"caiatech-datalab/backend/internal/models"
+)
+
+func TestWriteError_Codes(t *testing.T) {
+	cases := []struct {
+		err   error
+		code  string
+		field string
+	}{
+		{invalidField("split", "invalid split"), "invalid_split", "split"},
+		{fmt.Errorf("%w: score must be 1-5", models.ErrInvalidInput), codeInvalidInput, ""},
+		{errors.New("boom"), codeBadRequest, ""},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		rec.Header().Set(requestIDHeader, "req-1")
+		writeError(rec, http.StatusBadRequest, tc.err)
+		e := assertErrorCode(t, rec, http.StatusBadRequest, tc.code)
+		if e.Field != tc.field || e.Message != tc.err.Error() {
+			t.Fatalf("%v: unexpected envelope %+v", tc.err, e)
+		}
+	}
+}
+
+func TestWriteError_ValidationFields(t *testing.T) {
+	var v models.ValidationError
+	v.Add("split", "invalid split")
+	v.Add("dataset_id", "dataset_id required")
+	rec := httptest.NewRecorder()
+	rec.Header().Set(requestIDHeader, "req-1")
+	writeError(rec, http.StatusBadRequest, v.Err())
+	e := assertErrorCode(t, rec, http.StatusBadRequest, "invalid_split")
+	if e.Field != "split" || len(e.Fields) != 2 || e.Fields["dataset_id"] != "dataset_id required" {
+		t.Fatalf("unexpected envelope %+v", e)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	req.Header.Set(requestIDHeader, "trace-42.a_b")
+	if got := requestID(req); got != "trace-42.a_b" {
+		t.Fatalf("expected the caller's id to be kept, got %q", got)
+	}
+	req.Header.Set(requestIDHeader, "bad id\n")
+	if got := requestID(req); got == "bad id\n" || len(got) != 16 {
+		t.Fatalf("expected a fresh id for an unsafe one, got %q", got)
+	}
+}
+
+func TestWriteIdempotentJSON_SetsLocation(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeIdempotentJSON(rec, "conversations", 7, http.StatusCreated, []byte(`{"id":7}`+"\n"))
+	if got := rec.Header().Get("Location"); got != "/api/v1/conversations/7" {
+		t.Fatalf("expected Location /api/v1/conversations/7, got %q", got)
+	}
+	if rec.Code != http.StatusCreated || rec.Body.String() != `{"id":7}`+"\n" {
+		t.Fatalf("expected the stored body with 201, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCompleteIdempotent_WithoutKey(t *testing.T) {
+	// Without a key nothing is stored, so no transaction is needed.
+	body, err := completeIdempotent(context.Background(), nil, "proposals", "", 3, http.StatusCreated, map[string]any{"id": 3})
+	if err != nil || string(body) != `{"id":3}`+"\n" {
+		t.Fatalf("expected the encoded body, got %q %v", body, err)
+	}
+	h := NewHandler(HandlerDeps{})
+	if !h.reserveIdempotent(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/proposals", nil), nil, "proposals", "", body) {
+		t.Fatal("expected an empty key to reserve nothing and proceed")
+	}
+}
+
+func TestIdempotencyKey_TooLong(t *testing.T) {
+	routes := NewHandler(HandlerDeps{AdminToken: "secret"}).Routes()
+	for _, path := range []string{"/api/v1/conversations", "/api/v1/proposals"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{}`))
+		req.Header.Set("X-Admin-Token", "secret")
+		req.Header.Set("Idempotency-Key", strings.Repeat("k", 256))
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		assertErrorCode(t, rec, http.StatusBadRequest, codeInvalidIdemKey)
+	}
+}
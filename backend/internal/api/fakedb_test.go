@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"caiatech-datalab/backend/internal/models"
+)
+
+// fakeDB is a database/sql driver that hands every statement to answer, so handler paths
+// past validation can run without Postgres. Statements are answered one at a time.
+type fakeDB struct {
+	mu     sync.Mutex
+	answer func(query string, args []any) fakeResult
+}
+
+// fakeResult is the answer to one statement: the columns and rows of a query, or the rows
+// affected by an exec.
+type fakeResult struct {
+	cols     []string
+	rows     [][]any
+	affected int64
+	err      error
+}
+
+// newFakeDB opens a *sql.DB whose statements are answered by answer.
+func newFakeDB(t *testing.T, answer func(query string, args []any) fakeResult) *sql.DB {
+	t.Helper()
+	db := sql.OpenDB(&fakeDB{answer: answer})
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func (d *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{d}, nil }
+func (d *fakeDB) Driver() driver.Driver                        { return nil }
+
+func (d *fakeDB) run(query string, args []driver.NamedValue) fakeResult {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	vals := make([]any, len(args))
+	for i, a := range args {
+		vals[i] = a.Value
+	}
+	return d.answer(strings.TrimSpace(query), vals)
+}
+
+type fakeConn struct{ d *fakeDB }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+func (c fakeConn) Close() error              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+// CheckNamedValue converts arguments as database/sql would (ints to int64, ...) and passes
+// anything else, such as arrays, through unchanged.
+func (c fakeConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if v, err := driver.DefaultParameterConverter.ConvertValue(nv.Value); err == nil {
+		nv.Value = v
+	}
+	return nil
+}
+
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	res := c.d.run(query, args)
+	if res.err != nil {
+		return nil, res.err
+	}
+	return driver.RowsAffected(res.affected), nil
+}
+
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	res := c.d.run(query, args)
+	if res.err != nil {
+		return nil, res.err
+	}
+	return &fakeRows{res: res}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	res  fakeResult
+	next int
+}
+
+func (r *fakeRows) Columns() []string { return r.res.cols }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.res.rows) {
+		return io.EOF
+	}
+	for i, v := range r.res.rows[r.next] {
+		dest[i] = v
+	}
+	r.next++
+	return nil
+}
+
+// conversationRowResult answers GetConversation with c as its only row. Tags and meta are
+// always empty; a nil MessagesUpdatedAt reads back as NULL.
+func conversationRowResult(c models.Conversation) fakeResult {
+	var messagesUpdated any
+	if c.MessagesUpdatedAt != nil {
+		messagesUpdated = *c.MessagesUpdatedAt
+	}
+	return fakeResult{
+		cols: []string{"id", "dataset_id", "split", "status", "tags", "source", "notes", "lang", "meta", "created_at", "updated_at", "avg", "count", "import_run_id", "messages_updated_at", "name", "kind"},
+		rows: [][]any{{c.ID, c.DatasetID, string(c.Split), string(c.Status), []byte(`[]`), c.Source, c.Notes, c.Lang, []byte(`{}`), c.CreatedAt, c.UpdatedAt,
+			nil, int64(0), nil, messagesUpdated, c.DatasetName, c.DatasetKind}},
+	}
+}
+
+// datasetRowResult answers the plain dataset lookup (FROM datasets WHERE id = $1) with d,
+// unlocked.
+func datasetRowResult(d models.Dataset) fakeResult {
+	return fakeResult{
+		cols: []string{"id", "name", "description", "kind", "project_id", "visibility", "license", "provenance_url", "default_split", "default_status", "created_at", "updated_at", "locked_by", "locked_at", "lock_expires_at"},
+		rows: [][]any{{d.ID, d.Name, d.Description, d.Kind, d.ProjectID, d.Visibility, d.License, d.ProvenanceURL, d.DefaultSplit, d.DefaultStatus, d.CreatedAt, d.UpdatedAt, "", nil, nil}},
+	}
+}
+
+// datasetDetailRowResult answers GetDataset with d, unlocked, including the readme and the
+// cached counts.
+func datasetDetailRowResult(d models.Dataset) fakeResult {
+	return fakeResult{
+		cols: []string{"id", "name", "description", "kind", "project_id", "visibility", "license", "provenance_url", "default_split", "default_status", "readme",
+			"item_count", "conversation_count", "train_count", "valid_count", "test_count", "created_at", "updated_at", "locked_by", "locked_at", "lock_expires_at"},
+		rows: [][]any{{d.ID, d.Name, d.Description, d.Kind, d.ProjectID, d.Visibility, d.License, d.ProvenanceURL, d.DefaultSplit, d.DefaultStatus, d.Readme,
+			d.ItemCount, d.ConversationCount, d.TrainCount, d.ValidCount, d.TestCount, d.CreatedAt, d.UpdatedAt, "", nil, nil}},
+	}
+}
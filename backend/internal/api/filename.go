@@ -0,0 +1,136 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"caiatech-datalab/backend/internal/models"
+)
+
+const defaultExportBasename = "caiatech-datalab"
+
+// exportFilename builds a download name like "support-bot_pairs_train_2024-06-01.jsonl".
+// datasetName may be empty for cross-dataset exports.
+func exportFilename(datasetName, outType, split string, now time.Time, ext string) string {
+	base := slugify(datasetName)
+	if base == "" {
+		base = defaultExportBasename
+	}
+	parts := []string{base}
+	if t := slugify(outType); t != "" {
+		parts = append(parts, t)
+	}
+	if s := slugify(split); s != "" {
+		parts = append(parts, s)
+	}
+	parts = append(parts, now.UTC().Format("2006-01-02"))
+	return strings.Join(parts, "_") + ext
+}
+
+// groupedExportFiles names one "dataset-<name>.jsonl" file per dataset for group_by=dataset,
+// falling back to (or suffixing) the dataset id when the name slugs to nothing or collides.
+func groupedExportFiles(datasets []models.Dataset) []models.ExportFile {
+	files := make([]models.ExportFile, 0, len(datasets))
+	seen := map[string]bool{}
+	for _, ds := range datasets {
+		base := slugify(ds.Name)
+		if base == "" {
+			base = strconv.FormatInt(ds.ID, 10)
+		} else if seen[base] {
+			base += "-" + strconv.FormatInt(ds.ID, 10)
+		}
+		seen[base] = true
+		files = append(files, models.ExportFile{File: "dataset-" + base + ".jsonl", DatasetID: ds.ID, Dataset: ds.Name})
+	}
+	return files
+}
+
+// exportExtension returns the file extension for an export body.
+func exportExtension(compress string) string {
+	switch compress {
+	case compressGzip:
+		return ".jsonl.gz"
+	case compressZstd:
+		return ".jsonl.zst"
+	default:
+		return ".jsonl"
+	}
+}
+
+// slugify lowercases s and collapses every run of non letter/digit runes into a single '-'.
+// Unicode letters are kept; contentDisposition takes care of encoding them.
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(s)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimRight(b.String(), "-")
+}
+
+// sanitizeFilename makes a user-supplied filename safe to echo into a Content-Disposition
+// header: directory components, control characters (header injection), quotes, backslashes
+// and separators are removed. Returns "" when nothing usable remains.
+func sanitizeFilename(s string) string {
+	s = strings.ReplaceAll(s, "\\", "/")
+	if i := strings.LastIndex(s, "/"); i >= 0 {
+		s = s[i+1:]
+	}
+
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case unicode.IsControl(r):
+			continue
+		case r == '"' || r == ';' || r == ':' || r == '*' || r == '?' || r == '<' || r == '>' || r == '|':
+			continue
+		case unicode.IsSpace(r):
+			b.WriteByte('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	out := strings.Trim(b.String(), ". _")
+	if len(out) > 200 {
+		out = strings.ToValidUTF8(out[:200], "")
+	}
+	return out
+}
+
+// contentDisposition renders an attachment header with an ASCII fallback filename plus the
+// RFC 5987 filename* form so non-ASCII names survive.
+func contentDisposition(filename string) string {
+	var ascii strings.Builder
+	for _, r := range filename {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			ascii.WriteByte('_')
+			continue
+		}
+		ascii.WriteRune(r)
+	}
+	return fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`, ascii.String(), rfc5987Escape(filename))
+}
+
+func rfc5987Escape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
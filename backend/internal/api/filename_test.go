@@ -0,0 +1,73 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"caiatech-datalab/backend/internal/models"
+)
+
+func TestExportFilename_DatasetTypeSplitDate(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	got := exportFilename("Support Bot", "pairs", "train", now, ".jsonl")
+	if got != "support-bot_pairs_train_2024-06-01.jsonl" {
+		t.Fatalf("unexpected filename: %q", got)
+	}
+}
+
+func TestExportFilename_NoDataset(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	got := exportFilename("", "conversations", "all", now, exportExtension(compressZstd))
+	if got != "caiatech-datalab_conversations_all_2024-06-01.jsonl.zst" {
+		t.Fatalf("unexpected filename: %q", got)
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"export.jsonl", "export.jsonl"},
+		{"../../etc/passwd", "passwd"},
+		{`C:\Users\me\data.jsonl`, "data.jsonl"},
+		{"evil.jsonl\r\nSet-Cookie: x=1", "evil.jsonlSet-Cookie_x=1"},
+		{`a"b;c.jsonl`, "abc.jsonl"},
+		{"my data.jsonl", "my_data.jsonl"},
+		{"..", ""},
+		{"\x00\x01", ""},
+	}
+	for _, tc := range cases {
+		if got := sanitizeFilename(tc.in); got != tc.want {
+			t.Fatalf("sanitizeFilename(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestContentDisposition_Unicode(t *testing.T) {
+	got := contentDisposition("données_pairs.jsonl")
+	if !strings.HasPrefix(got, `attachment; filename="donn_es_pairs.jsonl"; `) {
+		t.Fatalf("unexpected ascii fallback: %q", got)
+	}
+	if !strings.HasSuffix(got, "filename*=UTF-8''donn%C3%A9es_pairs.jsonl") {
+		t.Fatalf("unexpected filename*: %q", got)
+	}
+}
+
+func TestGroupedExportFiles(t *testing.T) {
+	files := groupedExportFiles([]models.Dataset{
+		{ID: 1, Name: "Support Bot"},
+		{ID: 2, Name: "support/bot"},
+		{ID: 3, Name: "../../"},
+	})
+	want := []string{"dataset-support-bot.jsonl", "dataset-support-bot-2.jsonl", "dataset-3.jsonl"}
+	for i, f := range files {
+		if f.File != want[i] {
+			t.Fatalf("file %d: got %q, want %q", i, f.File, want[i])
+		}
+	}
+	if files[1].DatasetID != 2 || files[1].Dataset != "support/bot" {
+		t.Fatalf("unexpected mapping: %+v", files[1])
+	}
+}
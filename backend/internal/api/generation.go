@@ -0,0 +1,266 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"text/template"
+
+	"caiatech-datalab/backend/internal/llm"
+	"caiatech-datalab/backend/internal/models"
+)
+
+// maxConsecutiveGenerationFailures fails a job once this many attempts in a row have failed,
+// so a broken endpoint or template does not burn through the whole target.
+const maxConsecutiveGenerationFailures = 5
+
+// generationRunner runs generation jobs in the background, one goroutine group per job.
+// Jobs interrupted by shutdown stay running in the database and are resumed on the next start.
+type generationRunner struct {
+	mu       sync.Mutex
+	stopping bool
+	cancels  map[int64]context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// start launches run for job id unless it is already running or shutdown has begun.
+func (g *generationRunner) start(id int64, run func(ctx context.Context)) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.stopping {
+		return false
+	}
+	if _, ok := g.cancels[id]; ok {
+		return false
+	}
+	if g.cancels == nil {
+		g.cancels = map[int64]context.CancelFunc{}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	g.cancels[id] = cancel
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer g.forget(id)
+		run(ctx)
+	}()
+	return true
+}
+
+func (g *generationRunner) forget(id int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if cancel, ok := g.cancels[id]; ok {
+		cancel()
+		delete(g.cancels, id)
+	}
+}
+
+// cancel stops job id's in-flight attempts, if it is running here.
+func (g *generationRunner) cancel(id int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if cancel, ok := g.cancels[id]; ok {
+		cancel()
+	}
+}
+
+// stop cancels every running job and waits for them to wind down until ctx is done.
+func (g *generationRunner) stop(ctx context.Context) error {
+	g.mu.Lock()
+	g.stopping = true
+	for _, cancel := range g.cancels {
+		cancel()
+	}
+	g.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ResumeGenerationJobs restarts queued and running jobs left over from a previous process.
+func (h *Handler) ResumeGenerationJobs(ctx context.Context) error {
+	jobs, err := models.ListActiveGenerationJobs(ctx, h.db)
+	if err != nil {
+		return err
+	}
+	for _, j := range jobs {
+		h.startGenerationJob(j)
+	}
+	return nil
+}
+
+// StopGenerationJobs cancels running generation jobs and waits until ctx expires for their
+// in-flight calls to return. The jobs stay running and resume on the next start.
+func (h *Handler) StopGenerationJobs(ctx context.Context) error {
+	return h.generation.stop(ctx)
+}
+
+func (h *Handler) startGenerationJob(j models.GenerationJob) {
+	h.generation.start(j.ID, func(ctx context.Context) { h.runGenerationJob(ctx, j) })
+}
+
+// generationProgress hands out seed positions to a job's workers and stops handing them
+// out once the target is reached, too many attempts in a row failed or the target dataset
+// turned out to be locked.
+type generationProgress struct {
+	mu          sync.Mutex
+	target      int
+	generated   int
+	inflight    int
+	next        int
+	consecutive int
+	lastErr     error
+	locked      *models.DatasetLockedError
+}
+
+func (p *generationProgress) take() (int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.locked != nil || p.consecutive >= maxConsecutiveGenerationFailures || p.generated+p.inflight >= p.target {
+		return 0, false
+	}
+	i := p.next
+	p.next++
+	p.inflight++
+	return i, true
+}
+
+func (p *generationProgress) finish(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inflight--
+	if err == nil {
+		p.generated++
+		p.consecutive = 0
+		return
+	}
+	p.consecutive++
+	p.lastErr = err
+	if le := models.AsLockedError(err); le != nil {
+		p.locked = le
+	}
+}
+
+// runGenerationJob generates until j has TargetCount conversations, cycling through its
+// seeds. A resumed job continues from the seed after its last finished attempt. The job
+// fails as soon as an insert finds the dataset locked.
+func (h *Handler) runGenerationJob(ctx context.Context, j models.GenerationJob) {
+	if err := models.StartGenerationJob(ctx, h.db, j.ID); err != nil {
+		return
+	}
+	fail := func(msg string) {
+		_ = models.FinishGenerationJob(context.Background(), h.db, j.ID, models.GenerationStatusFailed, msg)
+	}
+	if !h.llm.Enabled() {
+		fail("no LLM endpoint configured")
+		return
+	}
+	tmpl, err := models.ParseSeedTemplate(j.PromptTemplate)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	seeds, err := models.LoadGenerationSeeds(ctx, h.db, j)
+	if err != nil {
+		if ctx.Err() == nil {
+			fail("failed to load seeds")
+		}
+		return
+	}
+	if len(seeds) == 0 {
+		fail("seed dataset has no items")
+		return
+	}
+
+	p := &generationProgress{target: j.TargetCount, generated: j.Generated, next: j.Done()}
+	var wg sync.WaitGroup
+	for w := 0; w < j.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				i, ok := p.take()
+				if !ok {
+					return
+				}
+				err := h.generateOne(ctx, j, tmpl, seeds[i%len(seeds)])
+				if err != nil && ctx.Err() != nil {
+					// Canceled or shutting down: the attempt is not counted and is redone on resume.
+					return
+				}
+				// A stored conversation is counted even when the job was canceled meanwhile,
+				// so a resumed job does not generate it again.
+				p.finish(err)
+				_ = models.RecordGenerationAttempt(context.WithoutCancel(ctx), h.db, j.ID, err == nil)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return
+	}
+	if p.locked != nil {
+		fail(p.locked.Error())
+		return
+	}
+	if p.generated >= p.target {
+		_ = models.FinishGenerationJob(ctx, h.db, j.ID, models.GenerationStatusSucceeded, "")
+		return
+	}
+	fail(fmt.Sprintf("stopped after %d consecutive failures: %v", p.consecutive, p.lastErr))
+}
+
+// generateOne renders seed's prompt, asks the LLM for a reply and stores the exchange. The
+// system prompt, the rendered prompt and the reply go through the same banned-phrase and
+// size checks as submitted messages; the prompts are checked before the LLM is called.
+func (h *Handler) generateOne(ctx context.Context, j models.GenerationJob, tmpl *template.Template, seed models.GenerationSeed) error {
+	prompt, err := models.RenderSeedPrompt(tmpl, seed.Data)
+	if err != nil {
+		return err
+	}
+	var chat []models.Message
+	if j.SystemPrompt != "" {
+		chat = append(chat, models.Message{Role: models.RoleSystem, Content: j.SystemPrompt})
+	}
+	chat = append(chat, models.Message{Role: models.RoleUser, Content: prompt})
+	if idx, phrase := h.banned.MatchMessages(chat); idx >= 0 {
+		return fmt.Errorf("%s prompt contains banned phrase %q", chat[idx].Role, phrase)
+	}
+	if err := h.limits.CheckCount(len(chat) + 1); err != nil {
+		return err
+	}
+	msgs := make([]llm.Message, 0, len(chat))
+	for i, m := range chat {
+		if err := h.limits.CheckContent(i, m.Content); err != nil {
+			return err
+		}
+		msgs = append(msgs, llm.Message{Role: string(m.Role), Content: m.Content})
+	}
+
+	reply, err := h.llm.CompleteWith(ctx, msgs, llm.Params{Model: j.Params.Model, Temperature: j.Params.Temperature, MaxTokens: j.Params.MaxTokens})
+	if err != nil {
+		return err
+	}
+	if reply == "" {
+		return fmt.Errorf("upstream returned an empty reply")
+	}
+	if phrase, ok := h.banned.Match(reply); ok {
+		return fmt.Errorf("reply contains banned phrase %q", phrase)
+	}
+	if err := h.limits.CheckContent(len(msgs), reply); err != nil {
+		return err
+	}
+	_, err = models.InsertGeneratedConversation(ctx, h.db, j, seed, prompt, reply)
+	return err
+}
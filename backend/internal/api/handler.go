@@ -1,65 +1,215 @@
 package api
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"caiatech-datalab/backend/internal/lang"
+	"caiatech-datalab/backend/internal/llm"
 	"caiatech-datalab/backend/internal/models"
 )
 
+// defaultAuthHeader carries the admin token unless DATALAB_AUTH_HEADER names another header.
+const defaultAuthHeader = "X-Admin-Token"
+
 type HandlerDeps struct {
-	DB         *sql.DB
-	AdminToken string
+	DB            *sql.DB
+	AdminToken    string
+	BannedPhrases []string
+
+	// AuthHeader carries the admin token; empty means X-Admin-Token.
+	AuthHeader string
+
+	RequireLicense    bool
+	StrictAlternation bool
+	MaxExportRows     int
+
+	// Message limits (see models.MessageLimits); 0 disables each.
+	MaxMessages            int
+	MaxMessageContentBytes int
+	MaxMessageMetaBytes    int
+
+	// DatasetCacheTTL is how long dataset heads are cached for hot-path checks; 0 disables.
+	DatasetCacheTTL time.Duration
+
+	// DatasetLockTTL is the default lifetime of dataset locks; 0 means until unlocked.
+	DatasetLockTTL time.Duration
+
+	// LLM regenerates assistant replies; nil disables regeneration.
+	LLM *llm.Client
+
+	// Embedder embeds conversations for semantic search; nil disables it. EmbedIndex is the
+	// nearest-neighbor index kind (models.EmbedIndexes) and EmbedBatchSize the inputs sent per
+	// embeddings call.
+	Embedder       *llm.Client
+	EmbedIndex     string
+	EmbedBatchSize int
 }
 
 type Handler struct {
-	db         *sql.DB
-	adminToken string
+	db                *sql.DB
+	adminToken        string
+	authHeader        string
+	banned            *models.PhraseFilter
+	requireLicense    bool
+	strictAlternation bool
+	maxExportRows     int
+	limits            models.MessageLimits
+	lockTTL           time.Duration
+	llm               *llm.Client
+	embedder          *llm.Client
+	embedIndex        string
+	embedBatchSize    int
+
+	exports    exportTracker
+	generation generationRunner
+	datasets   *datasetCache
+	stats      instanceStatsCache
 }
 
 func NewHandler(deps HandlerDeps) *Handler {
-	return &Handler{db: deps.DB, adminToken: deps.AdminToken}
+	authHeader := http.CanonicalHeaderKey(strings.TrimSpace(deps.AuthHeader))
+	if authHeader == "" {
+		authHeader = defaultAuthHeader
+	}
+	return &Handler{
+		db:         deps.DB,
+		adminToken: deps.AdminToken,
+		authHeader: authHeader,
+		banned:     models.NewPhraseFilter(deps.BannedPhrases),
+
+		requireLicense:    deps.RequireLicense,
+		strictAlternation: deps.StrictAlternation,
+		maxExportRows:     deps.MaxExportRows,
+		lockTTL:           deps.DatasetLockTTL,
+		llm:               deps.LLM,
+		embedder:          deps.Embedder,
+		embedIndex:        deps.EmbedIndex,
+		embedBatchSize:    deps.EmbedBatchSize,
+		limits: models.MessageLimits{
+			MaxMessages:     deps.MaxMessages,
+			MaxContentBytes: deps.MaxMessageContentBytes,
+			MaxMetaBytes:    deps.MaxMessageMetaBytes,
+		},
+
+		datasets: newDatasetCache(deps.DatasetCacheTTL),
+	}
 }
 
 func (h *Handler) Routes() http.Handler {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("GET /healthz", h.handleHealthz)
+	mux.HandleFunc("GET /api/v1/stats", h.withCORS(h.handleInstanceStats))
 
 	// datasets
+	mux.HandleFunc("GET /api/v1/projects", h.withCORS(h.handleListProjects))
+	mux.HandleFunc("POST /api/v1/projects", h.withCORS(h.handleCreateProject))
+	mux.HandleFunc("GET /api/v1/projects/{slug}", h.withCORS(h.handleGetProject))
+	mux.HandleFunc("PATCH /api/v1/projects/{slug}", h.withCORS(h.handleUpdateProject))
+	mux.HandleFunc("DELETE /api/v1/projects/{slug}", h.withCORS(h.handleDeleteProject))
+	mux.HandleFunc("GET /api/v1/projects/{slug}/datasets", h.withCORS(h.handleListProjectDatasets))
+
 	mux.HandleFunc("GET /api/v1/datasets", h.withCORS(h.handleListDatasets))
 	mux.HandleFunc("POST /api/v1/datasets", h.withCORS(h.handleCreateDataset))
 	mux.HandleFunc("GET /api/v1/datasets/{id}", h.withCORS(h.handleGetDataset))
 	mux.HandleFunc("PATCH /api/v1/datasets/{id}", h.withCORS(h.handleUpdateDataset))
 	mux.HandleFunc("DELETE /api/v1/datasets/{id}", h.withCORS(h.handleDeleteDataset))
+	mux.HandleFunc("POST /api/v1/datasets/{id}/recount", h.withCORS(h.handleRecountDataset))
+	mux.HandleFunc("POST /api/v1/datasets/{id}/stats/snapshot", h.withCORS(h.handleSnapshotDatasetStats))
+	mux.HandleFunc("GET /api/v1/datasets/{id}/stats/history", h.withCORS(h.handleDatasetStatsHistory))
+	mux.HandleFunc("GET /api/v1/datasets/{id}/stats/history/{snapshot_id}", h.withCORS(h.handleGetDatasetStatsSnapshot))
+	mux.HandleFunc("POST /api/v1/datasets/{id}/lock", h.withCORS(h.handleLockDataset))
+	mux.HandleFunc("POST /api/v1/datasets/{id}/unlock", h.withCORS(h.handleUnlockDataset))
 	mux.HandleFunc("GET /api/v1/datasets/{id}/conversations", h.withCORS(h.handleListDatasetConversations))
 	mux.HandleFunc("GET /api/v1/datasets/{id}/items", h.withCORS(h.handleListDatasetItems))
+	mux.HandleFunc("GET /api/v1/datasets/{id}/items/sample", h.withCORS(h.handleSampleDatasetItems))
+	mux.HandleFunc("GET /api/v1/datasets/{id}/conversations/sample", h.withCORS(h.handleSampleConversations))
+	mux.HandleFunc("GET /api/v1/datasets/{id}/conversations/similar", h.withCORS(h.handleSimilarConversations))
+	mux.HandleFunc("POST /api/v1/datasets/{id}/embed", h.withCORS(h.handleEmbedDataset))
+	mux.HandleFunc("GET /api/v1/datasets/{id}/items/schema", h.withCORS(h.handleItemSchema))
+	mux.HandleFunc("GET /api/v1/datasets/{id}/imports", h.withCORS(h.handleListImportRuns))
+	mux.HandleFunc("GET /api/v1/import-runs", h.withCORS(h.handleListImportRunsByDataset))
+	mux.HandleFunc("POST /api/v1/import-runs/{id}/rollback", h.withCORS(h.handleRollbackImportRun))
+	mux.HandleFunc("GET /api/v1/datasets/{id}/tags/suggest", h.withCORS(h.handleSuggestTags))
+	mux.HandleFunc("GET /api/v1/datasets/{id}/sources", h.withCORS(h.handleListSources))
+	mux.HandleFunc("GET /api/v1/datasets/{id}/split-check", h.withCORS(h.handleSplitCheck))
+	mux.HandleFunc("GET /api/v1/datasets/{id}/meta-check", h.withCORS(h.handleMetaCheck))
+	mux.HandleFunc("POST /api/v1/datasets/{id}/strip-meta", h.withCORS(h.handleStripMeta))
+	mux.HandleFunc("POST /api/v1/datasets/{id}/reindex", h.withCORS(h.handleReindexDataset))
+	mux.HandleFunc("POST /api/v1/datasets/{id}/split-by-tag", h.withCORS(h.handleSplitByTag))
 	mux.HandleFunc("POST /api/v1/datasets/{id}/items", h.withCORS(h.handleCreateDatasetItem))
+	mux.HandleFunc("GET /api/v1/datasets/{id}/preferences", h.withCORS(h.handleListPreferences))
+	mux.HandleFunc("POST /api/v1/datasets/{id}/preferences", h.withCORS(h.handleCreatePreference))
+	mux.HandleFunc("GET /api/v1/datasets/{id}/preferences/next", h.withCORS(h.handleNextPreference))
+	mux.HandleFunc("GET /api/v1/datasets/{id}/preferences/{pref_id}", h.withCORS(h.handleGetPreference))
 
 	mux.HandleFunc("GET /api/v1/items/{id}", h.withCORS(h.handleGetDatasetItem))
 	mux.HandleFunc("PATCH /api/v1/items/{id}", h.withCORS(h.handleUpdateDatasetItem))
+	mux.HandleFunc("PATCH /api/v1/items/{id}/merge", h.withCORS(h.handleMergeDatasetItem))
+	mux.HandleFunc("POST /api/v1/items/{id}/move", h.withCORS(h.handleMoveDatasetItem))
 	mux.HandleFunc("DELETE /api/v1/items/{id}", h.withCORS(h.handleDeleteDatasetItem))
+	mux.HandleFunc("GET /api/v1/items/{id}/annotations", h.withCORS(h.handleListItemAnnotations))
+	mux.HandleFunc("PUT /api/v1/items/{id}/annotations/{key}", h.withCORS(h.handleSetItemAnnotation))
+	mux.HandleFunc("DELETE /api/v1/items/{id}/annotations/{key}", h.withCORS(h.handleDeleteItemAnnotation))
 
 	// conversations
+	mux.HandleFunc("GET /api/v1/conversations", h.withCORS(h.handleGetConversations))
 	mux.HandleFunc("GET /api/v1/conversations/{id}", h.withCORS(h.handleGetConversation))
 	mux.HandleFunc("POST /api/v1/conversations", h.withCORS(h.handleCreateConversation))
 	mux.HandleFunc("PATCH /api/v1/conversations/{id}", h.withCORS(h.handleUpdateConversation))
 	mux.HandleFunc("DELETE /api/v1/conversations/{id}", h.withCORS(h.handleDeleteConversation))
+	mux.HandleFunc("POST /api/v1/conversations/{id}/move", h.withCORS(h.handleMoveConversation))
+	mux.HandleFunc("POST /api/v1/conversations/{id}/duplicate", h.withCORS(h.handleDuplicateConversation))
+	mux.HandleFunc("POST /api/v1/conversations/{id}/reindex", h.withCORS(h.handleReindexConversation))
+	mux.HandleFunc("GET /api/v1/conversations/{id}/ratings", h.withCORS(h.handleListRatings))
+	mux.HandleFunc("PUT /api/v1/conversations/{id}/ratings", h.withCORS(h.handleUpsertRating))
+	mux.HandleFunc("POST /api/v1/conversations/{id}/messages", h.withCORS(h.handleAppendMessage))
+	mux.HandleFunc("GET /api/v1/conversations/{id}/messages/{idx}", h.withCORS(h.handleGetMessage))
+	mux.HandleFunc("PATCH /api/v1/conversations/{id}/messages/{idx}", h.withCORS(h.handleUpdateMessage))
+	mux.HandleFunc("POST /api/v1/conversations/{id}/flag", h.withCORS(h.handleFlagConversation))
+	mux.HandleFunc("GET /api/v1/conversations/{id}/flags", h.withCORS(h.handleListConversationFlags))
+	mux.HandleFunc("POST /api/v1/conversations/{id}/regenerate", h.withCORS(h.handleRegenerateMessage))
+	mux.HandleFunc("GET /api/v1/conversations/{id}/alternatives", h.withCORS(h.handleListAlternatives))
+	mux.HandleFunc("POST /api/v1/conversations/{id}/alternatives", h.withCORS(h.handleCreateAlternative))
+	mux.HandleFunc("POST /api/v1/conversations/{id}/alternatives/{alt_id}/promote", h.withCORS(h.handlePromoteAlternative))
+	mux.HandleFunc("POST /api/v1/conversations/{id}/accept-alternative", h.withCORS(h.handleAcceptAlternative))
+
+	// synthetic generation
+	mux.HandleFunc("POST /api/v1/generation-jobs", h.withCORS(h.handleCreateGenerationJob))
+	mux.HandleFunc("GET /api/v1/generation-jobs", h.withCORS(h.handleListGenerationJobs))
+	mux.HandleFunc("GET /api/v1/generation-jobs/{id}", h.withCORS(h.handleGetGenerationJob))
+	mux.HandleFunc("POST /api/v1/generation-jobs/{id}/cancel", h.withCORS(h.handleCancelGenerationJob))
 
 	// proposals (review workflow)
 	mux.HandleFunc("POST /api/v1/proposals", h.withCORS(h.handleCreateProposal))
 	mux.HandleFunc("GET /api/v1/proposals", h.withCORS(h.handleListProposalsAdmin))
+	mux.HandleFunc("DELETE /api/v1/proposals", h.withCORS(h.handlePurgeProposals))
+	mux.HandleFunc("GET /api/v1/proposals/{id}", h.withCORS(h.handleGetProposal))
 	mux.HandleFunc("POST /api/v1/proposals/{id}/approve", h.withCORS(h.handleApproveProposal))
 	mux.HandleFunc("POST /api/v1/proposals/{id}/reject", h.withCORS(h.handleRejectProposal))
+	mux.HandleFunc("POST /api/v1/proposals/{id}/flag", h.withCORS(h.handleFlagProposal))
+	mux.HandleFunc("GET /api/v1/proposals/{id}/flags", h.withCORS(h.handleListProposalFlags))
+
+	// moderation flags
+	mux.HandleFunc("GET /api/v1/flags", h.withCORS(h.handleListFlags))
+	mux.HandleFunc("POST /api/v1/flags/{id}/resolve", h.withCORS(h.handleResolveFlag))
 
 	// export
 	mux.HandleFunc("GET /api/v1/export.jsonl", h.withCORS(h.handleExportJSONL))
+	mux.HandleFunc("GET /api/v1/export/options", h.withCORS(h.handleExportOptions))
 
 	return mux
 }
@@ -68,8 +218,9 @@ func (h *Handler) withCORS(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PATCH,DELETE,OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type,X-Admin-Token")
-		w.Header().Set("Access-Control-Expose-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type,"+h.authHeader+",Idempotency-Key,X-Request-Id")
+		w.Header().Set("Access-Control-Expose-Headers", "Content-Type,Content-Disposition,Location,X-Export-Warning,X-Export-Truncated,X-Export-Dedup-Skipped,X-Export-Dedup-Hash-Skipped,X-Request-Id")
+		w.Header().Set(requestIDHeader, requestID(r))
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
@@ -83,6 +234,169 @@ func (h *Handler) handleHealthz(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "ts": time.Now().UTC().Format(time.RFC3339)})
 }
 
+// ----------------------------
+// Projects
+// ----------------------------
+
+type projectRequest struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+// resolveProject maps a project slug from a query or body to its id; "" means no project
+// (0). A malformed or unknown slug is a 400 invalid_project.
+func (h *Handler) resolveProject(w http.ResponseWriter, r *http.Request, slug string) (int64, bool) {
+	slug = strings.TrimSpace(slug)
+	if slug == "" {
+		return 0, true
+	}
+	if !models.ValidProjectSlug(slug) {
+		writeFieldError(w, "project", "invalid project slug")
+		return 0, false
+	}
+	id, err := models.ProjectID(r.Context(), h.db, slug)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeFieldError(w, "project", fmt.Sprintf("project %q not found", slug))
+			return 0, false
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to get project")
+		return 0, false
+	}
+	return id, true
+}
+
+// projectFromPath loads the project named by the {slug} path value, writing 400/404 itself.
+func (h *Handler) projectFromPath(w http.ResponseWriter, r *http.Request) (models.Project, bool) {
+	slug := r.PathValue("slug")
+	if !models.ValidProjectSlug(slug) {
+		writeFieldError(w, "slug", "invalid slug")
+		return models.Project{}, false
+	}
+	p, err := models.GetProjectBySlug(r.Context(), h.db, slug)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "project not found")
+			return models.Project{}, false
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to get project")
+		return models.Project{}, false
+	}
+	return p, true
+}
+
+// writeProjectError maps project store errors to responses.
+func writeProjectError(w http.ResponseWriter, err error, msg string) {
+	switch {
+	case errors.Is(err, models.ErrInvalidInput):
+		writeError(w, http.StatusBadRequest, err)
+	case errors.Is(err, models.ErrNotFound):
+		writeJSONError(w, http.StatusNotFound, "project not found")
+	case errors.Is(err, models.ErrConflict):
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeJSONError(w, http.StatusInternalServerError, msg)
+	}
+}
+
+func (h *Handler) handleListProjects(w http.ResponseWriter, r *http.Request) {
+	items, err := models.ListProjects(r.Context(), h.db)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to list projects")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func (h *Handler) handleGetProject(w http.ResponseWriter, r *http.Request) {
+	p, ok := h.projectFromPath(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (h *Handler) handleCreateProject(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+	var req projectRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON")
+		return
+	}
+	if !models.ValidProjectSlug(strings.TrimSpace(req.Slug)) {
+		writeFieldError(w, "slug", "invalid slug (lowercase letters, digits and dashes, at most 64)")
+		return
+	}
+
+	p, err := models.CreateProject(r.Context(), h.db, req.Slug, req.Name)
+	if err != nil {
+		writeProjectError(w, err, "failed to create project")
+		return
+	}
+	w.Header().Set("Location", "/api/v1/projects/"+p.Slug)
+	writeJSON(w, http.StatusCreated, p)
+}
+
+func (h *Handler) handleUpdateProject(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+	slug := r.PathValue("slug")
+	if !models.ValidProjectSlug(slug) {
+		writeFieldError(w, "slug", "invalid slug")
+		return
+	}
+	var req projectRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON")
+		return
+	}
+	if req.Slug != "" && req.Slug != slug {
+		writeFieldError(w, "slug", "slug cannot be changed")
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		writeFieldError(w, "name", "name required")
+		return
+	}
+
+	p, err := models.RenameProject(r.Context(), h.db, slug, req.Name)
+	if err != nil {
+		writeProjectError(w, err, "failed to update project")
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (h *Handler) handleDeleteProject(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+	slug := r.PathValue("slug")
+	if !models.ValidProjectSlug(slug) {
+		writeFieldError(w, "slug", "invalid slug")
+		return
+	}
+	if err := models.DeleteProject(r.Context(), h.db, slug); err != nil {
+		writeProjectError(w, err, "failed to delete project")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+func (h *Handler) handleListProjectDatasets(w http.ResponseWriter, r *http.Request) {
+	p, ok := h.projectFromPath(w, r)
+	if !ok {
+		return
+	}
+	h.listDatasets(w, r, p.ID)
+}
+
 // ----------------------------
 // Datasets
 // ----------------------------
@@ -91,15 +405,44 @@ type createDatasetRequest struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	Kind        string `json:"kind"`
+	Visibility  string `json:"visibility"`
+	Readme      string `json:"readme"`
+
+	License       string `json:"license"`
+	ProvenanceURL string `json:"provenance_url"`
+	DefaultSplit  string `json:"default_split"`
+	DefaultStatus string `json:"default_status"`
+
+	Project string `json:"project"` // slug; "" = the default project
 }
 
+// updateDatasetRequest leaves absent fields unchanged; "" clears the pointer fields (kind
+// excepted). An empty name or visibility also leaves it unchanged.
 type updateDatasetRequest struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Kind        string `json:"kind"`
+	Name        string  `json:"name"`
+	Description *string `json:"description"`
+	Kind        *string `json:"kind"`
+	Visibility  string  `json:"visibility"`
+	Readme      *string `json:"readme"`
+
+	License       *string `json:"license"`
+	ProvenanceURL *string `json:"provenance_url"`
+	DefaultSplit  *string `json:"default_split"`
+	DefaultStatus *string `json:"default_status"`
+
+	Project string `json:"project"` // slug of the project to move the dataset to
 }
 
 func (h *Handler) handleListDatasets(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := h.resolveProject(w, r, r.URL.Query().Get("project"))
+	if !ok {
+		return
+	}
+	h.listDatasets(w, r, projectID)
+}
+
+// listDatasets writes a page of datasets, limited to one project unless projectID is 0.
+func (h *Handler) listDatasets(w http.ResponseWriter, r *http.Request, projectID int64) {
 	q := strings.TrimSpace(r.URL.Query().Get("q"))
 	limit := parseIntDefault(r.URL.Query().Get("limit"), 50)
 	offset := parseIntDefault(r.URL.Query().Get("offset"), 0)
@@ -113,7 +456,13 @@ func (h *Handler) handleListDatasets(w http.ResponseWriter, r *http.Request) {
 		offset = 0
 	}
 
-	items, err := models.ListDatasets(r.Context(), h.db, models.ListDatasetsParams{Query: q, Limit: limit, Offset: offset})
+	items, err := models.ListDatasets(r.Context(), h.db, models.ListDatasetsParams{
+		Query:          q,
+		IncludePrivate: h.isAdmin(r),
+		ProjectID:      projectID,
+		Limit:          limit,
+		Offset:         offset,
+	})
 	if err != nil {
 		writeJSONError(w, http.StatusInternalServerError, "failed to list datasets")
 		return
@@ -124,7 +473,7 @@ func (h *Handler) handleListDatasets(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) handleGetDataset(w http.ResponseWriter, r *http.Request) {
 	id, err := parsePathInt64(r, "id")
 	if err != nil {
-		writeJSONError(w, http.StatusBadRequest, "invalid id")
+		writeFieldError(w, "id", "invalid id")
 		return
 	}
 	item, err := models.GetDataset(r.Context(), h.db, id)
@@ -136,6 +485,10 @@ func (h *Handler) handleGetDataset(w http.ResponseWriter, r *http.Request) {
 		writeJSONError(w, http.StatusInternalServerError, "failed to get dataset")
 		return
 	}
+	if !h.canRead(r, item.Visibility) {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
 	writeJSON(w, http.StatusOK, item)
 }
 
@@ -147,20 +500,42 @@ func (h *Handler) handleCreateDataset(w http.ResponseWriter, r *http.Request) {
 
 	var req createDatasetRequest
 	if err := decodeJSON(r.Body, &req); err != nil {
-		writeJSONError(w, http.StatusBadRequest, "invalid JSON")
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON")
+		return
+	}
+	projectID, ok := h.resolveProject(w, r, req.Project)
+	if !ok {
 		return
 	}
 
-	item, err := models.CreateDataset(r.Context(), h.db, req.Name, req.Description, req.Kind)
+	item, err := models.CreateDataset(r.Context(), h.db, models.CreateDatasetParams{
+		Name:        req.Name,
+		Description: req.Description,
+		Kind:        req.Kind,
+		Visibility:  req.Visibility,
+		Readme:      req.Readme,
+
+		License:       req.License,
+		ProvenanceURL: req.ProvenanceURL,
+		DefaultSplit:  req.DefaultSplit,
+		DefaultStatus: req.DefaultStatus,
+
+		ProjectID: projectID,
+	})
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidInput) {
-			writeJSONError(w, http.StatusBadRequest, "invalid dataset")
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if errors.Is(err, models.ErrConflict) {
+			writeError(w, http.StatusConflict, err)
 			return
 		}
 		writeJSONError(w, http.StatusInternalServerError, "failed to create dataset")
 		return
 	}
 
+	w.Header().Set("Location", resourcePath("datasets", item.ID))
 	writeJSON(w, http.StatusCreated, item)
 }
 
@@ -172,22 +547,48 @@ func (h *Handler) handleUpdateDataset(w http.ResponseWriter, r *http.Request) {
 
 	id, err := parsePathInt64(r, "id")
 	if err != nil {
-		writeJSONError(w, http.StatusBadRequest, "invalid id")
+		writeFieldError(w, "id", "invalid id")
 		return
 	}
 
 	var req updateDatasetRequest
 	if err := decodeJSON(r.Body, &req); err != nil {
-		writeJSONError(w, http.StatusBadRequest, "invalid JSON")
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON")
+		return
+	}
+	projectID, ok := h.resolveProject(w, r, req.Project)
+	if !ok {
 		return
 	}
 
-	item, err := models.UpdateDataset(r.Context(), h.db, id, req.Name, req.Description, req.Kind)
+	defer h.datasets.invalidate(id)
+	item, err := models.UpdateDataset(r.Context(), h.db, id, models.UpdateDatasetParams{
+		Name:        req.Name,
+		Description: req.Description,
+		Kind:        req.Kind,
+		Visibility:  req.Visibility,
+		Readme:      req.Readme,
+
+		License:       req.License,
+		ProvenanceURL: req.ProvenanceURL,
+		DefaultSplit:  req.DefaultSplit,
+		DefaultStatus: req.DefaultStatus,
+
+		ProjectID: projectID,
+	})
 	if err != nil {
+		if errors.Is(err, models.ErrInvalidInput) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
 		if errors.Is(err, models.ErrNotFound) {
 			writeJSONError(w, http.StatusNotFound, "not found")
 			return
 		}
+		if errors.Is(err, models.ErrConflict) {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
 		writeJSONError(w, http.StatusInternalServerError, "failed to update dataset")
 		return
 	}
@@ -202,343 +603,2831 @@ func (h *Handler) handleDeleteDataset(w http.ResponseWriter, r *http.Request) {
 
 	id, err := parsePathInt64(r, "id")
 	if err != nil {
-		writeJSONError(w, http.StatusBadRequest, "invalid id")
+		writeFieldError(w, "id", "invalid id")
 		return
 	}
 
-	if err := models.DeleteDataset(r.Context(), h.db, id); err != nil {
+	q := r.URL.Query()
+	hard := parseBoolDefault(q.Get("hard"), false)
+
+	report, err := models.GetDatasetDeletionReport(r.Context(), h.db, id)
+	if err != nil {
 		if errors.Is(err, models.ErrNotFound) {
 			writeJSONError(w, http.StatusNotFound, "not found")
 			return
 		}
-		writeJSONError(w, http.StatusInternalServerError, "failed to delete dataset")
+		writeJSONError(w, http.StatusInternalServerError, "failed to get dataset")
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
-}
-
-func (h *Handler) handleListDatasetConversations(w http.ResponseWriter, r *http.Request) {
-	datasetID, err := parsePathInt64(r, "id")
-	if err != nil {
-		writeJSONError(w, http.StatusBadRequest, "invalid dataset id")
+	action, status, msg := planDatasetDeletion(report, q.Get("confirm"), hard)
+	if action == deletionSoft || action == deletionHard {
+		// Deleting removes the dataset's conversations and items, which a lock freezes.
+		if !h.checkUnlocked(w, r, id) {
+			return
+		}
+		defer h.datasets.invalidate(id)
+	}
+	switch action {
+	case deletionRefused:
+		writeJSONError(w, status, msg)
 		return
+	case deletionReportOnly:
+		writeJSON(w, http.StatusOK, map[string]any{"deleted": false, "report": report, "message": msg})
+		return
+	case deletionSoft:
+		archived, err := models.SoftDeleteDataset(r.Context(), h.db, id)
+		if err != nil {
+			if errors.Is(err, models.ErrNotFound) {
+				writeJSONError(w, http.StatusNotFound, "not found")
+				return
+			}
+			writeStoreError(w, err, "failed to delete dataset")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"deleted": true, "hard": false, "removed": report, "archived_conversations": archived})
+	case deletionHard:
+		if err := models.DeleteDataset(r.Context(), h.db, id); err != nil {
+			if errors.Is(err, models.ErrNotFound) {
+				writeJSONError(w, http.StatusNotFound, "not found")
+				return
+			}
+			writeStoreError(w, err, "failed to delete dataset")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"deleted": true, "hard": true, "removed": report})
 	}
+}
 
-	q := strings.TrimSpace(r.URL.Query().Get("q"))
-	splitText := strings.TrimSpace(r.URL.Query().Get("split"))
-	statusText := strings.TrimSpace(r.URL.Query().Get("status"))
-	limit := parseIntDefault(r.URL.Query().Get("limit"), 50)
-	offset := parseIntDefault(r.URL.Query().Get("offset"), 0)
+type deletionAction int
 
-	if splitText == "" {
-		splitText = string(models.SplitTrain)
+const (
+	deletionReportOnly deletionAction = iota
+	deletionRefused
+	deletionSoft
+	deletionHard
+)
+
+// planDatasetDeletion decides what DELETE /datasets/{id} does: without confirm it only
+// reports, confirm must equal the dataset name exactly, and a soft-deleted dataset can only
+// be hard-deleted. For deletionRefused, status and msg describe the error.
+func planDatasetDeletion(report models.DatasetDeletionReport, confirm string, hard bool) (deletionAction, int, string) {
+	if confirm == "" {
+		return deletionReportOnly, 0, "pass confirm=<dataset name> to delete (hard=true to remove rows instead of archiving)"
 	}
-	if statusText == "" {
-		statusText = string(models.ConversationStatusApproved)
+	if confirm != report.Name {
+		return deletionRefused, http.StatusBadRequest, "confirm does not match the dataset name"
 	}
-	split, ok := models.NormalizeSplit(splitText)
-	if !ok {
-		writeJSONError(w, http.StatusBadRequest, "invalid split")
-		return
+	if hard {
+		return deletionHard, 0, ""
 	}
-	status, ok := models.NormalizeConversationStatus(statusText)
-	if !ok {
-		writeJSONError(w, http.StatusBadRequest, "invalid status")
-		return
+	if report.DeletedAt != nil {
+		return deletionRefused, http.StatusConflict, "dataset is already deleted; pass hard=true to remove it"
 	}
+	return deletionSoft, 0, ""
+}
 
-	if limit < 1 {
-		limit = 1
+func (h *Handler) handleRecountDataset(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
 	}
-	if limit > 200 {
-		limit = 200
+
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
 	}
-	if offset < 0 {
-		offset = 0
+
+	drift, err := models.RecountDataset(r.Context(), h.db, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to recount dataset")
+		return
 	}
+	writeJSON(w, http.StatusOK, drift)
+}
 
-	items, err := models.ListConversations(r.Context(), h.db, models.ListConversationsParams{
-		DatasetID: datasetID,
-		Split:     split,
-		Status:    status,
-		Query:     q,
-		Limit:     limit,
-		Offset:    offset,
+// handleInstanceStats returns instance-wide totals for ops dashboards, cached for
+// instanceStatsTTL. They span private datasets, so it is admin only.
+func (h *Handler) handleInstanceStats(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+	st, err := h.stats.get(r.Context(), func(ctx context.Context) (models.InstanceStats, error) {
+		return models.GetInstanceStats(ctx, h.db)
 	})
 	if err != nil {
-		writeJSONError(w, http.StatusInternalServerError, "failed to list conversations")
+		writeJSONError(w, http.StatusInternalServerError, "failed to get stats")
 		return
 	}
-
-	writeJSON(w, http.StatusOK, map[string]any{"items": items, "limit": limit, "offset": offset})
+	writeJSON(w, http.StatusOK, st)
 }
 
-	// ----------------------------
-	// Conversations
-	// ----------------------------
+// handleSnapshotDatasetStats records the dataset's current stats in its history now, besides
+// the daily background snapshot.
+func (h *Handler) handleSnapshotDatasetStats(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
 
-	// ----------------------------
-	// Dataset Items (generic JSONB)
-	// ----------------------------
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+	ds, err := h.datasetHead(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to get dataset")
+		return
+	}
+	if ds.Kind != models.DatasetKindConversations {
+		writeErrorCode(w, http.StatusConflict, codeWrongDatasetKind, fmt.Sprintf("dataset %q is a %s dataset; only conversation datasets have stats snapshots", ds.Name, ds.Kind))
+		return
+	}
 
-	type createDatasetItemRequest struct {
-		Data      json.RawMessage `json:"data"`
-		SourceRef string          `json:"source_ref"`
+	snap, err := models.SnapshotDatasetStats(r.Context(), h.db, id)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to snapshot stats")
+		return
 	}
+	w.Header().Set("Location", fmt.Sprintf("%s/stats/history/%d", resourcePath("datasets", id), snap.ID))
+	writeJSON(w, http.StatusCreated, snap)
+}
 
-	type updateDatasetItemRequest struct {
-		Data      *json.RawMessage `json:"data"`
-		SourceRef *string          `json:"source_ref"`
+// handleGetDatasetStatsSnapshot returns one stats snapshot of the dataset.
+func (h *Handler) handleGetDatasetStatsSnapshot(w http.ResponseWriter, r *http.Request) {
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+	snapshotID, err := parsePathInt64(r, "snapshot_id")
+	if err != nil {
+		writeFieldError(w, "snapshot_id", "invalid snapshot id")
+		return
+	}
+	if !h.checkDatasetReadable(w, r, id) {
+		return
 	}
 
-	func (h *Handler) handleListDatasetItems(w http.ResponseWriter, r *http.Request) {
-		datasetID, err := parsePathInt64(r, "id")
-		if err != nil {
-			writeJSONError(w, http.StatusBadRequest, "invalid dataset id")
+	snap, err := models.GetDatasetStatsSnapshot(r.Context(), h.db, id, snapshotID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "snapshot not found")
 			return
 		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to get stats snapshot")
+		return
+	}
+	writeJSON(w, http.StatusOK, snap)
+}
 
-		// Ensure dataset exists (so we can return 404 instead of empty list).
-		if _, err := models.GetDataset(r.Context(), h.db, datasetID); err != nil {
-			if errors.Is(err, models.ErrNotFound) {
-				writeJSONError(w, http.StatusNotFound, "not found")
-				return
+// handleDatasetStatsHistory returns the dataset's stats snapshots between from and to (RFC
+// 3339 times or YYYY-MM-DD dates, a to date counting through its end), oldest first.
+func (h *Handler) handleDatasetStatsHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+	q := r.URL.Query()
+	from, ok := parseTimeBound(q.Get("from"), false)
+	if !ok {
+		writeFieldError(w, "from", "invalid from (expected an RFC 3339 time or YYYY-MM-DD)")
+		return
+	}
+	to, ok := parseTimeBound(q.Get("to"), true)
+	if !ok {
+		writeFieldError(w, "to", "invalid to (expected an RFC 3339 time or YYYY-MM-DD)")
+		return
+	}
+	if !from.IsZero() && !to.IsZero() && from.After(to) {
+		writeFieldError(w, "from", "from must not be after to")
+		return
+	}
+	if !h.checkDatasetReadable(w, r, id) {
+		return
+	}
+
+	snaps, err := models.ListDatasetStatsHistory(r.Context(), h.db, id, from, to)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to list stats history")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"dataset_id": id, "snapshots": snaps})
+}
+
+type lockDatasetRequest struct {
+	LockedBy string `json:"locked_by"`
+	// TTL is a Go duration ("6h"); empty uses the server default, "0" never expires.
+	TTL string `json:"ttl"`
+}
+
+func (h *Handler) handleLockDataset(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+
+	var req lockDatasetRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON")
+		return
+	}
+	if strings.TrimSpace(req.LockedBy) == "" {
+		writeFieldError(w, "locked_by", "locked_by required")
+		return
+	}
+	ttl := h.lockTTL
+	if s := strings.TrimSpace(req.TTL); s != "" {
+		ttl, err = time.ParseDuration(s)
+		if err != nil || ttl < 0 {
+			writeFieldError(w, "ttl", "invalid ttl (expected a duration like 6h, or 0)")
+			return
+		}
+	}
+
+	defer h.datasets.invalidate(id)
+	ds, err := models.LockDataset(r.Context(), h.db, id, req.LockedBy, ttl)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			writeJSONError(w, http.StatusNotFound, "not found")
+		case errors.Is(err, models.ErrLocked):
+			writeLockedError(w, err)
+		case errors.Is(err, models.ErrInvalidInput):
+			writeError(w, http.StatusBadRequest, err)
+		default:
+			writeJSONError(w, http.StatusInternalServerError, "failed to lock dataset")
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, ds)
+}
+
+func (h *Handler) handleUnlockDataset(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+
+	defer h.datasets.invalidate(id)
+	ds, err := models.UnlockDataset(r.Context(), h.db, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to unlock dataset")
+		return
+	}
+	writeJSON(w, http.StatusOK, ds)
+}
+
+// checkUnlocked writes 423 and returns false when any of datasetIDs is locked. Missing
+// datasets pass so the caller reports its own 404. It reads the cached dataset, so it is
+// only a fast path: the lock triggers refuse writes that race a fresh lock, and callers
+// report those through writeStoreError.
+func (h *Handler) checkUnlocked(w http.ResponseWriter, r *http.Request, datasetIDs ...int64) bool {
+	now := time.Now()
+	for _, id := range datasetIDs {
+		if id <= 0 {
+			continue
+		}
+		ds, err := h.datasetHead(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, models.ErrNotFound) {
+				continue
 			}
 			writeJSONError(w, http.StatusInternalServerError, "failed to get dataset")
+			return false
+		}
+		if ds.Lock.Active(now) {
+			writeLockedError(w, &models.DatasetLockedError{DatasetID: id, Lock: *ds.Lock})
+			return false
+		}
+	}
+	return true
+}
+
+// checkConversationUnlocked is checkUnlocked for the dataset holding conversation id, plus
+// any extra target datasets.
+func (h *Handler) checkConversationUnlocked(w http.ResponseWriter, r *http.Request, id int64, targets ...int64) bool {
+	return h.checkOwnerUnlocked(w, r, models.GetConversationDatasetID, id, targets)
+}
+
+// checkItemUnlocked is checkUnlocked for the dataset holding item id, plus any extra target
+// datasets.
+func (h *Handler) checkItemUnlocked(w http.ResponseWriter, r *http.Request, id int64, targets ...int64) bool {
+	return h.checkOwnerUnlocked(w, r, models.GetDatasetItemDatasetID, id, targets)
+}
+
+func (h *Handler) checkOwnerUnlocked(w http.ResponseWriter, r *http.Request, owner func(context.Context, *sql.DB, int64) (int64, error), id int64, targets []int64) bool {
+	datasetID, err := owner(r.Context(), h.db, id)
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		writeJSONError(w, http.StatusInternalServerError, "failed to get dataset")
+		return false
+	}
+	return h.checkUnlocked(w, r, append(targets, datasetID)...)
+}
+
+// writeLockedError reports a models.DatasetLockedError as 423 with the lock attached.
+func writeLockedError(w http.ResponseWriter, err error) {
+	var le *models.DatasetLockedError
+	if !errors.As(err, &le) {
+		writeErrorCode(w, http.StatusLocked, codeDatasetLocked, err.Error())
+		return
+	}
+	body := errorBody(w, apiError{Code: codeDatasetLocked, Message: le.Error()})
+	body["lock"] = le.Lock
+	writeJSON(w, http.StatusLocked, body)
+}
+
+// writeStoreError reports a failed write: 423 when the dataset lock triggers refused it,
+// 500 with msg otherwise.
+func writeStoreError(w http.ResponseWriter, err error, msg string) {
+	if le := models.AsLockedError(err); le != nil {
+		writeLockedError(w, le)
+		return
+	}
+	writeJSONError(w, http.StatusInternalServerError, msg)
+}
+
+func (h *Handler) handleSuggestTags(w http.ResponseWriter, r *http.Request) {
+	datasetID, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid dataset id")
+		return
+	}
+	if !h.checkDatasetReadable(w, r, datasetID) {
+		return
+	}
+
+	limit := parseIntDefault(r.URL.Query().Get("limit"), 10)
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	tags, err := models.SuggestTags(r.Context(), h.db, datasetID, r.URL.Query().Get("prefix"), limit)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to suggest tags")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"tags": tags})
+}
+
+func (h *Handler) handleListSources(w http.ResponseWriter, r *http.Request) {
+	datasetID, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid dataset id")
+		return
+	}
+	if !h.checkDatasetReadable(w, r, datasetID) {
+		return
+	}
+
+	sources, err := models.ListSources(r.Context(), h.db, datasetID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to list sources")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"sources": sources})
+}
+
+func (h *Handler) handleListImportRuns(w http.ResponseWriter, r *http.Request) {
+	datasetID, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid dataset id")
+		return
+	}
+	h.listImportRuns(w, r, datasetID)
+}
+
+// handleListImportRunsByDataset is GET /api/v1/import-runs?dataset_id=N.
+func (h *Handler) handleListImportRunsByDataset(w http.ResponseWriter, r *http.Request) {
+	datasetID := int64(parseIntDefault(r.URL.Query().Get("dataset_id"), 0))
+	if datasetID <= 0 {
+		writeFieldError(w, "dataset_id", "dataset_id is required")
+		return
+	}
+	h.listImportRuns(w, r, datasetID)
+}
+
+func (h *Handler) listImportRuns(w http.ResponseWriter, r *http.Request, datasetID int64) {
+	if !h.checkDatasetReadable(w, r, datasetID) {
+		return
+	}
+
+	limit := parseIntDefault(r.URL.Query().Get("limit"), 50)
+	offset := parseIntDefault(r.URL.Query().Get("offset"), 0)
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > 200 {
+		limit = 200
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	runs, err := models.ListImportRuns(r.Context(), h.db, datasetID, limit, offset)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to list imports")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"imports": runs})
+}
+
+// handleRollbackImportRun deletes (action=archive: archives) the rows an import run created.
+// Rows edited since the import make it 409 unless force=true.
+func (h *Handler) handleRollbackImportRun(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+	action := strings.TrimSpace(r.URL.Query().Get("action"))
+	switch action {
+	case "", models.RollbackDelete, models.RollbackArchive:
+	default:
+		writeFieldError(w, "action", "invalid action (expected delete|archive)")
+		return
+	}
+	force := parseBoolDefault(r.URL.Query().Get("force"), false)
+
+	run, err := models.GetImportRun(r.Context(), h.db, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not found")
 			return
 		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to get import run")
+		return
+	}
+	if !h.checkUnlocked(w, r, run.DatasetID) {
+		return
+	}
 
-		q := strings.TrimSpace(r.URL.Query().Get("q"))
-		limit := parseIntDefault(r.URL.Query().Get("limit"), 50)
-		offset := parseIntDefault(r.URL.Query().Get("offset"), 0)
-		if limit < 1 {
-			limit = 1
+	defer h.datasets.invalidate(run.DatasetID)
+	res, err := models.RollbackImportRun(r.Context(), h.db, id, action, force)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			writeJSONError(w, http.StatusNotFound, "not found")
+		case errors.Is(err, models.ErrConflict):
+			body := errorBody(w, apiError{Code: codeConflict, Message: err.Error()})
+			body["modified"] = res.Modified
+			writeJSON(w, http.StatusConflict, body)
+		case errors.Is(err, models.ErrInvalidInput):
+			writeError(w, http.StatusBadRequest, err)
+		default:
+			writeStoreError(w, err, "failed to roll back import run")
 		}
-		if limit > 200 {
-			limit = 200
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// sampleParams reads n (default 20, capped at models.MaxSampleSize) and seed (random when
+// omitted; echoed back so the sample can be reproduced).
+func sampleParams(r *http.Request) (n int, seed int64, err error) {
+	q := r.URL.Query()
+	n = parseIntDefault(q.Get("n"), 20)
+	if n < 1 {
+		n = 1
+	}
+	if n > models.MaxSampleSize {
+		n = models.MaxSampleSize
+	}
+	if s := strings.TrimSpace(q.Get("seed")); s != "" {
+		seed, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, 0, invalidField("seed", "invalid seed")
 		}
-		if offset < 0 {
-			offset = 0
+		return n, seed, nil
+	}
+	return n, time.Now().UnixNano() % 1_000_000, nil
+}
+
+// loadDatasetOfKind checks the dataset is readable and of the given kind; endpoint names
+// the route in the error message.
+func (h *Handler) loadDatasetOfKind(w http.ResponseWriter, r *http.Request, wantItems bool, endpoint string) (int64, bool) {
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid dataset id")
+		return 0, false
+	}
+	ds, err := h.datasetHead(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return 0, false
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to get dataset")
+		return 0, false
+	}
+	if !h.canRead(r, ds.Visibility) {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return 0, false
+	}
+	if isItems := strings.EqualFold(ds.Kind, "items"); isItems != wantItems {
+		if wantItems {
+			writeErrorCode(w, http.StatusBadRequest, codeWrongDatasetKind, endpoint+" applies to items datasets")
+		} else {
+			writeErrorCode(w, http.StatusBadRequest, codeWrongDatasetKind, endpoint+" applies to conversation datasets")
 		}
+		return 0, false
+	}
+	return id, true
+}
 
-		items, err := models.ListDatasetItems(r.Context(), h.db, models.ListDatasetItemsParams{
-			DatasetID: datasetID,
-			Query:     q,
-			Limit:     limit,
-			Offset:    offset,
-		})
-		if err != nil {
-			writeJSONError(w, http.StatusInternalServerError, "failed to list items")
+func (h *Handler) handleSampleDatasetItems(w http.ResponseWriter, r *http.Request) {
+	n, seed, err := sampleParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	id, ok := h.loadDatasetOfKind(w, r, true, "items/sample")
+	if !ok {
+		return
+	}
+
+	items, err := models.SampleDatasetItems(r.Context(), h.db, id, n, seed)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to sample items")
+		return
+	}
+	if items == nil {
+		items = []models.DatasetItem{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"seed":  seed,
+		"items": items,
+		"stats": models.SummarizeItemSample(items, 20),
+	})
+}
+
+func (h *Handler) handleSampleConversations(w http.ResponseWriter, r *http.Request) {
+	n, seed, err := sampleParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	id, ok := h.loadDatasetOfKind(w, r, false, "conversations/sample")
+	if !ok {
+		return
+	}
+
+	convs, err := models.SampleConversations(r.Context(), h.db, id, n, seed)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to sample conversations")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"seed":          seed,
+		"conversations": convs,
+		"stats":         models.SummarizeConversationSample(convs),
+	})
+}
+
+// handleItemSchema reports the keys found in an items dataset's data, with their JSON
+// types, presence and example values; sample=N inspects N random items instead of all.
+func (h *Handler) handleItemSchema(w http.ResponseWriter, r *http.Request) {
+	sample := parseIntDefault(r.URL.Query().Get("sample"), 0)
+	if sample < 0 || sample > models.MaxSchemaSample {
+		writeFieldError(w, "sample", fmt.Sprintf("invalid sample (expected 0-%d)", models.MaxSchemaSample))
+		return
+	}
+	id, ok := h.loadDatasetOfKind(w, r, true, "items/schema")
+	if !ok {
+		return
+	}
+
+	schema, err := models.InferItemSchema(r.Context(), h.db, id, sample)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to infer schema")
+		return
+	}
+	writeJSON(w, http.StatusOK, schema)
+}
+
+// handleSplitCheck reports content shared between train and valid/test in a conversation dataset.
+func (h *Handler) handleSplitCheck(w http.ResponseWriter, r *http.Request) {
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid dataset id")
+		return
+	}
+
+	ds, err := h.datasetHead(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to get dataset")
+		return
+	}
+	if !h.canRead(r, ds.Visibility) {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if strings.EqualFold(ds.Kind, "items") {
+		writeErrorCode(w, http.StatusBadRequest, codeWrongDatasetKind, "split-check applies to conversation datasets")
+		return
+	}
+
+	status := ""
+	if s := strings.TrimSpace(r.URL.Query().Get("status")); s != "" {
+		st, ok := models.NormalizeConversationStatus(s)
+		if !ok {
+			writeFieldError(w, "status", "invalid status")
+			return
+		}
+		status = string(st)
+	}
+
+	collisions, err := models.CheckSplitPurity(r.Context(), h.db, id, status)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to check splits")
+		return
+	}
+	if collisions == nil {
+		collisions = []models.SplitCollision{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"dataset_id": id, "clean": len(collisions) == 0, "collisions": collisions})
+}
+
+// handleMetaCheck lists messages whose meta breaks the current size limit or is not an object,
+// e.g. rows stored before the limit existed.
+func (h *Handler) handleMetaCheck(w http.ResponseWriter, r *http.Request) {
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid dataset id")
+		return
+	}
+	if !h.checkDatasetReadable(w, r, id) {
+		return
+	}
+
+	limit := parseIntDefault(r.URL.Query().Get("limit"), 100)
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+
+	violations, err := models.FindMetaViolations(r.Context(), h.db, id, h.limits.MaxMetaBytes, limit)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to check message meta")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"dataset_id": id,
+		"max_bytes":  h.limits.MaxMetaBytes,
+		"clean":      len(violations) == 0,
+		"violations": violations,
+	})
+}
+
+type stripMetaRequest struct {
+	Pattern string `json:"pattern"`
+}
+
+func (h *Handler) handleStripMeta(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid dataset id")
+		return
+	}
+
+	if !h.checkUnlocked(w, r, id) {
+		return
+	}
+
+	var req stripMetaRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON")
+		return
+	}
+
+	n, err := models.StripMetaKeys(r.Context(), h.db, id, req.Pattern)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidInput) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeStoreError(w, err, "failed to strip meta")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"dataset_id": id, "messages_updated": n})
+}
+
+type splitByTagRequest struct {
+	Test  []string `json:"test"`
+	Valid []string `json:"valid"`
+}
+
+// handleSplitByTag assigns every conversation of the dataset a split from its tags; untagged
+// conversations go to train.
+func (h *Handler) handleSplitByTag(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+
+	var req splitByTagRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON (expected {\"test\":[tags],\"valid\":[tags]})")
+		return
+	}
+
+	tags, err := models.SplitTags{Test: req.Test, Valid: req.Valid}.Normalize()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	id, ok := h.loadDatasetOfKind(w, r, false, "split-by-tag")
+	if !ok {
+		return
+	}
+	if !h.checkUnlocked(w, r, id) {
+		return
+	}
+
+	moved, err := models.SplitByTag(r.Context(), h.db, id, tags)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidInput) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeStoreError(w, err, "failed to assign splits")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"dataset_id": id, "moved": moved})
+}
+
+// handleReindexDataset renumbers message idx values to 0..n-1 in every conversation of the
+// dataset that has gaps or duplicates.
+func (h *Handler) handleReindexDataset(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+
+	id, ok := h.loadDatasetOfKind(w, r, false, "reindex")
+	if !ok {
+		return
+	}
+	if !h.checkUnlocked(w, r, id) {
+		return
+	}
+
+	res, err := models.ReindexDatasetMessages(r.Context(), h.db, id)
+	if err != nil {
+		writeStoreError(w, err, "failed to reindex messages")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"dataset_id":              id,
+		"conversations_reindexed": res.Conversations,
+		"messages_reindexed":      res.Messages,
+	})
+}
+
+func (h *Handler) handleListDatasetConversations(w http.ResponseWriter, r *http.Request) {
+	datasetID, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid dataset id")
+		return
+	}
+
+	ds, ok := h.readableDataset(w, r, datasetID)
+	if !ok {
+		return
+	}
+
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	splitText := strings.TrimSpace(r.URL.Query().Get("split"))
+	statusText := strings.TrimSpace(r.URL.Query().Get("status"))
+	limit := parseIntDefault(r.URL.Query().Get("limit"), 50)
+	offset := parseIntDefault(r.URL.Query().Get("offset"), 0)
+
+	if splitText == "" || statusText == "" {
+		defSplit, defStatus := ds.Defaults()
+		if splitText == "" {
+			splitText = string(defSplit)
+		}
+		if statusText == "" {
+			statusText = string(defStatus)
+		}
+	}
+	splits, ok := models.ParseSplitList(splitText)
+	if !ok {
+		writeFieldError(w, "split", "invalid split (expected all or a comma-separated list of train|valid|test)")
+		return
+	}
+	statuses, ok := models.ParseStatusList(statusText)
+	if !ok {
+		writeFieldError(w, "status", "invalid status (expected any or a comma-separated list of draft|pending|approved|rejected|archived)")
+		return
+	}
+
+	minAvgRating, ok := parseMinAvgRating(r.URL.Query().Get("min_avg_rating"))
+	if !ok {
+		writeFieldError(w, "min_avg_rating", "invalid min_avg_rating (expected 1-5)")
+		return
+	}
+	if !checkAttributionFilters(w, r.URL.Query()) {
+		return
+	}
+	hasOpenFlags, ok := parseOptionalBool(r.URL.Query().Get("has_open_flags"))
+	if !ok {
+		writeFieldError(w, "has_open_flags", "invalid has_open_flags (expected true or false)")
+		return
+	}
+
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > 200 {
+		limit = 200
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	items, err := models.ListConversations(r.Context(), h.db, models.ListConversationsParams{
+		DatasetID:    datasetID,
+		Splits:       splits,
+		Statuses:     statuses,
+		Query:        q,
+		Limit:        limit,
+		Offset:       offset,
+		MinAvgRating: minAvgRating,
+		Source:       r.URL.Query().Get("source"),
+		SourcePrefix: r.URL.Query().Get("source_prefix"),
+		HasOpenFlags: hasOpenFlags,
+	})
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to list conversations")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"items": items, "limit": limit, "offset": offset})
+}
+
+	// ----------------------------
+	// Conversations
+	// ----------------------------
+
+	// ----------------------------
+	// Dataset Items (generic JSONB)
+	// ----------------------------
+
+	type createDatasetItemRequest struct {
+		Data      json.RawMessage `json:"data"`
+		SourceRef string          `json:"source_ref"`
+	}
+
+	type updateDatasetItemRequest struct {
+		Data      *json.RawMessage `json:"data"`
+		SourceRef *string          `json:"source_ref"`
+	}
+
+	func (h *Handler) handleListDatasetItems(w http.ResponseWriter, r *http.Request) {
+		datasetID, err := parsePathInt64(r, "id")
+		if err != nil {
+			writeFieldError(w, "id", "invalid dataset id")
+			return
+		}
+
+		key, value := r.URL.Query().Get("key"), r.URL.Query().Get("value")
+		keyExists := r.URL.Query().Get("key_exists")
+		if key != "" && !models.ValidDataKey(key) {
+			writeFieldError(w, "key", "invalid key (expected a simple identifier: letters, digits, _)")
+			return
+		}
+		if key == "" && r.URL.Query().Has("value") {
+			writeFieldError(w, "value", "value requires key")
+			return
+		}
+		if keyExists != "" && !models.ValidDataKey(keyExists) {
+			writeFieldError(w, "key_exists", "invalid key_exists (expected a simple identifier: letters, digits, _)")
+			return
+		}
+
+		// Ensure dataset exists (so we can return 404 instead of empty list).
+		if !h.checkDatasetReadable(w, r, datasetID) {
+			return
+		}
+
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
+		limit := parseIntDefault(r.URL.Query().Get("limit"), 50)
+		offset := parseIntDefault(r.URL.Query().Get("offset"), 0)
+		if limit < 1 {
+			limit = 1
+		}
+		if limit > 200 {
+			limit = 200
+		}
+		if offset < 0 {
+			offset = 0
+		}
+
+		var annotation *models.AnnotationFilter
+		if s := strings.TrimSpace(r.URL.Query().Get("annotation")); s != "" {
+			f, err := models.ParseAnnotationFilter(s)
+			if err != nil {
+				writeFieldError(w, "annotation", err.Error())
+				return
+			}
+			annotation = &f
+		}
+
+		items, err := models.ListDatasetItems(r.Context(), h.db, models.ListDatasetItemsParams{
+			DatasetID:  datasetID,
+			Query:      q,
+			Limit:      limit,
+			Offset:     offset,
+			Annotation: annotation,
+			Key:        key,
+			Value:      value,
+			KeyExists:  keyExists,
+		})
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to list items")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": items, "limit": limit, "offset": offset})
+	}
+
+	func (h *Handler) handleCreateDatasetItem(w http.ResponseWriter, r *http.Request) {
+		if !h.isAdmin(r) {
+			writeJSONError(w, http.StatusUnauthorized, "admin token required")
+			return
+		}
+
+		datasetID, err := parsePathInt64(r, "id")
+		if err != nil {
+			writeFieldError(w, "id", "invalid dataset id")
+			return
+		}
+
+		// Ensure dataset exists and holds items.
+		ds, err := h.datasetHead(r.Context(), datasetID)
+		if err != nil {
+			if errors.Is(err, models.ErrNotFound) {
+				writeJSONError(w, http.StatusNotFound, "not found")
+				return
+			}
+			writeJSONError(w, http.StatusInternalServerError, "failed to get dataset")
+			return
+		}
+		if ds.Kind != models.DatasetKindItems {
+			writeErrorCode(w, http.StatusConflict, codeWrongDatasetKind, fmt.Sprintf("dataset %q is a %s dataset; items can only be added to items datasets", ds.Name, ds.Kind))
+			return
+		}
+		if !h.checkUnlocked(w, r, datasetID) {
+			return
+		}
+
+		var req createDatasetItemRequest
+		if err := decodeJSON(r.Body, &req); err != nil {
+			writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON")
+			return
+		}
+
+		it, err := models.CreateDatasetItem(r.Context(), h.db, datasetID, req.Data, req.SourceRef)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidInput) {
+				writeFieldError(w, "data", "invalid item")
+				return
+			}
+			writeInsertError(w, err, "failed to create item")
+			return
+		}
+		w.Header().Set("Location", resourcePath("items", it.ID))
+		writeJSON(w, http.StatusCreated, it)
+	}
+
+	func (h *Handler) handleGetDatasetItem(w http.ResponseWriter, r *http.Request) {
+		id, err := parsePathInt64(r, "id")
+		if err != nil {
+			writeFieldError(w, "id", "invalid id")
+			return
+		}
+
+		it, err := models.GetDatasetItem(r.Context(), h.db, id)
+		if err != nil {
+			if errors.Is(err, models.ErrNotFound) {
+				writeJSONError(w, http.StatusNotFound, "not found")
+				return
+			}
+			writeJSONError(w, http.StatusInternalServerError, "failed to get item")
+			return
+		}
+		if !h.checkDatasetReadable(w, r, it.DatasetID) {
+			return
+		}
+		writeJSON(w, http.StatusOK, it)
+	}
+
+	func (h *Handler) handleUpdateDatasetItem(w http.ResponseWriter, r *http.Request) {
+		if !h.isAdmin(r) {
+			writeJSONError(w, http.StatusUnauthorized, "admin token required")
+			return
+		}
+
+		id, err := parsePathInt64(r, "id")
+		if err != nil {
+			writeFieldError(w, "id", "invalid id")
+			return
+		}
+
+		if !h.checkItemUnlocked(w, r, id) {
+			return
+		}
+
+		var req updateDatasetItemRequest
+		if err := decodeJSON(r.Body, &req); err != nil {
+			writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON")
+			return
+		}
+
+		existing, err := models.GetDatasetItem(r.Context(), h.db, id)
+		if err != nil {
+			if errors.Is(err, models.ErrNotFound) {
+				writeJSONError(w, http.StatusNotFound, "not found")
+				return
+			}
+			writeJSONError(w, http.StatusInternalServerError, "failed to get item")
+			return
+		}
+
+		newData := existing.Data
+		if req.Data != nil {
+			newData = *req.Data
+		}
+		newSourceRef := existing.SourceRef
+		if req.SourceRef != nil {
+			newSourceRef = *req.SourceRef
+		}
+
+		updated, err := models.UpdateDatasetItem(r.Context(), h.db, id, newData, newSourceRef)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidInput) {
+				writeFieldError(w, "data", "invalid item")
+				return
+			}
+			if errors.Is(err, models.ErrNotFound) {
+				writeJSONError(w, http.StatusNotFound, "not found")
+				return
+			}
+			writeStoreError(w, err, "failed to update item")
+			return
+		}
+		writeJSON(w, http.StatusOK, updated)
+	}
+
+	func (h *Handler) handleDeleteDatasetItem(w http.ResponseWriter, r *http.Request) {
+		if !h.isAdmin(r) {
+			writeJSONError(w, http.StatusUnauthorized, "admin token required")
+			return
+		}
+
+		id, err := parsePathInt64(r, "id")
+		if err != nil {
+			writeFieldError(w, "id", "invalid id")
+			return
+		}
+
+		if !h.checkItemUnlocked(w, r, id) {
+			return
+		}
+
+		if err := models.DeleteDatasetItem(r.Context(), h.db, id); err != nil {
+			if errors.Is(err, models.ErrNotFound) {
+				writeJSONError(w, http.StatusNotFound, "not found")
+				return
+			}
+			writeStoreError(w, err, "failed to delete item")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+	}
+
+// handleMergeDatasetItem deep-merges the request body (a JSON object) into the item's data.
+func (h *Handler) handleMergeDatasetItem(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+
+	if !h.checkItemUnlocked(w, r, id) {
+		return
+	}
+
+	var patch json.RawMessage
+	if err := decodeJSON(r.Body, &patch); err != nil {
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON")
+		return
+	}
+
+	updated, err := models.MergeDatasetItem(r.Context(), h.db, id, patch)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidInput) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeStoreError(w, err, "failed to merge item")
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+type moveRequest struct {
+	DatasetID int64 `json:"dataset_id"`
+}
+
+// decodeMove reads the entity id and target dataset shared by the move endpoints.
+func decodeMove(w http.ResponseWriter, r *http.Request) (id, target int64, ok bool) {
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return 0, 0, false
+	}
+	var req moveRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON")
+		return 0, 0, false
+	}
+	if req.DatasetID <= 0 {
+		writeFieldError(w, "dataset_id", "dataset_id required")
+		return 0, 0, false
+	}
+	return id, req.DatasetID, true
+}
+
+// writeMoveError maps MoveConversation / MoveDatasetItem errors to responses.
+func writeMoveError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrInvalidInput):
+		writeError(w, http.StatusBadRequest, err)
+	case errors.Is(err, models.ErrNotFound):
+		writeJSONError(w, http.StatusNotFound, "not found")
+	default:
+		writeStoreError(w, err, "failed to move")
+	}
+}
+
+func (h *Handler) handleMoveDatasetItem(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+	id, target, ok := decodeMove(w, r)
+	if !ok {
+		return
+	}
+
+	if !h.checkItemUnlocked(w, r, id, target) {
+		return
+	}
+
+	moved, err := models.MoveDatasetItem(r.Context(), h.db, id, target)
+	if err != nil {
+		writeMoveError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, moved)
+}
+
+type setItemAnnotationRequest struct {
+	Value  json.RawMessage `json:"value"`
+	Author string          `json:"author"`
+}
+
+func (h *Handler) handleListItemAnnotations(w http.ResponseWriter, r *http.Request) {
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+
+	it, err := models.GetDatasetItem(r.Context(), h.db, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to get item")
+		return
+	}
+	if !h.checkDatasetReadable(w, r, it.DatasetID) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"annotations": it.Annotations})
+}
+
+func (h *Handler) handleSetItemAnnotation(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+
+	if !h.checkItemUnlocked(w, r, id) {
+		return
+	}
+
+	var req setItemAnnotationRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON")
+		return
+	}
+
+	a, err := models.SetItemAnnotation(r.Context(), h.db, id, r.PathValue("key"), req.Author, req.Value)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidInput) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeStoreError(w, err, "failed to set annotation")
+		return
+	}
+	writeJSON(w, http.StatusOK, a)
+}
+
+func (h *Handler) handleDeleteItemAnnotation(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+
+	if !h.checkItemUnlocked(w, r, id) {
+		return
+	}
+
+	if err := models.DeleteItemAnnotation(r.Context(), h.db, id, r.PathValue("key"), r.URL.Query().Get("author")); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeStoreError(w, err, "failed to delete annotation")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+// upsertConversationRequest is the create and PATCH body. Pointer fields (and nil slices)
+// are absent from the JSON: create applies defaults, PATCH leaves the stored value alone.
+type upsertConversationRequest struct {
+	DatasetID int64            `json:"dataset_id"`
+	Split     *string          `json:"split"`
+	Status    *string          `json:"status"`
+	Tags      []string         `json:"tags"`
+	Source    *string          `json:"source"`
+	Notes     *string          `json:"notes"`
+	Lang      *string          `json:"lang"`
+	Meta      json.RawMessage  `json:"meta"`
+	Messages  []models.Message `json:"messages"`
+}
+
+// handleGetConversation returns a conversation with each message's alternative_count;
+// ?expand=alternatives (admin, like the alternatives list) inlines the alternatives.
+func (h *Handler) handleGetConversation(w http.ResponseWriter, r *http.Request) {
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+	expand := false
+	switch strings.TrimSpace(r.URL.Query().Get("expand")) {
+	case "":
+	case "alternatives":
+		if !h.isAdmin(r) {
+			writeJSONError(w, http.StatusUnauthorized, "admin token required for expand=alternatives")
+			return
+		}
+		expand = true
+	default:
+		writeFieldError(w, "expand", "invalid expand (expected alternatives)")
+		return
+	}
+
+	c, err := models.GetConversation(r.Context(), h.db, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to get conversation")
+		return
+	}
+	if !h.checkDatasetReadable(w, r, c.DatasetID) {
+		return
+	}
+	if err := models.AttachAlternatives(r.Context(), h.db, &c, expand); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to load alternatives")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, c)
+}
+
+// maxBatchGetIDs caps ?ids= on the batch conversation read.
+const maxBatchGetIDs = 200
+
+// handleGetConversations returns full conversations for ?ids=1,2,3 in the order asked.
+// Ids that do not exist or are not readable by the caller are listed in "missing".
+func (h *Handler) handleGetConversations(w http.ResponseWriter, r *http.Request) {
+	ids, err := parseIDList(r.URL.Query().Get("ids"), maxBatchGetIDs)
+	if err != nil {
+		writeFieldError(w, "ids", err.Error())
+		return
+	}
+
+	convs, err := models.GetConversationsByIDs(r.Context(), h.db, ids, h.isAdmin(r))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to get conversations")
+		return
+	}
+	found := make(map[int64]bool, len(convs))
+	for _, c := range convs {
+		found[c.ID] = true
+	}
+	missing := []int64{}
+	for _, id := range ids {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": convs, "missing": missing})
+}
+
+func (h *Handler) handleCreateConversation(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+
+	idemKey, ok := idempotencyKey(w, r)
+	if !ok {
+		return
+	}
+	raw, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "failed to read body")
+		return
+	}
+
+	var req upsertConversationRequest
+	if err := decodeJSON(bytes.NewReader(raw), &req); err != nil {
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON")
+		return
+	}
+
+	conv, err := normalizeConversationUpsert(req, h.banned, h.limits)
+	if err != nil {
+		writeNormalizeError(w, err)
+		return
+	}
+
+	tx, err := h.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to start transaction")
+		return
+	}
+	defer tx.Rollback()
+
+	if !h.reserveIdempotent(w, r, tx, "conversations", idemKey, raw) {
+		return
+	}
+	if !h.checkUnlocked(w, r, conv.DatasetID) {
+		return
+	}
+	inserted, err := models.InsertConversationWithMessages(r.Context(), tx, conv)
+	if err != nil {
+		writeInsertError(w, err, "failed to create conversation")
+		return
+	}
+	body, err := completeIdempotent(r.Context(), tx, "conversations", idemKey, inserted.ID, http.StatusCreated, inserted)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to store idempotency key")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to commit")
+		return
+	}
+
+	writeIdempotentJSON(w, "conversations", inserted.ID, http.StatusCreated, body)
+}
+
+func (h *Handler) handleUpdateConversation(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+
+	var req upsertConversationRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON")
+		return
+	}
+
+	// Empty-content checks depend on the status, so replacing messages without a new status
+	// validates against the stored one, and changing the status alone validates the stored
+	// messages.
+	var current models.Conversation
+	if (req.Messages != nil) != (req.Status != nil) {
+		current, err = models.GetConversation(r.Context(), h.db, id)
+		if err != nil {
+			if errors.Is(err, models.ErrNotFound) {
+				writeJSONError(w, http.StatusNotFound, "not found")
+				return
+			}
+			writeJSONError(w, http.StatusInternalServerError, "failed to get conversation")
+			return
+		}
+	}
+
+	patch, err := normalizeConversationPatch(req, current, h.banned, h.limits)
+	if err != nil {
+		writeNormalizeError(w, err)
+		return
+	}
+	if !h.checkConversationUnlocked(w, r, id, patch.DatasetID) {
+		return
+	}
+
+	updated, err := models.UpdateConversation(r.Context(), h.db, id, patch)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidInput) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeStoreError(w, err, "failed to update conversation")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (h *Handler) handleMoveConversation(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+	id, target, ok := decodeMove(w, r)
+	if !ok {
+		return
+	}
+
+	if !h.checkConversationUnlocked(w, r, id, target) {
+		return
+	}
+
+	moved, err := models.MoveConversation(r.Context(), h.db, id, target)
+	if err != nil {
+		writeMoveError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, moved)
+}
+
+type duplicateConversationRequest struct {
+	DatasetID int64    `json:"dataset_id"`
+	Split     *string  `json:"split"`
+	Status    *string  `json:"status"`
+	Tags      []string `json:"tags"`
+	Notes     *string  `json:"notes"`
+}
+
+// handleDuplicateConversation copies a conversation into the same or another dataset. The
+// copy is a draft unless status says otherwise; tags are added to the source's.
+func (h *Handler) handleDuplicateConversation(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+	var req duplicateConversationRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON")
+		return
+	}
+	if req.DatasetID < 0 {
+		writeFieldError(w, "dataset_id", "invalid dataset_id")
+		return
+	}
+	opts := models.DuplicateOptions{
+		DatasetID: req.DatasetID,
+		AddTags:   req.Tags,
+		Notes:     strings.TrimSpace(derefString(req.Notes)),
+	}
+	if req.Split != nil {
+		split, err := normalizeUpsertSplit(*req.Split)
+		if err != nil {
+			writeNormalizeError(w, err)
+			return
+		}
+		opts.Split = split
+	}
+	if req.Status != nil && strings.TrimSpace(*req.Status) != "" {
+		status, err := normalizeUpsertStatus(*req.Status)
+		if err != nil {
+			writeNormalizeError(w, err)
+			return
+		}
+		opts.Status = status
+	}
+	// An approved copy is exported as is, so its messages must pass what a create checks.
+	var checkErr error
+	if opts.Status == models.ConversationStatusApproved {
+		opts.CheckMessages = func(msgs []models.Message) error {
+			_, checkErr = normalizeUpsertMessages(msgs, opts.Status, h.banned, h.limits)
+			return checkErr
+		}
+	}
+
+	target := req.DatasetID
+	if target == 0 {
+		target, err = models.GetConversationDatasetID(r.Context(), h.db, id)
+		if err != nil {
+			if errors.Is(err, models.ErrNotFound) {
+				writeJSONError(w, http.StatusNotFound, "not found")
+				return
+			}
+			writeJSONError(w, http.StatusInternalServerError, "failed to get conversation")
+			return
+		}
+	}
+	if !h.checkUnlocked(w, r, target) {
+		return
+	}
+
+	dup, err := models.DuplicateConversation(r.Context(), h.db, id, opts)
+	if err != nil {
+		switch {
+		case checkErr != nil:
+			writeNormalizeError(w, checkErr)
+		case errors.Is(err, models.ErrInvalidInput):
+			writeError(w, http.StatusBadRequest, err)
+		case errors.Is(err, models.ErrNotFound):
+			writeJSONError(w, http.StatusNotFound, "not found")
+		case errors.Is(err, models.ErrWrongDatasetKind):
+			writeErrorCode(w, http.StatusConflict, codeWrongDatasetKind, err.Error())
+		default:
+			writeStoreError(w, err, "failed to duplicate conversation")
+		}
+		return
+	}
+	w.Header().Set("Location", resourcePath("conversations", dup.ID))
+	writeJSON(w, http.StatusCreated, dup)
+}
+
+func (h *Handler) handleDeleteConversation(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+
+	if !h.checkConversationUnlocked(w, r, id) {
+		return
+	}
+
+	if err := models.DeleteConversation(r.Context(), h.db, id); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeStoreError(w, err, "failed to delete conversation")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+type updateMessageRequest struct {
+	Role    string          `json:"role"`
+	Content *string         `json:"content"`
+	Meta    json.RawMessage `json:"meta"`
+}
+
+// handleGetMessage returns message idx of a conversation, the resource an append's Location
+// names.
+func (h *Handler) handleGetMessage(w http.ResponseWriter, r *http.Request) {
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+	idx, err := strconv.Atoi(r.PathValue("idx"))
+	if err != nil || idx < 0 {
+		writeFieldError(w, "idx", "invalid idx")
+		return
+	}
+
+	c, err := models.GetConversation(r.Context(), h.db, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to get conversation")
+		return
+	}
+	if !h.checkDatasetReadable(w, r, c.DatasetID) {
+		return
+	}
+	if idx >= len(c.Messages) {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, c.Messages[idx])
+}
+
+func (h *Handler) handleUpdateMessage(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+	idx, err := strconv.Atoi(r.PathValue("idx"))
+	if err != nil || idx < 0 {
+		writeFieldError(w, "idx", "invalid idx")
+		return
+	}
+
+	var req updateMessageRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON")
+		return
+	}
+	if req.Content != nil {
+		if phrase, ok := h.banned.Match(*req.Content); ok {
+			writeErrorCode(w, http.StatusBadRequest, codeBannedPhrase, fmt.Sprintf("message %d contains banned phrase %q", idx, phrase))
+			return
+		}
+	}
+	if err := models.ValidateMessageMeta(idx, req.Meta, h.limits.MaxMetaBytes); err != nil {
+		writeNormalizeError(w, err)
+		return
+	}
+	if req.Content != nil {
+		if err := h.limits.CheckContent(idx, strings.TrimSpace(*req.Content)); err != nil {
+			writeNormalizeError(w, err)
+			return
+		}
+	}
+	if !h.checkConversationUnlocked(w, r, id) {
+		return
+	}
+
+	updated, err := models.UpdateMessage(r.Context(), h.db, id, idx, models.UpdateMessageParams{
+		Role:    models.Role(strings.TrimSpace(req.Role)),
+		Content: req.Content,
+		Meta:    req.Meta,
+	})
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidInput) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeStoreError(w, err, "failed to update message")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+type upsertRatingRequest struct {
+	Rater string `json:"rater"`
+	Score int    `json:"score"`
+	Note  string `json:"note"`
+}
+
+func (h *Handler) handleListRatings(w http.ResponseWriter, r *http.Request) {
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+
+	c, err := models.GetConversation(r.Context(), h.db, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to get conversation")
+		return
+	}
+	if !h.checkDatasetReadable(w, r, c.DatasetID) {
+		return
+	}
+
+	ratings, err := models.ListRatings(r.Context(), h.db, id)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to list ratings")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ratings": ratings, "avg_rating": c.AvgRating, "rating_count": c.RatingCount})
+}
+
+// handleUpsertRating creates the rater's rating (201) or replaces their previous one (200).
+func (h *Handler) handleUpsertRating(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+
+	var req upsertRatingRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON")
+		return
+	}
+	if err := models.ValidateRating(req.Rater, req.Score); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !h.checkConversationUnlocked(w, r, id) {
+		return
+	}
+
+	rating, created, err := models.UpsertRating(r.Context(), h.db, id, req.Rater, req.Score, req.Note)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidInput) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeStoreError(w, err, "failed to save rating")
+		return
+	}
+
+	code := http.StatusOK
+	if created {
+		code = http.StatusCreated
+		w.Header().Set("Location", resourcePath("conversations", id)+"/ratings")
+	}
+	writeJSON(w, code, rating)
+}
+
+type appendMessageRequest struct {
+	Role    models.Role     `json:"role"`
+	Content string          `json:"content"`
+	Name    string          `json:"name"`
+	Meta    json.RawMessage `json:"meta"`
+}
+
+func (h *Handler) handleReindexConversation(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+
+	if !h.checkConversationUnlocked(w, r, id) {
+		return
+	}
+
+	res, err := models.ReindexConversationMessages(r.Context(), h.db, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeStoreError(w, err, "failed to reindex messages")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"conversation_id":    id,
+		"reindexed":          res.Messages > 0,
+		"messages_reindexed": res.Messages,
+	})
+}
+
+func (h *Handler) handleAppendMessage(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+
+	if !h.checkConversationUnlocked(w, r, id) {
+		return
+	}
+
+	var req appendMessageRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON")
+		return
+	}
+	if phrase, ok := h.banned.Match(req.Content); ok {
+		writeErrorCode(w, http.StatusBadRequest, codeBannedPhrase, fmt.Sprintf("message contains banned phrase %q", phrase))
+		return
+	}
+	if err := models.ValidateMessageMeta(-1, req.Meta, h.limits.MaxMetaBytes); err != nil {
+		writeNormalizeError(w, err)
+		return
+	}
+	if err := h.limits.CheckContent(-1, strings.TrimSpace(req.Content)); err != nil {
+		writeNormalizeError(w, err)
+		return
+	}
+
+	updated, err := models.AppendMessage(r.Context(), h.db, id, models.Message{
+		Role:    models.Role(strings.TrimSpace(string(req.Role))),
+		Content: req.Content,
+		Name:    req.Name,
+		Meta:    req.Meta,
+	}, h.strictAlternation, h.limits.MaxMessages)
+	if err != nil {
+		var le *models.LimitError
+		if errors.As(err, &le) {
+			writeNormalizeError(w, err)
+			return
+		}
+		if errors.Is(err, models.ErrInvalidInput) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeStoreError(w, err, "failed to append message")
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%s/messages/%d", resourcePath("conversations", id), len(updated.Messages)-1))
+	writeJSON(w, http.StatusCreated, updated)
+}
+
+// normalizeConversationUpsert validates a create body, reporting every rejected field in a
+// models.ValidationError. Meta and banned-phrase errors keep their own type when they are the
+// only problem.
+func normalizeConversationUpsert(req upsertConversationRequest, banned *models.PhraseFilter, limits models.MessageLimits) (models.Conversation, error) {
+	var verr models.ValidationError
+	split, err := normalizeUpsertSplit(derefString(req.Split))
+	addFieldError(&verr, err)
+	status, err := normalizeUpsertStatus(derefString(req.Status))
+	addFieldError(&verr, err)
+
+	if req.DatasetID <= 0 {
+		verr.Add("dataset_id", "dataset_id required")
+	}
+
+	langCode, ok := lang.Normalize(derefString(req.Lang))
+	if !ok {
+		verr.Add("lang", "invalid lang (expected an ISO 639 code like en)")
+	}
+	if err := models.ValidateConversationMeta(req.Meta, limits.MaxMetaBytes); err != nil {
+		verr.Add("meta", err.Error())
+	}
+
+	msgs, err := normalizeUpsertMessages(req.Messages, status, banned, limits)
+	if err := collectMessagesError(&verr, err); err != nil {
+		return models.Conversation{}, err
+	}
+
+	return models.Conversation{
+		DatasetID: req.DatasetID,
+		Split:     split,
+		Status:    status,
+		Tags:      req.Tags,
+		Source:    strings.TrimSpace(derefString(req.Source)),
+		Notes:     strings.TrimSpace(derefString(req.Notes)),
+		Lang:      langCode,
+		Meta:      req.Meta,
+		Messages:  msgs,
+	}, nil
+}
+
+// normalizeConversationPatch validates the fields present in req. current is the stored
+// conversation: its status is used for message checks when req replaces messages but not
+// status, and its messages are checked when req approves it without replacing them.
+func normalizeConversationPatch(req upsertConversationRequest, current models.Conversation, banned *models.PhraseFilter, limits models.MessageLimits) (models.ConversationPatch, error) {
+	var p models.ConversationPatch
+	if req.DatasetID < 0 {
+		return p, invalidField("dataset_id", "invalid dataset_id")
+	}
+	p.DatasetID = req.DatasetID
+
+	if req.Split != nil {
+		split, err := normalizeUpsertSplit(*req.Split)
+		if err != nil {
+			return p, err
+		}
+		p.Split = &split
+	}
+	status := current.Status
+	if req.Status != nil {
+		s, err := normalizeUpsertStatus(*req.Status)
+		if err != nil {
+			return p, err
+		}
+		status = s
+		p.Status = &status
+	}
+	if req.Lang != nil {
+		langCode, ok := lang.Normalize(*req.Lang)
+		if !ok {
+			return p, invalidField("lang", "invalid lang (expected an ISO 639 code like en)")
+		}
+		p.Lang = &langCode
+	}
+	if req.Source != nil {
+		source := strings.TrimSpace(*req.Source)
+		p.Source = &source
+	}
+	if req.Notes != nil {
+		notes := strings.TrimSpace(*req.Notes)
+		p.Notes = &notes
+	}
+	if req.Meta != nil {
+		if err := models.ValidateConversationMeta(req.Meta, limits.MaxMetaBytes); err != nil {
+			return p, invalidField("meta", err.Error())
+		}
+		p.Meta = req.Meta
+	}
+	p.Tags = req.Tags
+
+	if req.Messages != nil {
+		msgs, err := normalizeUpsertMessages(req.Messages, status, banned, limits)
+		if err != nil {
+			return p, err
+		}
+		p.Messages = msgs
+	} else if p.Status != nil && *p.Status == models.ConversationStatusApproved {
+		// Approving exports the stored messages, so they must pass what a create would check.
+		stored := slices.Clone(current.Messages)
+		if _, err := normalizeUpsertMessages(stored, status, banned, limits); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// collectMessagesError adds a messages error to verr and returns the combined result:
+// verr when any field was rejected, otherwise the messages error itself (which may be a
+// MetaError or banned_phrase error).
+func collectMessagesError(verr *models.ValidationError, err error) error {
+	if err := addFieldError(verr, err); err != nil {
+		if verr.Err() == nil {
+			return err
+		}
+		verr.Add("messages", err.Error())
+	}
+	return verr.Err()
+}
+
+func normalizeUpsertSplit(text string) (models.Split, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		text = string(models.SplitTrain)
+	}
+	split, ok := models.NormalizeSplit(text)
+	if !ok {
+		return "", invalidField("split", "invalid split")
+	}
+	return split, nil
+}
+
+func normalizeUpsertStatus(text string) (models.ConversationStatus, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		text = string(models.ConversationStatusApproved)
+	}
+	status, ok := models.NormalizeConversationStatus(text)
+	if !ok {
+		return "", invalidField("status", "invalid status")
+	}
+	return status, nil
+}
+
+func normalizeUpsertMessages(msgs []models.Message, status models.ConversationStatus, banned *models.PhraseFilter, limits models.MessageLimits) ([]models.Message, error) {
+	if len(msgs) == 0 {
+		return nil, invalidField("messages", "messages required")
+	}
+	if err := limits.CheckCount(len(msgs)); err != nil {
+		return nil, err
+	}
+	for i := range msgs {
+		msgs[i].Content = strings.TrimSpace(msgs[i].Content)
+		msgs[i].Name = strings.TrimSpace(msgs[i].Name)
+		if msgs[i].Content == "" && status != models.ConversationStatusDraft {
+			return nil, invalidField("messages", "message content cannot be empty")
+		}
+		switch msgs[i].Role {
+		case models.RoleSystem, models.RoleUser, models.RoleAssistant:
+		default:
+			return nil, invalidField("messages", "invalid role")
+		}
+	}
+	if err := limits.Check(msgs); err != nil {
+		return nil, err
+	}
+	if err := models.ValidateMessagesMeta(msgs, limits.MaxMetaBytes); err != nil {
+		return nil, err
+	}
+	for i := range msgs {
+		if len(msgs[i].Meta) == 0 || string(msgs[i].Meta) == "null" {
+			msgs[i].Meta = json.RawMessage("{}")
+		}
+	}
+	if idx, phrase := banned.MatchMessages(msgs); idx >= 0 {
+		return nil, &fieldError{Code: codeBannedPhrase, Field: "messages", Message: fmt.Sprintf("message %d contains banned phrase %q", idx, phrase)}
+	}
+	return msgs, nil
+}
+
+func derefString(p *string) string {
+	if p == nil {
+		return ""
+	}
+	return *p
+}
+
+// ----------------------------
+// Regeneration
+// ----------------------------
+
+type acceptAlternativeRequest struct {
+	AlternativeID int64 `json:"alternative_id"`
+}
+
+type createAlternativeRequest struct {
+	MessageIdx *int            `json:"message_idx"`
+	Content    string          `json:"content"`
+	Model      string          `json:"model"`
+	Author     string          `json:"author"`
+	Meta       json.RawMessage `json:"meta"`
+}
+
+// handleRegenerateMessage asks the configured LLM for a new reply to the history before the
+// assistant message ?message_idx=N and stores it as a draft alternative (201); the message
+// itself is left alone until the draft is accepted. Upstream failures pass through as 502
+// upstream_error (with the upstream status and body) or 504 upstream_timeout.
+func (h *Handler) handleRegenerateMessage(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+	if !h.llm.Enabled() {
+		writeErrorCode(w, http.StatusServiceUnavailable, codeLLMDisabled, "regeneration is disabled: no LLM endpoint configured")
+		return
+	}
+
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+	idx, err := strconv.Atoi(r.URL.Query().Get("message_idx"))
+	if err != nil || idx < 0 {
+		writeFieldError(w, "message_idx", "message_idx required (the index of an assistant message)")
+		return
+	}
+
+	msgs, err := models.LoadConversationMessages(r.Context(), h.db, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to load messages")
+		return
+	}
+	history, err := models.RegenerationHistory(msgs, idx)
+	if err != nil {
+		writeFieldError(w, "message_idx", err.Error())
+		return
+	}
+
+	prompt := make([]llm.Message, len(history))
+	for i, m := range history {
+		prompt[i] = llm.Message{Role: string(m.Role), Content: m.Content}
+	}
+	content, err := h.llm.Complete(r.Context(), prompt)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	if phrase, ok := h.banned.Match(content); ok {
+		writeErrorCode(w, http.StatusUnprocessableEntity, codeBannedPhrase, fmt.Sprintf("regenerated reply contains banned phrase %q", phrase))
+		return
+	}
+	if err := h.limits.CheckContent(idx, content); err != nil {
+		writeNormalizeError(w, err)
+		return
+	}
+
+	alt, err := models.CreateMessageAlternative(r.Context(), h.db, models.MessageAlternative{
+		ConversationID: id,
+		MessageIdx:     idx,
+		Content:        content,
+		Model:          h.llm.Model,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			writeJSONError(w, http.StatusNotFound, "message not found")
+		case errors.Is(err, models.ErrInvalidInput):
+			writeErrorCode(w, http.StatusBadGateway, codeUpstreamError, "upstream returned an empty reply")
+		default:
+			writeStoreError(w, err, "failed to save alternative")
+		}
+		return
+	}
+	w.Header().Set("Location", resourcePath("conversations", id)+"/alternatives")
+	writeJSON(w, http.StatusCreated, alt)
+}
+
+// writeUpstreamError reports a failed LLM call: 504 upstream_timeout when it timed out,
+// otherwise 502 upstream_error carrying the upstream status and body when there was one.
+func writeUpstreamError(w http.ResponseWriter, err error) {
+	var ue *llm.UpstreamError
+	var ne net.Error
+	switch {
+	case errors.As(err, &ue):
+		writeErrorCode(w, http.StatusBadGateway, codeUpstreamError, fmt.Sprintf("LLM endpoint returned %d: %s", ue.StatusCode, ue.Body))
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &ne) && ne.Timeout():
+		writeErrorCode(w, http.StatusGatewayTimeout, codeUpstreamTimeout, "LLM endpoint timed out")
+	default:
+		writeErrorCode(w, http.StatusBadGateway, codeUpstreamError, "LLM endpoint failed: "+err.Error())
+	}
+}
+
+func (h *Handler) handleListAlternatives(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+
+	alts, err := models.ListMessageAlternatives(r.Context(), h.db, id)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to list alternatives")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": alts})
+}
+
+// handleCreateAlternative stores a curator's candidate answer for an assistant message as a
+// draft alternative (201).
+func (h *Handler) handleCreateAlternative(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+	var req createAlternativeRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON")
+		return
+	}
+	if req.MessageIdx == nil {
+		writeFieldError(w, "message_idx", "message_idx required")
+		return
+	}
+	idx := *req.MessageIdx
+	content := strings.TrimSpace(req.Content)
+	if content == "" {
+		writeFieldError(w, "content", "content required")
+		return
+	}
+	if err := h.limits.CheckContent(idx, content); err != nil {
+		writeNormalizeError(w, err)
+		return
+	}
+	if err := models.ValidateMessageMeta(idx, req.Meta, h.limits.MaxMetaBytes); err != nil {
+		writeNormalizeError(w, err)
+		return
+	}
+	if phrase, ok := h.banned.Match(content); ok {
+		writeErrorCode(w, http.StatusUnprocessableEntity, codeBannedPhrase, fmt.Sprintf("alternative contains banned phrase %q", phrase))
+		return
+	}
+	if !h.checkConversationUnlocked(w, r, id) {
+		return
+	}
+
+	msgs, err := models.LoadConversationMessages(r.Context(), h.db, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not found")
 			return
 		}
-		writeJSON(w, http.StatusOK, map[string]any{"items": items, "limit": limit, "offset": offset})
+		writeJSONError(w, http.StatusInternalServerError, "failed to load messages")
+		return
+	}
+	if err := models.CheckAlternativeTarget(msgs, idx); err != nil {
+		writeFieldError(w, "message_idx", err.Error())
+		return
 	}
 
-	func (h *Handler) handleCreateDatasetItem(w http.ResponseWriter, r *http.Request) {
-		if !h.isAdmin(r) {
-			writeJSONError(w, http.StatusUnauthorized, "admin token required")
+	alt, err := models.CreateMessageAlternative(r.Context(), h.db, models.MessageAlternative{
+		ConversationID: id,
+		MessageIdx:     idx,
+		Content:        content,
+		Model:          strings.TrimSpace(req.Model),
+		Author:         req.Author,
+		Meta:           req.Meta,
+	})
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "message not found")
 			return
 		}
+		writeStoreError(w, err, "failed to save alternative")
+		return
+	}
+	w.Header().Set("Location", resourcePath("conversations", id)+"/alternatives")
+	writeJSON(w, http.StatusCreated, alt)
+}
 
-		datasetID, err := parsePathInt64(r, "id")
-		if err != nil {
-			writeJSONError(w, http.StatusBadRequest, "invalid dataset id")
-			return
-		}
+// handleAcceptAlternative promotes {"alternative_id":N} into its message; see
+// promoteAlternative.
+func (h *Handler) handleAcceptAlternative(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
 
-		// Ensure dataset exists.
-		if _, err := models.GetDataset(r.Context(), h.db, datasetID); err != nil {
-			if errors.Is(err, models.ErrNotFound) {
-				writeJSONError(w, http.StatusNotFound, "not found")
-				return
-			}
-			writeJSONError(w, http.StatusInternalServerError, "failed to get dataset")
-			return
-		}
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
 
-		var req createDatasetItemRequest
-		if err := decodeJSON(r.Body, &req); err != nil {
-			writeJSONError(w, http.StatusBadRequest, "invalid JSON")
-			return
-		}
+	var req acceptAlternativeRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON")
+		return
+	}
+	if req.AlternativeID <= 0 {
+		writeFieldError(w, "alternative_id", "alternative_id required")
+		return
+	}
+	h.promoteAlternative(w, r, id, req.AlternativeID)
+}
 
-		it, err := models.CreateDatasetItem(r.Context(), h.db, datasetID, req.Data, req.SourceRef)
-		if err != nil {
-			if errors.Is(err, models.ErrInvalidInput) {
-				writeJSONError(w, http.StatusBadRequest, "invalid item")
-				return
-			}
-			writeJSONError(w, http.StatusInternalServerError, "failed to create item")
-			return
-		}
-		writeJSON(w, http.StatusCreated, it)
+// handlePromoteAlternative is handleAcceptAlternative with the alternative in the path.
+func (h *Handler) handlePromoteAlternative(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
 	}
 
-	func (h *Handler) handleGetDatasetItem(w http.ResponseWriter, r *http.Request) {
-		id, err := parsePathInt64(r, "id")
-		if err != nil {
-			writeJSONError(w, http.StatusBadRequest, "invalid id")
-			return
-		}
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+	altID, err := parsePathInt64(r, "alt_id")
+	if err != nil || altID <= 0 {
+		writeFieldError(w, "alt_id", "invalid alternative id")
+		return
+	}
+	h.promoteAlternative(w, r, id, altID)
+}
 
-		it, err := models.GetDatasetItem(r.Context(), h.db, id)
-		if err != nil {
-			if errors.Is(err, models.ErrNotFound) {
-				writeJSONError(w, http.StatusNotFound, "not found")
-				return
-			}
-			writeJSONError(w, http.StatusInternalServerError, "failed to get item")
-			return
-		}
-		writeJSON(w, http.StatusOK, it)
+// promoteAlternative swaps a draft or replaced alternative into its message and returns the
+// updated conversation; 404 when it is gone, as it is once a rewrite dropped its message, and
+// 409 when it is already accepted or its message changed role. The text goes through the
+// banned-phrase and size checks again, since batch-imported drafts skip the API and the
+// banned list may have changed since the draft was stored.
+func (h *Handler) promoteAlternative(w http.ResponseWriter, r *http.Request, id, altID int64) {
+	if !h.checkConversationUnlocked(w, r, id) {
+		return
 	}
 
-	func (h *Handler) handleUpdateDatasetItem(w http.ResponseWriter, r *http.Request) {
-		if !h.isAdmin(r) {
-			writeJSONError(w, http.StatusUnauthorized, "admin token required")
-			return
+	var bannedPhrase string
+	var limitErr error
+	check := func(idx int, content string) error {
+		if phrase, ok := h.banned.Match(content); ok {
+			bannedPhrase = phrase
+			return fmt.Errorf("%w: alternative contains banned phrase %q", models.ErrInvalidInput, phrase)
 		}
-
-		id, err := parsePathInt64(r, "id")
-		if err != nil {
-			writeJSONError(w, http.StatusBadRequest, "invalid id")
-			return
+		limitErr = h.limits.CheckContent(idx, content)
+		return limitErr
+	}
+	updated, err := models.AcceptMessageAlternative(r.Context(), h.db, id, altID, check)
+	if err != nil {
+		switch {
+		case bannedPhrase != "":
+			writeErrorCode(w, http.StatusUnprocessableEntity, codeBannedPhrase, fmt.Sprintf("alternative contains banned phrase %q", bannedPhrase))
+		case limitErr != nil:
+			writeNormalizeError(w, limitErr)
+		case errors.Is(err, models.ErrNotFound):
+			writeJSONError(w, http.StatusNotFound, "alternative not found")
+		case errors.Is(err, models.ErrConflict):
+			writeErrorCode(w, http.StatusConflict, codeConflict, err.Error())
+		default:
+			writeStoreError(w, err, "failed to accept alternative")
 		}
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
 
-		var req updateDatasetItemRequest
-		if err := decodeJSON(r.Body, &req); err != nil {
-			writeJSONError(w, http.StatusBadRequest, "invalid JSON")
+// ----------------------------
+// Generation jobs
+// ----------------------------
+
+type createGenerationJobRequest struct {
+	DatasetID      int64             `json:"dataset_id"`
+	PromptTemplate string            `json:"prompt_template"`
+	SystemPrompt   string            `json:"system_prompt"`
+	Seeds          []json.RawMessage `json:"seeds"`
+	SeedDatasetID  *int64            `json:"seed_dataset_id"`
+	TargetCount    int               `json:"target_count"`
+	Concurrency    int               `json:"concurrency"`
+	Model          string            `json:"model"`
+	Temperature    *float64          `json:"temperature"`
+	MaxTokens      int               `json:"max_tokens"`
+}
+
+// handleCreateGenerationJob queues a job that prompts the LLM over seeds and writes the
+// replies into a conversation dataset as pending conversations. It returns 202 at once;
+// progress is read from GET /api/v1/generation-jobs/{id}.
+func (h *Handler) handleCreateGenerationJob(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+	if !h.llm.Enabled() {
+		writeErrorCode(w, http.StatusServiceUnavailable, codeLLMDisabled, "generation is disabled: no LLM endpoint configured")
+		return
+	}
+
+	var req createGenerationJobRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON")
+		return
+	}
+	if req.Concurrency == 0 {
+		req.Concurrency = 1
+	}
+	job := models.GenerationJob{
+		DatasetID:      req.DatasetID,
+		PromptTemplate: req.PromptTemplate,
+		SystemPrompt:   req.SystemPrompt,
+		Seeds:          req.Seeds,
+		SeedDatasetID:  req.SeedDatasetID,
+		TargetCount:    req.TargetCount,
+		Concurrency:    req.Concurrency,
+		Params:         models.GenerationParams{Model: strings.TrimSpace(req.Model), Temperature: req.Temperature, MaxTokens: req.MaxTokens},
+	}
+	if err := models.ValidateGenerationJob(job); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !h.checkUnlocked(w, r, job.DatasetID) {
+		return
+	}
+
+	job, err := models.CreateGenerationJob(r.Context(), h.db, job)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidInput) {
+			writeFieldError(w, "seed_dataset_id", err.Error())
 			return
 		}
+		writeInsertError(w, err, "failed to create generation job")
+		return
+	}
+	h.startGenerationJob(job)
+	w.Header().Set("Location", resourcePath("generation-jobs", job.ID))
+	writeJSON(w, http.StatusAccepted, job)
+}
 
-		existing, err := models.GetDatasetItem(r.Context(), h.db, id)
-		if err != nil {
-			if errors.Is(err, models.ErrNotFound) {
-				writeJSONError(w, http.StatusNotFound, "not found")
-				return
-			}
-			writeJSONError(w, http.StatusInternalServerError, "failed to get item")
+// handleListGenerationJobs is GET /api/v1/generation-jobs?dataset_id=N.
+func (h *Handler) handleListGenerationJobs(w http.ResponseWriter, r *http.Request) {
+	datasetID := int64(parseIntDefault(r.URL.Query().Get("dataset_id"), 0))
+	if datasetID <= 0 {
+		writeFieldError(w, "dataset_id", "dataset_id is required")
+		return
+	}
+	if !h.checkDatasetReadable(w, r, datasetID) {
+		return
+	}
+
+	limit := parseIntDefault(r.URL.Query().Get("limit"), 50)
+	offset := parseIntDefault(r.URL.Query().Get("offset"), 0)
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > 200 {
+		limit = 200
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	jobs, err := models.ListGenerationJobs(r.Context(), h.db, datasetID, limit, offset)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to list generation jobs")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"jobs": jobs})
+}
+
+func (h *Handler) handleGetGenerationJob(w http.ResponseWriter, r *http.Request) {
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+
+	job, err := models.GetGenerationJob(r.Context(), h.db, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not found")
 			return
 		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to get generation job")
+		return
+	}
+	if !h.checkDatasetReadable(w, r, job.DatasetID) {
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
 
-		newData := existing.Data
-		if req.Data != nil {
-			newData = *req.Data
-		}
-		newSourceRef := existing.SourceRef
-		if req.SourceRef != nil {
-			newSourceRef = *req.SourceRef
-		}
+// handleCancelGenerationJob stops a queued or running job; conversations it already wrote
+// stay in the review queue. A finished job is 409.
+func (h *Handler) handleCancelGenerationJob(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
 
-		updated, err := models.UpdateDatasetItem(r.Context(), h.db, id, newData, newSourceRef)
-		if err != nil {
-			if errors.Is(err, models.ErrInvalidInput) {
-				writeJSONError(w, http.StatusBadRequest, "invalid item")
-				return
-			}
-			if errors.Is(err, models.ErrNotFound) {
-				writeJSONError(w, http.StatusNotFound, "not found")
-				return
-			}
-			writeJSONError(w, http.StatusInternalServerError, "failed to update item")
-			return
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+
+	job, err := models.CancelGenerationJob(r.Context(), h.db, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			writeJSONError(w, http.StatusNotFound, "not found")
+		case errors.Is(err, models.ErrConflict):
+			writeErrorCode(w, http.StatusConflict, codeConflict, err.Error())
+		default:
+			writeJSONError(w, http.StatusInternalServerError, "failed to cancel generation job")
 		}
-		writeJSON(w, http.StatusOK, updated)
+		return
 	}
+	h.generation.cancel(id)
+	writeJSON(w, http.StatusOK, job)
+}
 
-	func (h *Handler) handleDeleteDatasetItem(w http.ResponseWriter, r *http.Request) {
-		if !h.isAdmin(r) {
-			writeJSONError(w, http.StatusUnauthorized, "admin token required")
+// ----------------------------
+// Semantic search
+// ----------------------------
+
+// checkVectorStore writes 501 vector_unavailable and returns false when pgvector was not
+// installed, so the conversation_embeddings table is missing.
+func (h *Handler) checkVectorStore(w http.ResponseWriter, r *http.Request) bool {
+	ok, err := models.EmbeddingsAvailable(r.Context(), h.db)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to check for pgvector")
+		return false
+	}
+	if !ok {
+		writeErrorCode(w, http.StatusNotImplemented, codeNoVector, models.ErrVectorUnavailable.Error())
+		return false
+	}
+	return true
+}
+
+func writeEmbedDisabled(w http.ResponseWriter) {
+	writeErrorCode(w, http.StatusNotImplemented, codeEmbedDisabled, "semantic search is disabled: no embedding endpoint configured (DATALAB_EMBED_MODEL)")
+}
+
+// handleEmbedDataset embeds up to limit conversations of a dataset whose embedding is missing
+// or older than their messages, in batches of DATALAB_EMBED_BATCH_SIZE, and reports how many
+// remain; call it again until remaining is 0. Batches embedded before a failed call are kept.
+func (h *Handler) handleEmbedDataset(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+	if !h.embedder.Enabled() {
+		writeEmbedDisabled(w)
+		return
+	}
+
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid dataset id")
+		return
+	}
+	q := r.URL.Query()
+	text := strings.TrimSpace(q.Get("text"))
+	if text == "" {
+		text = models.EmbedTextFirstUser
+	}
+	if !slices.Contains(models.EmbedTexts, text) {
+		writeFieldError(w, "text", "invalid text (expected "+strings.Join(models.EmbedTexts, "|")+")")
+		return
+	}
+	limit := parseIntDefault(q.Get("limit"), 1000)
+	if limit < 1 || limit > 10000 {
+		writeFieldError(w, "limit", "limit must be 1-10000")
+		return
+	}
+	force := parseBoolDefault(q.Get("force"), false)
+
+	ds, err := h.datasetHead(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not found")
 			return
 		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to get dataset")
+		return
+	}
+	if ds.Kind != models.DatasetKindConversations {
+		writeErrorCode(w, http.StatusConflict, codeWrongDatasetKind, fmt.Sprintf("dataset %q is a %s dataset; only conversations can be embedded", ds.Name, ds.Kind))
+		return
+	}
+	if !h.checkVectorStore(w, r) {
+		return
+	}
 
-		id, err := parsePathInt64(r, "id")
+	model := h.embedder.Model
+	pending, err := models.PendingEmbeddings(r.Context(), h.db, id, model, text, force, limit)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to list conversations to embed")
+		return
+	}
+	batch := h.embedBatchSize
+	if batch < 1 {
+		batch = 64
+	}
+	embedded, dims := 0, 0
+	for start := 0; start < len(pending); start += batch {
+		chunk := pending[start:min(start+batch, len(pending))]
+		ids := make([]int64, len(chunk))
+		inputs := make([]string, len(chunk))
+		for i, in := range chunk {
+			ids[i], inputs[i] = in.ConversationID, in.Text
+		}
+		vecs, err := h.embedder.Embed(r.Context(), inputs)
 		if err != nil {
-			writeJSONError(w, http.StatusBadRequest, "invalid id")
+			writeUpstreamError(w, err)
 			return
 		}
-
-		if err := models.DeleteDatasetItem(r.Context(), h.db, id); err != nil {
-			if errors.Is(err, models.ErrNotFound) {
-				writeJSONError(w, http.StatusNotFound, "not found")
-				return
-			}
-			writeJSONError(w, http.StatusInternalServerError, "failed to delete item")
+		if err := models.SaveEmbeddings(r.Context(), h.db, model, text, ids, vecs); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to save embeddings")
+			return
+		}
+		embedded += len(chunk)
+		dims = len(vecs[0])
+	}
+	if dims > 0 {
+		if err := models.EnsureEmbeddingIndex(r.Context(), h.db, h.embedIndex, dims); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to create embedding index")
 			return
 		}
-		writeJSON(w, http.StatusOK, map[string]any{"ok": true})
 	}
 
-	type upsertConversationRequest struct {
-		DatasetID int64            `json:"dataset_id"`
-		Split     string           `json:"split"`
-	Status    string           `json:"status"`
-	Tags      []string         `json:"tags"`
-	Source    string           `json:"source"`
-	Notes     string           `json:"notes"`
-	Messages  []models.Message `json:"messages"`
+	remaining, err := models.CountPendingEmbeddings(r.Context(), h.db, id, model, text)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to count conversations to embed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"model": model, "text": text, "dims": dims, "embedded": embedded, "remaining": remaining})
 }
 
-func (h *Handler) handleGetConversation(w http.ResponseWriter, r *http.Request) {
+// handleSimilarConversations returns a dataset's conversations nearest to ?q= (embedded with
+// the configured model) or to conversation ?like_id='s stored embedding, with cosine scores.
+// q calls the embeddings endpoint, so it is admin only; like_id must be in the dataset.
+func (h *Handler) handleSimilarConversations(w http.ResponseWriter, r *http.Request) {
 	id, err := parsePathInt64(r, "id")
 	if err != nil {
-		writeJSONError(w, http.StatusBadRequest, "invalid id")
+		writeFieldError(w, "id", "invalid dataset id")
 		return
 	}
-
-	c, err := models.GetConversation(r.Context(), h.db, id)
-	if err != nil {
-		if errors.Is(err, models.ErrNotFound) {
-			writeJSONError(w, http.StatusNotFound, "not found")
+	q := r.URL.Query()
+	text := strings.TrimSpace(q.Get("q"))
+	var likeID int64
+	if raw := strings.TrimSpace(q.Get("like_id")); raw != "" {
+		likeID, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || likeID <= 0 {
+			writeFieldError(w, "like_id", "invalid like_id")
 			return
 		}
-		writeJSONError(w, http.StatusInternalServerError, "failed to get conversation")
+	}
+	if (text == "") == (likeID == 0) {
+		writeFieldError(w, "q", "give either q or like_id")
 		return
 	}
-
-	writeJSON(w, http.StatusOK, c)
-}
-
-func (h *Handler) handleCreateConversation(w http.ResponseWriter, r *http.Request) {
-	if !h.isAdmin(r) {
-		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+	limit := parseIntDefault(q.Get("limit"), 10)
+	if limit < 1 || limit > 100 {
+		writeFieldError(w, "limit", "limit must be 1-100")
 		return
 	}
-
-	var req upsertConversationRequest
-	if err := decodeJSON(r.Body, &req); err != nil {
-		writeJSONError(w, http.StatusBadRequest, "invalid JSON")
+	if text != "" && !h.embedder.Enabled() {
+		writeEmbedDisabled(w)
 		return
 	}
-
-	conv, err := normalizeConversationUpsert(req)
-	if err != nil {
-		writeJSONError(w, http.StatusBadRequest, err.Error())
+	if text != "" && !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required to search by q")
 		return
 	}
 
-	tx, err := h.db.BeginTx(r.Context(), nil)
-	if err != nil {
-		writeJSONError(w, http.StatusInternalServerError, "failed to start transaction")
+	if !h.checkDatasetReadable(w, r, id) {
 		return
 	}
-	defer tx.Rollback()
-
-	inserted, err := models.InsertConversationWithMessages(r.Context(), tx, conv)
-	if err != nil {
-		writeJSONError(w, http.StatusInternalServerError, "failed to create conversation")
+	if !h.checkVectorStore(w, r) {
 		return
 	}
-	if err := tx.Commit(); err != nil {
-		writeJSONError(w, http.StatusInternalServerError, "failed to commit")
+
+	var vec []float32
+	var model string
+	if text != "" {
+		vecs, err := h.embedder.Embed(r.Context(), []string{text})
+		if err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+		vec, model = vecs[0], h.embedder.Model
+	} else {
+		vec, model, err = models.ConversationEmbedding(r.Context(), h.db, id, likeID)
+		if err != nil {
+			if errors.Is(err, models.ErrNotFound) {
+				writeJSONError(w, http.StatusNotFound, fmt.Sprintf("conversation %d of dataset %d has no embedding; run POST /api/v1/datasets/{id}/embed first", likeID, id))
+				return
+			}
+			writeJSONError(w, http.StatusInternalServerError, "failed to load embedding")
+			return
+		}
+	}
+
+	results, err := models.SimilarConversations(r.Context(), h.db, id, model, vec, likeID, limit)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to search conversations")
 		return
 	}
+	writeJSON(w, http.StatusOK, map[string]any{"model": model, "results": results})
+}
+
+// ----------------------------
+// Flags
+// ----------------------------
 
-	writeJSON(w, http.StatusCreated, inserted)
+type flagRequest struct {
+	Category  models.FlagCategory `json:"category"`
+	Note      string              `json:"note"`
+	FlaggedBy string              `json:"flagged_by"`
 }
 
-func (h *Handler) handleUpdateConversation(w http.ResponseWriter, r *http.Request) {
+type resolveFlagRequest struct {
+	Resolver   string `json:"resolver"`
+	Resolution string `json:"resolution"`
+}
+
+func (h *Handler) handleFlagConversation(w http.ResponseWriter, r *http.Request) {
+	h.createFlag(w, r, "conversations", models.FlagConversation)
+}
+
+func (h *Handler) handleFlagProposal(w http.ResponseWriter, r *http.Request) {
+	h.createFlag(w, r, "proposals", models.FlagProposal)
+}
+
+// createFlag opens a flag on the conversation or proposal {id} of resource (201), 404 when
+// it does not exist.
+func (h *Handler) createFlag(w http.ResponseWriter, r *http.Request, resource string,
+	flag func(context.Context, *sql.DB, int64, models.FlagCategory, string, string) (models.Flag, error)) {
 	if !h.isAdmin(r) {
 		writeJSONError(w, http.StatusUnauthorized, "admin token required")
 		return
@@ -546,112 +3435,126 @@ func (h *Handler) handleUpdateConversation(w http.ResponseWriter, r *http.Reques
 
 	id, err := parsePathInt64(r, "id")
 	if err != nil {
-		writeJSONError(w, http.StatusBadRequest, "invalid id")
+		writeFieldError(w, "id", "invalid id")
 		return
 	}
 
-	var req upsertConversationRequest
+	var req flagRequest
 	if err := decodeJSON(r.Body, &req); err != nil {
-		writeJSONError(w, http.StatusBadRequest, "invalid JSON")
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON")
 		return
 	}
-
-	conv, err := normalizeConversationUpsert(req)
-	if err != nil {
-		writeJSONError(w, http.StatusBadRequest, err.Error())
+	if !models.ValidFlagCategory(req.Category) {
+		writeFieldError(w, "category", "invalid category (expected toxicity|pii|copyright|other)")
 		return
 	}
-	conv.ID = id
 
-	updated, err := models.UpdateConversation(r.Context(), h.db, conv)
+	f, err := flag(r.Context(), h.db, id, req.Category, req.Note, req.FlaggedBy)
 	if err != nil {
 		if errors.Is(err, models.ErrNotFound) {
 			writeJSONError(w, http.StatusNotFound, "not found")
 			return
 		}
-		writeJSONError(w, http.StatusInternalServerError, "failed to update conversation")
+		writeJSONError(w, http.StatusInternalServerError, "failed to save flag")
 		return
 	}
+	w.Header().Set("Location", resourcePath(resource, id)+"/flags")
+	writeJSON(w, http.StatusCreated, f)
+}
 
-	writeJSON(w, http.StatusOK, updated)
+func (h *Handler) handleListConversationFlags(w http.ResponseWriter, r *http.Request) {
+	h.listFlags(w, r, func(p *models.ListFlagsParams, id int64) { p.ConversationID = id })
 }
 
-func (h *Handler) handleDeleteConversation(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) handleListProposalFlags(w http.ResponseWriter, r *http.Request) {
+	h.listFlags(w, r, func(p *models.ListFlagsParams, id int64) { p.ProposalID = id })
+}
+
+func (h *Handler) handleListFlags(w http.ResponseWriter, r *http.Request) {
+	h.listFlags(w, r, nil)
+}
+
+// listFlags lists flags filtered by ?status= (open|resolved|any, default open) and
+// ?category=; scope, when set, narrows them to the {id} path value.
+func (h *Handler) listFlags(w http.ResponseWriter, r *http.Request, scope func(*models.ListFlagsParams, int64)) {
 	if !h.isAdmin(r) {
 		writeJSONError(w, http.StatusUnauthorized, "admin token required")
 		return
 	}
 
-	id, err := parsePathInt64(r, "id")
-	if err != nil {
-		writeJSONError(w, http.StatusBadRequest, "invalid id")
-		return
+	var p models.ListFlagsParams
+	if scope != nil {
+		id, err := parsePathInt64(r, "id")
+		if err != nil {
+			writeFieldError(w, "id", "invalid id")
+			return
+		}
+		scope(&p, id)
 	}
 
-	if err := models.DeleteConversation(r.Context(), h.db, id); err != nil {
-		if errors.Is(err, models.ErrNotFound) {
-			writeJSONError(w, http.StatusNotFound, "not found")
+	q := r.URL.Query()
+	switch status := strings.TrimSpace(q.Get("status")); status {
+	case "":
+		p.Status = models.FlagStatusOpen
+	case "any":
+	case models.FlagStatusOpen, models.FlagStatusResolved:
+		p.Status = status
+	default:
+		writeFieldError(w, "status", "invalid status (expected open|resolved|any)")
+		return
+	}
+	if category := models.FlagCategory(strings.TrimSpace(q.Get("category"))); category != "" {
+		if !models.ValidFlagCategory(category) {
+			writeFieldError(w, "category", "invalid category (expected toxicity|pii|copyright|other)")
 			return
 		}
-		writeJSONError(w, http.StatusInternalServerError, "failed to delete conversation")
-		return
+		p.Category = category
 	}
 
-	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+	flags, err := models.ListFlags(r.Context(), h.db, p)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to list flags")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": flags})
 }
 
-func normalizeConversationUpsert(req upsertConversationRequest) (models.Conversation, error) {
-	splitText := strings.TrimSpace(req.Split)
-	if splitText == "" {
-		splitText = string(models.SplitTrain)
-	}
-	split, ok := models.NormalizeSplit(splitText)
-	if !ok {
-		return models.Conversation{}, errors.New("invalid split")
+// handleResolveFlag closes an open flag; resolving one twice is 409.
+func (h *Handler) handleResolveFlag(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
 	}
 
-	statusText := strings.TrimSpace(req.Status)
-	if statusText == "" {
-		statusText = string(models.ConversationStatusApproved)
-	}
-	status, ok := models.NormalizeConversationStatus(statusText)
-	if !ok {
-		return models.Conversation{}, errors.New("invalid status")
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
 	}
 
-	if req.DatasetID <= 0 {
-		return models.Conversation{}, errors.New("dataset_id required")
+	var req resolveFlagRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON")
+		return
 	}
-
-	msgs := req.Messages
-	if len(msgs) == 0 {
-		return models.Conversation{}, errors.New("messages required")
+	if err := models.ValidateFlagResolution(req.Resolver, req.Resolution); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
 	}
-	for i := range msgs {
-		msgs[i].Content = strings.TrimSpace(msgs[i].Content)
-		msgs[i].Name = strings.TrimSpace(msgs[i].Name)
-		if msgs[i].Content == "" && status != models.ConversationStatusDraft {
-			return models.Conversation{}, errors.New("message content cannot be empty")
-		}
-		switch msgs[i].Role {
-		case models.RoleSystem, models.RoleUser, models.RoleAssistant:
+
+	f, err := models.ResolveFlag(r.Context(), h.db, id, req.Resolver, req.Resolution)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			writeJSONError(w, http.StatusNotFound, "flag not found")
+		case errors.Is(err, models.ErrConflict):
+			writeJSONError(w, http.StatusConflict, err.Error())
 		default:
-			return models.Conversation{}, errors.New("invalid role")
-		}
-		if len(msgs[i].Meta) == 0 {
-			msgs[i].Meta = json.RawMessage("{}")
+			writeJSONError(w, http.StatusInternalServerError, "failed to resolve flag")
 		}
+		return
 	}
-
-	return models.Conversation{
-		DatasetID: req.DatasetID,
-		Split:     split,
-		Status:    status,
-		Tags:      req.Tags,
-		Source:    strings.TrimSpace(req.Source),
-		Notes:     strings.TrimSpace(req.Notes),
-		Messages:  msgs,
-	}, nil
+	writeJSON(w, http.StatusOK, f)
 }
 
 // ----------------------------
@@ -673,26 +3576,58 @@ type createProposalRequest struct {
 }
 
 func (h *Handler) handleCreateProposal(w http.ResponseWriter, r *http.Request) {
+	idemKey, ok := idempotencyKey(w, r)
+	if !ok {
+		return
+	}
+	raw, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "failed to read body")
+		return
+	}
+
 	var req createProposalRequest
-	if err := decodeJSON(r.Body, &req); err != nil {
-		writeJSONError(w, http.StatusBadRequest, "invalid JSON")
+	if err := decodeJSON(bytes.NewReader(raw), &req); err != nil {
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON")
+		return
+	}
+
+	conv, err := normalizeConversationFromProposal(req, h.banned, h.limits)
+	if err != nil {
+		writeNormalizeError(w, err)
 		return
 	}
 
-	conv, err := normalizeConversationFromProposal(req)
+	tx, err := h.db.BeginTx(r.Context(), nil)
 	if err != nil {
-		writeJSONError(w, http.StatusBadRequest, err.Error())
+		writeJSONError(w, http.StatusInternalServerError, "failed to start transaction")
 		return
 	}
+	defer tx.Rollback()
 
+	if !h.reserveIdempotent(w, r, tx, "proposals", idemKey, raw) {
+		return
+	}
+	if !h.checkProposalDataset(w, r, conv.DatasetID, http.StatusBadRequest) {
+		return
+	}
 	payload, _ := json.Marshal(conv)
-	p, err := models.CreateProposal(r.Context(), h.db, payload)
+	p, err := models.CreateProposal(r.Context(), tx, payload)
 	if err != nil {
 		writeJSONError(w, http.StatusInternalServerError, "failed to create proposal")
 		return
 	}
+	body, err := completeIdempotent(r.Context(), tx, "proposals", idemKey, p.ID, http.StatusCreated, p)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to store idempotency key")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to commit")
+		return
+	}
 
-	writeJSON(w, http.StatusCreated, p)
+	writeIdempotentJSON(w, "proposals", p.ID, http.StatusCreated, body)
 }
 
 func (h *Handler) handleListProposalsAdmin(w http.ResponseWriter, r *http.Request) {
@@ -715,6 +3650,59 @@ func (h *Handler) handleListProposalsAdmin(w http.ResponseWriter, r *http.Reques
 	writeJSON(w, http.StatusOK, map[string]any{"items": items})
 }
 
+// handlePurgeProposals purges proposals decided as ?status=rejected|approved more than
+// ?older_than ago (see models.PurgeProposals); both parameters are required.
+func (h *Handler) handlePurgeProposals(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+
+	q := r.URL.Query()
+	status := strings.TrimSpace(q.Get("status"))
+	if status != models.ProposalStatusRejected && status != models.ProposalStatusApproved {
+		writeFieldError(w, "status", "invalid status (expected rejected|approved)")
+		return
+	}
+	olderThan, ok := parseAge(q.Get("older_than"))
+	if !ok {
+		writeFieldError(w, "older_than", "invalid older_than (expected a positive age like 30d or 12h)")
+		return
+	}
+
+	n, err := models.PurgeProposals(r.Context(), h.db, status, olderThan)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to purge proposals")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status": status, "older_than": olderThan.String(), "purged": n})
+}
+
+func (h *Handler) handleGetProposal(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+
+	id, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid id")
+		return
+	}
+
+	p, err := models.GetProposal(r.Context(), h.db, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "proposal not found")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to load proposal")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, p)
+}
+
 func (h *Handler) handleApproveProposal(w http.ResponseWriter, r *http.Request) {
 	if !h.isAdmin(r) {
 		writeJSONError(w, http.StatusUnauthorized, "admin token required")
@@ -723,7 +3711,7 @@ func (h *Handler) handleApproveProposal(w http.ResponseWriter, r *http.Request)
 
 	id, err := parsePathInt64(r, "id")
 	if err != nil {
-		writeJSONError(w, http.StatusBadRequest, "invalid id")
+		writeFieldError(w, "id", "invalid id")
 		return
 	}
 
@@ -745,16 +3733,33 @@ func (h *Handler) handleApproveProposal(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	openFlags, err := models.CountOpenProposalFlags(ctx, tx, id)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to load proposal flags")
+		return
+	}
+	if openFlags > 0 {
+		writeErrorCode(w, http.StatusConflict, codeOpenFlags, fmt.Sprintf("proposal has %d open flags; resolve them before approving", openFlags))
+		return
+	}
+
 	conv, err := decodeConversationPayload(proposal.Payload)
 	if err != nil {
 		writeJSONError(w, http.StatusBadRequest, "proposal payload invalid")
 		return
 	}
+	// The dataset may have been replaced by an items dataset since the proposal was filed.
+	if !h.checkProposalDataset(w, r, conv.DatasetID, http.StatusConflict) {
+		return
+	}
+	if !h.checkUnlocked(w, r, conv.DatasetID) {
+		return
+	}
 	conv.Status = models.ConversationStatusApproved
 
 	inserted, err := models.InsertConversationWithMessages(ctx, tx, conv)
 	if err != nil {
-		writeJSONError(w, http.StatusInternalServerError, "failed to insert conversation")
+		writeInsertError(w, err, "failed to insert conversation")
 		return
 	}
 
@@ -772,6 +3777,38 @@ func (h *Handler) handleApproveProposal(w http.ResponseWriter, r *http.Request)
 	writeJSON(w, http.StatusOK, inserted)
 }
 
+// checkProposalDataset writes an error (kindCode when the kind is wrong) unless datasetID is
+// an existing conversation dataset; proposals always become conversations.
+// writeInsertError reports a failed row insert: 404 for a missing dataset, 409
+// wrong_dataset_kind for a dataset of the other kind, 500 with msg otherwise.
+func writeInsertError(w http.ResponseWriter, err error, msg string) {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		writeJSONError(w, http.StatusNotFound, "dataset not found")
+	case errors.Is(err, models.ErrWrongDatasetKind):
+		writeErrorCode(w, http.StatusConflict, codeWrongDatasetKind, err.Error())
+	default:
+		writeStoreError(w, err, msg)
+	}
+}
+
+func (h *Handler) checkProposalDataset(w http.ResponseWriter, r *http.Request, datasetID int64, kindCode int) bool {
+	ds, err := h.datasetHead(r.Context(), datasetID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "dataset not found")
+			return false
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to load dataset")
+		return false
+	}
+	if strings.EqualFold(ds.Kind, "items") {
+		writeJSONError(w, kindCode, fmt.Sprintf("dataset %q is an items dataset; proposals can only target conversation datasets", ds.Name))
+		return false
+	}
+	return true
+}
+
 func (h *Handler) handleRejectProposal(w http.ResponseWriter, r *http.Request) {
 	if !h.isAdmin(r) {
 		writeJSONError(w, http.StatusUnauthorized, "admin token required")
@@ -780,7 +3817,7 @@ func (h *Handler) handleRejectProposal(w http.ResponseWriter, r *http.Request) {
 
 	id, err := parsePathInt64(r, "id")
 	if err != nil {
-		writeJSONError(w, http.StatusBadRequest, "invalid id")
+		writeFieldError(w, "id", "invalid id")
 		return
 	}
 
@@ -796,28 +3833,48 @@ func (h *Handler) handleRejectProposal(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
 }
 
-func normalizeConversationFromProposal(req createProposalRequest) (models.Conversation, error) {
+func normalizeConversationFromProposal(req createProposalRequest, banned *models.PhraseFilter, limits models.MessageLimits) (models.Conversation, error) {
+	var verr models.ValidationError
 	splitText := strings.TrimSpace(req.Split)
 	if splitText == "" {
 		splitText = string(models.SplitTrain)
 	}
 	split, ok := models.NormalizeSplit(splitText)
 	if !ok {
-		return models.Conversation{}, errors.New("invalid split")
+		verr.Add("split", "invalid split")
 	}
 
 	datasetID := req.DatasetID
 	if datasetID <= 0 {
-		return models.Conversation{}, errors.New("dataset_id required")
+		verr.Add("dataset_id", "dataset_id required")
 	}
 
+	msgs, err := proposalMessages(req, banned, limits)
+	if err := collectMessagesError(&verr, err); err != nil {
+		return models.Conversation{}, err
+	}
+
+	return models.Conversation{
+		DatasetID: datasetID,
+		Split:     split,
+		Status:    models.ConversationStatusPending,
+		Tags:      req.Tags,
+		Source:    strings.TrimSpace(req.Source),
+		Notes:     strings.TrimSpace(req.Notes),
+		Messages:  msgs,
+	}, nil
+}
+
+// proposalMessages returns the proposal's messages, built from user/assistant/system when
+// messages is empty.
+func proposalMessages(req createProposalRequest, banned *models.PhraseFilter, limits models.MessageLimits) ([]models.Message, error) {
 	msgs := req.Messages
 	if len(msgs) == 0 {
 		user := strings.TrimSpace(req.User)
 		assistant := strings.TrimSpace(req.Assistant)
 		system := strings.TrimSpace(req.System)
 		if user == "" || assistant == "" {
-			return models.Conversation{}, errors.New("messages or (user+assistant) required")
+			return nil, invalidField("messages", "messages or (user+assistant) required")
 		}
 		if system != "" {
 			msgs = append(msgs, models.Message{Role: models.RoleSystem, Content: system, Meta: json.RawMessage("{}")})
@@ -828,31 +3885,34 @@ func normalizeConversationFromProposal(req createProposalRequest) (models.Conver
 		)
 	}
 
+	if err := limits.CheckCount(len(msgs)); err != nil {
+		return nil, err
+	}
 	for i := range msgs {
 		msgs[i].Content = strings.TrimSpace(msgs[i].Content)
 		msgs[i].Name = strings.TrimSpace(msgs[i].Name)
-		if len(msgs[i].Meta) == 0 {
+		if err := limits.CheckContent(i, msgs[i].Content); err != nil {
+			return nil, err
+		}
+		if err := models.ValidateMessageMeta(i, msgs[i].Meta, limits.MaxMetaBytes); err != nil {
+			return nil, err
+		}
+		if len(msgs[i].Meta) == 0 || string(msgs[i].Meta) == "null" {
 			msgs[i].Meta = json.RawMessage("{}")
 		}
 		switch msgs[i].Role {
 		case models.RoleSystem, models.RoleUser, models.RoleAssistant:
 		default:
-			return models.Conversation{}, errors.New("invalid role")
+			return nil, invalidField("messages", "invalid role")
 		}
 		if msgs[i].Content == "" {
-			return models.Conversation{}, errors.New("message content cannot be empty")
+			return nil, invalidField("messages", "message content cannot be empty")
 		}
 	}
-
-	return models.Conversation{
-		DatasetID: datasetID,
-		Split:     split,
-		Status:    models.ConversationStatusPending,
-		Tags:      req.Tags,
-		Source:    strings.TrimSpace(req.Source),
-		Notes:     strings.TrimSpace(req.Notes),
-		Messages:  msgs,
-	}, nil
+	if idx, phrase := banned.MatchMessages(msgs); idx >= 0 {
+		return nil, &fieldError{Code: codeBannedPhrase, Field: "messages", Message: fmt.Sprintf("message %d contains banned phrase %q", idx, phrase)}
+	}
+	return msgs, nil
 }
 
 func decodeConversationPayload(payload []byte) (models.Conversation, error) {
@@ -873,16 +3933,82 @@ func decodeConversationPayload(payload []byte) (models.Conversation, error) {
 // Export
 // ----------------------------
 
-func (h *Handler) handleExportJSONL(w http.ResponseWriter, r *http.Request) {
+// Export formats (?format=): jsonl lines, or md transcripts of whole conversations in a zip.
+const (
+	exportFormatJSONL    = "jsonl"
+	exportFormatMarkdown = "md"
+)
+
+var exportFormats = []string{exportFormatJSONL, exportFormatMarkdown}
+
+// exportGroupByDataset is the one ?group_by= value: a zip with a file per dataset.
+const exportGroupByDataset = "dataset"
+
+// handleExportOptions lists the values the export endpoint accepts, from the same lists its
+// validation uses, so clients can build export controls without hardcoding them.
+func (h *Handler) handleExportOptions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"types":   models.ExportTypes,
+		"formats": exportFormats,
+		// Non-jsonl formats fix the type.
+		"format_types": map[string][]string{
+			exportFormatJSONL:    models.ExportTypes,
+			exportFormatMarkdown: {models.ExportTypeConversations},
+		},
+		"dataset_kinds": map[string][]string{
+			models.DatasetKindConversations: models.ConversationExportTypes,
+			models.DatasetKindItems:         models.ItemExportTypes,
+		},
+		"context":            models.ContextModes,
+		"role_styles":        models.RoleStyles,
+		"templates":          models.Templates,
+		"compress":           compressValues,
+		"quality_gates":      models.QualityGates,
+		"group_by":           []string{exportGroupByDataset},
+		"interleave_types":   models.LineExportTypes,
+		"max_chars_types":    models.LineExportTypes,
+		"include_hash_types": models.HashExportTypes,
+		"with_source_types":  models.SourceExportTypes,
+		"on_oversize":        models.OversizeActions,
+		"dedup":              []string{models.DedupSemantic},
+		"dedup_types":        []string{models.ExportTypePairs},
+	})
+}
+
+func (h *Handler) handleExportJSONL(w http.ResponseWriter, r *http.Request) {
+	if !h.exports.begin() {
+		w.Header().Set("Retry-After", "30")
+		writeJSONError(w, http.StatusServiceUnavailable, "server is shutting down")
+		return
+	}
+	defer h.exports.done()
+
 	q := r.URL.Query()
 	outType := strings.TrimSpace(q.Get("type"))
+	markdown := false
+	switch strings.ToLower(strings.TrimSpace(q.Get("format"))) {
+	case "", exportFormatJSONL:
+	case exportFormatMarkdown:
+		// Markdown transcripts render whole conversations.
+		if outType != "" && outType != models.ExportTypeConversations {
+			writeFieldError(w, "format", "format=md is only valid for type=conversations")
+			return
+		}
+		markdown = true
+		outType = models.ExportTypeConversations
+	default:
+		writeFieldError(w, "format", "invalid format (expected "+strings.Join(exportFormats, "|")+")")
+		return
+	}
 	if outType == "" {
-		outType = "pairs"
+		outType = models.ExportTypePairs
 	}
 
 	datasetID := int64(parseIntDefault(q.Get("dataset_id"), 0))
-	split := strings.TrimSpace(q.Get("split"))
-	status := strings.TrimSpace(q.Get("status"))
+	// Omitted split/status fall back to the dataset's defaults once it is loaded below.
+	splitParam := strings.TrimSpace(q.Get("split"))
+	statusParam := strings.TrimSpace(q.Get("status"))
+	split, status := splitParam, statusParam
 	if split == "" {
 		split = string(models.SplitTrain)
 	}
@@ -890,10 +4016,21 @@ func (h *Handler) handleExportJSONL(w http.ResponseWriter, r *http.Request) {
 		status = string(models.ConversationStatusApproved)
 	}
 
-	includeSystem := parseBoolDefault(q.Get("include_system"), false)
+	// A replayed prompt keeps the conversation's system messages unless asked otherwise.
+	includeSystem := parseBoolDefault(q.Get("include_system"), outType == models.ExportTypeOpenAIBatch)
+	contextTokens := parseIntDefault(q.Get("context_tokens"), 0)
+	if contextTokens < 0 {
+		contextTokens = 0
+	}
 	contextMode := strings.TrimSpace(q.Get("context"))
 	if contextMode == "" {
-		contextMode = "none" // none|window|full
+		contextMode = models.ContextNone
+		if contextTokens > 0 {
+			contextMode = models.ContextWindow
+		} else if outType == models.ExportTypeTurns || outType == models.ExportTypeOpenAIBatch {
+			// Prior turns are the point of type=turns, and a replay needs the whole history.
+			contextMode = models.ContextFull
+		}
 	}
 	contextTurns := parseIntDefault(q.Get("context_turns"), 6)
 	if contextTurns < 0 {
@@ -901,34 +4038,286 @@ func (h *Handler) handleExportJSONL(w http.ResponseWriter, r *http.Request) {
 	}
 	roleStyle := strings.TrimSpace(q.Get("role_style"))
 	if roleStyle == "" {
-		roleStyle = "labels" // labels|plain
+		roleStyle = models.RoleStyleLabels
+	}
+	// A custom template runs caller-supplied text/template code over every exported message.
+	if strings.EqualFold(strings.TrimSpace(q.Get("template")), models.TemplateCustom) && !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required for template=custom")
+		return
+	}
+	contextTemplate, err := models.ParseContextTemplate(q.Get("template"), q.Get("template_text"))
+	if err != nil {
+		writeFieldError(w, "template", err.Error())
+		return
 	}
 	maxExamples := parseIntDefault(q.Get("max_examples"), 0)
 	if maxExamples < 0 {
 		maxExamples = 0
 	}
+	compress, ok := normalizeCompress(q.Get("compress"))
+	if !ok {
+		writeFieldError(w, "compress", "invalid compress (expected "+strings.Join(compressValues, "|")+")")
+		return
+	}
+	minAvgRating, ok := parseMinAvgRating(q.Get("min_avg_rating"))
+	if !ok {
+		writeFieldError(w, "min_avg_rating", "invalid min_avg_rating (expected 1-5)")
+		return
+	}
+	var metaGTE []models.MetaThreshold
+	if s := strings.TrimSpace(q.Get("min_quality")); s != "" {
+		t, err := models.NewMetaThreshold("quality", s)
+		if err != nil {
+			writeFieldError(w, "min_quality", "invalid min_quality (expected a number)")
+			return
+		}
+		metaGTE = append(metaGTE, t)
+	}
+	for _, s := range q["meta_gte"] {
+		t, err := models.ParseMetaThreshold(s)
+		if err != nil {
+			writeFieldError(w, "meta_gte", "invalid meta_gte: "+err.Error())
+			return
+		}
+		metaGTE = append(metaGTE, t)
+	}
+	langFilter, ok := lang.Normalize(q.Get("lang"))
+	if !ok {
+		writeFieldError(w, "lang", "invalid lang (expected an ISO 639 code like en)")
+		return
+	}
+	normalize, err := models.ParseNormalizeFlags(q.Get("normalize"))
+	if err != nil {
+		writeFieldError(w, "normalize", err.Error())
+		return
+	}
+	interleave, err := models.ParseInterleave(q.Get("interleave"))
+	if err != nil {
+		writeFieldError(w, "interleave", err.Error())
+		return
+	}
+	if len(interleave) > 0 && splitParam != "" {
+		writeFieldError(w, "interleave", "interleave replaces split; omit split")
+		return
+	}
+	maxChars := 0
+	if v := strings.TrimSpace(q.Get("max_chars")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeFieldError(w, "max_chars", "invalid max_chars (expected a positive integer)")
+			return
+		}
+		maxChars = n
+	}
+	onOversize, err := models.ParseOnOversize(q.Get("on_oversize"))
+	if err != nil {
+		writeFieldError(w, "on_oversize", err.Error())
+		return
+	}
+	qualityGate, err := models.ParseQualityGate(q.Get("quality_gate"))
+	if err != nil {
+		writeFieldError(w, "quality_gate", err.Error())
+		return
+	}
+	stratify, err := models.ParseStratify(q.Get("stratify"))
+	if err != nil {
+		writeFieldError(w, "stratify", err.Error())
+		return
+	}
+	dedup, err := models.ParseDedup(q.Get("dedup"))
+	if err != nil {
+		writeFieldError(w, "dedup", err.Error())
+		return
+	}
+	dedupThreshold, err := models.ParseDedupThreshold(q.Get("dedup_threshold"))
+	if err != nil {
+		writeFieldError(w, "dedup_threshold", err.Error())
+		return
+	}
+	if dedup == "" {
+		dedupThreshold = 0
+	}
+	sampleRate, err := models.ParseSampleRate(q.Get("sample"))
+	if err != nil {
+		writeFieldError(w, "sample", err.Error())
+		return
+	}
+	var sampleSeed int64
+	if v := strings.TrimSpace(q.Get("seed")); v != "" {
+		if sampleRate == 0 {
+			writeFieldError(w, "seed", "seed requires sample")
+			return
+		}
+		sampleSeed, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			writeFieldError(w, "seed", "invalid seed")
+			return
+		}
+	}
+	if !checkAttributionFilters(w, q) {
+		return
+	}
+	withManifest := parseBoolDefault(q.Get("manifest"), false)
+	groupByDataset := false
+	switch strings.TrimSpace(q.Get("group_by")) {
+	case "":
+	case exportGroupByDataset:
+		groupByDataset = true
+	default:
+		writeFieldError(w, "group_by", "invalid group_by (expected dataset)")
+		return
+	}
+	if groupByDataset && compress != compressNone {
+		writeFieldError(w, "compress", "compress cannot be combined with group_by=dataset (the zip is already compressed)")
+		return
+	}
+	stampLicense := parseBoolDefault(q.Get("stamp_license"), false)
+	allowEmpty := parseBoolDefault(q.Get("allow_empty"), false)
+	enforcePurity := parseBoolDefault(q.Get("enforce_split_purity"), false)
+	if withManifest && compress != compressNone {
+		writeFieldError(w, "compress", "compress cannot be combined with manifest=true (the zip is already compressed)")
+		return
+	}
+	if markdown && (compress != compressNone || withManifest || groupByDataset) {
+		writeFieldError(w, "format", "format=md cannot be combined with compress, manifest or group_by (it is already a zip)")
+		return
+	}
 
 	opts := models.ExportOptions{
-		Type:          outType,
-		DatasetID:     datasetID,
-		Split:         split,
-		Status:        status,
-		IncludeSystem: includeSystem,
-		Context:       contextMode,
-		ContextTurns:  contextTurns,
-		RoleStyle:     roleStyle,
-		MaxExamples:   maxExamples,
+		Type:            outType,
+		DatasetID:       datasetID,
+		Split:           split,
+		Status:          status,
+		IncludeSystem:   includeSystem,
+		Context:         contextMode,
+		ContextTurns:    contextTurns,
+		ContextTokens:   contextTokens,
+		RoleStyle:       roleStyle,
+		Template:        strings.TrimSpace(q.Get("template")),
+		TemplateText:    q.Get("template_text"),
+		ContextTemplate: contextTemplate,
+		MaxExamples:     maxExamples,
+		SampleRate:      sampleRate,
+		SampleSeed:      sampleSeed,
+		WithSource:      parseBoolDefault(q.Get("with_source"), false),
+		IncludeHash:     parseBoolDefault(q.Get("include_hash"), false),
+		IncludeMeta:     parseBoolDefault(q.Get("include_meta"), false),
+		IncludeIDs:      parseBoolDefault(q.Get("include_ids"), false),
+		DPOAlternatives: parseBoolDefault(q.Get("dpo_alternatives"), false),
+		MinAvgRating:    minAvgRating,
+		MetaGTE:         metaGTE,
+		Lang:            langFilter,
+		Source:          q.Get("source"),
+		SourcePrefix:    q.Get("source_prefix"),
+		IncludeFlagged:  h.isAdmin(r) && parseBoolDefault(q.Get("include_flagged"), false),
+		Normalize:       normalize,
+		Interleave:      interleave,
+		MaxChars:        maxChars,
+		OnOversize:      onOversize,
+		QualityGate:     qualityGate,
+		Stratify:        stratify,
+		Dedup:           dedup,
+		DedupThreshold:  dedupThreshold,
+		PublicOnly:      !h.isAdmin(r),
+	}
+	batchModel := strings.TrimSpace(q.Get("model"))
+	batchSystemPrompt := strings.TrimSpace(q.Get("system_prompt"))
+	if opts.Type == models.ExportTypeOpenAIBatch {
+		if batchModel == "" && h.llm.Enabled() {
+			batchModel = h.llm.Model
+		}
+		if batchModel == "" {
+			writeFieldError(w, "model", "model is required for type=openai_batch (or configure DATALAB_LLM_MODEL)")
+			return
+		}
+		opts.BatchModel, opts.BatchSystemPrompt = batchModel, batchSystemPrompt
+	} else if batchModel != "" || batchSystemPrompt != "" {
+		writeFieldError(w, "model", "model and system_prompt are only valid for type=openai_batch")
+		return
+	}
+	// Admins may lift the cap by asking for an explicit, larger max_examples.
+	if !h.isAdmin(r) || maxExamples == 0 {
+		opts.RowCap = h.maxExportRows
 	}
 
 	// Validate export mode up-front so we can return a helpful error.
-	if opts.Type == "items" || opts.Type == "items_with_meta" {
+	if !slices.Contains(models.ExportTypes, opts.Type) {
+		writeFieldError(w, "type", "invalid type (expected "+strings.Join(models.ExportTypes, "|")+")")
+		return
+	}
+	if !models.ExportTypeForKind(opts.Type, "conversations") {
 		if opts.DatasetID <= 0 {
-			writeJSONError(w, http.StatusBadRequest, "dataset_id is required for items exports")
+			writeFieldError(w, "dataset_id", "dataset_id is required for items exports")
+			return
+		}
+	}
+	if len(opts.MetaGTE) > 0 && !models.ExportTypeForKind(opts.Type, "conversations") {
+		writeFieldError(w, "meta_gte", "meta_gte and min_quality filter conversations; items exports do not take them")
+		return
+	}
+	if len(opts.MetaGTE) > 0 && opts.Type == models.ExportTypeDPO {
+		writeFieldError(w, "meta_gte", "meta_gte and min_quality filter conversations; stored preference pairs carry no conversation meta, so type="+models.ExportTypeDPO+" does not take them")
+		return
+	}
+	lineTypes := strings.Join(models.LineExportTypes, "|")
+	if len(opts.Interleave) > 0 && !slices.Contains(models.LineExportTypes, opts.Type) {
+		writeFieldError(w, "interleave", "interleave is only valid for type="+lineTypes)
+		return
+	}
+	if opts.MaxChars > 0 && !slices.Contains(models.LineExportTypes, opts.Type) {
+		writeFieldError(w, "max_chars", "max_chars is only valid for type="+lineTypes)
+		return
+	}
+	if opts.IncludeHash && !slices.Contains(models.HashExportTypes, opts.Type) {
+		writeFieldError(w, "include_hash", "include_hash is only valid for type="+strings.Join(models.HashExportTypes, "|"))
+		return
+	}
+	if opts.WithSource && !slices.Contains(models.SourceExportTypes, opts.Type) {
+		writeFieldError(w, "with_source", "with_source is only valid for type="+strings.Join(models.SourceExportTypes, "|"))
+		return
+	}
+	if opts.DPOAlternatives && opts.Type != models.ExportTypeDPO {
+		writeFieldError(w, "dpo_alternatives", "dpo_alternatives is only valid for type="+models.ExportTypeDPO)
+		return
+	}
+	if opts.Dedup != "" && opts.Type != models.ExportTypePairs {
+		writeFieldError(w, "dedup", "dedup is only valid for type="+models.ExportTypePairs)
+		return
+	}
+	if stampLicense && opts.DatasetID <= 0 {
+		writeFieldError(w, "stamp_license", "stamp_license requires dataset_id")
+		return
+	}
+	if groupByDataset && opts.DatasetID > 0 {
+		writeFieldError(w, "group_by", "group_by=dataset exports every dataset; omit dataset_id")
+		return
+	}
+	if enforcePurity && opts.DatasetID <= 0 {
+		writeFieldError(w, "enforce_split_purity", "enforce_split_purity requires dataset_id")
+		return
+	}
+
+	projectID, ok := h.resolveProject(w, r, q.Get("project"))
+	if !ok {
+		return
+	}
+	opts.ProjectID = projectID
+
+	if opts.Dedup != "" {
+		if !h.checkVectorStore(w, r) {
 			return
 		}
+		// Only embeddings by the configured model are comparable with each other; without one,
+		// whatever is stored is used.
+		if h.embedder.Enabled() {
+			opts.DedupModel = h.embedder.Model
+		}
 	}
+
+	datasetName := ""
+	var unlicensed []string
 	if opts.DatasetID > 0 {
-		ds, err := models.GetDataset(r.Context(), h.db, opts.DatasetID)
+		ds, err := h.datasetHead(r.Context(), opts.DatasetID)
 		if err != nil {
 			if errors.Is(err, models.ErrNotFound) {
 				writeJSONError(w, http.StatusNotFound, "dataset not found")
@@ -937,23 +4326,177 @@ func (h *Handler) handleExportJSONL(w http.ResponseWriter, r *http.Request) {
 			writeJSONError(w, http.StatusInternalServerError, "failed to load dataset")
 			return
 		}
+		if !h.canRead(r, ds.Visibility) || (projectID > 0 && ds.ProjectID != projectID) {
+			writeJSONError(w, http.StatusNotFound, "dataset not found")
+			return
+		}
 		isItems := strings.EqualFold(ds.Kind, "items")
 		if isItems {
-			if opts.Type == "conversations" {
-				writeJSONError(w, http.StatusBadRequest, "type=conversations is not valid for items datasets")
+			if !models.ExportTypeForKind(opts.Type, ds.Kind) {
+				writeErrorCode(w, http.StatusBadRequest, codeWrongDatasetKind, fmt.Sprintf("type=%s is not valid for items datasets", opts.Type))
+				return
+			}
+			if len(opts.Interleave) > 0 {
+				writeFieldError(w, "interleave", "interleave is not valid for items datasets")
 				return
 			}
 		} else {
-			if opts.Type == "items" || opts.Type == "items_with_meta" {
-				writeJSONError(w, http.StatusBadRequest, "items export types are only valid for items datasets")
+			if !models.ExportTypeForKind(opts.Type, ds.Kind) {
+				writeErrorCode(w, http.StatusBadRequest, codeWrongDatasetKind, "items export types are only valid for items datasets")
+				return
+			}
+		}
+		datasetName = ds.Name
+		defSplit, defStatus := ds.Defaults()
+		if splitParam == "" {
+			opts.Split = string(defSplit)
+		}
+		if statusParam == "" {
+			opts.Status = string(defStatus)
+		}
+		if enforcePurity && !isItems {
+			collisions, err := models.CheckSplitPurity(r.Context(), h.db, ds.ID, opts.Status)
+			if err != nil {
+				writeJSONError(w, http.StatusInternalServerError, "failed to check splits")
+				return
+			}
+			if len(collisions) > 0 {
+				body := errorBody(w, apiError{
+					Code:    codeSplitPurity,
+					Message: fmt.Sprintf("split purity check failed: %d collisions between train and valid/test", len(collisions)),
+				})
+				body["collisions"] = collisions
+				writeJSON(w, http.StatusConflict, body)
 				return
 			}
 		}
+		if ds.License == "" {
+			unlicensed = []string{ds.Name}
+		} else if stampLicense {
+			opts.StampLicense = ds.License
+		}
+	} else {
+		names, err := models.ListUnlicensedDatasetNames(r.Context(), h.db, opts)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to check dataset licenses")
+			return
+		}
+		unlicensed = names
+	}
+
+	warning, blocked := licenseGate(h.requireLicense, unlicensed)
+	if blocked {
+		writeJSONError(w, http.StatusConflict, warning)
+		return
+	}
+	if warning != "" {
+		w.Header().Set("X-Export-Warning", warning)
+	}
+
+	ext := exportExtension(compress)
+	if withManifest || groupByDataset {
+		ext = ".zip"
+	}
+	if markdown {
+		ext = ".md.zip"
+	}
+	filenameSplit := opts.Split
+	if len(opts.Interleave) > 0 {
+		filenameSplit = "interleaved"
+	}
+	filename := exportFilename(datasetName, opts.Type, filenameSplit, time.Now(), ext)
+	if raw := q.Get("filename"); raw != "" {
+		if f := sanitizeFilename(raw); f != "" {
+			filename = f
+		}
+	}
+
+	// An export matching nothing is 204 rather than an empty attachment, unless asked for.
+	if !allowEmpty {
+		hasRows, err := models.ExportHasRows(r.Context(), h.db, opts)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to check export")
+			return
+		}
+		if !hasRows {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	if groupByDataset {
+		datasets, err := models.ListConversationDatasets(r.Context(), h.db, opts.PublicOnly, opts.ProjectID)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "failed to list datasets")
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", contentDisposition(filename))
+		// As with manifest=true, a failure mid-stream leaves a visibly corrupt zip.
+		_ = models.StreamGroupedExport(r.Context(), h.db, w, opts, groupedExportFiles(datasets))
+		return
+	}
+
+	if markdown {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", contentDisposition(filename))
+		// As with manifest=true, a failure mid-stream leaves a visibly corrupt zip.
+		_ = models.StreamMarkdownTranscripts(r.Context(), h.db, w, opts)
+		return
+	}
+
+	if withManifest {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", contentDisposition(filename))
+		// A failure mid-stream leaves the archive without its central directory, so clients
+		// see a corrupt zip rather than silently incomplete data.
+		_ = models.StreamExportWithManifest(r.Context(), h.db, w, opts)
+		return
+	}
+
+	// Dedup counters and whether the row cap cut the export short are only known once it
+	// has streamed, so they are sent as trailers.
+	var trailers []string
+	if opts.Dedup != "" {
+		opts.DedupStats = &models.DedupStats{Mode: opts.Dedup, Threshold: opts.DedupThreshold}
+		trailers = append(trailers, "X-Export-Dedup-Skipped", "X-Export-Dedup-Hash-Skipped")
+	}
+	var truncated bool
+	if _, capped := opts.EffectiveMaxExamples(); capped {
+		opts.Truncated = &truncated
+		trailers = append(trailers, "X-Export-Truncated")
+	}
+	if len(trailers) > 0 {
+		w.Header().Set("Trailer", strings.Join(trailers, ","))
+	}
+
+	out, err := newCompressWriter(w, compress)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to init compression")
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/x-ndjson")
-	w.Header().Set("Content-Disposition", "attachment; filename=caiatech-datalab.jsonl")
-	if err := models.StreamExport(r.Context(), h.db, w, opts); err != nil {
+	w.Header().Set("Content-Disposition", contentDisposition(filename))
+	if compress != compressNone {
+		w.Header().Set("Content-Encoding", compress)
+	}
+	err = models.StreamExport(r.Context(), h.db, out, opts)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if st := opts.DedupStats; st != nil {
+		w.Header().Set("X-Export-Dedup-Skipped", strconv.FormatInt(st.SemanticSkipped, 10))
+		w.Header().Set("X-Export-Dedup-Hash-Skipped", strconv.FormatInt(st.HashSkipped, 10))
+	}
+	if opts.Truncated != nil {
+		w.Header().Set("X-Export-Truncated", strconv.FormatBool(truncated))
+	}
+	if err != nil {
+		if compress != compressNone {
+			// The body is a compressed stream; a plain JSON error would only corrupt it further.
+			return
+		}
 		// Headers are already set; return a JSON error body anyway for easier debugging in-browser.
 		writeJSONError(w, http.StatusInternalServerError, "export failed")
 		return
@@ -964,11 +4507,155 @@ func (h *Handler) handleExportJSONL(w http.ResponseWriter, r *http.Request) {
 // Helpers
 // ----------------------------
 
+// isAdmin checks the admin token in h.authHeader; Authorization takes it as a Bearer token.
 func (h *Handler) isAdmin(r *http.Request) bool {
 	if h.adminToken == "" {
 		return false
 	}
-	return r.Header.Get("X-Admin-Token") == h.adminToken
+	token := r.Header.Get(h.authHeader)
+	if h.authHeader == "Authorization" {
+		scheme, rest, ok := strings.Cut(token, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return false
+		}
+		token = strings.TrimSpace(rest)
+	}
+	return token == h.adminToken
+}
+
+// idempotencyKey returns the request's Idempotency-Key, "" when absent. A key that is too
+// long is a 400 and ok is false.
+func idempotencyKey(w http.ResponseWriter, r *http.Request) (key string, ok bool) {
+	key = strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	if len(key) > 255 {
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidIdemKey, "Idempotency-Key too long (max 255)")
+		return "", false
+	}
+	return key, true
+}
+
+// reserveIdempotent reserves key for this request in tx, the transaction that creates the
+// resource (see models.ReserveIdempotencyKey); an empty key reserves nothing. It returns false
+// once it has written a response: the stored one for a repeated request, 422 for a key reused
+// with a different body.
+func (h *Handler) reserveIdempotent(w http.ResponseWriter, r *http.Request, tx *sql.Tx, scope string, key string, body []byte) bool {
+	if key == "" {
+		return true
+	}
+	prev, err := models.ReserveIdempotencyKey(r.Context(), tx, scope, key, models.RequestHash(body))
+	switch {
+	case errors.Is(err, models.ErrIdempotencyKeyReused):
+		writeErrorCode(w, http.StatusUnprocessableEntity, codeIdemKeyReused, "Idempotency-Key was already used with a different request body")
+		return false
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, "failed to check idempotency key")
+		return false
+	case prev != nil:
+		w.Header().Set("Idempotent-Replayed", "true")
+		writeIdempotentJSON(w, scope, prev.ResourceID, prev.StatusCode, prev.Body)
+		return false
+	}
+	return true
+}
+
+// completeIdempotent encodes v as the response body and, when key is set, stores it for
+// replays in tx, before the transaction commits.
+func completeIdempotent(ctx context.Context, tx *sql.Tx, scope string, key string, resourceID int64, code int, v any) ([]byte, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	body = append(body, '\n')
+	if key == "" {
+		return body, nil
+	}
+	err = models.CompleteIdempotencyKey(ctx, tx, scope, key, models.IdempotentResponse{
+		ResourceID: resourceID,
+		StatusCode: code,
+		Body:       body,
+	})
+	return body, err
+}
+
+// writeIdempotentJSON writes a response body from completeIdempotent or a stored replay.
+// scope doubles as the resource name for the Location header of a 201.
+func writeIdempotentJSON(w http.ResponseWriter, scope string, resourceID int64, code int, body []byte) {
+	if code == http.StatusCreated {
+		w.Header().Set("Location", resourcePath(scope, resourceID))
+	}
+	writeRawJSON(w, code, body)
+}
+
+// licenseGate decides whether an export touching unlicensed datasets proceeds with a warning
+// or is blocked (when the instance requires licenses).
+func licenseGate(requireLicense bool, unlicensed []string) (warning string, blocked bool) {
+	if len(unlicensed) == 0 {
+		return "", false
+	}
+	const maxNames = 5
+	names := unlicensed
+	if len(names) > maxNames {
+		names = names[:maxNames]
+	}
+	warning = "dataset has no license: " + strings.Join(names, ", ")
+	if len(unlicensed) > maxNames {
+		warning += fmt.Sprintf(" (+%d more)", len(unlicensed)-maxNames)
+	}
+	return warning, requireLicense
+}
+
+// canRead reports whether the caller may read a dataset with the given visibility.
+func (h *Handler) canRead(r *http.Request, visibility string) bool {
+	return visibility != models.DatasetVisibilityPrivate || h.isAdmin(r)
+}
+
+// checkDatasetReadable writes a 404 (private datasets are indistinguishable from missing ones
+// to non-admins) or 500 and returns false when the caller may not read datasetID.
+func (h *Handler) checkDatasetReadable(w http.ResponseWriter, r *http.Request, datasetID int64) bool {
+	_, ok := h.readableDataset(w, r, datasetID)
+	return ok
+}
+
+// readableDataset is checkDatasetReadable returning the (cached) dataset head.
+func (h *Handler) readableDataset(w http.ResponseWriter, r *http.Request, datasetID int64) (models.Dataset, bool) {
+	ds, err := h.datasetHead(r.Context(), datasetID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "not found")
+			return models.Dataset{}, false
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to get dataset")
+		return models.Dataset{}, false
+	}
+	if !h.canRead(r, ds.Visibility) {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return models.Dataset{}, false
+	}
+	return ds, true
+}
+
+// parseIDList parses a comma-separated list of positive ids such as "1,2,3", dropping
+// duplicates. It must hold between 1 and max ids.
+func parseIDList(s string, max int) ([]int64, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, errors.New("ids required (e.g. ids=1,2,3)")
+	}
+	var ids []int64
+	seen := map[int64]bool{}
+	for _, part := range strings.Split(s, ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid id %q", strings.TrimSpace(part))
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > max {
+		return nil, fmt.Errorf("at most %d ids", max)
+	}
+	return ids, nil
 }
 
 func parseIntDefault(s string, fallback int) int {
@@ -996,6 +4683,82 @@ func parseBoolDefault(s string, fallback bool) bool {
 	return fallback
 }
 
+// parseOptionalBool parses a yes/no filter in the words parseBoolDefault accepts; "" means
+// unset (nil).
+func parseOptionalBool(s string) (*bool, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, true
+	}
+	v := parseBoolDefault(s, false)
+	if v != parseBoolDefault(s, true) {
+		return nil, false
+	}
+	return &v, true
+}
+
+// checkAttributionFilters rejects the reviewer filters decided_by and created_by: conversations
+// carry no attribution columns yet, so they cannot be honored and must not be ignored.
+func checkAttributionFilters(w http.ResponseWriter, q url.Values) bool {
+	for _, field := range []string{"decided_by", "created_by"} {
+		if q.Get(field) != "" {
+			writeFieldError(w, field, field+" requires reviewer attribution, which is not enabled on this server")
+			return false
+		}
+	}
+	return true
+}
+
+// parseMinAvgRating parses a min_avg_rating filter; "" means no filter (0).
+func parseMinAvgRating(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, true
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < models.MinRatingScore || v > models.MaxRatingScore {
+		return 0, false
+	}
+	return v, true
+}
+
+// parseTimeBound parses an optional time filter, an RFC 3339 time or a YYYY-MM-DD date (UTC);
+// "" is the zero time. A date is its start, or with end its last instant.
+func parseTimeBound(s string, end bool) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, true
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, true
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if end {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, true
+}
+
+// parseAge parses a positive age as a whole number of days ("30d") or a Go duration ("12h").
+func parseAge(s string) (time.Duration, bool) {
+	s = strings.TrimSpace(s)
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, false
+		}
+		return time.Duration(n) * 24 * time.Hour, true
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	return d, true
+}
+
 func parsePathInt64(r *http.Request, param string) (int64, error) {
 	v := r.PathValue(param)
 	if v == "" {
@@ -1016,6 +4779,14 @@ func writeJSON(w http.ResponseWriter, code int, v any) {
 	_ = json.NewEncoder(w).Encode(v)
 }
 
-func writeJSONError(w http.ResponseWriter, code int, msg string) {
-	writeJSON(w, code, map[string]any{"error": msg})
+// resourcePath is the API path of one entity, e.g. /api/v1/datasets/7.
+func resourcePath(resource string, id int64) string {
+	return "/api/v1/" + resource + "/" + strconv.FormatInt(id, 10)
+}
+
+func writeRawJSON(w http.ResponseWriter, code int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, _ = w.Write(body)
 }
+
@@ -0,0 +1,1830 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"caiatech-datalab/backend/internal/llm"
+	"caiatech-datalab/backend/internal/models"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestLicenseGate_WarnsWhenNotRequired(t *testing.T) {
+	warning, blocked := licenseGate(false, []string{"support-bot"})
+	if blocked {
+		t.Fatalf("expected export to proceed")
+	}
+	if warning != "dataset has no license: support-bot" {
+		t.Fatalf("unexpected warning: %q", warning)
+	}
+}
+
+func TestLicenseGate_BlocksWhenRequired(t *testing.T) {
+	names := []string{"a", "b", "c", "d", "e", "f", "g"}
+	warning, blocked := licenseGate(true, names)
+	if !blocked {
+		t.Fatalf("expected export to be blocked")
+	}
+	if !strings.HasSuffix(warning, "(+2 more)") {
+		t.Fatalf("unexpected warning: %q", warning)
+	}
+}
+
+func TestLicenseGate_LicensedPassesSilently(t *testing.T) {
+	warning, blocked := licenseGate(true, nil)
+	if blocked || warning != "" {
+		t.Fatalf("expected no warning and no block, got %q blocked=%v", warning, blocked)
+	}
+}
+
+func TestParseMinAvgRating(t *testing.T) {
+	if v, ok := parseMinAvgRating(""); !ok || v != 0 {
+		t.Fatalf("empty should mean no filter, got %v %v", v, ok)
+	}
+	if v, ok := parseMinAvgRating("4.5"); !ok || v != 4.5 {
+		t.Fatalf("expected 4.5, got %v %v", v, ok)
+	}
+	for _, bad := range []string{"0", "6", "abc"} {
+		if _, ok := parseMinAvgRating(bad); ok {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestParseIDList(t *testing.T) {
+	ids, err := parseIDList(" 3,1, 3 ,2", 200)
+	if err != nil || !reflect.DeepEqual(ids, []int64{3, 1, 2}) {
+		t.Fatalf("expected [3 1 2], got %v %v", ids, err)
+	}
+	for _, bad := range []string{"", "1,,2", "0", "-4", "a"} {
+		if _, err := parseIDList(bad, 200); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+	if _, err := parseIDList("1,2,3", 2); err == nil {
+		t.Fatal("expected the cap to be enforced")
+	}
+}
+
+func TestGetConversations_RejectsBadIDs(t *testing.T) {
+	h := NewHandler(HandlerDeps{})
+	tooMany := make([]string, maxBatchGetIDs+1)
+	for i := range tooMany {
+		tooMany[i] = strconv.Itoa(i + 1)
+	}
+	for _, q := range []string{"", "?ids=", "?ids=1,x", "?ids=" + strings.Join(tooMany, ",")} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/conversations"+q, nil)
+		rec := httptest.NewRecorder()
+		h.Routes().ServeHTTP(rec, req)
+		assertErrorCode(t, rec, http.StatusBadRequest, "invalid_ids")
+	}
+}
+
+func TestUpsertRating_Validation(t *testing.T) {
+	h := NewHandler(HandlerDeps{AdminToken: "secret"})
+	routes := h.Routes()
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/conversations/1/ratings", strings.NewReader(`{"rater":"alice","score":4}`))
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assertErrorCode(t, rec, http.StatusUnauthorized, codeUnauthorized)
+
+	for _, body := range []string{`{"rater":"alice","score":9}`, `{"rater":"","score":3}`} {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/conversations/1/ratings", strings.NewReader(body))
+		req.Header.Set("X-Admin-Token", "secret")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		assertErrorCode(t, rec, http.StatusBadRequest, codeInvalidInput)
+	}
+}
+
+func TestUpsertRating_SameRaterUpdates(t *testing.T) {
+	// rater -> score, standing in for conversation_ratings' unique (conversation_id, rater).
+	stored := map[string]int64{}
+	db := newFakeDB(t, func(query string, args []any) fakeResult {
+		t.Logf("Q %q %v", query, args)
+		switch {
+		case strings.HasPrefix(query, "SELECT dataset_id FROM conversations"):
+			return fakeResult{cols: []string{"dataset_id"}, rows: [][]any{{int64(3)}}}
+		case strings.Contains(query, "FROM datasets"):
+			return fakeResult{} // no dataset head: the lock check passes
+		case strings.HasPrefix(query, "INSERT INTO conversation_ratings"):
+			if !strings.Contains(query, "ON CONFLICT (conversation_id, rater) DO UPDATE") {
+				t.Fatalf("a repeated rater must update in place: %s", query)
+			}
+			rater, score := args[1].(string), args[2].(int64)
+			_, existed := stored[rater]
+			stored[rater] = score
+			now := time.Now()
+			return fakeResult{
+				cols: []string{"conversation_id", "rater", "score", "note", "created_at", "updated_at", "created"},
+				rows: [][]any{{args[0], rater, score, args[3], now, now, !existed}},
+			}
+		}
+		t.Fatalf("unexpected query: %s", query)
+		return fakeResult{}
+	})
+	routes := NewHandler(HandlerDeps{DB: db, AdminToken: "secret"}).Routes()
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/conversations/7/ratings", strings.NewReader(body))
+		req.Header.Set("X-Admin-Token", "secret")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		return rec
+	}
+	first := put(`{"rater":"alice","score":3}`)
+	if first.Code != http.StatusCreated || first.Header().Get("Location") != "/api/v1/conversations/7/ratings" {
+		t.Fatalf("first rating: expected 201 with Location, got %d %q", first.Code, first.Header().Get("Location"))
+	}
+	second := put(`{"rater":"alice","score":5,"note":"better on reread"}`)
+	if second.Code != http.StatusOK || second.Header().Get("Location") != "" {
+		t.Fatalf("second rating by the same rater: expected 200 without Location, got %d %s", second.Code, second.Body.String())
+	}
+	var got models.Rating
+	if err := json.Unmarshal(second.Body.Bytes(), &got); err != nil || got.Score != 5 || got.Note != "better on reread" {
+		t.Fatalf("expected the updated rating, got %+v %v", got, err)
+	}
+	if len(stored) != 1 || stored["alice"] != 5 {
+		t.Fatalf("expected one rating for alice with score 5, got %v", stored)
+	}
+	if third := put(`{"rater":"bob","score":4}`); third.Code != http.StatusCreated || len(stored) != 2 {
+		t.Fatalf("another rater adds a rating: got %d, %v", third.Code, stored)
+	}
+}
+
+func TestAdminAuthHeader(t *testing.T) {
+	cases := []struct {
+		name       string
+		authHeader string
+		header     string
+		value      string
+		want       int
+	}{
+		{"default header", "", "X-Admin-Token", "secret", http.StatusBadRequest},
+		{"default ignores bearer", "", "Authorization", "Bearer secret", http.StatusUnauthorized},
+		{"custom header", "x-datalab-key", "X-Datalab-Key", "secret", http.StatusBadRequest},
+		{"custom ignores default", "X-Datalab-Key", "X-Admin-Token", "secret", http.StatusUnauthorized},
+		{"bearer", "Authorization", "Authorization", "Bearer secret", http.StatusBadRequest},
+		{"bearer any case", "authorization", "Authorization", "bearer secret", http.StatusBadRequest},
+		{"bearer missing prefix", "Authorization", "Authorization", "secret", http.StatusUnauthorized},
+		{"bearer wrong token", "Authorization", "Authorization", "Bearer nope", http.StatusUnauthorized},
+		{"basic scheme", "Authorization", "Authorization", "Basic secret", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			routes := NewHandler(HandlerDeps{AdminToken: "secret", AuthHeader: tc.authHeader}).Routes()
+			req := httptest.NewRequest(http.MethodPut, "/api/v1/conversations/1/ratings", strings.NewReader(`{"rater":"alice","score":9}`))
+			req.Header.Set(tc.header, tc.value)
+			rec := httptest.NewRecorder()
+			routes.ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tc.want, rec.Body.String())
+			}
+		})
+	}
+
+	routes := NewHandler(HandlerDeps{AdminToken: "secret", AuthHeader: "authorization"}).Routes()
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/conversations/1/ratings", strings.NewReader(`{}`))
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Access-Control-Allow-Headers"); !strings.Contains(got, ",Authorization,") || strings.Contains(got, "X-Admin-Token") {
+		t.Fatalf("Access-Control-Allow-Headers = %q", got)
+	}
+}
+
+func TestCreateConversation_RejectsBadMeta(t *testing.T) {
+	h := NewHandler(HandlerDeps{AdminToken: "secret", MaxMessageMetaBytes: 32})
+	routes := h.Routes()
+
+	cases := map[string]string{
+		"non-object": `{"dataset_id":1,"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"hello","meta":[1]}]}`,
+		"oversized":  `{"dataset_id":1,"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"hello","meta":{"blob":"` + strings.Repeat("x", 40) + `"}}]}`,
+	}
+	for name, body := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/conversations", strings.NewReader(body))
+		req.Header.Set("X-Admin-Token", "secret")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		e := assertErrorCode(t, rec, http.StatusUnprocessableEntity, codeInvalidMeta)
+		if e.Index == nil || *e.Index != 1 || e.Field != "messages" {
+			t.Fatalf("%s: expected offending messages index 1 in %s", name, rec.Body.String())
+		}
+	}
+}
+
+func TestConversationWrites_EnforceMessageLimits(t *testing.T) {
+	h := NewHandler(HandlerDeps{AdminToken: "secret", MaxMessages: 2, MaxMessageContentBytes: 8})
+	routes := h.Routes()
+
+	cases := []struct {
+		path, body, code string
+		index            int
+	}{
+		{"/api/v1/conversations", `{"dataset_id":1,"messages":[{"role":"user","content":"a"},{"role":"assistant","content":"b"},{"role":"user","content":"c"}]}`, codeTooManyMessages, -1},
+		{"/api/v1/conversations", `{"dataset_id":1,"messages":[{"role":"user","content":"a"},{"role":"assistant","content":"123456789"}]}`, codeContentTooLarge, 1},
+		{"/api/v1/proposals", `{"dataset_id":1,"system":"s","user":"u","assistant":"a"}`, codeTooManyMessages, -1},
+		{"/api/v1/proposals", `{"dataset_id":1,"user":"123456789","assistant":"a"}`, codeContentTooLarge, 0},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, c.path, strings.NewReader(c.body))
+		req.Header.Set("X-Admin-Token", "secret")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		e := assertErrorCode(t, rec, http.StatusUnprocessableEntity, c.code)
+		if (c.index < 0) != (e.Index == nil) || (e.Index != nil && *e.Index != c.index) {
+			t.Fatalf("%s %s: expected index %d in %s", c.path, c.body, c.index, rec.Body.String())
+		}
+	}
+
+	// Exactly at both limits passes validation.
+	req := upsertConversationRequest{DatasetID: 1, Messages: []models.Message{{Role: models.RoleUser, Content: "12345678"}, {Role: models.RoleAssistant, Content: "b"}}}
+	if _, err := normalizeConversationUpsert(req, nil, h.limits); err != nil {
+		t.Fatalf("at the limits: expected ok, got %v", err)
+	}
+}
+
+func TestCreateConversation_ReportsEveryField(t *testing.T) {
+	h := NewHandler(HandlerDeps{AdminToken: "secret"})
+	routes := h.Routes()
+
+	body := `{"split":"dev","lang":"klingon","meta":["hard"],"messages":[{"role":"bot","content":"hi"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/conversations", strings.NewReader(body))
+	req.Header.Set("X-Admin-Token", "secret")
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	e := assertErrorCode(t, rec, http.StatusBadRequest, "invalid_split")
+	for _, f := range []string{"split", "dataset_id", "lang", "meta", "messages"} {
+		if e.Fields[f] == "" {
+			t.Fatalf("expected %s in fields, got %+v", f, e.Fields)
+		}
+	}
+
+	// A proposal with only a banned phrase keeps its own code.
+	h = NewHandler(HandlerDeps{BannedPhrases: []string{"as an ai"}})
+	body = `{"dataset_id":1,"user":"hi","assistant":"As an AI, no."}`
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/proposals", strings.NewReader(body))
+	rec = httptest.NewRecorder()
+	h.Routes().ServeHTTP(rec, req)
+	if e := assertErrorCode(t, rec, http.StatusBadRequest, codeBannedPhrase); e.Fields != nil {
+		t.Fatalf("a single non-field error has no fields: %+v", e)
+	}
+}
+
+func TestNormalizeConversationPatch_OnlyPresentFields(t *testing.T) {
+	var req upsertConversationRequest
+	if err := json.Unmarshal([]byte(`{"notes":"  reviewed  "}`), &req); err != nil {
+		t.Fatal(err)
+	}
+	p, err := normalizeConversationPatch(req, models.Conversation{}, nil, models.MessageLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Notes == nil || *p.Notes != "reviewed" {
+		t.Fatalf("expected trimmed notes, got %v", p.Notes)
+	}
+	if p.Messages != nil || p.Tags != nil || p.Split != nil || p.Status != nil || p.Source != nil || p.Lang != nil || p.Meta != nil || p.DatasetID != 0 {
+		t.Fatalf("absent fields must stay unset: %+v", p)
+	}
+
+	// Meta must be an object; null clears it.
+	req = upsertConversationRequest{Meta: json.RawMessage(`[1]`)}
+	var fe *fieldError
+	if _, err := normalizeConversationPatch(req, models.Conversation{}, nil, models.MessageLimits{}); !errors.As(err, &fe) || fe.Field != "meta" {
+		t.Fatalf("expected invalid_meta, got %v", err)
+	}
+	req = upsertConversationRequest{Meta: json.RawMessage(`null`)}
+	if p, err := normalizeConversationPatch(req, models.Conversation{}, nil, models.MessageLimits{}); err != nil || p.Meta == nil {
+		t.Fatalf("expected null meta to be kept as a clear, got %v / %v", p.Meta, err)
+	}
+
+	// An explicit empty list is a wipe, which is still rejected.
+	req = upsertConversationRequest{Messages: []models.Message{}}
+	if _, err := normalizeConversationPatch(req, models.Conversation{}, nil, models.MessageLimits{}); err == nil {
+		t.Fatal("expected empty messages to be rejected")
+	}
+
+	// Replacing messages without a status checks content against the stored status.
+	req = upsertConversationRequest{Messages: []models.Message{{Role: models.RoleUser, Content: " "}}}
+	if _, err := normalizeConversationPatch(req, models.Conversation{Status: models.ConversationStatusDraft}, nil, models.MessageLimits{}); err != nil {
+		t.Fatalf("drafts may hold empty content: %v", err)
+	}
+	req = upsertConversationRequest{Messages: []models.Message{{Role: models.RoleUser, Content: " "}}}
+	if _, err := normalizeConversationPatch(req, models.Conversation{Status: models.ConversationStatusApproved}, nil, models.MessageLimits{}); err == nil {
+		t.Fatal("expected empty content to be rejected for approved conversations")
+	}
+
+	// Approving without new messages checks the stored ones.
+	approved := "approved"
+	draft := models.Conversation{Status: models.ConversationStatusDraft, Messages: []models.Message{{Role: models.RoleUser, Content: "hi"}, {Role: models.RoleAssistant, Content: ""}}}
+	req = upsertConversationRequest{Status: &approved}
+	if _, err := normalizeConversationPatch(req, draft, nil, models.MessageLimits{}); !errors.As(err, &fe) || fe.Field != "messages" {
+		t.Fatalf("expected the stored empty message to block approval, got %v", err)
+	}
+	draft.Messages[1].Content = "hello, contact me at spam.example"
+	banned := models.NewPhraseFilter([]string{"spam.example"})
+	if _, err := normalizeConversationPatch(req, draft, banned, models.MessageLimits{}); !errors.As(err, &fe) || fe.Code != codeBannedPhrase {
+		t.Fatalf("expected a stored banned phrase to block approval, got %v", err)
+	}
+	var le *models.LimitError
+	if _, err := normalizeConversationPatch(req, draft, nil, models.MessageLimits{MaxMessages: 1}); !errors.As(err, &le) {
+		t.Fatalf("expected the message limit to block approval, got %v", err)
+	}
+	rejected := "rejected"
+	req = upsertConversationRequest{Status: &rejected}
+	if _, err := normalizeConversationPatch(req, draft, banned, models.MessageLimits{}); err != nil {
+		t.Fatalf("rejecting must not re-check the stored messages: %v", err)
+	}
+}
+
+func TestExport_RejectsBadTemplate(t *testing.T) {
+	routes := NewHandler(HandlerDeps{AdminToken: "secret"}).Routes()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/export.jsonl?context=full&template=custom&template_text=%7B%7B.Role", nil)
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assertErrorCode(t, rec, http.StatusUnauthorized, codeUnauthorized)
+
+	req.Header.Set("X-Admin-Token", "secret")
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	e := assertErrorCode(t, rec, http.StatusBadRequest, "invalid_template")
+	if e.Field != "template" || !strings.Contains(e.Message, "custom:1") {
+		t.Fatalf("expected the template field and position, got %+v", e)
+	}
+}
+
+func TestExport_InterleaveValidation(t *testing.T) {
+	h := NewHandler(HandlerDeps{})
+	for _, q := range []string{
+		"interleave=train:0",
+		"interleave=train:9,valid:1&split=train",
+		"interleave=train:9,valid:1&type=pairs_grouped",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/export.jsonl?"+q, nil)
+		rec := httptest.NewRecorder()
+		h.Routes().ServeHTTP(rec, req)
+		assertErrorCode(t, rec, http.StatusBadRequest, "invalid_interleave")
+	}
+}
+
+func TestExport_MaxCharsValidation(t *testing.T) {
+	h := NewHandler(HandlerDeps{})
+	for q, code := range map[string]string{
+		"max_chars=0":                      "invalid_max_chars",
+		"max_chars=abc":                    "invalid_max_chars",
+		"max_chars=100&type=pairs_grouped": "invalid_max_chars",
+		"max_chars=100&on_oversize=cut":    "invalid_on_oversize",
+		"quality_gate=hard":                "invalid_quality_gate",
+		"stratify=random":                  "invalid_stratify",
+		"format=html":                      "invalid_format",
+		"format=md&type=pairs":             "invalid_format",
+		"format=md&manifest=true":          "invalid_format",
+		"format=md&compress=gzip":          "invalid_format",
+		"manifest=true&compress=gzip":      "invalid_compress",
+		"sample=0":                         "invalid_sample",
+		"sample=1.5":                       "invalid_sample",
+		"sample=abc":                       "invalid_sample",
+		"seed=7":                           "invalid_seed",
+		"sample=0.1&seed=x":                "invalid_seed",
+		"dedup=fuzzy":                      "invalid_dedup",
+		"dedup=semantic&type=completions":  "invalid_dedup",
+		"dedup=semantic&dedup_threshold=0": "invalid_dedup_threshold",
+		"dedup_threshold=1.5":              "invalid_dedup_threshold",
+		"type=openai_batch":                "invalid_model",
+		"model=gpt-x":                      "invalid_model",
+		"dpo_alternatives=true":            "invalid_dpo_alternatives",
+		"include_hash=true&type=dpo":       "invalid_include_hash",
+		"include_hash=true&type=openai_batch&model=gpt-x": "invalid_include_hash",
+		"with_source=true&type=pairs_grouped":             "invalid_with_source",
+		"with_source=true&type=openai_batch&model=gpt-x":  "invalid_with_source",
+		"min_quality=high":                                "invalid_min_quality",
+		"meta_gte=quality":                                "invalid_meta_gte",
+		"meta_gte=a%20b:1":                                "invalid_meta_gte",
+		"type=dpo&min_quality=0.5":                        "invalid_meta_gte",
+		"type=dpo&meta_gte=quality:0.5":                   "invalid_meta_gte",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/export.jsonl?"+q, nil)
+		rec := httptest.NewRecorder()
+		h.Routes().ServeHTTP(rec, req)
+		assertErrorCode(t, rec, http.StatusBadRequest, code)
+	}
+}
+
+func TestExport_MetaGTERejectedForItems(t *testing.T) {
+	h := NewHandler(HandlerDeps{})
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/export.jsonl?type=items&dataset_id=1&min_quality=0.5", nil)
+	rec := httptest.NewRecorder()
+	h.Routes().ServeHTTP(rec, req)
+	assertErrorCode(t, rec, http.StatusBadRequest, "invalid_meta_gte")
+}
+
+func TestExport_CapSentAsTrailer(t *testing.T) {
+	db := newFakeDB(t, func(query string, args []any) fakeResult {
+		if strings.HasPrefix(query, "SELECT id, split, status") {
+			return fakeResult{cols: []string{"id", "split", "status", "tags", "source", "notes", "meta"}, rows: [][]any{
+				{int64(1), "train", "approved", []byte(`[]`), "", "", []byte(`{}`)},
+				{int64(2), "train", "approved", []byte(`[]`), "", "", []byte(`{}`)},
+			}}
+		}
+		return fakeResult{}
+	})
+	for cap, want := range map[int]string{1: "true", 5: "false"} {
+		h := NewHandler(HandlerDeps{DB: db, MaxExportRows: cap})
+		rec := httptest.NewRecorder()
+		h.Routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/export.jsonl?type=conversations&allow_empty=true", nil))
+		res := rec.Result()
+		// Declared up front and filled in once the rows are written, so nothing is buffered.
+		if res.StatusCode != http.StatusOK || !strings.Contains(rec.Header().Get("Trailer"), "X-Export-Truncated") {
+			t.Fatalf("cap %d: expected the trailer to be declared, got %d %v", cap, res.StatusCode, rec.Header())
+		}
+		if got := res.Trailer.Get("X-Export-Truncated"); got != want {
+			t.Fatalf("cap %d: expected X-Export-Truncated %s, got %q", cap, want, got)
+		}
+		if lines := strings.Count(rec.Body.String(), "\n"); lines != min(cap, 2) {
+			t.Fatalf("cap %d: expected %d lines, got %d", cap, min(cap, 2), lines)
+		}
+	}
+}
+
+func TestListSources_RejectsBadID(t *testing.T) {
+	h := NewHandler(HandlerDeps{})
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/datasets/abc/sources", nil)
+	rec := httptest.NewRecorder()
+	h.Routes().ServeHTTP(rec, req)
+	assertErrorCode(t, rec, http.StatusBadRequest, "invalid_id")
+}
+
+func TestImportRuns_Validation(t *testing.T) {
+	h := NewHandler(HandlerDeps{AdminToken: "secret"})
+	cases := []struct {
+		method, path string
+		admin        bool
+		status       int
+		code         string
+	}{
+		{http.MethodGet, "/api/v1/import-runs", false, http.StatusBadRequest, "invalid_dataset_id"},
+		{http.MethodPost, "/api/v1/import-runs/1/rollback", false, http.StatusUnauthorized, "unauthorized"},
+		{http.MethodPost, "/api/v1/import-runs/abc/rollback", true, http.StatusBadRequest, "invalid_id"},
+		{http.MethodPost, "/api/v1/import-runs/1/rollback?action=purge", true, http.StatusBadRequest, "invalid_action"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, nil)
+		if c.admin {
+			req.Header.Set("X-Admin-Token", "secret")
+		}
+		rec := httptest.NewRecorder()
+		h.Routes().ServeHTTP(rec, req)
+		assertErrorCode(t, rec, c.status, c.code)
+	}
+}
+
+func TestAttributionFilters_NotEnabled(t *testing.T) {
+	h := NewHandler(HandlerDeps{})
+	for path, code := range map[string]string{
+		"/api/v1/export.jsonl?decided_by=alice": "invalid_decided_by",
+		"/api/v1/export.jsonl?created_by=bob":   "invalid_created_by",
+	} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		h.Routes().ServeHTTP(rec, req)
+		assertErrorCode(t, rec, http.StatusBadRequest, code)
+	}
+}
+
+func TestItemSchema_RejectsBadSample(t *testing.T) {
+	h := NewHandler(HandlerDeps{})
+	for _, sample := range []string{"-1", "100001"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/datasets/1/items/schema?sample="+sample, nil)
+		rec := httptest.NewRecorder()
+		h.Routes().ServeHTTP(rec, req)
+		assertErrorCode(t, rec, http.StatusBadRequest, "invalid_sample")
+	}
+}
+
+func TestListDatasetItems_RejectsBadKeyFilter(t *testing.T) {
+	h := NewHandler(HandlerDeps{})
+	for query, code := range map[string]string{
+		"key=a-b&value=x":       "invalid_key",
+		"key=1st&value=x":       "invalid_key",
+		"value=x":               "invalid_value",
+		"key_exists=data->>'x'": "invalid_key_exists",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/datasets/1/items?"+strings.ReplaceAll(query, ">", "%3E"), nil)
+		rec := httptest.NewRecorder()
+		h.Routes().ServeHTTP(rec, req)
+		assertErrorCode(t, rec, http.StatusBadRequest, code)
+	}
+}
+
+func TestListDatasetItems_KeyValueUsesContainment(t *testing.T) {
+	var filtered bool
+	db := newFakeDB(t, func(query string, args []any) fakeResult {
+		if strings.Contains(query, "FROM dataset_items") {
+			if strings.Contains(query, "data->>") || !strings.Contains(query, "dataset_items.data @> jsonb_build_object($") {
+				t.Fatalf("expected an indexable containment filter: %s", query)
+			}
+			if !reflect.DeepEqual(args[1:3], []any{"category", "billing"}) {
+				t.Fatalf("expected key and value as arguments, got %v", args)
+			}
+			filtered = true
+		}
+		return fakeResult{}
+	})
+	h := NewHandler(HandlerDeps{DB: db, DatasetCacheTTL: time.Hour})
+	h.datasets.entries[3] = datasetCacheEntry{ds: models.Dataset{ID: 3, Kind: "items", Visibility: "public"}, expires: time.Now().Add(time.Hour)}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/datasets/3/items?key=category&value=billing", nil)
+	rec := httptest.NewRecorder()
+	h.Routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !filtered {
+		t.Fatalf("expected 200 from the filtered list, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestMove_Validation(t *testing.T) {
+	h := NewHandler(HandlerDeps{AdminToken: "secret"})
+	routes := h.Routes()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/conversations/1/move", strings.NewReader(`{"dataset_id":2}`))
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assertErrorCode(t, rec, http.StatusUnauthorized, codeUnauthorized)
+
+	for _, path := range []string{"/api/v1/conversations/1/move", "/api/v1/items/1/move"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{}`))
+		req.Header.Set("X-Admin-Token", "secret")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		assertErrorCode(t, rec, http.StatusBadRequest, "invalid_dataset_id")
+	}
+}
+
+func TestProjects_Validation(t *testing.T) {
+	routes := NewHandler(HandlerDeps{AdminToken: "secret"}).Routes()
+
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodPost, "/api/v1/projects"},
+		{http.MethodPatch, "/api/v1/projects/team-a"},
+		{http.MethodDelete, "/api/v1/projects/team-a"},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(`{"slug":"team-a"}`))
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		assertErrorCode(t, rec, http.StatusUnauthorized, codeUnauthorized)
+	}
+
+	cases := []struct {
+		method, path, body string
+		admin              bool
+		code               string
+	}{
+		{http.MethodPost, "/api/v1/projects", `{"slug":"Team A"}`, true, "invalid_slug"},
+		{http.MethodPost, "/api/v1/projects", `{"slug":""}`, true, "invalid_slug"},
+		{http.MethodPost, "/api/v1/projects", `{"id":1}`, true, codeInvalidJSON},
+		{http.MethodPatch, "/api/v1/projects/team-a", `{"slug":"team-b","name":"B"}`, true, "invalid_slug"},
+		{http.MethodPatch, "/api/v1/projects/team-a", `{"name":" "}`, true, "invalid_name"},
+		{http.MethodDelete, "/api/v1/projects/Team_A", ``, true, "invalid_slug"},
+		{http.MethodGet, "/api/v1/projects/Team_A", ``, false, "invalid_slug"},
+		{http.MethodGet, "/api/v1/projects/Team_A/datasets", ``, false, "invalid_slug"},
+		{http.MethodGet, "/api/v1/datasets?project=Team_A", ``, false, "invalid_project"},
+		{http.MethodGet, "/api/v1/export.jsonl?project=-x", ``, false, "invalid_project"},
+		{http.MethodPost, "/api/v1/datasets", `{"name":"x","project":"Team A"}`, true, "invalid_project"},
+		{http.MethodPatch, "/api/v1/datasets/1", `{"project":"Team A"}`, true, "invalid_project"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		if tc.admin {
+			req.Header.Set("X-Admin-Token", "secret")
+		}
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		assertErrorCode(t, rec, http.StatusBadRequest, tc.code)
+	}
+}
+
+func TestDuplicateConversation_ApprovedChecksMessages(t *testing.T) {
+	reply := "As an AI, I cannot help."
+	var inserted int
+	now := time.Now()
+	db := newFakeDB(t, func(query string, args []any) fakeResult {
+		t.Logf("Q %q %v", query, args)
+		switch {
+		case strings.HasPrefix(query, "SELECT dataset_id FROM conversations"):
+			return fakeResult{cols: []string{"dataset_id"}, rows: [][]any{{int64(3)}}}
+		case strings.Contains(query, "SELECT c.dataset_id, c.split, c.tags, c.notes, c.lang, c.meta"):
+			return fakeResult{cols: []string{"dataset_id", "split", "tags", "notes", "lang", "meta"}, rows: [][]any{{int64(3), "train", []byte(`[]`), "", "", []byte(`{}`)}}}
+		case strings.Contains(query, "FROM conversation_messages"):
+			return fakeResult{cols: []string{"id", "role", "name", "content", "meta"}, rows: [][]any{{int64(70), "user", "", "hi", []byte(`{}`)}, {int64(71), "assistant", "", reply, []byte(`{}`)}}}
+		case strings.HasPrefix(query, "SELECT name, kind FROM datasets"):
+			return fakeResult{cols: []string{"name", "kind"}, rows: [][]any{{"chats", "conversations"}}}
+		case strings.Contains(query, "INSERT INTO conversations"):
+			inserted++
+			return fakeResult{
+				cols: []string{"id", "dataset_id", "split", "status", "tags", "source", "notes", "lang", "meta", "created_at", "updated_at", "import_run_id"},
+				rows: [][]any{{int64(42), int64(3), "train", "approved", []byte(`[]`), "duplicate-of:7", "", "", []byte(`{}`), now, now, nil}},
+			}
+		case strings.Contains(query, "INSERT INTO conversation_messages"), strings.Contains(query, "INSERT INTO audit_log"):
+			return fakeResult{affected: 1}
+		case strings.Contains(query, "FROM conversations c\nJOIN datasets d ON d.id = c.dataset_id"):
+			return conversationRowResult(models.Conversation{ID: 42, DatasetID: 3, Split: models.SplitTrain, Status: models.ConversationStatusApproved, Source: "duplicate-of:7", CreatedAt: now, UpdatedAt: now, DatasetName: "chats", DatasetKind: "conversations"})
+		case strings.Contains(query, "FROM datasets"):
+			return fakeResult{}
+		}
+		t.Fatalf("unexpected query: %s", query)
+		return fakeResult{}
+	})
+	routes := NewHandler(HandlerDeps{DB: db, AdminToken: "secret", BannedPhrases: []string{"as an ai"}}).Routes()
+	duplicate := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/conversations/7/duplicate", strings.NewReader(body))
+		req.Header.Set("X-Admin-Token", "secret")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assertErrorCode(t, duplicate(`{"status":"approved"}`), http.StatusBadRequest, codeBannedPhrase)
+	if inserted != 0 {
+		t.Fatalf("expected no copy of a banned reply as approved")
+	}
+
+	reply = "Sure, here it is."
+	rec := duplicate(`{"status":"approved"}`)
+	if rec.Code != http.StatusCreated || rec.Header().Get("Location") != "/api/v1/conversations/42" || inserted != 1 {
+		t.Fatalf("expected 201 with the copy's Location, got %d %q %s", rec.Code, rec.Header().Get("Location"), rec.Body.String())
+	}
+}
+
+func TestDuplicateConversation_Validation(t *testing.T) {
+	h := NewHandler(HandlerDeps{AdminToken: "secret"})
+	routes := h.Routes()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/conversations/1/duplicate", strings.NewReader(`{}`))
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assertErrorCode(t, rec, http.StatusUnauthorized, codeUnauthorized)
+
+	cases := []struct {
+		path, body, code string
+	}{
+		{"/api/v1/conversations/x/duplicate", `{}`, "invalid_id"},
+		{"/api/v1/conversations/1/duplicate", `{"title":"x"}`, codeInvalidJSON},
+		{"/api/v1/conversations/1/duplicate", `{"dataset_id":-1}`, "invalid_dataset_id"},
+		{"/api/v1/conversations/1/duplicate", `{"split":"holdout"}`, "invalid_split"},
+		{"/api/v1/conversations/1/duplicate", `{"status":"done"}`, "invalid_status"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+		req.Header.Set("X-Admin-Token", "secret")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		assertErrorCode(t, rec, http.StatusBadRequest, tc.code)
+	}
+}
+
+func TestFlags_Validation(t *testing.T) {
+	h := NewHandler(HandlerDeps{AdminToken: "secret"})
+	routes := h.Routes()
+
+	for _, path := range []string{"/api/v1/conversations/1/flag", "/api/v1/proposals/1/flag", "/api/v1/flags/1/resolve"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{}`))
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		assertErrorCode(t, rec, http.StatusUnauthorized, codeUnauthorized)
+	}
+
+	cases := []struct {
+		method, path, body, code string
+	}{
+		{http.MethodPost, "/api/v1/conversations/x/flag", `{"category":"pii"}`, "invalid_id"},
+		{http.MethodPost, "/api/v1/conversations/1/flag", `{"category":"spam"}`, "invalid_category"},
+		{http.MethodPost, "/api/v1/proposals/1/flag", `{"category":"pii","reason":"x"}`, codeInvalidJSON},
+		{http.MethodPost, "/api/v1/flags/1/resolve", `{"resolution":"ok"}`, "invalid_resolver"},
+		{http.MethodPost, "/api/v1/flags/1/resolve", `{"resolver":"alice"}`, "invalid_resolution"},
+		{http.MethodGet, "/api/v1/flags?status=closed", "", "invalid_status"},
+		{http.MethodGet, "/api/v1/conversations/1/flags?category=spam", "", "invalid_category"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		req.Header.Set("X-Admin-Token", "secret")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		assertErrorCode(t, rec, http.StatusBadRequest, tc.code)
+	}
+}
+
+func TestGetMessage(t *testing.T) {
+	now := time.Now()
+	db := newFakeDB(t, func(query string, args []any) fakeResult {
+		t.Logf("Q %q %v", query, args)
+		switch {
+		case strings.Contains(query, "FROM conversations c"):
+			return conversationRowResult(models.Conversation{ID: 7, DatasetID: 3, Split: models.SplitTrain, Status: models.ConversationStatusApproved, CreatedAt: now, UpdatedAt: now, MessagesUpdatedAt: &now, DatasetName: "support-bot", DatasetKind: "conversations"})
+		case strings.Contains(query, "FROM conversation_messages"):
+			return fakeResult{
+				cols: []string{"id", "role", "name", "content", "meta"},
+				rows: [][]any{{int64(70), "user", "", "hi", []byte(`{}`)}, {int64(71), "assistant", "", "hello", []byte(`{}`)}},
+			}
+		}
+		t.Fatalf("unexpected query: %s", query)
+		return fakeResult{}
+	})
+	h := NewHandler(HandlerDeps{DB: db, DatasetCacheTTL: time.Hour})
+	h.datasets.entries[3] = datasetCacheEntry{ds: models.Dataset{ID: 3, Visibility: "public"}, expires: time.Now().Add(time.Hour)}
+	routes := h.Routes()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	rec := get("/api/v1/conversations/7/messages/1")
+	var m models.Message
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &m) != nil || m.Role != models.RoleAssistant || m.Content != "hello" {
+		t.Fatalf("expected the assistant message, got %d %s", rec.Code, rec.Body.String())
+	}
+	assertErrorCode(t, get("/api/v1/conversations/7/messages/2"), http.StatusNotFound, codeNotFound)
+	assertErrorCode(t, get("/api/v1/conversations/7/messages/-1"), http.StatusBadRequest, "invalid_idx")
+}
+
+func TestUpdateMessage_Validation(t *testing.T) {
+	h := NewHandler(HandlerDeps{AdminToken: "secret", BannedPhrases: []string{"as an ai"}, MaxMessageContentBytes: 8, MaxMessageMetaBytes: 16})
+	routes := h.Routes()
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/v1/conversations/1/messages/0", strings.NewReader(`{"content":"x"}`))
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assertErrorCode(t, rec, http.StatusUnauthorized, codeUnauthorized)
+
+	cases := []struct {
+		path, body string
+		status     int
+		code       string
+	}{
+		{"/api/v1/conversations/x/messages/0", `{"content":"x"}`, http.StatusBadRequest, "invalid_id"},
+		{"/api/v1/conversations/1/messages/-1", `{"content":"x"}`, http.StatusBadRequest, "invalid_idx"},
+		{"/api/v1/conversations/1/messages/a", `{"content":"x"}`, http.StatusBadRequest, "invalid_idx"},
+		{"/api/v1/conversations/1/messages/0", `{"text":"x"}`, http.StatusBadRequest, codeInvalidJSON},
+		{"/api/v1/conversations/1/messages/0", `{"content":"As an AI"}`, http.StatusBadRequest, codeBannedPhrase},
+		{"/api/v1/conversations/1/messages/2", `{"content":"123456789"}`, http.StatusUnprocessableEntity, codeContentTooLarge},
+		{"/api/v1/conversations/1/messages/2", `{"meta":[1]}`, http.StatusUnprocessableEntity, codeInvalidMeta},
+		{"/api/v1/conversations/1/messages/2", `{"meta":{"blob":"` + strings.Repeat("x", 20) + `"}}`, http.StatusUnprocessableEntity, codeInvalidMeta},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPatch, tc.path, strings.NewReader(tc.body))
+		req.Header.Set("X-Admin-Token", "secret")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		e := assertErrorCode(t, rec, tc.status, tc.code)
+		if tc.status == http.StatusUnprocessableEntity && (e.Index == nil || *e.Index != 2) {
+			t.Fatalf("%s: expected the message index in %s", tc.body, rec.Body.String())
+		}
+	}
+}
+
+func TestRegenerate_Validation(t *testing.T) {
+	routes := NewHandler(HandlerDeps{AdminToken: "secret"}).Routes()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/conversations/1/regenerate?message_idx=2", nil)
+	req.Header.Set("X-Admin-Token", "secret")
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assertErrorCode(t, rec, http.StatusServiceUnavailable, codeLLMDisabled)
+
+	routes = NewHandler(HandlerDeps{AdminToken: "secret", LLM: llm.New("http://llm.invalid/v1", "", "m", time.Second)}).Routes()
+	cases := []struct {
+		path, body, code string
+	}{
+		{"/api/v1/conversations/1/regenerate", "", "invalid_message_idx"},
+		{"/api/v1/conversations/1/regenerate?message_idx=-1", "", "invalid_message_idx"},
+		{"/api/v1/conversations/x/regenerate?message_idx=1", "", "invalid_id"},
+		{"/api/v1/conversations/1/accept-alternative", `{}`, "invalid_alternative_id"},
+		{"/api/v1/conversations/1/accept-alternative", `{"id":1}`, codeInvalidJSON},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+		req.Header.Set("X-Admin-Token", "secret")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		assertErrorCode(t, rec, http.StatusBadRequest, tc.code)
+	}
+}
+
+func TestAlternatives_Validation(t *testing.T) {
+	routes := NewHandler(HandlerDeps{AdminToken: "secret"}).Routes()
+	cases := []struct {
+		method, path, body string
+		admin              bool
+		status             int
+		code               string
+	}{
+		{http.MethodGet, "/api/v1/conversations/1?expand=revisions", "", false, http.StatusBadRequest, "invalid_expand"},
+		{http.MethodGet, "/api/v1/conversations/1?expand=alternatives", "", false, http.StatusUnauthorized, "unauthorized"},
+		{http.MethodPost, "/api/v1/conversations/1/alternatives", `{"message_idx":2,"content":"x"}`, false, http.StatusUnauthorized, "unauthorized"},
+		{http.MethodPost, "/api/v1/conversations/1/alternatives", `{"content":"x"}`, true, http.StatusBadRequest, "invalid_message_idx"},
+		{http.MethodPost, "/api/v1/conversations/1/alternatives", `{"message_idx":2,"content":"  "}`, true, http.StatusBadRequest, "invalid_content"},
+		{http.MethodPost, "/api/v1/conversations/1/alternatives", `{"message_idx":2,"content":"x","meta":[1]}`, true, http.StatusUnprocessableEntity, "invalid_meta"},
+		{http.MethodPost, "/api/v1/conversations/1/alternatives", `{"message_idx":2,"text":"x"}`, true, http.StatusBadRequest, codeInvalidJSON},
+		{http.MethodPost, "/api/v1/conversations/1/alternatives/x/promote", "", true, http.StatusBadRequest, "invalid_alt_id"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		if tc.admin {
+			req.Header.Set("X-Admin-Token", "secret")
+		}
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		assertErrorCode(t, rec, tc.status, tc.code)
+	}
+}
+
+func TestWriteUpstreamError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set(requestIDHeader, "req-1")
+	writeUpstreamError(rec, &llm.UpstreamError{StatusCode: 429, Body: "slow down"})
+	e := assertErrorCode(t, rec, http.StatusBadGateway, codeUpstreamError)
+	if !strings.Contains(e.Message, "429") || !strings.Contains(e.Message, "slow down") {
+		t.Fatalf("expected the upstream status and body in %q", e.Message)
+	}
+
+	rec = httptest.NewRecorder()
+	rec.Header().Set(requestIDHeader, "req-1")
+	writeUpstreamError(rec, fmt.Errorf("post: %w", context.DeadlineExceeded))
+	assertErrorCode(t, rec, http.StatusGatewayTimeout, codeUpstreamTimeout)
+}
+
+func TestExportOptions(t *testing.T) {
+	routes := NewHandler(HandlerDeps{}).Routes()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/export/options", nil)
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (%s)", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		Types        []string            `json:"types"`
+		Formats      []string            `json:"formats"`
+		FormatTypes  map[string][]string `json:"format_types"`
+		DatasetKinds map[string][]string `json:"dataset_kinds"`
+		Compress     []string            `json:"compress"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(body.Types, models.ExportTypes) || !reflect.DeepEqual(body.Formats, exportFormats) {
+		t.Fatalf("unexpected types/formats: %+v", body)
+	}
+	if !reflect.DeepEqual(body.FormatTypes["md"], []string{"conversations"}) || !reflect.DeepEqual(body.DatasetKinds["items"], models.ItemExportTypes) {
+		t.Fatalf("unexpected format or kind types: %+v", body)
+	}
+	if !reflect.DeepEqual(body.Compress, []string{"none", "gzip", "zstd"}) {
+		t.Fatalf("unexpected compress values: %v", body.Compress)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/export.jsonl?type=csv", nil)
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	e := assertErrorCode(t, rec, http.StatusBadRequest, "invalid_type")
+	if !strings.Contains(e.Message, strings.Join(body.Types, "|")) {
+		t.Fatalf("expected the advertised types in %q", e.Message)
+	}
+}
+
+func TestPurgeProposals_Validation(t *testing.T) {
+	routes := NewHandler(HandlerDeps{AdminToken: "secret"}).Routes()
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/proposals?status=rejected&older_than=30d", nil)
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assertErrorCode(t, rec, http.StatusUnauthorized, codeUnauthorized)
+
+	for query, code := range map[string]string{
+		"older_than=30d":                  "invalid_status",
+		"status=pending&older_than=30d":   "invalid_status",
+		"status=rejected":                 "invalid_older_than",
+		"status=rejected&older_than=0d":   "invalid_older_than",
+		"status=approved&older_than=soon": "invalid_older_than",
+	} {
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/proposals?"+query, nil)
+		req.Header.Set("X-Admin-Token", "secret")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		assertErrorCode(t, rec, http.StatusBadRequest, code)
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	for s, want := range map[string]time.Duration{"30d": 30 * 24 * time.Hour, " 12h ": 12 * time.Hour, "90m": 90 * time.Minute} {
+		if got, ok := parseAge(s); !ok || got != want {
+			t.Fatalf("parseAge(%q) = %v %v, want %v", s, got, ok, want)
+		}
+	}
+	for _, s := range []string{"", "d", "-1d", "0", "1.5d", "-2h"} {
+		if _, ok := parseAge(s); ok {
+			t.Fatalf("parseAge(%q): expected invalid", s)
+		}
+	}
+}
+
+func TestParseTimeBound(t *testing.T) {
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	if got, ok := parseTimeBound("2026-03-01", false); !ok || !got.Equal(day) {
+		t.Fatalf("from date: got %v %v", got, ok)
+	}
+	if got, ok := parseTimeBound("2026-03-01", true); !ok || !got.Equal(day.Add(24*time.Hour-time.Nanosecond)) {
+		t.Fatalf("to date: got %v %v", got, ok)
+	}
+	if got, ok := parseTimeBound("2026-03-01T12:00:00+02:00", true); !ok || !got.Equal(day.Add(10*time.Hour)) {
+		t.Fatalf("time: got %v %v", got, ok)
+	}
+	if got, ok := parseTimeBound(" ", false); !ok || !got.IsZero() {
+		t.Fatalf("empty: got %v %v", got, ok)
+	}
+	if _, ok := parseTimeBound("March 1", false); ok {
+		t.Fatal("expected an invalid bound")
+	}
+}
+
+func TestStatsHistory_Validation(t *testing.T) {
+	h := NewHandler(HandlerDeps{AdminToken: "secret"})
+	cases := []struct {
+		method, path string
+		status       int
+		code         string
+	}{
+		{http.MethodPost, "/api/v1/datasets/1/stats/snapshot", http.StatusUnauthorized, "unauthorized"},
+		{http.MethodGet, "/api/v1/datasets/abc/stats/history", http.StatusBadRequest, "invalid_id"},
+		{http.MethodGet, "/api/v1/datasets/1/stats/history?from=yesterday", http.StatusBadRequest, "invalid_from"},
+		{http.MethodGet, "/api/v1/datasets/1/stats/history?to=2026-13-01", http.StatusBadRequest, "invalid_to"},
+		{http.MethodGet, "/api/v1/datasets/1/stats/history?from=2026-03-02&to=2026-03-01", http.StatusBadRequest, "invalid_from"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, nil)
+		rec := httptest.NewRecorder()
+		h.Routes().ServeHTTP(rec, req)
+		assertErrorCode(t, rec, c.status, c.code)
+	}
+}
+
+func TestParseOptionalBool(t *testing.T) {
+	if v, ok := parseOptionalBool(""); !ok || v != nil {
+		t.Fatalf("empty: got %v %v", v, ok)
+	}
+	if v, ok := parseOptionalBool("yes"); !ok || v == nil || !*v {
+		t.Fatalf("yes: got %v %v", v, ok)
+	}
+	if v, ok := parseOptionalBool("0"); !ok || v == nil || *v {
+		t.Fatalf("0: got %v %v", v, ok)
+	}
+	if _, ok := parseOptionalBool("maybe"); ok {
+		t.Fatal("maybe: expected invalid")
+	}
+}
+
+func TestReindex_Validation(t *testing.T) {
+	h := NewHandler(HandlerDeps{AdminToken: "secret"})
+	routes := h.Routes()
+
+	for _, path := range []string{"/api/v1/conversations/1/reindex", "/api/v1/datasets/1/reindex"} {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		assertErrorCode(t, rec, http.StatusUnauthorized, codeUnauthorized)
+	}
+
+	for _, path := range []string{"/api/v1/conversations/x/reindex", "/api/v1/datasets/x/reindex"} {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("X-Admin-Token", "secret")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		assertErrorCode(t, rec, http.StatusBadRequest, "invalid_id")
+	}
+}
+
+func TestSplitByTag_Validation(t *testing.T) {
+	h := NewHandler(HandlerDeps{AdminToken: "secret"})
+	routes := h.Routes()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/datasets/1/split-by-tag", strings.NewReader(`{"test":["holdout"]}`))
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assertErrorCode(t, rec, http.StatusUnauthorized, codeUnauthorized)
+
+	for body, code := range map[string]string{
+		`{"train":["x"]}`:           codeInvalidJSON,
+		`{}`:                        codeInvalidInput,
+		`{"test":[" "],"valid":[]}`: codeInvalidInput,
+		`{"test":["holdout"],"valid":["holdout"]}`: codeInvalidInput,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/datasets/1/split-by-tag", strings.NewReader(body))
+		req.Header.Set("X-Admin-Token", "secret")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		assertErrorCode(t, rec, http.StatusBadRequest, code)
+	}
+}
+
+func TestPlanDatasetDeletion(t *testing.T) {
+	report := models.DatasetDeletionReport{DatasetID: 7, Name: "support-bot", ConversationCount: 1200}
+
+	if action, _, _ := planDatasetDeletion(report, "", true); action != deletionReportOnly {
+		t.Fatalf("missing confirm should only report, got %v", action)
+	}
+	for _, confirm := range []string{"support", "Support-Bot", "support-bot "} {
+		action, status, _ := planDatasetDeletion(report, confirm, true)
+		if action != deletionRefused || status != http.StatusBadRequest {
+			t.Fatalf("confirm=%q: expected 400 refusal, got %v %d", confirm, action, status)
+		}
+	}
+	if action, _, _ := planDatasetDeletion(report, "support-bot", false); action != deletionSoft {
+		t.Fatalf("expected soft delete by default, got %v", action)
+	}
+	if action, _, _ := planDatasetDeletion(report, "support-bot", true); action != deletionHard {
+		t.Fatalf("expected hard delete, got %v", action)
+	}
+
+	trashed := time.Now()
+	report.DeletedAt = &trashed
+	if action, status, _ := planDatasetDeletion(report, "support-bot", false); action != deletionRefused || status != http.StatusConflict {
+		t.Fatalf("soft-deleting twice should conflict, got %v %d", action, status)
+	}
+	if action, _, _ := planDatasetDeletion(report, "support-bot", true); action != deletionHard {
+		t.Fatalf("a soft-deleted dataset can still be hard-deleted, got %v", action)
+	}
+}
+
+func TestDeleteDataset_RequiresAdmin(t *testing.T) {
+	h := NewHandler(HandlerDeps{AdminToken: "secret"})
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/datasets/1?confirm=x&hard=true", nil)
+	rec := httptest.NewRecorder()
+	h.Routes().ServeHTTP(rec, req)
+	assertErrorCode(t, rec, http.StatusUnauthorized, codeUnauthorized)
+}
+
+func TestDeleteDataset_HardDelete(t *testing.T) {
+	var statements []string
+	db := newFakeDB(t, func(query string, args []any) fakeResult {
+		switch {
+		case strings.Contains(query, "FROM proposals p"):
+			return fakeResult{
+				cols: []string{"name", "deleted_at", "conversations", "items", "proposals", "pending"},
+				rows: [][]any{{"support-bot", nil, int64(1200), int64(0), int64(3), int64(1)}},
+			}
+		case strings.HasPrefix(query, "DELETE FROM datasets"):
+			statements = append(statements, "delete")
+			return fakeResult{cols: []string{"name"}, rows: [][]any{{"support-bot"}}}
+		case strings.Contains(query, "FROM datasets"):
+			return fakeResult{} // no dataset head: the lock check passes
+		case strings.HasPrefix(query, "INSERT INTO audit_log"):
+			statements = append(statements, fmt.Sprintf("audit %v %v %v %s", args[0], args[1], args[2], args[3]))
+			return fakeResult{affected: 1}
+		}
+		t.Fatalf("unexpected query: %s", query)
+		return fakeResult{}
+	})
+	routes := NewHandler(HandlerDeps{DB: db, AdminToken: "secret"}).Routes()
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/datasets/7?confirm=support-bot&hard=true", nil)
+	req.Header.Set("X-Admin-Token", "secret")
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		Deleted, Hard bool
+		Removed       models.DatasetDeletionReport
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if !body.Deleted || !body.Hard || body.Removed.ConversationCount != 1200 || body.Removed.ProposalCount != 3 {
+		t.Fatalf("expected the hard delete to report what it removed, got %+v", body)
+	}
+	// Conversations, messages and items go with the datasets row by ON DELETE CASCADE (see
+	// TestMigrations_DatasetRowsCascade), so one DELETE plus its audit entry is the whole job.
+	want := []string{"delete", `audit dataset 7 delete {"name":"support-bot"}`}
+	if !reflect.DeepEqual(statements, want) {
+		t.Fatalf("unexpected statements:\n got %q\nwant %q", statements, want)
+	}
+}
+
+// assertErrorCode checks rec is an error envelope with status and code and returns it.
+func assertErrorCode(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) apiError {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("expected %d, got %d (%s)", status, rec.Code, rec.Body.String())
+	}
+	var body struct {
+		Error apiError `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("error body is not an envelope: %v (%s)", err, rec.Body.String())
+	}
+	if body.Error.Code != code {
+		t.Fatalf("expected code %q, got %q (%s)", code, body.Error.Code, rec.Body.String())
+	}
+	if body.Error.RequestID == "" || body.Error.RequestID != rec.Header().Get(requestIDHeader) {
+		t.Fatalf("expected request_id to match the %s header, got %+v", requestIDHeader, body.Error)
+	}
+	return body.Error
+}
+
+func TestLockDataset_Validation(t *testing.T) {
+	h := NewHandler(HandlerDeps{AdminToken: "secret"})
+	routes := h.Routes()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/datasets/1/lock", strings.NewReader(`{"locked_by":"run-1"}`))
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assertErrorCode(t, rec, http.StatusUnauthorized, codeUnauthorized)
+
+	for body, code := range map[string]string{
+		`{"locked_by":" "}`:                 "invalid_locked_by",
+		`{"locked_by":"run-1","ttl":"x"}`:   "invalid_ttl",
+		`{"locked_by":"run-1","ttl":"-1h"}`: "invalid_ttl",
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/datasets/1/lock", strings.NewReader(body))
+		req.Header.Set("X-Admin-Token", "secret")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		assertErrorCode(t, rec, http.StatusBadRequest, code)
+	}
+}
+
+func TestListImportRuns(t *testing.T) {
+	started := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	db := newFakeDB(t, func(query string, args []any) fakeResult {
+		if !strings.Contains(query, "FROM import_runs") {
+			t.Fatalf("unexpected query: %s", query)
+		}
+		if args[0] != int64(3) || args[1] != int64(200) || args[2] != int64(0) {
+			t.Fatalf("expected dataset 3 with limit and offset clamped to 200 and 0, got %v", args)
+		}
+		return fakeResult{
+			cols: []string{"id", "dataset_id", "input", "mode", "imported", "bad", "flags", "started_at", "finished_at", "rolled_back_at"},
+			rows: [][]any{{int64(9), int64(3), "chats.jsonl", "conversations", int64(40), int64(2), []byte(`{"into":"conversations"}`), started, nil, nil}},
+		}
+	})
+	h := NewHandler(HandlerDeps{DB: db, DatasetCacheTTL: time.Hour})
+	h.datasets.entries[3] = datasetCacheEntry{ds: models.Dataset{ID: 3, Visibility: "public"}, expires: time.Now().Add(time.Hour)}
+	routes := h.Routes()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/datasets/x/imports", nil)
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assertErrorCode(t, rec, http.StatusBadRequest, "invalid_id")
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/datasets/3/imports?limit=500&offset=-4", nil)
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		Imports []models.ImportRun `json:"imports"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	want := models.ImportRun{ID: 9, DatasetID: 3, Input: "chats.jsonl", Mode: "conversations", Imported: 40, Bad: 2, Flags: map[string]string{"into": "conversations"}, StartedAt: started}
+	if len(body.Imports) != 1 || !reflect.DeepEqual(body.Imports[0], want) {
+		t.Fatalf("unexpected runs: %+v", body.Imports)
+	}
+}
+
+func TestRollbackImportRun_ModifiedRowsConflict(t *testing.T) {
+	var deleted, audited int
+	db := newFakeDB(t, func(query string, args []any) fakeResult {
+		switch {
+		case strings.HasPrefix(query, "SELECT mode, rolled_back_at FROM import_runs"):
+			return fakeResult{cols: []string{"mode", "rolled_back_at"}, rows: [][]any{{"conversations", nil}}}
+		case strings.Contains(query, "FROM import_runs"):
+			return fakeResult{
+				cols: []string{"id", "dataset_id", "input", "mode", "imported", "bad", "flags", "started_at", "finished_at", "rolled_back_at"},
+				rows: [][]any{{int64(9), int64(3), "chats.jsonl", "conversations", int64(40), int64(0), []byte(`{}`), time.Now(), nil, nil}},
+			}
+		case strings.Contains(query, "FILTER (WHERE updated_at > created_at) FROM conversations"):
+			return fakeResult{cols: []string{"count"}, rows: [][]any{{int64(2)}}}
+		case strings.HasPrefix(query, "DELETE FROM conversations WHERE import_run_id"):
+			deleted++
+			return fakeResult{affected: 40}
+		case strings.HasPrefix(query, "UPDATE import_runs SET rolled_back_at"):
+			return fakeResult{affected: 1}
+		case strings.Contains(query, "INSERT INTO audit_log"):
+			audited++
+			return fakeResult{affected: 1}
+		case strings.Contains(query, "FROM datasets"):
+			return fakeResult{} // no dataset head: the lock check passes
+		}
+		t.Fatalf("unexpected query: %s", query)
+		return fakeResult{}
+	})
+	routes := NewHandler(HandlerDeps{DB: db, AdminToken: "secret"}).Routes()
+	rollback := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/import-runs/9/rollback"+query, nil)
+		req.Header.Set("X-Admin-Token", "secret")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := rollback("")
+	assertErrorCode(t, rec, http.StatusConflict, codeConflict)
+	if !strings.Contains(rec.Body.String(), `"modified":2`) || deleted != 0 || audited != 0 {
+		t.Fatalf("expected a 409 reporting 2 modified rows and nothing deleted, got %s (deleted %d)", rec.Body.String(), deleted)
+	}
+
+	rec = rollback("?force=true")
+	var res models.ImportRollback
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &res) != nil {
+		t.Fatalf("expected force to roll back, got %d %s", rec.Code, rec.Body.String())
+	}
+	if res.Rows != 40 || res.Modified != 2 || deleted != 1 || audited != 1 {
+		t.Fatalf("expected 40 rows deleted with 2 modified and one audit entry, got %+v (audited %d)", res, audited)
+	}
+}
+
+func TestDatasetRename_ShowsOnConversationsAndItems(t *testing.T) {
+	name := "support-v1"
+	now := time.Now()
+	db := newFakeDB(t, func(query string, args []any) fakeResult {
+		switch {
+		case strings.HasPrefix(strings.TrimSpace(query), "UPDATE datasets"):
+			name = args[1].(string)
+			return fakeResult{affected: 1}
+		case strings.Contains(query, "FROM datasets d\nWHERE d.id = $1"):
+			return datasetDetailRowResult(models.Dataset{ID: 3, Name: name, Kind: "conversations", Visibility: "public", DefaultSplit: "train", DefaultStatus: "draft",
+				ItemCount: 1, ConversationCount: 1, TrainCount: 1, CreatedAt: now, UpdatedAt: now})
+		case strings.Contains(query, "FROM datasets\nWHERE id = $1"):
+			return datasetRowResult(models.Dataset{ID: 3, Name: name, Kind: "conversations", Visibility: "public", DefaultSplit: "train", DefaultStatus: "draft", CreatedAt: now, UpdatedAt: now})
+		case strings.Contains(query, "FROM conversations c\nJOIN datasets d ON d.id = c.dataset_id"):
+			return conversationRowResult(models.Conversation{ID: 7, DatasetID: 3, Split: models.SplitTrain, Status: models.ConversationStatusDraft, CreatedAt: now, UpdatedAt: now, DatasetName: name, DatasetKind: "conversations"})
+		case strings.Contains(query, "FROM dataset_items JOIN datasets d ON d.id = dataset_items.dataset_id"):
+			return fakeResult{
+				cols: []string{"id", "dataset_id", "data", "source_ref", "created_at", "updated_at", "name", "kind", "import_run_id"},
+				rows: [][]any{{int64(8), int64(3), []byte(`{"q":"x"}`), "", now, now, name, "items", nil}},
+			}
+		case strings.Contains(query, "FROM conversation_messages"), strings.Contains(query, "FROM message_alternatives"), strings.Contains(query, "FROM item_annotations"):
+			return fakeResult{}
+		}
+		t.Fatalf("unexpected query: %s", query)
+		return fakeResult{}
+	})
+	routes := NewHandler(HandlerDeps{DB: db, AdminToken: "secret"}).Routes()
+	datasetNames := func() (string, string) {
+		var conv models.Conversation
+		var item models.DatasetItem
+		for path, dst := range map[string]any{"/api/v1/conversations/7": &conv, "/api/v1/items/8": &item} {
+			rec := httptest.NewRecorder()
+			routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), dst) != nil {
+				t.Fatalf("%s: expected 200, got %d %s", path, rec.Code, rec.Body.String())
+			}
+		}
+		return conv.DatasetName, item.DatasetName
+	}
+
+	if conv, item := datasetNames(); conv != "support-v1" || item != "support-v1" {
+		t.Fatalf("expected the dataset name on both, got %q and %q", conv, item)
+	}
+	req := httptest.NewRequest(http.MethodPatch, "/api/v1/datasets/3", strings.NewReader(`{"name":"support-v2"}`))
+	req.Header.Set("X-Admin-Token", "secret")
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rename: expected 200, got %d %s", rec.Code, rec.Body.String())
+	}
+	if conv, item := datasetNames(); conv != "support-v2" || item != "support-v2" {
+		t.Fatalf("expected the new name after the rename, got %q and %q", conv, item)
+	}
+}
+
+func TestPatchConversation_DatasetIDMoves(t *testing.T) {
+	kinds := map[int64]string{4: "items", 5: "conversations"}
+	var moved, audited int
+	now := time.Now()
+	db := newFakeDB(t, func(query string, args []any) fakeResult {
+		t.Logf("Q %q %v", query, args)
+		switch {
+		case strings.HasPrefix(query, "SELECT dataset_id FROM conversations"):
+			return fakeResult{cols: []string{"dataset_id"}, rows: [][]any{{int64(3)}}}
+		case strings.HasPrefix(query, "SELECT kind FROM datasets"):
+			return fakeResult{cols: []string{"kind"}, rows: [][]any{{kinds[args[0].(int64)]}}}
+		case strings.HasPrefix(query, "UPDATE conversations SET dataset_id"):
+			moved++
+			return fakeResult{affected: 1}
+		case strings.Contains(query, "INSERT INTO audit_log"):
+			audited++
+			return fakeResult{affected: 1}
+		case strings.Contains(query, "UPDATE conversations\nSET split"):
+			return fakeResult{affected: 1}
+		case strings.Contains(query, "FROM conversations c\nJOIN datasets d ON d.id = c.dataset_id"):
+			return conversationRowResult(models.Conversation{ID: 7, DatasetID: 5, Split: models.SplitTrain, Status: models.ConversationStatusDraft, CreatedAt: now, UpdatedAt: now, DatasetName: "chats", DatasetKind: "conversations"})
+		case strings.Contains(query, "FROM conversation_messages"), strings.Contains(query, "FROM datasets"):
+			return fakeResult{}
+		}
+		t.Fatalf("unexpected query: %s", query)
+		return fakeResult{}
+	})
+	routes := NewHandler(HandlerDeps{DB: db, AdminToken: "secret"}).Routes()
+	patch := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/conversations/7", strings.NewReader(body))
+		req.Header.Set("X-Admin-Token", "secret")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := patch(`{"dataset_id":4}`)
+	assertErrorCode(t, rec, http.StatusBadRequest, codeInvalidInput)
+	if moved != 0 || audited != 0 {
+		t.Fatalf("expected no move into an items dataset, got %d moves", moved)
+	}
+
+	rec = patch(`{"dataset_id":5}`)
+	if rec.Code != http.StatusOK || moved != 1 || audited != 1 {
+		t.Fatalf("expected the move and its audit entry, got %d %s (moved %d, audited %d)", rec.Code, rec.Body.String(), moved, audited)
+	}
+}
+
+func TestPatchDataset_KindChangeNeedsEmptyDataset(t *testing.T) {
+	now := time.Now()
+	db := newFakeDB(t, func(query string, args []any) fakeResult {
+		switch {
+		case strings.HasPrefix(strings.TrimSpace(query), "UPDATE datasets"):
+			if !strings.Contains(query, "item_count = 0 AND conversation_count = 0") || args[len(args)-1] != "items" {
+				t.Fatalf("expected the kind change to be guarded by the counts: %s %v", query, args)
+			}
+			return fakeResult{affected: 0}
+		case strings.Contains(query, "FROM datasets d\nWHERE d.id = $1"):
+			return datasetDetailRowResult(models.Dataset{ID: 3, Name: "chats", Kind: "conversations", Visibility: "public", DefaultSplit: "train", DefaultStatus: "draft",
+				ItemCount: 0, ConversationCount: 12, TrainCount: 12, CreatedAt: now, UpdatedAt: now})
+		}
+		t.Fatalf("unexpected query: %s", query)
+		return fakeResult{}
+	})
+	routes := NewHandler(HandlerDeps{DB: db, AdminToken: "secret"}).Routes()
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/v1/datasets/3", strings.NewReader(`{"kind":"items"}`))
+	req.Header.Set("X-Admin-Token", "secret")
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	e := assertErrorCode(t, rec, http.StatusConflict, codeConflict)
+	if !strings.Contains(e.Message, "12 conversations") {
+		t.Fatalf("expected the row counts in the message, got %q", e.Message)
+	}
+}
+
+func TestGetConversation_MessagesUpdatedAt(t *testing.T) {
+	created := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	edited := created.Add(90 * time.Minute)
+	db := newFakeDB(t, func(query string, args []any) fakeResult {
+		switch {
+		case strings.Contains(query, "FROM conversations c\nJOIN datasets d ON d.id = c.dataset_id"):
+			return conversationRowResult(models.Conversation{ID: 7, DatasetID: 3, Split: models.SplitTrain, Status: models.ConversationStatusApproved, CreatedAt: created, UpdatedAt: edited, MessagesUpdatedAt: &edited, DatasetName: "chats", DatasetKind: "conversations"})
+		case strings.Contains(query, "FROM conversation_messages"), strings.Contains(query, "FROM message_alternatives"):
+			return fakeResult{}
+		}
+		t.Fatalf("unexpected query: %s", query)
+		return fakeResult{}
+	})
+	h := NewHandler(HandlerDeps{DB: db, DatasetCacheTTL: time.Hour})
+	h.datasets.entries[3] = datasetCacheEntry{ds: models.Dataset{ID: 3, Visibility: "public"}, expires: time.Now().Add(time.Hour)}
+
+	rec := httptest.NewRecorder()
+	h.Routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/conversations/7", nil))
+	var got struct {
+		UpdatedAt         time.Time  `json:"updated_at"`
+		MessagesUpdatedAt *time.Time `json:"messages_updated_at"`
+	}
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &got) != nil {
+		t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body.String())
+	}
+	if got.MessagesUpdatedAt == nil || !got.MessagesUpdatedAt.Equal(edited) || !got.UpdatedAt.Equal(edited) {
+		t.Fatalf("expected the message edit time in messages_updated_at and updated_at, got %+v", got)
+	}
+}
+
+func TestPromoteAlternative_SwapsIntoItsMessageRow(t *testing.T) {
+	created := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	var swapped, replaced []any
+	db := newFakeDB(t, func(query string, args []any) fakeResult {
+		switch {
+		case strings.HasPrefix(query, "SELECT dataset_id FROM conversations"):
+			return fakeResult{cols: []string{"dataset_id"}, rows: [][]any{{int64(3)}}}
+		case strings.Contains(query, "FROM message_alternatives a JOIN conversation_messages m ON m.id = a.message_id"):
+			if !strings.Contains(query, "FOR UPDATE") {
+				return fakeResult{}
+			}
+			// The message moved from idx 1 to idx 3 since the draft was written.
+			return fakeResult{
+				cols: []string{"id", "conversation_id", "message_id", "idx", "content", "model", "author", "meta", "status", "created_at", "accepted_at"},
+				rows: [][]any{{int64(5), int64(7), int64(77), int64(3), "better", "", "ana", []byte(`{}`), "draft", created, nil}},
+			}
+		case strings.HasPrefix(query, "SELECT role, content FROM conversation_messages WHERE id = $1"):
+			return fakeResult{cols: []string{"role", "content"}, rows: [][]any{{"assistant", "worse"}}}
+		case strings.HasPrefix(query, "UPDATE conversation_messages"):
+			swapped = args
+			return fakeResult{affected: 1}
+		case strings.HasPrefix(query, "UPDATE message_alternatives"):
+			return fakeResult{affected: 1}
+		case strings.HasPrefix(query, "INSERT INTO message_alternatives"):
+			replaced = args
+			return fakeResult{cols: []string{"id"}, rows: [][]any{{int64(6)}}}
+		case strings.Contains(query, "INSERT INTO audit_log"):
+			return fakeResult{affected: 1}
+		case strings.Contains(query, "FROM conversations c\nJOIN datasets d ON d.id = c.dataset_id"):
+			return conversationRowResult(models.Conversation{ID: 7, DatasetID: 3, Split: models.SplitTrain, Status: models.ConversationStatusApproved, CreatedAt: created, UpdatedAt: created, MessagesUpdatedAt: &created, DatasetName: "chats", DatasetKind: "conversations"})
+		case strings.Contains(query, "FROM conversation_messages"):
+			return fakeResult{}
+		}
+		t.Fatalf("unexpected query: %s", query)
+		return fakeResult{}
+	})
+	h := NewHandler(HandlerDeps{DB: db, AdminToken: "secret", DatasetCacheTTL: time.Hour})
+	h.datasets.entries[3] = datasetCacheEntry{ds: models.Dataset{ID: 3, Visibility: "public"}, expires: time.Now().Add(time.Hour)}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/conversations/7/alternatives/5/promote", nil)
+	req.Header.Set("X-Admin-Token", "secret")
+	rec := httptest.NewRecorder()
+	h.Routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body.String())
+	}
+	if !reflect.DeepEqual(swapped, []any{int64(77), "better"}) {
+		t.Fatalf("expected the swap to address message row 77, got %v", swapped)
+	}
+	if len(replaced) < 3 || replaced[1] != int64(77) || replaced[2] != "worse" {
+		t.Fatalf("expected the replaced text kept on message row 77, got %v", replaced)
+	}
+}
+
+func TestPromoteAlternative_RechecksBannedPhrases(t *testing.T) {
+	created := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	db := newFakeDB(t, func(query string, args []any) fakeResult {
+		switch {
+		case strings.HasPrefix(query, "SELECT dataset_id FROM conversations"):
+			return fakeResult{cols: []string{"dataset_id"}, rows: [][]any{{int64(3)}}}
+		case strings.Contains(query, "FROM message_alternatives a JOIN conversation_messages m ON m.id = a.message_id"):
+			// A batch-imported draft stored before "as an ai" was banned.
+			return fakeResult{
+				cols: []string{"id", "conversation_id", "message_id", "idx", "content", "model", "author", "meta", "status", "created_at", "accepted_at"},
+				rows: [][]any{{int64(5), int64(7), int64(77), int64(1), "As an AI, I cannot", "gpt", "", []byte(`{}`), "draft", created, nil}},
+			}
+		case strings.HasPrefix(query, "SELECT role, content FROM conversation_messages WHERE id = $1"):
+			return fakeResult{cols: []string{"role", "content"}, rows: [][]any{{"assistant", "fine"}}}
+		}
+		t.Fatalf("unexpected query: %s", query)
+		return fakeResult{}
+	})
+	h := NewHandler(HandlerDeps{DB: db, AdminToken: "secret", BannedPhrases: []string{"as an ai"}, DatasetCacheTTL: time.Hour})
+	h.datasets.entries[3] = datasetCacheEntry{ds: models.Dataset{ID: 3, Visibility: "public"}, expires: time.Now().Add(time.Hour)}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/conversations/7/alternatives/5/promote", nil)
+	req.Header.Set("X-Admin-Token", "secret")
+	rec := httptest.NewRecorder()
+	h.Routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), codeBannedPhrase) {
+		t.Fatalf("expected 422 banned_phrase, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestUpdateConversationMessages_KeepsAlternatives(t *testing.T) {
+	created := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	// message_id of each alternative; 0 once its message row is deleted (ON DELETE SET NULL).
+	alts := map[int64]int64{5: 77, 6: 78}
+	db := newFakeDB(t, func(query string, args []any) fakeResult {
+		switch {
+		case strings.HasPrefix(query, "SELECT dataset_id FROM conversations"):
+			return fakeResult{cols: []string{"dataset_id"}, rows: [][]any{{int64(3)}}}
+		case strings.Contains(query, "FROM conversations c\nJOIN datasets d ON d.id = c.dataset_id"):
+			return conversationRowResult(models.Conversation{ID: 7, DatasetID: 3, Split: models.SplitTrain, Status: models.ConversationStatusApproved, CreatedAt: created, UpdatedAt: created, MessagesUpdatedAt: &created, DatasetName: "chats", DatasetKind: "conversations"})
+		case strings.HasPrefix(query, "UPDATE conversations"):
+			return fakeResult{affected: 1}
+		case strings.HasPrefix(query, "SELECT a.id, m.idx"):
+			// Alternative 5 belongs to the reply at idx 1, 6 to the one at idx 3.
+			return fakeResult{cols: []string{"id", "idx"}, rows: [][]any{{int64(5), int64(1)}, {int64(6), int64(3)}}}
+		case strings.HasPrefix(query, "DELETE FROM conversation_messages"):
+			for id := range alts {
+				alts[id] = 0
+			}
+			return fakeResult{affected: 4}
+		case strings.HasPrefix(query, "INSERT INTO conversation_messages"):
+			return fakeResult{affected: 2}
+		case strings.HasPrefix(query, "UPDATE message_alternatives a\nSET message_id = m.id"):
+			// The rewrite keeps an assistant reply at idx 1 only, now row 90.
+			ids, idxs := args[1].([]int64), args[2].([]int64)
+			for i, id := range ids {
+				if idxs[i] == 1 {
+					alts[id] = 90
+				}
+			}
+			return fakeResult{affected: 1}
+		case strings.HasPrefix(query, "DELETE FROM message_alternatives WHERE conversation_id = $1 AND message_id IS NULL"):
+			for id, msg := range alts {
+				if msg == 0 {
+					delete(alts, id)
+				}
+			}
+			return fakeResult{affected: 1}
+		case strings.Contains(query, "FROM message_alternatives a JOIN conversation_messages m ON m.id = a.message_id"):
+			res := fakeResult{cols: []string{"id", "conversation_id", "message_id", "idx", "content", "model", "author", "meta", "status", "created_at", "accepted_at"}}
+			if msg, ok := alts[5]; ok && msg == 90 {
+				res.rows = append(res.rows, []any{int64(5), int64(7), int64(90), int64(1), "older reply", "", "", []byte(`{}`), "replaced", created, nil})
+			}
+			return res
+		case strings.HasPrefix(query, "SELECT EXISTS"):
+			return fakeResult{cols: []string{"exists"}, rows: [][]any{{true}}}
+		case strings.Contains(query, "FROM conversation_messages"):
+			return fakeResult{}
+		}
+		t.Fatalf("unexpected query: %s", query)
+		return fakeResult{}
+	})
+	h := NewHandler(HandlerDeps{DB: db, AdminToken: "secret", DatasetCacheTTL: time.Hour})
+	h.datasets.entries[3] = datasetCacheEntry{ds: models.Dataset{ID: 3, Visibility: "public"}, expires: time.Now().Add(time.Hour)}
+	routes := h.Routes()
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/v1/conversations/7", strings.NewReader(`{"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"hello again"}]}`))
+	req.Header.Set("X-Admin-Token", "secret")
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body.String())
+	}
+	if !reflect.DeepEqual(alts, map[int64]int64{5: 90}) {
+		t.Fatalf("expected alternative 5 moved to the new reply and 6 dropped with its position, got %v", alts)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/conversations/7/alternatives", nil)
+	req.Header.Set("X-Admin-Token", "secret")
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"id":5`) || !strings.Contains(rec.Body.String(), `"status":"replaced"`) {
+		t.Fatalf("expected the replaced text still listed, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestSnapshotDatasetStats_ConversationDatasetsOnly(t *testing.T) {
+	taken := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	db := newFakeDB(t, func(query string, args []any) fakeResult {
+		switch {
+		case strings.HasPrefix(query, "SELECT\n  (SELECT COUNT(*) FROM conversation_messages"):
+			return fakeResult{cols: []string{"messages", "items"}, rows: [][]any{{int64(0), int64(0)}}}
+		case strings.Contains(query, "FROM conversations"):
+			return fakeResult{}
+		case strings.HasPrefix(query, "INSERT INTO dataset_stats_history"):
+			return fakeResult{cols: []string{"id", "taken_at"}, rows: [][]any{{int64(12), taken}}}
+		case strings.Contains(query, "FROM dataset_stats_history\nWHERE id = $1 AND dataset_id = $2"):
+			if args[1] != int64(3) {
+				return fakeResult{cols: []string{"id", "dataset_id", "taken_at", "stats"}}
+			}
+			return fakeResult{cols: []string{"id", "dataset_id", "taken_at", "stats"}, rows: [][]any{{int64(12), int64(3), taken, []byte(`{"conversations":0}`)}}}
+		}
+		t.Fatalf("unexpected query: %s", query)
+		return fakeResult{}
+	})
+	h := NewHandler(HandlerDeps{DB: db, AdminToken: "secret", DatasetCacheTTL: time.Hour})
+	h.datasets.entries[3] = datasetCacheEntry{ds: models.Dataset{ID: 3, Kind: models.DatasetKindConversations, Visibility: "public"}, expires: time.Now().Add(time.Hour)}
+	h.datasets.entries[4] = datasetCacheEntry{ds: models.Dataset{ID: 4, Kind: models.DatasetKindItems, Visibility: "public"}, expires: time.Now().Add(time.Hour)}
+	routes := h.Routes()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/datasets/4/stats/snapshot", nil)
+	req.Header.Set("X-Admin-Token", "secret")
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assertErrorCode(t, rec, http.StatusConflict, codeWrongDatasetKind)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/datasets/3/stats/snapshot", nil)
+	req.Header.Set("X-Admin-Token", "secret")
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	loc := rec.Header().Get("Location")
+	if rec.Code != http.StatusCreated || loc != "/api/v1/datasets/3/stats/history/12" {
+		t.Fatalf("expected 201 with the snapshot's Location, got %d %q %s", rec.Code, loc, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, loc, nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"id":12`) {
+		t.Fatalf("expected the snapshot at its Location, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/datasets/4/stats/history/12", nil))
+	assertErrorCode(t, rec, http.StatusNotFound, "not_found")
+}
+
+func TestLockedDataset_RefusesEdits(t *testing.T) {
+	h := NewHandler(HandlerDeps{AdminToken: "secret", DatasetCacheTTL: time.Hour})
+	lock := &models.DatasetLock{By: "run-1", At: time.Now()}
+	h.datasets.entries[3] = datasetCacheEntry{ds: models.Dataset{ID: 3, Kind: "items", Visibility: "public", Lock: lock}, expires: time.Now().Add(time.Hour)}
+	routes := h.Routes()
+
+	for _, path := range []string{"/api/v1/datasets/3/items", "/api/v1/datasets/3/strip-meta"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"data":{"q":"x"}}`))
+		req.Header.Set("X-Admin-Token", "secret")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		e := assertErrorCode(t, rec, http.StatusLocked, codeDatasetLocked)
+		if !strings.Contains(e.Message, "run-1") || !strings.Contains(rec.Body.String(), `"lock":{"by":"run-1"`) {
+			t.Fatalf("%s: expected the locker in the response, got %s", path, rec.Body.String())
+		}
+	}
+}
+
+func TestLockedDataset_TriggerRefusalIs423(t *testing.T) {
+	// The cached dataset is unlocked; the lock lands before the write and the trigger refuses it.
+	db := newFakeDB(t, func(query string, args []any) fakeResult {
+		switch {
+		case strings.HasPrefix(query, "SELECT dataset_id FROM conversations"):
+			return fakeResult{cols: []string{"dataset_id"}, rows: [][]any{{int64(3)}}}
+		case strings.HasPrefix(query, "INSERT INTO conversation_ratings"):
+			return fakeResult{err: &pgconn.PgError{
+				Code:    "DL423",
+				Message: "dataset 3 is locked by run-2",
+				Detail:  `{"dataset_id" : 3, "by" : "run-2", "at" : "2026-10-16T09:30:00+00:00", "expires_at" : null}`,
+			}}
+		}
+		t.Fatalf("unexpected query: %s", query)
+		return fakeResult{}
+	})
+	h := NewHandler(HandlerDeps{DB: db, AdminToken: "secret", DatasetCacheTTL: time.Hour})
+	h.datasets.entries[3] = datasetCacheEntry{ds: models.Dataset{ID: 3, Visibility: "public"}, expires: time.Now().Add(time.Hour)}
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/conversations/7/ratings", strings.NewReader(`{"rater":"alice","score":3}`))
+	req.Header.Set("X-Admin-Token", "secret")
+	rec := httptest.NewRecorder()
+	h.Routes().ServeHTTP(rec, req)
+	assertErrorCode(t, rec, http.StatusLocked, codeDatasetLocked)
+	if !strings.Contains(rec.Body.String(), `"lock":{"by":"run-2"`) {
+		t.Fatalf("expected the lock from the trigger, got %s", rec.Body.String())
+	}
+}
+
+func TestGenerationJobs_Validation(t *testing.T) {
+	routes := NewHandler(HandlerDeps{AdminToken: "secret"}).Routes()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/generation-jobs", strings.NewReader(`{}`))
+	req.Header.Set("X-Admin-Token", "secret")
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assertErrorCode(t, rec, http.StatusServiceUnavailable, codeLLMDisabled)
+
+	routes = NewHandler(HandlerDeps{AdminToken: "secret", LLM: llm.New("http://llm.invalid/v1", "", "m", time.Second)}).Routes()
+	cases := []struct {
+		body, code string
+	}{
+		{`{"dataset_id":1,"prompt_template":"x","seeds":["a"],"target_count":1,"bogus":1}`, codeInvalidJSON},
+		{`{"prompt_template":"x","seeds":["a"],"target_count":1}`, "invalid_dataset_id"},
+		{`{"dataset_id":1,"prompt_template":"{{.topic","seeds":["a"],"target_count":1}`, "invalid_prompt_template"},
+		{`{"dataset_id":1,"prompt_template":"x","target_count":1}`, "invalid_seeds"},
+		{`{"dataset_id":1,"prompt_template":"x","seeds":["a"],"target_count":0}`, "invalid_target_count"},
+		{`{"dataset_id":1,"prompt_template":"x","seeds":["a"],"target_count":1,"concurrency":9}`, "invalid_concurrency"},
+		{`{"dataset_id":1,"prompt_template":"x","seeds":["a"],"target_count":1,"temperature":3}`, "invalid_temperature"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/generation-jobs", strings.NewReader(tc.body))
+		req.Header.Set("X-Admin-Token", "secret")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		assertErrorCode(t, rec, http.StatusBadRequest, tc.code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/generation-jobs", nil)
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assertErrorCode(t, rec, http.StatusBadRequest, "invalid_dataset_id")
+}
+
+func TestGenerationProgress(t *testing.T) {
+	p := &generationProgress{target: 2, next: 5}
+	a, _ := p.take()
+	b, _ := p.take()
+	if a != 5 || b != 6 {
+		t.Fatalf("expected seed positions 5 and 6, got %d %d", a, b)
+	}
+	if _, ok := p.take(); ok {
+		t.Fatal("expected no attempts beyond the target while two are in flight")
+	}
+	p.finish(errors.New("boom"))
+	if _, ok := p.take(); !ok {
+		t.Fatal("expected a failed attempt to be retried with the next seed")
+	}
+	for i := 0; i < maxConsecutiveGenerationFailures; i++ {
+		p.inflight++
+		p.finish(errors.New("boom"))
+	}
+	if _, ok := p.take(); ok {
+		t.Fatal("expected the job to stop after consecutive failures")
+	}
+}
+
+func TestGenerationProgress_StopsOnLock(t *testing.T) {
+	p := &generationProgress{target: 5}
+	p.take()
+	p.finish(&pgconn.PgError{Code: "DL423", Detail: `{"dataset_id":3,"by":"run-1"}`})
+	if _, ok := p.take(); ok {
+		t.Fatal("expected no attempts once the dataset is locked")
+	}
+	if p.locked == nil || p.locked.DatasetID != 3 || p.locked.Lock.By != "run-1" {
+		t.Fatalf("expected the lock to be kept for the job error, got %+v", p.locked)
+	}
+}
+
+func TestGenerateOne_ChecksPrompts(t *testing.T) {
+	h := NewHandler(HandlerDeps{
+		BannedPhrases:          []string{"forbidden"},
+		MaxMessageContentBytes: 40,
+		LLM:                    llm.New("http://llm.invalid/v1", "", "m", time.Second),
+	})
+	tmpl, err := models.ParseSeedTemplate("Write about {{.topic}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		system, seed, want string
+	}{
+		{"You never say forbidden things.", `{"topic":"tea"}`, `system prompt contains banned phrase "forbidden"`},
+		{"", `{"topic":"forbidden tea"}`, `user prompt contains banned phrase "forbidden"`},
+		{"", `{"topic":"tea, coffee, cocoa and every other drink"}`, "bytes (max 40)"},
+	}
+	for _, tc := range cases {
+		// The checks fail before the unreachable LLM endpoint is called.
+		err := h.generateOne(context.Background(), models.GenerationJob{SystemPrompt: tc.system}, tmpl, models.GenerationSeed{Data: json.RawMessage(tc.seed)})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("expected %q, got %v", tc.want, err)
+		}
+	}
+}
+
+func TestSemanticSearch_Validation(t *testing.T) {
+	routes := NewHandler(HandlerDeps{AdminToken: "secret"}).Routes()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/datasets/1/embed", nil)
+	req.Header.Set("X-Admin-Token", "secret")
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assertErrorCode(t, rec, http.StatusNotImplemented, codeEmbedDisabled)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/datasets/1/conversations/similar?q=refunds", nil)
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	assertErrorCode(t, rec, http.StatusNotImplemented, codeEmbedDisabled)
+
+	routes = NewHandler(HandlerDeps{AdminToken: "secret", Embedder: llm.New("http://llm.invalid/v1", "", "e", time.Second)}).Routes()
+	cases := []struct {
+		method, path, code string
+	}{
+		{http.MethodPost, "/api/v1/datasets/1/embed?text=last_user", "invalid_text"},
+		{http.MethodPost, "/api/v1/datasets/1/embed?limit=0", "invalid_limit"},
+		{http.MethodGet, "/api/v1/datasets/1/conversations/similar", "invalid_q"},
+		{http.MethodGet, "/api/v1/datasets/1/conversations/similar?q=a&like_id=2", "invalid_q"},
+		{http.MethodGet, "/api/v1/datasets/1/conversations/similar?like_id=x", "invalid_like_id"},
+		{http.MethodGet, "/api/v1/datasets/1/conversations/similar?q=a&limit=101", "invalid_limit"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set("X-Admin-Token", "secret")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		assertErrorCode(t, rec, http.StatusBadRequest, tc.code)
+	}
+}
+
+func TestSimilarConversations_ScopesLookups(t *testing.T) {
+	var embeddingArgs []any
+	db := newFakeDB(t, func(query string, args []any) fakeResult {
+		switch {
+		case strings.Contains(query, "to_regclass('conversation_embeddings')"):
+			return fakeResult{cols: []string{"ok"}, rows: [][]any{{true}}}
+		case strings.Contains(query, "FROM conversation_embeddings e\nJOIN conversations c"):
+			embeddingArgs = args
+			return fakeResult{cols: []string{"embedding", "model"}}
+		}
+		t.Fatalf("unexpected query: %s", query)
+		return fakeResult{}
+	})
+	h := NewHandler(HandlerDeps{DB: db, AdminToken: "secret", DatasetCacheTTL: time.Hour, Embedder: llm.New("http://llm.invalid/v1", "", "e", time.Second)})
+	h.datasets.entries[3] = datasetCacheEntry{ds: models.Dataset{ID: 3, Visibility: "public"}, expires: time.Now().Add(time.Hour)}
+	routes := h.Routes()
+
+	// q would call the embeddings endpoint, so readers of a public dataset need the token.
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/datasets/3/conversations/similar?q=refunds", nil))
+	assertErrorCode(t, rec, http.StatusUnauthorized, "unauthorized")
+
+	// like_id only finds embeddings of the dataset's own conversations.
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/datasets/3/conversations/similar?like_id=9", nil))
+	assertErrorCode(t, rec, http.StatusNotFound, "not_found")
+	if !reflect.DeepEqual(embeddingArgs, []any{int64(9), int64(3)}) {
+		t.Fatalf("expected the embedding lookup scoped to dataset 3, got %v", embeddingArgs)
+	}
+}
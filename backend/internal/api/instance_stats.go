@@ -0,0 +1,41 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"caiatech-datalab/backend/internal/models"
+)
+
+// instanceStatsTTL is how long GET /api/v1/stats serves the same totals; they are counts over
+// whole tables, too costly to run on every dashboard refresh.
+const instanceStatsTTL = 30 * time.Second
+
+// instanceStatsLoadTimeout bounds one computation of the totals.
+const instanceStatsLoadTimeout = time.Minute
+
+// instanceStatsCache holds the last instance totals. The lock is held while loading, so
+// concurrent requests on an expired entry share one computation. It runs detached from the
+// request that started it, so that client going away does not fail everyone waiting.
+type instanceStatsCache struct {
+	mu      sync.Mutex
+	stats   models.InstanceStats
+	expires time.Time
+}
+
+func (c *instanceStatsCache) get(ctx context.Context, load func(context.Context) (models.InstanceStats, error)) (models.InstanceStats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Now().Before(c.expires) {
+		return c.stats, nil
+	}
+	loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), instanceStatsLoadTimeout)
+	defer cancel()
+	st, err := load(loadCtx)
+	if err != nil {
+		return models.InstanceStats{}, err
+	}
+	c.stats, c.expires = st, time.Now().Add(instanceStatsTTL)
+	return st, nil
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"caiatech-datalab/backend/internal/models"
+)
+
+func TestInstanceStatsCache(t *testing.T) {
+	var c instanceStatsCache
+	calls := 0
+	load := func(context.Context) (models.InstanceStats, error) {
+		calls++
+		return models.InstanceStats{Datasets: int64(calls)}, nil
+	}
+	fail := func(context.Context) (models.InstanceStats, error) {
+		return models.InstanceStats{}, errors.New("db down")
+	}
+
+	if _, err := c.get(context.Background(), fail); err == nil {
+		t.Fatal("expected the load error")
+	}
+	for i := 0; i < 3; i++ {
+		st, err := c.get(context.Background(), load)
+		if err != nil || st.Datasets != 1 {
+			t.Fatalf("get %d: got %+v %v", i, st, err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected one load within the TTL, got %d", calls)
+	}
+}
+
+func TestInstanceStatsCache_LoadOutlivesCanceledRequest(t *testing.T) {
+	var c instanceStatsCache
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	st, err := c.get(ctx, func(ctx context.Context) (models.InstanceStats, error) {
+		if err := ctx.Err(); err != nil {
+			return models.InstanceStats{}, err
+		}
+		return models.InstanceStats{Datasets: 2}, nil
+	})
+	if err != nil || st.Datasets != 2 {
+		t.Fatalf("expected the load to run despite the canceled request, got %+v %v", st, err)
+	}
+}
+
+func TestInstanceStats_RequiresAdmin(t *testing.T) {
+	h := NewHandler(HandlerDeps{AdminToken: "secret"})
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/stats", nil)
+	rec := httptest.NewRecorder()
+	h.Routes().ServeHTTP(rec, req)
+	assertErrorCode(t, rec, http.StatusUnauthorized, "unauthorized")
+}
+
+func TestInstanceStats_UsesDatasetCounts(t *testing.T) {
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	db := newFakeDB(t, func(query string, args []any) fakeResult {
+		switch {
+		case strings.Contains(query, "SUM(conversation_count)"):
+			if strings.Contains(query, "FROM dataset_items") {
+				t.Fatalf("expected items from the dataset counts, not a table count: %s", query)
+			}
+			if n := strings.Count(query, "deleted_at IS NULL"); n != 4 {
+				t.Fatalf("expected every total to skip soft-deleted datasets, got %d filters: %s", n, query)
+			}
+			return fakeResult{
+				cols: []string{"datasets", "conversations", "items", "messages", "pending", "now"},
+				rows: [][]any{{int64(2), int64(5), int64(40), int64(12), int64(1), now}},
+			}
+		case strings.HasPrefix(query, "SELECT c.status, COUNT(*)"):
+			// Soft-deleted datasets' conversations are archived; they must not count here.
+			if !strings.Contains(query, "WHERE d.deleted_at IS NULL") {
+				t.Fatalf("expected the status breakdown to skip soft-deleted datasets: %s", query)
+			}
+			return fakeResult{cols: []string{"status", "count"}, rows: [][]any{{"approved", int64(3)}, {"pending", int64(2)}}}
+		}
+		t.Fatalf("unexpected query: %s", query)
+		return fakeResult{}
+	})
+	h := NewHandler(HandlerDeps{DB: db, AdminToken: "secret"})
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/stats", nil)
+	req.Header.Set("X-Admin-Token", "secret")
+	rec := httptest.NewRecorder()
+	h.Routes().ServeHTTP(rec, req)
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(body, `"conversations":5`) || !strings.Contains(body, `"items":40`) || !strings.Contains(body, `"pending":2`) {
+		t.Fatalf("expected the dataset totals, got %d %s", rec.Code, body)
+	}
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"caiatech-datalab/backend/internal/models"
+)
+
+type createPreferenceRequest struct {
+	Split          string `json:"split"`
+	ConversationID *int64 `json:"conversation_id"`
+	MessageIdx     *int   `json:"message_idx"`
+	Prompt         string `json:"prompt"`
+	Chosen         string `json:"chosen"`
+	Rejected       string `json:"rejected"`
+	Rater          string `json:"rater"`
+}
+
+// handleCreatePreference stores a preference pair in a conversation dataset (201).
+func (h *Handler) handleCreatePreference(w http.ResponseWriter, r *http.Request) {
+	if !h.isAdmin(r) {
+		writeJSONError(w, http.StatusUnauthorized, "admin token required")
+		return
+	}
+
+	datasetID, err := parsePathInt64(r, "id")
+	if err != nil {
+		writeFieldError(w, "id", "invalid dataset id")
+		return
+	}
+	var req createPreferenceRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid JSON")
+		return
+	}
+	pair, err := models.NormalizePreferencePair(models.PreferencePair{
+		DatasetID:      datasetID,
+		Split:          models.Split(strings.TrimSpace(req.Split)),
+		ConversationID: req.ConversationID,
+		MessageIdx:     req.MessageIdx,
+		Prompt:         req.Prompt,
+		Chosen:         req.Chosen,
+		Rejected:       req.Rejected,
+		Rater:          req.Rater,
+	})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !h.checkUnlocked(w, r, datasetID) {
+		return
+	}
+
+	pair, err = models.CreatePreferencePair(r.Context(), h.db, pair)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidInput):
+			writeError(w, http.StatusBadRequest, err)
+		case errors.Is(err, models.ErrNotFound):
+			writeJSONError(w, http.StatusNotFound, "not found")
+		case errors.Is(err, models.ErrWrongDatasetKind):
+			writeErrorCode(w, http.StatusConflict, codeWrongDatasetKind, err.Error())
+		default:
+			writeStoreError(w, err, "failed to save preference")
+		}
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s/preferences/%d", resourcePath("datasets", datasetID), pair.ID))
+	writeJSON(w, http.StatusCreated, pair)
+}
+
+// handleGetPreference returns one preference pair of the dataset.
+func (h *Handler) handleGetPreference(w http.ResponseWriter, r *http.Request) {
+	prefID, err := parsePathInt64(r, "pref_id")
+	if err != nil {
+		writeFieldError(w, "pref_id", "invalid preference id")
+		return
+	}
+	id, ok := h.loadDatasetOfKind(w, r, false, "preferences")
+	if !ok {
+		return
+	}
+
+	pair, err := models.GetPreferencePair(r.Context(), h.db, id, prefID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			writeJSONError(w, http.StatusNotFound, "preference not found")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to get preference")
+		return
+	}
+	writeJSON(w, http.StatusOK, pair)
+}
+
+// handleListPreferences lists a dataset's preference pairs, oldest first.
+func (h *Handler) handleListPreferences(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.loadDatasetOfKind(w, r, false, "preferences")
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	limit := parseIntDefault(q.Get("limit"), 50)
+	offset := parseIntDefault(q.Get("offset"), 0)
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > 200 {
+		limit = 200
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	split := strings.TrimSpace(q.Get("split"))
+	if split != "" && split != "all" {
+		s, ok := models.NormalizeSplit(split)
+		if !ok {
+			writeFieldError(w, "split", "invalid split")
+			return
+		}
+		split = string(s)
+	}
+
+	pairs, err := models.ListPreferencePairs(r.Context(), h.db, id, split, limit, offset)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to list preferences")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"preferences": pairs})
+}
+
+// handleNextPreference serves a prompt with two responses to compare, for a rating UI. seed
+// reproduces a pick, as for the sample endpoints; 204 when nothing is left to compare.
+func (h *Handler) handleNextPreference(w http.ResponseWriter, r *http.Request) {
+	_, seed, err := sampleParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	id, ok := h.loadDatasetOfKind(w, r, false, "preferences/next")
+	if !ok {
+		return
+	}
+
+	c, err := models.NextPreferenceCandidate(r.Context(), h.db, id, seed)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "failed to pick a candidate")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"seed": seed, "candidate": c})
+}
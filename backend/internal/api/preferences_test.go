@@ -0,0 +1,123 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"caiatech-datalab/backend/internal/models"
+)
+
+func TestCreatePreference_Validation(t *testing.T) {
+	h := NewHandler(HandlerDeps{AdminToken: "secret"})
+	routes := h.Routes()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/datasets/1/preferences", strings.NewReader(`{}`))
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without the admin token, got %d", rec.Code)
+	}
+
+	// Rejected before the dataset is looked up.
+	for _, body := range []string{
+		`{"prompt":"q","chosen":" same ","rejected":"same","rater":"ana"}`,
+		`{"prompt":"q","chosen":"a","rejected":"b"}`,
+		`{"chosen":"a","rejected":"b","rater":"ana"}`,
+		`{"message_idx":1,"chosen":"a","rejected":"b","rater":"ana"}`,
+		`{"prompt":"q","chosen":"a","rejected":"b","rater":"ana","split":"dev"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/datasets/1/preferences", strings.NewReader(body))
+		req.Header.Set("X-Admin-Token", "secret")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		assertErrorCode(t, rec, http.StatusBadRequest, codeInvalidInput)
+	}
+}
+
+func TestCreatePreference_LocatesThePair(t *testing.T) {
+	created := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	pairRow := []any{int64(8), int64(3), "train", nil, nil, "q", "a", "b", "ana", created}
+	pairCols := []string{"id", "dataset_id", "split", "conversation_id", "message_idx", "prompt", "chosen", "rejected", "rater", "created_at"}
+	db := newFakeDB(t, func(query string, args []any) fakeResult {
+		switch {
+		case strings.HasPrefix(query, "SELECT name, kind FROM datasets"):
+			return fakeResult{cols: []string{"name", "kind"}, rows: [][]any{{"chats", "conversations"}}}
+		case strings.HasPrefix(query, "INSERT INTO preference_pairs"):
+			return fakeResult{cols: pairCols, rows: [][]any{pairRow}}
+		case strings.Contains(query, "FROM preference_pairs\nWHERE id = $1 AND dataset_id = $2"):
+			if args[0] != int64(8) || args[1] != int64(3) {
+				return fakeResult{cols: pairCols}
+			}
+			return fakeResult{cols: pairCols, rows: [][]any{pairRow}}
+		}
+		t.Fatalf("unexpected query: %s", query)
+		return fakeResult{}
+	})
+	h := NewHandler(HandlerDeps{DB: db, AdminToken: "secret", DatasetCacheTTL: time.Hour})
+	h.datasets.entries[3] = datasetCacheEntry{ds: models.Dataset{ID: 3, Kind: models.DatasetKindConversations, Visibility: "public"}, expires: time.Now().Add(time.Hour)}
+	routes := h.Routes()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/datasets/3/preferences", strings.NewReader(`{"prompt":"q","chosen":"a","rejected":"b","rater":"ana"}`))
+	req.Header.Set("X-Admin-Token", "secret")
+	rec := httptest.NewRecorder()
+	routes.ServeHTTP(rec, req)
+	loc := rec.Header().Get("Location")
+	if rec.Code != http.StatusCreated || loc != "/api/v1/datasets/3/preferences/8" {
+		t.Fatalf("expected 201 with the pair's Location, got %d %q %s", rec.Code, loc, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, loc, nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"id":8`) {
+		t.Fatalf("expected the pair at its Location, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/datasets/3/preferences/9", nil))
+	assertErrorCode(t, rec, http.StatusNotFound, "not_found")
+}
+
+func TestNextPreference_SamplesRepliesAPageAtATime(t *testing.T) {
+	cols := []string{"pick", "key", "prompt", "content", "conversation_id", "idx", "text", "source", "conv", "idx", "alt"}
+	var afters []any
+	db := newFakeDB(t, func(query string, args []any) fakeResult {
+		switch {
+		case strings.HasPrefix(query, "SELECT name, kind FROM datasets"):
+			return fakeResult{cols: []string{"name", "kind"}, rows: [][]any{{"chats", "conversations"}}}
+		case strings.HasPrefix(query, "WITH anchors AS"):
+			// Every lookup samples a bounded page of replies, never the whole dataset.
+			if !strings.Contains(query, "LIMIT $3\n)") || args[2] != int64(20) {
+				t.Fatalf("expected a page of 20 sampled replies, got %v: %s", args, query)
+			}
+			afters = append(afters, args[3])
+			if args[3] == "" {
+				// A full page of replies with nothing left to compare.
+				var rows [][]any
+				for i := 0; i < 20; i++ {
+					rows = append(rows, []any{fmt.Sprintf("p%02d", i), nil, "Hi", "hello", int64(i + 1), int64(1), nil, nil, nil, nil, nil})
+				}
+				return fakeResult{cols: cols, rows: rows}
+			}
+			return fakeResult{cols: cols, rows: [][]any{
+				{"p20", "c21-40", "Hi", "hello", int64(21), int64(1), "hey there", "message", int64(40), int64(1), nil},
+			}}
+		}
+		t.Fatalf("unexpected query: %s", query)
+		return fakeResult{}
+	})
+	h := NewHandler(HandlerDeps{DB: db, DatasetCacheTTL: time.Hour})
+	h.datasets.entries[3] = datasetCacheEntry{ds: models.Dataset{ID: 3, Kind: models.DatasetKindConversations, Visibility: "public"}, expires: time.Now().Add(time.Hour)}
+
+	rec := httptest.NewRecorder()
+	h.Routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/datasets/3/preferences/next?seed=7", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"text":"hey there"`) || !strings.Contains(rec.Body.String(), `"conversation_id":21`) {
+		t.Fatalf("expected the candidate from the second page, got %d %s", rec.Code, rec.Body.String())
+	}
+	if !reflect.DeepEqual(afters, []any{"", "p19"}) {
+		t.Fatalf("expected the second page to continue after the first, got %v", afters)
+	}
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"caiatech-datalab/backend/internal/models"
+)
+
+// RunStatsSnapshots snapshots every dataset's stats once per every and prunes snapshots older
+// than retention (0 keeps them) until ctx is done. It checks hourly, or every when shorter, so
+// a restart catches up on due snapshots without waiting a full interval. every <= 0 disables it.
+func (h *Handler) RunStatsSnapshots(ctx context.Context, every, retention time.Duration) {
+	if every <= 0 {
+		return
+	}
+	tick := time.NewTicker(min(every, time.Hour))
+	defer tick.Stop()
+	for {
+		h.snapshotDueStats(ctx, every, retention)
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+func (h *Handler) snapshotDueStats(ctx context.Context, every, retention time.Duration) {
+	n, err := models.SnapshotDueDatasetStats(ctx, h.db, every)
+	if err != nil && ctx.Err() == nil {
+		log.Printf("stats snapshots: %v", err)
+	}
+	if n > 0 {
+		log.Printf("stats snapshots: snapshotted %d datasets", n)
+	}
+	if retention <= 0 {
+		return
+	}
+	pruned, err := models.PruneDatasetStatsHistory(ctx, h.db, retention)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("stats snapshots: prune: %v", err)
+		}
+		return
+	}
+	if pruned > 0 {
+		log.Printf("stats snapshots: pruned %d snapshots older than %s", pruned, retention)
+	}
+}
@@ -103,7 +103,15 @@ func getAppliedMigrations(db *sql.DB) (map[string]bool, error) {
 	return out, rows.Err()
 }
 
+// noTxSuffix marks migrations that must run outside a transaction, such as CREATE INDEX
+// CONCURRENTLY: 022_jsonb_gin_indexes.no-tx.sql.
+const noTxSuffix = ".no-tx.sql"
+
 func applyMigration(db *sql.DB, version string, sqlText string) error {
+	if strings.HasSuffix(version, noTxSuffix) {
+		return applyMigrationNoTx(db, version, sqlText)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -122,3 +130,90 @@ func applyMigration(db *sql.DB, version string, sqlText string) error {
 
 	return tx.Commit()
 }
+
+// applyMigrationNoTx runs each statement of a no-tx migration on its own, then records the
+// version. Postgres treats a multi-statement query as one implicit transaction, so the
+// statements are split first. There is no timeout, since concurrent index builds on large
+// tables can take far longer than the transactional 30s. A failure part way leaves the
+// earlier statements applied and the version unrecorded, so such migrations should be
+// idempotent (IF NOT EXISTS) to be rerun safely.
+func applyMigrationNoTx(db *sql.DB, version string, sqlText string) error {
+	ctx := context.Background()
+	for _, stmt := range splitStatements(sqlText) {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	_, err := db.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version)
+	return err
+}
+
+// splitStatements splits sqlText on semicolons outside quoted strings, quoted identifiers,
+// dollar-quoted bodies and comments, dropping statements that are empty or only comments.
+func splitStatements(sqlText string) []string {
+	var out []string
+	start, hasCode := 0, false
+	emit := func(end int) {
+		if hasCode {
+			out = append(out, strings.TrimSpace(sqlText[start:end]))
+		}
+		start, hasCode = end+1, false
+	}
+	for i := 0; i < len(sqlText); i++ {
+		c := sqlText[i]
+		switch {
+		case c == '-' && strings.HasPrefix(sqlText[i:], "--"):
+			if j := strings.IndexByte(sqlText[i:], '\n'); j >= 0 {
+				i += j
+			} else {
+				i = len(sqlText)
+			}
+		case c == '/' && strings.HasPrefix(sqlText[i:], "/*"):
+			if j := strings.Index(sqlText[i+2:], "*/"); j >= 0 {
+				i += j + 3
+			} else {
+				i = len(sqlText)
+			}
+		case c == '\'' || c == '"':
+			hasCode = true
+			for i++; i < len(sqlText); i++ {
+				if sqlText[i] == c {
+					if i+1 < len(sqlText) && sqlText[i+1] == c {
+						i++
+						continue
+					}
+					break
+				}
+			}
+		case c == '$':
+			hasCode = true
+			if tag, ok := dollarTag(sqlText[i:]); ok {
+				if j := strings.Index(sqlText[i+len(tag):], tag); j >= 0 {
+					i += len(tag) + j + len(tag) - 1
+				} else {
+					i = len(sqlText)
+				}
+			}
+		case c == ';':
+			emit(i)
+		case c != ' ' && c != '\t' && c != '\n' && c != '\r':
+			hasCode = true
+		}
+	}
+	emit(len(sqlText))
+	return out
+}
+
+// dollarTag returns the opening $tag$ (or $$) at the start of s.
+func dollarTag(s string) (string, bool) {
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if c == '$' {
+			return s[:i+1], true
+		}
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 1 && c >= '0' && c <= '9') {
+			return "", false
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// recordingDriver is a database/sql driver that logs BEGIN, COMMIT and every executed
+// statement instead of talking to Postgres.
+type recordingDriver struct{ log *[]string }
+
+func (d recordingDriver) Open(string) (driver.Conn, error) { return recordingConn(d), nil }
+
+type recordingConn struct{ log *[]string }
+
+func (c recordingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+func (c recordingConn) Close() error { return nil }
+func (c recordingConn) Begin() (driver.Tx, error) {
+	*c.log = append(*c.log, "BEGIN")
+	return recordingTx(c), nil
+}
+func (c recordingConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	*c.log = append(*c.log, strings.TrimSpace(query))
+	return driver.RowsAffected(0), nil
+}
+
+type recordingTx struct{ log *[]string }
+
+func (t recordingTx) Commit() error   { *t.log = append(*t.log, "COMMIT"); return nil }
+func (t recordingTx) Rollback() error { return nil }
+
+func openRecording(t *testing.T) (*sql.DB, *[]string) {
+	t.Helper()
+	var log []string
+	db := sql.OpenDB(connector{recordingDriver{&log}})
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db, &log
+}
+
+type connector struct{ d recordingDriver }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return c.d.Open("") }
+func (c connector) Driver() driver.Driver                        { return c.d }
+
+const recordVersion = `INSERT INTO schema_migrations (version) VALUES ($1)`
+
+func TestApplyMigration_WrapsInTransaction(t *testing.T) {
+	db, log := openRecording(t)
+	if err := applyMigration(db, "021_x.sql", "CREATE INDEX a ON t (c);"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"BEGIN", "CREATE INDEX a ON t (c);", recordVersion, "COMMIT"}
+	if !reflect.DeepEqual(*log, want) {
+		t.Fatalf("expected %q, got %q", want, *log)
+	}
+}
+
+func TestApplyMigration_NoTxSkipsTransaction(t *testing.T) {
+	db, log := openRecording(t)
+	sqlText := "-- build without blocking writes\nCREATE INDEX CONCURRENTLY IF NOT EXISTS a ON t (c);\nCREATE INDEX CONCURRENTLY IF NOT EXISTS b ON t (d);\n"
+	if err := applyMigration(db, "022_x.no-tx.sql", sqlText); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"-- build without blocking writes\nCREATE INDEX CONCURRENTLY IF NOT EXISTS a ON t (c)",
+		"CREATE INDEX CONCURRENTLY IF NOT EXISTS b ON t (d)",
+		recordVersion,
+	}
+	if !reflect.DeepEqual(*log, want) {
+		t.Fatalf("expected %q, got %q", want, *log)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	got := splitStatements(`
+SELECT ';' AS "a;b"; -- trailing; comment
+/* block; comment */
+DO $body$ BEGIN PERFORM 1; END $body$;
+SELECT 'it''s; fine';
+-- only a comment;
+`)
+	want := []string{
+		`SELECT ';' AS "a;b"`,
+		"-- trailing; comment\n/* block; comment */\nDO $body$ BEGIN PERFORM 1; END $body$",
+		`SELECT 'it''s; fine'`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+// TestMigrations_DatasetRowsCascade checks that every foreign key into a dataset's rows
+// cascades or clears on delete, so a hard dataset delete never trips over a reference.
+func TestMigrations_DatasetRowsCascade(t *testing.T) {
+	files, err := filepath.Glob("../../migrations/*.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no migrations found: %v", err)
+	}
+	ref := regexp.MustCompile(`(?i)REFERENCES\s+(datasets|conversations|conversation_messages|dataset_items|import_runs)\s*\(id\)([^,;\n]*)`)
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range ref.FindAllStringSubmatch(string(b), -1) {
+			rest := strings.ToUpper(m[2])
+			if !strings.Contains(rest, "ON DELETE CASCADE") && !strings.Contains(rest, "ON DELETE SET NULL") {
+				t.Errorf("%s: reference to %s(id) neither cascades nor clears on delete: %s", filepath.Base(f), m[1], strings.TrimSpace(m[0]))
+			}
+		}
+	}
+}
+
+func TestMigrations_MessageChangesTouchConversation(t *testing.T) {
+	b, err := os.ReadFile("../../migrations/025_messages_updated_at.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(b)
+	fn := regexp.MustCompile(`(?s)FUNCTION conversations_touch_messages\(\).*?\$\$ LANGUAGE plpgsql`).FindString(text)
+	if !strings.Contains(fn, "updated_at = GREATEST(updated_at, now())") || !strings.Contains(fn, "messages_updated_at = now()") {
+		t.Fatalf("expected the trigger function to stamp updated_at and messages_updated_at: %s", fn)
+	}
+	for _, event := range []string{"INSERT", "UPDATE", "DELETE"} {
+		trigger := regexp.MustCompile(`(?s)AFTER ` + event + ` ON conversation_messages\s+REFERENCING (NEW|OLD) TABLE AS changed\s+FOR EACH STATEMENT EXECUTE FUNCTION conversations_touch_messages\(\)`)
+		if !trigger.MatchString(text) {
+			t.Errorf("expected a statement-level %s trigger on conversation_messages touching the conversation", event)
+		}
+	}
+}
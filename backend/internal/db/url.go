@@ -0,0 +1,44 @@
+package db
+
+import (
+	"net"
+	"net/url"
+)
+
+// URLFromComponents builds a Postgres URL from libpq-style component variables (PGHOST,
+// PGPORT, PGUSER, PGPASSWORD, PGDATABASE, PGSSLMODE) read through getenv, escaping the user
+// and password. It returns "" when none of PGHOST, PGUSER and PGDATABASE is set. A PGHOST
+// starting with "/" is a Unix socket directory and goes in the host query parameter.
+func URLFromComponents(getenv func(string) string) string {
+	host, user, name := getenv("PGHOST"), getenv("PGUSER"), getenv("PGDATABASE")
+	if host == "" && user == "" && name == "" {
+		return ""
+	}
+	u := url.URL{Scheme: "postgres", Path: "/" + name}
+	if user != "" {
+		if pw := getenv("PGPASSWORD"); pw != "" {
+			u.User = url.UserPassword(user, pw)
+		} else {
+			u.User = url.User(user)
+		}
+	}
+	q := url.Values{}
+	port := getenv("PGPORT")
+	if port == "" {
+		port = "5432"
+	}
+	switch {
+	case host == "":
+		u.Host = net.JoinHostPort("localhost", port)
+	case host[0] == '/':
+		q.Set("host", host)
+		q.Set("port", port)
+	default:
+		u.Host = net.JoinHostPort(host, port)
+	}
+	if mode := getenv("PGSSLMODE"); mode != "" {
+		q.Set("sslmode", mode)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
@@ -0,0 +1,44 @@
+package db
+
+import (
+	"net/url"
+	"testing"
+)
+
+func envMap(m map[string]string) func(string) string {
+	return func(k string) string { return m[k] }
+}
+
+func TestURLFromComponents(t *testing.T) {
+	got := URLFromComponents(envMap(map[string]string{
+		"PGHOST":     "db.internal",
+		"PGUSER":     "datalab",
+		"PGPASSWORD": "p@ss:w/rd?#%",
+		"PGDATABASE": "datalab",
+		"PGSSLMODE":  "require",
+	}))
+	u, err := url.Parse(got)
+	if err != nil {
+		t.Fatalf("unparseable url %q: %v", got, err)
+	}
+	if pw, _ := u.User.Password(); pw != "p@ss:w/rd?#%" || u.User.Username() != "datalab" {
+		t.Fatalf("credentials not round-tripped: %q", got)
+	}
+	if u.Host != "db.internal:5432" || u.Path != "/datalab" || u.Query().Get("sslmode") != "require" {
+		t.Fatalf("unexpected url %q", got)
+	}
+}
+
+func TestURLFromComponents_Socket(t *testing.T) {
+	got := URLFromComponents(envMap(map[string]string{"PGHOST": "/var/run/postgresql", "PGDATABASE": "datalab"}))
+	want := "postgres:///datalab?host=%2Fvar%2Frun%2Fpostgresql&port=5432"
+	if got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestURLFromComponents_Unset(t *testing.T) {
+	if got := URLFromComponents(envMap(map[string]string{"PGPASSWORD": "x"})); got != "" {
+		t.Fatalf("expected no url, got %q", got)
+	}
+}
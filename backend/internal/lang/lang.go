@@ -0,0 +1,129 @@
+// Package lang is a small, dependency-free language guesser for tagging imported text.
+//
+// Non-Latin scripts are identified by their Unicode ranges. Latin-script text is scored
+// against short lists of each language's most frequent words (word unigrams), which
+// stays usable on the one-line messages typical of chat data where character n-gram
+// profiles need far more text.
+package lang
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Unknown is returned when the text is too short or too ambiguous to call.
+const Unknown = ""
+
+// minLatinHits is how many common words a Latin-script guess needs.
+const minLatinHits = 2
+
+var commonWords = map[string][]string{
+	"en": {"the", "and", "is", "are", "was", "you", "that", "it", "of", "to", "in", "for", "with", "this", "what", "how", "can", "i", "my", "do", "have", "not", "be", "on"},
+	"es": {"el", "la", "los", "las", "de", "que", "y", "es", "en", "un", "una", "por", "para", "con", "no", "lo", "como", "qué", "cómo", "pero", "está", "se", "mi", "yo"},
+	"fr": {"le", "la", "les", "de", "des", "et", "est", "un", "une", "que", "qui", "pour", "dans", "pas", "je", "vous", "il", "ce", "sur", "avec", "comment", "mon", "ne", "suis"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "ich", "du", "sie", "es", "mit", "zu", "den", "wie", "was", "auf", "für", "sind", "mein", "auch", "bitte"},
+	"pt": {"o", "a", "os", "as", "de", "que", "e", "é", "um", "uma", "para", "com", "não", "em", "do", "da", "como", "eu", "você", "mas", "está", "meu", "se", "isso"},
+	"it": {"il", "lo", "la", "gli", "di", "che", "e", "è", "un", "una", "per", "con", "non", "sono", "come", "del", "della", "io", "mi", "ma", "questo", "cosa", "ho", "si"},
+	"nl": {"de", "het", "een", "en", "is", "van", "dat", "niet", "ik", "je", "met", "op", "voor", "zijn", "wat", "hoe", "mijn", "ook", "er", "maar", "dit", "te", "naar", "wij"},
+}
+
+var wordLangs = func() map[string][]string {
+	m := map[string][]string{}
+	for l, words := range commonWords {
+		for _, w := range words {
+			m[w] = append(m[w], l)
+		}
+	}
+	return m
+}()
+
+// Detect returns the ISO 639-1 code of the dominant language of s, or Unknown.
+func Detect(s string) string {
+	if l := detectScript(s); l != "latin" {
+		return l
+	}
+
+	hits := map[string]int{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		for _, l := range wordLangs[w] {
+			hits[l]++
+		}
+	}
+
+	best, bestN, tie := Unknown, 0, false
+	for l, n := range hits {
+		switch {
+		case n > bestN:
+			best, bestN, tie = l, n, false
+		case n == bestN:
+			tie = true
+		}
+	}
+	if bestN < minLatinHits || tie {
+		return Unknown
+	}
+	return best
+}
+
+// detectScript classifies s by the script most of its letters use. It returns "latin" for
+// Latin (or letterless) text, which Detect then looks at word by word.
+func detectScript(s string) string {
+	var latin, han, kana, hangul, cyrillic, arabic, other int
+	for _, r := range s {
+		switch {
+		case !unicode.IsLetter(r):
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Arabic, r):
+			arabic++
+		default:
+			other++
+		}
+	}
+	total := latin + han + kana + hangul + cyrillic + arabic + other
+	if total == 0 || latin*2 >= total {
+		return "latin"
+	}
+	switch {
+	case kana > 0 && kana+han >= total/2:
+		return "ja" // Japanese mixes kana into Han text; Chinese has none
+	case han >= total/2:
+		return "zh"
+	case hangul >= total/2:
+		return "ko"
+	case cyrillic >= total/2:
+		return "ru"
+	case arabic >= total/2:
+		return "ar"
+	default:
+		return Unknown
+	}
+}
+
+// Normalize lowercases a caller-supplied language code and checks it looks like an
+// ISO 639 code (2-3 ASCII letters). "" is valid and means unknown.
+func Normalize(code string) (string, bool) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if code == "" {
+		return Unknown, true
+	}
+	if len(code) < 2 || len(code) > 3 {
+		return Unknown, false
+	}
+	for _, r := range code {
+		if r < 'a' || r > 'z' {
+			return Unknown, false
+		}
+	}
+	return code, true
+}
@@ -0,0 +1,60 @@
+package lang
+
+import "testing"
+
+func TestDetect_ShortStrings(t *testing.T) {
+	cases := map[string]string{
+		"What is the capital of France?":     "en",
+		"How do I reset my password?":        "en",
+		"¿Cómo puedo cambiar la contraseña?": "es",
+		"Je ne sais pas ce que c'est.":       "fr",
+		"Ich weiß nicht, wie das geht.":      "de",
+		"Eu não sei como isso funciona.":     "pt",
+		"Non so come funziona questo.":       "it",
+		"Ik weet niet hoe dat werkt.":        "nl",
+		"Привет, как дела?":                  "ru",
+		"这是一个测试":                             "zh",
+		"これはテストです":                           "ja",
+		"안녕하세요 반갑습니다":                        "ko",
+		"مرحبا كيف حالك":                     "ar",
+	}
+	for s, want := range cases {
+		if got := Detect(s); got != want {
+			t.Errorf("Detect(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
+
+func TestDetect_TooShortOrAmbiguous(t *testing.T) {
+	for _, s := range []string{"", "ok", "12345 !!!", "Hola", "de la"} {
+		if got := Detect(s); got != Unknown {
+			t.Errorf("Detect(%q) = %q, want unknown", s, got)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if got, ok := Normalize(" EN "); !ok || got != "en" {
+		t.Fatalf("expected en, got %q %v", got, ok)
+	}
+	if got, ok := Normalize(""); !ok || got != Unknown {
+		t.Fatalf("empty should be valid and unknown, got %q %v", got, ok)
+	}
+	for _, bad := range []string{"e", "engl", "e1", "en-US"} {
+		if _, ok := Normalize(bad); ok {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestCommonWords_NoDuplicates(t *testing.T) {
+	for code, words := range commonWords {
+		seen := map[string]bool{}
+		for _, w := range words {
+			if seen[w] {
+				t.Fatalf("%s lists %q twice", code, w)
+			}
+			seen[w] = true
+		}
+	}
+}
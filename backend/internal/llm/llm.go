@@ -0,0 +1,186 @@
+// Package llm calls an OpenAI-compatible endpoint: chat completions to regenerate and
+// generate assistant replies, and embeddings for semantic search. Only simple, non-streaming
+// calls are used.
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxErrorBody bounds how much of an upstream error response is kept for passthrough.
+const maxErrorBody = 4 << 10
+
+// Message is one chat message sent to the endpoint.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Client talks to {BaseURL}/chat/completions. A nil Client, or one without a BaseURL or
+// Model, is disabled.
+type Client struct {
+	BaseURL string
+	APIKey  string
+	Model   string
+	HTTP    *http.Client
+}
+
+// New returns a client for baseURL, or nil when baseURL or model is empty so callers can
+// treat the feature as switched off.
+func New(baseURL, apiKey, model string, timeout time.Duration) *Client {
+	baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	model = strings.TrimSpace(model)
+	if baseURL == "" || model == "" {
+		return nil
+	}
+	return &Client{BaseURL: baseURL, APIKey: apiKey, Model: model, HTTP: &http.Client{Timeout: timeout}}
+}
+
+// Enabled reports whether c can be used.
+func (c *Client) Enabled() bool {
+	return c != nil && c.BaseURL != "" && c.Model != ""
+}
+
+// ErrDisabled is returned by Complete on a disabled client.
+var ErrDisabled = errors.New("llm: no completion endpoint configured")
+
+// UpstreamError is a non-2xx answer from the endpoint; Body is its (truncated) response body.
+type UpstreamError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("llm: upstream returned %d: %s", e.StatusCode, e.Body)
+}
+
+// Params overrides per-call completion settings; zero values leave the endpoint's defaults
+// (and the client's model) in place.
+type Params struct {
+	Model       string   `json:"model,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+}
+
+type completionRequest struct {
+	Model       string    `json:"model"`
+	Messages    []Message `json:"messages"`
+	Stream      bool      `json:"stream"`
+	Temperature *float64  `json:"temperature,omitempty"`
+	MaxTokens   int       `json:"max_tokens,omitempty"`
+}
+
+type completionResponse struct {
+	Choices []struct {
+		Message Message `json:"message"`
+	} `json:"choices"`
+}
+
+// Complete sends msgs and returns the first choice's content.
+func (c *Client) Complete(ctx context.Context, msgs []Message) (string, error) {
+	return c.CompleteWith(ctx, msgs, Params{})
+}
+
+// CompleteWith is Complete with per-call Params.
+func (c *Client) CompleteWith(ctx context.Context, msgs []Message, p Params) (string, error) {
+	if !c.Enabled() {
+		return "", ErrDisabled
+	}
+	req := completionRequest{Model: c.Model, Messages: msgs, Temperature: p.Temperature, MaxTokens: p.MaxTokens}
+	if p.Model != "" {
+		req.Model = p.Model
+	}
+	var out completionResponse
+	if err := c.post(ctx, "/chat/completions", req, &out); err != nil {
+		return "", err
+	}
+	if len(out.Choices) == 0 {
+		return "", errors.New("llm: response has no choices")
+	}
+	return strings.TrimSpace(out.Choices[0].Message.Content), nil
+}
+
+type embeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// Embed returns one embedding per input, in input order, from {BaseURL}/embeddings.
+func (c *Client) Embed(ctx context.Context, inputs []string) ([][]float32, error) {
+	if !c.Enabled() {
+		return nil, ErrDisabled
+	}
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+	var out embeddingResponse
+	if err := c.post(ctx, "/embeddings", embeddingRequest{Model: c.Model, Input: inputs}, &out); err != nil {
+		return nil, err
+	}
+	vecs := make([][]float32, len(inputs))
+	for _, d := range out.Data {
+		if d.Index < 0 || d.Index >= len(vecs) {
+			return nil, fmt.Errorf("llm: embedding index %d out of range", d.Index)
+		}
+		vecs[d.Index] = d.Embedding
+	}
+	for i, v := range vecs {
+		if len(v) == 0 {
+			return nil, fmt.Errorf("llm: no embedding for input %d", i)
+		}
+		if len(v) != len(vecs[0]) {
+			return nil, fmt.Errorf("llm: embeddings have mixed dimensions (%d and %d)", len(vecs[0]), len(v))
+		}
+	}
+	return vecs, nil
+}
+
+// post sends body as JSON to {BaseURL}{path} and decodes a 2xx answer into out.
+func (c *Client) post(ctx context.Context, path string, body, out any) error {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+path, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	httpClient := c.HTTP
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	res, err := httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		raw, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+		return &UpstreamError{StatusCode: res.StatusCode, Body: strings.TrimSpace(string(raw))}
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("llm: decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNew_Disabled(t *testing.T) {
+	if c := New("", "k", "m", time.Second); c != nil || c.Enabled() {
+		t.Fatal("expected no client without a base URL")
+	}
+	if c := New("http://x", "k", " ", time.Second); c != nil {
+		t.Fatal("expected no client without a model")
+	}
+	var c *Client
+	if _, err := c.Complete(context.Background(), nil); !errors.Is(err, ErrDisabled) {
+		t.Fatalf("expected ErrDisabled, got %v", err)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer key" {
+			t.Errorf("unexpected request %s %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		var req completionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Model != "m" || req.Stream || len(req.Messages) != 2 {
+			t.Errorf("unexpected body %+v %v", req, err)
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":" hi there "}}]}`))
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL+"/v1/", "key", "m", time.Second)
+	got, err := c.Complete(context.Background(), []Message{{Role: "system", Content: "s"}, {Role: "user", Content: "hi"}})
+	if err != nil || got != "hi there" {
+		t.Fatalf("got %q %v", got, err)
+	}
+}
+
+func TestCompleteWith_Params(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req completionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Model != "other" || req.Temperature == nil || *req.Temperature != 0.2 || req.MaxTokens != 64 {
+			t.Errorf("unexpected body %+v %v", req, err)
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer srv.Close()
+
+	temp := 0.2
+	got, err := New(srv.URL, "", "m", time.Second).CompleteWith(context.Background(), nil, Params{Model: "other", Temperature: &temp, MaxTokens: 64})
+	if err != nil || got != "ok" {
+		t.Fatalf("got %q %v", got, err)
+	}
+}
+
+func TestComplete_UpstreamError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"message":"rate limited"}}`, http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.URL, "", "m", time.Second).Complete(context.Background(), nil)
+	var ue *UpstreamError
+	if !errors.As(err, &ue) || ue.StatusCode != http.StatusTooManyRequests || ue.Body != `{"error":{"message":"rate limited"}}` {
+		t.Fatalf("expected the upstream error passed through, got %v", err)
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req embeddingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.URL.Path != "/embeddings" || req.Model != "e" || len(req.Input) != 2 {
+			t.Errorf("unexpected request %s %+v %v", r.URL.Path, req, err)
+		}
+		// Out of order on purpose: results are placed by index.
+		w.Write([]byte(`{"data":[{"index":1,"embedding":[0.5,0.5]},{"index":0,"embedding":[1,0]}]}`))
+	}))
+	defer srv.Close()
+
+	got, err := New(srv.URL, "", "e", time.Second).Embed(context.Background(), []string{"a", "b"})
+	if err != nil || len(got) != 2 || got[0][0] != 1 || got[1][0] != 0.5 {
+		t.Fatalf("got %v %v", got, err)
+	}
+}
@@ -0,0 +1,334 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	AlternativeStatusDraft    = "draft"
+	AlternativeStatusAccepted = "accepted"
+	AlternativeStatusReplaced = "replaced"
+)
+
+// MessageAlternative is a candidate text for an assistant message, regenerated (Model) or
+// written by a curator (Author). Drafts await review; promoting one marks it accepted and
+// stores the text it replaced as a "replaced" row, which can be promoted back in turn.
+// Alternatives belong to a message row (migration 037), so they follow it when messages are
+// renumbered; when the messages are rewritten they move to the assistant message at the same
+// idx (migration 039) and are deleted only when there is none. MessageIdx is the message's
+// current position.
+type MessageAlternative struct {
+	ID             int64           `json:"id"`
+	ConversationID int64           `json:"conversation_id"`
+	MessageID      int64           `json:"-"`
+	MessageIdx     int             `json:"message_idx"`
+	Content        string          `json:"content"`
+	Model          string          `json:"model"`
+	Author         string          `json:"author"`
+	Meta           json.RawMessage `json:"meta"`
+	Status         string          `json:"status"`
+	CreatedAt      time.Time       `json:"created_at"`
+	AcceptedAt     *time.Time      `json:"accepted_at"`
+}
+
+const alternativeColumns = `a.id, a.conversation_id, a.message_id, m.idx, a.content, a.model, a.author, a.meta, a.status, a.created_at, a.accepted_at`
+
+// alternativeFrom joins each alternative to its message, which carries the idx.
+const alternativeFrom = `message_alternatives a JOIN conversation_messages m ON m.id = a.message_id`
+
+func scanAlternative(row interface{ Scan(...any) error }) (MessageAlternative, error) {
+	var a MessageAlternative
+	err := row.Scan(&a.ID, &a.ConversationID, &a.MessageID, &a.MessageIdx, &a.Content, &a.Model, &a.Author, &a.Meta, &a.Status, &a.CreatedAt, &a.AcceptedAt)
+	return a, err
+}
+
+// CheckAlternativeTarget reports ErrInvalidInput unless idx names an assistant message of
+// msgs, the only messages that take alternatives.
+func CheckAlternativeTarget(msgs []Message, idx int) error {
+	if idx < 0 || idx >= len(msgs) {
+		return fmt.Errorf("%w: message %d does not exist", ErrInvalidInput, idx)
+	}
+	if msgs[idx].Role != RoleAssistant {
+		return fmt.Errorf("%w: message %d is a %s message; only assistant messages have alternatives", ErrInvalidInput, idx, msgs[idx].Role)
+	}
+	return nil
+}
+
+// RegenerationHistory returns the messages before idx, the context an assistant reply at idx
+// was written from. idx must name an assistant message.
+func RegenerationHistory(msgs []Message, idx int) ([]Message, error) {
+	if err := CheckAlternativeTarget(msgs, idx); err != nil {
+		return nil, err
+	}
+	return msgs[:idx], nil
+}
+
+// LoadConversationMessages returns the messages of conversation id in idx order; a missing
+// conversation is ErrNotFound.
+func LoadConversationMessages(ctx context.Context, db *sql.DB, id int64) ([]Message, error) {
+	var exists bool
+	if err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM conversations WHERE id = $1)`, id).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return loadMessages(ctx, db, id)
+}
+
+// CreateMessageAlternative stores a.Content as a draft alternative for message a.MessageIdx
+// of a.ConversationID, or for message row a.MessageID when set, with its model, author and
+// meta (empty meta is stored as {}). The message must be an assistant message; otherwise, or
+// when it is missing, ErrNotFound.
+func CreateMessageAlternative(ctx context.Context, db *sql.DB, a MessageAlternative) (MessageAlternative, error) {
+	content := strings.TrimSpace(a.Content)
+	if content == "" {
+		return MessageAlternative{}, fmt.Errorf("%w: alternative content is empty", ErrInvalidInput)
+	}
+	meta := a.Meta
+	if len(meta) == 0 || string(meta) == "null" {
+		meta = json.RawMessage("{}")
+	}
+	target, key := "idx = $2", any(a.MessageIdx)
+	if a.MessageID > 0 {
+		target, key = "id = $2", a.MessageID
+	}
+	a, err := scanAlternative(db.QueryRowContext(ctx, `
+WITH a AS (
+  INSERT INTO message_alternatives (conversation_id, message_id, content, model, author, meta)
+  SELECT conversation_id, id, $3, $4, $5, $6 FROM conversation_messages
+  WHERE conversation_id = $1 AND `+target+` AND role = 'assistant'
+  RETURNING *
+)
+SELECT `+alternativeColumns+`
+FROM a JOIN conversation_messages m ON m.id = a.message_id
+`, a.ConversationID, key, content, a.Model, strings.TrimSpace(a.Author), meta))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return MessageAlternative{}, ErrNotFound
+		}
+		return MessageAlternative{}, err
+	}
+	return a, nil
+}
+
+// ListMessageAlternatives lists a conversation's alternatives, newest first per message.
+func ListMessageAlternatives(ctx context.Context, db *sql.DB, conversationID int64) ([]MessageAlternative, error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT `+alternativeColumns+`
+FROM `+alternativeFrom+`
+WHERE a.conversation_id = $1
+ORDER BY m.idx ASC, a.created_at DESC, a.id DESC
+`, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []MessageAlternative{}
+	for rows.Next() {
+		a, err := scanAlternative(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// AttachAlternatives sets AlternativeCount on every message of c to the number of its
+// alternatives that could be promoted (drafts and replaced texts); with expand it also
+// inlines those alternatives, newest first.
+func AttachAlternatives(ctx context.Context, db *sql.DB, c *Conversation, expand bool) error {
+	counts := map[int]int{}
+	byIdx := map[int][]MessageAlternative{}
+	if expand {
+		rows, err := db.QueryContext(ctx, `
+SELECT `+alternativeColumns+`
+FROM `+alternativeFrom+`
+WHERE a.conversation_id = $1 AND a.status <> $2
+ORDER BY m.idx ASC, a.created_at DESC, a.id DESC
+`, c.ID, AlternativeStatusAccepted)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			a, err := scanAlternative(rows)
+			if err != nil {
+				return err
+			}
+			byIdx[a.MessageIdx] = append(byIdx[a.MessageIdx], a)
+			counts[a.MessageIdx]++
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	} else {
+		rows, err := db.QueryContext(ctx, `
+SELECT m.idx, COUNT(*)
+FROM `+alternativeFrom+`
+WHERE a.conversation_id = $1 AND a.status <> $2
+GROUP BY m.idx
+`, c.ID, AlternativeStatusAccepted)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var idx, n int
+			if err := rows.Scan(&idx, &n); err != nil {
+				return err
+			}
+			counts[idx] = n
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	for i := range c.Messages {
+		n := counts[i]
+		c.Messages[i].AlternativeCount = &n
+		if expand {
+			c.Messages[i].Alternatives = byIdx[i]
+			if c.Messages[i].Alternatives == nil {
+				c.Messages[i].Alternatives = []MessageAlternative{}
+			}
+		}
+	}
+	return nil
+}
+
+// alternativePositions returns the idx of the message each alternative of conversation id
+// belongs to, keyed by alternative id, for reattachAlternatives.
+func alternativePositions(ctx context.Context, tx *sql.Tx, id int64) (map[int64]int64, error) {
+	rows, err := tx.QueryContext(ctx, `
+SELECT a.id, m.idx
+FROM `+alternativeFrom+`
+WHERE a.conversation_id = $1
+`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[int64]int64{}
+	for rows.Next() {
+		var altID, idx int64
+		if err := rows.Scan(&altID, &idx); err != nil {
+			return nil, err
+		}
+		out[altID] = idx
+	}
+	return out, rows.Err()
+}
+
+// reattachAlternatives points the alternatives of conversation id, detached when its
+// messages were deleted and reinserted (migration 039), at the assistant message now at
+// the idx they had before, so drafts and replaced texts survive a rewrite. Those whose
+// position is gone or no longer holds an assistant message are deleted.
+func reattachAlternatives(ctx context.Context, tx *sql.Tx, id int64, positions map[int64]int64) error {
+	if len(positions) == 0 {
+		return nil
+	}
+	ids := make([]int64, 0, len(positions))
+	idxs := make([]int64, 0, len(positions))
+	for altID, idx := range positions {
+		ids = append(ids, altID)
+		idxs = append(idxs, idx)
+	}
+	if _, err := tx.ExecContext(ctx, `
+UPDATE message_alternatives a
+SET message_id = m.id
+FROM unnest($2::bigint[], $3::bigint[]) AS p(id, idx)
+JOIN conversation_messages m ON m.conversation_id = $1 AND m.idx = p.idx AND m.role = 'assistant'
+WHERE a.id = p.id
+`, id, ids, idxs); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `DELETE FROM message_alternatives WHERE conversation_id = $1 AND message_id IS NULL`, id)
+	return err
+}
+
+// AcceptMessageAlternative promotes alternative altID, a draft or a previously replaced
+// text, into its message, keeps the text it replaces as a "replaced" alternative, records
+// the swap in audit_log and returns the updated conversation. A missing alternative,
+// including one whose message position was dropped by a rewrite, is ErrNotFound; an accepted one, or
+// one whose message is no longer an assistant message, is ErrConflict. check, when set, vets
+// the content about to go live at its message's idx, and its error aborts the swap. Only the
+// content is swapped; message meta stays as it is.
+func AcceptMessageAlternative(ctx context.Context, db *sql.DB, conversationID, altID int64, check func(idx int, content string) error) (Conversation, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return Conversation{}, err
+	}
+	defer tx.Rollback()
+
+	alt, err := scanAlternative(tx.QueryRowContext(ctx, `
+SELECT `+alternativeColumns+`
+FROM `+alternativeFrom+`
+WHERE a.id = $1 AND a.conversation_id = $2
+FOR UPDATE OF a
+`, altID, conversationID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Conversation{}, ErrNotFound
+		}
+		return Conversation{}, err
+	}
+	if alt.Status == AlternativeStatusAccepted {
+		return Conversation{}, fmt.Errorf("%w: alternative %d is already accepted", ErrConflict, altID)
+	}
+
+	var role, previous string
+	err = tx.QueryRowContext(ctx, `
+SELECT role, content FROM conversation_messages WHERE id = $1 FOR UPDATE
+`, alt.MessageID).Scan(&role, &previous)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Conversation{}, ErrNotFound
+		}
+		return Conversation{}, err
+	}
+	if Role(role) != RoleAssistant {
+		return Conversation{}, fmt.Errorf("%w: message %d is no longer an assistant message", ErrConflict, alt.MessageIdx)
+	}
+	if check != nil {
+		if err := check(alt.MessageIdx, alt.Content); err != nil {
+			return Conversation{}, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+UPDATE conversation_messages SET content = $2 WHERE id = $1
+`, alt.MessageID, alt.Content); err != nil {
+		return Conversation{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+UPDATE message_alternatives SET status = $2, accepted_at = now() WHERE id = $1
+`, altID, AlternativeStatusAccepted); err != nil {
+		return Conversation{}, err
+	}
+	var replacedID int64
+	if err := tx.QueryRowContext(ctx, `
+INSERT INTO message_alternatives (conversation_id, message_id, content, status)
+VALUES ($1, $2, $3, $4)
+RETURNING id
+`, conversationID, alt.MessageID, previous, AlternativeStatusReplaced).Scan(&replacedID); err != nil {
+		return Conversation{}, err
+	}
+	detail, _ := json.Marshal(map[string]any{"message_idx": alt.MessageIdx, "alternative_id": altID, "replaced_id": replacedID})
+	if err := insertAuditEntry(ctx, tx, "conversation", conversationID, "accept_alternative", detail); err != nil {
+		return Conversation{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Conversation{}, err
+	}
+	return GetConversation(ctx, db, conversationID)
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRegenerationHistory(t *testing.T) {
+	msgs := []Message{
+		{Role: RoleSystem, Content: "s"},
+		{Role: RoleUser, Content: "u1"},
+		{Role: RoleAssistant, Content: "a1"},
+		{Role: RoleUser, Content: "u2"},
+		{Role: RoleAssistant, Content: "a2"},
+	}
+	got, err := RegenerationHistory(msgs, 4)
+	if err != nil || len(got) != 4 || got[3].Content != "u2" {
+		t.Fatalf("expected the four messages before idx 4, got %v %v", got, err)
+	}
+	for _, idx := range []int{-1, 1, 5} {
+		if _, err := RegenerationHistory(msgs, idx); !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("idx %d: expected ErrInvalidInput, got %v", idx, err)
+		}
+	}
+}
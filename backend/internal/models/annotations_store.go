@@ -0,0 +1,150 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxAnnotationKeyLen caps ItemAnnotation.Key.
+const MaxAnnotationKeyLen = 100
+
+type ItemAnnotation struct {
+	ItemID    int64           `json:"item_id"`
+	Key       string          `json:"key"`
+	Value     json.RawMessage `json:"value"`
+	Author    string          `json:"author"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+func ListItemAnnotations(ctx context.Context, db *sql.DB, itemID int64) ([]ItemAnnotation, error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT item_id, key, value, author, created_at
+FROM item_annotations
+WHERE item_id = $1
+ORDER BY key ASC, author ASC
+`, itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []ItemAnnotation{}
+	for rows.Next() {
+		var a ItemAnnotation
+		if err := rows.Scan(&a.ItemID, &a.Key, &a.Value, &a.Author, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// SetItemAnnotation stores value under key for author, overwriting that author's previous value.
+func SetItemAnnotation(ctx context.Context, db *sql.DB, itemID int64, key string, author string, value json.RawMessage) (ItemAnnotation, error) {
+	key = strings.TrimSpace(key)
+	author = strings.TrimSpace(author)
+	if key == "" || len(key) > MaxAnnotationKeyLen {
+		return ItemAnnotation{}, fmt.Errorf("%w: key must be 1-%d characters", ErrInvalidInput, MaxAnnotationKeyLen)
+	}
+	if len(value) == 0 || !json.Valid(value) {
+		return ItemAnnotation{}, fmt.Errorf("%w: value must be valid JSON", ErrInvalidInput)
+	}
+
+	var exists bool
+	if err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM dataset_items WHERE id = $1)`, itemID).Scan(&exists); err != nil {
+		return ItemAnnotation{}, err
+	}
+	if !exists {
+		return ItemAnnotation{}, ErrNotFound
+	}
+
+	var a ItemAnnotation
+	err := db.QueryRowContext(ctx, `
+INSERT INTO item_annotations (item_id, key, value, author)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (item_id, key, author) DO UPDATE
+SET value = EXCLUDED.value,
+    created_at = now()
+RETURNING item_id, key, value, author, created_at
+`, itemID, key, value, author).Scan(&a.ItemID, &a.Key, &a.Value, &a.Author, &a.CreatedAt)
+	if err != nil {
+		return ItemAnnotation{}, err
+	}
+	return a, nil
+}
+
+// DeleteItemAnnotation removes author's value for key.
+func DeleteItemAnnotation(ctx context.Context, db *sql.DB, itemID int64, key string, author string) error {
+	res, err := db.ExecContext(ctx, `
+DELETE FROM item_annotations
+WHERE item_id = $1 AND key = $2 AND author = $3
+`, itemID, strings.TrimSpace(key), strings.TrimSpace(author))
+	if err != nil {
+		return err
+	}
+	a, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if a == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AnnotationFilter matches items having an annotation Key whose value compares to Value.
+// Ordering operators need a numeric Value and only match numeric annotation values.
+type AnnotationFilter struct {
+	Key   string
+	Op    string
+	Value string
+}
+
+var annotationFilterOps = []string{">=", "<=", "!=", "=", ">", "<"}
+
+// ParseAnnotationFilter parses expressions like "quality>=4" or "category=math".
+func ParseAnnotationFilter(s string) (AnnotationFilter, error) {
+	s = strings.TrimSpace(s)
+	for i := 0; i < len(s); i++ {
+		for _, op := range annotationFilterOps {
+			if !strings.HasPrefix(s[i:], op) {
+				continue
+			}
+			f := AnnotationFilter{
+				Key:   strings.TrimSpace(s[:i]),
+				Op:    op,
+				Value: strings.TrimSpace(s[i+len(op):]),
+			}
+			if f.Key == "" || f.Value == "" {
+				return AnnotationFilter{}, fmt.Errorf("%w: invalid annotation filter %q", ErrInvalidInput, s)
+			}
+			if f.Op != "=" && f.Op != "!=" {
+				if _, err := strconv.ParseFloat(f.Value, 64); err != nil {
+					return AnnotationFilter{}, fmt.Errorf("%w: %s needs a numeric value", ErrInvalidInput, f.Op)
+				}
+			}
+			return f, nil
+		}
+	}
+	return AnnotationFilter{}, fmt.Errorf("%w: invalid annotation filter %q", ErrInvalidInput, s)
+}
+
+// sql renders the filter as an EXISTS clause over item_annotations for the dataset_items row,
+// with key and value bound at positions argN and argN+1.
+func (f AnnotationFilter) sql(argN int) string {
+	value := fmt.Sprintf("$%d::text", argN+1)
+	cmp := fmt.Sprintf("a.value #>> '{}' %s %s", f.Op, value)
+	if _, err := strconv.ParseFloat(f.Value, 64); err == nil {
+		fallback := cmp // equality still matches string annotations like "4"
+		if f.Op != "=" && f.Op != "!=" {
+			fallback = "false"
+		}
+		cmp = fmt.Sprintf("CASE WHEN jsonb_typeof(a.value) = 'number' THEN (a.value #>> '{}')::numeric %s (%s)::numeric ELSE %s END", f.Op, value, fallback)
+	}
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM item_annotations a WHERE a.item_id = dataset_items.id AND a.key = $%d AND %s)", argN, cmp)
+}
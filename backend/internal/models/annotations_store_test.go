@@ -0,0 +1,33 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseAnnotationFilter(t *testing.T) {
+	cases := []struct {
+		in   string
+		want AnnotationFilter
+	}{
+		{"quality>=4", AnnotationFilter{Key: "quality", Op: ">=", Value: "4"}},
+		{"quality < 2.5", AnnotationFilter{Key: "quality", Op: "<", Value: "2.5"}},
+		{"category=math", AnnotationFilter{Key: "category", Op: "=", Value: "math"}},
+		{"category!=math", AnnotationFilter{Key: "category", Op: "!=", Value: "math"}},
+	}
+	for _, tc := range cases {
+		got, err := ParseAnnotationFilter(tc.in)
+		if err != nil {
+			t.Fatalf("ParseAnnotationFilter(%q): %v", tc.in, err)
+		}
+		if got != tc.want {
+			t.Fatalf("ParseAnnotationFilter(%q) = %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"", "quality", ">=4", "quality>=", "category>math"} {
+		if _, err := ParseAnnotationFilter(bad); !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("ParseAnnotationFilter(%q): expected ErrInvalidInput, got %v", bad, err)
+		}
+	}
+}
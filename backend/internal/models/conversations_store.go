@@ -4,53 +4,71 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"strings"
 	"time"
 )
 
 type ListConversationsParams struct {
 	DatasetID int64
-	Split     Split
-	Status    ConversationStatus
-	Query     string
-	Limit     int
-	Offset    int
+	// Splits and Statuses keep conversations in any of the listed values; empty means any.
+	Splits   []Split
+	Statuses []ConversationStatus
+	Query    string
+	Limit    int
+	Offset   int
+
+	// MinAvgRating, when > 0, keeps only conversations whose average rating is at least this.
+	MinAvgRating float64
+
+	// Source and SourcePrefix filter on the source field, case-sensitively.
+	Source       string
+	SourcePrefix string
+
+	// HasOpenFlags, when set, keeps only conversations with (true) or without (false) an open
+	// moderation flag.
+	HasOpenFlags *bool
 }
 
 func ListConversations(ctx context.Context, db *sql.DB, p ListConversationsParams) ([]Conversation, error) {
-	q := strings.TrimSpace(p.Query)
-	if q == "" {
-		rows, err := db.QueryContext(ctx, `
-SELECT
-  c.id, c.dataset_id, c.split, c.status, c.tags, c.source, c.notes, c.created_at, c.updated_at,
-  (SELECT COUNT(*) FROM conversation_messages m WHERE m.conversation_id = c.id) AS message_count,
-  COALESCE((SELECT LEFT(m.content, 160) FROM conversation_messages m WHERE m.conversation_id = c.id AND m.role = 'user' ORDER BY m.idx ASC LIMIT 1), '') AS preview_user,
-  COALESCE((SELECT LEFT(m.content, 160) FROM conversation_messages m WHERE m.conversation_id = c.id AND m.role = 'assistant' ORDER BY m.idx ASC LIMIT 1), '') AS preview_assistant
-FROM conversations c
-WHERE c.dataset_id = $1 AND c.split = $2 AND c.status = $3
-ORDER BY c.id DESC
-LIMIT $4 OFFSET $5
-`, p.DatasetID, p.Split, p.Status, p.Limit, p.Offset)
-		if err != nil {
-			return nil, err
+	where := []string{"c.dataset_id = $1"}
+	args := []any{p.DatasetID}
+	where, args = appendInFilter(where, args, "c.split", p.Splits)
+	where, args = appendInFilter(where, args, "c.status", p.Statuses)
+
+	if q := strings.TrimSpace(p.Query); q != "" {
+		args = append(args, "%"+q+"%")
+		where = append(where, fmt.Sprintf("EXISTS (SELECT 1 FROM conversation_messages mm WHERE mm.conversation_id = c.id AND mm.content ILIKE $%d)", len(args)))
+	}
+	if p.MinAvgRating > 0 {
+		args = append(args, p.MinAvgRating)
+		where = append(where, fmt.Sprintf("%s >= $%d", avgRatingSQL, len(args)))
+	}
+	where, args = appendSourceFilter(where, args, "c.source", p.Source, p.SourcePrefix)
+	if p.HasOpenFlags != nil {
+		if *p.HasOpenFlags {
+			where = append(where, openFlagsSQL)
+		} else {
+			where = append(where, "NOT "+openFlagsSQL)
 		}
-		defer rows.Close()
-		return scanConversations(rows)
 	}
+	args = append(args, p.Limit, p.Offset)
 
-	pattern := "%" + q + "%"
-	rows, err := db.QueryContext(ctx, `
-SELECT DISTINCT
-  c.id, c.dataset_id, c.split, c.status, c.tags, c.source, c.notes, c.created_at, c.updated_at,
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`
+SELECT
+  c.id, c.dataset_id, c.split, c.status, c.tags, c.source, c.notes, c.lang, c.created_at, c.updated_at,
   (SELECT COUNT(*) FROM conversation_messages m WHERE m.conversation_id = c.id) AS message_count,
-  COALESCE((SELECT LEFT(m.content, 160) FROM conversation_messages m WHERE m.conversation_id = c.id AND m.role = 'user' ORDER BY m.idx ASC LIMIT 1), '') AS preview_user,
-  COALESCE((SELECT LEFT(m.content, 160) FROM conversation_messages m WHERE m.conversation_id = c.id AND m.role = 'assistant' ORDER BY m.idx ASC LIMIT 1), '') AS preview_assistant
+  COALESCE((SELECT LEFT(m.content, 160) FROM conversation_messages m WHERE m.conversation_id = c.id AND m.role = 'user' ORDER BY m.idx ASC, m.id ASC LIMIT 1), '') AS preview_user,
+  COALESCE((SELECT LEFT(m.content, 160) FROM conversation_messages m WHERE m.conversation_id = c.id AND m.role = 'assistant' ORDER BY m.idx ASC, m.id ASC LIMIT 1), '') AS preview_assistant,
+  %s AS avg_rating,
+  (SELECT COUNT(*) FROM conversation_ratings r WHERE r.conversation_id = c.id) AS rating_count,
+  d.name, d.kind
 FROM conversations c
-JOIN conversation_messages mm ON mm.conversation_id = c.id
-WHERE c.dataset_id = $1 AND c.split = $2 AND c.status = $3 AND mm.content ILIKE $4
+JOIN datasets d ON d.id = c.dataset_id
+WHERE %s
 ORDER BY c.id DESC
-LIMIT $5 OFFSET $6
-`, p.DatasetID, p.Split, p.Status, pattern, p.Limit, p.Offset)
+LIMIT $%d OFFSET $%d
+`, avgRatingSQL, strings.Join(where, " AND "), len(args)-1, len(args)), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -58,26 +76,53 @@ LIMIT $5 OFFSET $6
 	return scanConversations(rows)
 }
 
+// appendInFilter adds "col IN (...)" for values, or nothing when values is empty.
+func appendInFilter[T ~string](where []string, args []any, col string, values []T) ([]string, []any) {
+	if len(values) == 0 {
+		return where, args
+	}
+	ph := make([]string, len(values))
+	for i, v := range values {
+		args = append(args, string(v))
+		ph[i] = fmt.Sprintf("$%d", len(args))
+	}
+	return append(where, fmt.Sprintf("%s IN (%s)", col, strings.Join(ph, ", "))), args
+}
+
 func GetConversation(ctx context.Context, db *sql.DB, id int64) (Conversation, error) {
 	var c Conversation
 	var tagsRaw []byte
+	var avg sql.NullFloat64
 	err := db.QueryRowContext(ctx, `
-SELECT id, dataset_id, split, status, tags, source, notes, created_at, updated_at
-FROM conversations
-WHERE id = $1
-`, id).Scan(&c.ID, &c.DatasetID, &c.Split, &c.Status, &tagsRaw, &c.Source, &c.Notes, &c.CreatedAt, &c.UpdatedAt)
+SELECT c.id, c.dataset_id, c.split, c.status, c.tags, c.source, c.notes, c.lang, c.meta, c.created_at, c.updated_at,
+  `+avgRatingSQL+`,
+  (SELECT COUNT(*) FROM conversation_ratings r WHERE r.conversation_id = c.id),
+  c.import_run_id, c.messages_updated_at, d.name, d.kind
+FROM conversations c
+JOIN datasets d ON d.id = c.dataset_id
+WHERE c.id = $1
+`, id).Scan(&c.ID, &c.DatasetID, &c.Split, &c.Status, &tagsRaw, &c.Source, &c.Notes, &c.Lang, &c.Meta, &c.CreatedAt, &c.UpdatedAt, &avg, &c.RatingCount, &c.ImportRunID, &c.MessagesUpdatedAt, &c.DatasetName, &c.DatasetKind)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return Conversation{}, ErrNotFound
 		}
 		return Conversation{}, err
 	}
-	_ = json.Unmarshal(tagsRaw, &c.Tags)
+	c.Tags = decodeTags(tagsRaw)
+	if avg.Valid {
+		c.AvgRating = &avg.Float64
+	}
 
 	msgs, err := loadMessages(ctx, db, id)
 	if err != nil {
 		return Conversation{}, err
 	}
+	c.setMessages(msgs)
+	return c, nil
+}
+
+// setMessages attaches msgs and derives the message count and previews from them.
+func (c *Conversation) setMessages(msgs []Message) {
 	c.Messages = msgs
 	c.MessageCount = len(msgs)
 	for _, m := range msgs {
@@ -94,7 +139,71 @@ WHERE id = $1
 	if len(c.PreviewAssistant) > 160 {
 		c.PreviewAssistant = c.PreviewAssistant[:160]
 	}
-	return c, nil
+}
+
+// GetConversationsByIDs loads full conversations, messages included, with two queries: one
+// for the conversation rows and one for all their messages. Results follow the order of ids
+// (duplicates dropped); ids that do not exist, or whose dataset is deleted or private when
+// includePrivate is false, are left out.
+func GetConversationsByIDs(ctx context.Context, db *sql.DB, ids []int64, includePrivate bool) ([]Conversation, error) {
+	if len(ids) == 0 {
+		return []Conversation{}, nil
+	}
+	rows, err := db.QueryContext(ctx, `
+SELECT c.id, c.dataset_id, c.split, c.status, c.tags, c.source, c.notes, c.lang, c.meta, c.created_at, c.updated_at,
+  `+avgRatingSQL+`,
+  (SELECT COUNT(*) FROM conversation_ratings r WHERE r.conversation_id = c.id),
+  c.import_run_id, c.messages_updated_at, d.name, d.kind
+FROM conversations c
+JOIN datasets d ON d.id = c.dataset_id
+WHERE c.id = ANY($1) AND d.deleted_at IS NULL AND (d.visibility <> 'private' OR $2)
+`, ids, includePrivate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := map[int64]*Conversation{}
+	for rows.Next() {
+		var c Conversation
+		var tagsRaw []byte
+		var avg sql.NullFloat64
+		if err := rows.Scan(&c.ID, &c.DatasetID, &c.Split, &c.Status, &tagsRaw, &c.Source, &c.Notes, &c.Lang, &c.Meta, &c.CreatedAt, &c.UpdatedAt, &avg, &c.RatingCount, &c.ImportRunID, &c.MessagesUpdatedAt, &c.DatasetName, &c.DatasetKind); err != nil {
+			return nil, err
+		}
+		c.Tags = decodeTags(tagsRaw)
+		if avg.Valid {
+			c.AvgRating = &avg.Float64
+		}
+		byID[c.ID] = &c
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(byID) == 0 {
+		return []Conversation{}, nil
+	}
+
+	found := make([]int64, 0, len(byID))
+	for id := range byID {
+		found = append(found, id)
+	}
+	msgs, err := loadMessagesByConversation(ctx, db, found)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Conversation, 0, len(byID))
+	for _, id := range ids {
+		c, ok := byID[id]
+		if !ok {
+			continue
+		}
+		delete(byID, id)
+		c.setMessages(msgs[id])
+		out = append(out, *c)
+	}
+	return out, nil
 }
 
 func InsertConversationWithMessages(ctx context.Context, tx *sql.Tx, c Conversation) (Conversation, error) {
@@ -107,34 +216,27 @@ func InsertConversationWithMessages(ctx context.Context, tx *sql.Tx, c Conversat
 	if c.DatasetID == 0 {
 		return Conversation{}, ErrInvalidInput
 	}
+	if err := RequireDatasetKind(ctx, tx, c.DatasetID, DatasetKindConversations); err != nil {
+		return Conversation{}, err
+	}
 
-	tagsJSON, _ := json.Marshal(c.Tags)
+	tagsJSON := encodeTags(c.Tags)
 
 	row := tx.QueryRowContext(ctx, `
-INSERT INTO conversations (dataset_id, split, status, tags, source, notes)
-VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING id, dataset_id, split, status, tags, source, notes, created_at, updated_at
-`, c.DatasetID, c.Split, c.Status, tagsJSON, c.Source, c.Notes)
+INSERT INTO conversations (dataset_id, split, status, tags, source, notes, lang, import_run_id, meta)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING id, dataset_id, split, status, tags, source, notes, lang, meta, created_at, updated_at, import_run_id
+`, c.DatasetID, c.Split, c.Status, tagsJSON, c.Source, c.Notes, c.Lang, c.ImportRunID, conversationMeta(c.Meta))
 
 	var out Conversation
 	var tagsRaw []byte
-	if err := row.Scan(&out.ID, &out.DatasetID, &out.Split, &out.Status, &tagsRaw, &out.Source, &out.Notes, &out.CreatedAt, &out.UpdatedAt); err != nil {
+	if err := row.Scan(&out.ID, &out.DatasetID, &out.Split, &out.Status, &tagsRaw, &out.Source, &out.Notes, &out.Lang, &out.Meta, &out.CreatedAt, &out.UpdatedAt, &out.ImportRunID); err != nil {
 		return Conversation{}, err
 	}
-	_ = json.Unmarshal(tagsRaw, &out.Tags)
+	out.Tags = decodeTags(tagsRaw)
 
-	for idx, m := range c.Messages {
-		name := strings.TrimSpace(m.Name)
-		meta := m.Meta
-		if len(meta) == 0 {
-			meta = json.RawMessage("{}")
-		}
-		if _, err := tx.ExecContext(ctx, `
-INSERT INTO conversation_messages (conversation_id, idx, role, name, content, meta)
-VALUES ($1, $2, $3, $4, $5, $6)
-`, out.ID, idx, m.Role, name, strings.TrimSpace(m.Content), meta); err != nil {
-			return Conversation{}, err
-		}
+	if err := insertConversationMessages(ctx, tx, out.ID, c.Messages); err != nil {
+		return Conversation{}, err
 	}
 
 	out.Messages = c.Messages
@@ -142,16 +244,56 @@ VALUES ($1, $2, $3, $4, $5, $6)
 	return out, nil
 }
 
-func UpdateConversation(ctx context.Context, db *sql.DB, c Conversation) (Conversation, error) {
-	if c.ID == 0 {
-		return Conversation{}, ErrNotFound
+// decodeTags reads a stored tags value. SQL NULL, JSON null and anything that is not an
+// array of strings (left by older import tooling) read as no tags, never nil, so the tags
+// field always serializes as an array.
+func decodeTags(raw []byte) []string {
+	var tags []string
+	if err := json.Unmarshal(raw, &tags); err != nil || tags == nil {
+		return []string{}
 	}
-	if c.DatasetID == 0 {
-		return Conversation{}, ErrInvalidInput
+	return tags
+}
+
+// encodeTags is the stored form of tags: nil is written as [] rather than null.
+func encodeTags(tags []string) []byte {
+	if tags == nil {
+		return []byte("[]")
+	}
+	b, _ := json.Marshal(tags)
+	return b
+}
+
+// ConversationPatch lists the changes UpdateConversation applies. A nil field (0 for
+// DatasetID) leaves the stored value alone; Messages, when non-nil, replaces every message,
+// and Meta, when non-nil, replaces the whole meta object (JSON null clears it to {}). A
+// DatasetID change is a move, checked and audited like MoveConversation.
+type ConversationPatch struct {
+	DatasetID int64
+	Split     *Split
+	Status    *ConversationStatus
+	Tags      []string
+	Source    *string
+	Notes     *string
+	Lang      *string
+	Meta      json.RawMessage
+	Messages  []Message
+}
+
+func UpdateConversation(ctx context.Context, db *sql.DB, id int64, p ConversationPatch) (Conversation, error) {
+	if id == 0 {
+		return Conversation{}, ErrNotFound
 	}
 
 	now := time.Now().UTC()
-	tagsJSON, _ := json.Marshal(c.Tags)
+	var tagsJSON any
+	if p.Tags != nil {
+		tagsJSON = encodeTags(p.Tags)
+	}
+	var metaJSON any
+	if p.Meta != nil {
+		metaJSON = conversationMeta(p.Meta)
+	}
 
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
@@ -159,17 +301,24 @@ func UpdateConversation(ctx context.Context, db *sql.DB, c Conversation) (Conver
 	}
 	defer tx.Rollback()
 
+	if p.DatasetID != 0 {
+		if err := moveRowTx(ctx, tx, "conversations", "conversation", id, p.DatasetID, false); err != nil {
+			return Conversation{}, err
+		}
+	}
+
 	res, err := tx.ExecContext(ctx, `
 UPDATE conversations
-SET dataset_id = $2,
-    split = $3,
-    status = $4,
-    tags = $5,
-    source = $6,
-    notes = $7,
-    updated_at = $8
+SET split = COALESCE($2, split),
+    status = COALESCE($3, status),
+    tags = COALESCE($4::jsonb, NULLIF(tags, 'null'::jsonb), '[]'::jsonb),
+    source = COALESCE($5, source),
+    notes = COALESCE($6, notes),
+    lang = COALESCE($8, lang),
+    meta = COALESCE($9::jsonb, meta),
+    updated_at = $7
 WHERE id = $1
-`, c.ID, c.DatasetID, c.Split, c.Status, tagsJSON, c.Source, c.Notes, now)
+`, id, p.Split, p.Status, tagsJSON, p.Source, p.Notes, now, p.Lang, metaJSON)
 	if err != nil {
 		return Conversation{}, err
 	}
@@ -181,19 +330,18 @@ WHERE id = $1
 		return Conversation{}, ErrNotFound
 	}
 
-	if _, err := tx.ExecContext(ctx, `DELETE FROM conversation_messages WHERE conversation_id = $1`, c.ID); err != nil {
-		return Conversation{}, err
-	}
-	for idx, m := range c.Messages {
-		name := strings.TrimSpace(m.Name)
-		meta := m.Meta
-		if len(meta) == 0 {
-			meta = json.RawMessage("{}")
+	if p.Messages != nil {
+		alts, err := alternativePositions(ctx, tx, id)
+		if err != nil {
+			return Conversation{}, err
 		}
-		if _, err := tx.ExecContext(ctx, `
-INSERT INTO conversation_messages (conversation_id, idx, role, name, content, meta)
-VALUES ($1, $2, $3, $4, $5, $6)
-`, c.ID, idx, m.Role, name, strings.TrimSpace(m.Content), meta); err != nil {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM conversation_messages WHERE conversation_id = $1`, id); err != nil {
+			return Conversation{}, err
+		}
+		if err := insertConversationMessages(ctx, tx, id, p.Messages); err != nil {
+			return Conversation{}, err
+		}
+		if err := reattachAlternatives(ctx, tx, id, alts); err != nil {
 			return Conversation{}, err
 		}
 	}
@@ -202,7 +350,7 @@ VALUES ($1, $2, $3, $4, $5, $6)
 		return Conversation{}, err
 	}
 
-	return GetConversation(ctx, db, c.ID)
+	return GetConversation(ctx, db, id)
 }
 
 func DeleteConversation(ctx context.Context, db *sql.DB, id int64) error {
@@ -225,6 +373,7 @@ func scanConversations(rows *sql.Rows) ([]Conversation, error) {
 	for rows.Next() {
 		var c Conversation
 		var tagsRaw []byte
+		var avg sql.NullFloat64
 		if err := rows.Scan(
 			&c.ID,
 			&c.DatasetID,
@@ -233,15 +382,23 @@ func scanConversations(rows *sql.Rows) ([]Conversation, error) {
 			&tagsRaw,
 			&c.Source,
 			&c.Notes,
+			&c.Lang,
 			&c.CreatedAt,
 			&c.UpdatedAt,
 			&c.MessageCount,
 			&c.PreviewUser,
 			&c.PreviewAssistant,
+			&avg,
+			&c.RatingCount,
+			&c.DatasetName,
+			&c.DatasetKind,
 		); err != nil {
 			return nil, err
 		}
-		_ = json.Unmarshal(tagsRaw, &c.Tags)
+		c.Tags = decodeTags(tagsRaw)
+		if avg.Valid {
+			c.AvgRating = &avg.Float64
+		}
 		out = append(out, c)
 	}
 	return out, rows.Err()
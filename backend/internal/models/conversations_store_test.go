@@ -0,0 +1,44 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDecodeTags_NullIsEmptyArray(t *testing.T) {
+	for _, raw := range []string{"", "null", "{}", `"x"`, "[]"} {
+		tags := decodeTags([]byte(raw))
+		if tags == nil || len(tags) != 0 {
+			t.Fatalf("%q: expected empty non-nil tags, got %#v", raw, tags)
+		}
+	}
+	if tags := decodeTags([]byte(`["a","b"]`)); len(tags) != 2 || tags[1] != "b" {
+		t.Fatalf("unexpected tags %#v", tags)
+	}
+}
+
+func TestEncodeTags_NilIsEmptyArray(t *testing.T) {
+	if got := string(encodeTags(nil)); got != "[]" {
+		t.Fatalf("expected [], got %s", got)
+	}
+	if got := string(encodeTags([]string{"a"})); got != `["a"]` {
+		t.Fatalf(`expected ["a"], got %s`, got)
+	}
+}
+
+// A conversation row whose tags column holds JSON null (as older tooling wrote it) must read
+// back, and export, with "tags":[].
+func TestNullTags_ReadAndExportAsArray(t *testing.T) {
+	c := Conversation{ID: 1, Tags: decodeTags([]byte("null"))}
+	b, _ := json.Marshal(c)
+	if !strings.Contains(string(b), `"tags":[]`) {
+		t.Fatalf("conversation read: expected tags [], got %s", b)
+	}
+
+	line := conversationLine(exportConversationRow{ID: 1, TagsRaw: []byte("null")}, nil, ExportOptions{})
+	b, _ = json.Marshal(line)
+	if !strings.Contains(string(b), `"tags":[]`) {
+		t.Fatalf("export: expected tags [], got %s", b)
+	}
+}
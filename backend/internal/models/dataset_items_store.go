@@ -1,9 +1,12 @@
 package models
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"strings"
 	"time"
 )
@@ -15,6 +18,16 @@ type DatasetItem struct {
 	SourceRef string          `json:"source_ref"`
 	CreatedAt time.Time       `json:"created_at"`
 	UpdatedAt time.Time       `json:"updated_at"`
+
+	// DatasetName and DatasetKind are joined in by GetDatasetItem, ListDatasetItems and
+	// SampleDatasetItems.
+	DatasetName string `json:"dataset_name,omitempty"`
+	DatasetKind string `json:"dataset_kind,omitempty"`
+
+	// ImportRunID (the import run that created the item) and Annotations are only loaded by
+	// GetDatasetItem.
+	ImportRunID *int64           `json:"import_run_id,omitempty"`
+	Annotations []ItemAnnotation `json:"annotations,omitempty"`
 }
 
 type ListDatasetItemsParams struct {
@@ -22,33 +35,74 @@ type ListDatasetItemsParams struct {
 	Query     string
 	Limit     int
 	Offset    int
+
+	// Annotation, when set, keeps only items with a matching annotation.
+	Annotation *AnnotationFilter
+
+	// Key and Value keep items whose top-level data field Key is the string Value, as a
+	// containment test (data @> {key: value}) so the jsonb_path_ops GIN index (022) applies;
+	// KeyExists keeps items whose data has the top-level key. Keys must pass ValidDataKey.
+	Key       string
+	Value     string
+	KeyExists string
+}
+
+// maxDataKeyLen bounds keys accepted by ValidDataKey.
+const maxDataKeyLen = 64
+
+// ValidDataKey reports whether key is a simple identifier (letters, digits and underscores,
+// not starting with a digit) usable as an items data filter key.
+func ValidDataKey(key string) bool {
+	if key == "" || len(key) > maxDataKeyLen {
+		return false
+	}
+	for i, r := range key {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
 }
 
 func ListDatasetItems(ctx context.Context, db *sql.DB, p ListDatasetItemsParams) ([]DatasetItem, error) {
-	q := strings.TrimSpace(p.Query)
-	if q == "" {
-		rows, err := db.QueryContext(ctx, `
-SELECT id, dataset_id, data, source_ref, created_at, updated_at
-FROM dataset_items
-WHERE dataset_id = $1
-ORDER BY id DESC
-LIMIT $2 OFFSET $3
-`, p.DatasetID, p.Limit, p.Offset)
-		if err != nil {
-			return nil, err
+	where := []string{"dataset_items.dataset_id = $1"}
+	args := []any{p.DatasetID}
+
+	if q := strings.TrimSpace(p.Query); q != "" {
+		args = append(args, "%"+q+"%")
+		where = append(where, fmt.Sprintf("(dataset_items.data::text ILIKE $%d OR dataset_items.source_ref ILIKE $%d)", len(args), len(args)))
+	}
+	if p.Annotation != nil {
+		args = append(args, p.Annotation.Key, p.Annotation.Value)
+		where = append(where, p.Annotation.sql(len(args)-1))
+	}
+	if p.Key != "" {
+		if !ValidDataKey(p.Key) {
+			return nil, fmt.Errorf("%w: invalid key %q", ErrInvalidInput, p.Key)
+		}
+		args = append(args, p.Key, p.Value)
+		where = append(where, fmt.Sprintf("dataset_items.data @> jsonb_build_object($%d::text, $%d::text)", len(args)-1, len(args)))
+	}
+	if p.KeyExists != "" {
+		if !ValidDataKey(p.KeyExists) {
+			return nil, fmt.Errorf("%w: invalid key_exists %q", ErrInvalidInput, p.KeyExists)
 		}
-		defer rows.Close()
-		return scanDatasetItems(rows)
-	}
-
-	pattern := "%" + q + "%"
-	rows, err := db.QueryContext(ctx, `
-SELECT id, dataset_id, data, source_ref, created_at, updated_at
-FROM dataset_items
-WHERE dataset_id = $1 AND (data::text ILIKE $2 OR source_ref ILIKE $2)
-ORDER BY id DESC
-LIMIT $3 OFFSET $4
-`, p.DatasetID, pattern, p.Limit, p.Offset)
+		args = append(args, p.KeyExists)
+		// The ? operator can use the GIN index on data.
+		where = append(where, fmt.Sprintf("dataset_items.data ? ($%d::text)", len(args)))
+	}
+	args = append(args, p.Limit, p.Offset)
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`
+SELECT `+datasetItemColumnsSQL+`
+FROM dataset_items JOIN datasets d ON d.id = dataset_items.dataset_id
+WHERE %s
+ORDER BY dataset_items.id DESC
+LIMIT $%d OFFSET $%d
+`, strings.Join(where, " AND "), len(args)-1, len(args)), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -59,16 +113,21 @@ LIMIT $3 OFFSET $4
 func GetDatasetItem(ctx context.Context, db *sql.DB, id int64) (DatasetItem, error) {
 	var it DatasetItem
 	row := db.QueryRowContext(ctx, `
-SELECT id, dataset_id, data, source_ref, created_at, updated_at
-FROM dataset_items
-WHERE id = $1
+SELECT `+datasetItemColumnsSQL+`, dataset_items.import_run_id
+FROM dataset_items JOIN datasets d ON d.id = dataset_items.dataset_id
+WHERE dataset_items.id = $1
 `, id)
-	if err := row.Scan(&it.ID, &it.DatasetID, &it.Data, &it.SourceRef, &it.CreatedAt, &it.UpdatedAt); err != nil {
+	if err := row.Scan(&it.ID, &it.DatasetID, &it.Data, &it.SourceRef, &it.CreatedAt, &it.UpdatedAt, &it.DatasetName, &it.DatasetKind, &it.ImportRunID); err != nil {
 		if err == sql.ErrNoRows {
 			return DatasetItem{}, ErrNotFound
 		}
 		return DatasetItem{}, err
 	}
+	annotations, err := ListItemAnnotations(ctx, db, id)
+	if err != nil {
+		return DatasetItem{}, err
+	}
+	it.Annotations = annotations
 	return it, nil
 }
 
@@ -83,6 +142,10 @@ func CreateDatasetItem(ctx context.Context, db *sql.DB, datasetID int64, data js
 		return DatasetItem{}, ErrInvalidInput
 	}
 
+	if err := RequireDatasetKind(ctx, db, datasetID, DatasetKindItems); err != nil {
+		return DatasetItem{}, err
+	}
+
 	sourceRef = strings.TrimSpace(sourceRef)
 	row := db.QueryRowContext(ctx, `
 INSERT INTO dataset_items (dataset_id, data, source_ref)
@@ -131,6 +194,79 @@ WHERE id = $1
 	return GetDatasetItem(ctx, db, id)
 }
 
+// MergeDatasetItem deep-merges patch, a JSON object, into the item's data: nested objects are
+// merged key by key, any other value (arrays, scalars, null) replaces what was there.
+func MergeDatasetItem(ctx context.Context, db *sql.DB, id int64, patch json.RawMessage) (DatasetItem, error) {
+	p, err := decodeJSONNumber(patch)
+	if err != nil {
+		return DatasetItem{}, fmt.Errorf("%w: invalid JSON", ErrInvalidInput)
+	}
+	if _, ok := p.(map[string]any); !ok {
+		return DatasetItem{}, fmt.Errorf("%w: merge patch must be a JSON object", ErrInvalidInput)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return DatasetItem{}, err
+	}
+	defer tx.Rollback()
+
+	var data []byte
+	if err := tx.QueryRowContext(ctx, `SELECT data FROM dataset_items WHERE id = $1 FOR UPDATE`, id).Scan(&data); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return DatasetItem{}, ErrNotFound
+		}
+		return DatasetItem{}, err
+	}
+	base, err := decodeJSONNumber(data)
+	if err != nil {
+		return DatasetItem{}, err
+	}
+	merged, err := json.Marshal(mergeJSON(base, p))
+	if err != nil || !json.Valid(merged) {
+		return DatasetItem{}, fmt.Errorf("%w: merged data is not valid JSON", ErrInvalidInput)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE dataset_items SET data = $2, updated_at = $3 WHERE id = $1`, id, merged, time.Now().UTC()); err != nil {
+		return DatasetItem{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return DatasetItem{}, err
+	}
+	return GetDatasetItem(ctx, db, id)
+}
+
+// mergeJSON merges patch into base as MergeDatasetItem describes; maps in base are modified.
+func mergeJSON(base, patch any) any {
+	pm, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	bm, ok := base.(map[string]any)
+	if !ok {
+		bm = map[string]any{}
+	}
+	for k, v := range pm {
+		bm[k] = mergeJSON(bm[k], v)
+	}
+	return bm
+}
+
+// decodeJSONNumber decodes raw keeping numbers as json.Number, so large integers and exact
+// decimals survive a decode/encode round trip.
+func decodeJSONNumber(raw []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("trailing data after JSON value")
+	}
+	return v, nil
+}
+
 func DeleteDatasetItem(ctx context.Context, db *sql.DB, id int64) error {
 	res, err := db.ExecContext(ctx, `DELETE FROM dataset_items WHERE id = $1`, id)
 	if err != nil {
@@ -154,11 +290,16 @@ func DeleteDatasetItemsByDataset(ctx context.Context, db *sql.DB, datasetID int6
 	return err
 }
 
+// datasetItemColumnsSQL are the columns scanDatasetItems reads, from dataset_items joined
+// with its dataset as d.
+const datasetItemColumnsSQL = `dataset_items.id, dataset_items.dataset_id, dataset_items.data, dataset_items.source_ref,
+  dataset_items.created_at, dataset_items.updated_at, d.name, d.kind`
+
 func scanDatasetItems(rows *sql.Rows) ([]DatasetItem, error) {
 	var out []DatasetItem
 	for rows.Next() {
 		var it DatasetItem
-		if err := rows.Scan(&it.ID, &it.DatasetID, &it.Data, &it.SourceRef, &it.CreatedAt, &it.UpdatedAt); err != nil {
+		if err := rows.Scan(&it.ID, &it.DatasetID, &it.Data, &it.SourceRef, &it.CreatedAt, &it.UpdatedAt, &it.DatasetName, &it.DatasetKind); err != nil {
 			return nil, err
 		}
 		out = append(out, it)
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMergeJSON(t *testing.T) {
+	base, _ := decodeJSONNumber([]byte(`{"text":"hi","meta":{"lang":"en","tags":["a"]},"id":12345678901234567890}`))
+	patch, _ := decodeJSONNumber([]byte(`{"meta":{"quality":4,"tags":["b"]},"text":null,"extra":{"x":1}}`))
+
+	got, err := json.Marshal(mergeJSON(base, patch))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	want := `{"extra":{"x":1},"id":12345678901234567890,"meta":{"lang":"en","quality":4,"tags":["b"]},"text":null}`
+	if string(got) != want {
+		t.Fatalf("unexpected merge:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestMergeJSON_NonObjectBaseIsReplaced(t *testing.T) {
+	base, _ := decodeJSONNumber([]byte(`[1,2]`))
+	patch, _ := decodeJSONNumber([]byte(`{"a":{"b":1}}`))
+	got, _ := json.Marshal(mergeJSON(base, patch))
+	if string(got) != `{"a":{"b":1}}` {
+		t.Fatalf("unexpected merge: %s", got)
+	}
+}
+
+func TestDecodeJSONNumber_RejectsTrailingData(t *testing.T) {
+	if _, err := decodeJSONNumber([]byte(`{"a":1} {"b":2}`)); err == nil {
+		t.Fatalf("expected trailing data to be rejected")
+	}
+}
+
+func TestDatasetFieldsOmittedUnlessLoaded(t *testing.T) {
+	bare, _ := json.Marshal(DatasetItem{ID: 1, DatasetID: 2, Data: json.RawMessage(`{}`)})
+	conv, _ := json.Marshal(Conversation{ID: 1, DatasetID: 2})
+	for _, b := range [][]byte{bare, conv} {
+		var m map[string]any
+		_ = json.Unmarshal(b, &m)
+		if _, ok := m["dataset_name"]; ok {
+			t.Fatalf("dataset_name should be omitted when not loaded: %s", b)
+		}
+	}
+
+	loaded, _ := json.Marshal(DatasetItem{ID: 1, DatasetID: 2, Data: json.RawMessage(`{}`), DatasetName: "support", DatasetKind: "items"})
+	var m map[string]any
+	_ = json.Unmarshal(loaded, &m)
+	if m["dataset_name"] != "support" || m["dataset_kind"] != "items" {
+		t.Fatalf("expected dataset_name/dataset_kind, got %s", loaded)
+	}
+}
+
+func TestValidDataKey(t *testing.T) {
+	for _, k := range []string{"category", "_x", "Label2", "a_b_c"} {
+		if !ValidDataKey(k) {
+			t.Fatalf("%q should be valid", k)
+		}
+	}
+	for _, k := range []string{"", "2x", "a-b", "a.b", "a b", "x'; drop", "ключ", strings.Repeat("k", 65)} {
+		if ValidDataKey(k) {
+			t.Fatalf("%q should be invalid", k)
+		}
+	}
+}
@@ -3,38 +3,73 @@ package models
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"strings"
 	"time"
 )
 
+// MaxDatasetReadmeBytes caps the size of Dataset.Readme.
+const MaxDatasetReadmeBytes = 64 * 1024
+
+type CreateDatasetParams struct {
+	Name        string
+	Description string
+	Kind        string
+	Visibility  string // public (default) | private
+	Readme      string
+
+	License       string // SPDX identifier, see NormalizeLicense
+	ProvenanceURL string
+
+	DefaultSplit  string // train|valid|test, "" = global default
+	DefaultStatus string // draft|pending|approved|rejected|archived, "" = global default
+
+	ProjectID int64 // 0 = DefaultProjectID
+}
+
+// UpdateDatasetParams holds the fields to change. Name and Visibility keep their value when
+// empty; the pointer fields keep it when nil and otherwise set it, "" clearing the text fields
+// (a cleared default falls back to the global one). Kind cannot be cleared.
+type UpdateDatasetParams struct {
+	Name        string
+	Description *string
+	Kind        *string
+	Visibility  string
+	Readme      *string
+
+	License       *string
+	ProvenanceURL *string
+
+	DefaultSplit  *string
+	DefaultStatus *string
+
+	ProjectID int64 // moves the dataset to another project; 0 keeps it
+}
+
 type ListDatasetsParams struct {
-	Query  string
-	Limit  int
-	Offset int
+	Query          string
+	IncludePrivate bool
+	ProjectID      int64 // 0 = every project
+	Limit          int
+	Offset         int
 }
 
 func ListDatasets(ctx context.Context, db *sql.DB, p ListDatasetsParams) ([]Dataset, error) {
 	q := strings.TrimSpace(p.Query)
 	if q == "" {
 		rows, err := db.QueryContext(ctx, `
-SELECT d.id, d.name, d.description, d.kind,
-       COALESCE(di.cnt, 0) AS item_count,
-       COALESCE(cc.cnt, 0) AS conversation_count,
-       d.created_at, d.updated_at
+SELECT d.id, d.name, d.description, d.kind, d.project_id, d.visibility, d.license, d.provenance_url, d.default_split, d.default_status,
+       d.item_count, d.conversation_count, d.train_count, d.valid_count, d.test_count,
+       d.created_at, d.updated_at, d.locked_by, d.locked_at, d.lock_expires_at
 FROM datasets d
-LEFT JOIN (
-  SELECT dataset_id, COUNT(*) AS cnt
-  FROM dataset_items
-  GROUP BY dataset_id
-) di ON di.dataset_id = d.id
-LEFT JOIN (
-  SELECT dataset_id, COUNT(*) AS cnt
-  FROM conversations
-  GROUP BY dataset_id
-) cc ON cc.dataset_id = d.id
+WHERE ($3::boolean OR d.visibility = 'public')
+  AND ($4::bigint = 0 OR d.project_id = $4)
+  AND d.deleted_at IS NULL
 ORDER BY d.id DESC
 LIMIT $1 OFFSET $2
-`, p.Limit, p.Offset)
+`, p.Limit, p.Offset, p.IncludePrivate, p.ProjectID)
 		if err != nil {
 			return nil, err
 		}
@@ -44,25 +79,17 @@ LIMIT $1 OFFSET $2
 
 	pattern := "%" + q + "%"
 	rows, err := db.QueryContext(ctx, `
-SELECT d.id, d.name, d.description, d.kind,
-       COALESCE(di.cnt, 0) AS item_count,
-       COALESCE(cc.cnt, 0) AS conversation_count,
-       d.created_at, d.updated_at
+SELECT d.id, d.name, d.description, d.kind, d.project_id, d.visibility, d.license, d.provenance_url, d.default_split, d.default_status,
+       d.item_count, d.conversation_count, d.train_count, d.valid_count, d.test_count,
+       d.created_at, d.updated_at, d.locked_by, d.locked_at, d.lock_expires_at
 FROM datasets d
-LEFT JOIN (
-  SELECT dataset_id, COUNT(*) AS cnt
-  FROM dataset_items
-  GROUP BY dataset_id
-) di ON di.dataset_id = d.id
-LEFT JOIN (
-  SELECT dataset_id, COUNT(*) AS cnt
-  FROM conversations
-  GROUP BY dataset_id
-) cc ON cc.dataset_id = d.id
-WHERE d.name ILIKE $1 OR d.description ILIKE $1
+WHERE (d.name ILIKE $1 OR d.description ILIKE $1)
+  AND ($4::boolean OR d.visibility = 'public')
+  AND ($5::bigint = 0 OR d.project_id = $5)
+  AND d.deleted_at IS NULL
 ORDER BY d.id DESC
 LIMIT $2 OFFSET $3
-`, pattern, p.Limit, p.Offset)
+`, pattern, p.Limit, p.Offset, p.IncludePrivate, p.ProjectID)
 	if err != nil {
 		return nil, err
 	}
@@ -72,73 +99,105 @@ LIMIT $2 OFFSET $3
 
 func GetDataset(ctx context.Context, db *sql.DB, id int64) (Dataset, error) {
 	var d Dataset
+	var lockBy string
+	var lockAt, lockExpires *time.Time
 	err := db.QueryRowContext(ctx, `
-SELECT d.id, d.name, d.description, d.kind,
-       COALESCE(di.cnt, 0) AS item_count,
-       COALESCE(cc.cnt, 0) AS conversation_count,
-       d.created_at, d.updated_at
+SELECT d.id, d.name, d.description, d.kind, d.project_id, d.visibility, d.license, d.provenance_url, d.default_split, d.default_status, d.readme,
+       d.item_count, d.conversation_count, d.train_count, d.valid_count, d.test_count,
+       d.created_at, d.updated_at, d.locked_by, d.locked_at, d.lock_expires_at
 FROM datasets d
-LEFT JOIN (
-  SELECT dataset_id, COUNT(*) AS cnt
-  FROM dataset_items
-  WHERE dataset_id = $1
-  GROUP BY dataset_id
-) di ON di.dataset_id = d.id
-LEFT JOIN (
-  SELECT dataset_id, COUNT(*) AS cnt
-  FROM conversations
-  WHERE dataset_id = $1
-  GROUP BY dataset_id
-) cc ON cc.dataset_id = d.id
-WHERE d.id = $1
-`, id).Scan(&d.ID, &d.Name, &d.Description, &d.Kind, &d.ItemCount, &d.ConversationCount, &d.CreatedAt, &d.UpdatedAt)
+WHERE d.id = $1 AND d.deleted_at IS NULL
+`, id).Scan(&d.ID, &d.Name, &d.Description, &d.Kind, &d.ProjectID, &d.Visibility, &d.License, &d.ProvenanceURL, &d.DefaultSplit, &d.DefaultStatus, &d.Readme, &d.ItemCount, &d.ConversationCount, &d.TrainCount, &d.ValidCount, &d.TestCount, &d.CreatedAt, &d.UpdatedAt, &lockBy, &lockAt, &lockExpires)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return Dataset{}, ErrNotFound
 		}
 		return Dataset{}, err
 	}
+	d.setLock(lockBy, lockAt, lockExpires)
 	return d, nil
 }
 
-func CreateDataset(ctx context.Context, db *sql.DB, name string, description string, kind string) (Dataset, error) {
-	name = strings.TrimSpace(name)
-	description = strings.TrimSpace(description)
-	kind = strings.TrimSpace(strings.ToLower(kind))
+func CreateDataset(ctx context.Context, db *sql.DB, p CreateDatasetParams) (Dataset, error) {
+	name := strings.TrimSpace(p.Name)
+	description := strings.TrimSpace(p.Description)
+	var verr ValidationError
 	if name == "" {
-		return Dataset{}, ErrInvalidInput
+		verr.Add("name", "name required")
+	}
+	if len(p.Readme) > MaxDatasetReadmeBytes {
+		verr.Add("readme", fmt.Sprintf("readme exceeds %d bytes", MaxDatasetReadmeBytes))
+	}
+	kind := DatasetKindItems
+	if strings.TrimSpace(p.Kind) != "" {
+		k, ok := NormalizeDatasetKind(p.Kind)
+		if !ok {
+			verr.Add("kind", "invalid kind (expected items|conversations)")
+		}
+		kind = k
+	}
+	visibility := DatasetVisibilityPublic
+	if strings.TrimSpace(p.Visibility) != "" {
+		v, ok := NormalizeDatasetVisibility(p.Visibility)
+		if !ok {
+			verr.Add("visibility", "invalid visibility")
+		}
+		visibility = v
+	}
+	license, provenanceURL, err := normalizeLicenseFields(p.License, p.ProvenanceURL)
+	if err := verr.Merge(err); err != nil {
+		return Dataset{}, err
+	}
+	defaultSplit, defaultStatus, err := normalizeDatasetDefaults(p.DefaultSplit, p.DefaultStatus)
+	if err := verr.Merge(err); err != nil {
+		return Dataset{}, err
+	}
+	if err := verr.Err(); err != nil {
+		return Dataset{}, err
 	}
-	if kind == "" {
-		kind = "items"
+	projectID := p.ProjectID
+	if projectID == 0 {
+		projectID = DefaultProjectID
 	}
 	row := db.QueryRowContext(ctx, `
-INSERT INTO datasets (name, description, kind)
-VALUES ($1, $2, $3)
-RETURNING id, name, description, kind, created_at, updated_at
-`, name, description, kind)
+INSERT INTO datasets (name, description, kind, visibility, readme, license, provenance_url, default_split, default_status, project_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+RETURNING id, name, description, kind, project_id, visibility, license, provenance_url, default_split, default_status, readme, created_at, updated_at
+`, name, description, kind, visibility, p.Readme, license, provenanceURL, defaultSplit, defaultStatus, projectID)
 
 	var d Dataset
-	if err := row.Scan(&d.ID, &d.Name, &d.Description, &d.Kind, &d.CreatedAt, &d.UpdatedAt); err != nil {
+	if err := row.Scan(&d.ID, &d.Name, &d.Description, &d.Kind, &d.ProjectID, &d.Visibility, &d.License, &d.ProvenanceURL, &d.DefaultSplit, &d.DefaultStatus, &d.Readme, &d.CreatedAt, &d.UpdatedAt); err != nil {
+		if isUniqueViolation(err) {
+			return Dataset{}, fmt.Errorf("%w: dataset %q already exists", ErrConflict, name)
+		}
 		return Dataset{}, err
 	}
 	return d, nil
 }
 
-func UpdateDataset(ctx context.Context, db *sql.DB, id int64, name string, description string, kind string) (Dataset, error) {
-	name = strings.TrimSpace(name)
-	description = strings.TrimSpace(description)
-	kind = strings.TrimSpace(strings.ToLower(kind))
+func UpdateDataset(ctx context.Context, db *sql.DB, id int64, p UpdateDatasetParams) (Dataset, error) {
+	set, err := datasetUpdateColumns(p)
+	if err != nil {
+		return Dataset{}, err
+	}
 
-	now := time.Now().UTC()
+	set.add("updated_at", time.Now().UTC())
+	args := append([]any{id}, set.args...)
+	where := "id = $1 AND deleted_at IS NULL"
+	if p.Kind != nil {
+		// The kind only changes while the dataset holds no rows of the old kind.
+		kind, _ := NormalizeDatasetKind(*p.Kind)
+		args = append(args, kind)
+		where += fmt.Sprintf(" AND (kind = $%d OR (item_count = 0 AND conversation_count = 0))", len(args))
+	}
 	res, err := db.ExecContext(ctx, `
 UPDATE datasets
-SET name = COALESCE(NULLIF($2, ''), name),
-    description = COALESCE($3, description),
-    kind = COALESCE(NULLIF($4, ''), kind),
-    updated_at = $5
-WHERE id = $1
-`, id, name, description, kind, now)
+SET `+set.clause(2)+`
+WHERE `+where, args...)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return Dataset{}, fmt.Errorf("%w: dataset %q already exists", ErrConflict, strings.TrimSpace(p.Name))
+		}
 		return Dataset{}, err
 	}
 	a, err := res.RowsAffected()
@@ -146,73 +205,538 @@ WHERE id = $1
 		return Dataset{}, err
 	}
 	if a == 0 {
-		return Dataset{}, ErrNotFound
+		if p.Kind == nil {
+			return Dataset{}, ErrNotFound
+		}
+		d, err := GetDataset(ctx, db, id)
+		if err != nil {
+			return Dataset{}, err
+		}
+		return Dataset{}, fmt.Errorf("%w: dataset %q holds %d conversations and %d items; kind can only change while it is empty", ErrConflict, d.Name, d.ConversationCount, d.ItemCount)
 	}
 	return GetDataset(ctx, db, id)
 }
 
+// datasetUpdateColumns validates p and collects the columns it changes.
+func datasetUpdateColumns(p UpdateDatasetParams) (columnSet, error) {
+	var set columnSet
+	var verr ValidationError
+	if name := strings.TrimSpace(p.Name); name != "" {
+		set.add("name", name)
+	}
+	if p.Description != nil {
+		set.add("description", strings.TrimSpace(*p.Description))
+	}
+	if p.Kind != nil {
+		kind, ok := NormalizeDatasetKind(*p.Kind)
+		if !ok {
+			verr.Add("kind", "invalid kind (expected items|conversations)")
+		}
+		set.add("kind", kind)
+	}
+	if strings.TrimSpace(p.Visibility) != "" {
+		visibility, ok := NormalizeDatasetVisibility(p.Visibility)
+		if !ok {
+			verr.Add("visibility", "invalid visibility")
+		}
+		set.add("visibility", visibility)
+	}
+	if p.Readme != nil {
+		if len(*p.Readme) > MaxDatasetReadmeBytes {
+			verr.Add("readme", fmt.Sprintf("readme exceeds %d bytes", MaxDatasetReadmeBytes))
+		}
+		set.add("readme", *p.Readme)
+	}
+
+	license, provenanceURL, err := normalizeLicenseFields(derefString(p.License), derefString(p.ProvenanceURL))
+	if err := verr.Merge(err); err != nil {
+		return columnSet{}, err
+	}
+	if p.License != nil {
+		set.add("license", license)
+	}
+	if p.ProvenanceURL != nil {
+		set.add("provenance_url", provenanceURL)
+	}
+
+	defaultSplit, defaultStatus, err := normalizeDatasetDefaults(derefString(p.DefaultSplit), derefString(p.DefaultStatus))
+	if err := verr.Merge(err); err != nil {
+		return columnSet{}, err
+	}
+	if p.DefaultSplit != nil {
+		set.add("default_split", defaultSplit)
+	}
+	if p.DefaultStatus != nil {
+		set.add("default_status", defaultStatus)
+	}
+	if p.ProjectID > 0 {
+		set.add("project_id", p.ProjectID)
+	}
+
+	if err := verr.Err(); err != nil {
+		return columnSet{}, err
+	}
+	return set, nil
+}
+
+func derefString(p *string) string {
+	if p == nil {
+		return ""
+	}
+	return *p
+}
+
+// columnSet collects "col = $n" assignments for an UPDATE's SET clause.
+type columnSet struct {
+	cols []string
+	args []any
+}
+
+func (s *columnSet) add(col string, v any) {
+	s.cols = append(s.cols, col)
+	s.args = append(s.args, v)
+}
+
+// clause renders the assignments, numbering placeholders from first.
+func (s columnSet) clause(first int) string {
+	parts := make([]string, len(s.cols))
+	for i, col := range s.cols {
+		parts[i] = fmt.Sprintf("%s = $%d", col, first+i)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// DatasetDeletionReport describes what deleting a dataset affects (or affected).
+type DatasetDeletionReport struct {
+	DatasetID         int64      `json:"dataset_id"`
+	Name              string     `json:"name"`
+	ConversationCount int64      `json:"conversation_count"`
+	ItemCount         int64      `json:"item_count"`
+	ProposalCount     int64      `json:"proposal_count"`         // proposals targeting the dataset
+	PendingProposals  int64      `json:"pending_proposal_count"` // of which still pending
+	DeletedAt         *time.Time `json:"deleted_at,omitempty"`   // set when already soft-deleted
+}
+
+// GetDatasetDeletionReport counts what hangs off a dataset, including a soft-deleted one.
+func GetDatasetDeletionReport(ctx context.Context, db *sql.DB, id int64) (DatasetDeletionReport, error) {
+	r := DatasetDeletionReport{DatasetID: id}
+	var deletedAt sql.NullTime
+	err := db.QueryRowContext(ctx, `
+SELECT d.name, d.deleted_at,
+       (SELECT COUNT(*) FROM conversations c WHERE c.dataset_id = d.id),
+       (SELECT COUNT(*) FROM dataset_items i WHERE i.dataset_id = d.id),
+       (SELECT COUNT(*) FROM proposals p WHERE p.payload->>'dataset_id' = d.id::text),
+       (SELECT COUNT(*) FROM proposals p WHERE p.payload->>'dataset_id' = d.id::text AND p.status = 'pending')
+FROM datasets d
+WHERE d.id = $1
+`, id).Scan(&r.Name, &deletedAt, &r.ConversationCount, &r.ItemCount, &r.ProposalCount, &r.PendingProposals)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return DatasetDeletionReport{}, ErrNotFound
+		}
+		return DatasetDeletionReport{}, err
+	}
+	if deletedAt.Valid {
+		r.DeletedAt = &deletedAt.Time
+	}
+	return r, nil
+}
+
+// SoftDeleteDataset hides a dataset (deleted_at) and archives its conversations; rows are kept.
+// It returns how many conversations were archived.
+func SoftDeleteDataset(ctx context.Context, db *sql.DB, id int64) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	res, err := tx.ExecContext(ctx, `UPDATE datasets SET deleted_at = $2, updated_at = $2 WHERE id = $1 AND deleted_at IS NULL`, id, now)
+	if err != nil {
+		return 0, err
+	}
+	if a, err := res.RowsAffected(); err != nil {
+		return 0, err
+	} else if a == 0 {
+		return 0, ErrNotFound
+	}
+
+	res, err = tx.ExecContext(ctx, `
+UPDATE conversations SET status = $2, updated_at = $3
+WHERE dataset_id = $1 AND status <> $2
+`, id, ConversationStatusArchived, now)
+	if err != nil {
+		return 0, err
+	}
+	archived, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	detail, _ := json.Marshal(map[string]int64{"archived_conversations": archived})
+	if err := insertAuditEntry(ctx, tx, "dataset", id, "soft_delete", detail); err != nil {
+		return 0, err
+	}
+	return archived, tx.Commit()
+}
+
+// DeleteDataset removes a dataset for good (soft-deleted or not); conversations, messages,
+// items and import runs go with it through ON DELETE CASCADE.
 func DeleteDataset(ctx context.Context, db *sql.DB, id int64) error {
-	res, err := db.ExecContext(ctx, `DELETE FROM datasets WHERE id = $1`, id)
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	a, err := res.RowsAffected()
-	if err != nil {
+	defer tx.Rollback()
+
+	var name string
+	if err := tx.QueryRowContext(ctx, `DELETE FROM datasets WHERE id = $1 RETURNING name`, id).Scan(&name); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
 		return err
 	}
-	if a == 0 {
-		return ErrNotFound
+	detail, _ := json.Marshal(map[string]string{"name": name})
+	if err := insertAuditEntry(ctx, tx, "dataset", id, "delete", detail); err != nil {
+		return err
 	}
-	return nil
+	return tx.Commit()
 }
 
-func EnsureDataset(ctx context.Context, db *sql.DB, name string) (Dataset, error) {
+// FindDatasetByName looks a dataset up by its (unique) name. A soft-deleted dataset still
+// holds its name and yields ErrConflict.
+func FindDatasetByName(ctx context.Context, db *sql.DB, name string) (Dataset, error) {
+	var d Dataset
+	var deletedAt sql.NullTime
+	var lockBy string
+	var lockAt, lockExpires *time.Time
+	err := db.QueryRowContext(ctx, `
+SELECT id, name, description, kind, project_id, visibility, license, provenance_url, default_split, default_status, created_at, updated_at, deleted_at,
+       locked_by, locked_at, lock_expires_at
+FROM datasets
+WHERE name = $1
+`, strings.TrimSpace(name)).Scan(&d.ID, &d.Name, &d.Description, &d.Kind, &d.ProjectID, &d.Visibility, &d.License, &d.ProvenanceURL, &d.DefaultSplit, &d.DefaultStatus, &d.CreatedAt, &d.UpdatedAt, &deletedAt,
+		&lockBy, &lockAt, &lockExpires)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Dataset{}, ErrNotFound
+		}
+		return Dataset{}, err
+	}
+	if deletedAt.Valid {
+		// The name is still taken; importing into a trashed dataset would hide the rows.
+		return Dataset{}, fmt.Errorf("%w: dataset %q is deleted (hard-delete it to reuse the name)", ErrConflict, d.Name)
+	}
+	d.setLock(lockBy, lockAt, lockExpires)
+	return d, nil
+}
+
+// EnsureDataset returns the dataset called name, creating it with kind in project projectID
+// (0 = the default project) when it does not exist. An existing dataset is returned whatever
+// its kind (see RequireDatasetKind), but one in another project yields ErrConflict.
+func EnsureDataset(ctx context.Context, db *sql.DB, name, kind string, projectID int64) (Dataset, error) {
 	name = strings.TrimSpace(name)
 	if name == "" {
 		name = "default"
 	}
+	kind, ok := NormalizeDatasetKind(kind)
+	if !ok {
+		return Dataset{}, fmt.Errorf("%w: invalid dataset kind", ErrInvalidInput)
+	}
 
-	var d Dataset
-	err := db.QueryRowContext(ctx, `
-SELECT id, name, description, kind, created_at, updated_at
-FROM datasets
-WHERE name = $1
-`, name).Scan(&d.ID, &d.Name, &d.Description, &d.Kind, &d.CreatedAt, &d.UpdatedAt)
-	if err == nil {
-		return d, nil
+	if projectID == 0 {
+		projectID = DefaultProjectID
 	}
-	if err != sql.ErrNoRows {
-		return Dataset{}, err
+
+	d, err := FindDatasetByName(ctx, db, name)
+	if err == nil && d.ProjectID != projectID {
+		return Dataset{}, fmt.Errorf("%w: dataset %q belongs to another project", ErrConflict, name)
+	}
+	if err == nil || !errors.Is(err, ErrNotFound) {
+		return d, err
 	}
 
 	row := db.QueryRowContext(ctx, `
-INSERT INTO datasets (name)
-VALUES ($1)
-RETURNING id, name, description, kind, created_at, updated_at
-`, name)
-	if err := row.Scan(&d.ID, &d.Name, &d.Description, &d.Kind, &d.CreatedAt, &d.UpdatedAt); err != nil {
+INSERT INTO datasets (name, kind, project_id)
+VALUES ($1, $2, $3)
+RETURNING id, name, description, kind, project_id, visibility, license, provenance_url, default_split, default_status, created_at, updated_at
+`, name, kind, projectID)
+	if err := row.Scan(&d.ID, &d.Name, &d.Description, &d.Kind, &d.ProjectID, &d.Visibility, &d.License, &d.ProvenanceURL, &d.DefaultSplit, &d.DefaultStatus, &d.CreatedAt, &d.UpdatedAt); err != nil {
 		return Dataset{}, err
 	}
 	return d, nil
 }
 
+// ErrWrongDatasetKind is returned when a row is added to a dataset of the other kind. It
+// matches ErrConflict.
+var ErrWrongDatasetKind = fmt.Errorf("%w: wrong dataset kind", ErrConflict)
+
+// RequireDatasetKind returns ErrNotFound when dataset id does not exist and
+// ErrWrongDatasetKind when it is not of kind. q is a *sql.DB or *sql.Tx.
+func RequireDatasetKind(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}, id int64, kind string) error {
+	var name, got string
+	err := q.QueryRowContext(ctx, `SELECT name, kind FROM datasets WHERE id = $1 AND deleted_at IS NULL`, id).Scan(&name, &got)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+	if got != kind {
+		return fmt.Errorf("%w: dataset %q is a %s dataset, not %s", ErrWrongDatasetKind, name, got, kind)
+	}
+	return nil
+}
+
 func scanDatasets(rows *sql.Rows) ([]Dataset, error) {
 	var out []Dataset
 	for rows.Next() {
 		var d Dataset
+		var lockBy string
+		var lockAt, lockExpires *time.Time
 		if err := rows.Scan(
 			&d.ID,
 			&d.Name,
 			&d.Description,
 			&d.Kind,
+			&d.ProjectID,
+			&d.Visibility,
+			&d.License,
+			&d.ProvenanceURL,
+			&d.DefaultSplit,
+			&d.DefaultStatus,
 			&d.ItemCount,
 			&d.ConversationCount,
+			&d.TrainCount,
+			&d.ValidCount,
+			&d.TestCount,
 			&d.CreatedAt,
 			&d.UpdatedAt,
+			&lockBy,
+			&lockAt,
+			&lockExpires,
 		); err != nil {
 			return nil, err
 		}
+		d.setLock(lockBy, lockAt, lockExpires)
 		out = append(out, d)
 	}
 	return out, rows.Err()
 }
+
+// GetDatasetHead is GetDataset without the readme and counts: a single-row primary key
+// lookup for existence, visibility, kind, default and lock checks on hot paths.
+func GetDatasetHead(ctx context.Context, db *sql.DB, id int64) (Dataset, error) {
+	var d Dataset
+	var lockBy string
+	var lockAt, lockExpires *time.Time
+	err := db.QueryRowContext(ctx, `
+SELECT id, name, description, kind, project_id, visibility, license, provenance_url, default_split, default_status, created_at, updated_at,
+       locked_by, locked_at, lock_expires_at
+FROM datasets
+WHERE id = $1 AND deleted_at IS NULL
+`, id).Scan(&d.ID, &d.Name, &d.Description, &d.Kind, &d.ProjectID, &d.Visibility, &d.License, &d.ProvenanceURL, &d.DefaultSplit, &d.DefaultStatus, &d.CreatedAt, &d.UpdatedAt,
+		&lockBy, &lockAt, &lockExpires)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Dataset{}, ErrNotFound
+		}
+		return Dataset{}, err
+	}
+	d.setLock(lockBy, lockAt, lockExpires)
+	return d, nil
+}
+
+// DatasetCountDrift compares a dataset's cached counts with the source tables.
+type DatasetCountDrift struct {
+	DatasetID               int64       `json:"dataset_id"`
+	StoredItemCount         int64       `json:"stored_item_count"`
+	ActualItemCount         int64       `json:"actual_item_count"`
+	StoredConversationCount int64       `json:"stored_conversation_count"`
+	ActualConversationCount int64       `json:"actual_conversation_count"`
+	StoredSplitCounts       SplitCounts `json:"stored_split_counts"`
+	ActualSplitCounts       SplitCounts `json:"actual_split_counts"`
+	Drifted                 bool        `json:"drifted"`
+}
+
+// SplitCounts is a dataset's conversations per split.
+type SplitCounts struct {
+	Train int64 `json:"train"`
+	Valid int64 `json:"valid"`
+	Test  int64 `json:"test"`
+}
+
+// RecountDataset recomputes item_count, conversation_count and the per-split counts from
+// dataset_items and conversations, stores them, and reports what the cached values were.
+func RecountDataset(ctx context.Context, db *sql.DB, id int64) (DatasetCountDrift, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return DatasetCountDrift{}, err
+	}
+	defer tx.Rollback()
+
+	d := DatasetCountDrift{DatasetID: id}
+	stored, actual := &d.StoredSplitCounts, &d.ActualSplitCounts
+	err = tx.QueryRowContext(ctx, `
+SELECT d.item_count, d.conversation_count, d.train_count, d.valid_count, d.test_count,
+       (SELECT COUNT(*) FROM dataset_items WHERE dataset_id = $1),
+       sc.total, sc.train, sc.valid, sc.test
+FROM datasets d,
+LATERAL (
+  SELECT COUNT(*) AS total,
+         COUNT(*) FILTER (WHERE split = 'train') AS train,
+         COUNT(*) FILTER (WHERE split = 'valid') AS valid,
+         COUNT(*) FILTER (WHERE split = 'test') AS test
+  FROM conversations
+  WHERE dataset_id = $1
+) sc
+WHERE d.id = $1
+FOR UPDATE OF d
+`, id).Scan(&d.StoredItemCount, &d.StoredConversationCount, &stored.Train, &stored.Valid, &stored.Test,
+		&d.ActualItemCount, &d.ActualConversationCount, &actual.Train, &actual.Valid, &actual.Test)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return DatasetCountDrift{}, ErrNotFound
+		}
+		return DatasetCountDrift{}, err
+	}
+	d.Drifted = d.StoredItemCount != d.ActualItemCount || d.StoredConversationCount != d.ActualConversationCount ||
+		d.StoredSplitCounts != d.ActualSplitCounts
+
+	if d.Drifted {
+		if _, err := tx.ExecContext(ctx, `
+UPDATE datasets
+SET item_count = $2, conversation_count = $3, train_count = $4, valid_count = $5, test_count = $6
+WHERE id = $1
+`, id, d.ActualItemCount, d.ActualConversationCount, actual.Train, actual.Valid, actual.Test); err != nil {
+			return DatasetCountDrift{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return DatasetCountDrift{}, err
+	}
+	return d, nil
+}
+
+// ListUnlicensedDatasetNames returns the conversation datasets without a license that a
+// cross-dataset export with opts reads conversations from, used to warn on (or block) it.
+// Unlicensed datasets the export's filters leave out are not listed.
+func ListUnlicensedDatasetNames(ctx context.Context, db *sql.DB, opts ExportOptions) ([]string, error) {
+	query, args := unlicensedDatasetsQuery(opts)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		out = append(out, name)
+	}
+	return out, rows.Err()
+}
+
+// unlicensedDatasetsQuery selects the names of unlicensed datasets holding a conversation
+// that matches the export filters of opts (every split of an interleaved export).
+func unlicensedDatasetsQuery(opts ExportOptions) (string, []any) {
+	if opts.Status == "" {
+		opts.Status = string(ConversationStatusApproved)
+	}
+	if opts.Split == "" {
+		opts.Split = string(SplitTrain)
+	}
+	if len(opts.Interleave) > 0 {
+		opts.Split = "all"
+	}
+	opts.Dedup = "" // only ids are read; skip the embedding column
+	filter, args := conversationsFilterQuery(opts)
+	return `
+SELECT d.name
+FROM datasets d
+WHERE d.license = '' AND d.kind <> 'items' AND d.deleted_at IS NULL
+  AND d.id IN (SELECT c.dataset_id FROM conversations c WHERE c.id IN (SELECT f.id FROM (` + filter + `) f))
+ORDER BY d.id ASC
+`, args
+}
+
+// ListConversationDatasets returns every conversation dataset (the ones cross-dataset exports
+// read from), limited to project projectID unless 0, ordered by name.
+func ListConversationDatasets(ctx context.Context, db *sql.DB, publicOnly bool, projectID int64) ([]Dataset, error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT d.id, d.name, d.description, d.kind, d.project_id, d.visibility, d.license, d.provenance_url, d.default_split, d.default_status,
+       d.item_count, d.conversation_count, d.train_count, d.valid_count, d.test_count,
+       d.created_at, d.updated_at, d.locked_by, d.locked_at, d.lock_expires_at
+FROM datasets d
+WHERE d.kind <> 'items' AND d.deleted_at IS NULL
+  AND (NOT $1::boolean OR d.visibility = 'public')
+  AND ($2::bigint = 0 OR d.project_id = $2)
+ORDER BY d.name ASC, d.id ASC
+`, publicOnly, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanDatasets(rows)
+}
+
+func normalizeDatasetDefaults(split string, status string) (string, string, error) {
+	var verr ValidationError
+	split, status = strings.TrimSpace(split), strings.TrimSpace(status)
+	if split != "" {
+		s, ok := NormalizeSplit(split)
+		if !ok {
+			verr.Add("default_split", "invalid default_split")
+		}
+		split = string(s)
+	}
+	if status != "" {
+		st, ok := NormalizeConversationStatus(status)
+		if !ok {
+			verr.Add("default_status", "invalid default_status")
+		}
+		status = string(st)
+	}
+	if err := verr.Err(); err != nil {
+		return "", "", err
+	}
+	return split, status, nil
+}
+
+// Defaults returns the split and status to use when a request omits them: the dataset's own
+// defaults when set, otherwise SplitTrain and ConversationStatusApproved.
+func (d Dataset) Defaults() (Split, ConversationStatus) {
+	split, status := SplitTrain, ConversationStatusApproved
+	if d.DefaultSplit != "" {
+		split = Split(d.DefaultSplit)
+	}
+	if d.DefaultStatus != "" {
+		status = ConversationStatus(d.DefaultStatus)
+	}
+	return split, status
+}
+
+func normalizeLicenseFields(license string, provenanceURL string) (string, string, error) {
+	var verr ValidationError
+	if strings.TrimSpace(license) != "" {
+		l, ok := NormalizeLicense(license)
+		if !ok {
+			verr.Add("license", fmt.Sprintf("unknown SPDX license %q", strings.TrimSpace(license)))
+		}
+		license = l
+	}
+	provenanceURL = strings.TrimSpace(provenanceURL)
+	if provenanceURL != "" && !validProvenanceURL(provenanceURL) {
+		verr.Add("provenance_url", "provenance_url must be an http(s) URL")
+	}
+	if err := verr.Err(); err != nil {
+		return "", "", err
+	}
+	return license, provenanceURL, nil
+}
@@ -0,0 +1,180 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDatasetDefaults(t *testing.T) {
+	split, status := Dataset{}.Defaults()
+	if split != SplitTrain || status != ConversationStatusApproved {
+		t.Fatalf("expected global defaults, got %s/%s", split, status)
+	}
+
+	split, status = Dataset{DefaultSplit: "test", DefaultStatus: "pending"}.Defaults()
+	if split != SplitTest || status != ConversationStatusPending {
+		t.Fatalf("expected dataset defaults, got %s/%s", split, status)
+	}
+}
+
+func TestNormalizeDatasetDefaults(t *testing.T) {
+	split, status, err := normalizeDatasetDefaults(" Valid ", "")
+	if err != nil || split != "valid" || status != "" {
+		t.Fatalf("unexpected result: %q %q %v", split, status, err)
+	}
+	if _, _, err := normalizeDatasetDefaults("all", ""); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected invalid split error, got %v", err)
+	}
+	if _, _, err := normalizeDatasetDefaults("", "done"); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected invalid status error, got %v", err)
+	}
+}
+
+func TestNormalizeDatasetKind(t *testing.T) {
+	for in, want := range map[string]string{"items": "items", " Conversations ": "conversations"} {
+		if got, ok := NormalizeDatasetKind(in); !ok || got != want {
+			t.Fatalf("%q: expected %q, got %q %v", in, want, got, ok)
+		}
+	}
+	for _, bad := range []string{"", "itms", "conversation", "mixed"} {
+		if _, ok := NormalizeDatasetKind(bad); ok {
+			t.Fatalf("%q should be rejected", bad)
+		}
+	}
+}
+
+func TestCreateDataset_RejectsUnknownKind(t *testing.T) {
+	// Validation runs before any query, so no database is needed.
+	_, err := CreateDataset(context.Background(), nil, CreateDatasetParams{Name: "x", Kind: "itms"})
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Fields["kind"] == "" {
+		t.Fatalf("expected a kind field error, got %v", err)
+	}
+	_, err = UpdateDataset(context.Background(), nil, 1, UpdateDatasetParams{Kind: ptr("conversation")})
+	if !errors.As(err, &verr) || verr.Fields["kind"] == "" {
+		t.Fatalf("expected a kind field error on update, got %v", err)
+	}
+}
+
+func ptr(s string) *string { return &s }
+
+func TestDatasetUpdateColumns(t *testing.T) {
+	cases := []struct {
+		name     string
+		p        UpdateDatasetParams
+		wantCols []string
+		wantArgs []any
+	}{
+		{"omitted fields are unchanged", UpdateDatasetParams{}, nil, nil},
+		{"empty name keeps it", UpdateDatasetParams{Name: "  "}, nil, nil},
+		{"empty description clears", UpdateDatasetParams{Description: ptr("")}, []string{"description"}, []any{""}},
+		{"new description", UpdateDatasetParams{Description: ptr(" chats ")}, []string{"description"}, []any{"chats"}},
+		{"empty readme clears", UpdateDatasetParams{Readme: ptr("")}, []string{"readme"}, []any{""}},
+		{"empty license clears", UpdateDatasetParams{License: ptr("")}, []string{"license"}, []any{""}},
+		{"new license", UpdateDatasetParams{License: ptr("mit")}, []string{"license"}, []any{"MIT"}},
+		{"empty provenance clears", UpdateDatasetParams{ProvenanceURL: ptr("")}, []string{"provenance_url"}, []any{""}},
+		{"empty defaults clear", UpdateDatasetParams{DefaultSplit: ptr(""), DefaultStatus: ptr("")}, []string{"default_split", "default_status"}, []any{"", ""}},
+		{"new kind", UpdateDatasetParams{Kind: ptr("Items")}, []string{"kind"}, []any{"items"}},
+		{"move project", UpdateDatasetParams{ProjectID: 3}, []string{"project_id"}, []any{int64(3)}},
+		{"several", UpdateDatasetParams{Name: "chat", Visibility: "private", DefaultStatus: ptr("draft")}, []string{"name", "visibility", "default_status"}, []any{"chat", "private", "draft"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			set, err := datasetUpdateColumns(tc.p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(set.cols, tc.wantCols) || !reflect.DeepEqual(set.args, tc.wantArgs) {
+				t.Fatalf("got %v %v, want %v %v", set.cols, set.args, tc.wantCols, tc.wantArgs)
+			}
+		})
+	}
+
+	for field, p := range map[string]UpdateDatasetParams{
+		"kind":           {Kind: ptr("")},
+		"license":        {License: ptr("not-a-license")},
+		"provenance_url": {ProvenanceURL: ptr("ftp://x")},
+		"default_split":  {DefaultSplit: ptr("all")},
+	} {
+		_, err := datasetUpdateColumns(p)
+		var verr *ValidationError
+		if !errors.As(err, &verr) || verr.Fields[field] == "" {
+			t.Fatalf("%s: expected a field error, got %v", field, err)
+		}
+	}
+}
+
+func TestColumnSetClause(t *testing.T) {
+	var set columnSet
+	set.add("description", "")
+	set.add("updated_at", 1)
+	if got := set.clause(2); got != "description = $2, updated_at = $3" {
+		t.Fatalf("clause = %q", got)
+	}
+}
+
+func TestDatasetReadme_SizeCap(t *testing.T) {
+	// Validation runs before any query, so no database is needed.
+	big := strings.Repeat("x", MaxDatasetReadmeBytes+1)
+	_, err := CreateDataset(context.Background(), nil, CreateDatasetParams{Name: "x", Readme: big})
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Fields["readme"] == "" {
+		t.Fatalf("expected a readme field error on create, got %v", err)
+	}
+	if _, err := datasetUpdateColumns(UpdateDatasetParams{Readme: &big}); !errors.As(err, &verr) || verr.Fields["readme"] == "" {
+		t.Fatalf("expected a readme field error on update, got %v", err)
+	}
+	atCap := big[1:]
+	set, err := datasetUpdateColumns(UpdateDatasetParams{Readme: &atCap})
+	if err != nil || !reflect.DeepEqual(set.cols, []string{"readme"}) {
+		t.Fatalf("a readme at the cap should be accepted, got %v %v", set.cols, err)
+	}
+}
+
+func TestDatasetReadme_OmittedWhenNotLoaded(t *testing.T) {
+	// List queries leave Readme empty; it must not show up in their JSON.
+	raw, err := json.Marshal(Dataset{ID: 1, Name: "chat"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), `"readme"`) {
+		t.Fatalf("expected no readme key, got %s", raw)
+	}
+	raw, _ = json.Marshal(Dataset{ID: 1, Name: "chat", Readme: "# Chat"})
+	if !strings.Contains(string(raw), `"readme":"# Chat"`) {
+		t.Fatalf("expected the readme, got %s", raw)
+	}
+}
+
+func TestUnlicensedDatasetsQuery_ScopedToExportFilters(t *testing.T) {
+	query, args := unlicensedDatasetsQuery(ExportOptions{Type: ExportTypePairs, PublicOnly: true, ProjectID: 4, Lang: "de", Dedup: DedupSemantic})
+	for _, want := range []string{"d.license = ''", "status = $1", "project_id = $2", "split = $3", "lang = $4", "visibility = 'public'"} {
+		if !strings.Contains(query, want) {
+			t.Fatalf("expected %q in:\n%s", want, query)
+		}
+	}
+	if strings.Contains(query, "conversation_embeddings") {
+		t.Fatalf("expected no embedding column in:\n%s", query)
+	}
+	if !reflect.DeepEqual(args, []any{"approved", int64(4), "train", "de"}) {
+		t.Fatalf("unexpected args %v", args)
+	}
+
+	query, args = unlicensedDatasetsQuery(ExportOptions{Status: "pending", Split: "valid", Interleave: []InterleaveWeight{{Split: "train", Weight: 1}}})
+	if strings.Contains(query, "split =") || !reflect.DeepEqual(args, []any{"pending"}) {
+		t.Fatalf("an interleaved export reads every split, got %v in:\n%s", args, query)
+	}
+}
+
+func TestConversationsFilterQuery_SkipsSoftDeletedDatasets(t *testing.T) {
+	// Soft-deleting a dataset archives its conversations, so an archived export across
+	// datasets is where they would show up.
+	q, _ := conversationsFilterQuery(ExportOptions{Status: "archived", Split: "all"})
+	if !strings.Contains(q, "dataset_id IN (SELECT id FROM datasets WHERE deleted_at IS NULL)") {
+		t.Fatalf("expected soft-deleted datasets left out: %s", q)
+	}
+}
@@ -0,0 +1,208 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DedupSemantic is the one dedup mode (ExportOptions.Dedup).
+const DedupSemantic = "semantic"
+
+// DefaultDedupThreshold is the cosine similarity at which a pair counts as a near duplicate.
+const DefaultDedupThreshold = 0.95
+
+// ParseDedup validates ?dedup=; "" and "none" disable deduplication.
+func ParseDedup(s string) (string, error) {
+	switch s = strings.ToLower(strings.TrimSpace(s)); s {
+	case "", "none":
+		return "", nil
+	case DedupSemantic:
+		return s, nil
+	default:
+		return "", fmt.Errorf("%w: dedup must be semantic or none, got %q", ErrInvalidInput, s)
+	}
+}
+
+// ParseDedupThreshold validates ?dedup_threshold=, a cosine similarity in (0, 1]; "" is
+// DefaultDedupThreshold.
+func ParseDedupThreshold(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return DefaultDedupThreshold, nil
+	}
+	t, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(t) || t <= 0 || t > 1 {
+		return 0, fmt.Errorf("%w: dedup_threshold must be in (0, 1], got %q", ErrInvalidInput, s)
+	}
+	return t, nil
+}
+
+// DedupStats counts what dedup=semantic did. Pairs whose conversation has an embedding are
+// compared by cosine similarity; the rest fall back to exact content-hash dedup and are
+// counted separately.
+type DedupStats struct {
+	Mode            string  `json:"mode"`
+	Threshold       float64 `json:"threshold"`
+	Semantic        int64   `json:"semantic"`         // pairs checked by embedding
+	SemanticSkipped int64   `json:"semantic_skipped"` // of those, dropped as near duplicates
+	Hash            int64   `json:"hash"`             // pairs without an embedding, checked by hash
+	HashSkipped     int64   `json:"hash_skipped"`     // of those, dropped as exact duplicates
+}
+
+// newDedupStats returns the stats an export with opts should fill, or nil without dedup.
+func newDedupStats(opts ExportOptions) *DedupStats {
+	if opts.Dedup == "" {
+		return nil
+	}
+	return &DedupStats{Mode: opts.Dedup, Threshold: opts.DedupThreshold}
+}
+
+// dedupsEmbeddings reports whether an export loads conversation embeddings for dedup.
+func (o ExportOptions) dedupsEmbeddings() bool {
+	return o.Dedup == DedupSemantic && o.Type == ExportTypePairs
+}
+
+// maxInMemoryDedupVectors caps the embeddings a pairDeduper compares in memory. Each check
+// is linear in them, so past the cap kept conversations are only remembered by id and
+// compared with pgvector instead.
+const maxInMemoryDedupVectors = 20000
+
+// pairDeduper holds what an export has emitted so far. Embeddings exist per conversation, so
+// a conversation's pairs are kept or dropped together by comparing its embedding with those
+// of conversations already exported: the first maxInMemoryDedupVectors in memory, later ones
+// through a query over the stored embeddings of the ids emitted since.
+type pairDeduper struct {
+	threshold float32
+	kept      [][]float32 // unit vectors
+	spilled   []int64
+	seen      map[string]struct{}
+	stats     *DedupStats
+
+	// nearAny reports whether a stored embedding of one of the conversations ids is within
+	// the threshold of unit. nil keeps every vector in memory.
+	nearAny func(unit []float32, ids []int64) (bool, error)
+}
+
+// newPairDeduper returns the deduper for an export with opts; db, when not nil, backs the
+// pgvector comparisons past maxInMemoryDedupVectors.
+func newPairDeduper(ctx context.Context, db *sql.DB, opts ExportOptions) *pairDeduper {
+	t := opts.DedupThreshold
+	if t <= 0 {
+		t = DefaultDedupThreshold
+	}
+	d := &pairDeduper{threshold: float32(t), seen: map[string]struct{}{}, stats: opts.DedupStats}
+	if db != nil {
+		d.nearAny = func(unit []float32, ids []int64) (bool, error) {
+			return embeddingNearAny(ctx, db, opts.DedupModel, unit, 1-t, ids)
+		}
+	}
+	return d
+}
+
+// keep returns the lines of conversation id (or an item) that are not duplicates. embedding
+// is the conversation's, nil when it has none; then each pair is checked by content hash.
+func (d *pairDeduper) keep(id int64, embedding []float32, lines []any) ([]any, error) {
+	if d == nil || len(lines) == 0 {
+		return lines, nil
+	}
+	st := d.stats
+	if st == nil {
+		st = &DedupStats{}
+	}
+	if unit := normalizeVector(embedding); unit != nil {
+		st.Semantic += int64(len(lines))
+		dup, err := d.nearDuplicate(unit)
+		if err != nil {
+			return nil, err
+		}
+		if dup {
+			st.SemanticSkipped += int64(len(lines))
+			return nil, nil
+		}
+		if len(d.kept) < maxInMemoryDedupVectors || d.nearAny == nil {
+			d.kept = append(d.kept, unit)
+		} else {
+			d.spilled = append(d.spilled, id)
+		}
+		return lines, nil
+	}
+
+	out := lines[:0:0]
+	for _, line := range lines {
+		p, ok := line.(ExportPair)
+		if !ok {
+			out = append(out, line)
+			continue
+		}
+		st.Hash++
+		h := PairContentHash(p)
+		if _, dup := d.seen[h]; dup {
+			st.HashSkipped++
+			continue
+		}
+		d.seen[h] = struct{}{}
+		out = append(out, line)
+	}
+	return out, nil
+}
+
+func (d *pairDeduper) nearDuplicate(unit []float32) (bool, error) {
+	for _, k := range d.kept {
+		if len(k) != len(unit) {
+			continue
+		}
+		var dot float32
+		for i := range k {
+			dot += k[i] * unit[i]
+		}
+		if dot >= d.threshold {
+			return true, nil
+		}
+	}
+	if len(d.spilled) == 0 {
+		return false, nil
+	}
+	return d.nearAny(unit, d.spilled)
+}
+
+// embeddingNearAny reports whether the stored embedding (by model, when set) of one of the
+// conversations ids is within cosine distance maxDist of vec. Only ids are compared, so the
+// probe itself, rows outside the export and near duplicates dropped earlier can never
+// crowd out an emitted neighbor.
+func embeddingNearAny(ctx context.Context, db *sql.DB, model string, vec []float32, maxDist float64, ids []int64) (bool, error) {
+	dims := len(vec)
+	args := []any{encodeVector(vec), maxDist, ids}
+	where := fmt.Sprintf("e.conversation_id = ANY($3) AND e.dims = %d AND (e.embedding::vector(%d) <=> $1::vector(%d)) <= $2", dims, dims, dims)
+	if model != "" {
+		args = append(args, model)
+		where += " AND e.model = $4"
+	}
+	var near bool
+	err := db.QueryRowContext(ctx, `
+SELECT EXISTS (
+  SELECT 1 FROM conversation_embeddings e
+  WHERE `+where+`
+)`, args...).Scan(&near)
+	return near, err
+}
+
+// normalizeVector returns v scaled to unit length, or nil for an empty or zero vector.
+func normalizeVector(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return nil
+	}
+	n := float32(math.Sqrt(sum))
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = x / n
+	}
+	return out
+}
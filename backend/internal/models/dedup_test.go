@@ -0,0 +1,132 @@
+package models
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDedupThreshold(t *testing.T) {
+	if v, err := ParseDedupThreshold(""); err != nil || v != DefaultDedupThreshold {
+		t.Fatalf("expected the default, got %v %v", v, err)
+	}
+	if v, err := ParseDedupThreshold("1"); err != nil || v != 1 {
+		t.Fatalf("expected 1, got %v %v", v, err)
+	}
+	for _, s := range []string{"0", "-0.5", "1.01", "NaN", "high"} {
+		if _, err := ParseDedupThreshold(s); err == nil {
+			t.Fatalf("expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestPairDeduper_Semantic(t *testing.T) {
+	stats := &DedupStats{}
+	d := newPairDeduper(context.Background(), nil, ExportOptions{DedupThreshold: 0.95, DedupStats: stats})
+	a := []any{ExportPair{User: "hi", Assistant: "hello"}, ExportPair{User: "bye", Assistant: "ciao"}}
+	b := []any{ExportPair{User: "hey", Assistant: "hello there"}}
+	c := []any{ExportPair{User: "weather?", Assistant: "sunny"}}
+
+	if got, _ := d.keep(0, []float32{1, 0, 0}, a); len(got) != 2 {
+		t.Fatalf("expected the first conversation kept, got %v", got)
+	}
+	// Same direction at another scale: a near duplicate, dropped with all its pairs.
+	if got, _ := d.keep(0, []float32{2, 0.1, 0}, b); len(got) != 0 {
+		t.Fatalf("expected a near duplicate dropped, got %v", got)
+	}
+	if got, _ := d.keep(0, []float32{0, 1, 0}, c); len(got) != 1 {
+		t.Fatalf("expected an orthogonal conversation kept, got %v", got)
+	}
+	// Embeddings of another dimension are never compared.
+	if got, _ := d.keep(0, []float32{1, 0}, c); len(got) != 1 {
+		t.Fatalf("expected a different dimension kept, got %v", got)
+	}
+	if stats.Semantic != 5 || stats.SemanticSkipped != 1 || stats.Hash != 0 {
+		t.Fatalf("unexpected stats %+v", *stats)
+	}
+}
+
+func TestPairDeduper_SpillsToNeighborLookup(t *testing.T) {
+	d := newPairDeduper(context.Background(), nil, ExportOptions{DedupThreshold: 0.95})
+	for len(d.kept) < maxInMemoryDedupVectors {
+		d.kept = append(d.kept, []float32{0, 0, 1})
+	}
+	// The stored embeddings: conversation 7 is emitted below; 1000..1199 are nearer to every
+	// probe but were never emitted (outside the export, or dropped as duplicates).
+	stored := map[int64][]float32{7: {1, 0, 0}}
+	for id := int64(1000); id < 1200; id++ {
+		stored[id] = []float32{1, 0.001, 0}
+	}
+	var lookups int
+	d.nearAny = func(unit []float32, ids []int64) (bool, error) {
+		lookups++
+		for _, id := range ids {
+			var dot float32
+			for i, x := range normalizeVector(stored[id]) {
+				dot += x * unit[i]
+			}
+			if dot >= 0.95 {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	line := []any{ExportPair{User: "hi", Assistant: "hello"}}
+
+	if got, _ := d.keep(7, []float32{1, 0, 0}, line); len(got) != 1 || lookups != 0 {
+		t.Fatalf("expected the first conversation past the cap kept without a lookup, got %v after %d lookups", got, lookups)
+	}
+	if len(d.kept) != maxInMemoryDedupVectors || !reflect.DeepEqual(d.spilled, []int64{7}) {
+		t.Fatalf("expected only the emitted id remembered past the cap, got %d vectors and %v", len(d.kept), d.spilled)
+	}
+	if got, _ := d.keep(8, []float32{1, 0.01, 0}, line); len(got) != 0 {
+		t.Fatalf("expected a neighbor of an emitted conversation dropped despite nearer non-emitted rows, got %v", got)
+	}
+	if got, _ := d.keep(9, []float32{0, 1, 0}, line); len(got) != 1 || lookups != 2 {
+		t.Fatalf("expected a conversation without emitted neighbors kept, got %v after %d lookups", got, lookups)
+	}
+}
+
+func TestEmbeddingNearAny_ComparesOnlyTheGivenIDs(t *testing.T) {
+	var query string
+	var args []any
+	db := newFakeDB(t, func(q string, a []any) fakeResult {
+		query, args = q, a
+		return fakeResult{cols: []string{"exists"}, rows: [][]any{{true}}}
+	})
+	near, err := embeddingNearAny(context.Background(), db, "m", []float32{1, 0, 0}, 0.05, []int64{7, 9})
+	if err != nil || !near {
+		t.Fatalf("expected a hit, got %v %v", near, err)
+	}
+	// Restricting to the emitted ids before anything else means no number of nearer rows
+	// outside them can hide a match, as a nearest-N lookup would.
+	if !strings.Contains(query, "e.conversation_id = ANY($3)") || strings.Contains(query, "LIMIT") || !reflect.DeepEqual(args[2], []int64{7, 9}) || args[3] != "m" {
+		t.Fatalf("expected the lookup restricted to the emitted ids, got %v: %s", args, query)
+	}
+}
+
+func TestPairDeduper_HashFallback(t *testing.T) {
+	stats := &DedupStats{}
+	d := newPairDeduper(context.Background(), nil, ExportOptions{DedupStats: stats})
+	p := ExportPair{User: "hi", Assistant: "hello"}
+	if got, _ := d.keep(0, nil, []any{p, ExportPair{User: "hi ", Assistant: "hello"}}); len(got) != 1 {
+		t.Fatalf("expected the repeat within a conversation dropped, got %v", got)
+	}
+	if got, _ := d.keep(0, []float32{0, 0}, []any{p}); len(got) != 0 {
+		t.Fatalf("expected a zero vector to fall back to hashing, got %v", got)
+	}
+	if stats.Hash != 3 || stats.HashSkipped != 2 {
+		t.Fatalf("unexpected stats %+v", *stats)
+	}
+}
+
+func TestConversationsFilterQuery_Dedup(t *testing.T) {
+	q, args := conversationsFilterQuery(ExportOptions{Status: "approved", Type: ExportTypePairs, Dedup: DedupSemantic, DedupModel: "m"})
+	if !strings.Contains(q, "conversation_embeddings e") || !strings.Contains(q, "e.model = $2") || args[1] != "m" {
+		t.Fatalf("expected the embedding column filtered by model, got %s %v", q, args)
+	}
+	if q, _ := conversationsFilterQuery(ExportOptions{Status: "approved", Type: ExportTypePairs}); strings.Contains(q, "conversation_embeddings") {
+		t.Fatalf("expected no embedding column without dedup, got %s", q)
+	}
+}
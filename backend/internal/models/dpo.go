@@ -0,0 +1,127 @@
+package models
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ExportDPO is one line of a type=dpo export: a stored preference pair, or with
+// DPOAlternatives a live message paired with one of its alternatives.
+type ExportDPO struct {
+	Prompt   string `json:"prompt"`
+	Chosen   string `json:"chosen"`
+	Rejected string `json:"rejected"`
+
+	// Only filled with WithSource.
+	ID             int64  `json:"preference_id,omitempty"`
+	AlternativeID  int64  `json:"alternative_id,omitempty"`
+	ConversationID *int64 `json:"conversation_id,omitempty"`
+	Split          string `json:"split,omitempty"`
+}
+
+// preferencePairsFilterQuery selects the preference pairs a type=dpo export covers. Pairs
+// have no status, so opts.Status does not apply.
+func preferencePairsFilterQuery(opts ExportOptions) (string, []any) {
+	var where []string
+	var args []any
+	if opts.DatasetID > 0 {
+		args = append(args, opts.DatasetID)
+		where = append(where, fmt.Sprintf("dataset_id = $%d", len(args)))
+	} else {
+		where = append(where, "dataset_id IN (SELECT id FROM datasets WHERE deleted_at IS NULL)")
+		if opts.PublicOnly {
+			where = append(where, "dataset_id IN (SELECT id FROM datasets WHERE visibility = 'public')")
+		}
+		if opts.ProjectID > 0 {
+			args = append(args, opts.ProjectID)
+			where = append(where, fmt.Sprintf("dataset_id IN (SELECT id FROM datasets WHERE project_id = $%d)", len(args)))
+		}
+	}
+	if opts.Split != "" && opts.Split != "all" {
+		args = append(args, opts.Split)
+		where = append(where, fmt.Sprintf("split = $%d", len(args)))
+	}
+	return `
+SELECT id, split, conversation_id, prompt, chosen, rejected
+FROM preference_pairs
+WHERE ` + strings.Join(where, " AND ") + `
+ORDER BY id ASC
+`, args
+}
+
+// alternativePairsFilterQuery selects the DPOAlternatives lines: the live content of an
+// assistant message that directly follows a user message, against each of its draft and
+// replaced alternatives that differs from it, in the conversations the export covers.
+func alternativePairsFilterQuery(opts ExportOptions) (string, []any) {
+	convs, args := conversationsFilterQuery(opts)
+	return `
+SELECT a.id, c.split, a.conversation_id, btrim(u.content), btrim(m.content), btrim(a.content)
+FROM message_alternatives a
+JOIN conversations c ON c.id = a.conversation_id
+JOIN conversation_messages m ON m.id = a.message_id AND m.role = 'assistant'
+JOIN conversation_messages u ON u.conversation_id = m.conversation_id AND u.idx = m.idx - 1 AND u.role = 'user'
+WHERE a.status <> '` + AlternativeStatusAccepted + `'
+  AND btrim(a.content) <> btrim(m.content)
+  AND btrim(a.content) <> '' AND btrim(u.content) <> ''
+  AND a.conversation_id IN (SELECT id FROM (` + convs + `) f)
+ORDER BY a.id ASC
+`, args
+}
+
+func streamPreferencePairs(ctx context.Context, db *sql.DB, w io.Writer, opts ExportOptions) error {
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+	enc := json.NewEncoder(bw)
+
+	count := 0
+	more := func() bool { return opts.MaxExamples == 0 || count < opts.MaxExamples }
+	emit := func(line ExportDPO, sampleID int64) (bool, error) {
+		if !opts.sampled(sampleID) {
+			return true, nil
+		}
+		if !opts.WithSource {
+			line.ID, line.AlternativeID, line.ConversationID, line.Split = 0, 0, nil, ""
+		}
+		if err := enc.Encode(line); err != nil {
+			return false, err
+		}
+		count++
+		return more(), nil
+	}
+
+	query, args := preferencePairsFilterQuery(opts)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	err = eachRow(ctx, rows, func() (bool, error) {
+		var line ExportDPO
+		if err := rows.Scan(&line.ID, &line.Split, &line.ConversationID, &line.Prompt, &line.Chosen, &line.Rejected); err != nil {
+			return false, err
+		}
+		return emit(line, line.ID)
+	})
+	if err != nil || !opts.DPOAlternatives || !more() {
+		return err
+	}
+
+	query, args = alternativePairsFilterQuery(opts)
+	altRows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer altRows.Close()
+	return eachRow(ctx, altRows, func() (bool, error) {
+		var line ExportDPO
+		if err := altRows.Scan(&line.AlternativeID, &line.Split, &line.ConversationID, &line.Prompt, &line.Chosen, &line.Rejected); err != nil {
+			return false, err
+		}
+		return emit(line, line.AlternativeID)
+	})
+}
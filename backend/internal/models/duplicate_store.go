@@ -0,0 +1,119 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// DuplicateOptions overrides fields of a duplicated conversation. Zero values keep the
+// source's dataset, split and notes; Status defaults to draft. AddTags are appended to the
+// source's tags.
+type DuplicateOptions struct {
+	DatasetID int64
+	Split     Split
+	Status    ConversationStatus
+	AddTags   []string
+	Notes     string
+
+	// CheckMessages, when set, vets a copy of the source's messages before anything is
+	// written; its error is returned as is.
+	CheckMessages func([]Message) error
+}
+
+// DuplicateConversation copies conversation id and its messages into opts.DatasetID (or the
+// source's dataset) with source "duplicate-of:<id>", records the copy in audit_log and
+// returns the new conversation. Conversations in deleted datasets are not found; a target
+// that is an items dataset fails with ErrWrongDatasetKind.
+func DuplicateConversation(ctx context.Context, db *sql.DB, id int64, opts DuplicateOptions) (Conversation, error) {
+	var src Conversation
+	var tagsRaw []byte
+	err := db.QueryRowContext(ctx, `
+SELECT c.dataset_id, c.split, c.tags, c.notes, c.lang, c.meta
+FROM conversations c
+JOIN datasets d ON d.id = c.dataset_id
+WHERE c.id = $1 AND d.deleted_at IS NULL
+`, id).Scan(&src.DatasetID, &src.Split, &tagsRaw, &src.Notes, &src.Lang, &src.Meta)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Conversation{}, ErrNotFound
+		}
+		return Conversation{}, err
+	}
+	msgs, err := loadMessages(ctx, db, id)
+	if err != nil {
+		return Conversation{}, err
+	}
+	if opts.CheckMessages != nil {
+		if err := opts.CheckMessages(slices.Clone(msgs)); err != nil {
+			return Conversation{}, err
+		}
+	}
+
+	conv := Conversation{
+		DatasetID: src.DatasetID,
+		Split:     src.Split,
+		Status:    ConversationStatusDraft,
+		Tags:      mergeTags(decodeTags(tagsRaw), opts.AddTags),
+		Source:    fmt.Sprintf("duplicate-of:%d", id),
+		Notes:     src.Notes,
+		Lang:      src.Lang,
+		Meta:      src.Meta,
+		Messages:  msgs,
+	}
+	if opts.DatasetID > 0 {
+		conv.DatasetID = opts.DatasetID
+	}
+	if opts.Split != "" {
+		conv.Split = opts.Split
+	}
+	if opts.Status != "" {
+		conv.Status = opts.Status
+	}
+	if opts.Notes != "" {
+		conv.Notes = opts.Notes
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return Conversation{}, err
+	}
+	defer tx.Rollback()
+
+	inserted, err := InsertConversationWithMessages(ctx, tx, conv)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return Conversation{}, fmt.Errorf("%w: target dataset %d not found", ErrInvalidInput, conv.DatasetID)
+		}
+		return Conversation{}, err
+	}
+	detail, _ := json.Marshal(map[string]int64{"duplicate_of": id, "dataset_id": conv.DatasetID})
+	if err := insertAuditEntry(ctx, tx, "conversation", inserted.ID, "duplicate", detail); err != nil {
+		return Conversation{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Conversation{}, err
+	}
+	return GetConversation(ctx, db, inserted.ID)
+}
+
+// mergeTags appends the non-blank tags of add that tags does not already hold.
+func mergeTags(tags, add []string) []string {
+	seen := make(map[string]bool, len(tags)+len(add))
+	for _, t := range tags {
+		seen[t] = true
+	}
+	for _, t := range add {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		tags = append(tags, t)
+	}
+	return tags
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeTags(t *testing.T) {
+	got := mergeTags([]string{"seed", "tone"}, []string{" formal ", "seed", "", "formal"})
+	want := []string{"seed", "tone", "formal"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("mergeTags = %v, want %v", got, want)
+	}
+	if got := mergeTags([]string{}, nil); got == nil || len(got) != 0 {
+		t.Fatalf("mergeTags(empty) = %#v, want empty non-nil", got)
+	}
+}
@@ -0,0 +1,273 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Text a conversation is embedded from.
+const (
+	EmbedTextFirstUser = "first_user"
+	EmbedTextFull      = "full"
+)
+
+// Nearest-neighbor index kinds (DATALAB_EMBED_INDEX); none leaves searches to a scan.
+const (
+	EmbedIndexHNSW    = "hnsw"
+	EmbedIndexIVFFlat = "ivfflat"
+	EmbedIndexNone    = "none"
+)
+
+var (
+	EmbedTexts   = []string{EmbedTextFirstUser, EmbedTextFull}
+	EmbedIndexes = []string{EmbedIndexHNSW, EmbedIndexIVFFlat, EmbedIndexNone}
+)
+
+// MaxEmbedChars bounds the text sent for one conversation; longer text is cut, keeping its
+// start.
+const MaxEmbedChars = 8000
+
+// ErrVectorUnavailable is returned when the conversation_embeddings table is missing because
+// pgvector was not installed when migration 029 ran.
+var ErrVectorUnavailable = errors.New("pgvector is not installed: semantic search is unavailable")
+
+// EmbeddingsAvailable reports whether the conversation_embeddings table exists.
+func EmbeddingsAvailable(ctx context.Context, db *sql.DB) (bool, error) {
+	var ok bool
+	err := db.QueryRowContext(ctx, `SELECT to_regclass('conversation_embeddings') IS NOT NULL`).Scan(&ok)
+	return ok, err
+}
+
+// EmbedInput is a conversation's text awaiting an embedding.
+type EmbedInput struct {
+	ConversationID int64
+	Text           string
+}
+
+// embedTextSQL selects the text of conversation c for source.
+func embedTextSQL(source string) string {
+	if source == EmbedTextFull {
+		return `COALESCE((SELECT string_agg(initcap(m.role) || ': ' || m.content, E'\n' ORDER BY m.idx)
+  FROM conversation_messages m WHERE m.conversation_id = c.id), '')`
+	}
+	return `COALESCE((SELECT m.content FROM conversation_messages m
+  WHERE m.conversation_id = c.id AND m.role = 'user' ORDER BY m.idx ASC LIMIT 1), '')`
+}
+
+// staleEmbeddingSQL matches conversations c whose embedding e is missing, was made by another
+// model or from other text, or predates the last message change.
+const staleEmbeddingSQL = `(e.conversation_id IS NULL OR e.model <> $2 OR e.text_source <> $3
+  OR e.embedded_at < COALESCE(c.messages_updated_at, c.updated_at))`
+
+// PendingEmbeddings returns up to limit conversations of datasetID that need an embedding for
+// model and source, oldest embedding first. Conversations without text for source are left
+// out. force includes up-to-date ones too, so repeated forced calls cycle through the dataset.
+func PendingEmbeddings(ctx context.Context, db *sql.DB, datasetID int64, model, source string, force bool, limit int) ([]EmbedInput, error) {
+	where := "c.dataset_id = $1 AND btrim(" + embedTextSQL(source) + ") <> ''"
+	if !force {
+		where += " AND " + staleEmbeddingSQL
+	}
+	rows, err := db.QueryContext(ctx, `
+SELECT c.id, `+embedTextSQL(source)+`
+FROM conversations c
+LEFT JOIN conversation_embeddings e ON e.conversation_id = c.id
+WHERE `+where+`
+ORDER BY e.embedded_at ASC NULLS FIRST, c.id ASC
+LIMIT $4
+`, datasetID, model, source, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []EmbedInput
+	for rows.Next() {
+		var in EmbedInput
+		if err := rows.Scan(&in.ConversationID, &in.Text); err != nil {
+			return nil, err
+		}
+		in.Text = headRunes(strings.TrimSpace(in.Text), MaxEmbedChars)
+		out = append(out, in)
+	}
+	return out, rows.Err()
+}
+
+// CountPendingEmbeddings counts conversations of datasetID that still need an embedding.
+func CountPendingEmbeddings(ctx context.Context, db *sql.DB, datasetID int64, model, source string) (int64, error) {
+	var n int64
+	err := db.QueryRowContext(ctx, `
+SELECT COUNT(*)
+FROM conversations c
+LEFT JOIN conversation_embeddings e ON e.conversation_id = c.id
+WHERE c.dataset_id = $1 AND `+staleEmbeddingSQL+` AND btrim(`+embedTextSQL(source)+`) <> ''
+`, datasetID, model, source).Scan(&n)
+	return n, err
+}
+
+// SaveEmbeddings upserts one embedding per input id, made by model from source text.
+func SaveEmbeddings(ctx context.Context, db *sql.DB, model, source string, ids []int64, vecs [][]float32) error {
+	if len(ids) != len(vecs) {
+		return fmt.Errorf("%w: %d ids for %d embeddings", ErrInvalidInput, len(ids), len(vecs))
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i, id := range ids {
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO conversation_embeddings (conversation_id, model, text_source, dims, embedding, embedded_at)
+VALUES ($1, $2, $3, $4, $5::vector, now())
+ON CONFLICT (conversation_id) DO UPDATE
+SET model = EXCLUDED.model, text_source = EXCLUDED.text_source, dims = EXCLUDED.dims,
+  embedding = EXCLUDED.embedding, embedded_at = EXCLUDED.embedded_at
+`, id, model, source, len(vecs[i]), encodeVector(vecs[i])); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// EnsureEmbeddingIndex creates the kind (hnsw or ivfflat) cosine index for dims-dimensional
+// embeddings unless it exists. ivfflat builds its lists from the rows present, so it should
+// be created once a dataset is embedded.
+func EnsureEmbeddingIndex(ctx context.Context, db *sql.DB, kind string, dims int) error {
+	var using string
+	switch kind {
+	case EmbedIndexHNSW:
+		using = "hnsw"
+	case EmbedIndexIVFFlat:
+		using = "ivfflat"
+	case EmbedIndexNone, "":
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown embedding index %q", ErrInvalidInput, kind)
+	}
+	if dims <= 0 {
+		return fmt.Errorf("%w: invalid embedding dimension %d", ErrInvalidInput, dims)
+	}
+	opts := ""
+	if using == "ivfflat" {
+		opts = " WITH (lists = 100)"
+	}
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`
+CREATE INDEX IF NOT EXISTS conversation_embeddings_%s_%d_idx
+  ON conversation_embeddings USING %s ((embedding::vector(%d)) vector_cosine_ops)%s
+  WHERE dims = %d
+`, using, dims, using, dims, opts, dims))
+	return err
+}
+
+// SimilarConversation is a nearest neighbor with its cosine similarity (1 = same direction).
+type SimilarConversation struct {
+	ID               int64              `json:"id"`
+	Split            Split              `json:"split"`
+	Status           ConversationStatus `json:"status"`
+	Tags             []string           `json:"tags"`
+	Source           string             `json:"source"`
+	PreviewUser      string             `json:"preview_user"`
+	PreviewAssistant string             `json:"preview_assistant"`
+	EmbeddedAt       time.Time          `json:"embedded_at"`
+	Score            float64            `json:"score"`
+}
+
+// ConversationEmbedding returns the stored embedding of conversation id of datasetID and
+// the model that made it; ErrNotFound when it has none or belongs to another dataset.
+func ConversationEmbedding(ctx context.Context, db *sql.DB, datasetID, id int64) ([]float32, string, error) {
+	var raw, model string
+	err := db.QueryRowContext(ctx, `
+SELECT e.embedding::text, e.model
+FROM conversation_embeddings e
+JOIN conversations c ON c.id = e.conversation_id
+WHERE e.conversation_id = $1 AND c.dataset_id = $2
+`, id, datasetID).Scan(&raw, &model)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, "", ErrNotFound
+		}
+		return nil, "", err
+	}
+	vec, err := decodeVector(raw)
+	return vec, model, err
+}
+
+// SimilarConversations returns the limit conversations of datasetID whose model embeddings
+// are closest to vec, best first, leaving out excludeID.
+func SimilarConversations(ctx context.Context, db *sql.DB, datasetID int64, model string, vec []float32, excludeID int64, limit int) ([]SimilarConversation, error) {
+	dims := len(vec)
+	if dims == 0 {
+		return nil, fmt.Errorf("%w: empty embedding", ErrInvalidInput)
+	}
+	// The cast and dims filter match EnsureEmbeddingIndex's expression and predicate, so the
+	// planner can use the index.
+	dist := fmt.Sprintf("(e.embedding::vector(%d) <=> $1::vector(%d))", dims, dims)
+	rows, err := db.QueryContext(ctx, `
+SELECT c.id, c.split, c.status, c.tags, c.source,
+  COALESCE((SELECT LEFT(m.content, 160) FROM conversation_messages m WHERE m.conversation_id = c.id AND m.role = 'user' ORDER BY m.idx ASC LIMIT 1), ''),
+  COALESCE((SELECT LEFT(m.content, 160) FROM conversation_messages m WHERE m.conversation_id = c.id AND m.role = 'assistant' ORDER BY m.idx ASC LIMIT 1), ''),
+  e.embedded_at, 1 - `+dist+`
+FROM conversation_embeddings e
+JOIN conversations c ON c.id = e.conversation_id
+WHERE `+fmt.Sprintf("e.dims = %d", dims)+` AND e.model = $2 AND c.dataset_id = $3 AND c.id <> $4
+ORDER BY `+dist+`
+LIMIT $5
+`, encodeVector(vec), model, datasetID, excludeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []SimilarConversation{}
+	for rows.Next() {
+		var s SimilarConversation
+		var tagsRaw []byte
+		if err := rows.Scan(&s.ID, &s.Split, &s.Status, &tagsRaw, &s.Source, &s.PreviewUser, &s.PreviewAssistant, &s.EmbeddedAt, &s.Score); err != nil {
+			return nil, err
+		}
+		s.Tags = decodeTags(tagsRaw)
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// encodeVector formats vec as a pgvector literal: [0.1,0.2,...].
+func encodeVector(vec []float32) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, v := range vec {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(v), 'g', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// decodeVector parses a pgvector literal.
+func decodeVector(s string) ([]float32, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "[") || !strings.HasSuffix(s, "]") {
+		return nil, fmt.Errorf("invalid vector %q", s)
+	}
+	s = strings.TrimSpace(s[1 : len(s)-1])
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, ",")
+	out := make([]float32, len(parts))
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vector element %q", p)
+		}
+		out[i] = float32(f)
+	}
+	return out, nil
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeVector(t *testing.T) {
+	vec := []float32{0.25, -1, 3.5e-7}
+	raw := encodeVector(vec)
+	if raw != "[0.25,-1,3.5e-07]" {
+		t.Fatalf("unexpected literal %s", raw)
+	}
+	got, err := decodeVector(raw)
+	if err != nil || !reflect.DeepEqual(got, vec) {
+		t.Fatalf("round trip: got %v %v", got, err)
+	}
+	if _, err := decodeVector("0.25,1"); err == nil {
+		t.Fatal("expected an error without brackets")
+	}
+}
+
+func TestEmbedTextSQL(t *testing.T) {
+	if q := embedTextSQL(EmbedTextFirstUser); !strings.Contains(q, "m.role = 'user'") {
+		t.Fatalf("expected the first user message, got %s", q)
+	}
+	if q := embedTextSQL(EmbedTextFull); !strings.Contains(q, "string_agg") {
+		t.Fatalf("expected all messages joined, got %s", q)
+	}
+}
@@ -1,8 +1,85 @@
 package models
 
-import "errors"
+import (
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
 
 var (
 	ErrNotFound     = errors.New("not found")
 	ErrInvalidInput = errors.New("invalid input")
+	ErrConflict     = errors.New("conflict")
+	ErrLocked       = errors.New("locked")
 )
+
+// ValidationError collects every rejected field of a request (field name -> message) so
+// callers can report them all at once. It matches ErrInvalidInput with errors.Is.
+type ValidationError struct {
+	Fields map[string]string
+	order  []string
+}
+
+// Add records msg for field; the first message for a field wins.
+func (e *ValidationError) Add(field, msg string) {
+	if _, ok := e.Fields[field]; ok {
+		return
+	}
+	if e.Fields == nil {
+		e.Fields = map[string]string{}
+	}
+	e.Fields[field] = msg
+	e.order = append(e.order, field)
+}
+
+// Merge adds the fields of err when it is a *ValidationError; other non-nil errors are
+// returned for the caller to handle.
+func (e *ValidationError) Merge(err error) error {
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		return err
+	}
+	for _, f := range ve.order {
+		e.Add(f, ve.Fields[f])
+	}
+	return nil
+}
+
+// Err returns e, or nil when no field was rejected.
+func (e *ValidationError) Err() error {
+	if len(e.order) == 0 {
+		return nil
+	}
+	return e
+}
+
+// First is the first rejected field, in the order the checks ran.
+func (e *ValidationError) First() string {
+	if len(e.order) == 0 {
+		return ""
+	}
+	return e.order[0]
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.order))
+	for _, f := range e.order {
+		msgs = append(msgs, e.Fields[f])
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Is(target error) bool { return target == ErrInvalidInput }
+
+// isUniqueViolation reports whether err is a Postgres unique_violation (23505).
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// isForeignKeyViolation reports whether err is a Postgres foreign_key_violation (23503).
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
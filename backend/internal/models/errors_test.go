@@ -0,0 +1,63 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestIsUniqueViolation(t *testing.T) {
+	wrapped := fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23505"})
+	if !isUniqueViolation(wrapped) {
+		t.Fatalf("expected a wrapped 23505 to be a unique violation")
+	}
+	if isUniqueViolation(&pgconn.PgError{Code: "23503"}) || isUniqueViolation(errors.New("boom")) {
+		t.Fatalf("only 23505 is a unique violation")
+	}
+}
+
+func TestIsForeignKeyViolation(t *testing.T) {
+	if !isForeignKeyViolation(fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23503"})) {
+		t.Fatalf("expected a wrapped 23503 to be a foreign key violation")
+	}
+	if isForeignKeyViolation(&pgconn.PgError{Code: "23505"}) || isForeignKeyViolation(errors.New("boom")) {
+		t.Fatalf("only 23503 is a foreign key violation")
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	var v ValidationError
+	if v.Err() != nil {
+		t.Fatal("an empty ValidationError should be no error")
+	}
+	v.Add("split", "invalid split")
+	v.Add("lang", "invalid lang")
+	v.Add("split", "ignored")
+	if err := v.Merge(fmt.Errorf("wrapped: %w", &ValidationError{Fields: map[string]string{"name": "name required"}, order: []string{"name"}})); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Merge(errors.New("boom")); err == nil {
+		t.Fatal("Merge should hand back other errors")
+	}
+	err := v.Err()
+	if !errors.Is(err, ErrInvalidInput) || v.First() != "split" || err.Error() != "invalid split; invalid lang; name required" {
+		t.Fatalf("unexpected %v (first %q)", err, v.First())
+	}
+}
+
+func TestCreateDataset_CollectsFieldErrors(t *testing.T) {
+	// Validation runs before any database access.
+	_, err := CreateDataset(context.Background(), nil, CreateDatasetParams{Visibility: "secret", License: "nope", DefaultSplit: "all"})
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	for _, f := range []string{"name", "visibility", "license", "default_split"} {
+		if ve.Fields[f] == "" {
+			t.Fatalf("expected %s in %v", f, ve.Fields)
+		}
+	}
+}
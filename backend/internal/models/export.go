@@ -8,29 +8,284 @@ import (
 	"fmt"
 	"io"
 	"strings"
+
+	"caiatech-datalab/backend/internal/tokens"
 )
 
 type ExportOptions struct {
-	Type          string // pairs|conversations
-	DatasetID     int64  // 0 = any
-	Split         string // train|valid|test|all
-	Status        string // approved|...
-	IncludeSystem bool
+	Type          string `json:"type"`       // pairs|conversations|completions|turns
+	DatasetID     int64  `json:"dataset_id"` // 0 = any
+	Split         string `json:"split"`      // train|valid|test|all
+	Status        string `json:"status"`     // approved|...
+	IncludeSystem bool   `json:"include_system"`
 
 	// pairs only
-	Context      string // none|window|full
-	ContextTurns int
-	RoleStyle    string // labels|plain
+	Context      string `json:"context"` // none|window|full
+	ContextTurns int    `json:"context_turns"`
+	// ContextTokens, when > 0, sizes the window by estimated tokens instead of ContextTurns.
+	ContextTokens int    `json:"context_tokens,omitempty"`
+	RoleStyle     string `json:"role_style"` // labels|plain
+
+	// Tokens estimates token counts for every token budget; nil means tokens.Default.
+	Tokens tokens.Estimator `json:"-"`
+
+	// Template (alpaca|chatml|custom, with TemplateText for custom) replaces RoleStyle when
+	// rendering context. StreamExport parses it into ContextTemplate unless already set.
+	Template        string           `json:"template,omitempty"`
+	TemplateText    string           `json:"template_text,omitempty"`
+	ContextTemplate *ContextTemplate `json:"-"`
+
+	MaxExamples int `json:"max_examples"`
+
+	// SampleRate, when in (0, 1), keeps each conversation (or item) with that probability,
+	// reproducibly for a given SampleSeed (see sampled). MaxExamples then caps the sample.
+	SampleRate float64 `json:"sample_rate,omitempty"`
+	SampleSeed int64   `json:"sample_seed,omitempty"`
+
+	// RowCap is the server-side safety cap (DATALAB_MAX_EXPORT_ROWS). It replaces MaxExamples
+	// when that is 0 or larger; 0 disables the cap. Truncated, when set, receives whether the
+	// cap cut the export short.
+	RowCap    int   `json:"-"`
+	Truncated *bool `json:"-"`
+
+	// MinAvgRating, when > 0, exports only conversations rated at least this on average.
+	MinAvgRating float64 `json:"min_avg_rating,omitempty"`
+
+	// MetaGTE exports only conversations whose numeric meta fields meet every threshold.
+	MetaGTE []MetaThreshold `json:"meta_gte,omitempty"`
+
+	// Lang, when set, exports only conversations tagged with this language code.
+	Lang string `json:"lang,omitempty"`
+
+	// Source and SourcePrefix keep only conversations whose source equals Source or starts
+	// with SourcePrefix (case-sensitive).
+	Source       string `json:"source,omitempty"`
+	SourcePrefix string `json:"source_prefix,omitempty"`
+
+	// IncludeFlagged keeps conversations with open moderation flags, which are skipped otherwise.
+	IncludeFlagged bool `json:"include_flagged,omitempty"`
+
+	// Normalize lists content normalization flags (see ParseNormalizeFlags) applied to
+	// message content in pairs, completions and conversation exports.
+	Normalize []string `json:"normalize,omitempty"`
+
+	// Interleave, when set, replaces Split: lines from each listed split are merged into one
+	// stream at the given weights (see ParseInterleave). pairs, completions and conversations only.
+	Interleave []InterleaveWeight `json:"interleave,omitempty"`
+
+	// MaxChars, when > 0, bounds the content characters of each pairs, completions or
+	// conversations line; OnOversize (skip|truncate, see fitLine) says what happens to longer ones.
+	MaxChars   int    `json:"max_chars,omitempty"`
+	OnOversize string `json:"on_oversize,omitempty"`
+
+	// QualityGate (off|lenient|strict, see ParseQualityGate) skips conversations failing lint
+	// rules: lenient skips lint errors, strict any issue. GateStats, when set, counts them.
+	QualityGate string            `json:"quality_gate,omitempty"`
+	GateStats   *QualityGateStats `json:"-"`
+
+	// Stratify (proportional|equal|none, see ParseStratify) shares MaxExamples across splits
+	// when Split is all; none keeps plain id order. SplitLines, when set, receives the lines
+	// written per split.
+	Stratify   string           `json:"stratify,omitempty"`
+	SplitLines map[string]int64 `json:"-"`
+
+	// Dedup=semantic (type=pairs, see dedup.go) skips pairs whose conversation embedding is at
+	// least DedupThreshold cosine-similar to one already exported; pairs without an embedding
+	// fall back to exact content-hash dedup. DedupModel, when set, only uses its embeddings;
+	// DedupStats, when set, counts both.
+	Dedup          string      `json:"dedup,omitempty"`
+	DedupThreshold float64     `json:"dedup_threshold,omitempty"`
+	DedupModel     string      `json:"-"`
+	DedupStats     *DedupStats `json:"-"`
+	dedup          *pairDeduper
+
+	// BatchModel is the model of every type=openai_batch request; BatchSystemPrompt, when set,
+	// replaces the conversations' system messages in them.
+	BatchModel        string `json:"batch_model,omitempty"`
+	BatchSystemPrompt string `json:"batch_system_prompt,omitempty"`
+
+	// IncludeMeta adds split, tags and the conversation's meta to each type=pairs_grouped
+	// line, and meta to each type=conversations line.
+	IncludeMeta bool `json:"include_meta,omitempty"`
 
-	MaxExamples int
+	// DPOAlternatives makes a type=dpo export also pair each assistant message's live content
+	// (chosen) with its draft and replaced alternatives (rejected), after the stored pairs.
+	DPOAlternatives bool `json:"dpo_alternatives,omitempty"`
+
+	// IncludeIDs adds conversation_id (or item_id) and assistant_message_idx to pair lines.
+	IncludeIDs bool `json:"include_ids,omitempty"`
+
+	// WithSource adds provenance (conversation or item id, source, split) to every line.
+	WithSource bool `json:"with_source,omitempty"`
+
+	// IncludeHash adds the content hash (see hash.go) to every pairs, completions, turns,
+	// conversations and items line, and to each pair of a pairs_grouped line.
+	IncludeHash bool `json:"include_hash,omitempty"`
+
+	// StampLicense, when set, is injected as a "_license" field into every exported line.
+	StampLicense string `json:"stamp_license,omitempty"`
+
+	// PublicOnly restricts cross-dataset exports (DatasetID 0) to public datasets.
+	PublicOnly bool `json:"-"`
+
+	// ProjectID restricts cross-dataset exports to one project's datasets; 0 = all.
+	ProjectID int64 `json:"-"`
 }
 
 type ExportPair struct {
 	User      string `json:"user"`
 	Assistant string `json:"assistant"`
+	Hash      string `json:"hash,omitempty"` // only filled with IncludeHash
+
+	ExportProvenance
+
+	// assistantIdx is the position of the assistant message the pair came from, when known,
+	// and assistantID its row.
+	assistantIdx *int
+	assistantID  int64
+	// turns are the prompt's messages, oldest first; only derived for type=turns. A pointer
+	// keeps ExportPair comparable.
+	turns *[]Message
+}
+
+// ExportConversation is one line of a type=conversations export. A struct (rather than a map)
+// keeps the key order fixed so exports diff cleanly.
+type ExportConversation struct {
+	ID       int64           `json:"id"`
+	Split    string          `json:"split"`
+	Status   string          `json:"status"`
+	Tags     []string        `json:"tags"`
+	Source   string          `json:"source"`
+	Notes    string          `json:"notes"`
+	Meta     json.RawMessage `json:"meta,omitempty"` // only filled with IncludeMeta
+	Messages []Message       `json:"messages"`
+	Hash     string          `json:"hash,omitempty"` // only filled with IncludeHash
+}
+
+// ExportPairsGroup is one line of a type=pairs_grouped export: every pair of a conversation,
+// so they land in the same batch or shard.
+type ExportPairsGroup struct {
+	ConversationID int64 `json:"conversation_id"`
+	*ExportGroupMeta
+	Pairs []ExportPair `json:"pairs"`
+}
+
+// ExportGroupMeta is only filled with IncludeMeta.
+type ExportGroupMeta struct {
+	Split string          `json:"split"`
+	Tags  []string        `json:"tags"`
+	Meta  json.RawMessage `json:"meta,omitempty"`
+}
+
+// ExportCompletion is one line of a type=completions export (continued pretraining).
+type ExportCompletion struct {
+	Text string `json:"text"`
+	Hash string `json:"hash,omitempty"` // only filled with IncludeHash
+
+	ExportProvenance
+}
+
+// ExportTurns is one line of a type=turns export: the prompt as the ordered contents of the
+// turns before the reply, so trainers need not parse role labels out of a rendered string.
+type ExportTurns struct {
+	PromptTurns []string `json:"prompt_turns"`
+	Completion  string   `json:"completion"`
+	Hash        string   `json:"hash,omitempty"` // only filled with IncludeHash
+
+	ExportProvenance
+
+	// roles are the roles of PromptTurns, for the content hash.
+	roles []Role
+}
+
+// ExportProvenance traces an exported line back to its row; only filled with WithSource.
+type ExportProvenance struct {
+	ConversationID int64  `json:"conversation_id,omitempty"`
+	Source         string `json:"source,omitempty"`
+	Split          string `json:"split,omitempty"`
+	ItemID         int64  `json:"item_id,omitempty"`
+	SourceRef      string `json:"source_ref,omitempty"`
+
+	// AssistantMessageIdx is only filled with IncludeIDs.
+	AssistantMessageIdx *int `json:"assistant_message_idx,omitempty"`
+}
+
+// EffectiveMaxExamples returns MaxExamples with RowCap applied; capped reports whether the
+// cap, rather than the caller's own limit, is in force.
+func (o ExportOptions) EffectiveMaxExamples() (n int, capped bool) {
+	if o.RowCap > 0 && (o.MaxExamples == 0 || o.MaxExamples > o.RowCap) {
+		return o.RowCap, true
+	}
+	return o.MaxExamples, false
+}
+
+// capWriter passes the first limit lines to w and swallows the rest; over records that
+// there was more. StreamExport runs a capped export for limit+1 examples through it, so a cap
+// that was merely met is not reported as truncation.
+type capWriter struct {
+	w     io.Writer
+	limit int64
+	lines int64
+	over  bool
+}
+
+func (c *capWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if c.lines >= c.limit {
+		c.over = c.over || n > 0
+		return n, nil
+	}
+	keep := len(p)
+	for i, b := range p {
+		if b == '\n' {
+			c.lines++
+			if c.lines == c.limit {
+				keep = i + 1
+				break
+			}
+		}
+	}
+	if keep < len(p) {
+		c.over = true
+	}
+	if _, err := c.w.Write(p[:keep]); err != nil {
+		return 0, err
+	}
+	return n, nil
 }
 
 func StreamExport(ctx context.Context, db *sql.DB, w io.Writer, opts ExportOptions) error {
+	if limit, capped := opts.EffectiveMaxExamples(); capped {
+		cw := &capWriter{w: w, limit: int64(limit)}
+		truncated := opts.Truncated
+		opts.MaxExamples, opts.RowCap, opts.Truncated = limit+1, 0, nil
+		if err := StreamExport(ctx, db, cw, opts); err != nil {
+			return err
+		}
+		if truncated != nil {
+			*truncated = cw.over
+		}
+		if cw.over && opts.SplitLines != nil {
+			// The swallowed line was the last one written, so it belongs to the last split.
+			for i := len(stratifySplits) - 1; i >= 0; i-- {
+				if opts.SplitLines[stratifySplits[i]] > 0 {
+					opts.SplitLines[stratifySplits[i]]--
+					break
+				}
+			}
+		}
+		return nil
+	}
+	if opts.Truncated != nil {
+		*opts.Truncated = false
+	}
+	if opts.Template != "" && opts.ContextTemplate == nil {
+		ct, err := ParseContextTemplate(opts.Template, opts.TemplateText)
+		if err != nil {
+			return err
+		}
+		opts.ContextTemplate = ct
+	}
 	if opts.Type == "" {
 		opts.Type = "pairs"
 	}
@@ -40,6 +295,18 @@ func StreamExport(ctx context.Context, db *sql.DB, w io.Writer, opts ExportOptio
 	if opts.Status == "" {
 		opts.Status = string(ConversationStatusApproved)
 	}
+	if opts.Dedup != "" && opts.dedup == nil {
+		opts.dedup = newPairDeduper(ctx, db, opts)
+	}
+
+	if opts.StampLicense != "" {
+		st := newLicenseStamper(w, opts.StampLicense)
+		opts.StampLicense = ""
+		if err := StreamExport(ctx, db, st, opts); err != nil {
+			return err
+		}
+		return st.Flush()
+	}
 
 	if opts.DatasetID > 0 {
 		ds, err := GetDataset(ctx, db, opts.DatasetID)
@@ -51,11 +318,79 @@ func StreamExport(ctx context.Context, db *sql.DB, w io.Writer, opts ExportOptio
 		}
 	}
 
+	if len(opts.Interleave) > 0 {
+		return streamInterleaved(ctx, db, w, opts)
+	}
+	if opts.stratified() {
+		return streamStratified(ctx, db, w, opts)
+	}
+	return streamConversationExport(ctx, db, w, opts)
+}
+
+// ExportHasRows reports whether any conversation or item matches the filters of opts, a cheap
+// check before streaming. Sampling and the per-row checks (quality gate, oversize drops) run
+// only while streaming, so an export can still come out empty when this is true.
+func ExportHasRows(ctx context.Context, db *sql.DB, opts ExportOptions) (bool, error) {
+	if opts.Split == "" {
+		opts.Split = string(SplitTrain)
+	}
+	if opts.Status == "" {
+		opts.Status = string(ConversationStatusApproved)
+	}
+
+	var exists bool
+	if opts.DatasetID > 0 {
+		ds, err := GetDataset(ctx, db, opts.DatasetID)
+		if err != nil {
+			return false, err
+		}
+		if strings.EqualFold(ds.Kind, "items") {
+			err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM dataset_items WHERE dataset_id = $1)`, opts.DatasetID).Scan(&exists)
+			return exists, err
+		}
+	}
+	if opts.Type == ExportTypeDPO {
+		query, args := preferencePairsFilterQuery(opts)
+		if err := db.QueryRowContext(ctx, `SELECT EXISTS (`+query+`)`, args...).Scan(&exists); err != nil || exists || !opts.DPOAlternatives {
+			return exists, err
+		}
+		query, args = alternativePairsFilterQuery(opts)
+		err := db.QueryRowContext(ctx, `SELECT EXISTS (`+query+`)`, args...).Scan(&exists)
+		return exists, err
+	}
+
+	splits := []string{opts.Split}
+	if len(opts.Interleave) > 0 {
+		splits = splits[:0]
+		for _, iw := range opts.Interleave {
+			splits = append(splits, iw.Split)
+		}
+	}
+	for _, split := range splits {
+		splitOpts := opts
+		splitOpts.Split = split
+		query, args := conversationsFilterQuery(splitOpts)
+		if err := db.QueryRowContext(ctx, `SELECT EXISTS (`+query+`)`, args...).Scan(&exists); err != nil {
+			return false, err
+		}
+		if exists {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// streamConversationExport streams a conversation dataset export of opts.Type.
+func streamConversationExport(ctx context.Context, db *sql.DB, w io.Writer, opts ExportOptions) error {
 	switch opts.Type {
-	case "pairs":
+	case ExportTypePairs, ExportTypeCompletions, ExportTypeTurns, ExportTypeOpenAIBatch:
 		return streamPairs(ctx, db, w, opts)
-	case "conversations":
+	case ExportTypePairsGrouped:
+		return streamPairsGrouped(ctx, db, w, opts)
+	case ExportTypeConversations:
 		return streamConversations(ctx, db, w, opts)
+	case ExportTypeDPO:
+		return streamPreferencePairs(ctx, db, w, opts)
 	default:
 		return fmt.Errorf("unknown export type: %s", opts.Type)
 	}
@@ -63,11 +398,11 @@ func StreamExport(ctx context.Context, db *sql.DB, w io.Writer, opts ExportOptio
 
 func streamDatasetItems(ctx context.Context, db *sql.DB, w io.Writer, opts ExportOptions) error {
 	switch opts.Type {
-	case "pairs":
+	case ExportTypePairs, ExportTypeCompletions, ExportTypeTurns:
 		return streamPairsFromDatasetItems(ctx, db, w, opts)
-	case "items":
+	case ExportTypeItems:
 		return streamDatasetItemsRaw(ctx, db, w, opts)
-	case "items_with_meta":
+	case ExportTypeItemsWithMeta:
 		return streamDatasetItemsWithMeta(ctx, db, w, opts)
 	default:
 		return fmt.Errorf("unknown export type for items dataset: %s", opts.Type)
@@ -87,45 +422,106 @@ func streamConversations(ctx context.Context, db *sql.DB, w io.Writer, opts Expo
 	defer rows.Close()
 
 	count := 0
-	for rows.Next() {
-		var id int64
-		var split string
-		var status string
-		var tagsRaw []byte
-		var source string
-		var notes string
-		if err := rows.Scan(&id, &split, &status, &tagsRaw, &source, &notes); err != nil {
-			return err
+	return eachRow(ctx, rows, func() (bool, error) {
+		c, err := scanExportConversationRow(rows, opts)
+		if err != nil {
+			return false, err
 		}
-
-		msgs, err := loadMessages(ctx, db, id)
+		if !opts.sampled(c.ID) {
+			return true, nil
+		}
+		msgs, err := loadMessages(ctx, db, c.ID)
 		if err != nil {
-			return err
+			return false, err
 		}
-
-		var tags []string
-		_ = json.Unmarshal(tagsRaw, &tags)
-
-		obj := map[string]any{
-			"id":       id,
-			"split":    split,
-			"status":   status,
-			"tags":     tags,
-			"source":   source,
-			"notes":    notes,
-			"messages": msgs,
+		if !passesQualityGate(msgs, opts) {
+			return true, nil
 		}
 
-		if err := enc.Encode(obj); err != nil {
-			return err
+		line, ok := finishLine(conversationLine(c, msgs, opts), opts)
+		if !ok {
+			return true, nil
+		}
+		if err := enc.Encode(line); err != nil {
+			return false, err
 		}
 
 		count++
-		if opts.MaxExamples > 0 && count >= opts.MaxExamples {
-			break
+		return opts.MaxExamples == 0 || count < opts.MaxExamples, nil
+	})
+}
+
+// exportConversationRow is one row of conversationsFilterQuery.
+type exportConversationRow struct {
+	ID      int64
+	Split   string
+	Status  string
+	TagsRaw []byte
+	Source  string
+	Notes   string
+	Meta    []byte
+
+	// Embedding is the conversation's pgvector literal, "" when it has none; only selected
+	// when opts.dedupsEmbeddings().
+	Embedding string
+}
+
+func scanExportConversationRow(rows *sql.Rows, opts ExportOptions) (exportConversationRow, error) {
+	var c exportConversationRow
+	dest := []any{&c.ID, &c.Split, &c.Status, &c.TagsRaw, &c.Source, &c.Notes, &c.Meta}
+	if opts.dedupsEmbeddings() {
+		dest = append(dest, &c.Embedding)
+	}
+	err := rows.Scan(dest...)
+	return c, err
+}
+
+// conversationLine is the type=conversations line for c.
+func conversationLine(c exportConversationRow, msgs []Message, opts ExportOptions) ExportConversation {
+	line := ExportConversation{
+		ID:       c.ID,
+		Split:    c.Split,
+		Status:   c.Status,
+		Tags:     decodeTags(c.TagsRaw),
+		Source:   c.Source,
+		Notes:    c.Notes,
+		Messages: normalizeMessages(msgs, opts.Normalize),
+	}
+	if opts.IncludeMeta {
+		line.Meta = conversationMeta(c.Meta)
+	}
+	return line
+}
+
+// conversationPairLines renders c as type=pairs, completions or turns lines.
+func conversationPairLines(c exportConversationRow, msgs []Message, opts ExportOptions) ([]any, error) {
+	pairs, err := derivePairs(msgs, opts)
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]any, 0, len(pairs))
+	for _, p := range pairs {
+		if opts.WithSource {
+			p.ExportProvenance = ExportProvenance{ConversationID: c.ID, Source: c.Source, Split: c.Split}
+		}
+		if opts.IncludeIDs || opts.Type == ExportTypeOpenAIBatch {
+			p.ConversationID = c.ID
+			p.AssistantMessageIdx = p.assistantIdx
+		}
+		line, err := pairLine(p, opts)
+		if err != nil {
+			return nil, err
+		}
+		if line, ok := finishLine(line, opts); ok {
+			lines = append(lines, line)
 		}
 	}
-	return rows.Err()
+	if opts.dedup != nil {
+		// An unreadable embedding is treated as missing, falling back to hash dedup.
+		vec, _ := decodeVector(c.Embedding)
+		return opts.dedup.keep(c.ID, vec, lines)
+	}
+	return lines, nil
 }
 
 func streamDatasetItemsRaw(ctx context.Context, db *sql.DB, w io.Writer, opts ExportOptions) error {
@@ -137,7 +533,7 @@ func streamDatasetItemsRaw(ctx context.Context, db *sql.DB, w io.Writer, opts Ex
 	defer bw.Flush()
 
 	rows, err := db.QueryContext(ctx, `
-SELECT data
+SELECT id, source_ref, data
 FROM dataset_items
 WHERE dataset_id = $1
 ORDER BY id ASC
@@ -148,23 +544,39 @@ ORDER BY id ASC
 	defer rows.Close()
 
 	count := 0
-	for rows.Next() {
+	return eachRow(ctx, rows, func() (bool, error) {
+		var id int64
+		var sourceRef string
 		var data json.RawMessage
-		if err := rows.Scan(&data); err != nil {
-			return err
+		if err := rows.Scan(&id, &sourceRef, &data); err != nil {
+			return false, err
 		}
-		if _, err := bw.Write(data); err != nil {
-			return err
+		if !opts.sampled(id) {
+			return true, nil
+		}
+		// Raw items keep their own keys; provenance and the hash go in underscore fields like
+		// _license.
+		var prefix []byte
+		if opts.WithSource {
+			ref, _ := json.Marshal(sourceRef)
+			prefix = fmt.Appendf(prefix, `"_id":%d,"_source_ref":%s,`, id, ref)
+		}
+		if opts.IncludeHash {
+			prefix = fmt.Appendf(prefix, `"_hash":%q,`, lineHash(ItemContentHash(data)))
+		}
+		if len(prefix) > 0 {
+			if err := writeWithFields(bw, append([]byte{'{'}, prefix...), data); err != nil {
+				return false, err
+			}
+		} else if _, err := bw.Write(data); err != nil {
+			return false, err
 		}
 		if err := bw.WriteByte('\n'); err != nil {
-			return err
+			return false, err
 		}
 		count++
-		if opts.MaxExamples > 0 && count >= opts.MaxExamples {
-			break
-		}
-	}
-	return rows.Err()
+		return opts.MaxExamples == 0 || count < opts.MaxExamples, nil
+	})
 }
 
 func streamDatasetItemsWithMeta(ctx context.Context, db *sql.DB, w io.Writer, opts ExportOptions) error {
@@ -177,7 +589,13 @@ func streamDatasetItemsWithMeta(ctx context.Context, db *sql.DB, w io.Writer, op
 	enc := json.NewEncoder(bw)
 
 	rows, err := db.QueryContext(ctx, `
-SELECT id, dataset_id, source_ref, data
+SELECT id, dataset_id, source_ref, data,
+  COALESCE((
+    SELECT jsonb_agg(jsonb_build_object('key', a.key, 'value', a.value, 'author', a.author, 'created_at', a.created_at)
+                     ORDER BY a.key, a.author)
+    FROM item_annotations a
+    WHERE a.item_id = dataset_items.id
+  ), '[]'::jsonb)
 FROM dataset_items
 WHERE dataset_id = $1
 ORDER BY id ASC
@@ -188,29 +606,34 @@ ORDER BY id ASC
 	defer rows.Close()
 
 	count := 0
-	for rows.Next() {
+	return eachRow(ctx, rows, func() (bool, error) {
 		var id int64
 		var datasetID int64
 		var sourceRef string
 		var data json.RawMessage
-		if err := rows.Scan(&id, &datasetID, &sourceRef, &data); err != nil {
-			return err
+		var annotations json.RawMessage
+		if err := rows.Scan(&id, &datasetID, &sourceRef, &data, &annotations); err != nil {
+			return false, err
+		}
+		if !opts.sampled(id) {
+			return true, nil
 		}
 		obj := map[string]any{
-			"id":         id,
-			"dataset_id": datasetID,
-			"source_ref": sourceRef,
-			"data":       json.RawMessage(data),
+			"id":          id,
+			"dataset_id":  datasetID,
+			"source_ref":  sourceRef,
+			"data":        json.RawMessage(data),
+			"annotations": json.RawMessage(annotations),
+		}
+		if opts.IncludeHash {
+			obj["hash"] = lineHash(ItemContentHash(data))
 		}
 		if err := enc.Encode(obj); err != nil {
-			return err
+			return false, err
 		}
 		count++
-		if opts.MaxExamples > 0 && count >= opts.MaxExamples {
-			break
-		}
-	}
-	return rows.Err()
+		return opts.MaxExamples == 0 || count < opts.MaxExamples, nil
+	})
 }
 
 func streamPairs(ctx context.Context, db *sql.DB, w io.Writer, opts ExportOptions) error {
@@ -226,34 +649,104 @@ func streamPairs(ctx context.Context, db *sql.DB, w io.Writer, opts ExportOption
 	defer rows.Close()
 
 	count := 0
-	for rows.Next() {
+	return eachRow(ctx, rows, func() (bool, error) {
+		c, err := scanExportConversationRow(rows, opts)
+		if err != nil {
+			return false, err
+		}
+		if !opts.sampled(c.ID) {
+			return true, nil
+		}
+		msgs, err := loadMessages(ctx, db, c.ID)
+		if err != nil {
+			return false, err
+		}
+		if !passesQualityGate(msgs, opts) {
+			return true, nil
+		}
+
+		lines, err := conversationPairLines(c, msgs, opts)
+		if err != nil {
+			return false, err
+		}
+		for _, line := range lines {
+			if err := enc.Encode(line); err != nil {
+				return false, err
+			}
+			count++
+			if opts.MaxExamples > 0 && count >= opts.MaxExamples {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+}
+
+// streamPairsGrouped writes one ExportPairsGroup per conversation that yields pairs;
+// MaxExamples caps conversations rather than pairs.
+func streamPairsGrouped(ctx context.Context, db *sql.DB, w io.Writer, opts ExportOptions) error {
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+	enc := json.NewEncoder(bw)
+
+	query, args := conversationsFilterQuery(opts)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	count := 0
+	return eachRow(ctx, rows, func() (bool, error) {
 		var id int64
 		var split string
 		var status string
 		var tagsRaw []byte
 		var source string
 		var notes string
-		if err := rows.Scan(&id, &split, &status, &tagsRaw, &source, &notes); err != nil {
-			return err
+		var meta []byte
+		if err := rows.Scan(&id, &split, &status, &tagsRaw, &source, &notes, &meta); err != nil {
+			return false, err
+		}
+		if !opts.sampled(id) {
+			return true, nil
 		}
 
 		msgs, err := loadMessages(ctx, db, id)
 		if err != nil {
-			return err
+			return false, err
 		}
-
-		pairs := derivePairs(msgs, opts)
-		for _, p := range pairs {
-			if err := enc.Encode(p); err != nil {
-				return err
+		if !passesQualityGate(msgs, opts) {
+			return true, nil
+		}
+		pairs, err := derivePairs(msgs, opts)
+		if err != nil {
+			return false, err
+		}
+		line := ExportPairsGroup{ConversationID: id, Pairs: pairs}
+		if len(line.Pairs) == 0 {
+			return true, nil
+		}
+		if opts.IncludeIDs {
+			for i := range line.Pairs {
+				line.Pairs[i].AssistantMessageIdx = line.Pairs[i].assistantIdx
 			}
-			count++
-			if opts.MaxExamples > 0 && count >= opts.MaxExamples {
-				return nil
+		}
+		if opts.IncludeHash {
+			for i := range line.Pairs {
+				line.Pairs[i].Hash = lineHash(PairContentHash(line.Pairs[i]))
 			}
 		}
-	}
-	return rows.Err()
+		if opts.IncludeMeta {
+			line.ExportGroupMeta = &ExportGroupMeta{Split: split, Tags: decodeTags(tagsRaw), Meta: conversationMeta(meta)}
+		}
+		if err := enc.Encode(line); err != nil {
+			return false, err
+		}
+
+		count++
+		return opts.MaxExamples == 0 || count < opts.MaxExamples, nil
+	})
 }
 
 func streamPairsFromDatasetItems(ctx context.Context, db *sql.DB, w io.Writer, opts ExportOptions) error {
@@ -266,7 +759,7 @@ func streamPairsFromDatasetItems(ctx context.Context, db *sql.DB, w io.Writer, o
 	enc := json.NewEncoder(bw)
 
 	rows, err := db.QueryContext(ctx, `
-SELECT data
+SELECT id, source_ref, data
 FROM dataset_items
 WHERE dataset_id = $1
 ORDER BY id ASC
@@ -277,30 +770,122 @@ ORDER BY id ASC
 	defer rows.Close()
 
 	count := 0
-	for rows.Next() {
+	return eachRow(ctx, rows, func() (bool, error) {
+		var id int64
+		var sourceRef string
 		var data json.RawMessage
-		if err := rows.Scan(&data); err != nil {
-			return err
+		if err := rows.Scan(&id, &sourceRef, &data); err != nil {
+			return false, err
+		}
+		if !opts.sampled(id) {
+			return true, nil
 		}
 
-		pairs := derivePairsFromItemData(data, opts)
+		pairs, err := derivePairsFromItemData(data, opts)
+		if err != nil {
+			return false, err
+		}
 		for _, p := range pairs {
-			if err := enc.Encode(p); err != nil {
-				return err
+			if opts.WithSource {
+				p.ExportProvenance = ExportProvenance{ItemID: id, SourceRef: sourceRef}
+			}
+			if opts.IncludeIDs {
+				p.ItemID = id
+				p.AssistantMessageIdx = p.assistantIdx
+			}
+			line, err := pairLine(p, opts)
+			if err != nil {
+				return false, err
+			}
+			line, ok := finishLine(line, opts)
+			if !ok {
+				continue
+			}
+			// Items have no embeddings, so dedup compares content hashes.
+			if opts.dedup != nil {
+				kept, err := opts.dedup.keep(id, nil, []any{line})
+				if err != nil {
+					return false, err
+				}
+				if len(kept) == 0 {
+					continue
+				}
+			}
+			if err := enc.Encode(line); err != nil {
+				return false, err
 			}
 			count++
 			if opts.MaxExamples > 0 && count >= opts.MaxExamples {
-				return nil
+				return false, nil
 			}
 		}
+		return true, nil
+	})
+}
+
+// rowCursor is the part of *sql.Rows that eachRow drives.
+type rowCursor interface {
+	Next() bool
+	Err() error
+}
+
+// eachRow calls fn for every row until fn returns false or an error. ctx is checked before
+// each row so an aborted download stops the scan (and the per-row message queries) promptly;
+// the caller's deferred rows.Close then releases the cursor without draining it.
+func eachRow(ctx context.Context, rows rowCursor, fn func() (bool, error)) error {
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		more, err := fn()
+		if err != nil || !more {
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 	return rows.Err()
 }
 
-func derivePairsFromItemData(data json.RawMessage, opts ExportOptions) []ExportPair {
+// pairLine returns what a pairs-style export writes for p: the pair itself, only the
+// completion side for type=completions, the prompt turns and reply for type=turns, or the
+// request replaying the prompt for type=openai_batch.
+func pairLine(p ExportPair, opts ExportOptions) (any, error) {
+	if opts.Type == ExportTypeOpenAIBatch {
+		return batchRequestLine(p, opts), nil
+	}
+	if opts.Type == ExportTypeTurns {
+		var turns []Message
+		if p.turns != nil {
+			turns = *p.turns
+		}
+		t := ExportTurns{PromptTurns: make([]string, len(turns)), Completion: p.Assistant, ExportProvenance: p.ExportProvenance, roles: make([]Role, len(turns))}
+		for i, m := range turns {
+			t.PromptTurns[i], t.roles[i] = m.Content, m.Role
+		}
+		return t, nil
+	}
+	if opts.Type != ExportTypeCompletions {
+		return p, nil
+	}
+	if opts.Context == "" || opts.Context == "none" {
+		return ExportCompletion{Text: p.Assistant, ExportProvenance: p.ExportProvenance}, nil
+	}
+	// With context, the rendered prompt precedes the completion in the same style.
+	style := opts.lineStyle()
+	reply, err := style.line(Message{Role: RoleAssistant, Content: p.Assistant})
+	if err != nil {
+		return nil, err
+	}
+	return ExportCompletion{Text: p.User + style.sep() + reply, ExportProvenance: p.ExportProvenance}, nil
+}
+
+// derivePairsFromItemData returns nil, nil for data in neither recognized shape.
+func derivePairsFromItemData(data json.RawMessage, opts ExportOptions) ([]ExportPair, error) {
 	var obj map[string]json.RawMessage
 	if err := json.Unmarshal(data, &obj); err != nil {
-		return nil
+		return nil, nil
 	}
 
 	// Simple single-turn: {"user":"...","assistant":"..."}.
@@ -312,7 +897,11 @@ func derivePairsFromItemData(data json.RawMessage, opts ExportOptions) []ExportP
 					u = strings.TrimSpace(u)
 					a = strings.TrimSpace(a)
 					if u != "" && a != "" {
-						return []ExportPair{{User: u, Assistant: a}}
+						p := ExportPair{User: u, Assistant: a}
+						if opts.Type == ExportTypeTurns {
+							p.turns = &[]Message{{Role: RoleUser, Content: u}}
+						}
+						return []ExportPair{p}, nil
 					}
 				}
 			}
@@ -323,15 +912,15 @@ func derivePairsFromItemData(data json.RawMessage, opts ExportOptions) []ExportP
 	if mRaw, ok := obj["messages"]; ok {
 		var msgs []Message
 		if err := json.Unmarshal(mRaw, &msgs); err != nil {
-			return nil
+			return nil, nil
 		}
 		if len(msgs) == 0 {
-			return nil
+			return nil, nil
 		}
 		return derivePairs(msgs, opts)
 	}
 
-	return nil
+	return nil, nil
 }
 
 func conversationsFilterQuery(opts ExportOptions) (string, []any) {
@@ -342,6 +931,15 @@ func conversationsFilterQuery(opts ExportOptions) (string, []any) {
 	if opts.DatasetID > 0 {
 		where = append(where, fmt.Sprintf("dataset_id = $%d", len(args)+1))
 		args = append(args, opts.DatasetID)
+	} else {
+		where = append(where, "dataset_id IN (SELECT id FROM datasets WHERE deleted_at IS NULL)")
+		if opts.PublicOnly {
+			where = append(where, "dataset_id IN (SELECT id FROM datasets WHERE visibility = 'public')")
+		}
+		if opts.ProjectID > 0 {
+			where = append(where, fmt.Sprintf("dataset_id IN (SELECT id FROM datasets WHERE project_id = $%d)", len(args)+1))
+			args = append(args, opts.ProjectID)
+		}
 	}
 
 	if opts.Split != "" && opts.Split != "all" {
@@ -349,24 +947,49 @@ func conversationsFilterQuery(opts ExportOptions) (string, []any) {
 		args = append(args, opts.Split)
 	}
 
+	if opts.MinAvgRating > 0 {
+		where = append(where, fmt.Sprintf("%s >= $%d", avgRatingSQL, len(args)+1))
+		args = append(args, opts.MinAvgRating)
+	}
+
+	if opts.Lang != "" {
+		where = append(where, fmt.Sprintf("lang = $%d", len(args)+1))
+		args = append(args, opts.Lang)
+	}
+
+	where, args = appendSourceFilter(where, args, "source", opts.Source, opts.SourcePrefix)
+	where, args = appendMetaThresholds(where, args, opts.MetaGTE)
+
+	if !opts.IncludeFlagged {
+		where = append(where, "NOT "+openFlagsSQL)
+	}
+
+	cols := "id, split, status, tags, source, notes, meta"
+	if opts.dedupsEmbeddings() {
+		embedding := "SELECT e.embedding::text FROM conversation_embeddings e WHERE e.conversation_id = c.id"
+		if opts.DedupModel != "" {
+			embedding += fmt.Sprintf(" AND e.model = $%d", len(args)+1)
+			args = append(args, opts.DedupModel)
+		}
+		cols += ", COALESCE((" + embedding + "), '')"
+	}
+
 	q := `
-SELECT id, split, status, tags, source, notes
-FROM conversations
+SELECT ` + cols + `
+FROM conversations c
 WHERE ` + strings.Join(where, " AND ") + `
 ORDER BY id ASC
 `
 	return q, args
 }
 
-func derivePairs(msgs []Message, opts ExportOptions) []ExportPair {
+func derivePairs(msgs []Message, opts ExportOptions) ([]ExportPair, error) {
+	msgs = normalizeMessages(msgs, opts.Normalize)
 	contextMode := opts.Context
 	if contextMode == "" {
-		contextMode = "none"
-	}
-	roleStyle := opts.RoleStyle
-	if roleStyle == "" {
-		roleStyle = "labels"
+		contextMode = ContextNone
 	}
+	style := opts.lineStyle()
 
 	var pairs []ExportPair
 
@@ -386,25 +1009,35 @@ func derivePairs(msgs []Message, opts ExportOptions) []ExportPair {
 		}
 
 		var prompt string
+		var err error
 		switch contextMode {
-		case "none":
+		case ContextNone:
 			prompt = strings.TrimSpace(msgs[userIdx].Content)
-		case "window":
-			prompt = renderContext(msgs, userIdx, opts.IncludeSystem, opts.ContextTurns, roleStyle)
-		case "full":
-			prompt = renderContext(msgs, userIdx, opts.IncludeSystem, 0, roleStyle)
+		case ContextWindow:
+			prompt, err = renderContext(msgs, userIdx, opts.IncludeSystem, opts.ContextTurns, opts.ContextTokens, tokens.OrDefault(opts.Tokens), style)
+		case ContextFull:
+			prompt, err = renderContext(msgs, userIdx, opts.IncludeSystem, 0, 0, nil, style)
 		default:
 			prompt = strings.TrimSpace(msgs[userIdx].Content)
 		}
+		if err != nil {
+			return nil, err
+		}
 
 		if prompt == "" {
 			continue
 		}
 
-		pairs = append(pairs, ExportPair{User: prompt, Assistant: assistantText})
+		idx := i
+		pair := ExportPair{User: prompt, Assistant: assistantText, assistantIdx: &idx, assistantID: msgs[i].ID}
+		if opts.Type == ExportTypeTurns || opts.Type == ExportTypeOpenAIBatch {
+			turns := promptTurns(msgs, userIdx, contextMode, opts)
+			pair.turns = &turns
+		}
+		pairs = append(pairs, pair)
 	}
 
-	return pairs
+	return pairs, nil
 }
 
 func findPrevRole(msgs []Message, start int, role Role) int {
@@ -416,29 +1049,58 @@ func findPrevRole(msgs []Message, start int, role Role) int {
 	return -1
 }
 
-func renderContext(msgs []Message, userIdx int, includeSystem bool, contextTurns int, roleStyle string) string {
+func renderContext(msgs []Message, userIdx int, includeSystem bool, contextTurns int, contextTokens int, est tokens.Estimator, style lineStyle) (string, error) {
 	// Build context from some number of prior user/assistant turns plus the current user message.
+	// contextTokens > 0 => as many of the newest messages as fit the token budget (contextTurns is ignored).
 	// contextTurns == 0 => full history.
 
 	start := 0
-	if contextTurns > 0 {
-		turns := 0
-		j := userIdx
-		for j >= 0 {
-			if msgs[j].Role == RoleUser {
-				turns++
-				if turns >= contextTurns {
-					break
-				}
-			}
-			j--
+	if contextTokens <= 0 {
+		start = contextStart(msgs, userIdx, contextTurns)
+	}
+
+	var lines []string
+	for _, m := range contextMessages(msgs, start, userIdx, includeSystem) {
+		line, err := style.line(m)
+		if err != nil {
+			return "", err
 		}
-		if j > 0 {
-			start = j
+		lines = append(lines, line)
+	}
+	if contextTokens > 0 {
+		lines = fitTokenBudget(lines, contextTokens, tokens.OrDefault(est))
+	}
+
+	return strings.Join(lines, style.sep()), nil
+}
+
+// contextStart returns the index of the first message in a window of contextTurns user
+// turns ending at userIdx; contextTurns == 0 means the full history.
+func contextStart(msgs []Message, userIdx int, contextTurns int) int {
+	if contextTurns <= 0 {
+		return 0
+	}
+	turns := 0
+	j := userIdx
+	for j >= 0 {
+		if msgs[j].Role == RoleUser {
+			turns++
+			if turns >= contextTurns {
+				break
+			}
 		}
+		j--
 	}
+	if j > 0 {
+		return j
+	}
+	return 0
+}
 
-	var b strings.Builder
+// contextMessages returns msgs[start..userIdx] without empty messages and, unless
+// includeSystem, system messages.
+func contextMessages(msgs []Message, start, userIdx int, includeSystem bool) []Message {
+	var out []Message
 	for i := start; i <= userIdx; i++ {
 		m := msgs[i]
 		if m.Role == RoleSystem && !includeSystem {
@@ -447,21 +1109,56 @@ func renderContext(msgs []Message, userIdx int, includeSystem bool, contextTurns
 		if strings.TrimSpace(m.Content) == "" {
 			continue
 		}
+		out = append(out, m)
+	}
+	return out
+}
 
-		if b.Len() > 0 {
-			b.WriteString("\n")
+// promptTurns is the type=turns counterpart of renderContext: the same messages, trimmed but
+// unlabelled, with context_tokens budgeting their contents.
+func promptTurns(msgs []Message, userIdx int, contextMode string, opts ExportOptions) []Message {
+	var turns []Message
+	switch contextMode {
+	case ContextWindow:
+		start := 0
+		if opts.ContextTokens <= 0 {
+			start = contextStart(msgs, userIdx, opts.ContextTurns)
 		}
+		turns = contextMessages(msgs, start, userIdx, opts.IncludeSystem)
+	case ContextFull:
+		turns = contextMessages(msgs, 0, userIdx, opts.IncludeSystem)
+	default:
+		turns = []Message{msgs[userIdx]}
+	}
+	out := make([]Message, len(turns))
+	contents := make([]string, len(turns))
+	for i, m := range turns {
+		m.Content = strings.TrimSpace(m.Content)
+		out[i], contents[i] = m, m.Content
+	}
+	if contextMode == ContextWindow && opts.ContextTokens > 0 {
+		out = out[len(out)-len(fitTokenBudget(contents, opts.ContextTokens, tokens.OrDefault(opts.Tokens))):]
+	}
+	return out
+}
 
-		switch roleStyle {
-		case "plain":
-			b.WriteString(strings.TrimSpace(m.Content))
-		default:
-			b.WriteString(roleLabel(m.Role))
-			b.WriteString(strings.TrimSpace(m.Content))
+// fitTokenBudget keeps the newest lines whose estimated tokens add up to at most budget, walking
+// back from the last line (the current user turn, which is always kept) until one no longer fits.
+func fitTokenBudget(lines []string, budget int, est tokens.Estimator) []string {
+	if len(lines) == 0 {
+		return lines
+	}
+	first := len(lines) - 1
+	used := est.Estimate(lines[first])
+	for first > 0 {
+		n := est.Estimate(lines[first-1])
+		if used+n > budget {
+			break
 		}
+		used += n
+		first--
 	}
-
-	return b.String()
+	return lines[first:]
 }
 
 func roleLabel(r Role) string {
@@ -1,13 +1,16 @@
 package models
 
 import (
+	"bytes"
 	"encoding/json"
+	"reflect"
+	"strings"
 	"testing"
 )
 
 func TestDerivePairsFromItemData_UserAssistant(t *testing.T) {
 	data := json.RawMessage(`{"user":"Hi","assistant":"Hello"}`)
-	pairs := derivePairsFromItemData(data, ExportOptions{Context: "none"})
+	pairs := must(derivePairsFromItemData(data, ExportOptions{Context: "none"}))
 	if len(pairs) != 1 {
 		t.Fatalf("expected 1 pair, got %d", len(pairs))
 	}
@@ -21,7 +24,7 @@ func TestDerivePairsFromItemData_UserAssistant(t *testing.T) {
 
 func TestDerivePairsFromItemData_Messages(t *testing.T) {
 	data := json.RawMessage(`{"messages":[{"role":"user","content":"Hi"},{"role":"assistant","content":"Hello"}]}`)
-	pairs := derivePairsFromItemData(data, ExportOptions{Context: "none"})
+	pairs := must(derivePairsFromItemData(data, ExportOptions{Context: "none"}))
 	if len(pairs) != 1 {
 		t.Fatalf("expected 1 pair, got %d", len(pairs))
 	}
@@ -35,9 +38,222 @@ func TestDerivePairsFromItemData_Messages(t *testing.T) {
 
 func TestDerivePairsFromItemData_UnrecognizedShape(t *testing.T) {
 	data := json.RawMessage(`["not","an","object"]`)
-	pairs := derivePairsFromItemData(data, ExportOptions{Context: "none"})
+	pairs := must(derivePairsFromItemData(data, ExportOptions{Context: "none"}))
 	if len(pairs) != 0 {
 		t.Fatalf("expected 0 pairs, got %d", len(pairs))
 	}
 }
 
+func TestPairLine_Completions(t *testing.T) {
+	p := ExportPair{User: "User: Hi", Assistant: "Hello"}
+	if got := must(pairLine(p, ExportOptions{Type: "pairs"})); got != p {
+		t.Fatalf("pairs export should emit the pair unchanged, got %#v", got)
+	}
+	if got := must(pairLine(p, ExportOptions{Type: "completions", Context: "none"})); got != (ExportCompletion{Text: "Hello"}) {
+		t.Fatalf("unexpected completion: %#v", got)
+	}
+	got := must(pairLine(p, ExportOptions{Type: "completions", Context: "window", RoleStyle: "labels"}))
+	if got != (ExportCompletion{Text: "User: Hi\nAssistant: Hello"}) {
+		t.Fatalf("unexpected completion with context: %#v", got)
+	}
+}
+
+func TestPairLine_WithSourceProvenance(t *testing.T) {
+	p := ExportPair{User: "hi", Assistant: "hello", ExportProvenance: ExportProvenance{ConversationID: 7, Source: "web", Split: "train"}}
+
+	b, err := json.Marshal(must(pairLine(p, ExportOptions{Type: "pairs"})))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if string(b) != `{"user":"hi","assistant":"hello","conversation_id":7,"source":"web","split":"train"}` {
+		t.Fatalf("unexpected pair line: %s", b)
+	}
+
+	b, _ = json.Marshal(must(pairLine(ExportPair{User: "hi", Assistant: "hello"}, ExportOptions{Type: "completions"})))
+	if string(b) != `{"text":"hello"}` {
+		t.Fatalf("provenance should be omitted by default: %s", b)
+	}
+}
+
+func TestWriteWithFields(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeWithFields(&buf, []byte(`{"_id":3,`), []byte(`{"a":1}`)); err != nil {
+		t.Fatalf("writeWithFields: %v", err)
+	}
+	if err := writeWithFields(&buf, []byte(`{"_id":4,`), []byte(`{}`)); err != nil {
+		t.Fatalf("writeWithFields: %v", err)
+	}
+	if buf.String() != `{"_id":3,"a":1}{"_id":4}` {
+		t.Fatalf("unexpected output: %s", buf.String())
+	}
+}
+
+func TestExportConversation_KeyOrder(t *testing.T) {
+	b, err := json.Marshal(ExportConversation{
+		ID:       1,
+		Split:    "train",
+		Status:   "approved",
+		Tags:     []string{"a"},
+		Messages: []Message{{Role: RoleUser, Content: "hi"}},
+	})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	want := `{"id":1,"split":"train","status":"approved","tags":["a"],"source":"","notes":"","messages":[{"role":"user","content":"hi"}]}`
+	if string(b) != want {
+		t.Fatalf("unexpected encoding:\n got %s\nwant %s", b, want)
+	}
+}
+
+func TestExportOptions_EffectiveMaxExamples(t *testing.T) {
+	cases := []struct {
+		max, cap, want int
+		capped         bool
+	}{
+		{0, 0, 0, false},
+		{50, 0, 50, false},
+		{0, 100, 100, true},
+		{500, 100, 100, true},
+		{50, 100, 50, false},
+	}
+	for _, c := range cases {
+		o := ExportOptions{MaxExamples: c.max, RowCap: c.cap}
+		if n, capped := o.EffectiveMaxExamples(); n != c.want || capped != c.capped {
+			t.Fatalf("max=%d cap=%d: got (%d, %v), want (%d, %v)", c.max, c.cap, n, capped, c.want, c.capped)
+		}
+	}
+
+}
+
+func TestCapWriter(t *testing.T) {
+	cases := []struct {
+		writes []string
+		want   string
+		over   bool
+	}{
+		{[]string{"a\nb\n"}, "a\nb\n", false},
+		{[]string{"a\nb\nc\n"}, "a\nb\n", true},
+		{[]string{"a\n", "b", "\n", "c\n"}, "a\nb\n", true},
+		{[]string{"a\n"}, "a\n", false},
+	}
+	for _, c := range cases {
+		var buf strings.Builder
+		cw := &capWriter{w: &buf, limit: 2}
+		for _, s := range c.writes {
+			if n, err := cw.Write([]byte(s)); err != nil || n != len(s) {
+				t.Fatalf("%q: Write = (%d, %v)", c.writes, n, err)
+			}
+		}
+		if buf.String() != c.want || cw.over != c.over {
+			t.Fatalf("%q: got (%q, %v), want (%q, %v)", c.writes, buf.String(), cw.over, c.want, c.over)
+		}
+	}
+}
+
+func TestExportPairsGroup_Encoding(t *testing.T) {
+	g := ExportPairsGroup{ConversationID: 7, Pairs: []ExportPair{{User: "User: Hi", Assistant: "Hello"}}}
+	b, _ := json.Marshal(g)
+	if want := `{"conversation_id":7,"pairs":[{"user":"User: Hi","assistant":"Hello"}]}`; string(b) != want {
+		t.Fatalf("unexpected encoding:\n got %s\nwant %s", b, want)
+	}
+
+	g.ExportGroupMeta = &ExportGroupMeta{Split: "train", Tags: []string{}}
+	b, _ = json.Marshal(g)
+	if want := `{"conversation_id":7,"split":"train","tags":[],"pairs":[{"user":"User: Hi","assistant":"Hello"}]}`; string(b) != want {
+		t.Fatalf("unexpected encoding with meta:\n got %s\nwant %s", b, want)
+	}
+}
+
+func TestDerivePairs_CarriesAssistantIndex(t *testing.T) {
+	msgs := []Message{
+		{Role: RoleSystem, Content: "Be brief."},
+		{Role: RoleUser, Content: "Hi"},
+		{Role: RoleAssistant, Content: "Hello"},
+		{Role: RoleUser, Content: "Bye"},
+		{Role: RoleAssistant, Content: "Later"},
+	}
+	pairs := must(derivePairs(msgs, ExportOptions{}))
+	if len(pairs) != 2 || pairs[0].assistantIdx == nil || *pairs[0].assistantIdx != 2 || *pairs[1].assistantIdx != 4 {
+		t.Fatalf("unexpected pairs: %+v", pairs)
+	}
+
+	b, _ := json.Marshal(pairs[1])
+	if string(b) != `{"user":"Bye","assistant":"Later"}` {
+		t.Fatalf("ids must stay out of default output: %s", b)
+	}
+	p := pairs[1]
+	p.ConversationID, p.AssistantMessageIdx = 9, p.assistantIdx
+	b, _ = json.Marshal(p)
+	if string(b) != `{"user":"Bye","assistant":"Later","conversation_id":9,"assistant_message_idx":4}` {
+		t.Fatalf("unexpected include_ids line: %s", b)
+	}
+
+	single := must(derivePairsFromItemData(json.RawMessage(`{"user":"q","assistant":"a"}`), ExportOptions{}))
+	if len(single) != 1 || single[0].assistantIdx != nil {
+		t.Fatalf("single-turn items have no message index: %+v", single)
+	}
+}
+
+func TestPairLine_TurnsMultiTurn(t *testing.T) {
+	msgs := []Message{
+		{Role: RoleSystem, Content: "Be brief."},
+		{Role: RoleUser, Content: "u1"},
+		{Role: RoleAssistant, Content: "a1"},
+		{Role: RoleUser, Content: " u2 "},
+		{Role: RoleAssistant, Content: "a2"},
+	}
+	lines := func(opts ExportOptions) []string {
+		opts.Type = ExportTypeTurns
+		var out []string
+		for _, p := range must(derivePairs(msgs, opts)) {
+			b, _ := json.Marshal(must(pairLine(p, opts)))
+			out = append(out, string(b))
+		}
+		return out
+	}
+
+	got := lines(ExportOptions{Context: ContextFull})
+	want := []string{`{"prompt_turns":["u1"],"completion":"a1"}`, `{"prompt_turns":["u1","a1","u2"],"completion":"a2"}`}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected full turns:\n got %v\nwant %v", got, want)
+	}
+	if got := lines(ExportOptions{Context: ContextFull, IncludeSystem: true}); got[1] != `{"prompt_turns":["Be brief.","u1","a1","u2"],"completion":"a2"}` {
+		t.Fatalf("expected the system turn first, got %s", got[1])
+	}
+	if got := lines(ExportOptions{Context: ContextWindow, ContextTurns: 1}); got[1] != `{"prompt_turns":["u2"],"completion":"a2"}` {
+		t.Fatalf("expected a one-turn window, got %s", got[1])
+	}
+	if got := lines(ExportOptions{Context: ContextNone}); got[1] != `{"prompt_turns":["u2"],"completion":"a2"}` {
+		t.Fatalf("expected only the user turn without context, got %s", got[1])
+	}
+
+	single := must(derivePairsFromItemData(json.RawMessage(`{"user":"q","assistant":"a"}`), ExportOptions{Type: ExportTypeTurns}))
+	if b, _ := json.Marshal(must(pairLine(single[0], ExportOptions{Type: ExportTypeTurns}))); string(b) != `{"prompt_turns":["q"],"completion":"a"}` {
+		t.Fatalf("unexpected single-turn item line: %s", b)
+	}
+}
+
+func TestFitLine_Turns(t *testing.T) {
+	l := ExportTurns{PromptTurns: []string{"aaaa", "bbbb", "cccc"}, Completion: "dd", roles: []Role{RoleUser, RoleAssistant, RoleUser}}
+	if _, ok := fitLine(l, ExportOptions{MaxChars: 10, OnOversize: OversizeSkip}); ok {
+		t.Fatal("expected an oversize turns line to be skipped")
+	}
+	got, _ := fitLine(l, ExportOptions{MaxChars: 8, OnOversize: OversizeTruncate})
+	if tl := got.(ExportTurns); !reflect.DeepEqual(tl.PromptTurns, []string{"bb", "cccc"}) || len(tl.roles) != 2 || tl.Completion != "dd" {
+		t.Fatalf("expected the oldest turns dropped, got %+v", tl)
+	}
+
+	whole := ExportTurns{PromptTurns: []string{"u1", "a1", "u2"}, Completion: "a2", roles: []Role{RoleUser, RoleAssistant, RoleUser}}
+	conv := []Message{{Role: RoleUser, Content: "u1"}, {Role: RoleAssistant, Content: "a1"}, {Role: RoleUser, Content: "u2"}, {Role: RoleAssistant, Content: "a2"}}
+	if TurnsContentHash(whole) != ConversationContentHash(conv) {
+		t.Fatal("expected a turns line to hash like its conversation")
+	}
+}
+
+// must unwraps the results of the export helpers, which only fail on template errors.
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseSampleRate parses the export sample parameter: a fraction in (0, 1] such as 0.05.
+// Empty means no sampling and returns 0.
+func ParseSampleRate(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	rate, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(rate) || rate <= 0 || rate > 1 {
+		return 0, fmt.Errorf("%w: sample must be a fraction in (0, 1], got %q", ErrInvalidInput, s)
+	}
+	return rate, nil
+}
+
+// sampled reports whether row id is kept by opts.SampleRate. Each row is kept independently
+// with that probability, decided by sampleFraction(id, SampleSeed), so the same seed keeps the
+// same rows on every run and the decision needs nothing but the id.
+func (o ExportOptions) sampled(id int64) bool {
+	return o.SampleRate <= 0 || o.SampleRate >= 1 || sampleFraction(id, o.SampleSeed) < o.SampleRate
+}
+
+// sampleFraction maps (id, seed) to a uniform value in [0, 1): the splitmix64 finalizer of
+// id mixed with seed, top 53 bits scaled down.
+func sampleFraction(id, seed int64) float64 {
+	x := uint64(id) ^ uint64(seed)*0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	x ^= x >> 31
+	return float64(x>>11) / (1 << 53)
+}
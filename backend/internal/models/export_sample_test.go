@@ -0,0 +1,58 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseSampleRate(t *testing.T) {
+	for in, want := range map[string]float64{"": 0, "0.05": 0.05, " 1 ": 1} {
+		if got, err := ParseSampleRate(in); err != nil || got != want {
+			t.Fatalf("%q: expected %v, got %v %v", in, want, got, err)
+		}
+	}
+	for _, bad := range []string{"0", "-0.1", "1.01", "NaN", "5%"} {
+		if _, err := ParseSampleRate(bad); !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("%q: expected ErrInvalidInput, got %v", bad, err)
+		}
+	}
+}
+
+func TestSampled_ReproducibleAndProportional(t *testing.T) {
+	opts := ExportOptions{SampleRate: 0.05, SampleSeed: 7}
+	kept := 0
+	const n = 100000
+	for id := int64(1); id <= n; id++ {
+		if opts.sampled(id) {
+			kept++
+			if !opts.sampled(id) {
+				t.Fatalf("id %d: sampling is not deterministic", id)
+			}
+		}
+	}
+	if rate := float64(kept) / n; math.Abs(rate-0.05) > 0.005 {
+		t.Fatalf("expected about 5%% kept, got %.4f", rate)
+	}
+
+	other := ExportOptions{SampleRate: 0.05, SampleSeed: 8}
+	same := 0
+	for id := int64(1); id <= 1000; id++ {
+		if opts.sampled(id) == other.sampled(id) {
+			same++
+		}
+	}
+	if same == 1000 {
+		t.Fatal("a different seed should pick a different sample")
+	}
+}
+
+func TestSampled_OffKeepsEverything(t *testing.T) {
+	for _, o := range []ExportOptions{{}, {SampleRate: 1, SampleSeed: 3}} {
+		for id := int64(1); id <= 100; id++ {
+			if !o.sampled(id) {
+				t.Fatalf("%+v dropped id %d", o, id)
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type fakeCursor struct {
+	rows int
+	read int
+}
+
+func (c *fakeCursor) Next() bool {
+	if c.read >= c.rows {
+		return false
+	}
+	c.read++
+	return true
+}
+
+func (c *fakeCursor) Err() error { return nil }
+
+func TestEachRow_StopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cur := &fakeCursor{rows: 1000}
+	calls := 0
+	err := eachRow(ctx, cur, func() (bool, error) {
+		calls++
+		cancel() // client went away after the first line
+		return true, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if calls != 1 || cur.read != 2 {
+		t.Fatalf("expected to stop right after the first row, got calls=%d read=%d", calls, cur.read)
+	}
+}
+
+func TestEachRow_StopsWhenFnDeclines(t *testing.T) {
+	cur := &fakeCursor{rows: 10}
+	calls := 0
+	err := eachRow(context.Background(), cur, func() (bool, error) {
+		calls++
+		return calls < 3, nil
+	})
+	if err != nil || calls != 3 || cur.read != 3 {
+		t.Fatalf("unexpected result: err=%v calls=%d read=%d", err, calls, cur.read)
+	}
+}
+
+func TestRenderContext_TokenWindowVersusTurns(t *testing.T) {
+	msgs := []Message{
+		{Role: RoleUser, Content: strings.Repeat("a", 400)}, // long early turn
+		{Role: RoleAssistant, Content: strings.Repeat("b", 400)},
+		{Role: RoleUser, Content: "short question"},
+		{Role: RoleAssistant, Content: "short answer"},
+		{Role: RoleUser, Content: "follow up"},
+	}
+
+	// Two turns reach back to the second user message regardless of size.
+	byTurns := must(renderContext(msgs, 4, false, 2, 0, nil, lineStyle{roleStyle: "plain"}))
+	if byTurns != "short question\nshort answer\nfollow up" {
+		t.Fatalf("unexpected turn window: %q", byTurns)
+	}
+
+	// A small token budget packs the same short turns but stops before the 100-token message.
+	byTokens := must(renderContext(msgs, 4, false, 2, 50, nil, lineStyle{roleStyle: "plain"}))
+	if byTokens != byTurns {
+		t.Fatalf("unexpected token window: %q", byTokens)
+	}
+
+	// A larger budget reaches further back than the turn count would.
+	wide := must(renderContext(msgs, 4, false, 2, 150, nil, lineStyle{roleStyle: "plain"}))
+	if !strings.HasPrefix(wide, strings.Repeat("b", 400)+"\n") || strings.Contains(wide, "aaaa") {
+		t.Fatalf("expected the window to include the long assistant turn only: %q", wide)
+	}
+
+	// The current user turn is kept even when it alone exceeds the budget.
+	if got := must(renderContext(msgs, 4, false, 0, 1, nil, lineStyle{roleStyle: "plain"})); got != "follow up" {
+		t.Fatalf("expected only the current turn, got %q", got)
+	}
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"slices"
+	"strings"
+)
+
+// Export types (ExportOptions.Type).
+const (
+	ExportTypePairs         = "pairs"
+	ExportTypeCompletions   = "completions"
+	ExportTypePairsGrouped  = "pairs_grouped"
+	ExportTypeConversations = "conversations"
+	ExportTypeItems         = "items"
+	ExportTypeItemsWithMeta = "items_with_meta"
+	ExportTypeTurns         = "turns"
+	ExportTypeOpenAIBatch   = "openai_batch"
+	ExportTypeDPO           = "dpo"
+)
+
+// Context modes for pairs exports (ExportOptions.Context).
+const (
+	ContextNone   = "none"
+	ContextWindow = "window"
+	ContextFull   = "full"
+)
+
+// Role styles for rendered context (ExportOptions.RoleStyle).
+const (
+	RoleStyleLabels = "labels"
+	RoleStylePlain  = "plain"
+)
+
+// These lists drive both export validation and GET /api/v1/export/options, so the two
+// cannot drift; extend them when adding a type.
+var (
+	// ExportTypes is every export type, in the order clients should offer them.
+	ExportTypes = []string{ExportTypePairs, ExportTypeCompletions, ExportTypeTurns, ExportTypeOpenAIBatch, ExportTypeDPO, ExportTypePairsGrouped, ExportTypeConversations, ExportTypeItems, ExportTypeItemsWithMeta}
+
+	// ConversationExportTypes and ItemExportTypes are the types valid for each dataset kind.
+	// openai_batch needs conversation ids for its custom_id, and dpo exports the preference
+	// pairs kept with conversation datasets, so items cannot take either.
+	ConversationExportTypes = []string{ExportTypePairs, ExportTypeCompletions, ExportTypeTurns, ExportTypeOpenAIBatch, ExportTypeDPO, ExportTypePairsGrouped, ExportTypeConversations}
+	ItemExportTypes         = []string{ExportTypePairs, ExportTypeCompletions, ExportTypeTurns, ExportTypeItems, ExportTypeItemsWithMeta}
+
+	// LineExportTypes support interleave and max_chars: one line per pair, completion, turns
+	// example or conversation.
+	LineExportTypes = []string{ExportTypePairs, ExportTypeCompletions, ExportTypeTurns, ExportTypeConversations}
+
+	// HashExportTypes take include_hash and SourceExportTypes with_source; batch requests and
+	// dpo lines have no hash, and grouped pairs and batch requests no provenance.
+	// Conversations and items_with_meta lines carry their id and source already.
+	HashExportTypes   = []string{ExportTypePairs, ExportTypeCompletions, ExportTypeTurns, ExportTypePairsGrouped, ExportTypeConversations, ExportTypeItems, ExportTypeItemsWithMeta}
+	SourceExportTypes = []string{ExportTypePairs, ExportTypeCompletions, ExportTypeTurns, ExportTypeDPO, ExportTypeConversations, ExportTypeItems, ExportTypeItemsWithMeta}
+
+	ContextModes    = []string{ContextNone, ContextWindow, ContextFull}
+	RoleStyles      = []string{RoleStyleLabels, RoleStylePlain}
+	Templates       = []string{TemplateAlpaca, TemplateChatML, TemplateCustom}
+	QualityGates    = []string{QualityGateOff, QualityGateLenient, QualityGateStrict}
+	OversizeActions = []string{OversizeSkip, OversizeTruncate}
+)
+
+// ExportTypeForKind reports whether export type t applies to datasets of kind ("items" or
+// "conversations").
+func ExportTypeForKind(t, kind string) bool {
+	if strings.EqualFold(kind, DatasetKindItems) {
+		return slices.Contains(ItemExportTypes, t)
+	}
+	return slices.Contains(ConversationExportTypes, t)
+}
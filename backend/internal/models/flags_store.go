@@ -0,0 +1,199 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type FlagCategory string
+
+const (
+	FlagCategoryToxicity  FlagCategory = "toxicity"
+	FlagCategoryPII       FlagCategory = "pii"
+	FlagCategoryCopyright FlagCategory = "copyright"
+	FlagCategoryOther     FlagCategory = "other"
+)
+
+func ValidFlagCategory(c FlagCategory) bool {
+	switch c {
+	case FlagCategoryToxicity, FlagCategoryPII, FlagCategoryCopyright, FlagCategoryOther:
+		return true
+	default:
+		return false
+	}
+}
+
+const (
+	FlagStatusOpen     = "open"
+	FlagStatusResolved = "resolved"
+)
+
+// Flag is a moderation flag on a conversation or a proposal (exactly one of the two ids is set).
+type Flag struct {
+	ID             int64        `json:"id"`
+	ConversationID *int64       `json:"conversation_id,omitempty"`
+	ProposalID     *int64       `json:"proposal_id,omitempty"`
+	Category       FlagCategory `json:"category"`
+	Note           string       `json:"note"`
+	FlaggedBy      string       `json:"flagged_by"`
+	Status         string       `json:"status"`
+	ResolvedBy     *string      `json:"resolved_by"`
+	Resolution     *string      `json:"resolution"`
+	ResolvedAt     *time.Time   `json:"resolved_at"`
+	CreatedAt      time.Time    `json:"created_at"`
+}
+
+// openFlagsSQL is true when conversation c has an open flag.
+const openFlagsSQL = `EXISTS (SELECT 1 FROM content_flags f WHERE f.conversation_id = c.id AND f.status = 'open')`
+
+const flagColumns = `id, conversation_id, proposal_id, category, note, flagged_by, status, resolved_by, resolution, resolved_at, created_at`
+
+func scanFlag(row interface{ Scan(...any) error }) (Flag, error) {
+	var f Flag
+	err := row.Scan(&f.ID, &f.ConversationID, &f.ProposalID, &f.Category, &f.Note, &f.FlaggedBy, &f.Status,
+		&f.ResolvedBy, &f.Resolution, &f.ResolvedAt, &f.CreatedAt)
+	return f, err
+}
+
+// ValidateFlag checks a new flag's category before it is stored.
+func ValidateFlag(category FlagCategory) error {
+	if !ValidFlagCategory(category) {
+		return fmt.Errorf("%w: category must be toxicity, pii, copyright or other", ErrInvalidInput)
+	}
+	return nil
+}
+
+// FlagConversation opens a flag on conversation id.
+func FlagConversation(ctx context.Context, db *sql.DB, id int64, category FlagCategory, note, flaggedBy string) (Flag, error) {
+	return insertFlag(ctx, db, "conversation_id", "conversations", id, category, note, flaggedBy)
+}
+
+// FlagProposal opens a flag on proposal id.
+func FlagProposal(ctx context.Context, db *sql.DB, id int64, category FlagCategory, note, flaggedBy string) (Flag, error) {
+	return insertFlag(ctx, db, "proposal_id", "proposals", id, category, note, flaggedBy)
+}
+
+// insertFlag inserts a flag whose col references id in table; a missing row is ErrNotFound.
+func insertFlag(ctx context.Context, db *sql.DB, col, table string, id int64, category FlagCategory, note, flaggedBy string) (Flag, error) {
+	if err := ValidateFlag(category); err != nil {
+		return Flag{}, err
+	}
+	f, err := scanFlag(db.QueryRowContext(ctx, `
+INSERT INTO content_flags (`+col+`, category, note, flagged_by)
+SELECT id, $2, $3, $4 FROM `+table+` WHERE id = $1
+RETURNING `+flagColumns, id, string(category), strings.TrimSpace(note), strings.TrimSpace(flaggedBy)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Flag{}, ErrNotFound
+		}
+		return Flag{}, err
+	}
+	return f, nil
+}
+
+type ListFlagsParams struct {
+	// ConversationID and ProposalID, when > 0, keep the flags of that conversation or proposal.
+	ConversationID int64
+	ProposalID     int64
+	Status         string // open|resolved; "" means any
+	Category       FlagCategory
+	Limit          int
+}
+
+func ListFlags(ctx context.Context, db *sql.DB, p ListFlagsParams) ([]Flag, error) {
+	where := []string{"TRUE"}
+	args := []any{}
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if p.ConversationID > 0 {
+		add("conversation_id = $%d", p.ConversationID)
+	}
+	if p.ProposalID > 0 {
+		add("proposal_id = $%d", p.ProposalID)
+	}
+	if p.Status != "" {
+		add("status = $%d", p.Status)
+	}
+	if p.Category != "" {
+		add("category = $%d", string(p.Category))
+	}
+	limit := p.Limit
+	if limit <= 0 {
+		limit = 500
+	}
+	args = append(args, limit)
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`
+SELECT %s
+FROM content_flags
+WHERE %s
+ORDER BY created_at DESC, id DESC
+LIMIT $%d
+`, flagColumns, strings.Join(where, " AND "), len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Flag{}
+	for rows.Next() {
+		f, err := scanFlag(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// ValidateFlagResolution checks the resolver and resolution of a flag being resolved.
+func ValidateFlagResolution(resolver, resolution string) error {
+	var verr ValidationError
+	if strings.TrimSpace(resolver) == "" {
+		verr.Add("resolver", "resolver required")
+	}
+	if strings.TrimSpace(resolution) == "" {
+		verr.Add("resolution", "resolution required")
+	}
+	return verr.Err()
+}
+
+// ResolveFlag closes open flag id, recording who resolved it and how. A missing flag is
+// ErrNotFound; one already resolved is ErrConflict.
+func ResolveFlag(ctx context.Context, db *sql.DB, id int64, resolver, resolution string) (Flag, error) {
+	if err := ValidateFlagResolution(resolver, resolution); err != nil {
+		return Flag{}, err
+	}
+	f, err := scanFlag(db.QueryRowContext(ctx, `
+UPDATE content_flags
+SET status = $2, resolved_by = $3, resolution = $4, resolved_at = now()
+WHERE id = $1 AND status = $5
+RETURNING `+flagColumns, id, FlagStatusResolved, strings.TrimSpace(resolver), strings.TrimSpace(resolution), FlagStatusOpen))
+	if err == nil {
+		return f, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return Flag{}, err
+	}
+	var exists bool
+	if err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM content_flags WHERE id = $1)`, id).Scan(&exists); err != nil {
+		return Flag{}, err
+	}
+	if !exists {
+		return Flag{}, ErrNotFound
+	}
+	return Flag{}, fmt.Errorf("%w: flag %d is already resolved", ErrConflict, id)
+}
+
+// CountOpenProposalFlags counts the open flags on proposal id.
+func CountOpenProposalFlags(ctx context.Context, tx *sql.Tx, id int64) (int, error) {
+	var n int
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM content_flags WHERE proposal_id = $1 AND status = $2`, id, FlagStatusOpen).Scan(&n)
+	return n, err
+}
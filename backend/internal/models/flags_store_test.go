@@ -0,0 +1,41 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateFlag(t *testing.T) {
+	for _, c := range []FlagCategory{FlagCategoryToxicity, FlagCategoryPII, FlagCategoryCopyright, FlagCategoryOther} {
+		if err := ValidateFlag(c); err != nil {
+			t.Fatalf("%s: unexpected error %v", c, err)
+		}
+	}
+	for _, c := range []FlagCategory{"", "spam", "PII"} {
+		if err := ValidateFlag(c); !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("%q: expected ErrInvalidInput, got %v", c, err)
+		}
+	}
+}
+
+func TestValidateFlagResolution(t *testing.T) {
+	if err := ValidateFlagResolution("alice", "false positive"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var verr *ValidationError
+	if err := ValidateFlagResolution(" ", ""); !errors.As(err, &verr) || len(verr.Fields) != 2 {
+		t.Fatalf("expected resolver and resolution errors, got %v", err)
+	}
+}
+
+func TestConversationsFilterQuery_Flags(t *testing.T) {
+	q, _ := conversationsFilterQuery(ExportOptions{Status: "approved"})
+	if !strings.Contains(q, "NOT "+openFlagsSQL) {
+		t.Fatalf("expected open flags to be excluded, got %s", q)
+	}
+	q, _ = conversationsFilterQuery(ExportOptions{Status: "approved", IncludeFlagged: true})
+	if strings.Contains(q, "content_flags") {
+		t.Fatalf("unexpected flag filter with include_flagged: %s", q)
+	}
+}
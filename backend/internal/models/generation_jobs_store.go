@@ -0,0 +1,364 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Generation job statuses. queued and running jobs are active; the rest are final.
+const (
+	GenerationStatusQueued    = "queued"
+	GenerationStatusRunning   = "running"
+	GenerationStatusSucceeded = "succeeded"
+	GenerationStatusFailed    = "failed"
+	GenerationStatusCanceled  = "canceled"
+)
+
+// Bounds on a generation job's request.
+const (
+	MaxGenerationTarget      = 10000
+	MaxGenerationConcurrency = 8
+	MaxGenerationSeeds       = 10000
+)
+
+// GenerationTag tags every conversation a generation job writes.
+const GenerationTag = "synthetic"
+
+// GenerationParams are the per-job completion settings passed to the LLM endpoint.
+type GenerationParams struct {
+	Model       string   `json:"model,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+}
+
+// GenerationJob prompts the LLM over a list of seeds (inline Seeds, or the items of
+// SeedDatasetID) and writes each reply into DatasetID as a pending conversation.
+type GenerationJob struct {
+	ID             int64             `json:"id"`
+	DatasetID      int64             `json:"dataset_id"`
+	PromptTemplate string            `json:"prompt_template"`
+	SystemPrompt   string            `json:"system_prompt"`
+	Seeds          []json.RawMessage `json:"seeds,omitempty"`
+	SeedDatasetID  *int64            `json:"seed_dataset_id,omitempty"`
+	Params         GenerationParams  `json:"params"`
+	TargetCount    int               `json:"target_count"`
+	Concurrency    int               `json:"concurrency"`
+	Status         string            `json:"status"`
+	Generated      int               `json:"generated"`
+	Failed         int               `json:"failed"`
+	Error          string            `json:"error"`
+	CreatedAt      time.Time         `json:"created_at"`
+	StartedAt      *time.Time        `json:"started_at"`
+	FinishedAt     *time.Time        `json:"finished_at"`
+}
+
+// Done is how many attempts have finished, successfully or not.
+func (j GenerationJob) Done() int {
+	return j.Generated + j.Failed
+}
+
+// ParseSeedTemplate parses a prompt template: Go text/template executed with a seed as dot,
+// so an object seed's fields read as {{.topic}}. Unknown keys are errors, not "<no value>".
+func ParseSeedTemplate(text string) (*template.Template, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, fmt.Errorf("%w: prompt_template required", ErrInvalidInput)
+	}
+	t, err := template.New("prompt").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	return t, nil
+}
+
+// RenderSeedPrompt executes t over seed (any JSON value) and returns the trimmed prompt.
+func RenderSeedPrompt(t *template.Template, seed json.RawMessage) (string, error) {
+	var v any
+	if err := json.Unmarshal(seed, &v); err != nil {
+		return "", fmt.Errorf("%w: seed is not valid JSON", ErrInvalidInput)
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, v); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	prompt := strings.TrimSpace(b.String())
+	if prompt == "" {
+		return "", fmt.Errorf("%w: prompt_template rendered an empty prompt", ErrInvalidInput)
+	}
+	return prompt, nil
+}
+
+// ValidateGenerationJob checks a new job before it is stored: a parseable template that
+// renders for every inline seed, exactly one seed source, and bounded counts.
+func ValidateGenerationJob(j GenerationJob) error {
+	var verr ValidationError
+	if j.DatasetID <= 0 {
+		verr.Add("dataset_id", "dataset_id required")
+	}
+	t, err := ParseSeedTemplate(j.PromptTemplate)
+	if err != nil {
+		verr.Add("prompt_template", err.Error())
+	}
+	switch {
+	case len(j.Seeds) > 0 && j.SeedDatasetID != nil:
+		verr.Add("seeds", "give either seeds or seed_dataset_id, not both")
+	case len(j.Seeds) == 0 && (j.SeedDatasetID == nil || *j.SeedDatasetID <= 0):
+		verr.Add("seeds", "seeds or seed_dataset_id required")
+	case len(j.Seeds) > MaxGenerationSeeds:
+		verr.Add("seeds", fmt.Sprintf("at most %d seeds", MaxGenerationSeeds))
+	case t != nil:
+		for i, seed := range j.Seeds {
+			if _, err := RenderSeedPrompt(t, seed); err != nil {
+				verr.Add("seeds", fmt.Sprintf("seed %d: %v", i, err))
+				break
+			}
+		}
+	}
+	if j.TargetCount < 1 || j.TargetCount > MaxGenerationTarget {
+		verr.Add("target_count", fmt.Sprintf("target_count must be 1-%d", MaxGenerationTarget))
+	}
+	if j.Concurrency < 1 || j.Concurrency > MaxGenerationConcurrency {
+		verr.Add("concurrency", fmt.Sprintf("concurrency must be 1-%d", MaxGenerationConcurrency))
+	}
+	if j.Params.Temperature != nil && (*j.Params.Temperature < 0 || *j.Params.Temperature > 2) {
+		verr.Add("temperature", "temperature must be 0-2")
+	}
+	if j.Params.MaxTokens < 0 {
+		verr.Add("max_tokens", "max_tokens must not be negative")
+	}
+	return verr.Err()
+}
+
+const generationJobColumns = `id, dataset_id, prompt_template, system_prompt, seeds, seed_dataset_id, params, target_count,
+  concurrency, status, generated, failed, error, created_at, started_at, finished_at`
+
+func scanGenerationJob(row interface{ Scan(...any) error }) (GenerationJob, error) {
+	var j GenerationJob
+	var seeds, params []byte
+	err := row.Scan(&j.ID, &j.DatasetID, &j.PromptTemplate, &j.SystemPrompt, &seeds, &j.SeedDatasetID, &params, &j.TargetCount,
+		&j.Concurrency, &j.Status, &j.Generated, &j.Failed, &j.Error, &j.CreatedAt, &j.StartedAt, &j.FinishedAt)
+	if err != nil {
+		return GenerationJob{}, err
+	}
+	if len(seeds) > 0 {
+		_ = json.Unmarshal(seeds, &j.Seeds)
+	}
+	_ = json.Unmarshal(params, &j.Params)
+	return j, nil
+}
+
+// CreateGenerationJob validates and stores a queued job. The target must be a conversation
+// dataset and SeedDatasetID, when set, an items dataset (ErrNotFound / ErrWrongDatasetKind).
+func CreateGenerationJob(ctx context.Context, db *sql.DB, j GenerationJob) (GenerationJob, error) {
+	if err := ValidateGenerationJob(j); err != nil {
+		return GenerationJob{}, err
+	}
+	if err := RequireDatasetKind(ctx, db, j.DatasetID, DatasetKindConversations); err != nil {
+		return GenerationJob{}, err
+	}
+	if j.SeedDatasetID != nil {
+		if err := RequireDatasetKind(ctx, db, *j.SeedDatasetID, DatasetKindItems); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return GenerationJob{}, fmt.Errorf("%w: seed dataset %d not found", ErrInvalidInput, *j.SeedDatasetID)
+			}
+			return GenerationJob{}, err
+		}
+	}
+
+	var seeds []byte
+	if len(j.Seeds) > 0 {
+		seeds, _ = json.Marshal(j.Seeds)
+	}
+	params, _ := json.Marshal(j.Params)
+	return scanGenerationJob(db.QueryRowContext(ctx, `
+INSERT INTO generation_jobs (dataset_id, prompt_template, system_prompt, seeds, seed_dataset_id, params, target_count, concurrency)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING `+generationJobColumns,
+		j.DatasetID, j.PromptTemplate, strings.TrimSpace(j.SystemPrompt), seeds, j.SeedDatasetID, params, j.TargetCount, j.Concurrency))
+}
+
+func GetGenerationJob(ctx context.Context, db *sql.DB, id int64) (GenerationJob, error) {
+	j, err := scanGenerationJob(db.QueryRowContext(ctx, `SELECT `+generationJobColumns+` FROM generation_jobs WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return GenerationJob{}, ErrNotFound
+	}
+	return j, err
+}
+
+// ListGenerationJobs returns a dataset's generation jobs, newest first.
+func ListGenerationJobs(ctx context.Context, db *sql.DB, datasetID int64, limit, offset int) ([]GenerationJob, error) {
+	return queryGenerationJobs(ctx, db, `
+SELECT `+generationJobColumns+`
+FROM generation_jobs
+WHERE dataset_id = $1
+ORDER BY created_at DESC, id DESC
+LIMIT $2 OFFSET $3
+`, datasetID, limit, offset)
+}
+
+// ListActiveGenerationJobs returns queued and running jobs, oldest first, for resuming
+// after a restart.
+func ListActiveGenerationJobs(ctx context.Context, db *sql.DB) ([]GenerationJob, error) {
+	return queryGenerationJobs(ctx, db, `
+SELECT `+generationJobColumns+`
+FROM generation_jobs
+WHERE status IN ($1, $2)
+ORDER BY id ASC
+`, GenerationStatusQueued, GenerationStatusRunning)
+}
+
+func queryGenerationJobs(ctx context.Context, db *sql.DB, query string, args ...any) ([]GenerationJob, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []GenerationJob{}
+	for rows.Next() {
+		j, err := scanGenerationJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, j)
+	}
+	return out, rows.Err()
+}
+
+// StartGenerationJob marks a queued (or resumed running) job running.
+func StartGenerationJob(ctx context.Context, db *sql.DB, id int64) error {
+	_, err := db.ExecContext(ctx, `
+UPDATE generation_jobs SET status = $2, started_at = COALESCE(started_at, now())
+WHERE id = $1 AND status IN ($3, $2)
+`, id, GenerationStatusRunning, GenerationStatusQueued)
+	return err
+}
+
+// RecordGenerationAttempt counts one finished attempt, successful or not.
+func RecordGenerationAttempt(ctx context.Context, db *sql.DB, id int64, ok bool) error {
+	col := "failed"
+	if ok {
+		col = "generated"
+	}
+	_, err := db.ExecContext(ctx, `UPDATE generation_jobs SET `+col+` = `+col+` + 1 WHERE id = $1`, id)
+	return err
+}
+
+// FinishGenerationJob moves a running job to status (succeeded or failed) with errMsg. A job
+// canceled meanwhile keeps its canceled status.
+func FinishGenerationJob(ctx context.Context, db *sql.DB, id int64, status, errMsg string) error {
+	_, err := db.ExecContext(ctx, `
+UPDATE generation_jobs SET status = $2, error = $3, finished_at = now()
+WHERE id = $1 AND status = $4
+`, id, status, errMsg, GenerationStatusRunning)
+	return err
+}
+
+// CancelGenerationJob cancels an active job and returns it; a finished job is ErrConflict.
+func CancelGenerationJob(ctx context.Context, db *sql.DB, id int64) (GenerationJob, error) {
+	j, err := scanGenerationJob(db.QueryRowContext(ctx, `
+UPDATE generation_jobs SET status = $2, finished_at = now()
+WHERE id = $1 AND status IN ($3, $4)
+RETURNING `+generationJobColumns, id, GenerationStatusCanceled, GenerationStatusQueued, GenerationStatusRunning))
+	if err == nil {
+		return j, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return GenerationJob{}, err
+	}
+	j, err = GetGenerationJob(ctx, db, id)
+	if err != nil {
+		return GenerationJob{}, err
+	}
+	return GenerationJob{}, fmt.Errorf("%w: generation job %d is already %s", ErrConflict, id, j.Status)
+}
+
+// GenerationSeed is one seed of a job with the reference stored in the generated user
+// message's meta: its position in the inline list, or the seed item's id.
+type GenerationSeed struct {
+	Index  int
+	ItemID int64
+	Data   json.RawMessage
+}
+
+// Meta is the meta of the user message generated from s.
+func (s GenerationSeed) Meta(jobID int64) json.RawMessage {
+	m := map[string]any{"generation_job_id": jobID}
+	if s.ItemID > 0 {
+		m["seed_item_id"] = s.ItemID
+	} else {
+		m["seed_index"] = s.Index
+	}
+	raw, _ := json.Marshal(m)
+	return raw
+}
+
+// LoadGenerationSeeds returns a job's seeds: the inline list, or up to MaxGenerationSeeds
+// items of its seed dataset in id order.
+func LoadGenerationSeeds(ctx context.Context, db *sql.DB, j GenerationJob) ([]GenerationSeed, error) {
+	if j.SeedDatasetID == nil {
+		out := make([]GenerationSeed, len(j.Seeds))
+		for i, s := range j.Seeds {
+			out[i] = GenerationSeed{Index: i, Data: s}
+		}
+		return out, nil
+	}
+	rows, err := db.QueryContext(ctx, `
+SELECT id, data FROM dataset_items WHERE dataset_id = $1 ORDER BY id ASC LIMIT $2
+`, *j.SeedDatasetID, MaxGenerationSeeds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []GenerationSeed
+	for rows.Next() {
+		s := GenerationSeed{Index: len(out)}
+		if err := rows.Scan(&s.ItemID, &s.Data); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// InsertGeneratedConversation stores one generated exchange as a pending conversation
+// tagged synthetic, with source "generation-job:<id>" and the seed reference in the user
+// message's meta. When the dataset was locked since the job started, the lock triggers
+// (migration 036) refuse the insert and the error is a *DatasetLockedError.
+func InsertGeneratedConversation(ctx context.Context, db *sql.DB, j GenerationJob, seed GenerationSeed, prompt, reply string) (Conversation, error) {
+	var msgs []Message
+	if j.SystemPrompt != "" {
+		msgs = append(msgs, Message{Role: RoleSystem, Content: j.SystemPrompt, Meta: json.RawMessage("{}")})
+	}
+	msgs = append(msgs,
+		Message{Role: RoleUser, Content: prompt, Meta: seed.Meta(j.ID)},
+		Message{Role: RoleAssistant, Content: reply, Meta: json.RawMessage("{}")},
+	)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return Conversation{}, err
+	}
+	defer tx.Rollback()
+
+	c, err := InsertConversationWithMessages(ctx, tx, Conversation{
+		DatasetID: j.DatasetID,
+		Status:    ConversationStatusPending,
+		Tags:      []string{GenerationTag},
+		Source:    fmt.Sprintf("generation-job:%d", j.ID),
+		Messages:  msgs,
+	})
+	if err != nil {
+		if le := AsLockedError(err); le != nil {
+			return Conversation{}, le
+		}
+		return Conversation{}, err
+	}
+	return c, tx.Commit()
+}
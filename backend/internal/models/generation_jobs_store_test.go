@@ -0,0 +1,74 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestRenderSeedPrompt(t *testing.T) {
+	tmpl, err := ParseSeedTemplate("Write a question about {{.topic}}.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := RenderSeedPrompt(tmpl, json.RawMessage(`{"topic":"tides"}`))
+	if err != nil || got != "Write a question about tides." {
+		t.Fatalf("got %q %v", got, err)
+	}
+	if _, err := RenderSeedPrompt(tmpl, json.RawMessage(`{"subject":"tides"}`)); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected a missing key to fail, got %v", err)
+	}
+
+	tmpl, _ = ParseSeedTemplate("Explain {{.}}")
+	if got, _ := RenderSeedPrompt(tmpl, json.RawMessage(`"entropy"`)); got != "Explain entropy" {
+		t.Fatalf("expected a string seed as dot, got %q", got)
+	}
+	if _, err := ParseSeedTemplate("{{.topic"); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected a parse error, got %v", err)
+	}
+}
+
+func TestValidateGenerationJob(t *testing.T) {
+	seedDS := int64(3)
+	ok := GenerationJob{DatasetID: 1, PromptTemplate: "About {{.topic}}", Seeds: []json.RawMessage{json.RawMessage(`{"topic":"a"}`)}, TargetCount: 10, Concurrency: 2}
+	if err := ValidateGenerationJob(ok); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	cases := []struct {
+		field string
+		edit  func(*GenerationJob)
+	}{
+		{"dataset_id", func(j *GenerationJob) { j.DatasetID = 0 }},
+		{"prompt_template", func(j *GenerationJob) { j.PromptTemplate = " " }},
+		{"seeds", func(j *GenerationJob) { j.Seeds = nil }},
+		{"seeds", func(j *GenerationJob) { j.SeedDatasetID = &seedDS }},
+		{"seeds", func(j *GenerationJob) { j.Seeds = []json.RawMessage{json.RawMessage(`{"name":"a"}`)} }},
+		{"target_count", func(j *GenerationJob) { j.TargetCount = MaxGenerationTarget + 1 }},
+		{"concurrency", func(j *GenerationJob) { j.Concurrency = 0 }},
+		{"concurrency", func(j *GenerationJob) { j.Concurrency = MaxGenerationConcurrency + 1 }},
+	}
+	for _, c := range cases {
+		j := ok
+		c.edit(&j)
+		var verr *ValidationError
+		if err := ValidateGenerationJob(j); !errors.As(err, &verr) || verr.First() != c.field {
+			t.Fatalf("%s: expected a field error, got %v", c.field, err)
+		}
+	}
+
+	j := ok
+	j.Seeds, j.SeedDatasetID = nil, &seedDS
+	if err := ValidateGenerationJob(j); err != nil {
+		t.Fatalf("expected a seed dataset to be accepted, got %v", err)
+	}
+}
+
+func TestGenerationSeedMeta(t *testing.T) {
+	if got := string(GenerationSeed{Index: 2}.Meta(7)); got != `{"generation_job_id":7,"seed_index":2}` {
+		t.Fatalf("got %s", got)
+	}
+	if got := string(GenerationSeed{Index: 2, ItemID: 40}.Meta(7)); got != `{"generation_job_id":7,"seed_item_id":40}` {
+		t.Fatalf("got %s", got)
+	}
+}
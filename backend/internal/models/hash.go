@@ -0,0 +1,143 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+// Content hashes identify an example by its text alone, so copies exported at different
+// times, from different datasets or by other tools can be matched. The algorithm is part of
+// the export format (include_hash) and must not change:
+//
+//  1. Each text is normalized with NormalizeForHash: lowercased, whitespace runs collapsed to
+//     one space, leading and trailing whitespace dropped.
+//  2. The parts below are written to SHA-256, each followed by a zero byte.
+//     - conversation: for every message, its role ("system", "user", "assistant") then its
+//       normalized content
+//     - pair: "user", the normalized user text, "assistant", the normalized assistant text
+//       (so a pair hashes like the two-message conversation it stands for)
+//     - completion: "text", the normalized text
+//     - turns: like a conversation of the prompt turns (with the roles they came from)
+//       followed by the completion as an assistant message
+//     - item: "item", then the item data as canonical JSON: object keys sorted, no
+//       insignificant whitespace, every string value normalized, numbers as written, no
+//       escaping beyond what JSON requires (Go's encoding with HTML escaping off)
+//  3. The digest is hex-encoded; exported lines carry it as "sha256:<hex>".
+//
+// Ids, timestamps, split, tags and other metadata never enter the hash.
+
+// NormalizeForHash lowercases s and collapses whitespace so trivially re-formatted copies of
+// the same text hash identically.
+func NormalizeForHash(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+func hashParts(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ConversationContentHash hashes the normalized role/content sequence of msgs.
+func ConversationContentHash(msgs []Message) string {
+	parts := make([]string, 0, 2*len(msgs))
+	for _, m := range msgs {
+		parts = append(parts, string(m.Role), NormalizeForHash(m.Content))
+	}
+	return hashParts(parts...)
+}
+
+// PairContentHash hashes the normalized user and assistant text of p.
+func PairContentHash(p ExportPair) string {
+	return ConversationContentHash([]Message{{Role: RoleUser, Content: p.User}, {Role: RoleAssistant, Content: p.Assistant}})
+}
+
+// TurnsContentHash hashes a type=turns line like the conversation it stands for.
+func TurnsContentHash(t ExportTurns) string {
+	msgs := make([]Message, 0, len(t.PromptTurns)+1)
+	for i, content := range t.PromptTurns {
+		role := RoleUser
+		if i < len(t.roles) {
+			role = t.roles[i]
+		}
+		msgs = append(msgs, Message{Role: role, Content: content})
+	}
+	return ConversationContentHash(append(msgs, Message{Role: RoleAssistant, Content: t.Completion}))
+}
+
+// CompletionContentHash hashes the normalized text of a completion line.
+func CompletionContentHash(text string) string {
+	return hashParts("text", NormalizeForHash(text))
+}
+
+// ItemContentHash hashes item data independently of key order and formatting. Data that is
+// not valid JSON is hashed as a single string.
+func ItemContentHash(data json.RawMessage) string {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		v = string(data)
+	}
+	// encoding/json sorts map keys and keeps json.Number as written; <, > and & stay literal.
+	var canonical bytes.Buffer
+	enc := json.NewEncoder(&canonical)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(normalizeJSONStrings(v))
+	return hashParts("item", strings.TrimSuffix(canonical.String(), "\n"))
+}
+
+func normalizeJSONStrings(v any) any {
+	switch t := v.(type) {
+	case string:
+		return NormalizeForHash(t)
+	case map[string]any:
+		for k, x := range t {
+			t[k] = normalizeJSONStrings(x)
+		}
+		return t
+	case []any:
+		for i, x := range t {
+			t[i] = normalizeJSONStrings(x)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// lineHash formats a content hash for the "hash" field of an exported line.
+func lineHash(hex string) string {
+	return "sha256:" + hex
+}
+
+// finishLine applies opts.MaxChars (see fitLine) to an export line, then fills its hash when
+// opts.IncludeHash is set, so the hash covers exactly the exported content.
+func finishLine(line any, opts ExportOptions) (any, bool) {
+	line, ok := fitLine(line, opts)
+	if !ok || !opts.IncludeHash {
+		return line, ok
+	}
+	switch l := line.(type) {
+	case ExportPair:
+		l.Hash = lineHash(PairContentHash(l))
+		return l, true
+	case ExportCompletion:
+		l.Hash = lineHash(CompletionContentHash(l.Text))
+		return l, true
+	case ExportTurns:
+		l.Hash = lineHash(TurnsContentHash(l))
+		return l, true
+	case ExportConversation:
+		l.Hash = lineHash(ConversationContentHash(l.Messages))
+		return l, true
+	default:
+		return line, true
+	}
+}
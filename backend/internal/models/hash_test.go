@@ -0,0 +1,125 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// The digests below are computed independently of this package (sha256 over the documented
+// parts, each followed by a zero byte) and pin the published algorithm.
+func TestContentHash_Published(t *testing.T) {
+	cases := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{
+			"pair",
+			PairContentHash(ExportPair{User: "  Hello\tWORLD ", Assistant: "Hi there"}),
+			"634f9091c4d89225973fa3a5effdb869e7f5729bc93a7ede1294f608425d66d7",
+		},
+		{
+			"conversation equal to the pair",
+			ConversationContentHash([]Message{{Role: RoleUser, Content: "hello world"}, {Role: RoleAssistant, Content: "hi  there"}}),
+			"634f9091c4d89225973fa3a5effdb869e7f5729bc93a7ede1294f608425d66d7",
+		},
+		{
+			"completion",
+			CompletionContentHash("Once upon\na time"),
+			"550fbc982211e18795d4d7c3e9ec8fc87ea13e349c05a6f97a9fc3716e58b207",
+		},
+		{
+			"item",
+			ItemContentHash(json.RawMessage(`{ "b": "<TAG> &  more", "a": [1, "X y"] }`)),
+			"ba08b495fcc26d13e292c319f6abde4f883adeb15fa9608d1f3d4eb9fcf59f77",
+		},
+	}
+	for _, c := range cases {
+		if c.got != c.want {
+			t.Errorf("%s: got %s, want %s", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestItemContentHash_Equivalence(t *testing.T) {
+	base := ItemContentHash(json.RawMessage(`{"text":"Hello world","meta":{"n":1,"k":"v"}}`))
+	for _, same := range []string{
+		`{"meta":{"k":"v","n":1},"text":"Hello world"}`,
+		"{\n  \"text\": \"hello   WORLD\",\n  \"meta\": {\"k\": \"V\", \"n\": 1}\n}",
+	} {
+		if got := ItemContentHash(json.RawMessage(same)); got != base {
+			t.Errorf("%s should hash like the base item", same)
+		}
+	}
+	for _, diff := range []string{
+		`{"text":"Hello world","meta":{"n":2,"k":"v"}}`,
+		`{"text":"Hello world","meta":{"n":1.0,"k":"v"}}`,
+		`{"text":"Hello world!","meta":{"n":1,"k":"v"}}`,
+	} {
+		if got := ItemContentHash(json.RawMessage(diff)); got == base {
+			t.Errorf("%s should not hash like the base item", diff)
+		}
+	}
+}
+
+func TestFinishLine_Hash(t *testing.T) {
+	pair := ExportPair{User: "hi", Assistant: "hello", ExportProvenance: ExportProvenance{ConversationID: 9}}
+	line, ok := finishLine(pair, ExportOptions{IncludeHash: true})
+	if !ok {
+		t.Fatal("line dropped")
+	}
+	got := line.(ExportPair).Hash
+	if got != "sha256:"+PairContentHash(pair) {
+		t.Fatalf("unexpected hash %q", got)
+	}
+	// Provenance is not part of the hash.
+	pair.ConversationID = 10
+	if line, _ := finishLine(pair, ExportOptions{IncludeHash: true}); line.(ExportPair).Hash != got {
+		t.Fatal("hash must not depend on ids")
+	}
+	if line, _ := finishLine(pair, ExportOptions{}); line.(ExportPair).Hash != "" {
+		t.Fatal("hash only with IncludeHash")
+	}
+
+	// The hash covers the truncated content that is actually exported.
+	conv := ExportConversation{Messages: []Message{{Role: RoleUser, Content: "abcdef"}, {Role: RoleAssistant, Content: "xy"}}}
+	line, _ = finishLine(conv, ExportOptions{IncludeHash: true, MaxChars: 7, OnOversize: OversizeTruncate})
+	c := line.(ExportConversation)
+	if c.Hash != "sha256:"+ConversationContentHash(c.Messages) {
+		t.Fatalf("hash should match the truncated messages: %+v", c)
+	}
+}
+
+func TestStreamPairsGrouped_HashesEachPair(t *testing.T) {
+	db := newFakeDB(t, func(query string, args []any) fakeResult {
+		switch {
+		case strings.Contains(query, "FROM conversation_messages"):
+			return fakeResult{
+				cols: []string{"id", "role", "name", "content", "meta"},
+				rows: [][]any{{int64(1), "user", "", "hi", nil}, {int64(2), "assistant", "", "hello", nil}},
+			}
+		case strings.Contains(query, "FROM conversations"):
+			return fakeResult{
+				cols: []string{"id", "split", "status", "tags", "source", "notes", "meta"},
+				rows: [][]any{{int64(7), "train", "approved", []byte(`[]`), "", "", nil}},
+			}
+		}
+		t.Fatalf("unexpected query: %s", query)
+		return fakeResult{}
+	})
+	var buf bytes.Buffer
+	opts := ExportOptions{Type: ExportTypePairsGrouped, DatasetID: 3, IncludeHash: true}
+	if err := streamPairsGrouped(context.Background(), db, &buf, opts); err != nil {
+		t.Fatal(err)
+	}
+	var line ExportPairsGroup
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil || len(line.Pairs) != 1 {
+		t.Fatalf("unexpected line %q (%v)", buf.String(), err)
+	}
+	if want := "sha256:" + PairContentHash(ExportPair{User: "hi", Assistant: "hello"}); line.Pairs[0].Hash != want {
+		t.Fatalf("expected each pair to hash like a pairs line, got %q", line.Pairs[0].Hash)
+	}
+}
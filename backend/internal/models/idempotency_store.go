@@ -0,0 +1,99 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// IdempotencyKeyTTL is how long a stored response is replayed for a repeated key.
+const IdempotencyKeyTTL = 24 * time.Hour
+
+// ErrIdempotencyKeyReused is returned when a key is sent again with a different request body.
+var ErrIdempotencyKeyReused = fmt.Errorf("%w: idempotency key reused with a different request", ErrConflict)
+
+type IdempotentResponse struct {
+	ResourceID int64
+	StatusCode int
+	Body       json.RawMessage
+}
+
+// RequestHash is the hash a key is bound to: sha256 of the raw request body.
+func RequestHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// sameRequest reports whether a stored request hash matches; keys stored before hashes were
+// recorded match any request.
+func sameRequest(stored, hash string) bool {
+	return stored == "" || stored == hash
+}
+
+// ReserveIdempotencyKey claims key for a request whose body hashes to requestHash, inside tx,
+// the transaction that creates the resource. It returns nil when the key is now reserved; the
+// caller then creates the resource and calls CompleteIdempotencyKey before committing. A
+// concurrent request with the same key blocks on the reservation until tx ends, and then
+// either reserves the key itself (tx rolled back) or gets the stored response for replay. A
+// live key sent with a different body is ErrIdempotencyKeyReused.
+func ReserveIdempotencyKey(ctx context.Context, tx *sql.Tx, scope string, key string, requestHash string) (*IdempotentResponse, error) {
+	now := time.Now().UTC()
+	// An expired entry no longer protects anything; dropping it lets the key be reserved again.
+	if _, err := tx.ExecContext(ctx, `
+DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2 AND created_at <= $3
+`, scope, key, now.Add(-IdempotencyKeyTTL)); err != nil {
+		return nil, err
+	}
+	res, err := tx.ExecContext(ctx, `
+INSERT INTO idempotency_keys (scope, key, request_hash, created_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (scope, key) DO NOTHING
+`, scope, key, requestHash, now)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 1 {
+		return nil, nil
+	}
+
+	// The key is held by a committed request, which stored its response in the same
+	// transaction that reserved it.
+	var stored string
+	var out IdempotentResponse
+	err = tx.QueryRowContext(ctx, `
+SELECT request_hash, resource_id, status_code, response
+FROM idempotency_keys
+WHERE scope = $1 AND key = $2
+`, scope, key).Scan(&stored, &out.ResourceID, &out.StatusCode, &out.Body)
+	if err != nil {
+		return nil, err
+	}
+	if !sameRequest(stored, requestHash) {
+		return nil, ErrIdempotencyKeyReused
+	}
+	return &out, nil
+}
+
+// CompleteIdempotencyKey stores the response for a key reserved in tx.
+func CompleteIdempotencyKey(ctx context.Context, tx *sql.Tx, scope string, key string, resp IdempotentResponse) error {
+	_, err := tx.ExecContext(ctx, `
+UPDATE idempotency_keys
+SET resource_id = $3, status_code = $4, response = $5
+WHERE scope = $1 AND key = $2
+`, scope, key, resp.ResourceID, resp.StatusCode, []byte(resp.Body))
+	return err
+}
+
+func PurgeExpiredIdempotencyKeys(ctx context.Context, db *sql.DB) (int64, error) {
+	res, err := db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE created_at <= $1`, time.Now().UTC().Add(-IdempotencyKeyTTL))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// keyStore is a database/sql driver holding idempotency_keys rows in memory. It answers only
+// the statements ReserveIdempotencyKey and CompleteIdempotencyKey send.
+type keyStore struct {
+	rows map[string]*keyRow
+}
+
+type keyRow struct {
+	hash       string
+	resourceID int64
+	status     int64
+	body       []byte
+}
+
+func (s *keyStore) Connect(context.Context) (driver.Conn, error) { return keyConn{s}, nil }
+func (s *keyStore) Driver() driver.Driver                        { return nil }
+
+type keyConn struct{ s *keyStore }
+
+func (c keyConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+func (c keyConn) Close() error              { return nil }
+func (c keyConn) Begin() (driver.Tx, error) { return keyTx{}, nil }
+
+type keyTx struct{}
+
+func (keyTx) Commit() error   { return nil }
+func (keyTx) Rollback() error { return nil }
+
+func (c keyConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	id := args[0].Value.(string) + "/" + args[1].Value.(string)
+	query = strings.TrimSpace(query)
+	switch {
+	case strings.HasPrefix(query, "DELETE"):
+		return driver.RowsAffected(0), nil
+	case strings.HasPrefix(query, "INSERT"):
+		if _, ok := c.s.rows[id]; ok {
+			return driver.RowsAffected(0), nil
+		}
+		c.s.rows[id] = &keyRow{hash: args[2].Value.(string)}
+		return driver.RowsAffected(1), nil
+	case strings.HasPrefix(query, "UPDATE"):
+		row := c.s.rows[id]
+		row.resourceID, row.status, row.body = args[2].Value.(int64), args[3].Value.(int64), args[4].Value.([]byte)
+		return driver.RowsAffected(1), nil
+	}
+	return nil, errors.New("unexpected statement: " + query)
+}
+
+func (c keyConn) QueryContext(_ context.Context, _ string, args []driver.NamedValue) (driver.Rows, error) {
+	row := c.s.rows[args[0].Value.(string)+"/"+args[1].Value.(string)]
+	return &keyRows{row: row}, nil
+}
+
+type keyRows struct {
+	row  *keyRow
+	done bool
+}
+
+func (r *keyRows) Columns() []string {
+	return []string{"request_hash", "resource_id", "status_code", "response"}
+}
+func (r *keyRows) Close() error { return nil }
+func (r *keyRows) Next(dest []driver.Value) error {
+	if r.done || r.row == nil {
+		return io.EOF
+	}
+	r.done = true
+	dest[0], dest[1], dest[2], dest[3] = r.row.hash, r.row.resourceID, r.row.status, r.row.body
+	return nil
+}
+
+func TestReserveIdempotencyKey(t *testing.T) {
+	store := &keyStore{rows: map[string]*keyRow{}}
+	db := sql.OpenDB(store)
+	defer db.Close()
+	ctx := context.Background()
+
+	reserve := func(body string) (*IdempotentResponse, error) {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Commit()
+		return ReserveIdempotencyKey(ctx, tx, "conversations", "k1", RequestHash([]byte(body)))
+	}
+
+	prev, err := reserve(`{"dataset_id":1}`)
+	if err != nil || prev != nil {
+		t.Fatalf("first request should reserve the key, got %v %v", prev, err)
+	}
+	tx, _ := db.BeginTx(ctx, nil)
+	if err := CompleteIdempotencyKey(ctx, tx, "conversations", "k1", IdempotentResponse{ResourceID: 9, StatusCode: 201, Body: []byte(`{"id":9}`)}); err != nil {
+		t.Fatal(err)
+	}
+	_ = tx.Commit()
+
+	prev, err = reserve(`{"dataset_id":1}`)
+	if err != nil || prev == nil || prev.ResourceID != 9 || prev.StatusCode != 201 || string(prev.Body) != `{"id":9}` {
+		t.Fatalf("a retry should get the stored response, got %+v %v", prev, err)
+	}
+	if _, err := reserve(`{"dataset_id":2}`); !errors.Is(err, ErrIdempotencyKeyReused) || !errors.Is(err, ErrConflict) {
+		t.Fatalf("a different body should be rejected, got %v", err)
+	}
+}
+
+func TestRequestHash(t *testing.T) {
+	a, b := RequestHash([]byte(`{"a":1}`)), RequestHash([]byte(`{"a": 1}`))
+	if a == b || len(a) != 64 || a != RequestHash([]byte(`{"a":1}`)) {
+		t.Fatalf("expected a stable sha256 of the raw body, got %s and %s", a, b)
+	}
+	if !sameRequest("", a) || !sameRequest(a, a) || sameRequest(a, b) {
+		t.Fatal("expected keys stored without a hash to match any request, others only their own")
+	}
+}
@@ -0,0 +1,195 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ImportRun records one import into a dataset. import_jsonl creates it before the first row
+// and finishes it after the last batch, so FinishedAt is nil while the run is in progress (or
+// if it crashed). Rows it created carry its id in import_run_id.
+type ImportRun struct {
+	ID           int64             `json:"id"`
+	DatasetID    int64             `json:"dataset_id"`
+	Input        string            `json:"input"` // file base name or hf:org/name
+	Mode         string            `json:"mode"`  // items|conversations
+	Imported     int               `json:"imported"`
+	Bad          int               `json:"bad"`
+	Flags        map[string]string `json:"flags"`
+	StartedAt    time.Time         `json:"started_at"`
+	FinishedAt   *time.Time        `json:"finished_at"`
+	RolledBackAt *time.Time        `json:"rolled_back_at"`
+}
+
+const importRunColumns = `id, dataset_id, input, mode, imported, bad, flags, started_at, finished_at, rolled_back_at`
+
+func CreateImportRun(ctx context.Context, db *sql.DB, r ImportRun) (ImportRun, error) {
+	if r.Flags == nil {
+		r.Flags = map[string]string{}
+	}
+	flags, err := json.Marshal(r.Flags)
+	if err != nil {
+		return ImportRun{}, err
+	}
+	var finished *time.Time
+	if r.FinishedAt != nil {
+		t := r.FinishedAt.UTC()
+		finished = &t
+	}
+	err = db.QueryRowContext(ctx, `
+INSERT INTO import_runs (dataset_id, input, mode, imported, bad, flags, started_at, finished_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING id
+`, r.DatasetID, r.Input, r.Mode, r.Imported, r.Bad, flags, r.StartedAt.UTC(), finished).Scan(&r.ID)
+	if err != nil {
+		return ImportRun{}, err
+	}
+	return r, nil
+}
+
+// FinishImportRun stores a run's final counts and stamps finished_at.
+func FinishImportRun(ctx context.Context, db *sql.DB, id int64, imported, bad int) error {
+	res, err := db.ExecContext(ctx, `
+UPDATE import_runs SET imported = $2, bad = $3, finished_at = $4 WHERE id = $1
+`, id, imported, bad, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func GetImportRun(ctx context.Context, db *sql.DB, id int64) (ImportRun, error) {
+	r, err := scanImportRun(db.QueryRowContext(ctx, `SELECT `+importRunColumns+` FROM import_runs WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ImportRun{}, ErrNotFound
+	}
+	return r, err
+}
+
+// ListImportRuns returns a dataset's import runs, newest first.
+func ListImportRuns(ctx context.Context, db *sql.DB, datasetID int64, limit int, offset int) ([]ImportRun, error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT `+importRunColumns+`
+FROM import_runs
+WHERE dataset_id = $1
+ORDER BY started_at DESC, id DESC
+LIMIT $2 OFFSET $3
+`, datasetID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []ImportRun{}
+	for rows.Next() {
+		r, err := scanImportRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func scanImportRun(row interface{ Scan(...any) error }) (ImportRun, error) {
+	var r ImportRun
+	var flags []byte
+	if err := row.Scan(&r.ID, &r.DatasetID, &r.Input, &r.Mode, &r.Imported, &r.Bad, &flags, &r.StartedAt, &r.FinishedAt, &r.RolledBackAt); err != nil {
+		return ImportRun{}, err
+	}
+	_ = json.Unmarshal(flags, &r.Flags)
+	return r, nil
+}
+
+// Rollback actions for RollbackImportRun.
+const (
+	RollbackDelete  = "delete"
+	RollbackArchive = "archive"
+)
+
+// ImportRollback reports what RollbackImportRun did.
+type ImportRollback struct {
+	RunID    int64  `json:"run_id"`
+	Action   string `json:"action"`
+	Rows     int64  `json:"rows"`     // rows deleted or archived
+	Modified int64  `json:"modified"` // of those, rows edited since the import
+}
+
+// RollbackImportRun deletes (or, for conversation runs, archives) every row created by run
+// id, wherever it has been moved since. Rows edited after the import (updated_at past
+// created_at) make it fail with ErrConflict unless force is set. A run can be rolled back once.
+func RollbackImportRun(ctx context.Context, db *sql.DB, id int64, action string, force bool) (ImportRollback, error) {
+	if action == "" {
+		action = RollbackDelete
+	}
+	if action != RollbackDelete && action != RollbackArchive {
+		return ImportRollback{}, fmt.Errorf("%w: action must be delete|archive", ErrInvalidInput)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return ImportRollback{}, err
+	}
+	defer tx.Rollback()
+
+	var mode string
+	var rolledBack sql.NullTime
+	if err := tx.QueryRowContext(ctx, `SELECT mode, rolled_back_at FROM import_runs WHERE id = $1 FOR UPDATE`, id).Scan(&mode, &rolledBack); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ImportRollback{}, ErrNotFound
+		}
+		return ImportRollback{}, err
+	}
+	if rolledBack.Valid {
+		return ImportRollback{}, fmt.Errorf("%w: import run %d was already rolled back", ErrConflict, id)
+	}
+	table := "dataset_items"
+	if strings.EqualFold(mode, "conversations") {
+		table = "conversations"
+	} else if action == RollbackArchive {
+		return ImportRollback{}, fmt.Errorf("%w: only conversation imports can be archived", ErrInvalidInput)
+	}
+
+	out := ImportRollback{RunID: id, Action: action}
+	if err := tx.QueryRowContext(ctx, `
+SELECT COUNT(*) FILTER (WHERE updated_at > created_at) FROM `+table+` WHERE import_run_id = $1
+`, id).Scan(&out.Modified); err != nil {
+		return ImportRollback{}, err
+	}
+	if out.Modified > 0 && !force {
+		return out, fmt.Errorf("%w: %d rows of import run %d were modified since import; pass force=true to roll back anyway", ErrConflict, out.Modified, id)
+	}
+
+	var res sql.Result
+	if action == RollbackArchive {
+		res, err = tx.ExecContext(ctx, `
+UPDATE conversations SET status = $2, updated_at = $3 WHERE import_run_id = $1 AND status <> $2
+`, id, ConversationStatusArchived, time.Now().UTC())
+	} else {
+		res, err = tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE import_run_id = $1`, id)
+	}
+	if err != nil {
+		return ImportRollback{}, err
+	}
+	out.Rows, _ = res.RowsAffected()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE import_runs SET rolled_back_at = $2 WHERE id = $1`, id, time.Now().UTC()); err != nil {
+		return ImportRollback{}, err
+	}
+	detail, _ := json.Marshal(out)
+	if err := insertAuditEntry(ctx, tx, "import_run", id, "rollback", detail); err != nil {
+		return ImportRollback{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return ImportRollback{}, err
+	}
+	return out, nil
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRollbackImportRun_RejectsUnknownAction(t *testing.T) {
+	// The action is checked before any database access.
+	if _, err := RollbackImportRun(context.Background(), nil, 1, "purge", false); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected ErrInvalidInput, got %v", err)
+	}
+}
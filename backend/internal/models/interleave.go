@@ -0,0 +1,166 @@
+package models
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// MaxInterleaveWeight bounds a single split's weight in ParseInterleave.
+const MaxInterleaveWeight = 1000
+
+// InterleaveWeight is one split:weight entry of ExportOptions.Interleave.
+type InterleaveWeight struct {
+	Split  string `json:"split"`
+	Weight int    `json:"weight"`
+}
+
+// ParseInterleave parses "train:9,valid:1" into weights, keeping the given order. Each split
+// may appear once; weights are 1..MaxInterleaveWeight. An empty string means no interleave.
+func ParseInterleave(s string) ([]InterleaveWeight, error) {
+	var out []InterleaveWeight
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, weight, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: interleave entry %q must be split:weight", ErrInvalidInput, part)
+		}
+		split, ok := NormalizeSplit(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: interleave split must be train|valid|test, got %q", ErrInvalidInput, name)
+		}
+		if seen[string(split)] {
+			return nil, fmt.Errorf("%w: interleave split %q listed twice", ErrInvalidInput, split)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(weight))
+		if err != nil || n < 1 || n > MaxInterleaveWeight {
+			return nil, fmt.Errorf("%w: interleave weight for %s must be 1..%d", ErrInvalidInput, split, MaxInterleaveWeight)
+		}
+		seen[string(split)] = true
+		out = append(out, InterleaveWeight{Split: string(split), Weight: n})
+	}
+	return out, nil
+}
+
+// lineSource yields export lines one at a time; ok is false once it is exhausted.
+type lineSource interface {
+	next() (line any, ok bool, err error)
+}
+
+// interleaveLines emits up to weights[i] lines from sources[i] per round, skipping exhausted
+// sources, until all are exhausted or max (> 0) lines were emitted.
+func interleaveLines(sources []lineSource, weights []int, max int, emit func(any) error) error {
+	done := make([]bool, len(sources))
+	remaining := len(sources)
+	count := 0
+	for remaining > 0 {
+		for i, src := range sources {
+			for k := 0; k < weights[i] && !done[i]; k++ {
+				line, ok, err := src.next()
+				if err != nil {
+					return err
+				}
+				if !ok {
+					done[i] = true
+					remaining--
+					break
+				}
+				if err := emit(line); err != nil {
+					return err
+				}
+				count++
+				if max > 0 && count >= max {
+					return nil
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// splitLineSource walks one split's conversations, buffering the lines of the current one.
+type splitLineSource struct {
+	ctx     context.Context
+	db      *sql.DB
+	rows    *sql.Rows
+	opts    ExportOptions
+	pending []any
+}
+
+func (s *splitLineSource) next() (any, bool, error) {
+	for len(s.pending) == 0 {
+		if err := s.ctx.Err(); err != nil {
+			return nil, false, err
+		}
+		if !s.rows.Next() {
+			return nil, false, s.rows.Err()
+		}
+		c, err := scanExportConversationRow(s.rows, s.opts)
+		if err != nil {
+			return nil, false, err
+		}
+		if !s.opts.sampled(c.ID) {
+			continue
+		}
+		msgs, err := loadMessages(s.ctx, s.db, c.ID)
+		if err != nil {
+			return nil, false, err
+		}
+		if !passesQualityGate(msgs, s.opts) {
+			continue
+		}
+		if s.opts.Type == "conversations" {
+			if line, ok := finishLine(conversationLine(c, msgs, s.opts), s.opts); ok {
+				s.pending = []any{line}
+			}
+		} else {
+			lines, err := conversationPairLines(c, msgs, s.opts)
+			if err != nil {
+				return nil, false, err
+			}
+			s.pending = lines
+		}
+	}
+	line := s.pending[0]
+	s.pending = s.pending[1:]
+	return line, true, nil
+}
+
+// streamInterleaved runs one cursor per opts.Interleave split and merges them by weight.
+func streamInterleaved(ctx context.Context, db *sql.DB, w io.Writer, opts ExportOptions) error {
+	if !slices.Contains(LineExportTypes, opts.Type) {
+		return fmt.Errorf("%w: interleave supports type %s", ErrInvalidInput, strings.Join(LineExportTypes, ", "))
+	}
+
+	sources := make([]lineSource, 0, len(opts.Interleave))
+	weights := make([]int, 0, len(opts.Interleave))
+	for _, iw := range opts.Interleave {
+		splitOpts := opts
+		splitOpts.Split = iw.Split
+		query, args := conversationsFilterQuery(splitOpts)
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		sources = append(sources, &splitLineSource{ctx: ctx, db: db, rows: rows, opts: splitOpts})
+		weights = append(weights, iw.Weight)
+	}
+
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+	enc := json.NewEncoder(bw)
+	return interleaveLines(sources, weights, opts.MaxExamples, func(line any) error {
+		return enc.Encode(line)
+	})
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseInterleave(t *testing.T) {
+	got, err := ParseInterleave(" train:9, VALID:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []InterleaveWeight{{Split: "train", Weight: 9}, {Split: "valid", Weight: 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if got, err := ParseInterleave(""); err != nil || got != nil {
+		t.Fatalf("empty should mean none, got %v %v", got, err)
+	}
+	for _, bad := range []string{"train", "all:1", "train:0", "train:x", "train:1,train:2", "test:1001"} {
+		if _, err := ParseInterleave(bad); !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("%q: expected ErrInvalidInput, got %v", bad, err)
+		}
+	}
+}
+
+type sliceLineSource struct{ lines []any }
+
+func (s *sliceLineSource) next() (any, bool, error) {
+	if len(s.lines) == 0 {
+		return nil, false, nil
+	}
+	l := s.lines[0]
+	s.lines = s.lines[1:]
+	return l, true, nil
+}
+
+func collectInterleaved(t *testing.T, weights []int, max int, lines ...[]any) []any {
+	t.Helper()
+	sources := make([]lineSource, len(lines))
+	for i, l := range lines {
+		sources[i] = &sliceLineSource{lines: l}
+	}
+	var out []any
+	if err := interleaveLines(sources, weights, max, func(l any) error {
+		out = append(out, l)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestInterleaveLines(t *testing.T) {
+	train := []any{"t1", "t2", "t3", "t4", "t5"}
+	valid := []any{"v1", "v2"}
+
+	got := collectInterleaved(t, []int{2, 1}, 0, train, valid)
+	want := []any{"t1", "t2", "v1", "t3", "t4", "v2", "t5"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	// An exhausted split drops out and the rest keep going.
+	got = collectInterleaved(t, []int{1, 1}, 0, []any{"t1"}, []any{"v1", "v2", "v3"})
+	if want := []any{"t1", "v1", "v2", "v3"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	// max applies to the merged stream.
+	got = collectInterleaved(t, []int{2, 1}, 4, train, valid)
+	if want := []any{"t1", "t2", "v1", "t3"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// spdxLicenses is the built-in allow-list of SPDX identifiers accepted for datasets.
+var spdxLicenses = []string{
+	"0BSD",
+	"AGPL-3.0-only",
+	"AGPL-3.0-or-later",
+	"Apache-2.0",
+	"BSD-2-Clause",
+	"BSD-3-Clause",
+	"CC-BY-4.0",
+	"CC-BY-NC-4.0",
+	"CC-BY-NC-SA-4.0",
+	"CC-BY-SA-4.0",
+	"CC-BY-ND-4.0",
+	"CC-BY-NC-ND-4.0",
+	"CC0-1.0",
+	"CDLA-Permissive-2.0",
+	"CDLA-Sharing-1.0",
+	"GPL-2.0-only",
+	"GPL-3.0-only",
+	"GPL-3.0-or-later",
+	"ISC",
+	"LGPL-3.0-only",
+	"MIT",
+	"MPL-2.0",
+	"ODC-By-1.0",
+	"ODbL-1.0",
+	"OpenRAIL",
+	"PDDL-1.0",
+	"Unlicense",
+	"LicenseRef-Proprietary",
+}
+
+// NormalizeLicense maps a case-insensitive SPDX identifier to its canonical spelling.
+func NormalizeLicense(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	for _, l := range spdxLicenses {
+		if strings.EqualFold(l, s) {
+			return l, true
+		}
+	}
+	return "", false
+}
+
+func validProvenanceURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// licenseStamper injects a leading "_license" field into every JSON object line written
+// through it. Lines that are not objects pass through untouched.
+type licenseStamper struct {
+	w      io.Writer
+	prefix []byte
+	buf    []byte
+}
+
+func newLicenseStamper(w io.Writer, license string) *licenseStamper {
+	v, _ := json.Marshal(license)
+	return &licenseStamper{w: w, prefix: append(append([]byte(`{"_license":`), v...), ',')}
+}
+
+func (s *licenseStamper) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	for {
+		i := bytes.IndexByte(s.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		if err := s.writeLine(s.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		s.buf = s.buf[i+1:]
+	}
+}
+
+// Flush writes a trailing partial line, if any.
+func (s *licenseStamper) Flush() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	err := s.writeLine(s.buf)
+	s.buf = nil
+	return err
+}
+
+func (s *licenseStamper) writeLine(line []byte) error {
+	return writeWithFields(s.w, s.prefix, line)
+}
+
+// writeWithFields writes obj with prefix (`{"k":v,` ...) replacing its opening brace, so the
+// prefixed fields come first. Anything that is not a JSON object is written unchanged.
+func writeWithFields(w io.Writer, prefix []byte, obj []byte) error {
+	if len(obj) == 0 || obj[0] != '{' {
+		_, err := w.Write(obj)
+		return err
+	}
+	rest := obj[1:]
+	if len(bytes.TrimSpace(rest)) > 0 && bytes.TrimSpace(rest)[0] == '}' {
+		// Empty object: drop the trailing comma.
+		prefix = prefix[:len(prefix)-1]
+	}
+	if _, err := w.Write(prefix); err != nil {
+		return err
+	}
+	_, err := w.Write(rest)
+	return err
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNormalizeLicense(t *testing.T) {
+	if l, ok := NormalizeLicense(" cc-by-4.0 "); !ok || l != "CC-BY-4.0" {
+		t.Fatalf("expected CC-BY-4.0, got %q ok=%v", l, ok)
+	}
+	if _, ok := NormalizeLicense("WTFPL-ish"); ok {
+		t.Fatalf("expected unknown license to be rejected")
+	}
+}
+
+func TestLicenseStamper_StampsObjectLines(t *testing.T) {
+	var buf bytes.Buffer
+	st := newLicenseStamper(&buf, "MIT")
+	// Split writes mid-line to exercise buffering.
+	_, _ = st.Write([]byte(`{"user":"hi","assis`))
+	_, _ = st.Write([]byte("tant\":\"hello\"}\n{}\n[1,2]\n"))
+	if err := st.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	want := "{\"_license\":\"MIT\",\"user\":\"hi\",\"assistant\":\"hello\"}\n{\"_license\":\"MIT\"}\n[1,2]\n"
+	if buf.String() != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,80 @@
+package models
+
+import "fmt"
+
+// Defaults for MessageLimits unless configured otherwise.
+const (
+	DefaultMaxMessages            = 1000
+	DefaultMaxMessageContentBytes = 1 << 20
+)
+
+// MessageLimits bounds a conversation written through the API or importer. A zero field
+// disables that limit.
+type MessageLimits struct {
+	MaxMessages     int // messages per conversation
+	MaxContentBytes int // bytes of one message's content
+	MaxMetaBytes    int // bytes of one message's meta, see ValidateMessageMeta
+}
+
+// DefaultMessageLimits returns the default limits.
+func DefaultMessageLimits() MessageLimits {
+	return MessageLimits{
+		MaxMessages:     DefaultMaxMessages,
+		MaxContentBytes: DefaultMaxMessageContentBytes,
+		MaxMetaBytes:    DefaultMaxMessageMetaBytes,
+	}
+}
+
+// Limits a LimitError can report.
+const (
+	LimitMessages = "messages"
+	LimitContent  = "content"
+)
+
+// LimitError reports a conversation over a MessageLimits bound. For LimitContent, Index is
+// the message's position, or -1 when it is not known yet.
+type LimitError struct {
+	Limit  string
+	Index  int
+	Reason string
+}
+
+func (e *LimitError) Error() string {
+	switch {
+	case e.Limit == LimitMessages:
+		return "conversation " + e.Reason
+	case e.Index < 0:
+		return "message content " + e.Reason
+	default:
+		return fmt.Sprintf("message %d content %s", e.Index, e.Reason)
+	}
+}
+
+// CheckCount reports a LimitError when a conversation would hold n messages.
+func (l MessageLimits) CheckCount(n int) error {
+	if l.MaxMessages > 0 && n > l.MaxMessages {
+		return &LimitError{Limit: LimitMessages, Index: -1, Reason: fmt.Sprintf("has %d messages (max %d)", n, l.MaxMessages)}
+	}
+	return nil
+}
+
+// CheckContent reports a LimitError when the content of message idx (-1 if unknown) is too long.
+func (l MessageLimits) CheckContent(idx int, content string) error {
+	if l.MaxContentBytes > 0 && len(content) > l.MaxContentBytes {
+		return &LimitError{Limit: LimitContent, Index: idx, Reason: fmt.Sprintf("is %d bytes (max %d)", len(content), l.MaxContentBytes)}
+	}
+	return nil
+}
+
+// Check runs CheckCount and CheckContent over msgs, reporting the first offender.
+func (l MessageLimits) Check(msgs []Message) error {
+	if err := l.CheckCount(len(msgs)); err != nil {
+		return err
+	}
+	for i, m := range msgs {
+		if err := l.CheckContent(i, m.Content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMessageLimits_Boundaries(t *testing.T) {
+	l := MessageLimits{MaxMessages: 3, MaxContentBytes: 5}
+	msgs := []Message{{Content: "12345"}, {Content: "a"}, {Content: "b"}}
+	if err := l.Check(msgs); err != nil {
+		t.Fatalf("at the limits: expected ok, got %v", err)
+	}
+
+	var le *LimitError
+	err := l.Check(append(msgs, Message{Content: "c"}))
+	if !errors.As(err, &le) || le.Limit != LimitMessages || le.Index != -1 {
+		t.Fatalf("expected a messages LimitError, got %v", err)
+	}
+	if err.Error() != "conversation has 4 messages (max 3)" {
+		t.Fatalf("unexpected message %q", err)
+	}
+
+	msgs[1].Content = "123456"
+	err = l.Check(msgs)
+	if !errors.As(err, &le) || le.Limit != LimitContent || le.Index != 1 {
+		t.Fatalf("expected a content LimitError at 1, got %v", err)
+	}
+}
+
+func TestMessageLimits_ZeroDisables(t *testing.T) {
+	msgs := make([]Message, 5000)
+	msgs[0].Content = strings.Repeat("x", 2<<20)
+	if err := (MessageLimits{}).Check(msgs); err != nil {
+		t.Fatalf("expected no limits, got %v", err)
+	}
+	if err := DefaultMessageLimits().Check(msgs); err == nil {
+		t.Fatal("expected the default limits to reject 5000 messages")
+	}
+}
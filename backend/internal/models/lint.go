@@ -0,0 +1,149 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LintSeverity says how bad a lint issue is: errors make a conversation unusable for
+// training, warnings make it suspect.
+type LintSeverity string
+
+const (
+	LintError   LintSeverity = "error"
+	LintWarning LintSeverity = "warning"
+)
+
+// LintIssue is one rule a conversation fails. Index is the offending message, or -1 when the
+// rule is about the conversation as a whole.
+type LintIssue struct {
+	Rule     string       `json:"rule"`
+	Severity LintSeverity `json:"severity"`
+	Index    int          `json:"index"`
+}
+
+type lintRule struct {
+	name     string
+	severity LintSeverity
+	// check reports whether msgs fail, with the offending message index (-1 for the whole
+	// conversation).
+	check func(msgs []Message) (idx int, failed bool)
+}
+
+// lintRules run in order; LintConversation reports at most one issue per rule.
+var lintRules = []lintRule{
+	{"empty_content", LintError, func(msgs []Message) (int, bool) {
+		for i, m := range msgs {
+			if strings.TrimSpace(m.Content) == "" {
+				return i, true
+			}
+		}
+		return 0, false
+	}},
+	{"no_user", LintError, func(msgs []Message) (int, bool) {
+		return -1, !hasRole(msgs, RoleUser)
+	}},
+	{"no_assistant", LintError, func(msgs []Message) (int, bool) {
+		return -1, !hasRole(msgs, RoleAssistant)
+	}},
+	{"not_ending_with_assistant", LintWarning, func(msgs []Message) (int, bool) {
+		if len(msgs) == 0 || msgs[len(msgs)-1].Role == RoleAssistant {
+			return 0, false
+		}
+		return len(msgs) - 1, true
+	}},
+	{"consecutive_same_role", LintWarning, func(msgs []Message) (int, bool) {
+		for i := 1; i < len(msgs); i++ {
+			if msgs[i].Role == msgs[i-1].Role && msgs[i].Role != RoleSystem {
+				return i, true
+			}
+		}
+		return 0, false
+	}},
+	{"system_not_first", LintWarning, func(msgs []Message) (int, bool) {
+		seenOther := false
+		for i, m := range msgs {
+			if m.Role != RoleSystem {
+				seenOther = true
+			} else if seenOther {
+				return i, true
+			}
+		}
+		return 0, false
+	}},
+}
+
+func hasRole(msgs []Message, role Role) bool {
+	for _, m := range msgs {
+		if m.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// LintConversation runs every lint rule over msgs, which are already loaded, so callers such
+// as the export loop need no extra query.
+func LintConversation(msgs []Message) []LintIssue {
+	var issues []LintIssue
+	for _, r := range lintRules {
+		if idx, failed := r.check(msgs); failed {
+			issues = append(issues, LintIssue{Rule: r.name, Severity: r.severity, Index: idx})
+		}
+	}
+	return issues
+}
+
+// ExportOptions.QualityGate values.
+const (
+	QualityGateOff     = "off"
+	QualityGateLenient = "lenient" // skip conversations with lint errors
+	QualityGateStrict  = "strict"  // skip conversations with any lint issue
+)
+
+// ParseQualityGate validates a quality_gate value; empty means off.
+func ParseQualityGate(s string) (string, error) {
+	switch g := strings.ToLower(strings.TrimSpace(s)); g {
+	case "", QualityGateOff:
+		return QualityGateOff, nil
+	case QualityGateLenient, QualityGateStrict:
+		return g, nil
+	default:
+		return "", fmt.Errorf("%w: quality_gate must be strict|lenient|off, got %q", ErrInvalidInput, s)
+	}
+}
+
+// QualityGateStats counts the conversations an export's quality gate skipped, in total and
+// per rule (a conversation failing two rules counts toward both).
+type QualityGateStats struct {
+	Gate     string           `json:"gate"`
+	Excluded int64            `json:"excluded"`
+	ByRule   map[string]int64 `json:"by_rule"`
+}
+
+// passesQualityGate reports whether a conversation with msgs may be exported under
+// opts.QualityGate, counting skipped ones in opts.GateStats when set.
+func passesQualityGate(msgs []Message, opts ExportOptions) bool {
+	if opts.QualityGate == "" || opts.QualityGate == QualityGateOff {
+		return true
+	}
+	var failed []string
+	for _, issue := range LintConversation(msgs) {
+		if opts.QualityGate == QualityGateStrict || issue.Severity == LintError {
+			failed = append(failed, issue.Rule)
+		}
+	}
+	if len(failed) == 0 {
+		return true
+	}
+	if st := opts.GateStats; st != nil {
+		st.Excluded++
+		if st.ByRule == nil {
+			st.ByRule = map[string]int64{}
+		}
+		for _, rule := range failed {
+			st.ByRule[rule]++
+		}
+	}
+	return false
+}
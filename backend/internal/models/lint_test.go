@@ -0,0 +1,81 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func lintRuleNames(issues []LintIssue) []string {
+	var names []string
+	for _, i := range issues {
+		names = append(names, i.Rule)
+	}
+	return names
+}
+
+func TestLintConversation(t *testing.T) {
+	clean := []Message{
+		{Role: RoleSystem, Content: "be brief"},
+		{Role: RoleUser, Content: "hi"},
+		{Role: RoleAssistant, Content: "hello"},
+	}
+	if issues := LintConversation(clean); len(issues) != 0 {
+		t.Fatalf("expected no issues, got %v", issues)
+	}
+
+	msgs := []Message{
+		{Role: RoleUser, Content: "hi"},
+		{Role: RoleUser, Content: "anyone?"},
+		{Role: RoleAssistant, Content: "  "},
+		{Role: RoleSystem, Content: "late"},
+	}
+	got := LintConversation(msgs)
+	want := []LintIssue{
+		{Rule: "empty_content", Severity: LintError, Index: 2},
+		{Rule: "not_ending_with_assistant", Severity: LintWarning, Index: 3},
+		{Rule: "consecutive_same_role", Severity: LintWarning, Index: 1},
+		{Rule: "system_not_first", Severity: LintWarning, Index: 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	if names := lintRuleNames(LintConversation([]Message{{Role: RoleUser, Content: "hi"}})); !reflect.DeepEqual(names, []string{"no_assistant", "not_ending_with_assistant"}) {
+		t.Fatalf("unexpected rules %v", names)
+	}
+}
+
+func TestPassesQualityGate(t *testing.T) {
+	warnOnly := []Message{{Role: RoleUser, Content: "hi"}, {Role: RoleAssistant, Content: "hello"}, {Role: RoleUser, Content: "bye"}}
+	broken := []Message{{Role: RoleUser, Content: "hi"}, {Role: RoleAssistant, Content: ""}}
+
+	if !passesQualityGate(broken, ExportOptions{}) {
+		t.Fatal("the gate is off by default")
+	}
+
+	st := &QualityGateStats{}
+	lenient := ExportOptions{QualityGate: QualityGateLenient, GateStats: st}
+	if !passesQualityGate(warnOnly, lenient) || passesQualityGate(broken, lenient) {
+		t.Fatal("lenient should skip only lint errors")
+	}
+	strict := ExportOptions{QualityGate: QualityGateStrict, GateStats: st}
+	if passesQualityGate(warnOnly, strict) {
+		t.Fatal("strict should skip warnings too")
+	}
+	want := map[string]int64{"empty_content": 1, "not_ending_with_assistant": 1}
+	if st.Excluded != 2 || !reflect.DeepEqual(st.ByRule, want) {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestParseQualityGate(t *testing.T) {
+	for in, want := range map[string]string{"": QualityGateOff, "off": QualityGateOff, "Strict": QualityGateStrict, "lenient": QualityGateLenient} {
+		if got, err := ParseQualityGate(in); err != nil || got != want {
+			t.Fatalf("%q: expected %q, got %q %v", in, want, got, err)
+		}
+	}
+	if _, err := ParseQualityGate("hard"); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected ErrInvalidInput, got %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// DatasetLockedError reports an edit refused because the dataset is locked. It matches
+// ErrLocked with errors.Is.
+type DatasetLockedError struct {
+	DatasetID int64
+	Lock      DatasetLock
+}
+
+func (e *DatasetLockedError) Error() string {
+	return fmt.Sprintf("dataset %d is locked by %s", e.DatasetID, e.Lock.By)
+}
+
+func (e *DatasetLockedError) Unwrap() error { return ErrLocked }
+
+// lockedSQLState is the SQLSTATE the dataset lock triggers (migration 036) raise when a
+// statement touches a locked dataset; the error detail carries the lock as JSON.
+const lockedSQLState = "DL423"
+
+// AsLockedError returns err as a *DatasetLockedError, converting a write the lock triggers
+// refused. It returns nil for any other error.
+func AsLockedError(err error) *DatasetLockedError {
+	var le *DatasetLockedError
+	if errors.As(err, &le) {
+		return le
+	}
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != lockedSQLState {
+		return nil
+	}
+	var detail struct {
+		DatasetID int64      `json:"dataset_id"`
+		By        string     `json:"by"`
+		At        time.Time  `json:"at"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	_ = json.Unmarshal([]byte(pgErr.Detail), &detail)
+	return &DatasetLockedError{
+		DatasetID: detail.DatasetID,
+		Lock:      DatasetLock{By: detail.By, At: detail.At, ExpiresAt: detail.ExpiresAt},
+	}
+}
+
+// setLock fills d.Lock from the locked_by/locked_at/lock_expires_at columns, leaving it nil
+// when unlocked or expired.
+func (d *Dataset) setLock(by string, at, expiresAt *time.Time) {
+	d.Lock = nil
+	if at == nil {
+		return
+	}
+	l := &DatasetLock{By: by, At: *at, ExpiresAt: expiresAt}
+	if l.Active(time.Now()) {
+		d.Lock = l
+	}
+}
+
+// LockDataset freezes conversation and item edits in dataset id on behalf of by. ttl > 0
+// makes the lock expire on its own. Re-locking by the same name refreshes the lock; a live
+// lock held by someone else yields ErrLocked.
+func LockDataset(ctx context.Context, db *sql.DB, id int64, by string, ttl time.Duration) (Dataset, error) {
+	by = strings.TrimSpace(by)
+	if by == "" {
+		return Dataset{}, fmt.Errorf("%w: locked_by required", ErrInvalidInput)
+	}
+	if ttl < 0 {
+		return Dataset{}, fmt.Errorf("%w: ttl must not be negative", ErrInvalidInput)
+	}
+	now := time.Now().UTC()
+	var expiresAt *time.Time
+	if ttl > 0 {
+		t := now.Add(ttl)
+		expiresAt = &t
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return Dataset{}, err
+	}
+	defer tx.Rollback()
+
+	var cur Dataset
+	var curBy string
+	var curAt, curExpires *time.Time
+	if err := tx.QueryRowContext(ctx, `
+SELECT locked_by, locked_at, lock_expires_at FROM datasets WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+`, id).Scan(&curBy, &curAt, &curExpires); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Dataset{}, ErrNotFound
+		}
+		return Dataset{}, err
+	}
+	cur.setLock(curBy, curAt, curExpires)
+	if cur.Lock != nil && cur.Lock.By != by {
+		return Dataset{}, &DatasetLockedError{DatasetID: id, Lock: *cur.Lock}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+UPDATE datasets SET locked_by = $2, locked_at = $3, lock_expires_at = $4 WHERE id = $1
+`, id, by, now, expiresAt); err != nil {
+		return Dataset{}, err
+	}
+	detail, _ := json.Marshal(map[string]any{"by": by, "expires_at": expiresAt})
+	if err := insertAuditEntry(ctx, tx, "dataset", id, "lock", detail); err != nil {
+		return Dataset{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Dataset{}, err
+	}
+	return GetDataset(ctx, db, id)
+}
+
+// UnlockDataset clears the lock on dataset id; unlocking an unlocked dataset is a no-op.
+func UnlockDataset(ctx context.Context, db *sql.DB, id int64) (Dataset, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return Dataset{}, err
+	}
+	defer tx.Rollback()
+
+	var by string
+	if err := tx.QueryRowContext(ctx, `
+UPDATE datasets d SET locked_by = '', locked_at = NULL, lock_expires_at = NULL
+FROM (SELECT id, locked_by FROM datasets WHERE id = $1 AND deleted_at IS NULL FOR UPDATE) old
+WHERE d.id = old.id
+RETURNING old.locked_by
+`, id).Scan(&by); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Dataset{}, ErrNotFound
+		}
+		return Dataset{}, err
+	}
+	if by != "" {
+		detail, _ := json.Marshal(map[string]string{"by": by})
+		if err := insertAuditEntry(ctx, tx, "dataset", id, "unlock", detail); err != nil {
+			return Dataset{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Dataset{}, err
+	}
+	return GetDataset(ctx, db, id)
+}
+
+// GetConversationDatasetID returns the dataset a conversation belongs to.
+func GetConversationDatasetID(ctx context.Context, db *sql.DB, id int64) (int64, error) {
+	return lookupDatasetID(ctx, db, `SELECT dataset_id FROM conversations WHERE id = $1`, id)
+}
+
+// GetDatasetItemDatasetID returns the dataset an item belongs to.
+func GetDatasetItemDatasetID(ctx context.Context, db *sql.DB, id int64) (int64, error) {
+	return lookupDatasetID(ctx, db, `SELECT dataset_id FROM dataset_items WHERE id = $1`, id)
+}
+
+func lookupDatasetID(ctx context.Context, db *sql.DB, query string, id int64) (int64, error) {
+	var datasetID int64
+	if err := db.QueryRowContext(ctx, query, id).Scan(&datasetID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+	return datasetID, nil
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestSetLock_DropsExpiredLocks(t *testing.T) {
+	at := time.Now().Add(-time.Hour)
+	var d Dataset
+
+	d.setLock("", nil, nil)
+	if d.Lock != nil {
+		t.Fatalf("expected no lock without locked_at, got %+v", d.Lock)
+	}
+
+	d.setLock("run-1", &at, nil)
+	if d.Lock == nil || d.Lock.By != "run-1" {
+		t.Fatalf("expected a lock without expiry, got %+v", d.Lock)
+	}
+
+	future := time.Now().Add(time.Hour)
+	d.setLock("run-1", &at, &future)
+	if !d.Lock.Active(time.Now()) || d.Lock.Active(future.Add(time.Second)) {
+		t.Fatalf("expected the lock to hold until expires_at, got %+v", d.Lock)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	d.setLock("run-1", &at, &past)
+	if d.Lock != nil {
+		t.Fatalf("expected an expired lock to read as unlocked, got %+v", d.Lock)
+	}
+}
+
+func TestDatasetLockedError_IsErrLocked(t *testing.T) {
+	err := error(&DatasetLockedError{DatasetID: 3, Lock: DatasetLock{By: "run-1"}})
+	if !errors.Is(err, ErrLocked) || err.Error() != "dataset 3 is locked by run-1" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestAsLockedError_ConvertsTriggerRefusal(t *testing.T) {
+	pgErr := &pgconn.PgError{
+		Code:    lockedSQLState,
+		Message: "dataset 3 is locked by run-1",
+		Detail:  `{"dataset_id" : 3, "by" : "run-1", "at" : "2026-10-16T09:30:00.5+00:00", "expires_at" : null}`,
+	}
+	le := AsLockedError(fmt.Errorf("insert messages: %w", pgErr))
+	if le == nil || le.DatasetID != 3 || le.Lock.By != "run-1" || le.Lock.At.IsZero() || le.Lock.ExpiresAt != nil {
+		t.Fatalf("expected the lock from the detail, got %+v", le)
+	}
+	if !errors.Is(le, ErrLocked) {
+		t.Fatalf("expected a DatasetLockedError, got %v", le)
+	}
+
+	if AsLockedError(&pgconn.PgError{Code: "23505"}) != nil || AsLockedError(errors.New("boom")) != nil {
+		t.Fatalf("expected other errors to pass through")
+	}
+	direct := &DatasetLockedError{DatasetID: 4}
+	if AsLockedError(direct) != direct {
+		t.Fatalf("expected a DatasetLockedError to be returned as is")
+	}
+}
@@ -0,0 +1,221 @@
+package models
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+type ExportManifest struct {
+	GeneratedAt time.Time         `json:"generated_at"`
+	Dataset     *Dataset          `json:"dataset,omitempty"`
+	Filters     ExportOptions     `json:"filters"`
+	Data        ExportDataSummary `json:"data"`
+	Totals      ConversationStats `json:"totals"`
+
+	// QualityGate reports what quality_gate excluded; omitted when the gate is off.
+	QualityGate *QualityGateStats `json:"quality_gate,omitempty"`
+
+	// Dedup reports what dedup dropped; omitted without dedup.
+	Dedup *DedupStats `json:"dedup,omitempty"`
+}
+
+type ExportDataSummary struct {
+	File   string `json:"file"`
+	Lines  int64  `json:"lines"` // pairs for type=pairs, rows otherwise
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+
+	// Truncated is set when the server-side row cap stopped the export.
+	Truncated bool `json:"truncated,omitempty"`
+
+	// Splits holds the lines emitted per split when a split=all export was stratified.
+	Splits map[string]int64 `json:"splits,omitempty"`
+}
+
+// StreamExportWithManifest writes a zip archive holding data.jsonl (the regular export
+// stream) and manifest.json describing what was exported.
+func StreamExportWithManifest(ctx context.Context, db *sql.DB, w io.Writer, opts ExportOptions) error {
+	m := ExportManifest{GeneratedAt: time.Now().UTC(), Filters: opts}
+	opts.GateStats = newGateStats(opts)
+	m.QualityGate = opts.GateStats
+	opts.DedupStats = newDedupStats(opts)
+	m.Dedup = opts.DedupStats
+	if opts.Split == "all" {
+		opts.SplitLines = map[string]int64{}
+	}
+	if opts.DatasetID > 0 {
+		ds, err := GetDataset(ctx, db, opts.DatasetID)
+		if err != nil {
+			return err
+		}
+		m.Dataset = &ds
+	}
+
+	totals, err := GetConversationStats(ctx, db, opts.DatasetID, opts.PublicOnly, opts.ProjectID)
+	if err != nil {
+		return err
+	}
+	m.Totals = totals
+
+	zw := zip.NewWriter(w)
+	data, err := zw.Create("data.jsonl")
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	cw := &LineCounter{}
+	var truncated bool
+	opts.Truncated = &truncated
+	if err := StreamExport(ctx, db, io.MultiWriter(data, h, cw), opts); err != nil {
+		return err
+	}
+	m.Data = ExportDataSummary{
+		File:   "data.jsonl",
+		Lines:  cw.Lines,
+		Bytes:  cw.Bytes,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+
+		Truncated: truncated,
+		Splits:    opts.SplitLines,
+	}
+
+	mf, err := zw.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(mf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// newGateStats returns the stats an export with opts should fill, or nil when the quality
+// gate is off.
+func newGateStats(opts ExportOptions) *QualityGateStats {
+	if opts.QualityGate == "" || opts.QualityGate == QualityGateOff {
+		return nil
+	}
+	return &QualityGateStats{Gate: opts.QualityGate, ByRule: map[string]int64{}}
+}
+
+// LineCounter is an io.Writer that counts the lines and bytes written to it.
+type LineCounter struct {
+	Lines int64
+	Bytes int64
+}
+
+func (c *LineCounter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b == '\n' {
+			c.Lines++
+		}
+	}
+	c.Bytes += int64(len(p))
+	return len(p), nil
+}
+
+// ExportFile is one dataset's file in a grouped (group_by=dataset) archive.
+type ExportFile struct {
+	File      string `json:"file"`
+	DatasetID int64  `json:"dataset_id"`
+	Dataset   string `json:"dataset"`
+	Lines     int64  `json:"lines"`
+	Bytes     int64  `json:"bytes"`
+	SHA256    string `json:"sha256"`
+}
+
+type GroupedExportManifest struct {
+	GeneratedAt time.Time     `json:"generated_at"`
+	Filters     ExportOptions `json:"filters"`
+	Files       []ExportFile  `json:"files"`
+
+	// Truncated is set when the server-side row cap stopped the export.
+	Truncated bool `json:"truncated,omitempty"`
+
+	// QualityGate reports what quality_gate excluded across all files.
+	QualityGate *QualityGateStats `json:"quality_gate,omitempty"`
+
+	// Dedup reports what dedup dropped across all files.
+	Dedup *DedupStats `json:"dedup,omitempty"`
+}
+
+// StreamGroupedExport writes a zip archive with one file per entry of files (File, DatasetID
+// and Dataset filled in by the caller) plus manifest.json mapping the files to datasets.
+// MaxExamples and RowCap bound the archive as a whole, not each file.
+func StreamGroupedExport(ctx context.Context, db *sql.DB, w io.Writer, opts ExportOptions, files []ExportFile) error {
+	m := GroupedExportManifest{GeneratedAt: time.Now().UTC(), Filters: opts, Files: files}
+	opts.GateStats = newGateStats(opts)
+	m.QualityGate = opts.GateStats
+	opts.DedupStats = newDedupStats(opts)
+	m.Dedup = opts.DedupStats
+	if opts.Dedup != "" {
+		// One deduper for the whole archive, so duplicates across datasets are dropped too.
+		opts.dedup = newPairDeduper(ctx, db, opts)
+	}
+	limit, capped := opts.EffectiveMaxExamples()
+
+	zw := zip.NewWriter(w)
+	var total int64
+	for i := range m.Files {
+		f := &m.Files[i]
+		data, err := zw.Create(f.File)
+		if err != nil {
+			return err
+		}
+		fileOpts := opts
+		fileOpts.DatasetID = f.DatasetID
+		fileOpts.RowCap = 0
+		fileOpts.MaxExamples = 0
+		if limit > 0 {
+			if total >= int64(limit) {
+				// The archive still lists the dataset, with an empty file.
+				f.SHA256 = hex.EncodeToString(sha256.New().Sum(nil))
+				if capped && !m.Truncated {
+					// The cap was met exactly so far; it cut the archive short only if this
+					// dataset had anything left to export.
+					probe := fileOpts
+					probe.MaxExamples, probe.GateStats, probe.DedupStats = 1, nil, nil
+					pc := &LineCounter{}
+					if err := StreamExport(ctx, db, pc, probe); err != nil {
+						return err
+					}
+					m.Truncated = pc.Lines > 0
+				}
+				continue
+			}
+			if capped {
+				fileOpts.RowCap = limit - int(total)
+				fileOpts.Truncated = &m.Truncated
+			} else {
+				fileOpts.MaxExamples = limit - int(total)
+			}
+		}
+
+		h := sha256.New()
+		cw := &LineCounter{}
+		if err := StreamExport(ctx, db, io.MultiWriter(data, h, cw), fileOpts); err != nil {
+			return err
+		}
+		f.Lines, f.Bytes, f.SHA256 = cw.Lines, cw.Bytes, hex.EncodeToString(h.Sum(nil))
+		total += cw.Lines
+	}
+
+	mf, err := zw.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(mf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		return err
+	}
+	return zw.Close()
+}
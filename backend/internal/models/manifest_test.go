@@ -0,0 +1,54 @@
+package models
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLineCounter(t *testing.T) {
+	c := &LineCounter{}
+	for _, chunk := range []string{`{"a":1}` + "\n" + `{"a"`, `:2}` + "\n", "", `{"a":3}` + "\n"} {
+		if _, err := io.WriteString(c, chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.Lines != 3 || c.Bytes != 24 {
+		t.Fatalf("expected 3 lines and 24 bytes, got %d and %d", c.Lines, c.Bytes)
+	}
+}
+
+func TestNewGateStats(t *testing.T) {
+	for _, gate := range []string{"", QualityGateOff} {
+		if st := newGateStats(ExportOptions{QualityGate: gate}); st != nil {
+			t.Fatalf("gate %q: expected no stats, got %+v", gate, st)
+		}
+	}
+	st := newGateStats(ExportOptions{QualityGate: QualityGateStrict})
+	if st == nil || st.Gate != QualityGateStrict || st.ByRule == nil {
+		t.Fatalf("expected strict stats with a rule map, got %+v", st)
+	}
+}
+
+func TestExportManifest_JSON(t *testing.T) {
+	m := ExportManifest{
+		Filters: ExportOptions{Type: ExportTypePairs, DatasetID: 3, Split: "train", Status: "approved"},
+		Data:    ExportDataSummary{File: "data.jsonl", Lines: 2, Bytes: 10, SHA256: "ab"},
+	}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(raw)
+	for _, want := range []string{`"type":"pairs"`, `"dataset_id":3`, `"split":"train"`, `"file":"data.jsonl"`, `"lines":2`, `"sha256":"ab"`} {
+		if !strings.Contains(s, want) {
+			t.Fatalf("manifest is missing %s: %s", want, s)
+		}
+	}
+	for _, absent := range []string{`"dataset":`, `"quality_gate":`, `"dedup":`, `"truncated"`} {
+		if strings.Contains(s, absent) {
+			t.Fatalf("manifest should omit %s: %s", absent, s)
+		}
+	}
+}
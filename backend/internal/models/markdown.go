@@ -0,0 +1,99 @@
+package models
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// StreamMarkdownTranscripts writes a zip archive with one Markdown transcript per exported
+// conversation, named conversation-<id>.md. It runs the regular type=conversations export,
+// so every filter and limit applies, and renders each line as it is produced.
+func StreamMarkdownTranscripts(ctx context.Context, db *sql.DB, w io.Writer, opts ExportOptions) error {
+	opts.Type = "conversations"
+	mw := &markdownZipWriter{zw: zip.NewWriter(w)}
+	if err := StreamExport(ctx, db, mw, opts); err != nil {
+		return err
+	}
+	return mw.Close()
+}
+
+// markdownZipWriter turns the type=conversations JSONL written to it into zip entries.
+type markdownZipWriter struct {
+	zw  *zip.Writer
+	buf []byte
+}
+
+func (m *markdownZipWriter) Write(p []byte) (int, error) {
+	m.buf = append(m.buf, p...)
+	for {
+		i := bytes.IndexByte(m.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := m.buf[:i]
+		m.buf = m.buf[i+1:]
+		if err := m.writeLine(line); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Close renders a final unterminated line, if any, and finishes the archive.
+func (m *markdownZipWriter) Close() error {
+	if len(bytes.TrimSpace(m.buf)) > 0 {
+		if err := m.writeLine(m.buf); err != nil {
+			return err
+		}
+	}
+	m.buf = nil
+	return m.zw.Close()
+}
+
+func (m *markdownZipWriter) writeLine(line []byte) error {
+	var c ExportConversation
+	if err := json.Unmarshal(line, &c); err != nil {
+		return fmt.Errorf("markdown transcript: %w", err)
+	}
+	f, err := m.zw.Create(fmt.Sprintf("conversation-%d.md", c.ID))
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, MarkdownTranscript(c))
+	return err
+}
+
+// MarkdownTranscript renders c for human readers: a front-matter block with its id, split,
+// status, source and tags, then a "## User" / "## Assistant" section per message.
+func MarkdownTranscript(c ExportConversation) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "id: %d\n", c.ID)
+	fmt.Fprintf(&b, "split: %s\n", yamlString(c.Split))
+	fmt.Fprintf(&b, "status: %s\n", yamlString(c.Status))
+	fmt.Fprintf(&b, "source: %s\n", yamlString(c.Source))
+	tags := c.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	// JSON arrays and strings are valid YAML flow values and escape everything for us.
+	tagsJSON, _ := json.Marshal(tags)
+	fmt.Fprintf(&b, "tags: %s\n", tagsJSON)
+	b.WriteString("---\n")
+	for _, msg := range c.Messages {
+		fmt.Fprintf(&b, "\n## %s\n\n", strings.TrimSuffix(roleLabel(msg.Role), ": "))
+		b.WriteString(strings.TrimSpace(msg.Content))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func yamlString(s string) string {
+	out, _ := json.Marshal(s)
+	return string(out)
+}
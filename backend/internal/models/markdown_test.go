@@ -0,0 +1,80 @@
+package models
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestMarkdownTranscript(t *testing.T) {
+	got := MarkdownTranscript(ExportConversation{
+		ID:     7,
+		Split:  "train",
+		Status: "approved",
+		Tags:   []string{"support", `say "hi"`},
+		Source: "community: forum",
+		Messages: []Message{
+			{Role: RoleSystem, Content: "Be brief."},
+			{Role: RoleUser, Content: "Hi?\n"},
+			{Role: RoleAssistant, Content: "Hello."},
+		},
+	})
+	want := `---
+id: 7
+split: "train"
+status: "approved"
+source: "community: forum"
+tags: ["support","say \"hi\""]
+---
+
+## System
+
+Be brief.
+
+## User
+
+Hi?
+
+## Assistant
+
+Hello.
+`
+	if got != want {
+		t.Fatalf("unexpected transcript:\n%s", got)
+	}
+}
+
+func TestMarkdownZipWriter(t *testing.T) {
+	var out bytes.Buffer
+	mw := &markdownZipWriter{zw: zip.NewWriter(&out)}
+	// Lines may arrive split across writes; the last one unterminated.
+	for _, chunk := range []string{
+		`{"id":1,"split":"train","messages":[{"role":"user","content":"a"}]}` + "\n" + `{"id":`,
+		`2,"split":"valid","messages":[]}`,
+	} {
+		if _, err := mw.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 2 || zr.File[0].Name != "conversation-1.md" || zr.File[1].Name != "conversation-2.md" {
+		t.Fatalf("unexpected entries: %v", zr.File)
+	}
+	rc, err := zr.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	body, _ := io.ReadAll(rc)
+	if !bytes.Contains(body, []byte("## User\n\na\n")) {
+		t.Fatalf("unexpected body: %s", body)
+	}
+}
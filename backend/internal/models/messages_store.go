@@ -3,14 +3,18 @@ package models
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 )
 
 func loadMessages(ctx context.Context, db *sql.DB, conversationID int64) ([]Message, error) {
 	rows, err := db.QueryContext(ctx, `
-SELECT role, name, content, meta
+SELECT id, role, name, content, meta
 FROM conversation_messages
 WHERE conversation_id = $1
-ORDER BY idx ASC
+ORDER BY idx ASC, id ASC
 `, conversationID)
 	if err != nil {
 		return nil, err
@@ -19,14 +23,337 @@ ORDER BY idx ASC
 
 	var out []Message
 	for rows.Next() {
+		var id int64
 		var role string
 		var name string
 		var content string
 		var meta []byte
-		if err := rows.Scan(&role, &name, &content, &meta); err != nil {
+		if err := rows.Scan(&id, &role, &name, &content, &meta); err != nil {
 			return nil, err
 		}
-		out = append(out, Message{Role: Role(role), Name: name, Content: content, Meta: meta})
+		out = append(out, Message{ID: id, Role: Role(role), Name: name, Content: content, Meta: meta})
 	}
 	return out, rows.Err()
 }
+
+// loadMessagesByConversation is loadMessages for many conversations in one query, keyed by
+// conversation id.
+func loadMessagesByConversation(ctx context.Context, db *sql.DB, conversationIDs []int64) (map[int64][]Message, error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT conversation_id, id, role, name, content, meta
+FROM conversation_messages
+WHERE conversation_id = ANY($1)
+ORDER BY conversation_id ASC, idx ASC, id ASC
+`, conversationIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[int64][]Message{}
+	for rows.Next() {
+		var conversationID, id int64
+		var role string
+		var name string
+		var content string
+		var meta []byte
+		if err := rows.Scan(&conversationID, &id, &role, &name, &content, &meta); err != nil {
+			return nil, err
+		}
+		out[conversationID] = append(out[conversationID], Message{ID: id, Role: Role(role), Name: name, Content: content, Meta: meta})
+	}
+	return out, rows.Err()
+}
+
+// UpdateMessageParams describes a single-message edit. Zero values leave the field unchanged.
+type UpdateMessageParams struct {
+	Role    Role
+	Content *string
+	Meta    json.RawMessage
+}
+
+// UpdateMessage edits the message at idx in place; the conversation_messages triggers bump
+// the conversation's updated_at and messages_updated_at.
+// Content may only be emptied while the conversation is a draft.
+func UpdateMessage(ctx context.Context, db *sql.DB, conversationID int64, idx int, p UpdateMessageParams) (Conversation, error) {
+	if p.Role != "" && !validRole(p.Role) {
+		return Conversation{}, fmt.Errorf("%w: invalid role", ErrInvalidInput)
+	}
+	if len(p.Meta) > 0 && !json.Valid(p.Meta) {
+		return Conversation{}, fmt.Errorf("%w: invalid meta", ErrInvalidInput)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return Conversation{}, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	if err := tx.QueryRowContext(ctx, `SELECT status FROM conversations WHERE id = $1 FOR UPDATE`, conversationID).Scan(&status); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Conversation{}, ErrNotFound
+		}
+		return Conversation{}, err
+	}
+
+	var content *string
+	if p.Content != nil {
+		c := strings.TrimSpace(*p.Content)
+		if c == "" && ConversationStatus(status) != ConversationStatusDraft {
+			return Conversation{}, fmt.Errorf("%w: message content cannot be empty", ErrInvalidInput)
+		}
+		content = &c
+	}
+	var meta []byte
+	if len(p.Meta) > 0 && string(p.Meta) != "null" {
+		meta = p.Meta
+	}
+
+	res, err := tx.ExecContext(ctx, `
+UPDATE conversation_messages
+SET role = COALESCE(NULLIF($3::text, ''), role),
+    content = COALESCE($4, content),
+    meta = COALESCE($5::jsonb, meta)
+WHERE conversation_id = $1 AND idx = $2
+`, conversationID, idx, string(p.Role), content, meta)
+	if err != nil {
+		return Conversation{}, err
+	}
+	a, err := res.RowsAffected()
+	if err != nil {
+		return Conversation{}, err
+	}
+	if a == 0 {
+		return Conversation{}, ErrNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Conversation{}, err
+	}
+	return GetConversation(ctx, db, conversationID)
+}
+
+func validRole(r Role) bool {
+	switch r {
+	case RoleSystem, RoleUser, RoleAssistant:
+		return true
+	default:
+		return false
+	}
+}
+
+// AppendMessage adds m after the conversation's last message (bumping updated_at). With
+// strict set, m must keep user/assistant turns alternating (see AllowsNextRole); with
+// maxMessages > 0, a conversation already that long gets a LimitError.
+func AppendMessage(ctx context.Context, db *sql.DB, conversationID int64, m Message, strict bool, maxMessages int) (Conversation, error) {
+	if !validRole(m.Role) {
+		return Conversation{}, fmt.Errorf("%w: invalid role", ErrInvalidInput)
+	}
+	if len(m.Meta) == 0 || string(m.Meta) == "null" {
+		m.Meta = json.RawMessage("{}")
+	} else if !json.Valid(m.Meta) {
+		return Conversation{}, fmt.Errorf("%w: invalid meta", ErrInvalidInput)
+	}
+	m.Content = strings.TrimSpace(m.Content)
+	m.Name = strings.TrimSpace(m.Name)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return Conversation{}, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	if err := tx.QueryRowContext(ctx, `SELECT status FROM conversations WHERE id = $1 FOR UPDATE`, conversationID).Scan(&status); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Conversation{}, ErrNotFound
+		}
+		return Conversation{}, err
+	}
+	if m.Content == "" && ConversationStatus(status) != ConversationStatusDraft {
+		return Conversation{}, fmt.Errorf("%w: message content cannot be empty", ErrInvalidInput)
+	}
+
+	var next, count int
+	var lastRole sql.NullString
+	if err := tx.QueryRowContext(ctx, `
+SELECT COALESCE(MAX(idx) + 1, 0), COUNT(*),
+       (SELECT role FROM conversation_messages WHERE conversation_id = $1 ORDER BY idx DESC, id DESC LIMIT 1)
+FROM conversation_messages
+WHERE conversation_id = $1
+`, conversationID).Scan(&next, &count, &lastRole); err != nil {
+		return Conversation{}, err
+	}
+	if err := (MessageLimits{MaxMessages: maxMessages}).CheckCount(count + 1); err != nil {
+		return Conversation{}, err
+	}
+	if strict && !AllowsNextRole(Role(lastRole.String), m.Role) {
+		return Conversation{}, fmt.Errorf("%w: %s message cannot follow %s in strict alternation mode", ErrInvalidInput, m.Role, roleOrStart(lastRole.String))
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO conversation_messages (conversation_id, idx, role, name, content, meta)
+VALUES ($1, $2, $3, $4, $5, $6)
+`, conversationID, next, m.Role, m.Name, m.Content, m.Meta); err != nil {
+		return Conversation{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Conversation{}, err
+	}
+	return GetConversation(ctx, db, conversationID)
+}
+
+// messageInsertBatch is how many messages go into one INSERT; 6 parameters per row keeps
+// every statement well under Postgres's 65535-parameter limit.
+const messageInsertBatch = 1000
+
+// insertConversationMessages stores msgs as idx 0..n-1 of conversationID using one
+// multi-row INSERT per messageInsertBatch messages. Name and content are trimmed and an
+// empty meta is stored as {}.
+func insertConversationMessages(ctx context.Context, tx *sql.Tx, conversationID int64, msgs []Message) error {
+	for start := 0; start < len(msgs); start += messageInsertBatch {
+		end := min(start+messageInsertBatch, len(msgs))
+		query, args := messageInsertQuery(conversationID, start, msgs[start:end])
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// messageInsertQuery builds the INSERT for msgs, numbering them from firstIdx.
+func messageInsertQuery(conversationID int64, firstIdx int, msgs []Message) (string, []any) {
+	var b strings.Builder
+	b.WriteString("INSERT INTO conversation_messages (conversation_id, idx, role, name, content, meta)\nVALUES ")
+	args := make([]any, 0, len(msgs)*6)
+	for i, m := range msgs {
+		meta := m.Meta
+		if len(meta) == 0 {
+			meta = json.RawMessage("{}")
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		n := len(args)
+		fmt.Fprintf(&b, "($%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6)
+		args = append(args, conversationID, firstIdx+i, m.Role, strings.TrimSpace(m.Name), strings.TrimSpace(m.Content), meta)
+	}
+	return b.String(), args
+}
+
+// ReindexResult counts what a reindex renumbered.
+type ReindexResult struct {
+	Conversations int64 `json:"conversations_reindexed"`
+	Messages      int64 `json:"messages_reindexed"`
+}
+
+// ReindexConversationMessages rewrites the conversation's message idx values to a dense
+// 0..n-1 sequence, keeping the current (idx, id) order. Conversations that are already
+// dense are left alone.
+func ReindexConversationMessages(ctx context.Context, db *sql.DB, conversationID int64) (ReindexResult, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return ReindexResult{}, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	if err := tx.QueryRowContext(ctx, `SELECT id FROM conversations WHERE id = $1 FOR UPDATE`, conversationID).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ReindexResult{}, ErrNotFound
+		}
+		return ReindexResult{}, err
+	}
+	res, err := reindexMessages(ctx, tx, `SELECT $1::bigint`, conversationID)
+	if err != nil {
+		return ReindexResult{}, err
+	}
+	return res, tx.Commit()
+}
+
+// ReindexDatasetMessages is ReindexConversationMessages for every conversation in a dataset,
+// in one transaction.
+func ReindexDatasetMessages(ctx context.Context, db *sql.DB, datasetID int64) (ReindexResult, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return ReindexResult{}, err
+	}
+	defer tx.Rollback()
+
+	res, err := reindexMessages(ctx, tx, `SELECT id FROM conversations WHERE dataset_id = $1`, datasetID)
+	if err != nil {
+		return ReindexResult{}, err
+	}
+	return res, tx.Commit()
+}
+
+// idxNotDenseSQL is the HAVING condition, over one conversation's messages, for idx values
+// that are not 0..n-1: a gap or offset start, or duplicates such as 0,1,1,3 whose bounds
+// look dense. Migration 021 repairs with the same condition.
+const idxNotDenseSQL = `MIN(idx) <> 0 OR MAX(idx) <> COUNT(*) - 1 OR COUNT(DISTINCT idx) <> COUNT(*)`
+
+// reindexMessages renumbers the messages of the conversations selected by scope (a query
+// over $1 returning conversation ids) whose idx values are not already 0..n-1. It runs in
+// two steps so the unique (conversation_id, idx) constraint holds after each: first every
+// affected idx is flipped negative (-1 - idx, reversing the order), then the rows are
+// numbered from 0 in their original (idx, id) order.
+func reindexMessages(ctx context.Context, tx *sql.Tx, scope string, arg int64) (ReindexResult, error) {
+	var res ReindexResult
+	if err := tx.QueryRowContext(ctx, `
+WITH flipped AS (
+  UPDATE conversation_messages
+  SET idx = -1 - idx
+  WHERE conversation_id IN (
+    SELECT conversation_id
+    FROM conversation_messages
+    WHERE conversation_id IN (`+scope+`)
+    GROUP BY conversation_id
+    HAVING `+idxNotDenseSQL+`
+  )
+  RETURNING conversation_id
+)
+SELECT COUNT(DISTINCT conversation_id), COUNT(*) FROM flipped
+`, arg).Scan(&res.Conversations, &res.Messages); err != nil {
+		return ReindexResult{}, err
+	}
+	if res.Messages == 0 {
+		return res, nil
+	}
+	if _, err := tx.ExecContext(ctx, `
+UPDATE conversation_messages m
+SET idx = r.n
+FROM (
+  SELECT id, row_number() OVER (PARTITION BY conversation_id ORDER BY idx DESC, id ASC) - 1 AS n
+  FROM conversation_messages
+  WHERE idx < 0 AND conversation_id IN (`+scope+`)
+) r
+WHERE m.id = r.id
+`, arg); err != nil {
+		return ReindexResult{}, err
+	}
+	return res, nil
+}
+
+// AllowsNextRole reports whether next may follow last under strict alternation: system
+// messages only lead the conversation, then user and assistant turns alternate starting
+// with user. last is "" for an empty conversation.
+func AllowsNextRole(last, next Role) bool {
+	switch next {
+	case RoleSystem:
+		return last == "" || last == RoleSystem
+	case RoleUser:
+		return last == "" || last == RoleSystem || last == RoleAssistant
+	case RoleAssistant:
+		return last == RoleUser
+	default:
+		return false
+	}
+}
+
+func roleOrStart(role string) string {
+	if role == "" {
+		return "start of conversation"
+	}
+	return role
+}
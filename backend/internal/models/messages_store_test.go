@@ -0,0 +1,239 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestAllowsNextRole(t *testing.T) {
+	cases := []struct {
+		last, next Role
+		want       bool
+	}{
+		{"", RoleSystem, true},
+		{"", RoleUser, true},
+		{"", RoleAssistant, false},
+		{RoleSystem, RoleSystem, true},
+		{RoleSystem, RoleUser, true},
+		{RoleUser, RoleAssistant, true},
+		{RoleUser, RoleUser, false},
+		{RoleUser, RoleSystem, false},
+		{RoleAssistant, RoleUser, true},
+		{RoleAssistant, RoleAssistant, false},
+	}
+	for _, tc := range cases {
+		if got := AllowsNextRole(tc.last, tc.next); got != tc.want {
+			t.Fatalf("AllowsNextRole(%q, %q) = %v, want %v", tc.last, tc.next, got, tc.want)
+		}
+	}
+}
+
+// legacyMessageRows is the per-message argument list the old one-INSERT-per-message loop used.
+func legacyMessageRows(conversationID int64, msgs []Message) [][]any {
+	var out [][]any
+	for idx, m := range msgs {
+		meta := m.Meta
+		if len(meta) == 0 {
+			meta = json.RawMessage("{}")
+		}
+		out = append(out, []any{conversationID, idx, m.Role, strings.TrimSpace(m.Name), strings.TrimSpace(m.Content), meta})
+	}
+	return out
+}
+
+func TestMessageInsertQuery_MatchesPerRowInserts(t *testing.T) {
+	msgs := []Message{
+		{Role: RoleSystem, Content: "  be brief  "},
+		{Role: RoleUser, Name: " alice ", Content: "hi", Meta: json.RawMessage(`{"k":1}`)},
+		{Role: RoleAssistant, Content: "hello\n"},
+	}
+	query, args := messageInsertQuery(42, 0, msgs)
+	if !strings.Contains(query, "($13, $14, $15, $16, $17, $18)") || strings.Count(query, "(") != 4 {
+		t.Fatalf("unexpected query: %s", query)
+	}
+	var rows [][]any
+	for i := 0; i < len(args); i += 6 {
+		rows = append(rows, args[i:i+6])
+	}
+	if want := legacyMessageRows(42, msgs); !reflect.DeepEqual(rows, want) {
+		t.Fatalf("rows differ from per-row inserts:\n got %v\nwant %v", rows, want)
+	}
+
+	_, args = messageInsertQuery(42, 1000, msgs[:1])
+	if args[1] != 1000 {
+		t.Fatalf("expected idx to start at firstIdx, got %v", args[1])
+	}
+}
+
+// execCounter is a database/sql driver that accepts every statement and counts them, so
+// insert paths can be measured without Postgres.
+type execCounter struct{ statements int }
+
+func (c *execCounter) Connect(context.Context) (driver.Conn, error) { return execCounterConn{c}, nil }
+func (c *execCounter) Driver() driver.Driver                        { return nil }
+
+type execCounterConn struct{ c *execCounter }
+
+func (execCounterConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+func (execCounterConn) Close() error              { return nil }
+func (execCounterConn) Begin() (driver.Tx, error) { return execCounterConn{}, nil }
+func (execCounterConn) Commit() error             { return nil }
+func (execCounterConn) Rollback() error           { return nil }
+
+func (c execCounterConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	c.c.statements++
+	return driver.RowsAffected(1), nil
+}
+
+// BenchmarkInsertConversationMessages runs a 100-message conversation through
+// insertConversationMessages and through the per-message loop it replaced, reporting the
+// statements (round-trips) each sends.
+func BenchmarkInsertConversationMessages(b *testing.B) {
+	msgs := make([]Message, 100)
+	for i := range msgs {
+		msgs[i] = Message{Role: RoleUser, Content: fmt.Sprintf("turn %d", i)}
+	}
+	run := func(b *testing.B, insert func(ctx context.Context, tx *sql.Tx) error) {
+		counter := &execCounter{}
+		db := sql.OpenDB(counter)
+		defer db.Close()
+		ctx := context.Background()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			tx, err := db.BeginTx(ctx, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := insert(ctx, tx); err != nil {
+				b.Fatal(err)
+			}
+			if err := tx.Commit(); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(counter.statements)/float64(b.N), "statements/op")
+	}
+
+	b.Run("multi-row", func(b *testing.B) {
+		run(b, func(ctx context.Context, tx *sql.Tx) error {
+			return insertConversationMessages(ctx, tx, 1, msgs)
+		})
+	})
+	b.Run("per-message", func(b *testing.B) {
+		run(b, func(ctx context.Context, tx *sql.Tx) error {
+			for _, row := range legacyMessageRows(1, msgs) {
+				if _, err := tx.ExecContext(ctx, `
+INSERT INTO conversation_messages (conversation_id, idx, role, name, content, meta)
+VALUES ($1, $2, $3, $4, $5, $6)
+`, row...); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+func TestUpdateMessage_RejectsBadRoleAndMeta(t *testing.T) {
+	// Both are checked before the transaction starts, so no database is needed.
+	for name, p := range map[string]UpdateMessageParams{
+		"role": {Role: "narrator"},
+		"meta": {Meta: json.RawMessage(`{"a":`)},
+	} {
+		if _, err := UpdateMessage(context.Background(), nil, 1, 0, p); !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("%s: expected ErrInvalidInput, got %v", name, err)
+		}
+	}
+}
+
+func TestReindexConversationMessages_FlipsThenRenumbers(t *testing.T) {
+	// Conversation 7 has idx 0,1,1,3: bounds that look dense around a duplicate.
+	type row struct{ id, idx int64 }
+	rows := []row{{1, 0}, {2, 1}, {3, 1}, {4, 3}}
+	var statements []string
+	db := newFakeDB(t, func(query string, args []any) fakeResult {
+		switch {
+		case strings.HasPrefix(query, "SELECT id FROM conversations WHERE id = $1 FOR UPDATE"):
+			return fakeResult{cols: []string{"id"}, rows: [][]any{{int64(7)}}}
+		case strings.HasPrefix(query, "WITH flipped AS"):
+			statements = append(statements, "flip")
+			if !strings.Contains(query, "HAVING "+idxNotDenseSQL) || args[0] != int64(7) {
+				t.Fatalf("expected the flip scoped to conversation 7 by idxNotDenseSQL, got %v: %s", args, query)
+			}
+			for i := range rows {
+				rows[i].idx = -1 - rows[i].idx
+			}
+			return fakeResult{cols: []string{"conversations", "messages"}, rows: [][]any{{int64(1), int64(len(rows))}}}
+		case strings.HasPrefix(query, "UPDATE conversation_messages m"):
+			statements = append(statements, "renumber")
+			if !strings.Contains(query, "WHERE idx < 0") || !strings.Contains(query, "ORDER BY idx DESC, id ASC") {
+				t.Fatalf("expected only flipped rows renumbered in their original order: %s", query)
+			}
+			sort.Slice(rows, func(i, j int) bool {
+				if rows[i].idx != rows[j].idx {
+					return rows[i].idx > rows[j].idx
+				}
+				return rows[i].id < rows[j].id
+			})
+			for i := range rows {
+				rows[i].idx = int64(i)
+			}
+			return fakeResult{affected: int64(len(rows))}
+		}
+		t.Fatalf("unexpected query: %s", query)
+		return fakeResult{}
+	})
+
+	res, err := ReindexConversationMessages(context.Background(), db, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (ReindexResult{Conversations: 1, Messages: 4}) || !reflect.DeepEqual(statements, []string{"flip", "renumber"}) {
+		t.Fatalf("expected a flip then a renumber of 4 messages, got %+v after %v", res, statements)
+	}
+	if !reflect.DeepEqual(rows, []row{{1, 0}, {2, 1}, {3, 2}, {4, 3}}) {
+		t.Fatalf("expected 0..3 in the original (idx, id) order, got %v", rows)
+	}
+}
+
+func TestReindexConversationMessages_SkipsDense(t *testing.T) {
+	var renumbered bool
+	db := newFakeDB(t, func(query string, args []any) fakeResult {
+		switch {
+		case strings.HasPrefix(query, "SELECT id FROM conversations"):
+			return fakeResult{cols: []string{"id"}, rows: [][]any{{int64(7)}}}
+		case strings.HasPrefix(query, "WITH flipped AS"):
+			return fakeResult{cols: []string{"conversations", "messages"}, rows: [][]any{{int64(0), int64(0)}}}
+		case strings.HasPrefix(query, "UPDATE conversation_messages m"):
+			renumbered = true
+			return fakeResult{}
+		}
+		t.Fatalf("unexpected query: %s", query)
+		return fakeResult{}
+	})
+	if res, err := ReindexConversationMessages(context.Background(), db, 7); err != nil || res != (ReindexResult{}) || renumbered {
+		t.Fatalf("expected a dense conversation left alone, got %+v %v renumbered=%v", res, err, renumbered)
+	}
+}
+
+func TestMigration021_RepairsLikeReindex(t *testing.T) {
+	migration, err := os.ReadFile("../../migrations/021_message_idx_dense.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(migration), "HAVING "+idxNotDenseSQL) {
+		t.Fatalf("expected migration 021 to repair with the same condition as reindexMessages")
+	}
+}
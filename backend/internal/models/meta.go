@@ -0,0 +1,195 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxMessageMetaBytes bounds a single message's meta unless configured otherwise.
+const DefaultMaxMessageMetaBytes = 64 << 10
+
+// MetaError reports an unacceptable message meta. Index is the message's position in the
+// conversation, or -1 when it is not known yet.
+type MetaError struct {
+	Index  int
+	Reason string
+}
+
+func (e *MetaError) Error() string {
+	if e.Index < 0 {
+		return "message meta " + e.Reason
+	}
+	return fmt.Sprintf("message %d meta %s", e.Index, e.Reason)
+}
+
+// ValidateMessageMeta checks that the meta of message idx (-1 if unknown) is a JSON object of
+// at most maxBytes (0 = no limit). Empty and null meta are accepted; callers store them as {}.
+func ValidateMessageMeta(idx int, meta json.RawMessage, maxBytes int) error {
+	if maxBytes > 0 && len(meta) > maxBytes {
+		return &MetaError{Index: idx, Reason: fmt.Sprintf("is %d bytes (max %d)", len(meta), maxBytes)}
+	}
+	trimmed := bytes.TrimSpace(meta)
+	if len(trimmed) == 0 || string(trimmed) == "null" {
+		return nil
+	}
+	if trimmed[0] != '{' || !json.Valid(trimmed) {
+		return &MetaError{Index: idx, Reason: "must be a JSON object"}
+	}
+	return nil
+}
+
+// ValidateConversationMeta checks that a conversation's meta is a JSON object of at most
+// maxBytes (0 = no limit). Empty and null meta are accepted and stored as {}.
+func ValidateConversationMeta(meta json.RawMessage, maxBytes int) error {
+	if maxBytes > 0 && len(meta) > maxBytes {
+		return fmt.Errorf("meta is %d bytes (max %d)", len(meta), maxBytes)
+	}
+	trimmed := bytes.TrimSpace(meta)
+	if len(trimmed) == 0 || string(trimmed) == "null" {
+		return nil
+	}
+	if trimmed[0] != '{' || !json.Valid(trimmed) {
+		return errors.New("meta must be a JSON object")
+	}
+	return nil
+}
+
+// conversationMeta is the stored form of meta: empty and null become {}.
+func conversationMeta(meta json.RawMessage) []byte {
+	trimmed := bytes.TrimSpace(meta)
+	if len(trimmed) == 0 || string(trimmed) == "null" {
+		return []byte("{}")
+	}
+	return trimmed
+}
+
+// MetaThreshold keeps only conversations whose meta field Key is a number of at least Min.
+type MetaThreshold struct {
+	Key string  `json:"key"`
+	Min float64 `json:"min"`
+}
+
+var metaKeyRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]{0,63}$`)
+
+// ParseMetaThreshold parses a "key:min" filter such as "quality:0.7". Keys are top-level meta
+// fields: a letter or underscore, then letters, digits, _ or -.
+func ParseMetaThreshold(s string) (MetaThreshold, error) {
+	key, value, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return MetaThreshold{}, errors.New("expected key:min, e.g. quality:0.7")
+	}
+	return NewMetaThreshold(key, value)
+}
+
+// NewMetaThreshold validates key and parses value as the minimum of a MetaThreshold.
+func NewMetaThreshold(key, value string) (MetaThreshold, error) {
+	key = strings.TrimSpace(key)
+	if !metaKeyRe.MatchString(key) {
+		return MetaThreshold{}, fmt.Errorf("invalid meta field %q", key)
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return MetaThreshold{}, fmt.Errorf("invalid minimum %q for meta field %s", value, key)
+	}
+	return MetaThreshold{Key: key, Min: v}, nil
+}
+
+// appendMetaThresholds adds a condition per threshold on the conversations' meta column.
+// Conversations where the field is missing or not a number never match.
+func appendMetaThresholds(where []string, args []any, thresholds []MetaThreshold) ([]string, []any) {
+	for _, t := range thresholds {
+		args = append(args, t.Key, t.Min)
+		k, v := len(args)-1, len(args)
+		where = append(where, fmt.Sprintf("(CASE WHEN jsonb_typeof(meta -> $%d::text) = 'number' THEN (meta ->> $%d::text)::numeric END) >= $%d::numeric", k, k, v))
+	}
+	return where, args
+}
+
+// ValidateMessagesMeta runs ValidateMessageMeta over msgs, reporting the first offender's index.
+func ValidateMessagesMeta(msgs []Message, maxBytes int) error {
+	for i, m := range msgs {
+		if err := ValidateMessageMeta(i, m.Meta, maxBytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MetaViolation is a stored message whose meta is too large or not an object.
+type MetaViolation struct {
+	ConversationID int64  `json:"conversation_id"`
+	Idx            int    `json:"idx"`
+	Bytes          int    `json:"bytes"`
+	Type           string `json:"type"` // jsonb_typeof(meta)
+}
+
+// FindMetaViolations lists messages in a dataset whose meta exceeds maxBytes (0 = no size
+// check) or is not a JSON object, largest first. Sizes are of the stored jsonb text.
+func FindMetaViolations(ctx context.Context, db *sql.DB, datasetID int64, maxBytes int, limit int) ([]MetaViolation, error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT m.conversation_id, m.idx, octet_length(m.meta::text) AS n, jsonb_typeof(m.meta)
+FROM conversation_messages m
+JOIN conversations c ON c.id = m.conversation_id
+WHERE c.dataset_id = $1
+  AND (jsonb_typeof(m.meta) <> 'object' OR ($2 > 0 AND octet_length(m.meta::text) > $2))
+ORDER BY n DESC, m.conversation_id ASC, m.idx ASC
+LIMIT $3
+`, datasetID, maxBytes, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []MetaViolation{}
+	for rows.Next() {
+		var v MetaViolation
+		if err := rows.Scan(&v.ConversationID, &v.Idx, &v.Bytes, &v.Type); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// StripMetaKeys removes meta keys matching pattern ("*" matches any run of characters) from
+// every message in a dataset, bumping updated_at on the conversations it touches. It returns
+// the number of messages changed.
+func StripMetaKeys(ctx context.Context, db *sql.DB, datasetID int64, pattern string) (int64, error) {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return 0, fmt.Errorf("%w: pattern required", ErrInvalidInput)
+	}
+
+	var n int64
+	err := db.QueryRowContext(ctx, `
+WITH stripped AS (
+  UPDATE conversation_messages m
+  SET meta = (
+    SELECT COALESCE(jsonb_object_agg(e.key, e.value), '{}'::jsonb)
+    FROM jsonb_each(m.meta) AS e
+    WHERE e.key NOT LIKE $2 ESCAPE '\'
+  )
+  FROM conversations c
+  WHERE c.id = m.conversation_id
+    AND c.dataset_id = $1
+    AND jsonb_typeof(m.meta) = 'object'
+    AND EXISTS (SELECT 1 FROM jsonb_object_keys(m.meta) AS k WHERE k LIKE $2 ESCAPE '\')
+  RETURNING m.conversation_id
+)
+SELECT COUNT(*) FROM stripped
+`, datasetID, globToLike(pattern)).Scan(&n)
+	return n, err
+}
+
+// globToLike turns a "*" glob into a LIKE pattern, matching everything else literally.
+func globToLike(glob string) string {
+	return strings.ReplaceAll(escapeLike(glob), "*", "%")
+}
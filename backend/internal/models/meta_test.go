@@ -0,0 +1,111 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateMessageMeta_SizeBoundary(t *testing.T) {
+	const max = 64
+	pad := func(n int) json.RawMessage {
+		// {"k":"..."} is 8 bytes of framing around the value.
+		return json.RawMessage(`{"k":"` + strings.Repeat("x", n-8) + `"}`)
+	}
+	if err := ValidateMessageMeta(-1, pad(max), max); err != nil {
+		t.Fatalf("meta of exactly max bytes should pass: %v", err)
+	}
+	err := ValidateMessageMeta(-1, pad(max+1), max)
+	var me *MetaError
+	if !errors.As(err, &me) || !strings.Contains(me.Reason, "65 bytes") {
+		t.Fatalf("expected size error for max+1 bytes, got %v", err)
+	}
+	if err := ValidateMessageMeta(-1, pad(max+1), 0); err != nil {
+		t.Fatalf("0 should disable the size limit: %v", err)
+	}
+}
+
+func TestValidateMessageMeta_NonObject(t *testing.T) {
+	for _, raw := range []string{`[1,2]`, `"str"`, `42`, `true`, `{"a":`} {
+		if err := ValidateMessageMeta(-1, json.RawMessage(raw), 0); err == nil {
+			t.Fatalf("expected %s to be rejected", raw)
+		}
+	}
+	for _, raw := range []string{``, `null`, ` {"a":1} `} {
+		if err := ValidateMessageMeta(-1, json.RawMessage(raw), 0); err != nil {
+			t.Fatalf("expected %q to pass: %v", raw, err)
+		}
+	}
+}
+
+func TestValidateMessagesMeta_ReportsIndex(t *testing.T) {
+	msgs := []Message{
+		{Role: RoleUser, Content: "hi", Meta: json.RawMessage(`{}`)},
+		{Role: RoleAssistant, Content: "hello", Meta: json.RawMessage(`[]`)},
+	}
+	err := ValidateMessagesMeta(msgs, 0)
+	var me *MetaError
+	if !errors.As(err, &me) || me.Index != 1 {
+		t.Fatalf("expected error at message 1, got %v", err)
+	}
+	if err.Error() != "message 1 meta must be a JSON object" {
+		t.Fatalf("unexpected message: %q", err.Error())
+	}
+}
+
+func TestGlobToLike(t *testing.T) {
+	if got := globToLike("debug_*"); got != `debug\_%` {
+		t.Fatalf("unexpected pattern: %q", got)
+	}
+}
+
+func TestValidateConversationMeta(t *testing.T) {
+	for _, raw := range []string{`[1,2]`, `"str"`, `{"a":`} {
+		if err := ValidateConversationMeta(json.RawMessage(raw), 0); err == nil {
+			t.Fatalf("expected %s to be rejected", raw)
+		}
+	}
+	if err := ValidateConversationMeta(json.RawMessage(`{"difficulty":"hard"}`), 10); err == nil || !strings.Contains(err.Error(), "max 10") {
+		t.Fatalf("expected size error, got %v", err)
+	}
+	for _, raw := range []string{``, `null`, `{"quality":0.9}`} {
+		if err := ValidateConversationMeta(json.RawMessage(raw), 0); err != nil {
+			t.Fatalf("expected %q to pass: %v", raw, err)
+		}
+	}
+
+	// Exports only carry meta when asked, and unset meta reads as {}.
+	row := exportConversationRow{ID: 1, Meta: []byte(`{"domain":"math"}`)}
+	if b, _ := json.Marshal(conversationLine(row, nil, ExportOptions{})); strings.Contains(string(b), `"meta"`) {
+		t.Fatalf("meta without include_meta: %s", b)
+	}
+	if b, _ := json.Marshal(conversationLine(row, nil, ExportOptions{IncludeMeta: true})); !strings.Contains(string(b), `"meta":{"domain":"math"}`) {
+		t.Fatalf("expected meta, got %s", b)
+	}
+	if b, _ := json.Marshal(conversationLine(exportConversationRow{ID: 1}, nil, ExportOptions{IncludeMeta: true})); !strings.Contains(string(b), `"meta":{}`) {
+		t.Fatalf("expected empty meta object, got %s", b)
+	}
+}
+
+func TestParseMetaThreshold(t *testing.T) {
+	got, err := ParseMetaThreshold(" quality:0.7 ")
+	if err != nil || got != (MetaThreshold{Key: "quality", Min: 0.7}) {
+		t.Fatalf("got %+v %v", got, err)
+	}
+	for _, s := range []string{"quality", "quality:", "quality:high", "quality:NaN", "1st:2", "a b:1", "a.b:1", ":1"} {
+		if _, err := ParseMetaThreshold(s); err == nil {
+			t.Fatalf("expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestConversationsFilterQuery_MetaGTE(t *testing.T) {
+	q, args := conversationsFilterQuery(ExportOptions{Status: "approved", MetaGTE: []MetaThreshold{{Key: "quality", Min: 0.7}}})
+	if !strings.Contains(q, "jsonb_typeof(meta -> $2::text) = 'number'") || !strings.Contains(q, ">= $3::numeric") {
+		t.Fatalf("expected a numeric meta filter, got %s", q)
+	}
+	if len(args) != 3 || args[1] != "quality" || args[2] != 0.7 {
+		t.Fatalf("unexpected args %v", args)
+	}
+}
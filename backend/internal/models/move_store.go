@@ -0,0 +1,89 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MoveConversation reassigns a conversation, messages included, to another conversation
+// dataset and records the move in audit_log.
+func MoveConversation(ctx context.Context, db *sql.DB, id, targetDatasetID int64) (Conversation, error) {
+	if err := moveRow(ctx, db, "conversations", "conversation", id, targetDatasetID, false); err != nil {
+		return Conversation{}, err
+	}
+	return GetConversation(ctx, db, id)
+}
+
+// MoveDatasetItem reassigns an item (and its annotations) to another items dataset and
+// records the move in audit_log.
+func MoveDatasetItem(ctx context.Context, db *sql.DB, id, targetDatasetID int64) (DatasetItem, error) {
+	if err := moveRow(ctx, db, "dataset_items", "item", id, targetDatasetID, true); err != nil {
+		return DatasetItem{}, err
+	}
+	return GetDatasetItem(ctx, db, id)
+}
+
+// moveRow updates table.dataset_id after checking the target exists and is an items
+// dataset exactly when wantItems is set. Moving to the current dataset is a no-op.
+func moveRow(ctx context.Context, db *sql.DB, table, entity string, id, targetDatasetID int64, wantItems bool) error {
+	if targetDatasetID <= 0 {
+		return fmt.Errorf("%w: dataset_id required", ErrInvalidInput)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := moveRowTx(ctx, tx, table, entity, id, targetDatasetID, wantItems); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// moveRowTx is moveRow inside tx, for callers that change other columns in the same
+// transaction.
+func moveRowTx(ctx context.Context, tx *sql.Tx, table, entity string, id, targetDatasetID int64, wantItems bool) error {
+	var from int64
+	if err := tx.QueryRowContext(ctx, `SELECT dataset_id FROM `+table+` WHERE id = $1 FOR UPDATE`, id).Scan(&from); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	var kind string
+	if err := tx.QueryRowContext(ctx, `SELECT kind FROM datasets WHERE id = $1`, targetDatasetID).Scan(&kind); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: target dataset %d not found", ErrInvalidInput, targetDatasetID)
+		}
+		return err
+	}
+	if isItems := strings.EqualFold(kind, "items"); isItems != wantItems {
+		return fmt.Errorf("%w: cannot move a %s into a %s dataset", ErrInvalidInput, entity, kind)
+	}
+	if from == targetDatasetID {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE `+table+` SET dataset_id = $2, updated_at = $3 WHERE id = $1`, id, targetDatasetID, time.Now().UTC()); err != nil {
+		return err
+	}
+	detail, _ := json.Marshal(map[string]int64{"from_dataset_id": from, "to_dataset_id": targetDatasetID})
+	return insertAuditEntry(ctx, tx, entity, id, "move", detail)
+}
+
+// insertAuditEntry appends one audit_log row inside tx.
+func insertAuditEntry(ctx context.Context, tx *sql.Tx, entity string, entityID int64, action string, detail json.RawMessage) error {
+	_, err := tx.ExecContext(ctx, `
+INSERT INTO audit_log (entity, entity_id, action, detail)
+VALUES ($1, $2, $3, $4)
+`, entity, entityID, action, detail)
+	return err
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Content normalization flags for ExportOptions.Normalize, applied in this order.
+const (
+	NormalizeNFC        = "nfc"         // Unicode NFC composition
+	NormalizeCollapseWS = "collapse_ws" // runs of spaces/tabs become one space; newlines kept
+	NormalizeTrim       = "trim"        // strip trailing whitespace from every line
+)
+
+var normalizeOrder = []string{NormalizeNFC, NormalizeCollapseWS, NormalizeTrim}
+
+// ParseNormalizeFlags parses a comma-separated flag list ("nfc,trim") into the canonical
+// order, dropping duplicates. An empty string means no normalization.
+func ParseNormalizeFlags(s string) ([]string, error) {
+	seen := map[string]bool{}
+	for _, f := range strings.Split(s, ",") {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f == "" {
+			continue
+		}
+		switch f {
+		case NormalizeNFC, NormalizeCollapseWS, NormalizeTrim:
+			seen[f] = true
+		default:
+			return nil, fmt.Errorf("%w: unknown normalize flag %q (expected nfc|trim|collapse_ws)", ErrInvalidInput, f)
+		}
+	}
+	var out []string
+	for _, f := range normalizeOrder {
+		if seen[f] {
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
+
+// normalizeContent applies flags (as returned by ParseNormalizeFlags) to s.
+func normalizeContent(s string, flags []string) string {
+	for _, f := range flags {
+		switch f {
+		case NormalizeNFC:
+			s = norm.NFC.String(s)
+		case NormalizeCollapseWS:
+			s = collapseHorizontalSpace(s)
+		case NormalizeTrim:
+			lines := strings.Split(s, "\n")
+			for i, l := range lines {
+				lines[i] = strings.TrimRightFunc(l, unicode.IsSpace)
+			}
+			s = strings.Join(lines, "\n")
+		}
+	}
+	return s
+}
+
+func collapseHorizontalSpace(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	inSpace := false
+	for _, r := range s {
+		if r != '\n' && r != '\r' && unicode.IsSpace(r) {
+			if !inSpace {
+				b.WriteByte(' ')
+			}
+			inSpace = true
+			continue
+		}
+		inSpace = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// normalizeMessages returns msgs with normalized content, copying only when flags are set.
+func normalizeMessages(msgs []Message, flags []string) []Message {
+	if len(flags) == 0 {
+		return msgs
+	}
+	out := make([]Message, len(msgs))
+	for i, m := range msgs {
+		m.Content = normalizeContent(m.Content, flags)
+		out[i] = m
+	}
+	return out
+}
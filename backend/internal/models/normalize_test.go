@@ -0,0 +1,63 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseNormalizeFlags(t *testing.T) {
+	flags, err := ParseNormalizeFlags(" trim, NFC,trim,,collapse_ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"nfc", "collapse_ws", "trim"}; !reflect.DeepEqual(flags, want) {
+		t.Fatalf("expected canonical order %v, got %v", want, flags)
+	}
+	if flags, err := ParseNormalizeFlags(""); err != nil || flags != nil {
+		t.Fatalf("empty should mean none, got %v %v", flags, err)
+	}
+	if _, err := ParseNormalizeFlags("nfc,lower"); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected ErrInvalidInput, got %v", err)
+	}
+}
+
+func TestNormalizeContent(t *testing.T) {
+	decomposed := "café" // e + combining acute
+	cases := []struct {
+		flags []string
+		in    string
+		want  string
+	}{
+		{[]string{NormalizeNFC}, decomposed, "caf\u00e9"},
+		{[]string{NormalizeCollapseWS}, "a  \t b\n\nc   d", "a b\n\nc d"},
+		{[]string{NormalizeTrim}, "a  \nb\t\n c", "a\nb\n c"},
+		{[]string{NormalizeCollapseWS, NormalizeTrim}, "x   \ny", "x\ny"},
+		{nil, "a  b ", "a  b "},
+	}
+	for _, c := range cases {
+		if got := normalizeContent(c.in, c.flags); got != c.want {
+			t.Errorf("normalizeContent(%q, %v) = %q, want %q", c.in, c.flags, got, c.want)
+		}
+	}
+}
+
+func TestDerivePairs_Normalize(t *testing.T) {
+	msgs := []Message{
+		{Role: RoleUser, Content: "first   question"},
+		{Role: RoleAssistant, Content: "answer  "},
+		{Role: RoleUser, Content: "second\t\tquestion"},
+		{Role: RoleAssistant, Content: "ok"},
+	}
+	pairs := must(derivePairs(msgs, ExportOptions{Context: "full", RoleStyle: "plain", Normalize: []string{NormalizeCollapseWS}}))
+	if len(pairs) != 2 {
+		t.Fatalf("expected 2 pairs, got %d", len(pairs))
+	}
+	if !strings.Contains(pairs[1].User, "first question") || !strings.Contains(pairs[1].User, "second question") {
+		t.Fatalf("expected collapsed context, got %q", pairs[1].User)
+	}
+	if msgs[0].Content != "first   question" {
+		t.Fatalf("input messages must not be modified")
+	}
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// OpenAI Batch API request constants for type=openai_batch lines.
+const (
+	BatchMethod = "POST"
+	BatchURL    = "/v1/chat/completions"
+)
+
+// ExportBatchRequest is one line of a type=openai_batch export: a chat completion request
+// replaying the prompt of one pair, to be compared with the gold reply it leaves out.
+// CustomID (see BatchCustomID) joins the model's answer back to that reply.
+type ExportBatchRequest struct {
+	CustomID string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     ExportBatchBody `json:"body"`
+}
+
+type ExportBatchBody struct {
+	Model    string               `json:"model"`
+	Messages []ExportBatchMessage `json:"messages"`
+}
+
+// ExportBatchMessage is a chat message as the completions API takes it; message meta stays
+// behind.
+type ExportBatchMessage struct {
+	Role    Role   `json:"role"`
+	Content string `json:"content"`
+	Name    string `json:"name,omitempty"`
+}
+
+// BatchCustomID names an assistant message of a conversation by its row:
+// conv-<id>-msg-<message_id>. Unlike its idx, the row does not move when messages are
+// reindexed or inserted, so an answer cannot be joined back to a different reply.
+func BatchCustomID(conversationID, messageID int64) string {
+	return fmt.Sprintf("conv-%d-msg-%d", conversationID, messageID)
+}
+
+// ParseBatchCustomID is the inverse of BatchCustomID.
+func ParseBatchCustomID(s string) (conversationID, messageID int64, err error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(s), "conv-")
+	conv, msg, ok2 := strings.Cut(rest, "-msg-")
+	if ok && ok2 {
+		conversationID, err = strconv.ParseInt(conv, 10, 64)
+		if err == nil {
+			messageID, err = strconv.ParseInt(msg, 10, 64)
+		}
+		if err == nil && conversationID > 0 && messageID > 0 && BatchCustomID(conversationID, messageID) == strings.TrimSpace(s) {
+			return conversationID, messageID, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("%w: custom_id %q is not conv-<id>-msg-<message_id>", ErrInvalidInput, s)
+}
+
+// batchRequestLine is the type=openai_batch line for p, which must carry its conversation id,
+// assistant message row and prompt turns. BatchSystemPrompt, when set, replaces the conversation's system messages.
+func batchRequestLine(p ExportPair, opts ExportOptions) ExportBatchRequest {
+	var turns []Message
+	if p.turns != nil {
+		turns = *p.turns
+	}
+	msgs := make([]ExportBatchMessage, 0, len(turns)+1)
+	if opts.BatchSystemPrompt != "" {
+		msgs = append(msgs, ExportBatchMessage{Role: RoleSystem, Content: opts.BatchSystemPrompt})
+	}
+	for _, m := range turns {
+		if m.Role == RoleSystem && opts.BatchSystemPrompt != "" {
+			continue
+		}
+		msgs = append(msgs, ExportBatchMessage{Role: m.Role, Content: m.Content, Name: m.Name})
+	}
+	return ExportBatchRequest{
+		CustomID: BatchCustomID(p.ConversationID, p.assistantID),
+		Method:   BatchMethod,
+		URL:      BatchURL,
+		Body:     ExportBatchBody{Model: opts.BatchModel, Messages: msgs},
+	}
+}
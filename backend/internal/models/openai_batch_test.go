@@ -0,0 +1,50 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBatchCustomID(t *testing.T) {
+	id := BatchCustomID(123, 4567)
+	if id != "conv-123-msg-4567" {
+		t.Fatalf("unexpected custom_id %s", id)
+	}
+	conv, msg, err := ParseBatchCustomID(id)
+	if err != nil || conv != 123 || msg != 4567 {
+		t.Fatalf("round trip: got %d %d %v", conv, msg, err)
+	}
+	// idx-keyed ids from older exports are refused rather than attached by position.
+	for _, bad := range []string{"", "conv-123", "conv-0-msg-1", "conv-1-msg-0", "conv-1-msg--1", "conv-01-msg-1", "item-1-msg-2", "conv-1-msg-2-x", "conv-1-idx-2"} {
+		if _, _, err := ParseBatchCustomID(bad); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestConversationPairLines_OpenAIBatch(t *testing.T) {
+	msgs := []Message{
+		{Role: RoleSystem, Content: "Be terse."},
+		{Role: RoleUser, Content: "hi"},
+		{Role: RoleAssistant, Content: "hello"},
+		{Role: RoleUser, Content: " and now? "},
+		{ID: 88, Role: RoleAssistant, Content: "bye"},
+	}
+	opts := ExportOptions{Type: ExportTypeOpenAIBatch, Context: ContextFull, IncludeSystem: true, BatchModel: "gpt-x"}
+	lines := must(conversationPairLines(exportConversationRow{ID: 9}, msgs, opts))
+	if len(lines) != 2 {
+		t.Fatalf("expected a request per pair, got %d", len(lines))
+	}
+	raw, _ := json.Marshal(lines[1])
+	want := `{"custom_id":"conv-9-msg-88","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-x","messages":[` +
+		`{"role":"system","content":"Be terse."},{"role":"user","content":"hi"},{"role":"assistant","content":"hello"},{"role":"user","content":"and now?"}]}}`
+	if string(raw) != want {
+		t.Fatalf("got  %s\nwant %s", raw, want)
+	}
+
+	opts.BatchSystemPrompt = "Answer in French."
+	req := must(conversationPairLines(exportConversationRow{ID: 9}, msgs, opts))[0].(ExportBatchRequest)
+	if m := req.Body.Messages; len(m) != 2 || m[0].Content != "Answer in French." || m[1].Role != RoleUser {
+		t.Fatalf("expected the system prompt to replace the conversation's, got %+v", m)
+	}
+}
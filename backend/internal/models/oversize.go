@@ -0,0 +1,167 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ExportOptions.OnOversize values.
+const (
+	OversizeSkip     = "skip"
+	OversizeTruncate = "truncate"
+)
+
+// ParseOnOversize validates an on_oversize value; empty means skip.
+func ParseOnOversize(s string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", OversizeSkip:
+		return OversizeSkip, nil
+	case OversizeTruncate:
+		return OversizeTruncate, nil
+	default:
+		return "", fmt.Errorf("%w: on_oversize must be skip|truncate, got %q", ErrInvalidInput, s)
+	}
+}
+
+// fitLine applies opts.MaxChars to an export line, counting the characters (runes) of its
+// content: user+assistant for pairs, text for completions, every message for conversations.
+// Oversized lines are dropped (ok=false) or, with OversizeTruncate, cut to fit. Truncation
+// drops the oldest content first so the assistant reply survives where possible.
+func fitLine(line any, opts ExportOptions) (any, bool) {
+	max := opts.MaxChars
+	if max <= 0 {
+		return line, true
+	}
+	truncate := opts.OnOversize == OversizeTruncate
+	switch l := line.(type) {
+	case ExportPair:
+		u, a := utf8.RuneCountInString(l.User), utf8.RuneCountInString(l.Assistant)
+		if u+a <= max {
+			return l, true
+		}
+		if !truncate {
+			return nil, false
+		}
+		if a >= max {
+			l.User = ""
+			l.Assistant = headRunes(l.Assistant, max)
+		} else {
+			l.User = tailRunes(l.User, max-a)
+		}
+		return l, true
+	case ExportCompletion:
+		if utf8.RuneCountInString(l.Text) <= max {
+			return l, true
+		}
+		if !truncate {
+			return nil, false
+		}
+		l.Text = tailRunes(l.Text, max)
+		return l, true
+	case ExportTurns:
+		total := utf8.RuneCountInString(l.Completion)
+		for _, t := range l.PromptTurns {
+			total += utf8.RuneCountInString(t)
+		}
+		if total <= max {
+			return l, true
+		}
+		if !truncate {
+			return nil, false
+		}
+		return truncateTurns(l, max), true
+	case ExportConversation:
+		total := 0
+		for _, m := range l.Messages {
+			total += utf8.RuneCountInString(m.Content)
+		}
+		if total <= max {
+			return l, true
+		}
+		if !truncate {
+			return nil, false
+		}
+		msgs, ok := truncateMessages(l.Messages, max)
+		if !ok {
+			return nil, false
+		}
+		l.Messages = msgs
+		return l, true
+	default:
+		return line, true
+	}
+}
+
+// truncateMessages keeps msgs in order up to max characters, cutting the message that crosses
+// the budget, then drops trailing turns so the conversation still ends with an assistant
+// reply. ok is false when no assistant message fits.
+func truncateMessages(msgs []Message, max int) ([]Message, bool) {
+	out := make([]Message, 0, len(msgs))
+	left := max
+	for _, m := range msgs {
+		if left <= 0 {
+			break
+		}
+		n := utf8.RuneCountInString(m.Content)
+		if n > left {
+			m.Content = headRunes(m.Content, left)
+			n = left
+		}
+		out = append(out, m)
+		left -= n
+	}
+	for len(out) > 0 && out[len(out)-1].Role != RoleAssistant {
+		out = out[:len(out)-1]
+	}
+	return out, len(out) > 0
+}
+
+// truncateTurns drops the oldest prompt turns until l fits max characters, cutting the
+// oldest kept turn from the front; a completion alone over max is cut to its head with no
+// turns left, as for pairs.
+func truncateTurns(l ExportTurns, max int) ExportTurns {
+	left := max - utf8.RuneCountInString(l.Completion)
+	if left <= 0 {
+		l.Completion = headRunes(l.Completion, max)
+		l.PromptTurns, l.roles = []string{}, nil
+		return l
+	}
+	first := len(l.PromptTurns)
+	for first > 0 && left > 0 {
+		first--
+		left -= utf8.RuneCountInString(l.PromptTurns[first])
+	}
+	turns := append([]string(nil), l.PromptTurns[first:]...)
+	if left < 0 {
+		turns[0] = tailRunes(turns[0], utf8.RuneCountInString(turns[0])+left)
+	}
+	l.PromptTurns, l.roles = turns, l.roles[first:]
+	return l
+}
+
+// headRunes returns the first n runes of s.
+func headRunes(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
+
+// tailRunes returns the last n runes of s.
+func tailRunes(s string, n int) string {
+	skip := utf8.RuneCountInString(s) - n
+	if skip <= 0 {
+		return s
+	}
+	for i := range s {
+		if skip == 0 {
+			return s[i:]
+		}
+		skip--
+	}
+	return ""
+}
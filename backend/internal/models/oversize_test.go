@@ -0,0 +1,68 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseOnOversize(t *testing.T) {
+	for in, want := range map[string]string{"": OversizeSkip, "skip": OversizeSkip, " Truncate ": OversizeTruncate} {
+		if got, err := ParseOnOversize(in); err != nil || got != want {
+			t.Fatalf("%q: expected %q, got %q %v", in, want, got, err)
+		}
+	}
+	if _, err := ParseOnOversize("cut"); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected ErrInvalidInput, got %v", err)
+	}
+}
+
+func TestFitLine_Pairs(t *testing.T) {
+	p := ExportPair{User: "héllo there", Assistant: "général"}
+	if got, ok := fitLine(p, ExportOptions{MaxChars: 18}); !ok || got != p {
+		t.Fatalf("pair within budget should pass unchanged, got %v %v", got, ok)
+	}
+	if _, ok := fitLine(p, ExportOptions{MaxChars: 17}); ok {
+		t.Fatal("oversized pair should be skipped by default")
+	}
+
+	got, ok := fitLine(p, ExportOptions{MaxChars: 12, OnOversize: OversizeTruncate})
+	if want := (ExportPair{User: "there", Assistant: "général"}); !ok || got != want {
+		t.Fatalf("expected the user side trimmed from the front, got %+v", got)
+	}
+	got, _ = fitLine(p, ExportOptions{MaxChars: 4, OnOversize: OversizeTruncate})
+	if want := (ExportPair{Assistant: "géné"}); got != want {
+		t.Fatalf("expected only the assistant head, got %+v", got)
+	}
+
+	c := ExportCompletion{Text: "User: hi\nAssistant: hello"}
+	got, _ = fitLine(c, ExportOptions{MaxChars: 5, OnOversize: OversizeTruncate})
+	if got != (ExportCompletion{Text: "hello"}) {
+		t.Fatalf("expected the completion tail, got %+v", got)
+	}
+}
+
+func TestFitLine_Conversations(t *testing.T) {
+	conv := ExportConversation{ID: 1, Messages: []Message{
+		{Role: RoleUser, Content: "abcd"},
+		{Role: RoleAssistant, Content: "efgh"},
+		{Role: RoleUser, Content: "ijkl"},
+		{Role: RoleAssistant, Content: "mnop"},
+	}}
+	if _, ok := fitLine(conv, ExportOptions{MaxChars: 15}); ok {
+		t.Fatal("oversized conversation should be skipped by default")
+	}
+
+	got, ok := fitLine(conv, ExportOptions{MaxChars: 14, OnOversize: OversizeTruncate})
+	want := []Message{{Role: RoleUser, Content: "abcd"}, {Role: RoleAssistant, Content: "efgh"}, {Role: RoleUser, Content: "ijkl"}, {Role: RoleAssistant, Content: "mn"}}
+	if !ok || !reflect.DeepEqual(got.(ExportConversation).Messages, want) {
+		t.Fatalf("expected the last reply cut, got %+v", got)
+	}
+	got, _ = fitLine(conv, ExportOptions{MaxChars: 10, OnOversize: OversizeTruncate})
+	if msgs := got.(ExportConversation).Messages; len(msgs) != 2 || msgs[1].Content != "efgh" {
+		t.Fatalf("expected trailing user turn dropped, got %+v", msgs)
+	}
+	if _, ok := fitLine(conv, ExportOptions{MaxChars: 4, OnOversize: OversizeTruncate}); ok {
+		t.Fatal("a conversation with no assistant reply left should be skipped")
+	}
+}
@@ -0,0 +1,83 @@
+package models
+
+import "strings"
+
+// PhraseFilter matches a list of banned phrases case-insensitively. A nil filter matches nothing.
+type PhraseFilter struct {
+	phrases []string
+	lowered []string
+}
+
+func NewPhraseFilter(phrases []string) *PhraseFilter {
+	f := &PhraseFilter{}
+	seen := map[string]bool{}
+	for _, p := range phrases {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		l := strings.ToLower(p)
+		if seen[l] {
+			continue
+		}
+		seen[l] = true
+		f.phrases = append(f.phrases, p)
+		f.lowered = append(f.lowered, l)
+	}
+	if len(f.phrases) == 0 {
+		return nil
+	}
+	return f
+}
+
+// ParsePhraseList splits a newline- or comma-separated phrase list, as given in an
+// environment variable, skipping blank lines and lines starting with '#'.
+func ParsePhraseList(s string) []string {
+	var out []string
+	for _, line := range ParsePhraseFile(s) {
+		for _, p := range strings.Split(line, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				out = append(out, p)
+			}
+		}
+	}
+	return out
+}
+
+// ParsePhraseFile splits a phrase file into one phrase per line, skipping blank lines and
+// lines starting with '#'. Commas are part of the phrase.
+func ParsePhraseFile(s string) []string {
+	var out []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// Match returns the first configured phrase found in text.
+func (f *PhraseFilter) Match(text string) (string, bool) {
+	if f == nil || text == "" {
+		return "", false
+	}
+	lower := strings.ToLower(text)
+	for i, l := range f.lowered {
+		if strings.Contains(lower, l) {
+			return f.phrases[i], true
+		}
+	}
+	return "", false
+}
+
+// MatchMessages returns the index of the first message containing a banned phrase, or -1.
+func (f *PhraseFilter) MatchMessages(msgs []Message) (int, string) {
+	for i, m := range msgs {
+		if phrase, ok := f.Match(m.Content); ok {
+			return i, phrase
+		}
+	}
+	return -1, ""
+}
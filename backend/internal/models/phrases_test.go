@@ -0,0 +1,53 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPhraseFilter_CaseInsensitive(t *testing.T) {
+	f := NewPhraseFilter([]string{"As an AI language model"})
+	phrase, ok := f.Match("Well, AS AN ai Language Model, I cannot...")
+	if !ok {
+		t.Fatalf("expected match")
+	}
+	if phrase != "As an AI language model" {
+		t.Fatalf("unexpected phrase: %q", phrase)
+	}
+	if _, ok := f.Match("perfectly fine"); ok {
+		t.Fatalf("unexpected match")
+	}
+}
+
+func TestPhraseFilter_NilMatchesNothing(t *testing.T) {
+	f := NewPhraseFilter([]string{"", "  "})
+	if f != nil {
+		t.Fatalf("expected nil filter for empty phrase list")
+	}
+	if idx, _ := f.MatchMessages([]Message{{Role: RoleUser, Content: "anything"}}); idx != -1 {
+		t.Fatalf("expected no match, got index %d", idx)
+	}
+}
+
+func TestPhraseFilter_MatchMessagesIndex(t *testing.T) {
+	f := NewPhraseFilter(ParsePhraseList("# comment\nfoo, bar\n\nbaz"))
+	msgs := []Message{
+		{Role: RoleUser, Content: "hello"},
+		{Role: RoleAssistant, Content: "some BAZ here"},
+	}
+	idx, phrase := f.MatchMessages(msgs)
+	if idx != 1 || phrase != "baz" {
+		t.Fatalf("expected (1, baz), got (%d, %q)", idx, phrase)
+	}
+}
+
+func TestParsePhraseFile_KeepsCommas(t *testing.T) {
+	got := ParsePhraseFile("# comment\r\nWell, actually\n\n  I cannot, sorry  \n")
+	want := []string{"Well, actually", "I cannot, sorry"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ParsePhraseFile = %q, want %q", got, want)
+	}
+	if got := ParsePhraseList("foo, bar\nbaz"); !reflect.DeepEqual(got, []string{"foo", "bar", "baz"}) {
+		t.Fatalf("ParsePhraseList = %q, want the env list split on commas too", got)
+	}
+}
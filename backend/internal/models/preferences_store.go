@@ -0,0 +1,324 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+)
+
+// PreferencePair is one DPO preference: for Prompt, a rater chose Chosen over Rejected.
+// ConversationID and MessageIdx name the assistant message the responses were compared at,
+// when the pair came from a conversation.
+type PreferencePair struct {
+	ID             int64     `json:"id"`
+	DatasetID      int64     `json:"dataset_id"`
+	Split          Split     `json:"split"`
+	ConversationID *int64    `json:"conversation_id"`
+	MessageIdx     *int      `json:"message_idx"`
+	Prompt         string    `json:"prompt"`
+	Chosen         string    `json:"chosen"`
+	Rejected       string    `json:"rejected"`
+	Rater          string    `json:"rater"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+const preferencePairColumns = `id, dataset_id, split, conversation_id, message_idx, prompt, chosen, rejected, rater, created_at`
+
+func scanPreferencePair(row interface{ Scan(...any) error }) (PreferencePair, error) {
+	var p PreferencePair
+	err := row.Scan(&p.ID, &p.DatasetID, &p.Split, &p.ConversationID, &p.MessageIdx, &p.Prompt, &p.Chosen, &p.Rejected, &p.Rater, &p.CreatedAt)
+	return p, err
+}
+
+// NormalizePreferencePair trims p and checks it can be stored: chosen, rejected and rater
+// are required, chosen and rejected must differ, and the prompt is either given or taken
+// from a conversation's message (message_idx needs conversation_id). An empty split is
+// left for CreatePreferencePair to fill in.
+func NormalizePreferencePair(p PreferencePair) (PreferencePair, error) {
+	p.Prompt = strings.TrimSpace(p.Prompt)
+	p.Chosen = strings.TrimSpace(p.Chosen)
+	p.Rejected = strings.TrimSpace(p.Rejected)
+	p.Rater = strings.TrimSpace(p.Rater)
+	switch {
+	case p.Chosen == "" || p.Rejected == "":
+		return p, fmt.Errorf("%w: chosen and rejected are required", ErrInvalidInput)
+	case p.Chosen == p.Rejected:
+		return p, fmt.Errorf("%w: chosen and rejected are identical", ErrInvalidInput)
+	case p.Rater == "":
+		return p, fmt.Errorf("%w: rater required", ErrInvalidInput)
+	case p.MessageIdx != nil && p.ConversationID == nil:
+		return p, fmt.Errorf("%w: message_idx needs conversation_id", ErrInvalidInput)
+	case p.Prompt == "" && (p.ConversationID == nil || p.MessageIdx == nil):
+		return p, fmt.Errorf("%w: prompt or conversation_id and message_idx required", ErrInvalidInput)
+	}
+	if p.Split != "" {
+		split, ok := NormalizeSplit(string(p.Split))
+		if !ok {
+			return p, fmt.Errorf("%w: invalid split", ErrInvalidInput)
+		}
+		p.Split = split
+	}
+	return p, nil
+}
+
+// preferencePrompt returns the prompt a reply at message idx answers: the user message
+// directly before it. idx must name an assistant message.
+func preferencePrompt(msgs []Message, idx int) (string, error) {
+	if idx < 0 || idx >= len(msgs) {
+		return "", fmt.Errorf("%w: message %d does not exist", ErrInvalidInput, idx)
+	}
+	if msgs[idx].Role != RoleAssistant {
+		return "", fmt.Errorf("%w: message %d is a %s message, not an assistant message", ErrInvalidInput, idx, msgs[idx].Role)
+	}
+	if idx == 0 || msgs[idx-1].Role != RoleUser {
+		return "", fmt.Errorf("%w: message %d does not follow a user message; pass prompt", ErrInvalidInput, idx)
+	}
+	return strings.TrimSpace(msgs[idx-1].Content), nil
+}
+
+// CreatePreferencePair stores a preference pair in a conversation dataset. A pair naming a
+// conversation must name one in the same dataset; its prompt, when not given, is the user
+// message before message_idx, and its split defaults to the conversation's. Other pairs
+// default to train.
+func CreatePreferencePair(ctx context.Context, db *sql.DB, p PreferencePair) (PreferencePair, error) {
+	p, err := NormalizePreferencePair(p)
+	if err != nil {
+		return PreferencePair{}, err
+	}
+	if err := RequireDatasetKind(ctx, db, p.DatasetID, DatasetKindConversations); err != nil {
+		return PreferencePair{}, err
+	}
+
+	if p.ConversationID != nil {
+		var datasetID int64
+		var split Split
+		err := db.QueryRowContext(ctx, `SELECT dataset_id, split FROM conversations WHERE id = $1`, *p.ConversationID).Scan(&datasetID, &split)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && datasetID != p.DatasetID) {
+			return PreferencePair{}, fmt.Errorf("%w: conversation %d is not in dataset %d", ErrInvalidInput, *p.ConversationID, p.DatasetID)
+		}
+		if err != nil {
+			return PreferencePair{}, err
+		}
+		if p.Split == "" {
+			p.Split = split
+		}
+		if p.Prompt == "" {
+			msgs, err := loadMessages(ctx, db, *p.ConversationID)
+			if err != nil {
+				return PreferencePair{}, err
+			}
+			if p.Prompt, err = preferencePrompt(msgs, *p.MessageIdx); err != nil {
+				return PreferencePair{}, err
+			}
+		}
+	}
+	if p.Split == "" {
+		p.Split = SplitTrain
+	}
+
+	return scanPreferencePair(db.QueryRowContext(ctx, `
+INSERT INTO preference_pairs (dataset_id, split, conversation_id, message_idx, prompt, chosen, rejected, rater)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING `+preferencePairColumns, p.DatasetID, p.Split, p.ConversationID, p.MessageIdx, p.Prompt, p.Chosen, p.Rejected, p.Rater))
+}
+
+// GetPreferencePair returns preference pair id of datasetID; ErrNotFound when there is none.
+func GetPreferencePair(ctx context.Context, db *sql.DB, datasetID, id int64) (PreferencePair, error) {
+	p, err := scanPreferencePair(db.QueryRowContext(ctx, `
+SELECT `+preferencePairColumns+`
+FROM preference_pairs
+WHERE id = $1 AND dataset_id = $2
+`, id, datasetID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return PreferencePair{}, ErrNotFound
+	}
+	return p, err
+}
+
+// ListPreferencePairs lists a dataset's preference pairs, oldest first; split "" or "all"
+// lists every split.
+func ListPreferencePairs(ctx context.Context, db *sql.DB, datasetID int64, split string, limit, offset int) ([]PreferencePair, error) {
+	if split == "all" {
+		split = ""
+	}
+	rows, err := db.QueryContext(ctx, `
+SELECT `+preferencePairColumns+`
+FROM preference_pairs
+WHERE dataset_id = $1 AND ($2 = '' OR split = $2)
+ORDER BY id ASC
+LIMIT $3 OFFSET $4
+`, datasetID, split, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []PreferencePair{}
+	for rows.Next() {
+		p, err := scanPreferencePair(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// Sources of a PreferenceResponse.
+const (
+	PreferenceSourceMessage     = "message"
+	PreferenceSourceAlternative = "alternative"
+)
+
+// PreferenceCandidate is a prompt with two responses to compare, as served by
+// NextPreferenceCandidate.
+type PreferenceCandidate struct {
+	Prompt    string               `json:"prompt"`
+	Responses []PreferenceResponse `json:"responses"`
+}
+
+// PreferenceResponse is one response of a PreferenceCandidate: an assistant message, or a
+// draft alternative of one.
+type PreferenceResponse struct {
+	Text           string `json:"text"`
+	Source         string `json:"source"`
+	ConversationID int64  `json:"conversation_id"`
+	MessageIdx     int    `json:"message_idx"`
+	AlternativeID  *int64 `json:"alternative_id,omitempty"`
+}
+
+// preferenceAnchorPage is how many replies NextPreferenceCandidate samples per query while
+// looking for one with something left to compare.
+const preferenceAnchorPage = 20
+
+// preferenceUnratedSQL holds when the responses named by the a and b expressions have not
+// been rated against each other, in either order, for the prompt expression. Rated pairs
+// are looked up by md5(prompt), indexed by migration 038, with the texts compared only to
+// rule out hash collisions.
+func preferenceUnratedSQL(prompt, a, b string) string {
+	return `NOT EXISTS (
+      SELECT 1 FROM preference_pairs p
+      WHERE p.dataset_id = $1 AND md5(p.prompt) = md5(btrim(` + prompt + `)) AND p.prompt = btrim(` + prompt + `)
+        AND ((p.chosen = btrim(` + a + `) AND p.rejected = btrim(` + b + `))
+          OR (p.chosen = btrim(` + b + `) AND p.rejected = btrim(` + a + `)))
+    )`
+}
+
+// preferenceCandidateSQL samples up to $3 replies of dataset $1, in seed ($2) order after
+// the pick $4, each with one partner when it has one left to compare: a draft alternative
+// of it, or the reply of another conversation to the same user prompt. A prompt is the
+// user message directly before the reply; same prompts are found by md5(content), indexed
+// for user messages by migration 038. Only the sampled replies look up partners, so a
+// prompt shared by many conversations costs one lookup per reply instead of a pairing of
+// all of them.
+var preferenceCandidateSQL = `
+WITH anchors AS (
+  SELECT m.id, m.conversation_id, m.idx, m.content, u.content AS prompt, ` + sampleOrderSQL("m.id") + ` AS pick
+  FROM conversation_messages m
+  JOIN conversations c ON c.id = m.conversation_id
+  JOIN conversation_messages u ON u.conversation_id = m.conversation_id AND u.idx = m.idx - 1 AND u.role = 'user'
+  WHERE c.dataset_id = $1 AND m.role = 'assistant' AND ` + sampleOrderSQL("m.id") + ` > $4
+  ORDER BY pick
+  LIMIT $3
+)
+SELECT r.pick, k.key, r.prompt, r.content, r.conversation_id, r.idx, k.text, k.source, k.conv, k.idx, k.alt
+FROM anchors r
+LEFT JOIN LATERAL (
+  SELECT * FROM (
+    (SELECT 'a' || a.id AS key, a.content AS text, 'alternative' AS source, a.conversation_id AS conv, r.idx AS idx, a.id AS alt
+    FROM message_alternatives a
+    WHERE a.message_id = r.id AND a.status = 'draft' AND btrim(a.content) <> btrim(r.content)
+      AND ` + preferenceUnratedSQL("r.prompt", "r.content", "a.content") + `
+    ORDER BY ` + sampleOrderSQL("a.id") + `
+    LIMIT 1)
+    UNION ALL
+    (SELECT 'c' || r.id || '-' || y.id, y.content, 'message', y.conversation_id, y.idx, NULL::bigint
+    FROM conversation_messages u
+    JOIN conversations c ON c.id = u.conversation_id
+    JOIN conversation_messages y ON y.conversation_id = u.conversation_id AND y.idx = u.idx + 1 AND y.role = 'assistant'
+    WHERE u.role = 'user' AND md5(u.content) = md5(r.prompt) AND u.content = r.prompt
+      AND c.dataset_id = $1 AND u.conversation_id <> r.conversation_id AND btrim(y.content) <> btrim(r.content)
+      AND ` + preferenceUnratedSQL("r.prompt", "r.content", "y.content") + `
+    ORDER BY ` + sampleOrderSQL("y.id") + `
+    LIMIT 1)
+  ) p
+  ORDER BY ` + sampleOrderSQL("p.key") + `
+  LIMIT 1
+) k ON true
+ORDER BY r.pick
+`
+
+// NextPreferenceCandidate picks a not yet rated pair of responses from a conversation
+// dataset: an assistant message and a draft alternative of it, or the assistant messages
+// of two conversations answering the same user prompt. Replies are tried in a
+// seed-determined random order like the sample endpoints, a page at a time, until one has
+// a partner. The two responses are shown in a seed-determined order too, so neither source
+// always comes first. No candidate is ErrNotFound.
+func NextPreferenceCandidate(ctx context.Context, db *sql.DB, datasetID int64, seed int64) (PreferenceCandidate, error) {
+	after := ""
+	for {
+		c, last, n, err := nextPreferenceCandidatePage(ctx, db, datasetID, seed, after)
+		if err != nil {
+			return PreferenceCandidate{}, err
+		}
+		if c != nil {
+			return *c, nil
+		}
+		if n < preferenceAnchorPage {
+			return PreferenceCandidate{}, ErrNotFound
+		}
+		after = last
+	}
+}
+
+// nextPreferenceCandidatePage runs preferenceCandidateSQL for the replies after pick after
+// and returns the first candidate, or nil with the last pick and the number of replies
+// sampled.
+func nextPreferenceCandidatePage(ctx context.Context, db *sql.DB, datasetID, seed int64, after string) (*PreferenceCandidate, string, int, error) {
+	rows, err := db.QueryContext(ctx, preferenceCandidateSQL, datasetID, seed, preferenceAnchorPage, after)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	defer rows.Close()
+
+	var last string
+	n := 0
+	for rows.Next() {
+		var key sql.NullString
+		var c PreferenceCandidate
+		a := PreferenceResponse{Source: PreferenceSourceMessage}
+		var b PreferenceResponse
+		var text, source sql.NullString
+		var conv sql.NullInt64
+		var idx sql.NullInt32
+		if err := rows.Scan(&last, &key, &c.Prompt, &a.Text, &a.ConversationID, &a.MessageIdx,
+			&text, &source, &conv, &idx, &b.AlternativeID); err != nil {
+			return nil, "", 0, err
+		}
+		n++
+		if !key.Valid {
+			continue
+		}
+		b.Text, b.Source, b.ConversationID, b.MessageIdx = text.String, source.String, conv.Int64, int(idx.Int32)
+		c.Prompt = strings.TrimSpace(c.Prompt)
+		a.Text, b.Text = strings.TrimSpace(a.Text), strings.TrimSpace(b.Text)
+		c.Responses = orderPreferenceResponses(key.String, a, b, seed)
+		return &c, last, n, nil
+	}
+	return nil, last, n, rows.Err()
+}
+
+// orderPreferenceResponses returns a and b in an order derived from seed and the
+// candidate's key.
+func orderPreferenceResponses(key string, a, b PreferenceResponse, seed int64) []PreferenceResponse {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	if sampleFraction(int64(h.Sum64()), seed) < 0.5 {
+		return []PreferenceResponse{b, a}
+	}
+	return []PreferenceResponse{a, b}
+}
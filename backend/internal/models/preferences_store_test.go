@@ -0,0 +1,99 @@
+package models
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestNormalizePreferencePair(t *testing.T) {
+	conv, idx := int64(3), 1
+	p, err := NormalizePreferencePair(PreferencePair{ConversationID: &conv, MessageIdx: &idx, Chosen: " a ", Rejected: "b", Rater: " ana ", Split: "VALID"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Chosen != "a" || p.Rater != "ana" || p.Split != SplitValid {
+		t.Fatalf("unexpected normalized pair: %+v", p)
+	}
+
+	p, err = NormalizePreferencePair(PreferencePair{Prompt: "q", Chosen: "same ", Rejected: " same", Rater: "ana"})
+	if err == nil || !strings.Contains(err.Error(), "identical") {
+		t.Fatalf("expected identical chosen and rejected rejected, got %v", err)
+	}
+	if _, err := NormalizePreferencePair(PreferencePair{ConversationID: &conv, Chosen: "a", Rejected: "b", Rater: "ana"}); err == nil {
+		t.Fatal("expected a conversation without message_idx or prompt to be rejected")
+	}
+}
+
+func TestPreferencePrompt(t *testing.T) {
+	msgs := []Message{
+		{Role: RoleSystem, Content: "be brief"},
+		{Role: RoleAssistant, Content: "hello"},
+		{Role: RoleUser, Content: " q "},
+		{Role: RoleAssistant, Content: "a"},
+	}
+	if got, err := preferencePrompt(msgs, 3); err != nil || got != "q" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	for _, idx := range []int{1, 2, 4} {
+		if _, err := preferencePrompt(msgs, idx); err == nil {
+			t.Fatalf("expected message %d to be rejected", idx)
+		}
+	}
+}
+
+func TestOrderPreferenceResponses(t *testing.T) {
+	a := PreferenceResponse{Text: "a", Source: PreferenceSourceMessage}
+	b := PreferenceResponse{Text: "b", Source: PreferenceSourceAlternative}
+	firsts := map[string]bool{}
+	for seed := int64(0); seed < 32; seed++ {
+		got := orderPreferenceResponses("a7", a, b, seed)
+		if again := orderPreferenceResponses("a7", a, b, seed); again[0] != got[0] {
+			t.Fatalf("seed %d: order is not reproducible", seed)
+		}
+		firsts[got[0].Text] = true
+	}
+	if !firsts["a"] || !firsts["b"] {
+		t.Fatalf("expected both orders across seeds, got %v", firsts)
+	}
+}
+
+func TestPreferencePairsFilterQuery(t *testing.T) {
+	q, args := preferencePairsFilterQuery(ExportOptions{DatasetID: 4, Split: "train", Status: "approved"})
+	if !strings.Contains(q, "dataset_id = $1") || !strings.Contains(q, "split = $2") || len(args) != 2 || strings.Contains(q, "status") {
+		t.Fatalf("unexpected query %s %v", q, args)
+	}
+	q, args = preferencePairsFilterQuery(ExportOptions{Split: "all", PublicOnly: true, ProjectID: 2})
+	if !strings.Contains(q, "visibility = 'public'") || !strings.Contains(q, "project_id = $1") || len(args) != 1 || strings.Contains(q, "split =") {
+		t.Fatalf("unexpected cross-dataset query %s %v", q, args)
+	}
+	if (ExportOptions{Type: ExportTypeDPO, Split: "all", MaxExamples: 10, Stratify: StratifyProportional}).stratified() {
+		t.Fatal("dpo exports are never stratified")
+	}
+}
+
+func TestPreferenceCandidateSQL_LooksUpByHashes(t *testing.T) {
+	for _, want := range []string{
+		"md5(u.content) = md5(r.prompt) AND u.content = r.prompt",
+		"md5(p.prompt) = md5(btrim(r.prompt))",
+	} {
+		if !strings.Contains(preferenceCandidateSQL, want) {
+			t.Errorf("expected %q in the candidate query", want)
+		}
+	}
+	b, err := os.ReadFile("../../migrations/038_preference_prompt_hash.no-tx.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"ON conversation_messages (md5(content)) WHERE role = 'user'",
+		"ON preference_pairs (dataset_id, md5(prompt))",
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("expected migration 038 to index %q", want)
+		}
+	}
+	if strings.Contains(string(b), "ALTER TABLE") || strings.Count(string(b), "CREATE INDEX CONCURRENTLY") != 2 {
+		t.Fatalf("expected migration 038 to only build indexes concurrently")
+	}
+}
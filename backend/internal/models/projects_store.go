@@ -0,0 +1,184 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultProjectSlug and DefaultProjectID name the project (migration 024) that holds
+// datasets created without one.
+const (
+	DefaultProjectSlug       = "default"
+	DefaultProjectID   int64 = 1
+)
+
+const maxProjectSlugLen = 64
+
+// Project groups the datasets of one team.
+type Project struct {
+	ID           int64     `json:"id"`
+	Slug         string    `json:"slug"`
+	Name         string    `json:"name"`
+	DatasetCount int64     `json:"dataset_count"` // live datasets, soft-deleted ones excluded
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ValidProjectSlug reports whether slug is 1..64 lowercase letters, digits and dashes,
+// starting with a letter or digit.
+func ValidProjectSlug(slug string) bool {
+	if slug == "" || len(slug) > maxProjectSlugLen {
+		return false
+	}
+	for i, r := range slug {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case r == '-' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+const projectColumns = `p.id, p.slug, p.name,
+  (SELECT COUNT(*) FROM datasets d WHERE d.project_id = p.id AND d.deleted_at IS NULL),
+  p.created_at, p.updated_at`
+
+func scanProject(row interface{ Scan(...any) error }) (Project, error) {
+	var p Project
+	err := row.Scan(&p.ID, &p.Slug, &p.Name, &p.DatasetCount, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
+
+func ListProjects(ctx context.Context, db *sql.DB) ([]Project, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+projectColumns+` FROM projects p ORDER BY p.slug ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Project{}
+	for rows.Next() {
+		p, err := scanProject(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func GetProjectBySlug(ctx context.Context, db *sql.DB, slug string) (Project, error) {
+	p, err := scanProject(db.QueryRowContext(ctx, `SELECT `+projectColumns+` FROM projects p WHERE p.slug = $1`, slug))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Project{}, ErrNotFound
+		}
+		return Project{}, err
+	}
+	return p, nil
+}
+
+// ProjectID resolves a project slug to its id; "" is the default project.
+func ProjectID(ctx context.Context, db *sql.DB, slug string) (int64, error) {
+	slug = strings.TrimSpace(slug)
+	if slug == "" {
+		slug = DefaultProjectSlug
+	}
+	var id int64
+	err := db.QueryRowContext(ctx, `SELECT id FROM projects WHERE slug = $1`, slug).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%w: project %q not found", ErrNotFound, slug)
+		}
+		return 0, err
+	}
+	return id, nil
+}
+
+// normalizeProject validates a slug and name; the name defaults to the slug.
+func normalizeProject(slug, name string) (string, string, error) {
+	var verr ValidationError
+	slug = strings.TrimSpace(slug)
+	if !ValidProjectSlug(slug) {
+		verr.Add("slug", "invalid slug (lowercase letters, digits and dashes, at most 64)")
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = slug
+	}
+	return slug, name, verr.Err()
+}
+
+func CreateProject(ctx context.Context, db *sql.DB, slug, name string) (Project, error) {
+	slug, name, err := normalizeProject(slug, name)
+	if err != nil {
+		return Project{}, err
+	}
+	var id int64
+	err = db.QueryRowContext(ctx, `INSERT INTO projects (slug, name) VALUES ($1, $2) RETURNING id`, slug, name).Scan(&id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return Project{}, fmt.Errorf("%w: project %q already exists", ErrConflict, slug)
+		}
+		return Project{}, err
+	}
+	return GetProjectBySlug(ctx, db, slug)
+}
+
+// RenameProject changes a project's display name; slugs are permanent since URLs use them.
+func RenameProject(ctx context.Context, db *sql.DB, slug, name string) (Project, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		var verr ValidationError
+		verr.Add("name", "name required")
+		return Project{}, verr.Err()
+	}
+	res, err := db.ExecContext(ctx, `UPDATE projects SET name = $2, updated_at = $3 WHERE slug = $1`, slug, name, time.Now().UTC())
+	if err != nil {
+		return Project{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return Project{}, ErrNotFound
+	}
+	return GetProjectBySlug(ctx, db, slug)
+}
+
+// DeleteProject removes an empty project. The default project, and projects that still hold
+// datasets (soft-deleted ones included), yield ErrConflict.
+func DeleteProject(ctx context.Context, db *sql.DB, slug string) error {
+	if slug == DefaultProjectSlug {
+		return fmt.Errorf("%w: the default project cannot be deleted", ErrConflict)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id, datasets int64
+	err = tx.QueryRowContext(ctx, `
+SELECT p.id, (SELECT COUNT(*) FROM datasets d WHERE d.project_id = p.id)
+FROM projects p
+WHERE p.slug = $1
+FOR UPDATE
+`, slug).Scan(&id, &datasets)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+	if datasets > 0 {
+		return fmt.Errorf("%w: project %q still has %d datasets", ErrConflict, slug, datasets)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM projects WHERE id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidProjectSlug(t *testing.T) {
+	for _, ok := range []string{"default", "team-a", "a", "2024-evals", strings.Repeat("x", 64)} {
+		if !ValidProjectSlug(ok) {
+			t.Fatalf("%q should be valid", ok)
+		}
+	}
+	for _, bad := range []string{"", "-team", "Team", "team_a", "team a", "tëam", strings.Repeat("x", 65)} {
+		if ValidProjectSlug(bad) {
+			t.Fatalf("%q should be invalid", bad)
+		}
+	}
+}
+
+func TestNormalizeProject(t *testing.T) {
+	slug, name, err := normalizeProject(" team-a ", "")
+	if err != nil || slug != "team-a" || name != "team-a" {
+		t.Fatalf("got %q %q %v", slug, name, err)
+	}
+	var verr *ValidationError
+	if _, _, err := normalizeProject("Team A", "Team A"); !errors.As(err, &verr) || verr.Fields["slug"] == "" {
+		t.Fatalf("expected a slug field error, got %v", err)
+	}
+}
+
+func TestConversationsFilterQuery_Project(t *testing.T) {
+	q, args := conversationsFilterQuery(ExportOptions{Status: "approved", Split: "train", ProjectID: 2, PublicOnly: true})
+	if !strings.Contains(q, "visibility = 'public'") || !strings.Contains(q, "project_id = $2") || args[1] != int64(2) {
+		t.Fatalf("expected public and project filters, got %s %v", q, args)
+	}
+	// A single dataset export is scoped by the dataset itself.
+	q, _ = conversationsFilterQuery(ExportOptions{Status: "approved", DatasetID: 5, ProjectID: 2})
+	if strings.Contains(q, "project_id") {
+		t.Fatalf("unexpected project filter with dataset_id: %s", q)
+	}
+}
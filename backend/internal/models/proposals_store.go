@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -15,8 +16,11 @@ type Proposal struct {
 	DecidedAt *time.Time      `json:"decided_at"`
 }
 
-func CreateProposal(ctx context.Context, db *sql.DB, payload json.RawMessage) (Proposal, error) {
-	row := db.QueryRowContext(ctx, `
+// CreateProposal inserts a pending proposal. q is a *sql.DB or *sql.Tx.
+func CreateProposal(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}, payload json.RawMessage) (Proposal, error) {
+	row := q.QueryRowContext(ctx, `
 INSERT INTO proposals (payload, status)
 VALUES ($1, $2)
 RETURNING id, payload, status, created_at, decided_at
@@ -53,6 +57,22 @@ LIMIT 500
 	return out, rows.Err()
 }
 
+func GetProposal(ctx context.Context, db *sql.DB, id int64) (Proposal, error) {
+	var p Proposal
+	err := db.QueryRowContext(ctx, `
+SELECT id, payload, status, created_at, decided_at
+FROM proposals
+WHERE id = $1
+`, id).Scan(&p.ID, &p.Payload, &p.Status, &p.CreatedAt, &p.DecidedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Proposal{}, ErrNotFound
+		}
+		return Proposal{}, err
+	}
+	return p, nil
+}
+
 func GetProposalForDecision(ctx context.Context, tx *sql.Tx, id int64) (Proposal, error) {
 	var p Proposal
 	err := tx.QueryRowContext(ctx, `
@@ -106,3 +126,33 @@ WHERE id = $1 AND status = $3
 	}
 	return nil
 }
+
+// PurgeProposals clears out proposals decided as status (rejected or approved) before
+// olderThan ago and returns how many it purged. Rejected proposals are deleted. Approved
+// ones stay, since the row is the provenance of the conversation they became, but their
+// payload loses its messages, which that conversation already holds.
+func PurgeProposals(ctx context.Context, db *sql.DB, status string, olderThan time.Duration) (int64, error) {
+	if olderThan <= 0 {
+		return 0, fmt.Errorf("%w: older_than must be positive", ErrInvalidInput)
+	}
+	cutoff := time.Now().UTC().Add(-olderThan)
+
+	var res sql.Result
+	var err error
+	switch status {
+	case ProposalStatusRejected:
+		res, err = db.ExecContext(ctx, `DELETE FROM proposals WHERE status = $1 AND decided_at < $2`, status, cutoff)
+	case ProposalStatusApproved:
+		res, err = db.ExecContext(ctx, `
+UPDATE proposals
+SET payload = payload - 'messages'
+WHERE status = $1 AND decided_at < $2 AND payload ? 'messages'
+`, status, cutoff)
+	default:
+		return 0, fmt.Errorf("%w: only rejected or approved proposals can be purged", ErrInvalidInput)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPurgeProposals_Validation(t *testing.T) {
+	ctx := context.Background()
+	if _, err := PurgeProposals(ctx, nil, ProposalStatusPending, time.Hour); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("pending: expected ErrInvalidInput, got %v", err)
+	}
+	if _, err := PurgeProposals(ctx, nil, ProposalStatusRejected, 0); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("zero age: expected ErrInvalidInput, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	MinRatingScore = 1
+	MaxRatingScore = 5
+)
+
+type Rating struct {
+	ConversationID int64     `json:"conversation_id"`
+	Rater          string    `json:"rater"`
+	Score          int       `json:"score"`
+	Note           string    `json:"note"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// avgRatingSQL is the average score of conversation c, NULL when unrated.
+const avgRatingSQL = `(SELECT AVG(r.score)::float8 FROM conversation_ratings r WHERE r.conversation_id = c.id)`
+
+// ValidateRating checks rater and score before a rating is stored.
+func ValidateRating(rater string, score int) error {
+	if strings.TrimSpace(rater) == "" {
+		return fmt.Errorf("%w: rater required", ErrInvalidInput)
+	}
+	if score < MinRatingScore || score > MaxRatingScore {
+		return fmt.Errorf("%w: score must be %d-%d", ErrInvalidInput, MinRatingScore, MaxRatingScore)
+	}
+	return nil
+}
+
+// UpsertRating records rater's score for a conversation. A second rating by the same rater
+// replaces the first; created reports whether a new row was inserted.
+func UpsertRating(ctx context.Context, db *sql.DB, conversationID int64, rater string, score int, note string) (r Rating, created bool, err error) {
+	if err := ValidateRating(rater, score); err != nil {
+		return Rating{}, false, err
+	}
+
+	err = db.QueryRowContext(ctx, `
+INSERT INTO conversation_ratings (conversation_id, rater, score, note)
+SELECT id, $2, $3, $4 FROM conversations WHERE id = $1
+ON CONFLICT (conversation_id, rater) DO UPDATE
+SET score = EXCLUDED.score,
+    note = EXCLUDED.note,
+    updated_at = now()
+RETURNING conversation_id, rater, score, note, created_at, updated_at, (xmax = 0)
+`, conversationID, strings.TrimSpace(rater), score, strings.TrimSpace(note)).Scan(
+		&r.ConversationID, &r.Rater, &r.Score, &r.Note, &r.CreatedAt, &r.UpdatedAt, &created)
+	if err != nil {
+		// No row: the conversation does not exist. A foreign key violation: it was deleted
+		// while the rating was being written.
+		if errors.Is(err, sql.ErrNoRows) || isForeignKeyViolation(err) {
+			return Rating{}, false, ErrNotFound
+		}
+		return Rating{}, false, err
+	}
+	return r, created, nil
+}
+
+func ListRatings(ctx context.Context, db *sql.DB, conversationID int64) ([]Rating, error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT conversation_id, rater, score, note, created_at, updated_at
+FROM conversation_ratings
+WHERE conversation_id = $1
+ORDER BY created_at ASC, id ASC
+`, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Rating{}
+	for rows.Next() {
+		var r Rating
+		if err := rows.Scan(&r.ConversationID, &r.Rater, &r.Score, &r.Note, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateRating(t *testing.T) {
+	if err := ValidateRating("alice", 4); err != nil {
+		t.Fatalf("expected valid rating, got %v", err)
+	}
+	for _, tc := range []struct {
+		rater string
+		score int
+	}{
+		{"", 3},
+		{"  ", 3},
+		{"alice", 0},
+		{"alice", 6},
+	} {
+		if err := ValidateRating(tc.rater, tc.score); !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("ValidateRating(%q, %d): expected ErrInvalidInput, got %v", tc.rater, tc.score, err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+)
+
+// MaxSampleSize caps the sample endpoints.
+const MaxSampleSize = 200
+
+// sampleOrderSQL orders rows by idCol pseudo-randomly but reproducibly for a given seed ($2).
+func sampleOrderSQL(idCol string) string {
+	return `md5(` + idCol + `::text || ':' || $2::text)`
+}
+
+// SampleDatasetItems returns n items of a dataset in a seed-determined random order; the same
+// seed returns the same sample while the dataset is unchanged.
+func SampleDatasetItems(ctx context.Context, db *sql.DB, datasetID int64, n int, seed int64) ([]DatasetItem, error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT `+datasetItemColumnsSQL+`
+FROM dataset_items JOIN datasets d ON d.id = dataset_items.dataset_id
+WHERE dataset_items.dataset_id = $1
+ORDER BY `+sampleOrderSQL("dataset_items.id")+`
+LIMIT $3
+`, datasetID, seed, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanDatasetItems(rows)
+}
+
+// SampleConversations is SampleDatasetItems for conversation datasets, with full messages.
+func SampleConversations(ctx context.Context, db *sql.DB, datasetID int64, n int, seed int64) ([]Conversation, error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT id
+FROM conversations
+WHERE dataset_id = $1
+ORDER BY `+sampleOrderSQL("id")+`
+LIMIT $3
+`, datasetID, seed, n)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// The caller has already checked the dataset, so private ones are included.
+	return GetConversationsByIDs(ctx, db, ids, true)
+}
+
+type KeyCount struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// ItemSampleStats summarizes a sample of items.
+type ItemSampleStats struct {
+	Count        int        `json:"count"`
+	AvgDataBytes float64    `json:"avg_data_bytes"`
+	TopKeys      []KeyCount `json:"top_keys"` // top-level keys of object items, most frequent first
+}
+
+// SummarizeItemSample computes ItemSampleStats, keeping at most topN keys.
+func SummarizeItemSample(items []DatasetItem, topN int) ItemSampleStats {
+	st := ItemSampleStats{Count: len(items), TopKeys: []KeyCount{}}
+	if len(items) == 0 {
+		return st
+	}
+
+	var total int
+	counts := map[string]int{}
+	for _, it := range items {
+		total += len(it.Data)
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(it.Data, &obj) != nil {
+			continue
+		}
+		for k := range obj {
+			counts[k]++
+		}
+	}
+	st.AvgDataBytes = float64(total) / float64(len(items))
+
+	for k, n := range counts {
+		st.TopKeys = append(st.TopKeys, KeyCount{Key: k, Count: n})
+	}
+	sort.Slice(st.TopKeys, func(i, j int) bool {
+		if st.TopKeys[i].Count != st.TopKeys[j].Count {
+			return st.TopKeys[i].Count > st.TopKeys[j].Count
+		}
+		return st.TopKeys[i].Key < st.TopKeys[j].Key
+	})
+	if len(st.TopKeys) > topN {
+		st.TopKeys = st.TopKeys[:topN]
+	}
+	return st
+}
+
+// ConversationSampleStats summarizes a sample of conversations.
+type ConversationSampleStats struct {
+	Count       int            `json:"count"`
+	AvgMessages float64        `json:"avg_messages"`
+	Splits      map[string]int `json:"splits"`
+	Statuses    map[string]int `json:"statuses"`
+}
+
+func SummarizeConversationSample(convs []Conversation) ConversationSampleStats {
+	st := ConversationSampleStats{Count: len(convs), Splits: map[string]int{}, Statuses: map[string]int{}}
+	if len(convs) == 0 {
+		return st
+	}
+	var msgs int
+	for _, c := range convs {
+		msgs += len(c.Messages)
+		st.Splits[string(c.Split)]++
+		st.Statuses[string(c.Status)]++
+	}
+	st.AvgMessages = float64(msgs) / float64(len(convs))
+	return st
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSummarizeItemSample(t *testing.T) {
+	items := []DatasetItem{
+		{Data: json.RawMessage(`{"text":"a","label":1}`)},
+		{Data: json.RawMessage(`{"text":"bb"}`)},
+		{Data: json.RawMessage(`["not","an","object"]`)},
+		{Data: json.RawMessage(`{"text":"c","label":0,"lang":"en"}`)},
+	}
+	st := SummarizeItemSample(items, 2)
+	if st.Count != 4 {
+		t.Fatalf("unexpected count: %d", st.Count)
+	}
+	want := float64(len(`{"text":"a","label":1}`)+len(`{"text":"bb"}`)+len(`["not","an","object"]`)+len(`{"text":"c","label":0,"lang":"en"}`)) / 4
+	if st.AvgDataBytes != want {
+		t.Fatalf("avg bytes: got %v, want %v", st.AvgDataBytes, want)
+	}
+	if len(st.TopKeys) != 2 || st.TopKeys[0] != (KeyCount{"text", 3}) || st.TopKeys[1] != (KeyCount{"label", 2}) {
+		t.Fatalf("unexpected top keys: %+v", st.TopKeys)
+	}
+
+	if empty := SummarizeItemSample(nil, 10); empty.Count != 0 || empty.TopKeys == nil {
+		t.Fatalf("unexpected empty summary: %+v", empty)
+	}
+}
+
+func TestSummarizeConversationSample(t *testing.T) {
+	st := SummarizeConversationSample([]Conversation{
+		{Split: SplitTrain, Status: ConversationStatusApproved, Messages: make([]Message, 2)},
+		{Split: SplitTest, Status: ConversationStatusApproved, Messages: make([]Message, 4)},
+	})
+	if st.AvgMessages != 3 || st.Splits["train"] != 1 || st.Splits["test"] != 1 || st.Statuses["approved"] != 2 {
+		t.Fatalf("unexpected summary: %+v", st)
+	}
+}
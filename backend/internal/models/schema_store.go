@@ -0,0 +1,147 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math"
+	"sort"
+)
+
+// MaxSchemaSample caps the sample=N parameter of the items schema endpoint.
+const MaxSchemaSample = 100000
+
+// schemaExamples is how many distinct example values are kept per key; each is cut to
+// schemaExampleChars characters of its JSON text.
+const (
+	schemaExamples     = 3
+	schemaExampleChars = 80
+)
+
+// SchemaKey describes one key observed in dataset_items.data. Nested keys of object
+// values are reported one level deep as "parent.child".
+type SchemaKey struct {
+	Key      string         `json:"key"`
+	Count    int            `json:"count"`    // items that have the key
+	Presence float64        `json:"presence"` // Count as a percentage of scanned items
+	Types    map[string]int `json:"types"`    // jsonb_typeof -> count
+	Examples []string       `json:"examples"` // distinct JSON texts, truncated
+}
+
+// ItemSchema is the inferred shape of an items dataset.
+type ItemSchema struct {
+	Scanned int         `json:"scanned"`
+	Sampled bool        `json:"sampled"`
+	Keys    []SchemaKey `json:"keys"`
+}
+
+// schemaRow is one (key, type) group from the aggregation query.
+type schemaRow struct {
+	Key      string
+	Type     string
+	Count    int
+	Examples []string
+}
+
+// InferItemSchema aggregates the keys of a dataset's item data. sample > 0 looks at that
+// many randomly chosen items instead of all of them.
+func InferItemSchema(ctx context.Context, db *sql.DB, datasetID int64, sample int) (ItemSchema, error) {
+	var total int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM dataset_items WHERE dataset_id = $1`, datasetID).Scan(&total); err != nil {
+		return ItemSchema{}, err
+	}
+	out := ItemSchema{Scanned: total, Keys: []SchemaKey{}}
+	if sample > 0 && sample < total {
+		out.Scanned, out.Sampled = sample, true
+	}
+	if out.Scanned == 0 {
+		return out, nil
+	}
+
+	// LIMIT NULL means no limit, so the full scan shares the query without the sort.
+	var limit any
+	order := ""
+	if out.Sampled {
+		limit, order = sample, "ORDER BY random()"
+	}
+	rows, err := db.QueryContext(ctx, `
+WITH s AS (
+  SELECT data
+  FROM dataset_items
+  WHERE dataset_id = $1 AND jsonb_typeof(data) = 'object'
+  `+order+`
+  LIMIT $2
+),
+top AS (
+  SELECT e.key, e.value FROM s, jsonb_each(s.data) e
+),
+fields AS (
+  SELECT key, value FROM top
+  UNION ALL
+  SELECT top.key || '.' || n.key, n.value
+  FROM top, jsonb_each(top.value) n
+  WHERE jsonb_typeof(top.value) = 'object'
+)
+SELECT key, jsonb_typeof(value), COUNT(*),
+  to_jsonb((array_agg(DISTINCT LEFT(value::text, $3)))[1:$4])
+FROM fields
+GROUP BY key, jsonb_typeof(value)
+`, datasetID, limit, schemaExampleChars, schemaExamples)
+	if err != nil {
+		return ItemSchema{}, err
+	}
+	defer rows.Close()
+
+	var groups []schemaRow
+	for rows.Next() {
+		var g schemaRow
+		var examplesRaw []byte
+		if err := rows.Scan(&g.Key, &g.Type, &g.Count, &examplesRaw); err != nil {
+			return ItemSchema{}, err
+		}
+		_ = json.Unmarshal(examplesRaw, &g.Examples)
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return ItemSchema{}, err
+	}
+
+	out.Keys = buildSchemaKeys(out.Scanned, groups)
+	return out, nil
+}
+
+// buildSchemaKeys merges per-type groups into one entry per key, most common keys first.
+func buildSchemaKeys(scanned int, groups []schemaRow) []SchemaKey {
+	byKey := map[string]*SchemaKey{}
+	var keys []*SchemaKey
+	for _, g := range groups {
+		k := byKey[g.Key]
+		if k == nil {
+			k = &SchemaKey{Key: g.Key, Types: map[string]int{}, Examples: []string{}}
+			byKey[g.Key] = k
+			keys = append(keys, k)
+		}
+		k.Count += g.Count
+		k.Types[g.Type] += g.Count
+		for _, ex := range g.Examples {
+			if len(k.Examples) < schemaExamples {
+				k.Examples = append(k.Examples, ex)
+			}
+		}
+	}
+
+	out := make([]SchemaKey, 0, len(keys))
+	for _, k := range keys {
+		if scanned > 0 {
+			k.Presence = math.Round(float64(k.Count)*1000/float64(scanned)) / 10
+		}
+		out = append(out, *k)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out
+}
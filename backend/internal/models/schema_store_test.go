@@ -0,0 +1,41 @@
+package models
+
+import "testing"
+
+func TestBuildSchemaKeys(t *testing.T) {
+	keys := buildSchemaKeys(4, []schemaRow{
+		{Key: "meta", Type: "object", Count: 2, Examples: []string{`{"model": "a"}`}},
+		{Key: "text", Type: "string", Count: 3, Examples: []string{`"a"`, `"b"`}},
+		{Key: "text", Type: "null", Count: 1, Examples: []string{"null"}},
+		{Key: "meta.model", Type: "string", Count: 2, Examples: []string{`"a"`}},
+		{Key: "label", Type: "number", Count: 2},
+	})
+
+	if len(keys) != 4 {
+		t.Fatalf("expected 4 keys, got %+v", keys)
+	}
+	text := keys[0]
+	if text.Key != "text" || text.Count != 4 || text.Presence != 100 {
+		t.Fatalf("expected text first with full presence, got %+v", text)
+	}
+	if text.Types["string"] != 3 || text.Types["null"] != 1 {
+		t.Fatalf("unexpected types: %v", text.Types)
+	}
+	if len(text.Examples) != 3 {
+		t.Fatalf("expected examples merged up to the limit, got %v", text.Examples)
+	}
+	// Ties on count sort by key.
+	if keys[1].Key != "label" || keys[2].Key != "meta" || keys[3].Key != "meta.model" {
+		t.Fatalf("unexpected order: %s %s %s", keys[1].Key, keys[2].Key, keys[3].Key)
+	}
+	if keys[1].Presence != 50 || keys[1].Examples == nil {
+		t.Fatalf("unexpected label entry: %+v", keys[1])
+	}
+}
+
+func TestBuildSchemaKeys_PresenceRounding(t *testing.T) {
+	keys := buildSchemaKeys(3, []schemaRow{{Key: "a", Type: "string", Count: 1}})
+	if keys[0].Presence != 33.3 {
+		t.Fatalf("expected 33.3, got %v", keys[0].Presence)
+	}
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type SourceCount struct {
+	Source string `json:"source"`
+	Count  int64  `json:"count"`
+}
+
+// ListSources returns the distinct conversation sources in a dataset with their counts,
+// most used first.
+func ListSources(ctx context.Context, db *sql.DB, datasetID int64) ([]SourceCount, error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT source, COUNT(*) AS n
+FROM conversations
+WHERE dataset_id = $1
+GROUP BY source
+ORDER BY n DESC, source ASC
+`, datasetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []SourceCount{}
+	for rows.Next() {
+		var sc SourceCount
+		if err := rows.Scan(&sc.Source, &sc.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, sc)
+	}
+	return out, rows.Err()
+}
+
+// appendSourceFilter adds the case-sensitive source= (exact) and source_prefix= conditions
+// on col; empty values add nothing.
+func appendSourceFilter(where []string, args []any, col, exact, prefix string) ([]string, []any) {
+	if exact != "" {
+		args = append(args, exact)
+		where = append(where, fmt.Sprintf("%s = $%d", col, len(args)))
+	}
+	if prefix != "" {
+		args = append(args, escapeLike(prefix)+"%")
+		where = append(where, fmt.Sprintf(`%s LIKE $%d ESCAPE '\'`, col, len(args)))
+	}
+	return where, args
+}
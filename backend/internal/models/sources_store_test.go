@@ -0,0 +1,28 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAppendSourceFilter(t *testing.T) {
+	where, args := appendSourceFilter([]string{"dataset_id = $1"}, []any{int64(7)}, "c.source", "", "")
+	if len(where) != 1 || len(args) != 1 {
+		t.Fatalf("empty filters should add nothing, got %v %v", where, args)
+	}
+
+	where, args = appendSourceFilter([]string{"dataset_id = $1"}, []any{int64(7)}, "c.source", "community", "synthetic:gpt_4o")
+	wantWhere := []string{"dataset_id = $1", "c.source = $2", `c.source LIKE $3 ESCAPE '\'`}
+	wantArgs := []any{int64(7), "community", `synthetic:gpt\_4o%`}
+	if !reflect.DeepEqual(where, wantWhere) || !reflect.DeepEqual(args, wantArgs) {
+		t.Fatalf("got %v %v", where, args)
+	}
+}
+
+func TestConversationsFilterQuery_Source(t *testing.T) {
+	q, args := conversationsFilterQuery(ExportOptions{Status: "approved", DatasetID: 3, Split: "train", SourcePrefix: "import:"})
+	if !strings.Contains(q, `source LIKE $4 ESCAPE '\'`) || args[3] != "import:%" {
+		t.Fatalf("expected the prefix filter as $4, got %s %v", q, args)
+	}
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// SplitTags maps splits to the tags that put a conversation there (see SplitByTag).
+type SplitTags struct {
+	Test  []string
+	Valid []string
+}
+
+// Normalize trims tags, drops empty and duplicate ones and rejects a mapping with no tags or
+// a tag listed for both splits.
+func (t SplitTags) Normalize() (SplitTags, error) {
+	seen := map[string]string{}
+	clean := func(split string, tags []string) ([]string, error) {
+		out := []string{}
+		for _, tag := range tags {
+			tag = strings.TrimSpace(tag)
+			if tag == "" {
+				continue
+			}
+			if prev, ok := seen[tag]; ok {
+				if prev != split {
+					return nil, fmt.Errorf("%w: tag %q is listed for both %s and %s", ErrInvalidInput, tag, prev, split)
+				}
+				continue
+			}
+			seen[tag] = split
+			out = append(out, tag)
+		}
+		return out, nil
+	}
+	var out SplitTags
+	var err error
+	if out.Test, err = clean(string(SplitTest), t.Test); err != nil {
+		return SplitTags{}, err
+	}
+	if out.Valid, err = clean(string(SplitValid), t.Valid); err != nil {
+		return SplitTags{}, err
+	}
+	if len(out.Test) == 0 && len(out.Valid) == 0 {
+		return SplitTags{}, fmt.Errorf("%w: at least one test or valid tag required", ErrInvalidInput)
+	}
+	return out, nil
+}
+
+// SplitByTag sets the split of every conversation in a dataset from its tags: any tag in
+// Test puts it in test, otherwise any tag in Valid puts it in valid, otherwise it goes to
+// train. Only conversations whose split changes are updated (and get a new updated_at), in
+// one statement. It returns how many conversations moved into each split.
+func SplitByTag(ctx context.Context, db *sql.DB, datasetID int64, tags SplitTags) (map[string]int64, error) {
+	tags, err := tags.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `
+WITH target AS (
+  SELECT id,
+    CASE
+      WHEN jsonb_typeof(tags) = 'array' AND tags ?| $2::text[] THEN 'test'
+      WHEN jsonb_typeof(tags) = 'array' AND tags ?| $3::text[] THEN 'valid'
+      ELSE 'train'
+    END AS split
+  FROM conversations
+  WHERE dataset_id = $1
+), moved AS (
+  UPDATE conversations c
+  SET split = t.split, updated_at = now()
+  FROM target t
+  WHERE c.id = t.id AND c.split <> t.split
+  RETURNING c.split
+)
+SELECT split, COUNT(*) FROM moved GROUP BY split
+`, datasetID, tags.Test, tags.Valid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]int64{string(SplitTrain): 0, string(SplitValid): 0, string(SplitTest): 0}
+	for rows.Next() {
+		var split string
+		var n int64
+		if err := rows.Scan(&split, &n); err != nil {
+			return nil, err
+		}
+		out[split] = n
+	}
+	return out, rows.Err()
+}
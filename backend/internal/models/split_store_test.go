@@ -0,0 +1,29 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSplitTags_Normalize(t *testing.T) {
+	got, err := SplitTags{Test: []string{" holdout ", "", "holdout"}, Valid: []string{"dev"}}.Normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := SplitTags{Test: []string{"holdout"}, Valid: []string{"dev"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	got, err = SplitTags{Valid: []string{"dev"}}.Normalize()
+	if err != nil || got.Test == nil || len(got.Test) != 0 {
+		t.Fatalf("a missing split should normalize to an empty list, got %+v %v", got, err)
+	}
+
+	for _, bad := range []SplitTags{{}, {Test: []string{" "}}, {Test: []string{"x"}, Valid: []string{"x"}}} {
+		if _, err := bad.Normalize(); !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("%+v: expected ErrInvalidInput, got %v", bad, err)
+		}
+	}
+}
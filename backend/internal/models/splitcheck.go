@@ -0,0 +1,138 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+)
+
+// SplitCollision is a piece of content found in train and in valid or test.
+type SplitCollision struct {
+	Kind       string `json:"kind"` // conversation|pair
+	Hash       string `json:"hash"`
+	TrainID    int64  `json:"train_id"`
+	OtherID    int64  `json:"other_id"`
+	OtherSplit string `json:"other_split"`
+}
+
+type splitHashEntry struct {
+	ID    int64
+	Split string
+	Msgs  []Message
+}
+
+// splitCheckBatch is how many conversations' messages CheckSplitPurity loads per query.
+const splitCheckBatch = 1000
+
+// CheckSplitPurity reports conversations in a dataset whose content (whole conversation or any
+// single pair) appears in both train and valid/test. status "" checks every status.
+func CheckSplitPurity(ctx context.Context, db *sql.DB, datasetID int64, status string) ([]SplitCollision, error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT id, split
+FROM conversations
+WHERE dataset_id = $1 AND ($2::text = '' OR status = $2)
+ORDER BY id ASC
+`, datasetID, status)
+	if err != nil {
+		return nil, err
+	}
+	var entries []splitHashEntry
+	for rows.Next() {
+		var e splitHashEntry
+		if err := rows.Scan(&e.ID, &e.Split); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for start := 0; start < len(entries); start += splitCheckBatch {
+		chunk := entries[start:min(start+splitCheckBatch, len(entries))]
+		ids := make([]int64, len(chunk))
+		for i := range chunk {
+			ids[i] = chunk[i].ID
+		}
+		byID, err := loadMessagesByConversation(ctx, db, ids)
+		if err != nil {
+			return nil, err
+		}
+		for i := range chunk {
+			chunk[i].Msgs = byID[chunk[i].ID]
+		}
+	}
+	return findSplitCollisions(entries), nil
+}
+
+func findSplitCollisions(entries []splitHashEntry) []SplitCollision {
+	type ref struct {
+		id    int64
+		split string
+	}
+	byHash := map[string][]ref{}
+	kinds := map[string]string{}
+	// A one-pair conversation hashes like its pair, so keys carry the kind.
+	add := func(kind, hash string, e splitHashEntry) {
+		hash = kind + ":" + hash
+		refs := byHash[hash]
+		for _, r := range refs {
+			if r.id == e.ID {
+				return // same pair repeated inside one conversation
+			}
+		}
+		byHash[hash] = append(refs, ref{e.ID, e.Split})
+		kinds[hash] = kind
+	}
+	for _, e := range entries {
+		add("conversation", ConversationContentHash(e.Msgs), e)
+		// Without a template, rendering can't fail.
+		pairs, _ := derivePairs(e.Msgs, ExportOptions{Context: "none"})
+		for _, p := range pairs {
+			add("pair", PairContentHash(p), e)
+		}
+	}
+
+	hashes := make([]string, 0, len(byHash))
+	for h := range byHash {
+		hashes = append(hashes, h)
+	}
+	sort.Strings(hashes)
+
+	var out []SplitCollision
+	seen := map[[2]int64]bool{} // whole-conversation matches hide their per-pair matches
+	for _, kind := range []string{"conversation", "pair"} {
+		for _, h := range hashes {
+			if kinds[h] != kind {
+				continue
+			}
+			refs := byHash[h]
+			for _, t := range refs {
+				if t.split != string(SplitTrain) {
+					continue
+				}
+				for _, o := range refs {
+					if o.split == string(SplitTrain) {
+						continue
+					}
+					key := [2]int64{t.id, o.id}
+					if seen[key] {
+						continue
+					}
+					seen[key] = true
+					out = append(out, SplitCollision{Kind: kind, Hash: strings.TrimPrefix(h, kind+":"), TrainID: t.id, OtherID: o.id, OtherSplit: o.split})
+				}
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].TrainID != out[j].TrainID {
+			return out[i].TrainID < out[j].TrainID
+		}
+		return out[i].OtherID < out[j].OtherID
+	})
+	return out
+}
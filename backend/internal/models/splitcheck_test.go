@@ -0,0 +1,45 @@
+package models
+
+import "testing"
+
+func qaMessages(pairs ...string) []Message {
+	var out []Message
+	for i := 0; i+1 < len(pairs); i += 2 {
+		out = append(out, Message{Role: RoleUser, Content: pairs[i]}, Message{Role: RoleAssistant, Content: pairs[i+1]})
+	}
+	return out
+}
+
+func TestFindSplitCollisions_DuplicatedPairAcrossSplits(t *testing.T) {
+	entries := []splitHashEntry{
+		{ID: 1, Split: "train", Msgs: qaMessages("What is 2+2?", "4", "And 3+3?", "6")},
+		{ID: 2, Split: "valid", Msgs: qaMessages("what is  2+2?", "4")}, // same pair, re-formatted
+		{ID: 3, Split: "test", Msgs: qaMessages("Capital of France?", "Paris")},
+		{ID: 4, Split: "train", Msgs: qaMessages("Capital of Spain?", "Madrid")},
+	}
+	got := findSplitCollisions(entries)
+	if len(got) != 1 {
+		t.Fatalf("expected 1 collision, got %+v", got)
+	}
+	c := got[0]
+	if c.Kind != "pair" || c.TrainID != 1 || c.OtherID != 2 || c.OtherSplit != "valid" {
+		t.Fatalf("unexpected collision: %+v", c)
+	}
+}
+
+func TestFindSplitCollisions_WholeConversationReportedOnce(t *testing.T) {
+	entries := []splitHashEntry{
+		{ID: 1, Split: "train", Msgs: qaMessages("hi", "hello")},
+		{ID: 2, Split: "test", Msgs: qaMessages("Hi", "Hello")},
+		{ID: 3, Split: "train", Msgs: qaMessages("hi", "hello")}, // train/train duplicates are fine
+	}
+	got := findSplitCollisions(entries)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 collisions, got %+v", got)
+	}
+	for _, c := range got {
+		if c.Kind != "conversation" || c.OtherID != 2 {
+			t.Fatalf("unexpected collision: %+v", c)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MaxStatsHistoryPoints bounds one history response; at one snapshot a day it is over five
+// years.
+const MaxStatsHistoryPoints = 2000
+
+// DatasetStats is what a stats snapshot records: the export manifest's totals plus average
+// messages and estimated tokens per conversation.
+type DatasetStats struct {
+	ConversationStats
+
+	AvgMessages float64 `json:"avg_messages"`
+	// AvgTokens uses the default heuristic estimator (see tokens.Heuristic), computed in SQL.
+	AvgTokens float64 `json:"avg_tokens"`
+}
+
+// DatasetStatsSnapshot is one point of a dataset's stats history.
+type DatasetStatsSnapshot struct {
+	ID        int64        `json:"id"`
+	DatasetID int64        `json:"dataset_id"`
+	TakenAt   time.Time    `json:"taken_at"`
+	Stats     DatasetStats `json:"stats"`
+}
+
+// heuristicTokensSQL mirrors tokens.Heuristic for message m: a token per four characters,
+// rounded up, but never fewer than its words. Like strings.Fields, surrounding whitespace
+// does not make an empty word, and blank content has no words.
+const heuristicTokensSQL = `GREATEST((char_length(m.content) + 3) / 4,
+  COALESCE(array_length(regexp_split_to_array(NULLIF(btrim(m.content, E' \t\n\r'), ''), '\s+'), 1), 0))`
+
+// ComputeDatasetStats computes the current stats of datasetID with the same queries as the
+// export manifest totals.
+func ComputeDatasetStats(ctx context.Context, db *sql.DB, datasetID int64) (DatasetStats, error) {
+	totals, err := GetConversationStats(ctx, db, datasetID, false, 0)
+	if err != nil {
+		return DatasetStats{}, err
+	}
+	st := DatasetStats{ConversationStats: totals}
+	if totals.Conversations == 0 {
+		return st, nil
+	}
+	st.AvgMessages = float64(totals.Messages) / float64(totals.Conversations)
+
+	var tokens int64
+	err = db.QueryRowContext(ctx, `
+SELECT COALESCE(SUM(`+heuristicTokensSQL+`), 0)
+FROM conversation_messages m
+JOIN conversations c ON c.id = m.conversation_id
+WHERE c.dataset_id = $1
+`, datasetID).Scan(&tokens)
+	if err != nil {
+		return DatasetStats{}, err
+	}
+	st.AvgTokens = float64(tokens) / float64(totals.Conversations)
+	return st, nil
+}
+
+// SnapshotDatasetStats records the current stats of datasetID.
+func SnapshotDatasetStats(ctx context.Context, db *sql.DB, datasetID int64) (DatasetStatsSnapshot, error) {
+	st, err := ComputeDatasetStats(ctx, db, datasetID)
+	if err != nil {
+		return DatasetStatsSnapshot{}, err
+	}
+	raw, err := json.Marshal(st)
+	if err != nil {
+		return DatasetStatsSnapshot{}, err
+	}
+	s := DatasetStatsSnapshot{DatasetID: datasetID, Stats: st}
+	err = db.QueryRowContext(ctx, `
+INSERT INTO dataset_stats_history (dataset_id, stats)
+VALUES ($1, $2)
+RETURNING id, taken_at
+`, datasetID, raw).Scan(&s.ID, &s.TakenAt)
+	return s, err
+}
+
+// SnapshotDueDatasetStats snapshots every conversation dataset whose latest snapshot is
+// older than every, or that has none, and returns how many it snapshotted. Checking the latest snapshot rather
+// than a timer keeps restarts from snapshotting twice.
+func SnapshotDueDatasetStats(ctx context.Context, db *sql.DB, every time.Duration) (int, error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT d.id
+FROM datasets d
+WHERE d.kind = 'conversations' AND NOT EXISTS (
+  SELECT 1 FROM dataset_stats_history h WHERE h.dataset_id = d.id AND h.taken_at > $1
+)
+ORDER BY d.id ASC
+`, time.Now().UTC().Add(-every))
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, id := range ids {
+		if _, err := SnapshotDatasetStats(ctx, db, id); err != nil {
+			return n, fmt.Errorf("dataset %d: %w", id, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// ListDatasetStatsHistory returns the snapshots of datasetID taken in [from, to], oldest
+// first; a zero bound is open. At most MaxStatsHistoryPoints are returned, the oldest ones.
+func ListDatasetStatsHistory(ctx context.Context, db *sql.DB, datasetID int64, from, to time.Time) ([]DatasetStatsSnapshot, error) {
+	var fromArg, toArg any
+	if !from.IsZero() {
+		fromArg = from
+	}
+	if !to.IsZero() {
+		toArg = to
+	}
+	rows, err := db.QueryContext(ctx, `
+SELECT id, dataset_id, taken_at, stats
+FROM dataset_stats_history
+WHERE dataset_id = $1
+  AND ($2::timestamptz IS NULL OR taken_at >= $2)
+  AND ($3::timestamptz IS NULL OR taken_at <= $3)
+ORDER BY taken_at ASC, id ASC
+LIMIT $4
+`, datasetID, fromArg, toArg, MaxStatsHistoryPoints)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []DatasetStatsSnapshot{}
+	for rows.Next() {
+		var s DatasetStatsSnapshot
+		var raw []byte
+		if err := rows.Scan(&s.ID, &s.DatasetID, &s.TakenAt, &raw); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &s.Stats); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// GetDatasetStatsSnapshot returns snapshot id of datasetID; ErrNotFound when there is none.
+func GetDatasetStatsSnapshot(ctx context.Context, db *sql.DB, datasetID, id int64) (DatasetStatsSnapshot, error) {
+	var s DatasetStatsSnapshot
+	var raw []byte
+	err := db.QueryRowContext(ctx, `
+SELECT id, dataset_id, taken_at, stats
+FROM dataset_stats_history
+WHERE id = $1 AND dataset_id = $2
+`, id, datasetID).Scan(&s.ID, &s.DatasetID, &s.TakenAt, &raw)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return DatasetStatsSnapshot{}, ErrNotFound
+		}
+		return DatasetStatsSnapshot{}, err
+	}
+	if err := json.Unmarshal(raw, &s.Stats); err != nil {
+		return DatasetStatsSnapshot{}, err
+	}
+	return s, nil
+}
+
+// PruneDatasetStatsHistory deletes snapshots taken more than olderThan ago and returns how
+// many it deleted.
+func PruneDatasetStatsHistory(ctx context.Context, db *sql.DB, olderThan time.Duration) (int64, error) {
+	if olderThan <= 0 {
+		return 0, fmt.Errorf("%w: retention must be positive", ErrInvalidInput)
+	}
+	res, err := db.ExecContext(ctx, `DELETE FROM dataset_stats_history WHERE taken_at < $1`, time.Now().UTC().Add(-olderThan))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
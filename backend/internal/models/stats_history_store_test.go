@@ -0,0 +1,45 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDatasetStats_JSONRoundTrip(t *testing.T) {
+	st := DatasetStats{
+		ConversationStats: ConversationStats{
+			Conversations: 4,
+			Messages:      10,
+			BySplit:       map[string]int64{"train": 3, "test": 1},
+			ByStatus:      map[string]int64{"approved": 4},
+			ByTag:         map[string]int64{"math": 2},
+		},
+		AvgMessages: 2.5,
+		AvgTokens:   41.25,
+	}
+	raw, err := json.Marshal(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var flat map[string]any
+	if err := json.Unmarshal(raw, &flat); err != nil {
+		t.Fatal(err)
+	}
+	// The totals sit beside the averages, as in the stored document.
+	if flat["conversations"] != float64(4) || flat["avg_tokens"] != 41.25 {
+		t.Fatalf("unexpected document %s", raw)
+	}
+	var back DatasetStats
+	if err := json.Unmarshal(raw, &back); err != nil || !reflect.DeepEqual(back, st) {
+		t.Fatalf("round trip: got %+v %v", back, err)
+	}
+}
+
+func TestHeuristicTokensSQL_WordsOfTrimmedContent(t *testing.T) {
+	// Leading or trailing newlines must not add an empty word, and blank content has none.
+	if !strings.Contains(heuristicTokensSQL, `regexp_split_to_array(NULLIF(btrim(m.content, E' \t\n\r'), ''), '\s+')`) {
+		t.Fatalf("expected words split from the whitespace-trimmed content, blank as none: %s", heuristicTokensSQL)
+	}
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type ConversationStats struct {
+	Conversations int64            `json:"conversations"`
+	Messages      int64            `json:"messages"`
+	Items         int64            `json:"items"`
+	BySplit       map[string]int64 `json:"by_split"`
+	ByStatus      map[string]int64 `json:"by_status"`
+	ByTag         map[string]int64 `json:"by_tag"`
+}
+
+// GetConversationStats aggregates conversation counts by split, status and tag, over one
+// dataset or (datasetID 0) every dataset of project projectID, or of all projects when 0.
+// datasetID 0 aggregates across every dataset (only public ones when publicOnly is set).
+func GetConversationStats(ctx context.Context, db *sql.DB, datasetID int64, publicOnly bool, projectID int64) (ConversationStats, error) {
+	st := ConversationStats{
+		BySplit:  map[string]int64{},
+		ByStatus: map[string]int64{},
+		ByTag:    map[string]int64{},
+	}
+
+	rows, err := db.QueryContext(ctx, `
+SELECT split, status, COUNT(*)
+FROM conversations
+WHERE ($1::bigint = 0 OR dataset_id = $1)
+  AND (NOT $2::boolean OR dataset_id IN (SELECT id FROM datasets WHERE visibility = 'public'))
+  AND ($3::bigint = 0 OR dataset_id IN (SELECT id FROM datasets WHERE project_id = $3))
+GROUP BY split, status
+`, datasetID, publicOnly, projectID)
+	if err != nil {
+		return ConversationStats{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var split, status string
+		var n int64
+		if err := rows.Scan(&split, &status, &n); err != nil {
+			return ConversationStats{}, err
+		}
+		st.BySplit[split] += n
+		st.ByStatus[status] += n
+		st.Conversations += n
+	}
+	if err := rows.Err(); err != nil {
+		return ConversationStats{}, err
+	}
+
+	tagRows, err := db.QueryContext(ctx, `
+SELECT t.tag, COUNT(*)
+FROM conversations c
+CROSS JOIN LATERAL jsonb_array_elements_text(
+  CASE WHEN jsonb_typeof(c.tags) = 'array' THEN c.tags ELSE '[]'::jsonb END
+) AS t(tag)
+WHERE ($1::bigint = 0 OR c.dataset_id = $1)
+  AND (NOT $2::boolean OR c.dataset_id IN (SELECT id FROM datasets WHERE visibility = 'public'))
+  AND ($3::bigint = 0 OR c.dataset_id IN (SELECT id FROM datasets WHERE project_id = $3))
+GROUP BY t.tag
+`, datasetID, publicOnly, projectID)
+	if err != nil {
+		return ConversationStats{}, err
+	}
+	defer tagRows.Close()
+	for tagRows.Next() {
+		var tag string
+		var n int64
+		if err := tagRows.Scan(&tag, &n); err != nil {
+			return ConversationStats{}, err
+		}
+		st.ByTag[tag] = n
+	}
+	if err := tagRows.Err(); err != nil {
+		return ConversationStats{}, err
+	}
+
+	err = db.QueryRowContext(ctx, `
+SELECT
+  (SELECT COUNT(*) FROM conversation_messages m JOIN conversations c ON c.id = m.conversation_id
+   WHERE ($1::bigint = 0 OR c.dataset_id = $1)
+     AND (NOT $2::boolean OR c.dataset_id IN (SELECT id FROM datasets WHERE visibility = 'public'))),
+  (SELECT COUNT(*) FROM dataset_items
+   WHERE ($1::bigint = 0 OR dataset_id = $1)
+     AND (NOT $2::boolean OR dataset_id IN (SELECT id FROM datasets WHERE visibility = 'public')))
+`, datasetID, publicOnly).Scan(&st.Messages, &st.Items)
+	if err != nil {
+		return ConversationStats{}, err
+	}
+	return st, nil
+}
+
+// InstanceStats are the instance-wide totals behind GET /api/v1/stats.
+type InstanceStats struct {
+	Datasets         int64            `json:"datasets"`
+	Conversations    int64            `json:"conversations"`
+	ByStatus         map[string]int64 `json:"conversations_by_status"`
+	Items            int64            `json:"items"`
+	Messages         int64            `json:"messages"`
+	PendingProposals int64            `json:"pending_proposals"`
+	ComputedAt       time.Time        `json:"computed_at"`
+}
+
+// GetInstanceStats counts datasets, conversations (in total and by status), items, messages
+// and pending proposals across the whole instance. Soft-deleted datasets and their rows are
+// left out, as GET /api/v1/datasets leaves them out. The conversation and item totals add up
+// the datasets' trigger-maintained counts (migration 012) instead of counting rows.
+func GetInstanceStats(ctx context.Context, db *sql.DB) (InstanceStats, error) {
+	st := InstanceStats{ByStatus: map[string]int64{}}
+	err := db.QueryRowContext(ctx, `
+SELECT
+  (SELECT COUNT(*) FROM datasets WHERE deleted_at IS NULL),
+  (SELECT COALESCE(SUM(conversation_count), 0) FROM datasets WHERE deleted_at IS NULL),
+  (SELECT COALESCE(SUM(item_count), 0) FROM datasets WHERE deleted_at IS NULL),
+  (SELECT COUNT(*) FROM conversation_messages m
+   JOIN conversations c ON c.id = m.conversation_id
+   JOIN datasets d ON d.id = c.dataset_id
+   WHERE d.deleted_at IS NULL),
+  (SELECT COUNT(*) FROM proposals WHERE status = $1),
+  now()
+`, ProposalStatusPending).Scan(&st.Datasets, &st.Conversations, &st.Items, &st.Messages, &st.PendingProposals, &st.ComputedAt)
+	if err != nil {
+		return InstanceStats{}, err
+	}
+
+	rows, err := db.QueryContext(ctx, `
+SELECT c.status, COUNT(*)
+FROM conversations c
+JOIN datasets d ON d.id = c.dataset_id
+WHERE d.deleted_at IS NULL
+GROUP BY c.status
+`)
+	if err != nil {
+		return InstanceStats{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status string
+		var n int64
+		if err := rows.Scan(&status, &n); err != nil {
+			return InstanceStats{}, err
+		}
+		st.ByStatus[status] = n
+	}
+	return st, rows.Err()
+}
@@ -0,0 +1,161 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ExportOptions.Stratify values: how max_examples is shared across splits when Split is all.
+const (
+	StratifyProportional = "proportional" // by each split's conversation count (the default)
+	StratifyEqual        = "equal"        // the same budget for every non-empty split
+	StratifyNone         = "none"         // id order across splits, the pre-stratification behavior
+)
+
+// ParseStratify validates a stratify value; empty means proportional.
+func ParseStratify(s string) (string, error) {
+	switch g := strings.ToLower(strings.TrimSpace(s)); g {
+	case "":
+		return StratifyProportional, nil
+	case StratifyProportional, StratifyEqual, StratifyNone:
+		return g, nil
+	default:
+		return "", fmt.Errorf("%w: stratify must be proportional|equal|none, got %q", ErrInvalidInput, s)
+	}
+}
+
+// stratifySplits is the order splits are allocated and exported in.
+var stratifySplits = []string{string(SplitTrain), string(SplitValid), string(SplitTest)}
+
+// stratified reports whether opts asks for a split=all export whose MaxExamples is shared
+// out per split. Stratification counts conversations, so type=dpo is never stratified.
+func (o ExportOptions) stratified() bool {
+	return o.Split == "all" && o.MaxExamples > 0 && o.Stratify != StratifyNone && len(o.Interleave) == 0 && o.Type != ExportTypeDPO
+}
+
+// allocateSplitBudget shares budget across stratifySplits given each split's row count.
+// Proportional shares use the largest remainder, so they add up to budget exactly; equal
+// shares give each non-empty split budget/n, the remainder going to the earlier splits, and
+// a split with fewer rows than its share passes the unused part on to the larger ones.
+// Empty splits get nothing.
+func allocateSplitBudget(counts map[string]int64, budget int, mode string) map[string]int {
+	out := map[string]int{}
+	var total int64
+	nonEmpty := 0
+	for _, s := range stratifySplits {
+		if counts[s] > 0 {
+			total += counts[s]
+			nonEmpty++
+		}
+	}
+	if nonEmpty == 0 || budget <= 0 {
+		return out
+	}
+
+	if mode == StratifyEqual {
+		open := make([]string, 0, nonEmpty)
+		for _, s := range stratifySplits {
+			if counts[s] > 0 {
+				open = append(open, s)
+				out[s] = 0
+			}
+		}
+		for budget > 0 && len(open) > 0 {
+			share, extra := budget/len(open), budget%len(open)
+			next := open[:0]
+			for _, s := range open {
+				give := share
+				if extra > 0 {
+					give++
+					extra--
+				}
+				if room := counts[s] - int64(out[s]); int64(give) >= room {
+					give = int(room)
+				} else {
+					next = append(next, s)
+				}
+				out[s] += give
+				budget -= give
+			}
+			if len(next) == len(open) {
+				break
+			}
+			open = next
+		}
+		return out
+	}
+
+	assigned := 0
+	rems := map[string]int64{}
+	for _, s := range stratifySplits {
+		if counts[s] == 0 {
+			continue
+		}
+		n := int64(budget) * counts[s]
+		out[s] = int(n / total)
+		rems[s] = n % total
+		assigned += out[s]
+	}
+	for ; assigned < budget; assigned++ {
+		best := ""
+		for _, s := range stratifySplits {
+			if _, ok := rems[s]; ok && (best == "" || rems[s] > rems[best]) {
+				best = s
+			}
+		}
+		out[best]++
+		rems[best] = -1
+	}
+	return out
+}
+
+// countConversationsBySplit counts the conversations conversationsFilterQuery selects for
+// opts, per split.
+func countConversationsBySplit(ctx context.Context, db *sql.DB, opts ExportOptions) (map[string]int64, error) {
+	query, args := conversationsFilterQuery(opts)
+	rows, err := db.QueryContext(ctx, `SELECT split, COUNT(*) FROM (`+query+`) q GROUP BY split`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int64{}
+	for rows.Next() {
+		var split string
+		var n int64
+		if err := rows.Scan(&split, &n); err != nil {
+			return nil, err
+		}
+		counts[split] = n
+	}
+	return counts, rows.Err()
+}
+
+// streamStratified exports each split in turn with its share of opts.MaxExamples, recording
+// the lines written per split in opts.SplitLines when set.
+func streamStratified(ctx context.Context, db *sql.DB, w io.Writer, opts ExportOptions) error {
+	counts, err := countConversationsBySplit(ctx, db, opts)
+	if err != nil {
+		return err
+	}
+	budgets := allocateSplitBudget(counts, opts.MaxExamples, opts.Stratify)
+	for _, split := range stratifySplits {
+		if budgets[split] == 0 {
+			continue
+		}
+		splitOpts := opts
+		splitOpts.Split = split
+		splitOpts.MaxExamples = budgets[split]
+		lc := &LineCounter{}
+		if err := streamConversationExport(ctx, db, io.MultiWriter(w, lc), splitOpts); err != nil {
+			return err
+		}
+		if opts.SplitLines != nil {
+			opts.SplitLines[split] = lc.Lines
+		}
+	}
+	return nil
+}
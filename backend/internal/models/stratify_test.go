@@ -0,0 +1,86 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseStratify(t *testing.T) {
+	for in, want := range map[string]string{"": StratifyProportional, " Equal ": StratifyEqual, "none": StratifyNone} {
+		if got, err := ParseStratify(in); err != nil || got != want {
+			t.Fatalf("%q: expected %q, got %q %v", in, want, got, err)
+		}
+	}
+	if _, err := ParseStratify("random"); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected ErrInvalidInput, got %v", err)
+	}
+}
+
+// unevenSplits is a dataset with a large train split and small valid/test splits.
+var unevenSplits = map[string]int64{"train": 900, "valid": 70, "test": 30}
+
+func TestAllocateSplitBudget_Proportional(t *testing.T) {
+	got := allocateSplitBudget(unevenSplits, 100, StratifyProportional)
+	want := map[string]int{"train": 90, "valid": 7, "test": 3}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	// Largest remainder: 10 * (900, 70, 30) / 1000 = 9, 0.7, 0.3 -> valid takes the spare.
+	got = allocateSplitBudget(unevenSplits, 10, StratifyProportional)
+	want = map[string]int{"train": 9, "valid": 1, "test": 0}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestAllocateSplitBudget_Equal(t *testing.T) {
+	// test holds 30 of its 33; train and valid share the 3 it leaves over.
+	got := allocateSplitBudget(unevenSplits, 100, StratifyEqual)
+	want := map[string]int{"train": 36, "valid": 34, "test": 30}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	got = allocateSplitBudget(map[string]int64{"train": 50, "test": 20}, 10, StratifyEqual)
+	want = map[string]int{"train": 5, "test": 5}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("empty splits get no share: expected %v, got %v", want, got)
+	}
+
+	// valid and test hold 2 and 5 rows of their 10; train takes the 13 they leave over.
+	got = allocateSplitBudget(map[string]int64{"train": 900, "valid": 2, "test": 5}, 30, StratifyEqual)
+	want = map[string]int{"train": 23, "valid": 2, "test": 5}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("small splits pass their unused share on: expected %v, got %v", want, got)
+	}
+
+	got = allocateSplitBudget(map[string]int64{"train": 5, "test": 2}, 10, StratifyEqual)
+	want = map[string]int{"train": 5, "test": 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("a budget above the row count takes every row: expected %v, got %v", want, got)
+	}
+}
+
+func TestAllocateSplitBudget_Empty(t *testing.T) {
+	if got := allocateSplitBudget(map[string]int64{}, 10, StratifyProportional); len(got) != 0 {
+		t.Fatalf("expected no budgets, got %v", got)
+	}
+}
+
+func TestExportOptions_Stratified(t *testing.T) {
+	base := ExportOptions{Split: "all", MaxExamples: 10}
+	if !base.stratified() {
+		t.Fatal("split=all with max_examples should stratify by default")
+	}
+	for _, o := range []ExportOptions{
+		{Split: "train", MaxExamples: 10},
+		{Split: "all"},
+		{Split: "all", MaxExamples: 10, Stratify: StratifyNone},
+	} {
+		if o.stratified() {
+			t.Fatalf("%+v should not stratify", o)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
+// SuggestTags returns distinct tags in a dataset starting with prefix (case-insensitive),
+// most used first.
+func SuggestTags(ctx context.Context, db *sql.DB, datasetID int64, prefix string, limit int) ([]TagCount, error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT t.tag, COUNT(*) AS n
+FROM conversations c
+CROSS JOIN LATERAL jsonb_array_elements_text(
+  CASE WHEN jsonb_typeof(c.tags) = 'array' THEN c.tags ELSE '[]'::jsonb END
+) AS t(tag)
+WHERE c.dataset_id = $1 AND t.tag ILIKE $2 ESCAPE '\'
+GROUP BY t.tag
+ORDER BY n DESC, t.tag ASC
+LIMIT $3
+`, datasetID, escapeLike(strings.TrimSpace(prefix))+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []TagCount{}
+	for rows.Next() {
+		var tc TagCount
+		if err := rows.Scan(&tc.Tag, &tc.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, tc)
+	}
+	return out, rows.Err()
+}
+
+// escapeLike escapes LIKE wildcards so s matches literally (with ESCAPE '\').
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
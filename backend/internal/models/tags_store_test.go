@@ -0,0 +1,9 @@
+package models
+
+import "testing"
+
+func TestEscapeLike(t *testing.T) {
+	if got := escapeLike(`co_de 100%\`); got != `co\_de 100\%\\` {
+		t.Fatalf("unexpected escape: %q", got)
+	}
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+const (
+	TemplateAlpaca = "alpaca"
+	TemplateChatML = "chatml"
+	TemplateCustom = "custom"
+)
+
+var presetTemplates = map[string]struct{ text, sep string }{
+	TemplateAlpaca: {
+		text: `{{if eq .Role "user"}}### Instruction:` + "\n" + `{{.Content}}{{else if eq .Role "assistant"}}### Response:` + "\n" + `{{.Content}}{{else}}{{.Content}}{{end}}`,
+		sep:  "\n\n",
+	},
+	TemplateChatML: {
+		text: "<|im_start|>{{.Role}}\n{{.Content}}<|im_end|>",
+		sep:  "\n",
+	},
+}
+
+// ContextTemplate renders each message of a rendered context (and, for completions, the
+// assistant turn) in a model's chat format instead of the built-in role labels.
+type ContextTemplate struct {
+	tmpl *template.Template
+	sep  string
+}
+
+// templateMessage is what a template sees for one message.
+type templateMessage struct {
+	Role    string
+	Content string
+	Name    string
+}
+
+// ParseContextTemplate resolves template=alpaca|chatml|custom; "" returns nil (role labels).
+// custom parses text as a Go text/template over .Role, .Content and .Name, one message per
+// execution, joined by newlines. Parse errors keep text/template's line position.
+func ParseContextTemplate(name string, text string) (*ContextTemplate, error) {
+	name = strings.TrimSpace(strings.ToLower(name))
+	sep := "\n"
+	switch name {
+	case "":
+		return nil, nil
+	case TemplateCustom:
+		if strings.TrimSpace(text) == "" {
+			return nil, fmt.Errorf("%w: template_text is required for template=custom", ErrInvalidInput)
+		}
+	default:
+		p, ok := presetTemplates[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid template (expected alpaca|chatml|custom)", ErrInvalidInput)
+		}
+		text, sep = p.text, p.sep
+	}
+
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	ct := &ContextTemplate{tmpl: t, sep: sep}
+	// Execute once per role so a bad field reference fails here rather than mid-export.
+	for _, r := range []Role{RoleSystem, RoleUser, RoleAssistant} {
+		if _, err := ct.render(Message{Role: r, Content: "x"}); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		}
+	}
+	return ct, nil
+}
+
+// maxTemplateOverhead bounds what one execution of a context template may write beyond the
+// message's own content, so a custom template can't blow a line up without limit.
+const maxTemplateOverhead = 64 << 10
+
+var errTemplateOutputTooLarge = errors.New("template output too large")
+
+// limitedBuilder is a strings.Builder that fails writes past max bytes.
+type limitedBuilder struct {
+	strings.Builder
+	max int
+}
+
+func (b *limitedBuilder) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.max {
+		return 0, errTemplateOutputTooLarge
+	}
+	return b.Builder.Write(p)
+}
+
+func (ct *ContextTemplate) render(m Message) (string, error) {
+	content := strings.TrimSpace(m.Content)
+	b := &limitedBuilder{max: len(content) + maxTemplateOverhead}
+	err := ct.tmpl.Execute(b, templateMessage{Role: string(m.Role), Content: content, Name: m.Name})
+	return b.String(), err
+}
+
+// lineStyle renders the messages of a context: role labels, plain text or a ContextTemplate.
+type lineStyle struct {
+	roleStyle string // labels|plain
+	tmpl      *ContextTemplate
+}
+
+func (o ExportOptions) lineStyle() lineStyle {
+	s := lineStyle{roleStyle: o.RoleStyle, tmpl: o.ContextTemplate}
+	if s.roleStyle == "" {
+		s.roleStyle = RoleStyleLabels
+	}
+	return s
+}
+
+// line renders one message. A template that failed its parse-time run can still fail here
+// (on real content, or by exceeding maxTemplateOverhead); the error aborts the export.
+func (s lineStyle) line(m Message) (string, error) {
+	if s.tmpl != nil {
+		return s.tmpl.render(m)
+	}
+	if s.roleStyle == RoleStylePlain {
+		return strings.TrimSpace(m.Content), nil
+	}
+	return roleLabel(m.Role) + strings.TrimSpace(m.Content), nil
+}
+
+func (s lineStyle) sep() string {
+	if s.tmpl != nil {
+		return s.tmpl.sep
+	}
+	return "\n"
+}
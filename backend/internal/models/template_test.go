@@ -0,0 +1,88 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDerivePairs_Templates(t *testing.T) {
+	msgs := []Message{
+		{Role: RoleSystem, Content: "Be brief."},
+		{Role: RoleUser, Content: "Hi"},
+		{Role: RoleAssistant, Content: "Hello"},
+		{Role: RoleUser, Content: "Bye"},
+		{Role: RoleAssistant, Content: "Later"},
+	}
+	cases := []struct {
+		name, text, want string
+	}{
+		{TemplateAlpaca, "", "Be brief.\n\n### Instruction:\nHi\n\n### Response:\nHello\n\n### Instruction:\nBye"},
+		{TemplateChatML, "", "<|im_start|>system\nBe brief.<|im_end|>\n<|im_start|>user\nHi<|im_end|>\n<|im_start|>assistant\nHello<|im_end|>\n<|im_start|>user\nBye<|im_end|>"},
+		{TemplateCustom, "[{{.Role}}] {{.Content}}", "[system] Be brief.\n[user] Hi\n[assistant] Hello\n[user] Bye"},
+	}
+	for _, c := range cases {
+		ct, err := ParseContextTemplate(c.name, c.text)
+		if err != nil {
+			t.Fatalf("%s: parse: %v", c.name, err)
+		}
+		pairs := must(derivePairs(msgs, ExportOptions{Context: "full", IncludeSystem: true, ContextTemplate: ct}))
+		if len(pairs) != 2 {
+			t.Fatalf("%s: expected 2 pairs, got %d", c.name, len(pairs))
+		}
+		if pairs[1].User != c.want {
+			t.Fatalf("%s: unexpected prompt:\n got %q\nwant %q", c.name, pairs[1].User, c.want)
+		}
+		if pairs[1].Assistant != "Later" {
+			t.Fatalf("%s: assistant text must stay raw, got %q", c.name, pairs[1].Assistant)
+		}
+	}
+}
+
+func TestPairLine_CompletionsWithTemplate(t *testing.T) {
+	ct, err := ParseContextTemplate(TemplateChatML, "")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	p := ExportPair{User: "<|im_start|>user\nHi<|im_end|>", Assistant: "Hello"}
+	got := must(pairLine(p, ExportOptions{Type: "completions", Context: "window", ContextTemplate: ct}))
+	want := "<|im_start|>user\nHi<|im_end|>\n<|im_start|>assistant\nHello<|im_end|>"
+	if c, ok := got.(ExportCompletion); !ok || c.Text != want {
+		t.Fatalf("unexpected completion: %#v", got)
+	}
+}
+
+func TestParseContextTemplate_Errors(t *testing.T) {
+	_, err := ParseContextTemplate(TemplateCustom, "line one\n{{.Role")
+	if !errors.Is(err, ErrInvalidInput) || !strings.Contains(err.Error(), "custom:2") {
+		t.Fatalf("expected parse error naming line 2, got %v", err)
+	}
+	if _, err := ParseContextTemplate(TemplateCustom, "{{.Text}}"); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected unknown field to be rejected, got %v", err)
+	}
+	if _, err := ParseContextTemplate(TemplateCustom, " "); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected empty custom template to be rejected, got %v", err)
+	}
+	if _, err := ParseContextTemplate("llama", ""); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected unknown preset to be rejected, got %v", err)
+	}
+	if ct, err := ParseContextTemplate("", ""); ct != nil || err != nil {
+		t.Fatalf("expected no template, got %v %v", ct, err)
+	}
+}
+
+func TestContextTemplate_RenderErrors(t *testing.T) {
+	if _, err := ParseContextTemplate(TemplateCustom, strings.Repeat("a", maxTemplateOverhead+1)+"{{.Content}}"); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected oversized output to be rejected, got %v", err)
+	}
+
+	// Fails only on content the parse-time run never sees.
+	ct, err := ParseContextTemplate(TemplateCustom, `{{if eq .Content "boom"}}{{.Missing}}{{end}}{{.Content}}`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	msgs := []Message{{Role: RoleUser, Content: "boom"}, {Role: RoleAssistant, Content: "ok"}}
+	if _, err := derivePairs(msgs, ExportOptions{Context: "full", ContextTemplate: ct}); err == nil {
+		t.Fatalf("expected the render error to surface")
+	}
+}
@@ -31,6 +31,11 @@ const (
 	ProposalStatusRejected = "rejected"
 )
 
+const (
+	DatasetVisibilityPublic  = "public"
+	DatasetVisibilityPrivate = "private"
+)
+
 const (
 	RoleSystem    Role = "system"
 	RoleUser      Role = "user"
@@ -42,14 +47,49 @@ type Dataset struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	Kind        string `json:"kind"`
+	ProjectID   int64  `json:"project_id"`
+	Visibility  string `json:"visibility"`
+
+	License       string `json:"license"`
+	ProvenanceURL string `json:"provenance_url"`
+
+	// DefaultSplit/DefaultStatus apply when list and export requests omit split/status.
+	// Empty means the global defaults (train, approved); see Defaults.
+	DefaultSplit  string `json:"default_split"`
+	DefaultStatus string `json:"default_status"`
 
+	// Readme is only loaded by GetDataset; list responses leave it empty.
+	Readme string `json:"readme,omitempty"`
+
+	// Cached counts maintained by triggers (migration 012); see RecountDataset.
 	ItemCount         int64 `json:"item_count"`
 	ConversationCount int64 `json:"conversation_count"`
 
+	// Conversations per split, cached by the same triggers (migration 035).
+	TrainCount int64 `json:"train_count"`
+	ValidCount int64 `json:"valid_count"`
+	TestCount  int64 `json:"test_count"`
+
+	// Lock is set while conversation and item edits are frozen (see LockDataset); nil when
+	// unlocked or expired.
+	Lock *DatasetLock `json:"lock"`
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// DatasetLock records who froze a dataset and until when (nil ExpiresAt = until unlocked).
+type DatasetLock struct {
+	By        string     `json:"by"`
+	At        time.Time  `json:"at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Active reports whether the lock still holds at now.
+func (l *DatasetLock) Active(now time.Time) bool {
+	return l != nil && (l.ExpiresAt == nil || now.Before(*l.ExpiresAt))
+}
+
 type Conversation struct {
 	ID        int64              `json:"id"`
 	DatasetID int64              `json:"dataset_id"`
@@ -58,19 +98,48 @@ type Conversation struct {
 	Tags      []string           `json:"tags"`
 	Source    string             `json:"source"`
 	Notes     string             `json:"notes"`
+	Lang      string             `json:"lang"` // ISO 639-1 code, "" when unknown
 	CreatedAt time.Time          `json:"created_at"`
 	UpdatedAt time.Time          `json:"updated_at"`
 
+	// Meta is a JSON object of structured metadata (difficulty, domain, quality scores); only
+	// loaded by GetConversation and GetConversationsByIDs.
+	Meta json.RawMessage `json:"meta,omitempty"`
+
+	// MessagesUpdatedAt is when a message was last inserted, edited or deleted (kept by the
+	// conversation_messages triggers, migration 025); only loaded by GetConversation.
+	MessagesUpdatedAt *time.Time `json:"messages_updated_at,omitempty"`
+
+	// DatasetName and DatasetKind are joined in by GetConversation and ListConversations.
+	DatasetName string `json:"dataset_name,omitempty"`
+	DatasetKind string `json:"dataset_kind,omitempty"`
+
+	// ImportRunID is the import run that created the conversation; only loaded by
+	// GetConversation.
+	ImportRunID *int64 `json:"import_run_id,omitempty"`
+
 	MessageCount     int    `json:"message_count,omitempty"`
 	PreviewUser      string `json:"preview_user,omitempty"`
 	PreviewAssistant string `json:"preview_assistant,omitempty"`
 
+	// AvgRating is the mean reviewer score (1-5); nil when unrated.
+	AvgRating   *float64 `json:"avg_rating"`
+	RatingCount int      `json:"rating_count"`
+
 	Messages []Message `json:"messages,omitempty"`
 }
 
 type Message struct {
+	// ID is the message row, set when the message was read from the database; requests never
+	// set it.
+	ID      int64           `json:"-"`
 	Role    Role            `json:"role"`
 	Content string          `json:"content"`
 	Name    string          `json:"name,omitempty"`
 	Meta    json.RawMessage `json:"meta,omitempty"`
+
+	// AlternativeCount and Alternatives are only filled by AttachAlternatives, for
+	// conversation reads; exports never carry them.
+	AlternativeCount *int                 `json:"alternative_count,omitempty"`
+	Alternatives     []MessageAlternative `json:"alternatives,omitempty"`
 }
@@ -23,3 +23,76 @@ func NormalizeConversationStatus(s string) (ConversationStatus, bool) {
 		return "", false
 	}
 }
+
+// ParseSplitList parses a comma-separated split filter such as "valid,test". "all" means
+// every split and returns nil; duplicates are dropped.
+func ParseSplitList(s string) ([]Split, bool) {
+	if strings.EqualFold(strings.TrimSpace(s), "all") {
+		return nil, true
+	}
+	var out []Split
+	for _, part := range strings.Split(s, ",") {
+		split, ok := NormalizeSplit(part)
+		if !ok {
+			return nil, false
+		}
+		if !containsValue(out, split) {
+			out = append(out, split)
+		}
+	}
+	return out, true
+}
+
+// ParseStatusList parses a comma-separated status filter such as "pending,draft". "any"
+// means every status and returns nil; duplicates are dropped.
+func ParseStatusList(s string) ([]ConversationStatus, bool) {
+	if strings.EqualFold(strings.TrimSpace(s), "any") {
+		return nil, true
+	}
+	var out []ConversationStatus
+	for _, part := range strings.Split(s, ",") {
+		st, ok := NormalizeConversationStatus(part)
+		if !ok {
+			return nil, false
+		}
+		if !containsValue(out, st) {
+			out = append(out, st)
+		}
+	}
+	return out, true
+}
+
+func containsValue[T comparable](values []T, v T) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Dataset kinds: what a dataset holds.
+const (
+	DatasetKindItems         = "items"
+	DatasetKindConversations = "conversations"
+)
+
+func NormalizeDatasetKind(s string) (string, bool) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	switch s {
+	case DatasetKindItems, DatasetKindConversations:
+		return s, true
+	default:
+		return "", false
+	}
+}
+
+func NormalizeDatasetVisibility(s string) (string, bool) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	switch s {
+	case DatasetVisibilityPublic, DatasetVisibilityPrivate:
+		return s, true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseStatusList(t *testing.T) {
+	got, ok := ParseStatusList(" Pending,draft,pending ")
+	if want := []ConversationStatus{ConversationStatusPending, ConversationStatusDraft}; !ok || !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v %v", want, got, ok)
+	}
+	if got, ok := ParseStatusList("any"); !ok || got != nil {
+		t.Fatalf("any should mean no filter, got %v %v", got, ok)
+	}
+	for _, bad := range []string{"", "pending,", "pending,bogus", "all"} {
+		if _, ok := ParseStatusList(bad); ok {
+			t.Fatalf("%q should be rejected", bad)
+		}
+	}
+}
+
+func TestParseSplitList(t *testing.T) {
+	got, ok := ParseSplitList("valid,TEST")
+	if want := []Split{SplitValid, SplitTest}; !ok || !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v %v", want, got, ok)
+	}
+	if got, ok := ParseSplitList("all"); !ok || got != nil {
+		t.Fatalf("all should mean no filter, got %v %v", got, ok)
+	}
+	if _, ok := ParseSplitList("train,dev"); ok {
+		t.Fatal("dev should be rejected")
+	}
+}
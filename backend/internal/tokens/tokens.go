@@ -0,0 +1,56 @@
+// Package tokens estimates how many tokens a model's tokenizer would produce for a text, so
+// that every token budget in the codebase (context windows, truncation, per-message counts)
+// is measured the same way.
+package tokens
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Estimator counts the tokens of a text. Implementations must be safe for concurrent use.
+type Estimator interface {
+	Estimate(s string) int
+}
+
+// Heuristic is the dependency-free default: one token per four characters, rounded up, but
+// never fewer than the number of whitespace-separated words. It is meant for budgeting,
+// not exact limits.
+type Heuristic struct{}
+
+func (Heuristic) Estimate(s string) int {
+	n := (utf8.RuneCountInString(s) + 3) / 4
+	if words := len(strings.Fields(s)); words > n {
+		return words
+	}
+	return n
+}
+
+// Func adapts a plain counting function, such as a BPE tokenizer's encode-and-count, to
+// Estimator.
+type Func func(s string) int
+
+func (f Func) Estimate(s string) int { return f(s) }
+
+// Default is the estimator used when none is configured.
+var Default Estimator = Heuristic{}
+
+// New returns the estimator registered under name; "" and "heuristic" are the Heuristic.
+// Real tokenizers can be added here without changing callers.
+func New(name string) (Estimator, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "heuristic":
+		return Heuristic{}, nil
+	default:
+		return nil, fmt.Errorf("unknown token estimator %q (expected heuristic)", name)
+	}
+}
+
+// OrDefault returns e, or Default when e is nil.
+func OrDefault(e Estimator) Estimator {
+	if e == nil {
+		return Default
+	}
+	return e
+}
@@ -0,0 +1,30 @@
+package tokens
+
+import "testing"
+
+func TestHeuristic(t *testing.T) {
+	for s, want := range map[string]int{"": 0, "abc": 1, "abcd": 1, "abcde": 2, "héllo wörld!": 3, "a b c d e": 5} {
+		if got := (Heuristic{}).Estimate(s); got != want {
+			t.Fatalf("Estimate(%q) = %d, want %d", s, got, want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	if e, err := New(" Heuristic "); err != nil || e != (Heuristic{}) {
+		t.Fatalf("expected the heuristic, got %v %v", e, err)
+	}
+	if _, err := New("tiktoken"); err == nil {
+		t.Fatal("expected an error for an unknown estimator")
+	}
+}
+
+func TestOrDefault(t *testing.T) {
+	if OrDefault(nil) != Default {
+		t.Fatal("nil should fall back to Default")
+	}
+	bytes := Func(func(s string) int { return len(s) })
+	if OrDefault(bytes).Estimate("héllo") != 6 {
+		t.Fatal("a configured estimator should be used as-is")
+	}
+}
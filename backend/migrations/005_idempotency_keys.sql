@@ -0,0 +1,12 @@
+-- Remembers responses for POSTs carrying an Idempotency-Key so client retries don't duplicate rows.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  scope TEXT NOT NULL,
+  key TEXT NOT NULL,
+  resource_id BIGINT NOT NULL,
+  status_code INT NOT NULL,
+  response JSONB NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (scope, key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_created_idx ON idempotency_keys(created_at);
@@ -0,0 +1,3 @@
+-- Long-form documentation (methodology, licensing, known issues) for a dataset.
+ALTER TABLE datasets
+  ADD COLUMN IF NOT EXISTS readme TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+-- Private datasets are only listed, read and exported with the admin token.
+ALTER TABLE datasets
+  ADD COLUMN IF NOT EXISTS visibility TEXT NOT NULL DEFAULT 'public'
+  CHECK (visibility IN ('public', 'private'));
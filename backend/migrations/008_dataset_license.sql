@@ -0,0 +1,4 @@
+-- SPDX license identifier and provenance link carried into exports.
+ALTER TABLE datasets
+  ADD COLUMN IF NOT EXISTS license TEXT NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS provenance_url TEXT NOT NULL DEFAULT '';
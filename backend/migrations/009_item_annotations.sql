@@ -0,0 +1,13 @@
+-- Labels and scores attached to dataset items without touching the original data blob.
+-- One value per (item, key, author): re-setting a key overwrites, other authors coexist.
+CREATE TABLE IF NOT EXISTS item_annotations (
+  id BIGSERIAL PRIMARY KEY,
+  item_id BIGINT NOT NULL REFERENCES dataset_items(id) ON DELETE CASCADE,
+  key TEXT NOT NULL,
+  value JSONB NOT NULL,
+  author TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE (item_id, key, author)
+);
+
+CREATE INDEX IF NOT EXISTS item_annotations_key_idx ON item_annotations(key, item_id);
@@ -0,0 +1,6 @@
+-- Per-dataset split/status used when list and export requests omit them ('' = global default).
+ALTER TABLE datasets
+  ADD COLUMN IF NOT EXISTS default_split TEXT NOT NULL DEFAULT ''
+    CHECK (default_split IN ('', 'train', 'valid', 'test')),
+  ADD COLUMN IF NOT EXISTS default_status TEXT NOT NULL DEFAULT ''
+    CHECK (default_status IN ('', 'draft', 'pending', 'approved', 'rejected', 'archived'));
@@ -0,0 +1,11 @@
+-- 1-5 quality ratings on conversations; one rating per rater, re-rating updates it.
+CREATE TABLE IF NOT EXISTS conversation_ratings (
+  id BIGSERIAL PRIMARY KEY,
+  conversation_id BIGINT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+  rater TEXT NOT NULL,
+  score SMALLINT NOT NULL CHECK (score BETWEEN 1 AND 5),
+  note TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE (conversation_id, rater)
+);
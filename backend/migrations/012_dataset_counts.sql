@@ -0,0 +1,113 @@
+-- Denormalized item/conversation counts on datasets, kept current by triggers so list calls
+-- no longer aggregate dataset_items/conversations. POST /api/v1/datasets/{id}/recount repairs drift.
+-- Statement-level triggers apply one grouped delta per dataset per statement, so a bulk import
+-- or move takes each datasets row lock once instead of once per row. Transition tables can't
+-- be combined with column lists or multiple events, hence one trigger per event and the
+-- dataset_id comparison inside the UPDATE branch.
+ALTER TABLE datasets
+  ADD COLUMN IF NOT EXISTS item_count BIGINT NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS conversation_count BIGINT NOT NULL DEFAULT 0;
+
+UPDATE datasets d
+SET item_count = (SELECT COUNT(*) FROM dataset_items i WHERE i.dataset_id = d.id),
+    conversation_count = (SELECT COUNT(*) FROM conversations c WHERE c.dataset_id = d.id);
+
+CREATE OR REPLACE FUNCTION datasets_bump_item_count() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    UPDATE datasets d SET item_count = d.item_count + n.delta
+    FROM (SELECT dataset_id, COUNT(*) AS delta FROM new_rows GROUP BY dataset_id) n
+    WHERE d.id = n.dataset_id;
+  ELSIF TG_OP = 'DELETE' THEN
+    UPDATE datasets d SET item_count = d.item_count - o.delta
+    FROM (SELECT dataset_id, COUNT(*) AS delta FROM old_rows GROUP BY dataset_id) o
+    WHERE d.id = o.dataset_id;
+  ELSE
+    UPDATE datasets d SET item_count = d.item_count + m.delta
+    FROM (
+      SELECT dataset_id, SUM(delta) AS delta
+      FROM (
+        SELECT n.dataset_id, 1 AS delta
+        FROM new_rows n JOIN old_rows o ON o.id = n.id
+        WHERE o.dataset_id IS DISTINCT FROM n.dataset_id
+        UNION ALL
+        SELECT o.dataset_id, -1 AS delta
+        FROM new_rows n JOIN old_rows o ON o.id = n.id
+        WHERE o.dataset_id IS DISTINCT FROM n.dataset_id
+      ) moved
+      GROUP BY dataset_id
+    ) m
+    WHERE d.id = m.dataset_id;
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION datasets_bump_conversation_count() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    UPDATE datasets d SET conversation_count = d.conversation_count + n.delta
+    FROM (SELECT dataset_id, COUNT(*) AS delta FROM new_rows GROUP BY dataset_id) n
+    WHERE d.id = n.dataset_id;
+  ELSIF TG_OP = 'DELETE' THEN
+    UPDATE datasets d SET conversation_count = d.conversation_count - o.delta
+    FROM (SELECT dataset_id, COUNT(*) AS delta FROM old_rows GROUP BY dataset_id) o
+    WHERE d.id = o.dataset_id;
+  ELSE
+    UPDATE datasets d SET conversation_count = d.conversation_count + m.delta
+    FROM (
+      SELECT dataset_id, SUM(delta) AS delta
+      FROM (
+        SELECT n.dataset_id, 1 AS delta
+        FROM new_rows n JOIN old_rows o ON o.id = n.id
+        WHERE o.dataset_id IS DISTINCT FROM n.dataset_id
+        UNION ALL
+        SELECT o.dataset_id, -1 AS delta
+        FROM new_rows n JOIN old_rows o ON o.id = n.id
+        WHERE o.dataset_id IS DISTINCT FROM n.dataset_id
+      ) moved
+      GROUP BY dataset_id
+    ) m
+    WHERE d.id = m.dataset_id;
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS dataset_items_count_trg ON dataset_items;
+DROP TRIGGER IF EXISTS dataset_items_insert_count_trg ON dataset_items;
+CREATE TRIGGER dataset_items_insert_count_trg
+  AFTER INSERT ON dataset_items
+  REFERENCING NEW TABLE AS new_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_bump_item_count();
+
+DROP TRIGGER IF EXISTS dataset_items_delete_count_trg ON dataset_items;
+CREATE TRIGGER dataset_items_delete_count_trg
+  AFTER DELETE ON dataset_items
+  REFERENCING OLD TABLE AS old_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_bump_item_count();
+
+DROP TRIGGER IF EXISTS dataset_items_move_count_trg ON dataset_items;
+CREATE TRIGGER dataset_items_move_count_trg
+  AFTER UPDATE ON dataset_items
+  REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_bump_item_count();
+
+DROP TRIGGER IF EXISTS conversations_count_trg ON conversations;
+DROP TRIGGER IF EXISTS conversations_insert_count_trg ON conversations;
+CREATE TRIGGER conversations_insert_count_trg
+  AFTER INSERT ON conversations
+  REFERENCING NEW TABLE AS new_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_bump_conversation_count();
+
+DROP TRIGGER IF EXISTS conversations_delete_count_trg ON conversations;
+CREATE TRIGGER conversations_delete_count_trg
+  AFTER DELETE ON conversations
+  REFERENCING OLD TABLE AS old_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_bump_conversation_count();
+
+DROP TRIGGER IF EXISTS conversations_move_count_trg ON conversations;
+CREATE TRIGGER conversations_move_count_trg
+  AFTER UPDATE ON conversations
+  REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_bump_conversation_count();
@@ -0,0 +1,14 @@
+-- Audit trail of import_jsonl runs: what was imported into a dataset, from where, and how.
+CREATE TABLE IF NOT EXISTS import_runs (
+  id BIGSERIAL PRIMARY KEY,
+  dataset_id BIGINT NOT NULL REFERENCES datasets(id) ON DELETE CASCADE,
+  input TEXT NOT NULL DEFAULT '',
+  mode TEXT NOT NULL DEFAULT '',
+  imported INTEGER NOT NULL DEFAULT 0,
+  bad INTEGER NOT NULL DEFAULT 0,
+  flags JSONB NOT NULL DEFAULT '{}'::jsonb,
+  started_at TIMESTAMPTZ NOT NULL,
+  finished_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS import_runs_dataset_started_idx ON import_runs (dataset_id, started_at DESC);
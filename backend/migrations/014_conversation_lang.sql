@@ -0,0 +1,5 @@
+-- Detected or supplied language of a conversation (ISO 639-1, '' = unknown), filterable on export.
+ALTER TABLE conversations
+  ADD COLUMN IF NOT EXISTS lang TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS conversations_dataset_lang_idx ON conversations (dataset_id, lang);
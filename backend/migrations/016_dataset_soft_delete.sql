@@ -0,0 +1,3 @@
+-- Soft-deleted datasets keep their rows but disappear from listing, reads and exports.
+ALTER TABLE datasets
+  ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
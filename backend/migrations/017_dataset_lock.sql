@@ -0,0 +1,6 @@
+-- While locked (and not past lock_expires_at), conversation and item edits in a dataset are
+-- refused so a training run reads exactly what reviewers saw.
+ALTER TABLE datasets
+  ADD COLUMN IF NOT EXISTS locked_by TEXT NOT NULL DEFAULT '',
+  ADD COLUMN IF NOT EXISTS locked_at TIMESTAMPTZ,
+  ADD COLUMN IF NOT EXISTS lock_expires_at TIMESTAMPTZ;
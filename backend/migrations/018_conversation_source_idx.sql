@@ -0,0 +1,3 @@
+-- Backs the source= and source_prefix= filters on conversation listing and export.
+-- text_pattern_ops serves both the exact match and the LIKE 'prefix%' scan.
+CREATE INDEX IF NOT EXISTS conversations_dataset_source_idx ON conversations(dataset_id, source text_pattern_ops);
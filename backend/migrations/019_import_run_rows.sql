@@ -0,0 +1,14 @@
+-- Rows remember the import run that created them so POST /api/v1/import-runs/{id}/rollback
+-- can undo exactly that run. Runs are now recorded when they start (finished_at stays NULL
+-- until the last batch commits, so a crashed run can still be rolled back).
+ALTER TABLE import_runs
+  ALTER COLUMN finished_at DROP NOT NULL,
+  ADD COLUMN IF NOT EXISTS rolled_back_at TIMESTAMPTZ;
+
+ALTER TABLE conversations
+  ADD COLUMN IF NOT EXISTS import_run_id BIGINT REFERENCES import_runs(id) ON DELETE SET NULL;
+ALTER TABLE dataset_items
+  ADD COLUMN IF NOT EXISTS import_run_id BIGINT REFERENCES import_runs(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS conversations_import_run_idx ON conversations(import_run_id) WHERE import_run_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS dataset_items_import_run_idx ON dataset_items(import_run_id) WHERE import_run_id IS NOT NULL;
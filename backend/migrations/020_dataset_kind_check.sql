@@ -0,0 +1,13 @@
+-- Dataset kind is either 'items' or 'conversations'. Until now any other string was accepted
+-- and treated as a conversation dataset, so free-form values ("conversation", "chat", "itms")
+-- become 'conversations', except datasets that only hold items, which become 'items'.
+UPDATE datasets d
+SET kind = CASE
+  WHEN EXISTS (SELECT 1 FROM dataset_items i WHERE i.dataset_id = d.id)
+   AND NOT EXISTS (SELECT 1 FROM conversations c WHERE c.dataset_id = d.id) THEN 'items'
+  ELSE 'conversations'
+END
+WHERE d.kind NOT IN ('items', 'conversations');
+
+ALTER TABLE datasets
+  ADD CONSTRAINT datasets_kind_check CHECK (kind IN ('items', 'conversations'));
@@ -0,0 +1,37 @@
+-- Message idx values should run 0..n-1 per conversation. Partial deletes and older clients
+-- left gaps (0,2,3), and databases created without the UNIQUE (conversation_id, idx) from
+-- 001 may also hold duplicates. Repair first, then make sure the constraint exists.
+--
+-- Step 1 flips every idx of an affected conversation negative (-1 - idx), which cannot
+-- collide with the remaining non-negative values; step 2 numbers those rows from 0 in their
+-- original (idx, id) order. The same approach backs POST /api/v1/conversations/{id}/reindex.
+UPDATE conversation_messages
+SET idx = -1 - idx
+WHERE conversation_id IN (
+  SELECT conversation_id
+  FROM conversation_messages
+  GROUP BY conversation_id
+  HAVING MIN(idx) <> 0 OR MAX(idx) <> COUNT(*) - 1 OR COUNT(DISTINCT idx) <> COUNT(*)
+);
+
+UPDATE conversation_messages m
+SET idx = r.n
+FROM (
+  SELECT id, row_number() OVER (PARTITION BY conversation_id ORDER BY idx DESC, id ASC) - 1 AS n
+  FROM conversation_messages
+  WHERE idx < 0
+) r
+WHERE m.id = r.id;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (
+    SELECT 1 FROM pg_constraint
+    WHERE conrelid = 'conversation_messages'::regclass
+      AND contype = 'u'
+      AND conname = 'conversation_messages_conversation_id_idx_key'
+  ) THEN
+    ALTER TABLE conversation_messages
+      ADD CONSTRAINT conversation_messages_conversation_id_idx_key UNIQUE (conversation_id, idx);
+  END IF;
+END $$;
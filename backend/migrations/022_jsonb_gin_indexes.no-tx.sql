@@ -0,0 +1,13 @@
+-- GIN indexes for JSONB filters.
+--
+-- dataset_items.data already has a default (jsonb_ops) GIN index from 004, which serves key
+-- presence (data ? 'label', the items key_exists filter). The jsonb_path_ops index added here
+-- is smaller and faster for containment lookups such as data @> '{"category":"billing"}'.
+-- conversations.tags gets a jsonb_ops index so tag filters (tags ? 'x', tags ?| array[...],
+-- tags @> '["x"]') stop scanning the table.
+--
+-- This is a .no-tx migration: each statement runs on its own outside a transaction, so the
+-- indexes build CONCURRENTLY without blocking writes. If a concurrent build fails it leaves
+-- an INVALID index behind that IF NOT EXISTS would then skip; drop it before restarting.
+CREATE INDEX CONCURRENTLY IF NOT EXISTS dataset_items_data_path_idx ON dataset_items USING gin (data jsonb_path_ops);
+CREATE INDEX CONCURRENTLY IF NOT EXISTS conversations_tags_gin_idx ON conversations USING gin (tags);
@@ -0,0 +1,6 @@
+-- Older import tooling stored conversation tags as JSON null (or other non-array values).
+-- Reads and writes now treat those as [], and this repairs the stored rows so filters and
+-- exports see an array everywhere.
+UPDATE conversations
+SET tags = '[]'::jsonb
+WHERE tags IS NULL OR jsonb_typeof(tags) <> 'array';
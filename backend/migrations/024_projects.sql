@@ -0,0 +1,18 @@
+-- Projects group datasets per team. Every dataset belongs to one; existing datasets, and new
+-- ones created without a project, land in the 'default' project (id 1).
+CREATE TABLE IF NOT EXISTS projects (
+  id BIGSERIAL PRIMARY KEY,
+  slug TEXT NOT NULL UNIQUE,
+  name TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+INSERT INTO projects (id, slug, name) VALUES (1, 'default', 'Default')
+ON CONFLICT (id) DO NOTHING;
+SELECT setval(pg_get_serial_sequence('projects', 'id'), GREATEST((SELECT MAX(id) FROM projects), 1));
+
+ALTER TABLE datasets
+  ADD COLUMN IF NOT EXISTS project_id BIGINT NOT NULL DEFAULT 1 REFERENCES projects(id);
+
+CREATE INDEX IF NOT EXISTS datasets_project_id_idx ON datasets (project_id);
@@ -0,0 +1,37 @@
+-- Any insert, update or delete of conversation messages stamps the conversation's updated_at
+-- and messages_updated_at, whichever code path made it, so message edits show up in
+-- updated_at-based syncs. Statement-level triggers touch each conversation once per
+-- statement, however many of its messages changed (a bulk insert from an import included).
+-- now() is the transaction start, so a conversation inserted along with its messages keeps
+-- updated_at = created_at; GREATEST keeps a later timestamp set in the same transaction.
+ALTER TABLE conversations
+  ADD COLUMN IF NOT EXISTS messages_updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+UPDATE conversations SET messages_updated_at = updated_at;
+
+CREATE OR REPLACE FUNCTION conversations_touch_messages() RETURNS trigger AS $$
+BEGIN
+  UPDATE conversations
+  SET updated_at = GREATEST(updated_at, now()), messages_updated_at = now()
+  WHERE id IN (SELECT DISTINCT conversation_id FROM changed);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS conversation_messages_insert_touch_trg ON conversation_messages;
+CREATE TRIGGER conversation_messages_insert_touch_trg
+  AFTER INSERT ON conversation_messages
+  REFERENCING NEW TABLE AS changed
+  FOR EACH STATEMENT EXECUTE FUNCTION conversations_touch_messages();
+
+DROP TRIGGER IF EXISTS conversation_messages_update_touch_trg ON conversation_messages;
+CREATE TRIGGER conversation_messages_update_touch_trg
+  AFTER UPDATE ON conversation_messages
+  REFERENCING NEW TABLE AS changed
+  FOR EACH STATEMENT EXECUTE FUNCTION conversations_touch_messages();
+
+DROP TRIGGER IF EXISTS conversation_messages_delete_touch_trg ON conversation_messages;
+CREATE TRIGGER conversation_messages_delete_touch_trg
+  AFTER DELETE ON conversation_messages
+  REFERENCING OLD TABLE AS changed
+  FOR EACH STATEMENT EXECUTE FUNCTION conversations_touch_messages();
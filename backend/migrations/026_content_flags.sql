@@ -0,0 +1,22 @@
+-- Moderation flags raised by reviewers on conversations or proposals that may hold content we
+-- cannot train on. Exports skip conversations with open flags; resolving records who and why.
+CREATE TABLE IF NOT EXISTS content_flags (
+  id BIGSERIAL PRIMARY KEY,
+  conversation_id BIGINT REFERENCES conversations(id) ON DELETE CASCADE,
+  proposal_id BIGINT REFERENCES proposals(id) ON DELETE CASCADE,
+  category TEXT NOT NULL CHECK (category IN ('toxicity', 'pii', 'copyright', 'other')),
+  note TEXT NOT NULL DEFAULT '',
+  flagged_by TEXT NOT NULL DEFAULT '',
+  status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved')),
+  resolved_by TEXT,
+  resolution TEXT,
+  resolved_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK ((conversation_id IS NULL) <> (proposal_id IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS content_flags_conversation_open_idx
+  ON content_flags (conversation_id) WHERE status = 'open' AND conversation_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS content_flags_proposal_idx
+  ON content_flags (proposal_id) WHERE proposal_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS content_flags_status_idx ON content_flags (status, created_at DESC);
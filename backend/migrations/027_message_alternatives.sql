@@ -0,0 +1,16 @@
+-- Candidate replacements for an assistant message, e.g. regenerated by an LLM. Accepting a
+-- draft swaps it into the message and keeps the replaced text as a 'replaced' row, so each
+-- message's rows read as its revision history.
+CREATE TABLE IF NOT EXISTS message_alternatives (
+  id BIGSERIAL PRIMARY KEY,
+  conversation_id BIGINT NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+  message_idx INT NOT NULL,
+  content TEXT NOT NULL,
+  model TEXT NOT NULL DEFAULT '',
+  status TEXT NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'accepted', 'replaced')),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  accepted_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS message_alternatives_conversation_idx
+  ON message_alternatives (conversation_id, message_idx, created_at DESC);
@@ -0,0 +1,26 @@
+-- Synthetic data generation: a job prompts the configured LLM once per seed (cycling through
+-- the seeds until target_count) and stores each reply as a pending conversation tagged
+-- synthetic, with source "generation-job:<id>". Seeds are inline JSON values or the items of
+-- seed_dataset_id. generated/failed count finished attempts, so an interrupted job resumes
+-- after them.
+CREATE TABLE IF NOT EXISTS generation_jobs (
+  id BIGSERIAL PRIMARY KEY,
+  dataset_id BIGINT NOT NULL REFERENCES datasets(id) ON DELETE CASCADE,
+  prompt_template TEXT NOT NULL,
+  system_prompt TEXT NOT NULL DEFAULT '',
+  seeds JSONB,
+  seed_dataset_id BIGINT REFERENCES datasets(id) ON DELETE SET NULL,
+  params JSONB NOT NULL DEFAULT '{}'::jsonb,
+  target_count INTEGER NOT NULL CHECK (target_count > 0),
+  concurrency INTEGER NOT NULL DEFAULT 1 CHECK (concurrency > 0),
+  status TEXT NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'succeeded', 'failed', 'canceled')),
+  generated INTEGER NOT NULL DEFAULT 0,
+  failed INTEGER NOT NULL DEFAULT 0,
+  error TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  started_at TIMESTAMPTZ,
+  finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS generation_jobs_dataset_idx ON generation_jobs (dataset_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS generation_jobs_active_idx ON generation_jobs (id) WHERE status IN ('queued', 'running');
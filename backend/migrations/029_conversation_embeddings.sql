@@ -0,0 +1,32 @@
+-- Conversation embeddings for semantic search. pgvector is optional: when the extension
+-- cannot be installed the table is not created and the similarity endpoints answer 501. To
+-- enable it later, install pgvector and delete this file's schema_migrations row so it
+-- runs again.
+DO $$
+BEGIN
+  CREATE EXTENSION IF NOT EXISTS vector;
+EXCEPTION WHEN OTHERS THEN
+  RAISE NOTICE 'pgvector is not available (%); semantic search stays disabled', SQLERRM;
+END
+$$;
+
+DO $$
+BEGIN
+  IF EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'vector') THEN
+    -- One embedding per conversation. The column has no fixed dimension so the embedding
+    -- model can change; the nearest-neighbor index is created per dimension at backfill
+    -- time (DATALAB_EMBED_INDEX) over embedding::vector(dims).
+    CREATE TABLE IF NOT EXISTS conversation_embeddings (
+      conversation_id BIGINT PRIMARY KEY REFERENCES conversations(id) ON DELETE CASCADE,
+      model TEXT NOT NULL,
+      text_source TEXT NOT NULL CHECK (text_source IN ('first_user', 'full')),
+      dims INT NOT NULL CHECK (dims > 0),
+      embedding vector NOT NULL,
+      embedded_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    );
+
+    CREATE INDEX IF NOT EXISTS conversation_embeddings_model_idx
+      ON conversation_embeddings (model, dims);
+  END IF;
+END
+$$;
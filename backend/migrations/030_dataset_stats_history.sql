@@ -0,0 +1,12 @@
+-- Daily snapshots of dataset statistics for drift tracking. stats holds a DatasetStats
+-- document (counts per split, status and tag, average messages and tokens per conversation);
+-- snapshots older than DATALAB_STATS_RETENTION are pruned.
+CREATE TABLE IF NOT EXISTS dataset_stats_history (
+  id BIGSERIAL PRIMARY KEY,
+  dataset_id BIGINT NOT NULL REFERENCES datasets(id) ON DELETE CASCADE,
+  taken_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  stats JSONB NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS dataset_stats_history_dataset_idx ON dataset_stats_history (dataset_id, taken_at);
+CREATE INDEX IF NOT EXISTS dataset_stats_history_taken_idx ON dataset_stats_history (taken_at);
@@ -0,0 +1,4 @@
+-- Structured metadata for whole conversations (difficulty, domain, model-graded quality, ...),
+-- alongside the free-form tags and notes. Always a JSON object; {} when unset.
+ALTER TABLE conversations
+  ADD COLUMN IF NOT EXISTS meta JSONB NOT NULL DEFAULT '{}'::jsonb;
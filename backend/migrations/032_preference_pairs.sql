@@ -0,0 +1,19 @@
+-- Preference pairs for DPO-style training: for a prompt, the response a rater chose over the
+-- one they rejected. The prompt text is always stored; conversation_id and message_idx name
+-- the assistant message it was compared at when the pair came from a conversation.
+CREATE TABLE IF NOT EXISTS preference_pairs (
+  id BIGSERIAL PRIMARY KEY,
+  dataset_id BIGINT NOT NULL REFERENCES datasets(id) ON DELETE CASCADE,
+  split TEXT NOT NULL DEFAULT 'train',
+  conversation_id BIGINT REFERENCES conversations(id) ON DELETE SET NULL,
+  message_idx INT,
+  prompt TEXT NOT NULL,
+  chosen TEXT NOT NULL,
+  rejected TEXT NOT NULL,
+  rater TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK (chosen <> rejected)
+);
+
+CREATE INDEX IF NOT EXISTS preference_pairs_dataset_idx
+  ON preference_pairs (dataset_id, split, id);
@@ -0,0 +1,5 @@
+-- Curators add alternatives by hand as well as through regeneration: record who wrote each
+-- one and let it carry meta like a message does.
+ALTER TABLE message_alternatives
+  ADD COLUMN IF NOT EXISTS meta JSONB NOT NULL DEFAULT '{}'::jsonb,
+  ADD COLUMN IF NOT EXISTS author TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+-- Idempotency keys are reserved inside the create transaction before the resource exists, so
+-- concurrent retries block on the key instead of both creating. The response columns are
+-- filled in by the same transaction; request_hash binds the key to the request body ('' for
+-- rows stored before this migration).
+ALTER TABLE idempotency_keys
+  ADD COLUMN IF NOT EXISTS request_hash TEXT NOT NULL DEFAULT '',
+  ALTER COLUMN resource_id DROP NOT NULL,
+  ALTER COLUMN status_code DROP NOT NULL,
+  ALTER COLUMN response DROP NOT NULL;
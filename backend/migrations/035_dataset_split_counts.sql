@@ -0,0 +1,84 @@
+-- Per-split conversation counts on datasets, kept by the same statement-level triggers as
+-- conversation_count (012), so dataset lists no longer count conversations per listed dataset.
+-- A statement's deltas are grouped by dataset and split; an UPDATE counts the rows whose
+-- dataset_id or split changed, as -1 for the old pair and +1 for the new one.
+ALTER TABLE datasets
+  ADD COLUMN IF NOT EXISTS train_count BIGINT NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS valid_count BIGINT NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS test_count BIGINT NOT NULL DEFAULT 0;
+
+UPDATE datasets d
+SET train_count = sc.train_count, valid_count = sc.valid_count, test_count = sc.test_count
+FROM (
+  SELECT dataset_id,
+         COUNT(*) FILTER (WHERE split = 'train') AS train_count,
+         COUNT(*) FILTER (WHERE split = 'valid') AS valid_count,
+         COUNT(*) FILTER (WHERE split = 'test') AS test_count
+  FROM conversations
+  GROUP BY dataset_id
+) sc
+WHERE d.id = sc.dataset_id;
+
+-- Replaces 012's function; its insert, delete and move triggers keep calling it.
+CREATE OR REPLACE FUNCTION datasets_bump_conversation_count() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    UPDATE datasets d
+    SET conversation_count = d.conversation_count + m.total,
+        train_count = d.train_count + m.train,
+        valid_count = d.valid_count + m.valid,
+        test_count = d.test_count + m.test
+    FROM (
+      SELECT dataset_id,
+             SUM(delta) AS total,
+             COALESCE(SUM(delta) FILTER (WHERE split = 'train'), 0) AS train,
+             COALESCE(SUM(delta) FILTER (WHERE split = 'valid'), 0) AS valid,
+             COALESCE(SUM(delta) FILTER (WHERE split = 'test'), 0) AS test
+      FROM (SELECT dataset_id, split, 1 AS delta FROM new_rows) deltas
+      GROUP BY dataset_id
+    ) m
+    WHERE d.id = m.dataset_id;
+  ELSIF TG_OP = 'DELETE' THEN
+    UPDATE datasets d
+    SET conversation_count = d.conversation_count + m.total,
+        train_count = d.train_count + m.train,
+        valid_count = d.valid_count + m.valid,
+        test_count = d.test_count + m.test
+    FROM (
+      SELECT dataset_id,
+             SUM(delta) AS total,
+             COALESCE(SUM(delta) FILTER (WHERE split = 'train'), 0) AS train,
+             COALESCE(SUM(delta) FILTER (WHERE split = 'valid'), 0) AS valid,
+             COALESCE(SUM(delta) FILTER (WHERE split = 'test'), 0) AS test
+      FROM (SELECT dataset_id, split, -1 AS delta FROM old_rows) deltas
+      GROUP BY dataset_id
+    ) m
+    WHERE d.id = m.dataset_id;
+  ELSE
+    UPDATE datasets d
+    SET conversation_count = d.conversation_count + m.total,
+        train_count = d.train_count + m.train,
+        valid_count = d.valid_count + m.valid,
+        test_count = d.test_count + m.test
+    FROM (
+      SELECT dataset_id,
+             SUM(delta) AS total,
+             COALESCE(SUM(delta) FILTER (WHERE split = 'train'), 0) AS train,
+             COALESCE(SUM(delta) FILTER (WHERE split = 'valid'), 0) AS valid,
+             COALESCE(SUM(delta) FILTER (WHERE split = 'test'), 0) AS test
+      FROM (
+        SELECT n.dataset_id, n.split, 1 AS delta
+        FROM new_rows n JOIN old_rows o ON o.id = n.id
+        WHERE (o.dataset_id, o.split) IS DISTINCT FROM (n.dataset_id, n.split)
+        UNION ALL
+        SELECT o.dataset_id, o.split, -1 AS delta
+        FROM new_rows n JOIN old_rows o ON o.id = n.id
+        WHERE (o.dataset_id, o.split) IS DISTINCT FROM (n.dataset_id, n.split)
+      ) deltas
+      GROUP BY dataset_id
+    ) m
+    WHERE d.id = m.dataset_id;
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,214 @@
+-- Enforce dataset locks (017) in the database so a write that passed the API's cached lock
+-- check cannot land after the lock is taken. Statement-level triggers collect the datasets a
+-- statement touched and take FOR KEY SHARE on their rows: that conflicts with the FOR UPDATE
+-- in LockDataset (so a lock waits for in-flight writers and later writers see it) but not
+-- with the count triggers' updates of the same rows. A live lock raises SQLSTATE DL423 with
+-- the lock as JSON detail, which the API reports as 423 dataset_locked.
+CREATE OR REPLACE FUNCTION datasets_assert_unlocked(ids BIGINT[]) RETURNS void AS $$
+DECLARE
+  d RECORD;
+BEGIN
+  IF ids IS NULL OR cardinality(ids) = 0 THEN
+    RETURN;
+  END IF;
+  PERFORM 1 FROM datasets WHERE id = ANY(ids) ORDER BY id FOR KEY SHARE;
+  SELECT id, locked_by, locked_at, lock_expires_at INTO d
+  FROM datasets
+  WHERE id = ANY(ids)
+    AND locked_at IS NOT NULL
+    AND (lock_expires_at IS NULL OR lock_expires_at > now())
+  ORDER BY id
+  LIMIT 1;
+  IF FOUND THEN
+    RAISE EXCEPTION 'dataset % is locked by %', d.id, d.locked_by
+      USING ERRCODE = 'DL423',
+            DETAIL = json_build_object(
+              'dataset_id', d.id, 'by', d.locked_by, 'at', d.locked_at, 'expires_at', d.lock_expires_at
+            )::text;
+  END IF;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Rows carrying dataset_id directly.
+CREATE OR REPLACE FUNCTION datasets_refuse_locked_rows() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    PERFORM datasets_assert_unlocked(ARRAY(SELECT DISTINCT dataset_id FROM new_rows));
+  ELSIF TG_OP = 'DELETE' THEN
+    PERFORM datasets_assert_unlocked(ARRAY(SELECT DISTINCT dataset_id FROM old_rows));
+  ELSE
+    PERFORM datasets_assert_unlocked(ARRAY(
+      SELECT dataset_id FROM new_rows UNION SELECT dataset_id FROM old_rows
+    ));
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Rows hanging off a conversation (messages, ratings, alternatives).
+CREATE OR REPLACE FUNCTION datasets_refuse_locked_conversation_rows() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    PERFORM datasets_assert_unlocked(ARRAY(
+      SELECT DISTINCT c.dataset_id FROM conversations c WHERE c.id IN (SELECT conversation_id FROM new_rows)
+    ));
+  ELSIF TG_OP = 'DELETE' THEN
+    PERFORM datasets_assert_unlocked(ARRAY(
+      SELECT DISTINCT c.dataset_id FROM conversations c WHERE c.id IN (SELECT conversation_id FROM old_rows)
+    ));
+  ELSE
+    PERFORM datasets_assert_unlocked(ARRAY(
+      SELECT DISTINCT c.dataset_id FROM conversations c
+      WHERE c.id IN (SELECT conversation_id FROM new_rows UNION SELECT conversation_id FROM old_rows)
+    ));
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Item annotations, via their item.
+CREATE OR REPLACE FUNCTION datasets_refuse_locked_item_rows() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    PERFORM datasets_assert_unlocked(ARRAY(
+      SELECT DISTINCT i.dataset_id FROM dataset_items i WHERE i.id IN (SELECT item_id FROM new_rows)
+    ));
+  ELSIF TG_OP = 'DELETE' THEN
+    PERFORM datasets_assert_unlocked(ARRAY(
+      SELECT DISTINCT i.dataset_id FROM dataset_items i WHERE i.id IN (SELECT item_id FROM old_rows)
+    ));
+  ELSE
+    PERFORM datasets_assert_unlocked(ARRAY(
+      SELECT DISTINCT i.dataset_id FROM dataset_items i
+      WHERE i.id IN (SELECT item_id FROM new_rows UNION SELECT item_id FROM old_rows)
+    ));
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS conversations_lock_insert_trg ON conversations;
+CREATE TRIGGER conversations_lock_insert_trg
+  AFTER INSERT ON conversations
+  REFERENCING NEW TABLE AS new_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_refuse_locked_rows();
+
+DROP TRIGGER IF EXISTS conversations_lock_update_trg ON conversations;
+CREATE TRIGGER conversations_lock_update_trg
+  AFTER UPDATE ON conversations
+  REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_refuse_locked_rows();
+
+DROP TRIGGER IF EXISTS conversations_lock_delete_trg ON conversations;
+CREATE TRIGGER conversations_lock_delete_trg
+  AFTER DELETE ON conversations
+  REFERENCING OLD TABLE AS old_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_refuse_locked_rows();
+
+DROP TRIGGER IF EXISTS dataset_items_lock_insert_trg ON dataset_items;
+CREATE TRIGGER dataset_items_lock_insert_trg
+  AFTER INSERT ON dataset_items
+  REFERENCING NEW TABLE AS new_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_refuse_locked_rows();
+
+DROP TRIGGER IF EXISTS dataset_items_lock_update_trg ON dataset_items;
+CREATE TRIGGER dataset_items_lock_update_trg
+  AFTER UPDATE ON dataset_items
+  REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_refuse_locked_rows();
+
+DROP TRIGGER IF EXISTS dataset_items_lock_delete_trg ON dataset_items;
+CREATE TRIGGER dataset_items_lock_delete_trg
+  AFTER DELETE ON dataset_items
+  REFERENCING OLD TABLE AS old_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_refuse_locked_rows();
+
+DROP TRIGGER IF EXISTS preference_pairs_lock_insert_trg ON preference_pairs;
+CREATE TRIGGER preference_pairs_lock_insert_trg
+  AFTER INSERT ON preference_pairs
+  REFERENCING NEW TABLE AS new_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_refuse_locked_rows();
+
+DROP TRIGGER IF EXISTS preference_pairs_lock_update_trg ON preference_pairs;
+CREATE TRIGGER preference_pairs_lock_update_trg
+  AFTER UPDATE ON preference_pairs
+  REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_refuse_locked_rows();
+
+DROP TRIGGER IF EXISTS preference_pairs_lock_delete_trg ON preference_pairs;
+CREATE TRIGGER preference_pairs_lock_delete_trg
+  AFTER DELETE ON preference_pairs
+  REFERENCING OLD TABLE AS old_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_refuse_locked_rows();
+
+DROP TRIGGER IF EXISTS conversation_messages_lock_insert_trg ON conversation_messages;
+CREATE TRIGGER conversation_messages_lock_insert_trg
+  AFTER INSERT ON conversation_messages
+  REFERENCING NEW TABLE AS new_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_refuse_locked_conversation_rows();
+
+DROP TRIGGER IF EXISTS conversation_messages_lock_update_trg ON conversation_messages;
+CREATE TRIGGER conversation_messages_lock_update_trg
+  AFTER UPDATE ON conversation_messages
+  REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_refuse_locked_conversation_rows();
+
+DROP TRIGGER IF EXISTS conversation_messages_lock_delete_trg ON conversation_messages;
+CREATE TRIGGER conversation_messages_lock_delete_trg
+  AFTER DELETE ON conversation_messages
+  REFERENCING OLD TABLE AS old_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_refuse_locked_conversation_rows();
+
+DROP TRIGGER IF EXISTS conversation_ratings_lock_insert_trg ON conversation_ratings;
+CREATE TRIGGER conversation_ratings_lock_insert_trg
+  AFTER INSERT ON conversation_ratings
+  REFERENCING NEW TABLE AS new_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_refuse_locked_conversation_rows();
+
+DROP TRIGGER IF EXISTS conversation_ratings_lock_update_trg ON conversation_ratings;
+CREATE TRIGGER conversation_ratings_lock_update_trg
+  AFTER UPDATE ON conversation_ratings
+  REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_refuse_locked_conversation_rows();
+
+DROP TRIGGER IF EXISTS conversation_ratings_lock_delete_trg ON conversation_ratings;
+CREATE TRIGGER conversation_ratings_lock_delete_trg
+  AFTER DELETE ON conversation_ratings
+  REFERENCING OLD TABLE AS old_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_refuse_locked_conversation_rows();
+
+DROP TRIGGER IF EXISTS message_alternatives_lock_insert_trg ON message_alternatives;
+CREATE TRIGGER message_alternatives_lock_insert_trg
+  AFTER INSERT ON message_alternatives
+  REFERENCING NEW TABLE AS new_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_refuse_locked_conversation_rows();
+
+DROP TRIGGER IF EXISTS message_alternatives_lock_update_trg ON message_alternatives;
+CREATE TRIGGER message_alternatives_lock_update_trg
+  AFTER UPDATE ON message_alternatives
+  REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_refuse_locked_conversation_rows();
+
+DROP TRIGGER IF EXISTS message_alternatives_lock_delete_trg ON message_alternatives;
+CREATE TRIGGER message_alternatives_lock_delete_trg
+  AFTER DELETE ON message_alternatives
+  REFERENCING OLD TABLE AS old_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_refuse_locked_conversation_rows();
+
+DROP TRIGGER IF EXISTS item_annotations_lock_insert_trg ON item_annotations;
+CREATE TRIGGER item_annotations_lock_insert_trg
+  AFTER INSERT ON item_annotations
+  REFERENCING NEW TABLE AS new_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_refuse_locked_item_rows();
+
+DROP TRIGGER IF EXISTS item_annotations_lock_update_trg ON item_annotations;
+CREATE TRIGGER item_annotations_lock_update_trg
+  AFTER UPDATE ON item_annotations
+  REFERENCING OLD TABLE AS old_rows NEW TABLE AS new_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_refuse_locked_item_rows();
+
+DROP TRIGGER IF EXISTS item_annotations_lock_delete_trg ON item_annotations;
+CREATE TRIGGER item_annotations_lock_delete_trg
+  AFTER DELETE ON item_annotations
+  REFERENCING OLD TABLE AS old_rows
+  FOR EACH STATEMENT EXECUTE FUNCTION datasets_refuse_locked_item_rows();
@@ -0,0 +1,30 @@
+-- Key alternatives (027) to their message row instead of its position: rewriting a
+-- conversation's messages deletes and reinserts them, and reindexing or inserting messages
+-- shifts idx, so an idx-keyed draft could later be promoted over a different reply. With
+-- message_id the alternatives follow a renumbered message and go away with a deleted one.
+-- Rows whose position no longer names a message are dropped; the idx is read through the
+-- message from now on. The backfill is bookkeeping, not an edit, so it bypasses the lock
+-- triggers (036).
+ALTER TABLE message_alternatives
+  ADD COLUMN IF NOT EXISTS message_id BIGINT REFERENCES conversation_messages(id) ON DELETE CASCADE;
+
+ALTER TABLE message_alternatives DISABLE TRIGGER message_alternatives_lock_update_trg;
+ALTER TABLE message_alternatives DISABLE TRIGGER message_alternatives_lock_delete_trg;
+
+UPDATE message_alternatives a
+SET message_id = m.id
+FROM conversation_messages m
+WHERE a.message_id IS NULL AND m.conversation_id = a.conversation_id AND m.idx = a.message_idx;
+
+DELETE FROM message_alternatives WHERE message_id IS NULL;
+
+ALTER TABLE message_alternatives ENABLE TRIGGER message_alternatives_lock_update_trg;
+ALTER TABLE message_alternatives ENABLE TRIGGER message_alternatives_lock_delete_trg;
+
+ALTER TABLE message_alternatives ALTER COLUMN message_id SET NOT NULL;
+ALTER TABLE message_alternatives DROP COLUMN IF EXISTS message_idx;
+
+CREATE INDEX IF NOT EXISTS message_alternatives_message_idx
+  ON message_alternatives (message_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS message_alternatives_conversation_id_idx
+  ON message_alternatives (conversation_id);
@@ -0,0 +1,12 @@
+-- Hash indexes for the preference candidate query (032): a sampled reply finds replies to
+-- the same user prompt by md5(content) of the user messages, and already rated pairs are
+-- found by md5(prompt), so neither lookup compares full texts row by row.
+--
+-- This is a .no-tx migration so the indexes build CONCURRENTLY without blocking writes or
+-- running into the transactional migration timeout on large tables. If a concurrent build
+-- fails it leaves an INVALID index behind that IF NOT EXISTS would then skip; drop it
+-- before restarting.
+CREATE INDEX CONCURRENTLY IF NOT EXISTS conversation_messages_user_content_md5_idx
+  ON conversation_messages (md5(content)) WHERE role = 'user';
+CREATE INDEX CONCURRENTLY IF NOT EXISTS preference_pairs_prompt_hash_idx
+  ON preference_pairs (dataset_id, md5(prompt));
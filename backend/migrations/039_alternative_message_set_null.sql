@@ -0,0 +1,11 @@
+-- Let alternatives (037) outlive a rewrite of their conversation's messages: deleting a
+-- message now detaches its alternatives instead of deleting them, and UpdateConversation
+-- reattaches them to the assistant message at the same idx once the new messages are in,
+-- deleting the ones left without a message in the same transaction. Existing rows were
+-- checked by the constraint being replaced, so the new one is added NOT VALID to skip the
+-- table scan.
+ALTER TABLE message_alternatives DROP CONSTRAINT IF EXISTS message_alternatives_message_id_fkey;
+ALTER TABLE message_alternatives ALTER COLUMN message_id DROP NOT NULL;
+ALTER TABLE message_alternatives
+  ADD CONSTRAINT message_alternatives_message_id_fkey
+  FOREIGN KEY (message_id) REFERENCES conversation_messages(id) ON DELETE SET NULL NOT VALID;
@@ -13,11 +13,15 @@ import {
   getConversation,
   getDataset,
   getDatasetItem,
+  getExportOptions,
   listDatasetConversations,
+  listSources,
   listDatasetItems,
   listDatasets,
   listProposalsAdmin,
+  lockDataset,
   rejectProposal,
+  unlockDataset,
   updateConversation,
   updateDataset,
   updateDatasetItem,
@@ -29,6 +33,7 @@ import {
   type Proposal,
   type ProposalStatus,
   type Role,
+  type SourceCount,
   type Split
 } from './api'
 
@@ -223,6 +228,18 @@ function Datasets() {
                 <div style={{ height: 6 }} />
                 <div style={{ color: 'var(--muted)', fontWeight: 700 }}>{d.conversation_count}</div>
                 <small>conversations</small>
+                {d.lock && (
+                  <div>
+                    <small style={{ color: 'var(--muted)' }}>locked by {d.lock.by}</small>
+                  </div>
+                )}
+                {d.conversation_count > 0 && (
+                  <div>
+                    <small style={{ color: 'var(--muted)' }}>
+                      train {d.train_count} · valid {d.valid_count} · test {d.test_count}
+                    </small>
+                  </div>
+                )}
               </div>
             </div>
           </a>
@@ -257,6 +274,8 @@ function DatasetDetail({ datasetId }: { datasetId: number }) {
   const [convQ, setConvQ] = useState('')
   const [split, setSplit] = useState<Split>('train')
   const [status, setStatus] = useState<ConversationStatus>('approved')
+  const [convSource, setConvSource] = useState('')
+  const [sources, setSources] = useState<SourceCount[]>([])
   const [convos, setConvos] = useState<Conversation[]>([])
   const [loadingConvos, setLoadingConvos] = useState(false)
 
@@ -316,6 +335,7 @@ function DatasetDetail({ datasetId }: { datasetId: number }) {
         q: convQ.trim() || undefined,
         split,
         status,
+        source: convSource || undefined,
         limit: 200,
         offset: 0
       })
@@ -342,7 +362,7 @@ function DatasetDetail({ datasetId }: { datasetId: number }) {
   async function onSaveDataset() {
     if (!dataset || !canAdmin) return
     try {
-      const updated = await updateDataset(dataset.id, { name: editDatasetName, description: editDatasetDesc, kind: editDatasetKind }, adminToken)
+      const updated = await updateDataset(dataset.id, { name: editDatasetName, description: editDatasetDesc, kind: editDatasetKind || undefined }, adminToken)
       setDataset(updated)
     } catch (e: any) {
       setError(e?.message ?? 'failed to update dataset')
@@ -351,16 +371,31 @@ function DatasetDetail({ datasetId }: { datasetId: number }) {
 
   async function onDeleteDataset() {
     if (!dataset || !canAdmin) return
-    const ok = window.confirm(`Delete dataset "${dataset.name}" and all its items/conversations? This cannot be undone.`)
+    const ok = window.confirm(`Delete dataset "${dataset.name}"? It will be hidden and its conversations archived.`)
     if (!ok) return
     try {
-      await deleteDataset(dataset.id, adminToken)
+      await deleteDataset(dataset.id, dataset.name, adminToken)
       window.location.hash = '#/datasets'
     } catch (e: any) {
       setError(e?.message ?? 'failed to delete dataset')
     }
   }
 
+  async function onToggleLock() {
+    if (!dataset || !canAdmin) return
+    try {
+      if (dataset.lock) {
+        setDataset(await unlockDataset(dataset.id, adminToken))
+        return
+      }
+      const by = window.prompt('Lock edits on behalf of (e.g. the training run name):')
+      if (!by) return
+      setDataset(await lockDataset(dataset.id, by, adminToken))
+    } catch (e: any) {
+      setError(e?.message ?? 'failed to change dataset lock')
+    }
+  }
+
   async function onCreateConversation() {
     if (!canAdmin) return
     try {
@@ -399,6 +434,7 @@ function DatasetDetail({ datasetId }: { datasetId: number }) {
 
   useEffect(() => {
     void loadDataset()
+    setConvSource('')
     setSelected(null)
     setSelectedId(null)
     setSelectedErr(null)
@@ -410,7 +446,10 @@ function DatasetDetail({ datasetId }: { datasetId: number }) {
 
   useEffect(() => {
     if (view === 'items') void loadItems()
-    if (view === 'conversations') void loadConversations()
+    if (view === 'conversations') {
+      void loadConversations()
+      listSources(datasetId).then(setSources, () => setSources([]))
+    }
     // eslint-disable-next-line react-hooks/exhaustive-deps
   }, [view, datasetId])
 
@@ -439,6 +478,13 @@ function DatasetDetail({ datasetId }: { datasetId: number }) {
 	        </div>
 	      </div>
 
+      {dataset?.lock && (
+        <div className="banner" style={{ marginTop: 10 }}>
+          Locked by {dataset.lock.by} since {new Date(dataset.lock.at).toLocaleString()}
+          {dataset.lock.expires_at ? ` (until ${new Date(dataset.lock.expires_at).toLocaleString()})` : ''}: edits are refused, reads and exports still work.
+        </div>
+      )}
+
       <div style={{ marginTop: 10 }}>
         <div className="pairLabel">admin token (for CRUD)</div>
         <input value={adminToken} onChange={(e) => setAdminToken(e.target.value)} placeholder="DATALAB_ADMIN_TOKEN" />
@@ -462,6 +508,9 @@ function DatasetDetail({ datasetId }: { datasetId: number }) {
   	              <input value={editDatasetDesc} onChange={(e) => setEditDatasetDesc(e.target.value)} placeholder="description" />
   	            </div>
   	            <button onClick={onSaveDataset}>Save</button>
+  	            <button className="secondary" onClick={onToggleLock}>
+  	              {dataset.lock ? 'Unlock' : 'Lock'}
+  	            </button>
   	            <button className="danger" onClick={onDeleteDataset}>
   	              Delete
             </button>
@@ -512,6 +561,22 @@ function DatasetDetail({ datasetId }: { datasetId: number }) {
                 <option value="archived" />
               </datalist>
             </div>
+            <div style={{ width: 200 }}>
+              <select
+                value={convSource}
+                onChange={(e) => setConvSource(e.target.value)}
+                style={{ width: '100%', padding: '10px 12px', borderRadius: 12, border: '1px solid var(--border)', background: 'rgba(0,0,0,0.25)', color: 'var(--text)' }}
+              >
+                <option value="">any source</option>
+                {sources
+                  .filter((s) => s.source)
+                  .map((s) => (
+                    <option key={s.source} value={s.source}>
+                      {s.source} ({s.count})
+                    </option>
+                  ))}
+              </select>
+            </div>
             <button className="secondary" onClick={loadConversations}>
               {loadingConvos ? 'Loading…' : 'Refresh'}
             </button>
@@ -1173,7 +1238,8 @@ function Export() {
   const [datasets, setDatasets] = useState<Dataset[]>([])
   const [datasetId, setDatasetId] = useState<number | 'all'>('all')
 
-  const [type, setType] = useState<'pairs' | 'conversations' | 'items' | 'items_with_meta'>('pairs')
+  const [type, setType] = useState('pairs')
+  const [exportTypes, setExportTypes] = useState<string[]>(['pairs', 'conversations', 'items', 'items_with_meta'])
   const [split, setSplit] = useState<'train' | 'valid' | 'test' | 'all'>('train')
   const [status, setStatus] = useState<ConversationStatus>('approved')
 
@@ -1188,6 +1254,9 @@ function Export() {
       const res = await listDatasets({ limit: 200, offset: 0 })
       setDatasets(res.items)
     })()
+    void getExportOptions()
+      .then((o) => setExportTypes(o.types))
+      .catch(() => {})
   }, [])
 
   const url = exportUrl({
@@ -1222,12 +1291,11 @@ function Export() {
         </div>
         <div style={{ width: 220 }}>
           <div className="pairLabel">type</div>
-          <input value={type} onChange={(e) => setType(e.target.value as any)} list="exporttypes" />
+          <input value={type} onChange={(e) => setType(e.target.value)} list="exporttypes" />
           <datalist id="exporttypes">
-            <option value="pairs" />
-            <option value="conversations" />
-            <option value="items" />
-            <option value="items_with_meta" />
+            {exportTypes.map((t) => (
+              <option key={t} value={t} />
+            ))}
           </datalist>
         </div>
         <div style={{ width: 160 }}>
@@ -8,6 +8,8 @@ export type Message = {
   content: string
   name?: string
   meta?: any
+  alternative_count?: number
+  alternatives?: MessageAlternative[]
 }
 
 export type Dataset = {
@@ -15,12 +17,23 @@ export type Dataset = {
   name: string
   description: string
   kind: string
+  project_id: number
   item_count: number
   conversation_count: number
+  train_count: number
+  valid_count: number
+  test_count: number
+  lock: DatasetLock | null
   created_at: string
   updated_at: string
 }
 
+export type DatasetLock = {
+  by: string
+  at: string
+  expires_at?: string
+}
+
 export type DatasetItem = {
   id: number
   dataset_id: number
@@ -28,6 +41,8 @@ export type DatasetItem = {
   source_ref: string
   created_at: string
   updated_at: string
+  dataset_name?: string
+  dataset_kind?: string
 }
 
 export type Conversation = {
@@ -38,8 +53,12 @@ export type Conversation = {
   tags: string[]
   source: string
   notes: string
+  meta?: Record<string, unknown>
   created_at: string
   updated_at: string
+  messages_updated_at?: string
+  dataset_name?: string
+  dataset_kind?: string
   message_count?: number
   preview_user?: string
   preview_assistant?: string
@@ -54,6 +73,11 @@ export type Proposal = {
   decided_at: string | null
 }
 
+export type SourceCount = {
+  source: string
+  count: number
+}
+
 // Prefer relative API calls (so the UI works when served from another machine).
 // For local dev you can set VITE_API_BASE_URL=http://localhost:8080
 const API_BASE = (import.meta.env.VITE_API_BASE_URL as string | undefined) ?? ''
@@ -62,6 +86,15 @@ export function apiBase(): string {
   return (API_BASE || '').replace(/\/$/, '')
 }
 
+// The header carrying the admin token; match the API's DATALAB_AUTH_HEADER. With
+// Authorization the token is sent as a Bearer token.
+const AUTH_HEADER = (import.meta.env.VITE_AUTH_HEADER as string | undefined) || 'X-Admin-Token'
+
+function authHeaders(adminToken: string): Record<string, string> {
+  const value = AUTH_HEADER.toLowerCase() === 'authorization' ? `Bearer ${adminToken}` : adminToken
+  return { [AUTH_HEADER]: value }
+}
+
 function apiUrl(path: string): string {
   const base = apiBase()
   if (!base) return path
@@ -75,9 +108,25 @@ function toURL(path: string): URL {
 }
 
 // Datasets
-export async function listDatasets(params: { q?: string; limit?: number; offset?: number }): Promise<{ items: Dataset[]; limit: number; offset: number }> {
+export type Project = {
+  id: number
+  slug: string
+  name: string
+  dataset_count: number
+  created_at: string
+  updated_at: string
+}
+
+export async function listProjects(): Promise<{ items: Project[] }> {
+  const res = await fetch(apiUrl('/api/v1/projects'))
+  if (!res.ok) throw new Error('failed to list projects')
+  return res.json()
+}
+
+export async function listDatasets(params: { q?: string; project?: string; limit?: number; offset?: number }): Promise<{ items: Dataset[]; limit: number; offset: number }> {
   const url = toURL('/api/v1/datasets')
   if (params.q) url.searchParams.set('q', params.q)
+  if (params.project) url.searchParams.set('project', params.project)
   if (params.limit != null) url.searchParams.set('limit', String(params.limit))
   if (params.offset != null) url.searchParams.set('offset', String(params.offset))
 
@@ -95,7 +144,7 @@ export async function getDataset(id: number): Promise<Dataset> {
 export async function createDataset(body: { name: string; description?: string; kind?: string }, adminToken: string): Promise<Dataset> {
   const res = await fetch(apiUrl('/api/v1/datasets'), {
     method: 'POST',
-    headers: { 'Content-Type': 'application/json', 'X-Admin-Token': adminToken },
+    headers: { 'Content-Type': 'application/json', ...authHeaders(adminToken) },
     body: JSON.stringify({ name: body.name, description: body.description ?? '', kind: body.kind ?? '' })
   })
   if (!res.ok) throw new Error('failed to create dataset')
@@ -105,21 +154,46 @@ export async function createDataset(body: { name: string; description?: string;
 export async function updateDataset(id: number, body: { name?: string; description?: string; kind?: string }, adminToken: string): Promise<Dataset> {
   const res = await fetch(apiUrl(`/api/v1/datasets/${id}`), {
     method: 'PATCH',
-    headers: { 'Content-Type': 'application/json', 'X-Admin-Token': adminToken },
-    body: JSON.stringify({ name: body.name ?? '', description: body.description ?? '', kind: body.kind ?? '' })
+    headers: { 'Content-Type': 'application/json', ...authHeaders(adminToken) },
+    // Omitted fields stay unchanged; description '' clears it.
+    body: JSON.stringify(body)
   })
   if (!res.ok) throw new Error('failed to update dataset')
   return res.json()
 }
 
-export async function deleteDataset(id: number, adminToken: string): Promise<void> {
-  const res = await fetch(apiUrl(`/api/v1/datasets/${id}`), {
+// The API only deletes when confirm matches the dataset name; hard=false soft-deletes.
+export async function deleteDataset(id: number, name: string, adminToken: string, hard = false): Promise<void> {
+  const url = toURL(`/api/v1/datasets/${id}`)
+  url.searchParams.set('confirm', name)
+  if (hard) url.searchParams.set('hard', 'true')
+  const res = await fetch(url.toString(), {
     method: 'DELETE',
-    headers: { 'X-Admin-Token': adminToken }
+    headers: authHeaders(adminToken)
   })
   if (!res.ok) throw new Error('failed to delete dataset')
 }
 
+// ttl is a Go duration like "6h"; omit it for the server default, "0" never expires.
+export async function lockDataset(id: number, lockedBy: string, adminToken: string, ttl?: string): Promise<Dataset> {
+  const res = await fetch(apiUrl(`/api/v1/datasets/${id}/lock`), {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json', ...authHeaders(adminToken) },
+    body: JSON.stringify({ locked_by: lockedBy, ttl: ttl ?? '' })
+  })
+  if (!res.ok) throw new Error('failed to lock dataset')
+  return res.json()
+}
+
+export async function unlockDataset(id: number, adminToken: string): Promise<Dataset> {
+  const res = await fetch(apiUrl(`/api/v1/datasets/${id}/unlock`), {
+    method: 'POST',
+    headers: authHeaders(adminToken)
+  })
+  if (!res.ok) throw new Error('failed to unlock dataset')
+  return res.json()
+}
+
 // Dataset Items
 export async function listDatasetItems(params: {
   datasetId: number
@@ -145,7 +219,7 @@ export async function getDatasetItem(id: number): Promise<DatasetItem> {
 export async function createDatasetItem(datasetId: number, body: { data: any; source_ref?: string }, adminToken: string): Promise<DatasetItem> {
   const res = await fetch(apiUrl(`/api/v1/datasets/${datasetId}/items`), {
     method: 'POST',
-    headers: { 'Content-Type': 'application/json', 'X-Admin-Token': adminToken },
+    headers: { 'Content-Type': 'application/json', ...authHeaders(adminToken) },
     body: JSON.stringify({ data: body.data, source_ref: body.source_ref ?? '' })
   })
   if (!res.ok) throw new Error('failed to create item')
@@ -155,7 +229,7 @@ export async function createDatasetItem(datasetId: number, body: { data: any; so
 export async function updateDatasetItem(id: number, body: { data?: any; source_ref?: string }, adminToken: string): Promise<DatasetItem> {
   const res = await fetch(apiUrl(`/api/v1/items/${id}`), {
     method: 'PATCH',
-    headers: { 'Content-Type': 'application/json', 'X-Admin-Token': adminToken },
+    headers: { 'Content-Type': 'application/json', ...authHeaders(adminToken) },
     body: JSON.stringify({ data: body.data, source_ref: body.source_ref })
   })
   if (!res.ok) throw new Error('failed to update item')
@@ -165,7 +239,7 @@ export async function updateDatasetItem(id: number, body: { data?: any; source_r
 export async function deleteDatasetItem(id: number, adminToken: string): Promise<void> {
   const res = await fetch(apiUrl(`/api/v1/items/${id}`), {
     method: 'DELETE',
-    headers: { 'X-Admin-Token': adminToken }
+    headers: authHeaders(adminToken)
   })
   if (!res.ok) throw new Error('failed to delete item')
 }
@@ -176,6 +250,7 @@ export async function listDatasetConversations(params: {
   q?: string
   split?: Split
   status?: ConversationStatus
+  source?: string
   limit?: number
   offset?: number
 }): Promise<{ items: Conversation[]; limit: number; offset: number }> {
@@ -183,6 +258,7 @@ export async function listDatasetConversations(params: {
   if (params.q) url.searchParams.set('q', params.q)
   if (params.split) url.searchParams.set('split', params.split)
   if (params.status) url.searchParams.set('status', params.status)
+  if (params.source) url.searchParams.set('source', params.source)
   if (params.limit != null) url.searchParams.set('limit', String(params.limit))
   if (params.offset != null) url.searchParams.set('offset', String(params.offset))
 
@@ -191,12 +267,41 @@ export async function listDatasetConversations(params: {
   return res.json()
 }
 
+export async function listSources(datasetId: number): Promise<SourceCount[]> {
+  const res = await fetch(apiUrl(`/api/v1/datasets/${datasetId}/sources`))
+  if (!res.ok) throw new Error('failed to list sources')
+  const body = await res.json()
+  return body.sources
+}
+
 export async function getConversation(id: number): Promise<Conversation> {
   const res = await fetch(apiUrl(`/api/v1/conversations/${id}`))
   if (!res.ok) throw new Error('failed to get conversation')
   return res.json()
 }
 
+export async function getConversations(ids: number[]): Promise<{ items: Conversation[]; missing: number[] }> {
+  const url = toURL('/api/v1/conversations')
+  url.searchParams.set('ids', ids.join(','))
+  const res = await fetch(url.toString())
+  if (!res.ok) throw new Error('failed to get conversations')
+  return res.json()
+}
+
+export async function duplicateConversation(
+  id: number,
+  body: { dataset_id?: number; split?: Split; status?: string; tags?: string[]; notes?: string },
+  adminToken: string
+): Promise<Conversation> {
+  const res = await fetch(apiUrl(`/api/v1/conversations/${id}/duplicate`), {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json', ...authHeaders(adminToken) },
+    body: JSON.stringify(body)
+  })
+  if (!res.ok) throw new Error('failed to duplicate conversation')
+  return res.json()
+}
+
 export async function createConversation(body: {
   dataset_id: number
   split: Split
@@ -208,7 +313,7 @@ export async function createConversation(body: {
 }, adminToken: string): Promise<Conversation> {
   const res = await fetch(apiUrl('/api/v1/conversations'), {
     method: 'POST',
-    headers: { 'Content-Type': 'application/json', 'X-Admin-Token': adminToken },
+    headers: { 'Content-Type': 'application/json', ...authHeaders(adminToken) },
     body: JSON.stringify(body)
   })
   if (!res.ok) throw new Error('failed to create conversation')
@@ -226,7 +331,7 @@ export async function updateConversation(id: number, body: {
 }, adminToken: string): Promise<Conversation> {
   const res = await fetch(apiUrl(`/api/v1/conversations/${id}`), {
     method: 'PATCH',
-    headers: { 'Content-Type': 'application/json', 'X-Admin-Token': adminToken },
+    headers: { 'Content-Type': 'application/json', ...authHeaders(adminToken) },
     body: JSON.stringify(body)
   })
   if (!res.ok) throw new Error('failed to update conversation')
@@ -236,7 +341,7 @@ export async function updateConversation(id: number, body: {
 export async function deleteConversation(id: number, adminToken: string): Promise<void> {
   const res = await fetch(apiUrl(`/api/v1/conversations/${id}`), {
     method: 'DELETE',
-    headers: { 'X-Admin-Token': adminToken }
+    headers: authHeaders(adminToken)
   })
   if (!res.ok) throw new Error('failed to delete conversation')
 }
@@ -267,16 +372,33 @@ export async function listProposalsAdmin(status: ProposalStatus, adminToken: str
   url.searchParams.set('status', status)
 
   const res = await fetch(url.toString(), {
-    headers: { 'X-Admin-Token': adminToken }
+    headers: authHeaders(adminToken)
   })
   if (!res.ok) throw new Error('failed to list proposals')
   return res.json()
 }
 
+export async function purgeProposals(
+  status: 'rejected' | 'approved',
+  olderThan: string,
+  adminToken: string
+): Promise<{ status: string; older_than: string; purged: number }> {
+  const url = toURL('/api/v1/proposals')
+  url.searchParams.set('status', status)
+  url.searchParams.set('older_than', olderThan)
+
+  const res = await fetch(url.toString(), {
+    method: 'DELETE',
+    headers: authHeaders(adminToken)
+  })
+  if (!res.ok) throw new Error('failed to purge proposals')
+  return res.json()
+}
+
 export async function approveProposal(id: number, adminToken: string): Promise<Conversation> {
   const res = await fetch(apiUrl(`/api/v1/proposals/${id}/approve`), {
     method: 'POST',
-    headers: { 'X-Admin-Token': adminToken }
+    headers: authHeaders(adminToken)
   })
   if (!res.ok) throw new Error('failed to approve')
   return res.json()
@@ -285,14 +407,360 @@ export async function approveProposal(id: number, adminToken: string): Promise<C
 export async function rejectProposal(id: number, adminToken: string): Promise<void> {
   const res = await fetch(apiUrl(`/api/v1/proposals/${id}/reject`), {
     method: 'POST',
-    headers: { 'X-Admin-Token': adminToken }
+    headers: authHeaders(adminToken)
   })
   if (!res.ok) throw new Error('failed to reject')
 }
 
+export type MessageAlternative = {
+  id: number
+  conversation_id: number
+  message_idx: number
+  content: string
+  model: string
+  author: string
+  meta: Record<string, unknown>
+  status: 'draft' | 'accepted' | 'replaced'
+  created_at: string
+  accepted_at: string | null
+}
+
+export async function regenerateMessage(id: number, messageIdx: number, adminToken: string): Promise<MessageAlternative> {
+  const url = toURL(`/api/v1/conversations/${id}/regenerate`)
+  url.searchParams.set('message_idx', String(messageIdx))
+
+  const res = await fetch(url.toString(), {
+    method: 'POST',
+    headers: authHeaders(adminToken)
+  })
+  if (!res.ok) throw new Error('failed to regenerate message')
+  return res.json()
+}
+
+export async function addAlternative(
+  id: number,
+  alt: { message_idx: number; content: string; author?: string; model?: string; meta?: Record<string, unknown> },
+  adminToken: string
+): Promise<MessageAlternative> {
+  const res = await fetch(apiUrl(`/api/v1/conversations/${id}/alternatives`), {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json', ...authHeaders(adminToken) },
+    body: JSON.stringify(alt)
+  })
+  if (!res.ok) throw new Error('failed to add alternative')
+  return res.json()
+}
+
+export async function acceptAlternative(id: number, alternativeId: number, adminToken: string): Promise<Conversation> {
+  const res = await fetch(apiUrl(`/api/v1/conversations/${id}/alternatives/${alternativeId}/promote`), {
+    method: 'POST',
+    headers: authHeaders(adminToken)
+  })
+  if (!res.ok) throw new Error('failed to accept alternative')
+  return res.json()
+}
+
+export type PreferencePair = {
+  id: number
+  dataset_id: number
+  split: Split
+  conversation_id: number | null
+  message_idx: number | null
+  prompt: string
+  chosen: string
+  rejected: string
+  rater: string
+  created_at: string
+}
+
+export type PreferenceCandidate = {
+  prompt: string
+  responses: {
+    text: string
+    source: 'message' | 'alternative'
+    conversation_id: number
+    message_idx: number
+    alternative_id?: number
+  }[]
+}
+
+export async function getNextPreference(datasetId: number, seed?: number): Promise<PreferenceCandidate | null> {
+  const url = toURL(`/api/v1/datasets/${datasetId}/preferences/next`)
+  if (seed !== undefined) url.searchParams.set('seed', String(seed))
+
+  const res = await fetch(url.toString())
+  if (res.status === 204) return null
+  if (!res.ok) throw new Error('failed to load preference candidate')
+  const body = await res.json()
+  return body.candidate
+}
+
+export async function createPreference(
+  datasetId: number,
+  pair: { prompt?: string; conversation_id?: number; message_idx?: number; chosen: string; rejected: string; rater: string; split?: Split },
+  adminToken: string
+): Promise<PreferencePair> {
+  const res = await fetch(apiUrl(`/api/v1/datasets/${datasetId}/preferences`), {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json', ...authHeaders(adminToken) },
+    body: JSON.stringify(pair)
+  })
+  if (!res.ok) throw new Error('failed to save preference')
+  return res.json()
+}
+
+export type GenerationJob = {
+  id: number
+  dataset_id: number
+  prompt_template: string
+  system_prompt: string
+  seeds?: unknown[]
+  seed_dataset_id?: number
+  params: { model?: string; temperature?: number; max_tokens?: number }
+  target_count: number
+  concurrency: number
+  status: 'queued' | 'running' | 'succeeded' | 'failed' | 'canceled'
+  generated: number
+  failed: number
+  error: string
+  created_at: string
+  started_at: string | null
+  finished_at: string | null
+}
+
+export type CreateGenerationJob = {
+  dataset_id: number
+  prompt_template: string
+  system_prompt?: string
+  seeds?: unknown[]
+  seed_dataset_id?: number
+  target_count: number
+  concurrency?: number
+  model?: string
+  temperature?: number
+  max_tokens?: number
+}
+
+export async function createGenerationJob(job: CreateGenerationJob, adminToken: string): Promise<GenerationJob> {
+  const res = await fetch(apiUrl('/api/v1/generation-jobs'), {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json', ...authHeaders(adminToken) },
+    body: JSON.stringify(job)
+  })
+  if (!res.ok) throw new Error('failed to create generation job')
+  return res.json()
+}
+
+export type SimilarConversation = {
+  id: number
+  split: string
+  status: string
+  tags: string[]
+  source: string
+  preview_user: string
+  preview_assistant: string
+  embedded_at: string
+  score: number
+}
+
+export async function embedDataset(
+  datasetId: number,
+  opts: { text?: 'first_user' | 'full'; limit?: number; force?: boolean },
+  adminToken: string
+): Promise<{ model: string; text: string; dims: number; embedded: number; remaining: number }> {
+  const url = toURL(`/api/v1/datasets/${datasetId}/embed`)
+  if (opts.text) url.searchParams.set('text', opts.text)
+  if (opts.limit) url.searchParams.set('limit', String(opts.limit))
+  if (opts.force) url.searchParams.set('force', 'true')
+
+  const res = await fetch(url.toString(), {
+    method: 'POST',
+    headers: authHeaders(adminToken)
+  })
+  if (!res.ok) throw new Error('failed to embed dataset')
+  return res.json()
+}
+
+export type DatasetStats = {
+  conversations: number
+  messages: number
+  items: number
+  by_split: Record<string, number>
+  by_status: Record<string, number>
+  by_tag: Record<string, number>
+  avg_messages: number
+  avg_tokens: number
+}
+
+export type DatasetStatsSnapshot = {
+  id: number
+  dataset_id: number
+  taken_at: string
+  stats: DatasetStats
+}
+
+export async function snapshotDatasetStats(datasetId: number, adminToken: string): Promise<DatasetStatsSnapshot> {
+  const res = await fetch(apiUrl(`/api/v1/datasets/${datasetId}/stats/snapshot`), {
+    method: 'POST',
+    headers: authHeaders(adminToken)
+  })
+  if (!res.ok) throw new Error('failed to snapshot dataset stats')
+  return res.json()
+}
+
+export async function getDatasetStatsHistory(
+  datasetId: number,
+  range: { from?: string; to?: string } = {}
+): Promise<DatasetStatsSnapshot[]> {
+  const url = toURL(`/api/v1/datasets/${datasetId}/stats/history`)
+  if (range.from) url.searchParams.set('from', range.from)
+  if (range.to) url.searchParams.set('to', range.to)
+
+  const res = await fetch(url.toString())
+  if (!res.ok) throw new Error('failed to load dataset stats history')
+  const data = await res.json()
+  return data.snapshots
+}
+
+export async function similarConversations(
+  datasetId: number,
+  query: { q: string } | { likeId: number },
+  limit = 10,
+  adminToken = ''
+): Promise<SimilarConversation[]> {
+  const url = toURL(`/api/v1/datasets/${datasetId}/conversations/similar`)
+  if ('q' in query) url.searchParams.set('q', query.q)
+  else url.searchParams.set('like_id', String(query.likeId))
+  url.searchParams.set('limit', String(limit))
+
+  // Searching by q calls the embeddings endpoint and needs the admin token.
+  const res = await fetch(url.toString(), { headers: adminToken ? authHeaders(adminToken) : {} })
+  if (!res.ok) throw new Error('failed to search similar conversations')
+  const data = await res.json()
+  return data.results
+}
+
+export async function listGenerationJobs(datasetId: number): Promise<GenerationJob[]> {
+  const url = toURL('/api/v1/generation-jobs')
+  url.searchParams.set('dataset_id', String(datasetId))
+
+  const res = await fetch(url.toString())
+  if (!res.ok) throw new Error('failed to list generation jobs')
+  const data = await res.json()
+  return data.jobs
+}
+
+export async function getGenerationJob(id: number): Promise<GenerationJob> {
+  const res = await fetch(apiUrl(`/api/v1/generation-jobs/${id}`))
+  if (!res.ok) throw new Error('failed to get generation job')
+  return res.json()
+}
+
+export async function cancelGenerationJob(id: number, adminToken: string): Promise<GenerationJob> {
+  const res = await fetch(apiUrl(`/api/v1/generation-jobs/${id}/cancel`), {
+    method: 'POST',
+    headers: authHeaders(adminToken)
+  })
+  if (!res.ok) throw new Error('failed to cancel generation job')
+  return res.json()
+}
+
+export type FlagCategory = 'toxicity' | 'pii' | 'copyright' | 'other'
+
+export type Flag = {
+  id: number
+  conversation_id?: number
+  proposal_id?: number
+  category: FlagCategory
+  note: string
+  flagged_by: string
+  status: 'open' | 'resolved'
+  resolved_by: string | null
+  resolution: string | null
+  resolved_at: string | null
+  created_at: string
+}
+
+export async function flagConversation(
+  id: number,
+  body: { category: FlagCategory; note?: string; flagged_by?: string },
+  adminToken: string
+): Promise<Flag> {
+  const res = await fetch(apiUrl(`/api/v1/conversations/${id}/flag`), {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json', ...authHeaders(adminToken) },
+    body: JSON.stringify(body)
+  })
+  if (!res.ok) throw new Error('failed to flag conversation')
+  return res.json()
+}
+
+export async function listFlags(status: 'open' | 'resolved' | 'any', adminToken: string): Promise<{ items: Flag[] }> {
+  const url = toURL('/api/v1/flags')
+  url.searchParams.set('status', status)
+
+  const res = await fetch(url.toString(), {
+    headers: authHeaders(adminToken)
+  })
+  if (!res.ok) throw new Error('failed to list flags')
+  return res.json()
+}
+
+export async function resolveFlag(id: number, resolver: string, resolution: string, adminToken: string): Promise<Flag> {
+  const res = await fetch(apiUrl(`/api/v1/flags/${id}/resolve`), {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json', ...authHeaders(adminToken) },
+    body: JSON.stringify({ resolver, resolution })
+  })
+  if (!res.ok) throw new Error('failed to resolve flag')
+  return res.json()
+}
+
+export type InstanceStats = {
+  datasets: number
+  conversations: number
+  conversations_by_status: Record<string, number>
+  items: number
+  messages: number
+  pending_proposals: number
+  computed_at: string
+}
+
+export async function getInstanceStats(adminToken: string): Promise<InstanceStats> {
+  const res = await fetch(apiUrl('/api/v1/stats'), { headers: authHeaders(adminToken) })
+  if (!res.ok) throw new Error('failed to load stats')
+  return res.json()
+}
+
 // Export
+export type ExportOptions = {
+  types: string[]
+  formats: string[]
+  format_types: Record<string, string[]>
+  dataset_kinds: Record<'conversations' | 'items', string[]>
+  context: string[]
+  role_styles: string[]
+  templates: string[]
+  compress: string[]
+  quality_gates: string[]
+  group_by: string[]
+  interleave_types: string[]
+  max_chars_types: string[]
+  include_hash_types: string[]
+  with_source_types: string[]
+  on_oversize: string[]
+  dedup: string[]
+  dedup_types: string[]
+}
+
+export async function getExportOptions(): Promise<ExportOptions> {
+  const res = await fetch(apiUrl('/api/v1/export/options'))
+  if (!res.ok) throw new Error('failed to load export options')
+  return res.json()
+}
+
 export function exportUrl(params: {
-  type?: 'pairs' | 'conversations' | 'items' | 'items_with_meta'
+  type?: string
   dataset_id?: number
   split?: Split | 'all'
   status?: ConversationStatus
@@ -301,6 +769,12 @@ export function exportUrl(params: {
   context_turns?: number
   role_style?: 'labels' | 'plain'
   max_examples?: number
+  dedup?: 'semantic'
+  dedup_threshold?: number
+  model?: string
+  system_prompt?: string
+  min_quality?: number
+  meta_gte?: Record<string, number>
 }): string {
   const url = toURL('/api/v1/export.jsonl')
 
@@ -313,6 +787,12 @@ export function exportUrl(params: {
   if (params.context_turns != null) url.searchParams.set('context_turns', String(params.context_turns))
   if (params.role_style) url.searchParams.set('role_style', params.role_style)
   if (params.max_examples != null) url.searchParams.set('max_examples', String(params.max_examples))
+  if (params.dedup) url.searchParams.set('dedup', params.dedup)
+  if (params.dedup_threshold != null) url.searchParams.set('dedup_threshold', String(params.dedup_threshold))
+  if (params.model) url.searchParams.set('model', params.model)
+  if (params.system_prompt) url.searchParams.set('system_prompt', params.system_prompt)
+  if (params.min_quality != null) url.searchParams.set('min_quality', String(params.min_quality))
+  for (const [field, min] of Object.entries(params.meta_gte ?? {})) url.searchParams.append('meta_gte', `${field}:${min}`)
 
   return url.toString()
 }